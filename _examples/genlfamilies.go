@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/apuigsech/netlink/protocols/genetlink"
+)
+
+func main() {
+	gl, err := genetlink.OpenLink(0, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer gl.CloseLink()
+
+	families, err := gl.ListFamilies()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, f := range families {
+		fmt.Printf("%-16s id=%d version=%d ops=%d\n", f.Name, f.Id, f.Version, len(f.Ops))
+		for _, grp := range f.Groups {
+			fmt.Printf("\tgroup %s id=%d\n", grp.Name, grp.Id)
+		}
+	}
+}
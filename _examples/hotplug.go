@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/apuigsech/netlink/protocols/uevent"
+)
+
+func main() {
+	ul, err := uevent.OpenLink(uevent.UEVENT_GROUP_KERNEL, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer ul.CloseLink()
+
+	db := uevent.NewDeviceDB()
+	err = db.Coldplug()
+	if err != nil {
+		panic(err)
+	}
+
+	m := &uevent.Match{Subsystem: []string{"block"}, DevType: []string{"disk", "partition"}}
+	for _, d := range db.List(m) {
+		fmt.Printf("%-8s %s\n", d.DevNode, d.DevPath)
+	}
+
+	ec := make(chan error)
+	ul.StartUeventMonitor(m, func(ev *uevent.Uevent, ec chan error, args ...interface{}) {
+		db.Apply(ev)
+		fmt.Printf("%-8s %s %s\n", ev.Action, ev.Env["DEVNAME"], ev.DevPath)
+	}, ec)
+
+	for err := range ec {
+		fmt.Println("error:", err)
+		db.Coldplug()
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/apuigsech/netlink/protocols/route"
+)
+
+func main() {
+	rl, err := route.OpenLink(0, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer rl.CloseLink()
+
+	links, err := rl.ListLinks()
+	if err != nil {
+		panic(err)
+	}
+
+	for _, l := range links {
+		kind := ""
+		if l.Info != nil {
+			kind = l.Info.Kind()
+		}
+		fmt.Printf("%d: %s mtu %d state %d master %d %s %s\n", l.Index, l.Name, l.MTU, l.OperState, l.MasterIndex, l.HardwareAddr, kind)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/apuigsech/netlink/protocols/connector"
+)
+
+func main() {
+	cl, err := connector.OpenLink(0, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer cl.CloseLink()
+
+	err = cl.ProcListen()
+	if err != nil {
+		panic(err)
+	}
+
+	ec := make(chan error)
+	cl.StartProcMonitor(func(ev *connector.ProcEvent, ec chan error, args ...interface{}) {
+		switch {
+		case ev.Fork != nil:
+			fmt.Printf("fork %d -> %d\n", ev.Fork.ParentTgid, ev.Fork.ChildPid)
+		case ev.Exec != nil:
+			fmt.Printf("exec %d\n", ev.Exec.Pid)
+		case ev.Id != nil:
+			fmt.Printf("id %d ruid/rgid=%d euid/egid=%d\n", ev.Id.Pid, ev.Id.Real, ev.Id.Effective)
+		case ev.Comm != nil:
+			fmt.Printf("comm %d %q\n", ev.Comm.Pid, ev.Comm.Comm)
+		case ev.Exit != nil:
+			fmt.Printf("exit %d code=%d\n", ev.Exit.Pid, ev.Exit.ExitCode)
+		}
+	}, ec)
+
+	for err := range ec {
+		fmt.Println("error:", err)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+
+	"github.com/apuigsech/netlink/protocols/audit"
+	"github.com/apuigsech/netlink/protocols/sockdiag"
+)
+
+func main() {
+	sl, err := sockdiag.OpenLink(0, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer sl.CloseLink()
+
+	owners, err := sockdiag.SocketOwners()
+	if err != nil {
+		panic(err)
+	}
+
+	q := &sockdiag.InetDiagQuery{
+		Protocol: syscall.IPPROTO_TCP,
+		Ext:      sockdiag.InetDiagExt(sockdiag.INET_DIAG_INFO) | sockdiag.InetDiagExt(sockdiag.INET_DIAG_CONG),
+	}
+	sockets, err := sl.ListInetSockets(q)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, s := range sockets {
+		src := net.JoinHostPort(s.Id.Src.String(), strconv.Itoa(int(s.Id.SrcPort)))
+		dst := net.JoinHostPort(s.Id.Dst.String(), strconv.Itoa(int(s.Id.DstPort)))
+		fmt.Printf("tcp %-12s %6d %6d %-24s %-24s %s pids=%v\n", sockdiag.TcpStateName(s.State), s.RQueue, s.WQueue, src, dst, s.Cong, owners[s.Inode])
+	}
+
+	al, err := audit.OpenLink(0, 0)
+	if err != nil {
+		panic(err)
+	}
+	defer al.CloseLink()
+
+	st, err := al.GetStatus()
+	if err != nil {
+		panic(err)
+	}
+	if st.Pid == 0 {
+		fmt.Println("no audit daemon registered")
+		return
+	}
+
+	s, err := sl.FindNetlinkSocket(syscall.NETLINK_AUDIT, st.Pid)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Printf("audit pid %d: socket inode %d held by pids %v\n", st.Pid, s.Inode, owners[s.Inode])
+}
@@ -0,0 +1,193 @@
+package netlink
+
+import (
+	"encoding/binary"
+	"errors"
+	"unsafe"
+)
+
+const (
+	NLA_HDRLEN  = 4
+	NLA_ALIGNTO = 4
+
+	NLA_F_NESTED        = 0x8000
+	NLA_F_NET_BYTEORDER = 0x4000
+	NLA_TYPE_MASK       = ^uint16(NLA_F_NESTED | NLA_F_NET_BYTEORDER)
+)
+
+// NetlinkAttr is a single type-length-value attribute (struct nlattr). Data
+// holds the payload without the attribute header or padding.
+type NetlinkAttr struct {
+	Type uint16
+	Data []byte
+}
+
+func nlaAlignOf(attrlen int) int {
+	return (attrlen + NLA_ALIGNTO - 1) & ^(NLA_ALIGNTO - 1)
+}
+
+func NewAttr(attrtype uint16, data []byte) NetlinkAttr {
+	return NetlinkAttr{Type: attrtype, Data: data}
+}
+
+func NewAttrFlag(attrtype uint16) NetlinkAttr {
+	return NetlinkAttr{Type: attrtype, Data: []byte{}}
+}
+
+func NewAttrUint8(attrtype uint16, v uint8) NetlinkAttr {
+	return NetlinkAttr{Type: attrtype, Data: []byte{v}}
+}
+
+func NewAttrUint16(attrtype uint16, v uint16) NetlinkAttr {
+	b := make([]byte, 2)
+	*(*uint16)(unsafe.Pointer(&b[0])) = v
+	return NetlinkAttr{Type: attrtype, Data: b}
+}
+
+func NewAttrUint32(attrtype uint16, v uint32) NetlinkAttr {
+	b := make([]byte, 4)
+	*(*uint32)(unsafe.Pointer(&b[0])) = v
+	return NetlinkAttr{Type: attrtype, Data: b}
+}
+
+func NewAttrUint64(attrtype uint16, v uint64) NetlinkAttr {
+	b := make([]byte, 8)
+	*(*uint64)(unsafe.Pointer(&b[0])) = v
+	return NetlinkAttr{Type: attrtype, Data: b}
+}
+
+func NewAttrNetUint16(attrtype uint16, v uint16) NetlinkAttr {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return NetlinkAttr{Type: attrtype, Data: b}
+}
+
+func NewAttrNetUint32(attrtype uint16, v uint32) NetlinkAttr {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, v)
+	return NetlinkAttr{Type: attrtype, Data: b}
+}
+
+func NewAttrNetUint64(attrtype uint16, v uint64) NetlinkAttr {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return NetlinkAttr{Type: attrtype, Data: b}
+}
+
+// NewAttrString returns a NUL terminated string attribute.
+func NewAttrString(attrtype uint16, s string) NetlinkAttr {
+	return NetlinkAttr{Type: attrtype, Data: []byte(s + "\x00")}
+}
+
+func NewAttrNested(attrtype uint16, attrs []NetlinkAttr) NetlinkAttr {
+	return NetlinkAttr{Type: attrtype | NLA_F_NESTED, Data: AttrsToWireFormat(attrs)}
+}
+
+func (attr *NetlinkAttr) AttrType() uint16 {
+	return attr.Type & NLA_TYPE_MASK
+}
+
+func (attr *NetlinkAttr) IsNested() bool {
+	return attr.Type&NLA_F_NESTED != 0
+}
+
+func (attr *NetlinkAttr) Uint8() uint8 {
+	if len(attr.Data) < 1 {
+		return 0
+	}
+	return attr.Data[0]
+}
+
+func (attr *NetlinkAttr) Uint16() uint16 {
+	if len(attr.Data) < 2 {
+		return 0
+	}
+	return *(*uint16)(unsafe.Pointer(&attr.Data[0:2][0]))
+}
+
+func (attr *NetlinkAttr) Uint32() uint32 {
+	if len(attr.Data) < 4 {
+		return 0
+	}
+	return *(*uint32)(unsafe.Pointer(&attr.Data[0:4][0]))
+}
+
+func (attr *NetlinkAttr) Uint64() uint64 {
+	if len(attr.Data) < 8 {
+		return 0
+	}
+	return *(*uint64)(unsafe.Pointer(&attr.Data[0:8][0]))
+}
+
+func (attr *NetlinkAttr) NetUint16() uint16 {
+	if len(attr.Data) < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(attr.Data)
+}
+
+func (attr *NetlinkAttr) NetUint32() uint32 {
+	if len(attr.Data) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(attr.Data)
+}
+
+func (attr *NetlinkAttr) NetUint64() uint64 {
+	if len(attr.Data) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(attr.Data)
+}
+
+// String returns the attribute payload up to the first NUL byte.
+func (attr *NetlinkAttr) String() string {
+	for i, c := range attr.Data {
+		if c == 0 {
+			return string(attr.Data[:i])
+		}
+	}
+	return string(attr.Data)
+}
+
+func (attr *NetlinkAttr) Nested() ([]NetlinkAttr, error) {
+	return ParseNetlinkAttrs(attr.Data)
+}
+
+func (attr *NetlinkAttr) ToWireFormat() []byte {
+	l := NLA_HDRLEN + len(attr.Data)
+	b := make([]byte, nlaAlignOf(l))
+	*(*uint16)(unsafe.Pointer(&b[0:2][0])) = uint16(l)
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = attr.Type
+	copy(b[NLA_HDRLEN:], attr.Data)
+	return b
+}
+
+func AttrsToWireFormat(attrs []NetlinkAttr) []byte {
+	b := []byte{}
+	for _, attr := range attrs {
+		b = append(b, attr.ToWireFormat()...)
+	}
+	return b
+}
+
+func ParseNetlinkAttrs(b []byte) ([]NetlinkAttr, error) {
+	attrs := []NetlinkAttr{}
+
+	for len(b) >= NLA_HDRLEN {
+		l := int(*(*uint16)(unsafe.Pointer(&b[0:2][0])))
+		t := *(*uint16)(unsafe.Pointer(&b[2:4][0]))
+		if l < NLA_HDRLEN || l > len(b) {
+			return nil, errors.New("attribute out of range")
+		}
+		attrs = append(attrs, NetlinkAttr{Type: t, Data: b[NLA_HDRLEN:l]})
+
+		l = nlaAlignOf(l)
+		if l > len(b) {
+			break
+		}
+		b = b[l:]
+	}
+
+	return attrs, nil
+}
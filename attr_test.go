@@ -0,0 +1,161 @@
+package netlink
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+func TestAttrToWireFormat(t *testing.T) {
+	tests := []struct {
+		attr NetlinkAttr
+		want []byte
+	}{
+		{NewAttrFlag(1), []byte{4, 0, 1, 0}},
+		{NewAttrUint8(2, 0x7f), []byte{5, 0, 2, 0, 0x7f, 0, 0, 0}},
+		{NewAttrNetUint16(3, 0x1234), []byte{6, 0, 3, 0, 0x12, 0x34, 0, 0}},
+		{NewAttrNetUint32(4, 0x01020304), []byte{8, 0, 4, 0, 1, 2, 3, 4}},
+		{NewAttrString(5, "lo"), []byte{7, 0, 5, 0, 'l', 'o', 0, 0}},
+	}
+
+	for _, tt := range tests {
+		got := tt.attr.ToWireFormat()
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("attr %d: got % x, want % x", tt.attr.Type, got, tt.want)
+		}
+	}
+}
+
+func TestAttrValues(t *testing.T) {
+	attrs := []NetlinkAttr{
+		NewAttrUint8(1, 0xab),
+		NewAttrUint16(2, 0xabcd),
+		NewAttrUint32(3, 0xdeadbeef),
+		NewAttrUint64(4, 0x0102030405060708),
+		NewAttrNetUint16(5, 0xabcd),
+		NewAttrNetUint32(6, 0xdeadbeef),
+		NewAttrNetUint64(7, 0x0102030405060708),
+		NewAttrString(8, "eth0"),
+	}
+
+	parsed, err := ParseNetlinkAttrs(AttrsToWireFormat(attrs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(attrs) {
+		t.Fatalf("got %d attributes, want %d", len(parsed), len(attrs))
+	}
+
+	if v := parsed[0].Uint8(); v != 0xab {
+		t.Errorf("Uint8 = %#x", v)
+	}
+	if v := parsed[1].Uint16(); v != 0xabcd {
+		t.Errorf("Uint16 = %#x", v)
+	}
+	if v := parsed[2].Uint32(); v != 0xdeadbeef {
+		t.Errorf("Uint32 = %#x", v)
+	}
+	if v := parsed[3].Uint64(); v != 0x0102030405060708 {
+		t.Errorf("Uint64 = %#x", v)
+	}
+	if v := parsed[4].NetUint16(); v != 0xabcd {
+		t.Errorf("NetUint16 = %#x", v)
+	}
+	if v := parsed[5].NetUint32(); v != 0xdeadbeef {
+		t.Errorf("NetUint32 = %#x", v)
+	}
+	if v := parsed[6].NetUint64(); v != 0x0102030405060708 {
+		t.Errorf("NetUint64 = %#x", v)
+	}
+	if v := parsed[7].String(); v != "eth0" {
+		t.Errorf("String = %q", v)
+	}
+}
+
+func TestAttrShortData(t *testing.T) {
+	attr := NewAttrFlag(1)
+	if attr.Uint8() != 0 || attr.Uint16() != 0 || attr.Uint32() != 0 || attr.Uint64() != 0 {
+		t.Error("empty attribute decoded to a non zero value")
+	}
+	if attr.NetUint16() != 0 || attr.NetUint32() != 0 || attr.NetUint64() != 0 {
+		t.Error("empty attribute decoded to a non zero value")
+	}
+
+	attr = NewAttr(2, []byte("no nul"))
+	if s := attr.String(); s != "no nul" {
+		t.Errorf("String = %q", s)
+	}
+}
+
+func TestAttrNested(t *testing.T) {
+	inner := []NetlinkAttr{
+		NewAttrUint32(1, 42),
+		NewAttrString(2, "abc"),
+	}
+	outer := NewAttrNested(7, inner)
+
+	if !outer.IsNested() || outer.AttrType() != 7 {
+		t.Fatalf("type %#x: not nested attribute 7", outer.Type)
+	}
+
+	parsed, err := ParseNetlinkAttrs(outer.ToWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 1 || parsed[0].AttrType() != 7 || !parsed[0].IsNested() {
+		t.Fatalf("got %+v", parsed)
+	}
+
+	children, err := parsed[0].Nested()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(children) != 2 || children[0].Uint32() != 42 || children[1].String() != "abc" {
+		t.Errorf("got %+v", children)
+	}
+}
+
+func TestParseNetlinkAttrsErrors(t *testing.T) {
+	/* length beyond the buffer */
+	_, err := ParseNetlinkAttrs([]byte{12, 0, 1, 0, 0, 0, 0, 0})
+	if err == nil {
+		t.Error("attribute past the end of the buffer was accepted")
+	}
+
+	/* length shorter than the header */
+	_, err = ParseNetlinkAttrs([]byte{2, 0, 1, 0})
+	if err == nil {
+		t.Error("attribute shorter than its header was accepted")
+	}
+
+	/* the last attribute may come without its padding */
+	attrs, err := ParseNetlinkAttrs([]byte{5, 0, 1, 0, 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(attrs) != 1 || attrs[0].Uint8() != 9 {
+		t.Errorf("got %+v", attrs)
+	}
+}
+
+func TestMessageToWireFormat(t *testing.T) {
+	msg := &NetlinkMessage{
+		Header: syscall.NlMsghdr{Type: 0x10, Flags: syscall.NLM_F_REQUEST, Seq: 3, Pid: 4},
+		Data:   []byte{1, 2, 3, 4},
+	}
+
+	want := []byte{
+		20, 0, 0, 0,
+		0x10, 0,
+		syscall.NLM_F_REQUEST, 0,
+		3, 0, 0, 0,
+		4, 0, 0, 0,
+		1, 2, 3, 4,
+	}
+	if got := msg.toWireFormat(); !bytes.Equal(got, want) {
+		t.Errorf("got % x, want % x", got, want)
+	}
+	if msg.Header.Len != 20 {
+		t.Errorf("Header.Len = %d", msg.Header.Len)
+	}
+}
@@ -7,6 +7,10 @@ import (
 
 type NetlinkMessage syscall.NetlinkMessage
 
+func nlmAlignOf(msglen int) int {
+	return (msglen + syscall.NLMSG_ALIGNTO - 1) & ^(syscall.NLMSG_ALIGNTO - 1)
+}
+
 func (msg *NetlinkMessage) toWireFormat() []byte {
 	// Make sure Header.Len has the right value
 	msg.Header.Len = syscall.NLMSG_HDRLEN + uint32(len(msg.Data))
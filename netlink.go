@@ -4,6 +4,24 @@ import (
 	"errors"
 	"sync"
 	"syscall"
+	"unsafe"
+)
+
+const (
+	RECV_BUFFER_SIZE = 65536
+
+	SOL_NETLINK             = 270
+	NETLINK_ADD_MEMBERSHIP  = 1
+	NETLINK_DROP_MEMBERSHIP = 2
+	NETLINK_BROADCAST_ERROR = 4
+	NETLINK_NO_ENOBUFS      = 5
+	NETLINK_LISTEN_ALL_NSID = 8
+	NETLINK_CAP_ACK         = 10
+	NETLINK_EXT_ACK         = 11
+	NETLINK_GET_STRICT_CHK  = 12
+
+	NLM_F_DUMP_INTR     = 0x10
+	NLM_F_DUMP_FILTERED = 0x20
 )
 
 type NetlinkSocket struct {
@@ -62,6 +80,156 @@ func (nl *NetlinkSocket) SendMessage(msg *NetlinkMessage, sockflags int, ack boo
 	return nil
 }
 
+// SendMessages sends msgs in a single datagram, each with its own sequence
+// number, as required by protocols that process messages in batches.
+func (nl *NetlinkSocket) SendMessages(msgs []*NetlinkMessage, sockflags int) error {
+	b := []byte{}
+
+	for _, msg := range msgs {
+		msg.Header.Seq = nl.nextSeq()
+		logf("sent: %+v\n", msg)
+		w := msg.toWireFormat()
+		b = append(b, w...)
+		b = append(b, make([]byte, nlmAlignOf(len(w))-len(w))...)
+	}
+
+	err := syscall.Sendto(nl.sfd, b, sockflags, &nl.lsa)
+	if err == syscall.EMSGSIZE {
+		// Grow the send buffer to fit the whole datagram and retry.
+		err = syscall.SetsockoptInt(nl.sfd, syscall.SOL_SOCKET, syscall.SO_SNDBUFFORCE, len(b))
+		if err != nil {
+			return err
+		}
+		err = syscall.Sendto(nl.sfd, b, sockflags, &nl.lsa)
+	}
+	return err
+}
+
+// Execute sends msg asking for an acknowledgement and collects every reply
+// that carries its sequence number, until the kernel acknowledges the request
+// or terminates a multipart dump. Unrelated messages are discarded.
+func (nl *NetlinkSocket) Execute(msg *NetlinkMessage, sockflags int) ([]NetlinkMessage, error) {
+	msg.Header.Flags = msg.Header.Flags | syscall.NLM_F_REQUEST | syscall.NLM_F_ACK
+
+	err := nl.SendMessage(msg, sockflags, false)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []NetlinkMessage{}
+
+	for {
+		msgList, err := nl.RecvMessages(RECV_BUFFER_SIZE, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, m := range msgList {
+			if m.Header.Seq != msg.Header.Seq {
+				continue
+			}
+
+			switch m.Header.Type {
+			case syscall.NLMSG_DONE:
+				if len(m.Data) >= 4 {
+					if errno := *(*int32)(unsafe.Pointer(&m.Data[0:4][0])); errno < 0 {
+						return nil, syscall.Errno(-errno)
+					}
+				}
+				return ret, nil
+			case syscall.NLMSG_ERROR:
+				err := ParseErrorMessage(&m)
+				if err != nil {
+					return nil, err
+				}
+				return ret, nil
+			}
+
+			ret = append(ret, m)
+		}
+	}
+}
+
+// ParseErrorMessage returns the error carried by a NLMSG_ERROR message, or
+// nil if the message is an acknowledgement.
+func ParseErrorMessage(msg *NetlinkMessage) error {
+	if len(msg.Data) < 4 {
+		return syscall.EINVAL
+	}
+
+	errno := *(*int32)(unsafe.Pointer(&msg.Data[0:4][0]))
+	if errno == 0 {
+		return nil
+	}
+
+	return syscall.Errno(-errno)
+}
+
+// autobind binds the socket to a kernel assigned port id if it has none yet.
+// Multicast notifications are not delivered to unbound sockets.
+func (nl *NetlinkSocket) autobind() error {
+	sa, err := syscall.Getsockname(nl.sfd)
+	if err != nil {
+		return err
+	}
+	if nsa, ok := sa.(*syscall.SockaddrNetlink); ok && nsa.Pid != 0 {
+		return nil
+	}
+	return syscall.Bind(nl.sfd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+func (nl *NetlinkSocket) AddMembership(group uint32) error {
+	err := nl.autobind()
+	if err != nil {
+		return err
+	}
+	return syscall.SetsockoptInt(nl.sfd, SOL_NETLINK, NETLINK_ADD_MEMBERSHIP, int(group))
+}
+
+func (nl *NetlinkSocket) DropMembership(group uint32) error {
+	return syscall.SetsockoptInt(nl.sfd, SOL_NETLINK, NETLINK_DROP_MEMBERSHIP, int(group))
+}
+
+// SetStrictCheck asks the kernel to validate dump request headers strictly
+// and to filter dumps by the values set in them. It fails on kernels older
+// than 4.20.
+func (nl *NetlinkSocket) SetStrictCheck(enable bool) error {
+	v := 0
+	if enable {
+		v = 1
+	}
+	return syscall.SetsockoptInt(nl.sfd, SOL_NETLINK, NETLINK_GET_STRICT_CHK, v)
+}
+
+// StrictCheck reports whether strict checking is enabled on the socket.
+func (nl *NetlinkSocket) StrictCheck() (bool, error) {
+	v, err := syscall.GetsockoptInt(nl.sfd, SOL_NETLINK, NETLINK_GET_STRICT_CHK)
+	if err != nil {
+		return false, err
+	}
+	return v != 0, nil
+}
+
+// SetCapAck asks the kernel not to echo the request in error messages, which
+// keeps them small when large batches of requests fail.
+func (nl *NetlinkSocket) SetCapAck(enable bool) error {
+	v := 0
+	if enable {
+		v = 1
+	}
+	return syscall.SetsockoptInt(nl.sfd, SOL_NETLINK, NETLINK_CAP_ACK, v)
+}
+
+// SetPassCred asks the kernel to pass the credentials of the sender along
+// with every datagram, see RecvMessagesRawFrom.
+func (nl *NetlinkSocket) SetPassCred(enable bool) error {
+	v := 0
+	if enable {
+		v = 1
+	}
+	return syscall.SetsockoptInt(nl.sfd, syscall.SOL_SOCKET, syscall.SO_PASSCRED, v)
+}
+
 func (nl *NetlinkSocket) nextSeq() uint32 {
 	nl.mu.Lock()
 	defer nl.mu.Unlock()
@@ -82,7 +250,14 @@ func (nl *NetlinkSocket) RecvMessages(sz, sockflags int) ([]NetlinkMessage, erro
 		return nil, syscall.EINVAL
 	}
 
-	msgList, err := syscall.ParseNetlinkMessage(buf[:rsz])
+	// The last message may not be padded, as when it ends with a packet
+	// payload, while ParseNetlinkMessage expects it to be.
+	b := buf[:rsz]
+	if n := nlmAlignOf(rsz); n > rsz {
+		b = append(b, make([]byte, n-rsz)...)
+	}
+
+	msgList, err := syscall.ParseNetlinkMessage(b)
 	if err != nil {
 		return nil, err
 	}
@@ -108,3 +283,29 @@ func (nl *NetlinkSocket) RecvMessagesRaw(sz, sockflags int) ([]byte, error) {
 
 	return buf[:rsz], nil
 }
+
+// RecvMessagesRawFrom receives a datagram like RecvMessagesRaw, along with
+// the address of its sender and, with SetPassCred enabled, its credentials.
+func (nl *NetlinkSocket) RecvMessagesRawFrom(sz, sockflags int) ([]byte, *syscall.SockaddrNetlink, *syscall.Ucred, error) {
+	buf := make([]byte, sz)
+	oob := make([]byte, syscall.CmsgSpace(syscall.SizeofUcred))
+
+	rsz, oobn, _, from, err := syscall.Recvmsg(nl.sfd, buf, oob, sockflags)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	sa, _ := from.(*syscall.SockaddrNetlink)
+
+	var cred *syscall.Ucred
+	cmsgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err == nil {
+		for _, cmsg := range cmsgs {
+			if c, err := syscall.ParseUnixCredentials(&cmsg); err == nil {
+				cred = c
+			}
+		}
+	}
+
+	return buf[:rsz], sa, cred, nil
+}
@@ -0,0 +1,121 @@
+package connector
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+type ConnectorNLSocket netlink.NetlinkSocket
+
+// CnMsg is a connector message. Idx and Val identify the kernel user it is
+// for or comes from, Ack is echoed by the kernel users that answer.
+type CnMsg struct {
+	Idx   uint32
+	Val   uint32
+	Seq   uint32
+	Ack   uint32
+	Flags uint16
+	Data  []byte
+}
+
+func CnMsgfromWireFormat(data []byte) (*CnMsg, error) {
+	if len(data) < SizeofCnMsg {
+		return nil, errors.New("short cn_msg")
+	}
+
+	n := int(*(*uint16)(unsafe.Pointer(&data[16:18][0])))
+	if SizeofCnMsg+n > len(data) {
+		return nil, errors.New("truncated cn_msg")
+	}
+
+	return &CnMsg{
+		Idx:   *(*uint32)(unsafe.Pointer(&data[0:4][0])),
+		Val:   *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		Seq:   *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+		Ack:   *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+		Flags: *(*uint16)(unsafe.Pointer(&data[18:20][0])),
+		Data:  data[SizeofCnMsg : SizeofCnMsg+n],
+	}, nil
+}
+
+func (m *CnMsg) toWireFormat() []byte {
+	b := make([]byte, SizeofCnMsg+len(m.Data))
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = m.Idx
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = m.Val
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = m.Seq
+	*(*uint32)(unsafe.Pointer(&b[12:16][0])) = m.Ack
+	*(*uint16)(unsafe.Pointer(&b[16:18][0])) = uint16(len(m.Data))
+	*(*uint16)(unsafe.Pointer(&b[18:20][0])) = m.Flags
+	copy(b[SizeofCnMsg:], m.Data)
+	return b
+}
+
+func OpenLink(group, pid uint32) (*ConnectorNLSocket, error) {
+	nl, err := netlink.OpenLink(NETLINK_CONNECTOR, group, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*ConnectorNLSocket)(nl), nil
+}
+
+func (cl *ConnectorNLSocket) CloseLink() error {
+	nl := (*netlink.NetlinkSocket)(cl)
+	return nl.CloseLink()
+}
+
+func (cl *ConnectorNLSocket) AddMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(cl)
+	return nl.AddMembership(group)
+}
+
+func (cl *ConnectorNLSocket) DropMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(cl)
+	return nl.DropMembership(group)
+}
+
+// RecvMessages receives the connector messages of a datagram.
+func (cl *ConnectorNLSocket) RecvMessages(sz int, sockflags int) ([]*CnMsg, error) {
+	nl := (*netlink.NetlinkSocket)(cl)
+	msgList, err := nl.RecvMessages(sz, sockflags)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*CnMsg{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type == syscall.NLMSG_ERROR {
+			err := netlink.ParseErrorMessage(&msg)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		m, err := CnMsgfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+
+	return ret, nil
+}
+
+// Send sends a connector message to the kernel, as a NLMSG_DONE message
+// like the kernel sends them. Connector users do not acknowledge messages,
+// a reply, if any, has to be received by the caller.
+func (cl *ConnectorNLSocket) Send(m *CnMsg) error {
+	nl := (*netlink.NetlinkSocket)(cl)
+	msg := &netlink.NetlinkMessage{
+		Header: syscall.NlMsghdr{
+			Type: syscall.NLMSG_DONE,
+		},
+		Data: m.toWireFormat(),
+	}
+
+	return nl.SendMessage(msg, 0, false)
+}
@@ -0,0 +1,32 @@
+package connector
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestCnMsgWireFormat(t *testing.T) {
+	m := &CnMsg{Idx: CN_IDX_PROC, Val: CN_VAL_PROC, Seq: 7, Ack: 8, Flags: 3, Data: []byte{1, 2, 3}}
+	b := m.toWireFormat()
+	if len(b) != SizeofCnMsg+3 || *(*uint16)(unsafe.Pointer(&b[16])) != 3 || !bytes.Equal(b[SizeofCnMsg:], m.Data) {
+		t.Errorf("got % x", b)
+	}
+
+	/* bytes past the length of the data are padding */
+	got, err := CnMsgfromWireFormat(append(b, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, m) {
+		t.Errorf("got %+v, want %+v", got, m)
+	}
+
+	if _, err := CnMsgfromWireFormat(b[:SizeofCnMsg-1]); err == nil {
+		t.Error("short message parsed")
+	}
+	if _, err := CnMsgfromWireFormat(b[:SizeofCnMsg+2]); err == nil {
+		t.Error("truncated message parsed")
+	}
+}
@@ -0,0 +1,49 @@
+package connector
+
+const (
+	NETLINK_CONNECTOR = 11
+
+	SizeofCbId         = 8
+	SizeofCnMsg        = 20
+	SizeofProcEventHdr = 16
+
+	/* Connector indexes, also the multicast group the messages are sent to */
+	CN_IDX_PROC             = 0x1
+	CN_VAL_PROC             = 0x1
+	CN_IDX_CIFS             = 0x2
+	CN_VAL_CIFS             = 0x1
+	CN_W1_IDX               = 0x3
+	CN_W1_VAL               = 0x1
+	CN_IDX_V86D             = 0x4
+	CN_VAL_V86D_UVESAFB     = 0x2
+	CN_IDX_BB               = 0x5
+	CN_DST_IDX              = 0x6
+	CN_DST_VAL              = 0x1
+	CN_IDX_DM               = 0x7
+	CN_VAL_DM_USERSPACE_LOG = 0x1
+	CN_IDX_DRBD             = 0x8
+	CN_VAL_DRBD             = 0x1
+	CN_KVP_IDX              = 0x9
+	CN_KVP_VAL              = 0x1
+	CN_VSS_IDX              = 0xa
+	CN_VSS_VAL              = 0x1
+
+	CN_NETLINK_USERS = 11
+
+	/* proc connector control operations */
+	PROC_CN_MCAST_LISTEN = 1
+	PROC_CN_MCAST_IGNORE = 2
+
+	/* proc connector events */
+	PROC_EVENT_NONE         = 0x00000000
+	PROC_EVENT_FORK         = 0x00000001
+	PROC_EVENT_EXEC         = 0x00000002
+	PROC_EVENT_UID          = 0x00000004
+	PROC_EVENT_GID          = 0x00000040
+	PROC_EVENT_SID          = 0x00000080
+	PROC_EVENT_PTRACE       = 0x00000100
+	PROC_EVENT_COMM         = 0x00000200
+	PROC_EVENT_NONZERO_EXIT = 0x20000000
+	PROC_EVENT_COREDUMP     = 0x40000000
+	PROC_EVENT_EXIT         = 0x80000000
+)
@@ -0,0 +1,260 @@
+package connector
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+// ProcEvent is a process event of the proc connector. What is one of the
+// PROC_EVENT_* values and exactly one of the event fields is set
+// accordingly. UID and GID changes are both reported in Id. Timestamp is
+// the time since boot the event happened at. Events with What set to
+// PROC_EVENT_NONE acknowledge a listen or ignore request, with Err the
+// errno it failed with.
+type ProcEvent struct {
+	What      uint32
+	Cpu       uint32
+	Timestamp time.Duration
+	Err       uint32
+	Fork      *ProcForkEvent
+	Exec      *ProcExecEvent
+	Id        *ProcIdEvent
+	Sid       *ProcSidEvent
+	Ptrace    *ProcPtraceEvent
+	Comm      *ProcCommEvent
+	Coredump  *ProcCoredumpEvent
+	Exit      *ProcExitEvent
+}
+
+type ProcForkEvent struct {
+	ParentPid  int32
+	ParentTgid int32
+	ChildPid   int32
+	ChildTgid  int32
+}
+
+type ProcExecEvent struct {
+	Pid  int32
+	Tgid int32
+}
+
+// ProcIdEvent holds the new real and effective uid, or gid, of a process.
+type ProcIdEvent struct {
+	Pid       int32
+	Tgid      int32
+	Real      uint32
+	Effective uint32
+}
+
+type ProcSidEvent struct {
+	Pid  int32
+	Tgid int32
+}
+
+// ProcPtraceEvent reports a process being attached to by a tracer, or
+// detached when TracerPid is zero.
+type ProcPtraceEvent struct {
+	Pid        int32
+	Tgid       int32
+	TracerPid  int32
+	TracerTgid int32
+}
+
+type ProcCommEvent struct {
+	Pid  int32
+	Tgid int32
+	Comm string
+}
+
+type ProcCoredumpEvent struct {
+	Pid        int32
+	Tgid       int32
+	ParentPid  int32
+	ParentTgid int32
+}
+
+// ProcExitEvent reports a task exiting. ExitCode is in the format of wait
+// status and ExitSignal the signal sent to the parent, SIGCHLD for most
+// processes and -1 for threads.
+type ProcExitEvent struct {
+	Pid        int32
+	Tgid       int32
+	ExitCode   uint32
+	ExitSignal int32
+	ParentPid  int32
+	ParentTgid int32
+}
+
+type ProcEventCallback func(*ProcEvent, chan error, ...interface{})
+
+// procEventDataSize is the size of the data of every event.
+var procEventDataSize = map[uint32]int{
+	PROC_EVENT_NONE:     4,
+	PROC_EVENT_FORK:     16,
+	PROC_EVENT_EXEC:     8,
+	PROC_EVENT_UID:      16,
+	PROC_EVENT_GID:      16,
+	PROC_EVENT_SID:      8,
+	PROC_EVENT_PTRACE:   16,
+	PROC_EVENT_COMM:     24,
+	PROC_EVENT_COREDUMP: 16,
+	PROC_EVENT_EXIT:     24,
+}
+
+func procInt32(data []byte, i int) int32 {
+	return *(*int32)(unsafe.Pointer(&data[i*4 : i*4+4][0]))
+}
+
+func ProcEventfromWireFormat(data []byte) (*ProcEvent, error) {
+	if len(data) < SizeofProcEventHdr {
+		return nil, errors.New("short proc_event")
+	}
+
+	ev := &ProcEvent{
+		What:      *(*uint32)(unsafe.Pointer(&data[0:4][0])),
+		Cpu:       *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		Timestamp: time.Duration(*(*uint64)(unsafe.Pointer(&data[8:16][0]))),
+	}
+
+	d := data[SizeofProcEventHdr:]
+	if n, ok := procEventDataSize[ev.What]; ok && len(d) < n {
+		return nil, errors.New("short proc_event data")
+	}
+
+	switch ev.What {
+	case PROC_EVENT_NONE:
+		ev.Err = uint32(procInt32(d, 0))
+	case PROC_EVENT_FORK:
+		ev.Fork = &ProcForkEvent{
+			ParentPid:  procInt32(d, 0),
+			ParentTgid: procInt32(d, 1),
+			ChildPid:   procInt32(d, 2),
+			ChildTgid:  procInt32(d, 3),
+		}
+	case PROC_EVENT_EXEC:
+		ev.Exec = &ProcExecEvent{
+			Pid:  procInt32(d, 0),
+			Tgid: procInt32(d, 1),
+		}
+	case PROC_EVENT_UID, PROC_EVENT_GID:
+		ev.Id = &ProcIdEvent{
+			Pid:       procInt32(d, 0),
+			Tgid:      procInt32(d, 1),
+			Real:      uint32(procInt32(d, 2)),
+			Effective: uint32(procInt32(d, 3)),
+		}
+	case PROC_EVENT_SID:
+		ev.Sid = &ProcSidEvent{
+			Pid:  procInt32(d, 0),
+			Tgid: procInt32(d, 1),
+		}
+	case PROC_EVENT_PTRACE:
+		ev.Ptrace = &ProcPtraceEvent{
+			Pid:        procInt32(d, 0),
+			Tgid:       procInt32(d, 1),
+			TracerPid:  procInt32(d, 2),
+			TracerTgid: procInt32(d, 3),
+		}
+	case PROC_EVENT_COMM:
+		ev.Comm = &ProcCommEvent{
+			Pid:  procInt32(d, 0),
+			Tgid: procInt32(d, 1),
+			Comm: string(d[8:24]),
+		}
+		if i := strings.IndexByte(ev.Comm.Comm, 0); i >= 0 {
+			ev.Comm.Comm = ev.Comm.Comm[:i]
+		}
+	case PROC_EVENT_COREDUMP:
+		ev.Coredump = &ProcCoredumpEvent{
+			Pid:        procInt32(d, 0),
+			Tgid:       procInt32(d, 1),
+			ParentPid:  procInt32(d, 2),
+			ParentTgid: procInt32(d, 3),
+		}
+	case PROC_EVENT_EXIT:
+		ev.Exit = &ProcExitEvent{
+			Pid:        procInt32(d, 0),
+			Tgid:       procInt32(d, 1),
+			ExitCode:   uint32(procInt32(d, 2)),
+			ExitSignal: procInt32(d, 3),
+			ParentPid:  procInt32(d, 4),
+			ParentTgid: procInt32(d, 5),
+		}
+	}
+
+	return ev, nil
+}
+
+func (cl *ConnectorNLSocket) procControl(op uint32) error {
+	b := make([]byte, 4)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = op
+	return cl.Send(&CnMsg{Idx: CN_IDX_PROC, Val: CN_VAL_PROC, Data: b})
+}
+
+// ProcListen joins the proc connector group and asks the kernel to start
+// sending process events. It needs CAP_NET_ADMIN in the initial namespaces.
+// The kernel keeps sending events as long as one socket is listening.
+func (cl *ConnectorNLSocket) ProcListen() error {
+	err := cl.AddMembership(CN_IDX_PROC)
+	if err != nil {
+		return err
+	}
+	return cl.procControl(PROC_CN_MCAST_LISTEN)
+}
+
+// ProcIgnore tells the kernel the socket no longer listens to process
+// events and leaves the group.
+func (cl *ConnectorNLSocket) ProcIgnore() error {
+	err := cl.procControl(PROC_CN_MCAST_IGNORE)
+	if err != nil {
+		return err
+	}
+	return cl.DropMembership(CN_IDX_PROC)
+}
+
+// StartProcMonitor calls cb for every process event received once
+// ProcListen was called. A failed listen request is reported on ec, as are
+// events lost because the socket could not keep up, as ENOBUFS.
+func (cl *ConnectorNLSocket) StartProcMonitor(cb ProcEventCallback, ec chan error, args ...interface{}) error {
+	go func() {
+		for {
+			msgList, err := cl.RecvMessages(netlink.RECV_BUFFER_SIZE, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			for _, m := range msgList {
+				if m.Idx != CN_IDX_PROC || m.Val != CN_VAL_PROC {
+					continue
+				}
+				ev, err := ProcEventfromWireFormat(m.Data)
+				if err != nil {
+					if ec != nil {
+						ec <- err
+					}
+					continue
+				}
+				if ev.What == PROC_EVENT_NONE {
+					if ev.Err != 0 && ec != nil {
+						ec <- syscall.Errno(ev.Err)
+					}
+					continue
+				}
+				cb(ev, ec, args...)
+			}
+		}
+	}()
+
+	return nil
+}
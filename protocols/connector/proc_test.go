@@ -0,0 +1,204 @@
+package connector
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// procEventData builds a proc_event with the given event data.
+func procEventData(what uint32, data ...int32) []byte {
+	b := make([]byte, SizeofProcEventHdr+4*len(data))
+	*(*uint32)(unsafe.Pointer(&b[0])) = what
+	*(*uint32)(unsafe.Pointer(&b[4])) = 2
+	*(*uint64)(unsafe.Pointer(&b[8])) = uint64(5 * time.Second)
+	for i, v := range data {
+		*(*int32)(unsafe.Pointer(&b[SizeofProcEventHdr+4*i])) = v
+	}
+	return b
+}
+
+func TestProcEventfromWireFormat(t *testing.T) {
+	comm := procEventData(PROC_EVENT_COMM, 10, 11, 0, 0, 0, 0)
+	copy(comm[SizeofProcEventHdr+8:], "worker")
+
+	tests := []struct {
+		data []byte
+		want *ProcEvent
+	}{
+		{procEventData(PROC_EVENT_NONE, 1), &ProcEvent{Err: 1}},
+		{procEventData(PROC_EVENT_FORK, 1, 2, 3, 4), &ProcEvent{Fork: &ProcForkEvent{1, 2, 3, 4}}},
+		{procEventData(PROC_EVENT_EXEC, 1, 2), &ProcEvent{Exec: &ProcExecEvent{1, 2}}},
+		{procEventData(PROC_EVENT_UID, 1, 2, 0, 1000), &ProcEvent{Id: &ProcIdEvent{1, 2, 0, 1000}}},
+		{procEventData(PROC_EVENT_GID, 1, 2, 100, 100), &ProcEvent{Id: &ProcIdEvent{1, 2, 100, 100}}},
+		{procEventData(PROC_EVENT_SID, 1, 2), &ProcEvent{Sid: &ProcSidEvent{1, 2}}},
+		{procEventData(PROC_EVENT_PTRACE, 1, 2, 3, 4), &ProcEvent{Ptrace: &ProcPtraceEvent{1, 2, 3, 4}}},
+		{comm, &ProcEvent{Comm: &ProcCommEvent{10, 11, "worker"}}},
+		{procEventData(PROC_EVENT_COREDUMP, 1, 2, 3, 4), &ProcEvent{Coredump: &ProcCoredumpEvent{1, 2, 3, 4}}},
+		/* threads exit with a signal of -1 */
+		{procEventData(PROC_EVENT_EXIT, 1, 2, 3<<8, -1, 5, 6), &ProcEvent{Exit: &ProcExitEvent{1, 2, 3 << 8, -1, 5, 6}}},
+		/* events this package does not know are passed along */
+		{procEventData(0x1000, 1), &ProcEvent{}},
+	}
+
+	for _, test := range tests {
+		want := *test.want
+		want.What = *(*uint32)(unsafe.Pointer(&test.data[0]))
+		want.Cpu = 2
+		want.Timestamp = 5 * time.Second
+		got, err := ProcEventfromWireFormat(test.data)
+		if err != nil {
+			t.Errorf("%#x: %v", want.What, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, &want) {
+			t.Errorf("got %+v, want %+v", got, &want)
+		}
+	}
+
+	if _, err := ProcEventfromWireFormat(make([]byte, SizeofProcEventHdr-1)); err == nil {
+		t.Error("short header parsed")
+	}
+	if _, err := ProcEventfromWireFormat(procEventData(PROC_EVENT_EXIT, 1, 2, 3, 4, 5)); err == nil {
+		t.Error("short exit event parsed")
+	}
+}
+
+// testProcListen listens to process events on a new socket, skipping the
+// test when the kernel does not send them to it. Only privileged sockets
+// of the initial namespaces get them.
+func testProcListen(t *testing.T) (*ConnectorNLSocket, chan *ProcEvent, chan error) {
+	t.Helper()
+	cl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Skipf("connector unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		cl.CloseLink()
+	})
+
+	err = cl.ProcListen()
+	if err == syscall.EPERM || err == syscall.ECONNREFUSED || err == syscall.EPROTONOSUPPORT {
+		t.Skipf("proc connector unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := make(chan *ProcEvent, 1000)
+	ec := make(chan error, 10)
+	cb := func(ev *ProcEvent, ec chan error, args ...interface{}) {
+		events <- ev
+	}
+	err = cl.StartProcMonitor(cb, ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* the listen request is acknowledged only on error */
+	select {
+	case err := <-ec:
+		t.Skipf("proc connector unavailable: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	return cl, events, ec
+}
+
+func TestProcEvents(t *testing.T) {
+	_, events, ec := testProcListen(t)
+
+	cmd := exec.Command("/bin/sh", "-c", "printf renamed > /proc/self/comm; exit 3")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:     true,
+		Credential: &syscall.Credential{Uid: 65534, Gid: 65534, NoSetGroups: true},
+	}
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("got %v", err)
+	}
+	pid := int32(cmd.Process.Pid)
+
+	/* events of the child in the order it went through them, among those
+	   of the rest of the system */
+	want := []uint32{PROC_EVENT_FORK, PROC_EVENT_SID, PROC_EVENT_GID, PROC_EVENT_UID, PROC_EVENT_EXEC,
+		PROC_EVENT_COMM, PROC_EVENT_EXIT}
+	timeout := time.After(5 * time.Second)
+	for len(want) > 0 {
+		var ev *ProcEvent
+		select {
+		case ev = <-events:
+		case err := <-ec:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatalf("timed out waiting for event %#x", want[0])
+		}
+
+		switch {
+		case ev.Fork != nil && ev.Fork.ChildTgid == pid:
+			if ev.Fork.ParentTgid != int32(os.Getpid()) || ev.Fork.ChildPid != pid {
+				t.Errorf("fork: got %+v", ev.Fork)
+			}
+		case ev.Sid != nil && ev.Sid.Tgid == pid:
+		case ev.Id != nil && ev.Id.Tgid == pid:
+			if ev.Id.Real != 65534 || ev.Id.Effective != 65534 {
+				t.Errorf("id %#x: got %+v", ev.What, ev.Id)
+			}
+		case ev.Exec != nil && ev.Exec.Tgid == pid:
+		case ev.Comm != nil && ev.Comm.Tgid == pid:
+			if ev.Comm.Comm != "renamed" {
+				t.Errorf("comm: got %+v", ev.Comm)
+			}
+		case ev.Exit != nil && ev.Exit.Tgid == pid:
+			if ev.Exit.ExitCode != 3<<8 || ev.Exit.ExitSignal != int32(syscall.SIGCHLD) || ev.Exit.ParentTgid != int32(os.Getpid()) {
+				t.Errorf("exit: got %+v", ev.Exit)
+			}
+		default:
+			continue
+		}
+
+		if ev.What != want[0] {
+			t.Fatalf("got event %#x, want %#x", ev.What, want[0])
+		}
+		if ev.Timestamp == 0 {
+			t.Errorf("event %#x: no timestamp", ev.What)
+		}
+		want = want[1:]
+	}
+}
+
+func TestProcIgnore(t *testing.T) {
+	cl, events, _ := testProcListen(t)
+
+	err := cl.ProcIgnore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* let the events already queued drain */
+	time.Sleep(100 * time.Millisecond)
+	for len(events) > 0 {
+		<-events
+	}
+
+	cmd := exec.Command("/bin/true")
+	err = cmd.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := int32(cmd.Process.Pid)
+
+	timeout := time.After(200 * time.Millisecond)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Exec != nil && ev.Exec.Tgid == pid {
+				t.Fatalf("got %+v after leaving the group", ev.Exec)
+			}
+		case <-timeout:
+			return
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package genetlink
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/apuigsech/netlink"
+)
+
+type GenlOp struct {
+	Id    uint32
+	Flags uint32 /* GENL_ADMIN_PERM, GENL_CMD_CAP_* */
+}
+
+type GenlMcastGroup struct {
+	Id   uint32
+	Name string
+}
+
+type GenlFamily struct {
+	Id      uint16
+	Name    string
+	Version uint32
+	HdrSize uint32
+	MaxAttr uint32
+	Ops     []GenlOp
+	Groups  []GenlMcastGroup
+}
+
+type FamilyEvent struct {
+	Cmd    uint8 /* CTRL_CMD_NEWFAMILY, CTRL_CMD_DELFAMILY */
+	Family *GenlFamily
+}
+
+type FamilyCallback func(*FamilyEvent, chan error, ...interface{})
+
+func GenlFamilyfromAttrs(attrs []netlink.NetlinkAttr) (*GenlFamily, error) {
+	f := &GenlFamily{
+		Ops:    []GenlOp{},
+		Groups: []GenlMcastGroup{},
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case CTRL_ATTR_FAMILY_ID:
+			f.Id = attr.Uint16()
+		case CTRL_ATTR_FAMILY_NAME:
+			f.Name = attr.String()
+		case CTRL_ATTR_VERSION:
+			f.Version = attr.Uint32()
+		case CTRL_ATTR_HDRSIZE:
+			f.HdrSize = attr.Uint32()
+		case CTRL_ATTR_MAXATTR:
+			f.MaxAttr = attr.Uint32()
+		case CTRL_ATTR_OPS:
+			ops, err := parseOps(attr)
+			if err != nil {
+				return nil, err
+			}
+			f.Ops = ops
+		case CTRL_ATTR_MCAST_GROUPS:
+			groups, err := parseMcastGroups(attr)
+			if err != nil {
+				return nil, err
+			}
+			f.Groups = groups
+		}
+	}
+
+	return f, nil
+}
+
+func parseOps(attr netlink.NetlinkAttr) ([]GenlOp, error) {
+	ops := []GenlOp{}
+
+	list, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range list {
+		fields, err := entry.Nested()
+		if err != nil {
+			return nil, err
+		}
+		op := GenlOp{}
+		for _, field := range fields {
+			switch field.AttrType() {
+			case CTRL_ATTR_OP_ID:
+				op.Id = field.Uint32()
+			case CTRL_ATTR_OP_FLAGS:
+				op.Flags = field.Uint32()
+			}
+		}
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+func parseMcastGroups(attr netlink.NetlinkAttr) ([]GenlMcastGroup, error) {
+	groups := []GenlMcastGroup{}
+
+	list, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range list {
+		fields, err := entry.Nested()
+		if err != nil {
+			return nil, err
+		}
+		grp := GenlMcastGroup{}
+		for _, field := range fields {
+			switch field.AttrType() {
+			case CTRL_ATTR_MCAST_GRP_ID:
+				grp.Id = field.Uint32()
+			case CTRL_ATTR_MCAST_GRP_NAME:
+				grp.Name = field.String()
+			}
+		}
+		groups = append(groups, grp)
+	}
+
+	return groups, nil
+}
+
+func (f *GenlFamily) GetGroup(name string) (*GenlMcastGroup, bool) {
+	for i := range f.Groups {
+		if f.Groups[i].Name == name {
+			return &f.Groups[i], true
+		}
+	}
+	return nil, false
+}
+
+func (f *GenlFamily) GetOp(cmd uint8) (*GenlOp, bool) {
+	for i := range f.Ops {
+		if f.Ops[i].Id == uint32(cmd) {
+			return &f.Ops[i], true
+		}
+	}
+	return nil, false
+}
+
+func (gl *GenlNLSocket) GetFamily(name string) (*GenlFamily, error) {
+	hdr := &GenlMsgHdr{Cmd: CTRL_CMD_GETFAMILY, Version: GENL_CTRL_VERSION}
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(CTRL_ATTR_FAMILY_NAME, name),
+	}
+
+	msgList, err := gl.Execute(GENL_ID_CTRL, 0, hdr, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgList) == 0 {
+		return nil, syscall.ENOENT
+	}
+
+	return GenlFamilyfromAttrs(msgList[0].Attrs)
+}
+
+func (gl *GenlNLSocket) GetFamilyById(id uint16) (*GenlFamily, error) {
+	hdr := &GenlMsgHdr{Cmd: CTRL_CMD_GETFAMILY, Version: GENL_CTRL_VERSION}
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrUint16(CTRL_ATTR_FAMILY_ID, id),
+	}
+
+	msgList, err := gl.Execute(GENL_ID_CTRL, 0, hdr, attrs)
+	if err != nil {
+		return nil, err
+	}
+	if len(msgList) == 0 {
+		return nil, syscall.ENOENT
+	}
+
+	return GenlFamilyfromAttrs(msgList[0].Attrs)
+}
+
+func (gl *GenlNLSocket) ListFamilies() ([]*GenlFamily, error) {
+	hdr := &GenlMsgHdr{Cmd: CTRL_CMD_GETFAMILY, Version: GENL_CTRL_VERSION}
+
+	msgList, err := gl.Execute(GENL_ID_CTRL, syscall.NLM_F_DUMP, hdr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*GenlFamily{}
+
+	for _, gm := range msgList {
+		f, err := GenlFamilyfromAttrs(gm.Attrs)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, f)
+	}
+
+	return ret, nil
+}
+
+func (gl *GenlNLSocket) JoinGroup(f *GenlFamily, name string) error {
+	grp, ok := f.GetGroup(name)
+	if !ok {
+		return errors.New("unknown multicast group " + name)
+	}
+	return gl.AddMembership(grp.Id)
+}
+
+func (gl *GenlNLSocket) LeaveGroup(f *GenlFamily, name string) error {
+	grp, ok := f.GetGroup(name)
+	if !ok {
+		return errors.New("unknown multicast group " + name)
+	}
+	return gl.DropMembership(grp.Id)
+}
+
+// StartFamilyMonitor joins the controller notification group and calls cb
+// every time a family is registered or unregistered. The socket should not
+// be used for requests once the monitor is running.
+func (gl *GenlNLSocket) StartFamilyMonitor(cb FamilyCallback, ec chan error, args ...interface{}) error {
+	ctrl, err := gl.GetFamily(GENL_CTRL_NAME)
+	if err != nil {
+		return err
+	}
+
+	err = gl.JoinGroup(ctrl, GENL_CTRL_NOTIFY_GROUP)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			msgList, err := gl.RecvMessages(netlink.RECV_BUFFER_SIZE, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			for _, gm := range msgList {
+				if gm.Family != GENL_ID_CTRL {
+					continue
+				}
+				if gm.Header.Cmd != CTRL_CMD_NEWFAMILY && gm.Header.Cmd != CTRL_CMD_DELFAMILY {
+					continue
+				}
+				f, err := GenlFamilyfromAttrs(gm.Attrs)
+				if err != nil {
+					continue
+				}
+				cb(&FamilyEvent{Cmd: gm.Header.Cmd, Family: f}, ec, args...)
+			}
+		}
+	}()
+
+	return nil
+}
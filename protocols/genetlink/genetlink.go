@@ -0,0 +1,148 @@
+package genetlink
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+type GenlNLSocket netlink.NetlinkSocket
+
+type GenlMsgHdr struct {
+	Cmd      uint8
+	Version  uint8
+	Reserved uint16
+}
+
+// GenlMessage is a decoded generic netlink message. Family is the netlink
+// message type the message was received with.
+type GenlMessage struct {
+	Family uint16
+	Flags  uint16
+	Header GenlMsgHdr
+	Attrs  []netlink.NetlinkAttr
+}
+
+func GenlMsgHdrfromWireFormat(data []byte) *GenlMsgHdr {
+	return &GenlMsgHdr{
+		Cmd:      data[0],
+		Version:  data[1],
+		Reserved: *(*uint16)(unsafe.Pointer(&data[2:4][0])),
+	}
+}
+
+func (hdr *GenlMsgHdr) toWireFormat() []byte {
+	b := make([]byte, GENL_HDRLEN)
+	b[0] = hdr.Cmd
+	b[1] = hdr.Version
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = hdr.Reserved
+	return b
+}
+
+func ParseGenlMessage(msg *netlink.NetlinkMessage) (*GenlMessage, error) {
+	if len(msg.Data) < GENL_HDRLEN {
+		return nil, errors.New("short generic netlink message")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(msg.Data[GENL_HDRLEN:])
+	if err != nil {
+		return nil, err
+	}
+
+	gm := &GenlMessage{
+		Family: msg.Header.Type,
+		Flags:  msg.Header.Flags,
+		Header: *GenlMsgHdrfromWireFormat(msg.Data),
+		Attrs:  attrs,
+	}
+
+	return gm, nil
+}
+
+func OpenLink(group, pid uint32) (*GenlNLSocket, error) {
+	nl, err := netlink.OpenLink(syscall.NETLINK_GENERIC, group, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*GenlNLSocket)(nl), nil
+}
+
+func (gl *GenlNLSocket) CloseLink() error {
+	nl := (*netlink.NetlinkSocket)(gl)
+	return nl.CloseLink()
+}
+
+func (gl *GenlNLSocket) AddMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(gl)
+	return nl.AddMembership(group)
+}
+
+func (gl *GenlNLSocket) DropMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(gl)
+	return nl.DropMembership(group)
+}
+
+func (gl *GenlNLSocket) RecvMessages(sz int, sockflags int) ([]*GenlMessage, error) {
+	nl := (*netlink.NetlinkSocket)(gl)
+	msgList, err := nl.RecvMessages(sz, sockflags)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*GenlMessage{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type < GENL_MIN_ID {
+			continue
+		}
+		gm, err := ParseGenlMessage(&msg)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, gm)
+	}
+
+	return ret, nil
+}
+
+func newGenlMessage(family, flags uint16, hdr *GenlMsgHdr, attrs []netlink.NetlinkAttr) *netlink.NetlinkMessage {
+	data := hdr.toWireFormat()
+	data = append(data, netlink.AttrsToWireFormat(attrs)...)
+
+	return &netlink.NetlinkMessage{
+		Header: syscall.NlMsghdr{
+			Type:  family,
+			Flags: flags | syscall.NLM_F_REQUEST,
+		},
+		Data: data,
+	}
+}
+
+func (gl *GenlNLSocket) Request(family, flags uint16, hdr *GenlMsgHdr, attrs []netlink.NetlinkAttr, sockflags int, ack bool) error {
+	nl := (*netlink.NetlinkSocket)(gl)
+	return nl.SendMessage(newGenlMessage(family, flags, hdr, attrs), sockflags, ack)
+}
+
+// Execute sends a generic netlink request and returns the decoded replies.
+func (gl *GenlNLSocket) Execute(family, flags uint16, hdr *GenlMsgHdr, attrs []netlink.NetlinkAttr) ([]*GenlMessage, error) {
+	nl := (*netlink.NetlinkSocket)(gl)
+	msgList, err := nl.Execute(newGenlMessage(family, flags, hdr, attrs), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*GenlMessage{}
+
+	for _, msg := range msgList {
+		gm, err := ParseGenlMessage(&msg)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, gm)
+	}
+
+	return ret, nil
+}
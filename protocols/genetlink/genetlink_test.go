@@ -0,0 +1,142 @@
+package genetlink
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestGenlMsgHdrWireFormat(t *testing.T) {
+	hdr := &GenlMsgHdr{Cmd: CTRL_CMD_GETFAMILY, Version: GENL_CTRL_VERSION, Reserved: 0x0102}
+
+	b := hdr.toWireFormat()
+	if !bytes.Equal(b, []byte{CTRL_CMD_GETFAMILY, GENL_CTRL_VERSION, 0x02, 0x01}) {
+		t.Fatalf("got % x", b)
+	}
+	if got := GenlMsgHdrfromWireFormat(b); *got != *hdr {
+		t.Errorf("got %+v, want %+v", got, hdr)
+	}
+}
+
+func TestParseGenlMessage(t *testing.T) {
+	msg := newGenlMessage(GENL_ID_CTRL, syscall.NLM_F_DUMP, &GenlMsgHdr{Cmd: CTRL_CMD_GETFAMILY, Version: 1},
+		[]netlink.NetlinkAttr{netlink.NewAttrString(CTRL_ATTR_FAMILY_NAME, "nlctrl")})
+
+	if msg.Header.Flags != syscall.NLM_F_DUMP|syscall.NLM_F_REQUEST {
+		t.Errorf("flags %#x", msg.Header.Flags)
+	}
+
+	gm, err := ParseGenlMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gm.Family != GENL_ID_CTRL || gm.Header.Cmd != CTRL_CMD_GETFAMILY || gm.Header.Version != 1 {
+		t.Errorf("got %+v", gm)
+	}
+	if len(gm.Attrs) != 1 || gm.Attrs[0].String() != "nlctrl" {
+		t.Errorf("attrs %+v", gm.Attrs)
+	}
+
+	_, err = ParseGenlMessage(&netlink.NetlinkMessage{Data: []byte{1, 2}})
+	if err == nil {
+		t.Error("short message was accepted")
+	}
+}
+
+func TestGenlFamilyfromAttrs(t *testing.T) {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrUint16(CTRL_ATTR_FAMILY_ID, 0x1c),
+		netlink.NewAttrString(CTRL_ATTR_FAMILY_NAME, "test"),
+		netlink.NewAttrUint32(CTRL_ATTR_VERSION, 2),
+		netlink.NewAttrUint32(CTRL_ATTR_HDRSIZE, 8),
+		netlink.NewAttrUint32(CTRL_ATTR_MAXATTR, 12),
+		netlink.NewAttrNested(CTRL_ATTR_OPS, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(1, []netlink.NetlinkAttr{
+				netlink.NewAttrUint32(CTRL_ATTR_OP_ID, 3),
+				netlink.NewAttrUint32(CTRL_ATTR_OP_FLAGS, GENL_CMD_CAP_DO|GENL_ADMIN_PERM),
+			}),
+			netlink.NewAttrNested(2, []netlink.NetlinkAttr{
+				netlink.NewAttrUint32(CTRL_ATTR_OP_ID, 4),
+				netlink.NewAttrUint32(CTRL_ATTR_OP_FLAGS, GENL_CMD_CAP_DUMP),
+			}),
+		}),
+		netlink.NewAttrNested(CTRL_ATTR_MCAST_GROUPS, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(1, []netlink.NetlinkAttr{
+				netlink.NewAttrUint32(CTRL_ATTR_MCAST_GRP_ID, 0x20),
+				netlink.NewAttrString(CTRL_ATTR_MCAST_GRP_NAME, "events"),
+			}),
+		}),
+	}
+
+	f, err := GenlFamilyfromAttrs(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Id != 0x1c || f.Name != "test" || f.Version != 2 || f.HdrSize != 8 || f.MaxAttr != 12 {
+		t.Errorf("got %+v", f)
+	}
+
+	op, ok := f.GetOp(3)
+	if !ok || op.Flags != GENL_CMD_CAP_DO|GENL_ADMIN_PERM {
+		t.Errorf("op 3: %+v %v", op, ok)
+	}
+	if _, ok := f.GetOp(5); ok {
+		t.Error("found op 5")
+	}
+
+	grp, ok := f.GetGroup("events")
+	if !ok || grp.Id != 0x20 {
+		t.Errorf("group events: %+v %v", grp, ok)
+	}
+	if _, ok := f.GetGroup("other"); ok {
+		t.Error("found group other")
+	}
+}
+
+func TestGetFamily(t *testing.T) {
+	gl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Skipf("generic netlink unavailable: %v", err)
+	}
+	defer gl.CloseLink()
+
+	f, err := gl.GetFamily(GENL_CTRL_NAME)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Id != GENL_ID_CTRL || f.Name != GENL_CTRL_NAME {
+		t.Errorf("got %+v", f)
+	}
+	if _, ok := f.GetGroup(GENL_CTRL_NOTIFY_GROUP); !ok {
+		t.Error("no notify group")
+	}
+
+	byId, err := gl.GetFamilyById(GENL_ID_CTRL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byId.Name != GENL_CTRL_NAME {
+		t.Errorf("family %d is %q", GENL_ID_CTRL, byId.Name)
+	}
+
+	families, err := gl.ListFamilies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range families {
+		if f.Name == GENL_CTRL_NAME {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("nlctrl not listed")
+	}
+
+	_, err = gl.GetFamily("no-such-family")
+	if err != syscall.ENOENT {
+		t.Errorf("unknown family: %v", err)
+	}
+}
@@ -0,0 +1,456 @@
+package genetlink
+
+import (
+	"fmt"
+	"strconv"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+// AttrPolicy describes how the kernel validates a single attribute. The Has*
+// fields tell whether the corresponding limits were present in the dump.
+type AttrPolicy struct {
+	Type           uint32 /* NL_ATTR_TYPE_* */
+	MinValueS      int64
+	MaxValueS      int64
+	HasValueS      bool
+	MinValueU      uint64
+	MaxValueU      uint64
+	HasValueU      bool
+	MinLength      uint32
+	MaxLength      uint32
+	HasMinLength   bool
+	HasMaxLength   bool
+	PolicyIdx      uint32
+	PolicyMaxType  uint32
+	HasPolicy      bool
+	Bitfield32Mask uint32
+	Mask           uint64
+	HasMask        bool
+}
+
+type Policy map[uint16]*AttrPolicy
+
+type OpPolicy struct {
+	Do      uint32
+	HasDo   bool
+	Dump    uint32
+	HasDump bool
+}
+
+// FamilyPolicy holds the policies exported by a family through
+// CTRL_CMD_GETPOLICY. Names is optional and is only used to make validation
+// errors readable.
+type FamilyPolicy struct {
+	Family   uint16
+	Policies map[uint32]Policy
+	Ops      map[uint8]OpPolicy
+	Names    *AttrNames
+}
+
+// AttrNames maps attribute types to the names reported in validation errors.
+// Nested holds the names of the attributes carried inside a nested attribute.
+type AttrNames struct {
+	Names  map[uint16]string
+	Nested map[uint16]*AttrNames
+}
+
+type PolicyError struct {
+	Cmd    uint8
+	Attr   string
+	Reason string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("genetlink: command %d: attribute %s: %s", e.Cmd, e.Attr, e.Reason)
+}
+
+func (names *AttrNames) name(attrtype uint16) string {
+	if names != nil {
+		if n, ok := names.Names[attrtype]; ok {
+			return n
+		}
+	}
+	return strconv.Itoa(int(attrtype))
+}
+
+func (names *AttrNames) nested(attrtype uint16) *AttrNames {
+	if names == nil {
+		return nil
+	}
+	return names.Nested[attrtype]
+}
+
+func AttrPolicyfromAttrs(attrs []netlink.NetlinkAttr) *AttrPolicy {
+	ap := &AttrPolicy{}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NL_POLICY_TYPE_ATTR_TYPE:
+			ap.Type = attr.Uint32()
+		case NL_POLICY_TYPE_ATTR_MIN_VALUE_S:
+			ap.MinValueS = int64(attr.Uint64())
+			ap.HasValueS = true
+		case NL_POLICY_TYPE_ATTR_MAX_VALUE_S:
+			ap.MaxValueS = int64(attr.Uint64())
+			ap.HasValueS = true
+		case NL_POLICY_TYPE_ATTR_MIN_VALUE_U:
+			ap.MinValueU = attr.Uint64()
+			ap.HasValueU = true
+		case NL_POLICY_TYPE_ATTR_MAX_VALUE_U:
+			ap.MaxValueU = attr.Uint64()
+			ap.HasValueU = true
+		case NL_POLICY_TYPE_ATTR_MIN_LENGTH:
+			ap.MinLength = attr.Uint32()
+			ap.HasMinLength = true
+		case NL_POLICY_TYPE_ATTR_MAX_LENGTH:
+			ap.MaxLength = attr.Uint32()
+			ap.HasMaxLength = true
+		case NL_POLICY_TYPE_ATTR_POLICY_IDX:
+			ap.PolicyIdx = attr.Uint32()
+			ap.HasPolicy = true
+		case NL_POLICY_TYPE_ATTR_POLICY_MAXTYPE:
+			ap.PolicyMaxType = attr.Uint32()
+		case NL_POLICY_TYPE_ATTR_BITFIELD32_MASK:
+			ap.Bitfield32Mask = attr.Uint32()
+		case NL_POLICY_TYPE_ATTR_MASK:
+			ap.Mask = attr.Uint64()
+			ap.HasMask = true
+		}
+	}
+
+	return ap
+}
+
+func (fp *FamilyPolicy) update(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case CTRL_ATTR_FAMILY_ID:
+			fp.Family = attr.Uint16()
+		case CTRL_ATTR_POLICY:
+			policies, err := attr.Nested()
+			if err != nil {
+				return err
+			}
+			for _, pattr := range policies {
+				p, ok := fp.Policies[uint32(pattr.AttrType())]
+				if !ok {
+					p = Policy{}
+					fp.Policies[uint32(pattr.AttrType())] = p
+				}
+				entries, err := pattr.Nested()
+				if err != nil {
+					return err
+				}
+				for _, entry := range entries {
+					fields, err := entry.Nested()
+					if err != nil {
+						return err
+					}
+					p[entry.AttrType()] = AttrPolicyfromAttrs(fields)
+				}
+			}
+		case CTRL_ATTR_OP_POLICY:
+			ops, err := attr.Nested()
+			if err != nil {
+				return err
+			}
+			for _, oattr := range ops {
+				fields, err := oattr.Nested()
+				if err != nil {
+					return err
+				}
+				op := OpPolicy{}
+				for _, field := range fields {
+					switch field.AttrType() {
+					case CTRL_ATTR_POLICY_DO:
+						op.Do = field.Uint32()
+						op.HasDo = true
+					case CTRL_ATTR_POLICY_DUMP:
+						op.Dump = field.Uint32()
+						op.HasDump = true
+					}
+				}
+				fp.Ops[uint8(oattr.AttrType())] = op
+			}
+		}
+	}
+
+	return nil
+}
+
+// GetPolicy dumps the attribute policies of the named family. It requires a
+// kernel with CTRL_CMD_GETPOLICY support (5.10 or newer).
+func (gl *GenlNLSocket) GetPolicy(name string) (*FamilyPolicy, error) {
+	hdr := &GenlMsgHdr{Cmd: CTRL_CMD_GETPOLICY, Version: GENL_CTRL_VERSION}
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(CTRL_ATTR_FAMILY_NAME, name),
+	}
+
+	msgList, err := gl.Execute(GENL_ID_CTRL, syscall.NLM_F_DUMP, hdr, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	fp := &FamilyPolicy{
+		Policies: map[uint32]Policy{},
+		Ops:      map[uint8]OpPolicy{},
+	}
+
+	for _, gm := range msgList {
+		err := fp.update(gm.Attrs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fp, nil
+}
+
+// OpPolicy returns the top level policy used by the kernel for cmd. Kernels
+// that do not export per-operation policies use policy 0 for every command.
+func (fp *FamilyPolicy) OpPolicy(cmd uint8, dump bool) (Policy, bool) {
+	op, ok := fp.Ops[cmd]
+	if !ok {
+		if len(fp.Ops) != 0 {
+			return nil, false
+		}
+		p, ok := fp.Policies[0]
+		return p, ok
+	}
+
+	if dump && op.HasDump {
+		return fp.Policies[op.Dump], true
+	}
+	if !dump && op.HasDo {
+		return fp.Policies[op.Do], true
+	}
+
+	return nil, false
+}
+
+// Validate checks attrs against the policy the kernel applies to cmd and
+// returns a *PolicyError for the first attribute that would be rejected.
+// Attributes of type NLA_UNSPEC are left out of policy dumps, so the types a
+// policy does not describe are accepted up to its highest type, which is
+// only known for nested policies.
+func (fp *FamilyPolicy) Validate(cmd uint8, flags uint16, attrs []netlink.NetlinkAttr) error {
+	p, ok := fp.OpPolicy(cmd, flags&syscall.NLM_F_DUMP == syscall.NLM_F_DUMP)
+	if !ok {
+		if len(attrs) == 0 {
+			return nil
+		}
+		return &PolicyError{Cmd: cmd, Attr: fp.Names.name(attrs[0].AttrType()), Reason: "command accepts no attributes"}
+	}
+
+	return fp.validate(cmd, p, 0, attrs, fp.Names, "")
+}
+
+func (fp *FamilyPolicy) validate(cmd uint8, p Policy, maxtype uint32, attrs []netlink.NetlinkAttr, names *AttrNames, prefix string) error {
+	for _, attr := range attrs {
+		t := attr.AttrType()
+		name := prefix + names.name(t)
+
+		if maxtype != 0 && uint32(t) > maxtype {
+			return &PolicyError{Cmd: cmd, Attr: name, Reason: "not accepted by the kernel policy"}
+		}
+		ap, ok := p[t]
+		if !ok {
+			continue
+		}
+
+		reason := ap.check(&attr)
+		if reason != "" {
+			return &PolicyError{Cmd: cmd, Attr: name, Reason: reason}
+		}
+
+		if !ap.HasPolicy {
+			continue
+		}
+		np, ok := fp.Policies[ap.PolicyIdx]
+		if !ok {
+			continue
+		}
+
+		nested, err := attr.Nested()
+		if err != nil {
+			return &PolicyError{Cmd: cmd, Attr: name, Reason: err.Error()}
+		}
+
+		switch ap.Type {
+		case NL_ATTR_TYPE_NESTED:
+			err = fp.validate(cmd, np, ap.PolicyMaxType, nested, names.nested(t), name+".")
+			if err != nil {
+				return err
+			}
+		case NL_ATTR_TYPE_NESTED_ARRAY:
+			for _, entry := range nested {
+				entryAttrs, err := entry.Nested()
+				if err != nil {
+					return &PolicyError{Cmd: cmd, Attr: name, Reason: err.Error()}
+				}
+				entryName := name + "[" + strconv.Itoa(int(entry.AttrType())) + "]."
+				err = fp.validate(cmd, np, ap.PolicyMaxType, entryAttrs, names.nested(t), entryName)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+var policyIntSize = map[uint32]int{
+	NL_ATTR_TYPE_U8:  1,
+	NL_ATTR_TYPE_U16: 2,
+	NL_ATTR_TYPE_U32: 4,
+	NL_ATTR_TYPE_U64: 8,
+	NL_ATTR_TYPE_S8:  1,
+	NL_ATTR_TYPE_S16: 2,
+	NL_ATTR_TYPE_S32: 4,
+	NL_ATTR_TYPE_S64: 8,
+}
+
+func unsignedValue(b []byte) uint64 {
+	switch len(b) {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(*(*uint16)(unsafe.Pointer(&b[0])))
+	case 4:
+		return uint64(*(*uint32)(unsafe.Pointer(&b[0])))
+	case 8:
+		return *(*uint64)(unsafe.Pointer(&b[0]))
+	}
+	return 0
+}
+
+func signedValue(b []byte) int64 {
+	switch len(b) {
+	case 1:
+		return int64(int8(b[0]))
+	case 2:
+		return int64(*(*int16)(unsafe.Pointer(&b[0])))
+	case 4:
+		return int64(*(*int32)(unsafe.Pointer(&b[0])))
+	case 8:
+		return *(*int64)(unsafe.Pointer(&b[0]))
+	}
+	return 0
+}
+
+// check returns the reason attr would be rejected, or "" if it is valid.
+func (ap *AttrPolicy) check(attr *netlink.NetlinkAttr) string {
+	l := len(attr.Data)
+
+	switch ap.Type {
+	case NL_ATTR_TYPE_FLAG:
+		if l != 0 {
+			return "flag must not carry a payload"
+		}
+		return ""
+
+	case NL_ATTR_TYPE_U8, NL_ATTR_TYPE_U16, NL_ATTR_TYPE_U32, NL_ATTR_TYPE_U64,
+		NL_ATTR_TYPE_S8, NL_ATTR_TYPE_S16, NL_ATTR_TYPE_S32, NL_ATTR_TYPE_S64:
+		if l != policyIntSize[ap.Type] {
+			return fmt.Sprintf("expected %d bytes, got %d", policyIntSize[ap.Type], l)
+		}
+		return ap.checkValue(attr.Data)
+
+	case NL_ATTR_TYPE_UINT, NL_ATTR_TYPE_SINT:
+		if l != 4 && l != 8 {
+			return fmt.Sprintf("expected 4 or 8 bytes, got %d", l)
+		}
+		return ap.checkValue(attr.Data)
+
+	case NL_ATTR_TYPE_STRING:
+		if l > 0 && attr.Data[l-1] == 0 {
+			l--
+		}
+		return ap.checkLength(l)
+
+	case NL_ATTR_TYPE_NUL_STRING:
+		if l == 0 || attr.Data[l-1] != 0 {
+			return "string is not NUL terminated"
+		}
+		if ap.HasMaxLength && uint32(l-1) > ap.MaxLength {
+			return fmt.Sprintf("string longer than %d bytes", ap.MaxLength)
+		}
+		return ""
+
+	case NL_ATTR_TYPE_BINARY:
+		return ap.checkLength(l)
+
+	case NL_ATTR_TYPE_NESTED, NL_ATTR_TYPE_NESTED_ARRAY:
+		if l != 0 && l < netlink.NLA_HDRLEN {
+			return "malformed nested attribute"
+		}
+		return ""
+
+	case NL_ATTR_TYPE_BITFIELD32:
+		if l != 8 {
+			return fmt.Sprintf("expected 8 bytes, got %d", l)
+		}
+		value := *(*uint32)(unsafe.Pointer(&attr.Data[0]))
+		selector := *(*uint32)(unsafe.Pointer(&attr.Data[4]))
+		if value&^ap.Bitfield32Mask != 0 || selector&^ap.Bitfield32Mask != 0 {
+			return fmt.Sprintf("bits outside of mask 0x%x", ap.Bitfield32Mask)
+		}
+		return ""
+	}
+
+	return ""
+}
+
+func (ap *AttrPolicy) checkValue(b []byte) string {
+	signed := ap.Type == NL_ATTR_TYPE_S8 || ap.Type == NL_ATTR_TYPE_S16 ||
+		ap.Type == NL_ATTR_TYPE_S32 || ap.Type == NL_ATTR_TYPE_S64 || ap.Type == NL_ATTR_TYPE_SINT
+
+	if signed {
+		v := signedValue(b)
+		if ap.HasValueS && (v < ap.MinValueS || v > ap.MaxValueS) {
+			return fmt.Sprintf("value %d out of range [%d, %d]", v, ap.MinValueS, ap.MaxValueS)
+		}
+		return ""
+	}
+
+	v := unsignedValue(b)
+	if ap.HasValueU && (v < ap.MinValueU || v > ap.MaxValueU) {
+		return fmt.Sprintf("value %d out of range [%d, %d]", v, ap.MinValueU, ap.MaxValueU)
+	}
+	if ap.HasMask && v&^ap.Mask != 0 {
+		return fmt.Sprintf("value 0x%x has bits outside of mask 0x%x", v, ap.Mask)
+	}
+	return ""
+}
+
+func (ap *AttrPolicy) checkLength(l int) string {
+	if ap.HasMinLength && uint32(l) < ap.MinLength {
+		return fmt.Sprintf("length %d shorter than %d", l, ap.MinLength)
+	}
+	if ap.HasMaxLength && uint32(l) > ap.MaxLength {
+		return fmt.Sprintf("length %d longer than %d", l, ap.MaxLength)
+	}
+	return ""
+}
+
+// RequestWithPolicy validates the request against fp before sending it.
+func (gl *GenlNLSocket) RequestWithPolicy(fp *FamilyPolicy, flags uint16, hdr *GenlMsgHdr, attrs []netlink.NetlinkAttr, sockflags int, ack bool) error {
+	err := fp.Validate(hdr.Cmd, flags, attrs)
+	if err != nil {
+		return err
+	}
+	return gl.Request(fp.Family, flags, hdr, attrs, sockflags, ack)
+}
+
+// ExecuteWithPolicy validates the request against fp before executing it.
+func (gl *GenlNLSocket) ExecuteWithPolicy(fp *FamilyPolicy, flags uint16, hdr *GenlMsgHdr, attrs []netlink.NetlinkAttr) ([]*GenlMessage, error) {
+	err := fp.Validate(hdr.Cmd, flags, attrs)
+	if err != nil {
+		return nil, err
+	}
+	return gl.Execute(fp.Family, flags, hdr, attrs)
+}
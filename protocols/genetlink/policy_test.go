@@ -0,0 +1,217 @@
+package genetlink
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+func policyEntry(attrtype uint16, fields ...netlink.NetlinkAttr) netlink.NetlinkAttr {
+	return netlink.NewAttrNested(attrtype, fields)
+}
+
+// testPolicy is the policy dump of a family with a do policy 0 for command
+// 1, holding a u8 limited to [1, 10], a string of up to 4 bytes, a flag, a
+// bitfield32 and a nested attribute validated by policy 1, which describes
+// the first of its two attribute types.
+func testPolicy(t *testing.T) *FamilyPolicy {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrUint16(CTRL_ATTR_FAMILY_ID, 0x30),
+		netlink.NewAttrNested(CTRL_ATTR_POLICY, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(0, []netlink.NetlinkAttr{
+				policyEntry(1,
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_TYPE, NL_ATTR_TYPE_U8),
+					netlink.NewAttrUint64(NL_POLICY_TYPE_ATTR_MIN_VALUE_U, 1),
+					netlink.NewAttrUint64(NL_POLICY_TYPE_ATTR_MAX_VALUE_U, 10)),
+				policyEntry(2,
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_TYPE, NL_ATTR_TYPE_STRING),
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_MAX_LENGTH, 4)),
+				policyEntry(3,
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_TYPE, NL_ATTR_TYPE_FLAG)),
+				policyEntry(4,
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_TYPE, NL_ATTR_TYPE_BITFIELD32),
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_BITFIELD32_MASK, 0x3)),
+				policyEntry(5,
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_TYPE, NL_ATTR_TYPE_NESTED),
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_POLICY_IDX, 1),
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_POLICY_MAXTYPE, 2)),
+			}),
+			netlink.NewAttrNested(1, []netlink.NetlinkAttr{
+				policyEntry(1,
+					netlink.NewAttrUint32(NL_POLICY_TYPE_ATTR_TYPE, NL_ATTR_TYPE_S16),
+					netlink.NewAttrUint64(NL_POLICY_TYPE_ATTR_MIN_VALUE_S, ^uint64(4)), /* -5 */
+					netlink.NewAttrUint64(NL_POLICY_TYPE_ATTR_MAX_VALUE_S, 5)),
+			}),
+		}),
+		netlink.NewAttrNested(CTRL_ATTR_OP_POLICY, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(1, []netlink.NetlinkAttr{
+				netlink.NewAttrUint32(CTRL_ATTR_POLICY_DO, 0),
+			}),
+		}),
+	}
+
+	fp := &FamilyPolicy{
+		Policies: map[uint32]Policy{},
+		Ops:      map[uint8]OpPolicy{},
+		Names: &AttrNames{
+			Names:  map[uint16]string{1: "COUNT", 5: "NEST"},
+			Nested: map[uint16]*AttrNames{5: {Names: map[uint16]string{1: "DELTA"}}},
+		},
+	}
+	err := fp.update(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
+
+func int16Attr(attrtype uint16, v int16) netlink.NetlinkAttr {
+	return netlink.NewAttrUint16(attrtype, uint16(v))
+}
+
+func TestFamilyPolicyUpdate(t *testing.T) {
+	fp := testPolicy(t)
+
+	if fp.Family != 0x30 {
+		t.Errorf("family %#x", fp.Family)
+	}
+	if len(fp.Policies) != 2 || len(fp.Policies[0]) != 5 || len(fp.Policies[1]) != 1 {
+		t.Fatalf("policies %+v", fp.Policies)
+	}
+
+	ap := fp.Policies[0][1]
+	if ap.Type != NL_ATTR_TYPE_U8 || !ap.HasValueU || ap.MinValueU != 1 || ap.MaxValueU != 10 {
+		t.Errorf("attribute 1: %+v", ap)
+	}
+	ap = fp.Policies[0][5]
+	if !ap.HasPolicy || ap.PolicyIdx != 1 || ap.PolicyMaxType != 2 {
+		t.Errorf("attribute 5: %+v", ap)
+	}
+	ap = fp.Policies[1][1]
+	if !ap.HasValueS || ap.MinValueS != -5 || ap.MaxValueS != 5 {
+		t.Errorf("nested attribute 1: %+v", ap)
+	}
+
+	op := fp.Ops[1]
+	if !op.HasDo || op.Do != 0 || op.HasDump {
+		t.Errorf("op 1: %+v", op)
+	}
+}
+
+func TestOpPolicy(t *testing.T) {
+	fp := testPolicy(t)
+
+	if _, ok := fp.OpPolicy(1, false); !ok {
+		t.Error("no do policy for command 1")
+	}
+	if _, ok := fp.OpPolicy(1, true); ok {
+		t.Error("dump policy for command 1")
+	}
+	if _, ok := fp.OpPolicy(2, false); ok {
+		t.Error("policy for command 2")
+	}
+
+	/* without per operation policies, policy 0 applies to everything */
+	fp.Ops = map[uint8]OpPolicy{}
+	if p, ok := fp.OpPolicy(2, true); !ok || len(p) != 5 {
+		t.Error("policy 0 not used for command 2")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	fp := testPolicy(t)
+
+	tests := []struct {
+		name  string
+		cmd   uint8
+		attrs []netlink.NetlinkAttr
+		attr  string
+		err   string
+	}{
+		{"valid", 1, []netlink.NetlinkAttr{
+			netlink.NewAttrUint8(1, 5),
+			netlink.NewAttrString(2, "abcd"),
+			netlink.NewAttrFlag(3),
+			netlink.NewAttr(4, []byte{1, 0, 0, 0, 3, 0, 0, 0}),
+			netlink.NewAttrNested(5, []netlink.NetlinkAttr{int16Attr(1, -5)}),
+		}, "", ""},
+		{"no attributes", 2, nil, "", ""},
+		{"unknown command", 2, []netlink.NetlinkAttr{netlink.NewAttrUint8(1, 5)}, "COUNT", "accepts no attributes"},
+		/* NLA_UNSPEC attributes are not in the dump */
+		{"undescribed attribute", 1, []netlink.NetlinkAttr{netlink.NewAttrUint8(9, 5)}, "", ""},
+		{"undescribed nested attribute", 1, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(5, []netlink.NetlinkAttr{netlink.NewAttrUint32(2, 7)}),
+		}, "", ""},
+		{"unknown nested attribute", 1, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(5, []netlink.NetlinkAttr{netlink.NewAttrUint32(3, 7)}),
+		}, "NEST.3", "not accepted"},
+		{"integer size", 1, []netlink.NetlinkAttr{netlink.NewAttrUint16(1, 5)}, "COUNT", "expected 1 bytes, got 2"},
+		{"integer range", 1, []netlink.NetlinkAttr{netlink.NewAttrUint8(1, 11)}, "COUNT", "out of range"},
+		{"string length", 1, []netlink.NetlinkAttr{netlink.NewAttrString(2, "abcde")}, "2", "longer than 4"},
+		{"flag payload", 1, []netlink.NetlinkAttr{netlink.NewAttrUint8(3, 1)}, "3", "payload"},
+		{"bitfield mask", 1, []netlink.NetlinkAttr{netlink.NewAttr(4, []byte{4, 0, 0, 0, 4, 0, 0, 0})}, "4", "outside of mask"},
+		{"nested range", 1, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(5, []netlink.NetlinkAttr{int16Attr(1, -6)}),
+		}, "NEST.DELTA", "out of range"},
+	}
+
+	for _, tt := range tests {
+		err := fp.Validate(tt.cmd, 0, tt.attrs)
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tt.name, err)
+			}
+			continue
+		}
+		perr, ok := err.(*PolicyError)
+		if !ok {
+			t.Errorf("%s: got %v, want a *PolicyError", tt.name, err)
+			continue
+		}
+		if perr.Cmd != tt.cmd || perr.Attr != tt.attr || !strings.Contains(perr.Reason, tt.err) {
+			t.Errorf("%s: got %v, want attribute %s: %s", tt.name, err, tt.attr, tt.err)
+		}
+	}
+}
+
+func TestGetPolicy(t *testing.T) {
+	gl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Skipf("generic netlink unavailable: %v", err)
+	}
+	defer gl.CloseLink()
+
+	fp, err := gl.GetPolicy(GENL_CTRL_NAME)
+	if err == syscall.EOPNOTSUPP || err == syscall.EINVAL {
+		t.Skipf("policy dumps unsupported: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp.Family != GENL_ID_CTRL {
+		t.Errorf("family %#x", fp.Family)
+	}
+
+	attrs := []netlink.NetlinkAttr{netlink.NewAttrString(CTRL_ATTR_FAMILY_NAME, GENL_CTRL_NAME)}
+	err = fp.Validate(CTRL_CMD_GETFAMILY, 0, attrs)
+	if err != nil {
+		t.Error(err)
+	}
+
+	attrs = []netlink.NetlinkAttr{netlink.NewAttrString(CTRL_ATTR_FAMILY_NAME, strings.Repeat("x", GENL_NAMSIZ))}
+	err = fp.Validate(CTRL_CMD_GETFAMILY, 0, attrs)
+	if err == nil {
+		t.Error("family name longer than GENL_NAMSIZ accepted")
+	}
+
+	msgList, err := gl.ExecuteWithPolicy(fp, 0, &GenlMsgHdr{Cmd: CTRL_CMD_GETFAMILY, Version: GENL_CTRL_VERSION},
+		[]netlink.NetlinkAttr{netlink.NewAttrString(CTRL_ATTR_FAMILY_NAME, GENL_CTRL_NAME)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgList) != 1 {
+		t.Errorf("got %d replies", len(msgList))
+	}
+}
@@ -0,0 +1,468 @@
+package netfilter
+
+import (
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+// ConntrackTuple identifies one direction of a connection. Ports are used
+// for TCP, UDP and other port based protocols, IcmpId, IcmpType and
+// IcmpCode for ICMP and ICMPv6.
+type ConntrackTuple struct {
+	Src      net.IP
+	Dst      net.IP
+	Proto    uint8
+	SrcPort  uint16
+	DstPort  uint16
+	IcmpId   uint16
+	IcmpType uint8
+	IcmpCode uint8
+}
+
+type ConntrackCounters struct {
+	Packets uint64
+	Bytes   uint64
+}
+
+// Conntrack is a connection tracking entry. Timeout is the time left
+// before the entry expires. Counters are only reported when accounting is
+// enabled (net.netfilter.nf_conntrack_acct), Start and Stop only when
+// timestamps are (net.netfilter.nf_conntrack_timestamp).
+type Conntrack struct {
+	Family        uint8
+	Orig          ConntrackTuple
+	Reply         ConntrackTuple
+	Status        uint32
+	Timeout       time.Duration
+	Mark          uint32
+	HasMark       bool
+	Zone          uint16
+	Id            uint32
+	Use           uint32
+	Labels        []byte
+	LabelsMask    []byte
+	OrigCounters  *ConntrackCounters
+	ReplyCounters *ConntrackCounters
+	TcpState      uint8
+	HasTcpState   bool
+	Start         time.Time
+	Stop          time.Time
+	Attrs         []netlink.NetlinkAttr
+}
+
+// ConntrackFilter selects the entries of a dump or a flush: those of
+// Family, unless NFPROTO_UNSPEC, whose mark masked by MarkMask is Mark
+// when HasMark is set, and in Zone when HasZone is set. A zero MarkMask
+// compares the whole mark, as the kernel does without a mask.
+type ConntrackFilter struct {
+	Family   uint8
+	Mark     uint32
+	MarkMask uint32
+	HasMark  bool
+	Zone     uint16
+	HasZone  bool
+}
+
+// ConntrackEvent is a conntrack notification. Type is the group it was
+// received from: NFNLGRP_CONNTRACK_NEW, _UPDATE or _DESTROY.
+type ConntrackEvent struct {
+	Type      uint32
+	Conntrack *Conntrack
+}
+
+type ConntrackCallback func(*ConntrackEvent, chan error, ...interface{})
+
+func ctMsgType(msg uint8) uint16 {
+	return NfMsgType(NFNL_SUBSYS_CTNETLINK, msg)
+}
+
+func ConntrackTuplefromAttrs(attrs []netlink.NetlinkAttr) (*ConntrackTuple, error) {
+	t := &ConntrackTuple{}
+
+	for _, attr := range attrs {
+		nattrs, err := attr.Nested()
+		if err != nil {
+			return nil, err
+		}
+		switch attr.AttrType() {
+		case CTA_TUPLE_IP:
+			for _, a := range nattrs {
+				switch a.AttrType() {
+				case CTA_IP_V4_SRC, CTA_IP_V6_SRC:
+					t.Src = net.IP(a.Data)
+				case CTA_IP_V4_DST, CTA_IP_V6_DST:
+					t.Dst = net.IP(a.Data)
+				}
+			}
+		case CTA_TUPLE_PROTO:
+			for _, a := range nattrs {
+				switch a.AttrType() {
+				case CTA_PROTO_NUM:
+					t.Proto = a.Uint8()
+				case CTA_PROTO_SRC_PORT:
+					t.SrcPort = a.NetUint16()
+				case CTA_PROTO_DST_PORT:
+					t.DstPort = a.NetUint16()
+				case CTA_PROTO_ICMP_ID, CTA_PROTO_ICMPV6_ID:
+					t.IcmpId = a.NetUint16()
+				case CTA_PROTO_ICMP_TYPE, CTA_PROTO_ICMPV6_TYPE:
+					t.IcmpType = a.Uint8()
+				case CTA_PROTO_ICMP_CODE, CTA_PROTO_ICMPV6_CODE:
+					t.IcmpCode = a.Uint8()
+				}
+			}
+		}
+	}
+
+	return t, nil
+}
+
+func (t *ConntrackTuple) toAttrs() []netlink.NetlinkAttr {
+	ip := []netlink.NetlinkAttr{}
+	if src := t.Src.To4(); src != nil {
+		ip = append(ip,
+			netlink.NewAttr(CTA_IP_V4_SRC, src),
+			netlink.NewAttr(CTA_IP_V4_DST, t.Dst.To4()))
+	} else {
+		ip = append(ip,
+			netlink.NewAttr(CTA_IP_V6_SRC, t.Src.To16()),
+			netlink.NewAttr(CTA_IP_V6_DST, t.Dst.To16()))
+	}
+
+	proto := []netlink.NetlinkAttr{
+		netlink.NewAttrUint8(CTA_PROTO_NUM, t.Proto),
+	}
+	switch t.Proto {
+	case syscall.IPPROTO_ICMP:
+		proto = append(proto,
+			netlink.NewAttrNetUint16(CTA_PROTO_ICMP_ID, t.IcmpId),
+			netlink.NewAttrUint8(CTA_PROTO_ICMP_TYPE, t.IcmpType),
+			netlink.NewAttrUint8(CTA_PROTO_ICMP_CODE, t.IcmpCode))
+	case syscall.IPPROTO_ICMPV6:
+		proto = append(proto,
+			netlink.NewAttrNetUint16(CTA_PROTO_ICMPV6_ID, t.IcmpId),
+			netlink.NewAttrUint8(CTA_PROTO_ICMPV6_TYPE, t.IcmpType),
+			netlink.NewAttrUint8(CTA_PROTO_ICMPV6_CODE, t.IcmpCode))
+	default:
+		proto = append(proto,
+			netlink.NewAttrNetUint16(CTA_PROTO_SRC_PORT, t.SrcPort),
+			netlink.NewAttrNetUint16(CTA_PROTO_DST_PORT, t.DstPort))
+	}
+
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrNested(CTA_TUPLE_IP, ip),
+		netlink.NewAttrNested(CTA_TUPLE_PROTO, proto),
+	}
+}
+
+func conntrackCountersfromAttr(attr *netlink.NetlinkAttr) (*ConntrackCounters, error) {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+	c := &ConntrackCounters{}
+	for _, a := range attrs {
+		switch a.AttrType() {
+		case CTA_COUNTERS_PACKETS:
+			c.Packets = a.NetUint64()
+		case CTA_COUNTERS_BYTES:
+			c.Bytes = a.NetUint64()
+		case CTA_COUNTERS32_PACKETS:
+			c.Packets = uint64(a.NetUint32())
+		case CTA_COUNTERS32_BYTES:
+			c.Bytes = uint64(a.NetUint32())
+		}
+	}
+	return c, nil
+}
+
+func ConntrackfromMessage(m *NfMessage) (*Conntrack, error) {
+	ct := &Conntrack{
+		Family: m.Header.Family,
+		Attrs:  m.Attrs,
+	}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case CTA_TUPLE_ORIG, CTA_TUPLE_REPLY:
+			attrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			t, err := ConntrackTuplefromAttrs(attrs)
+			if err != nil {
+				return nil, err
+			}
+			if attr.AttrType() == CTA_TUPLE_ORIG {
+				ct.Orig = *t
+			} else {
+				ct.Reply = *t
+			}
+		case CTA_STATUS:
+			ct.Status = attr.NetUint32()
+		case CTA_TIMEOUT:
+			ct.Timeout = time.Duration(attr.NetUint32()) * time.Second
+		case CTA_MARK:
+			ct.Mark = attr.NetUint32()
+			ct.HasMark = true
+		case CTA_ZONE:
+			ct.Zone = attr.NetUint16()
+		case CTA_ID:
+			ct.Id = attr.NetUint32()
+		case CTA_USE:
+			ct.Use = attr.NetUint32()
+		case CTA_LABELS:
+			ct.Labels = attr.Data
+		case CTA_COUNTERS_ORIG, CTA_COUNTERS_REPLY:
+			c, err := conntrackCountersfromAttr(&attr)
+			if err != nil {
+				return nil, err
+			}
+			if attr.AttrType() == CTA_COUNTERS_ORIG {
+				ct.OrigCounters = c
+			} else {
+				ct.ReplyCounters = c
+			}
+		case CTA_PROTOINFO:
+			err := ct.parseProtoinfo(&attr)
+			if err != nil {
+				return nil, err
+			}
+		case CTA_TIMESTAMP:
+			attrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range attrs {
+				switch a.AttrType() {
+				case CTA_TIMESTAMP_START:
+					ct.Start = time.Unix(0, int64(a.NetUint64()))
+				case CTA_TIMESTAMP_STOP:
+					ct.Stop = time.Unix(0, int64(a.NetUint64()))
+				}
+			}
+		}
+	}
+
+	return ct, nil
+}
+
+func (ct *Conntrack) parseProtoinfo(attr *netlink.NetlinkAttr) error {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		if a.AttrType() != CTA_PROTOINFO_TCP {
+			continue
+		}
+		tattrs, err := a.Nested()
+		if err != nil {
+			return err
+		}
+		for _, ta := range tattrs {
+			if ta.AttrType() == CTA_PROTOINFO_TCP_STATE {
+				ct.TcpState = ta.Uint8()
+				ct.HasTcpState = true
+			}
+		}
+	}
+	return nil
+}
+
+// key returns the attributes identifying the entry: its original tuple and
+// zone. The id, when set, must match too; the kernel does not look entries
+// up by id alone.
+func (ct *Conntrack) key() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNested(CTA_TUPLE_ORIG, ct.Orig.toAttrs()),
+	}
+	if ct.Zone != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(CTA_ZONE, ct.Zone))
+	}
+	if ct.Id != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(CTA_ID, ct.Id))
+	}
+	return attrs
+}
+
+func (f *ConntrackFilter) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+	if f == nil {
+		return attrs
+	}
+	if f.HasMark {
+		mask := f.MarkMask
+		if mask == 0 {
+			/* kernels before 5.9 ignore a mark without a mask */
+			mask = 0xffffffff
+		}
+		attrs = append(attrs,
+			netlink.NewAttrNetUint32(CTA_MARK, f.Mark),
+			netlink.NewAttrNetUint32(CTA_MARK_MASK, mask))
+	}
+	if f.HasZone {
+		attrs = append(attrs, netlink.NewAttrNetUint16(CTA_ZONE, f.Zone))
+	}
+	return attrs
+}
+
+func (f *ConntrackFilter) family() uint8 {
+	if f == nil {
+		return NFPROTO_UNSPEC
+	}
+	return f.Family
+}
+
+// ListConntrack dumps the conntrack table, limited to the entries selected
+// by filter when it is not nil. With zero set, the counters of the dumped
+// entries are reset.
+func (nfl *NetfilterNLSocket) ListConntrack(filter *ConntrackFilter, zero bool) ([]*Conntrack, error) {
+	msg := uint8(IPCTNL_MSG_CT_GET)
+	if zero {
+		msg = IPCTNL_MSG_CT_GET_CTRZERO
+	}
+
+	msgList, err := nfl.Execute(ctMsgType(msg), syscall.NLM_F_DUMP, filter.family(), filter.toAttrs())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Conntrack{}
+
+	for _, m := range msgList {
+		ct, err := ConntrackfromMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, ct)
+	}
+
+	return ret, nil
+}
+
+// GetConntrack returns the entry with the original tuple, and zone, of ct.
+func (nfl *NetfilterNLSocket) GetConntrack(ct *Conntrack) (*Conntrack, error) {
+	if ct.Orig.Src == nil {
+		return nil, syscall.EINVAL
+	}
+
+	msgList, err := nfl.Execute(ctMsgType(IPCTNL_MSG_CT_GET), 0, ct.Family, ct.key())
+	if err != nil {
+		return nil, err
+	}
+
+	if len(msgList) == 0 {
+		return nil, syscall.ENOENT
+	}
+
+	return ConntrackfromMessage(msgList[0])
+}
+
+// DelConntrack deletes the entry identified as in GetConntrack, and with
+// the id of ct when it is not zero, so that a newer entry reusing the tuple
+// is not deleted.
+func (nfl *NetfilterNLSocket) DelConntrack(ct *Conntrack) error {
+	/* without a tuple the kernel would flush the table */
+	if ct.Orig.Src == nil {
+		return syscall.EINVAL
+	}
+
+	_, err := nfl.Execute(ctMsgType(IPCTNL_MSG_CT_DELETE), 0, ct.Family, ct.key())
+	return err
+}
+
+// UpdateConntrack sets the mark, when HasMark is set, the timeout, when not
+// zero, and the labels, when not nil, of the entry identified as in
+// GetConntrack. Only the labels set in LabelsMask are changed when it is
+// not nil.
+func (nfl *NetfilterNLSocket) UpdateConntrack(ct *Conntrack) error {
+	if ct.Orig.Src == nil {
+		return syscall.EINVAL
+	}
+
+	attrs := ct.key()
+	if ct.HasMark {
+		attrs = append(attrs, netlink.NewAttrNetUint32(CTA_MARK, ct.Mark))
+	}
+	if ct.Timeout != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(CTA_TIMEOUT, uint32(ct.Timeout/time.Second)))
+	}
+	if ct.Labels != nil {
+		attrs = append(attrs, netlink.NewAttr(CTA_LABELS, ct.Labels))
+		if ct.LabelsMask != nil {
+			attrs = append(attrs, netlink.NewAttr(CTA_LABELS_MASK, ct.LabelsMask))
+		}
+	}
+
+	_, err := nfl.Execute(ctMsgType(IPCTNL_MSG_CT_NEW), 0, ct.Family, attrs)
+	return err
+}
+
+// FlushConntrack deletes the entries selected by filter, or every entry
+// when it is nil.
+func (nfl *NetfilterNLSocket) FlushConntrack(filter *ConntrackFilter) error {
+	msg := newNfMessage(ctMsgType(IPCTNL_MSG_CT_DELETE), 0, filter.family(), 0, filter.toAttrs())
+	// The family is only taken as a filter from version 1 messages.
+	msg.Data[1] = NFNETLINK_V1
+	_, err := nfl.execute(msg)
+	return err
+}
+
+// StartConntrackMonitor joins the given conntrack groups, some of
+// NFNLGRP_CONNTRACK_NEW, _UPDATE and _DESTROY, and calls cb for every
+// event. Events are delivered as the kernel reports them and may be lost
+// under load, which is reported as ENOBUFS on ec. The socket should not be
+// used for requests once the monitor is running.
+func (nfl *NetfilterNLSocket) StartConntrackMonitor(groups []uint32, cb ConntrackCallback, ec chan error, args ...interface{}) error {
+	for _, group := range groups {
+		err := nfl.AddMembership(group)
+		if err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		for {
+			msgList, err := nfl.RecvMessages(netlink.RECV_BUFFER_SIZE, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			for _, m := range msgList {
+				if NfSubsysId(m.Type) != NFNL_SUBSYS_CTNETLINK {
+					continue
+				}
+				ct, err := ConntrackfromMessage(m)
+				if err != nil {
+					if ec != nil {
+						ec <- err
+					}
+					continue
+				}
+				cb(&ConntrackEvent{Type: conntrackEventType(m), Conntrack: ct}, ec, args...)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func conntrackEventType(m *NfMessage) uint32 {
+	switch {
+	case NfMsgId(m.Type) == IPCTNL_MSG_CT_DELETE:
+		return NFNLGRP_CONNTRACK_DESTROY
+	case m.Flags&(syscall.NLM_F_CREATE|syscall.NLM_F_EXCL) != 0:
+		return NFNLGRP_CONNTRACK_NEW
+	}
+	return NFNLGRP_CONNTRACK_UPDATE
+}
@@ -0,0 +1,325 @@
+package netfilter
+
+import (
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestConntrackTupleWireFormat(t *testing.T) {
+	tuples := []ConntrackTuple{
+		{Src: net.ParseIP("192.0.2.1").To4(), Dst: net.ParseIP("192.0.2.2").To4(), Proto: syscall.IPPROTO_UDP,
+			SrcPort: 1024, DstPort: 53},
+		{Src: net.ParseIP("2001:db8::1"), Dst: net.ParseIP("2001:db8::2"), Proto: syscall.IPPROTO_TCP,
+			SrcPort: 40000, DstPort: 443},
+		{Src: net.ParseIP("192.0.2.1").To4(), Dst: net.ParseIP("192.0.2.2").To4(), Proto: syscall.IPPROTO_ICMP,
+			IcmpId: 7, IcmpType: 8},
+		{Src: net.ParseIP("2001:db8::1"), Dst: net.ParseIP("2001:db8::2"), Proto: syscall.IPPROTO_ICMPV6,
+			IcmpId: 7, IcmpType: 128},
+	}
+
+	for _, tuple := range tuples {
+		attr := netlink.NewAttrNested(CTA_TUPLE_ORIG, tuple.toAttrs())
+		attrs, err := attr.Nested()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := ConntrackTuplefromAttrs(attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(*got, tuple) {
+			t.Errorf("got %+v, want %+v", got, tuple)
+		}
+	}
+
+	/* IPv4 addresses are sent in four bytes even in their 16 byte form */
+	tuple := ConntrackTuple{Src: net.ParseIP("192.0.2.1"), Dst: net.ParseIP("192.0.2.2"), Proto: syscall.IPPROTO_UDP}
+	ip, _ := tuple.toAttrs()[0].Nested()
+	if ip[0].AttrType() != CTA_IP_V4_SRC || len(ip[0].Data) != 4 {
+		t.Errorf("got %+v", ip)
+	}
+}
+
+func TestConntrackfromMessage(t *testing.T) {
+	orig := ConntrackTuple{Src: net.ParseIP("192.0.2.1").To4(), Dst: net.ParseIP("192.0.2.2").To4(),
+		Proto: syscall.IPPROTO_TCP, SrcPort: 1024, DstPort: 80}
+	reply := ConntrackTuple{Src: orig.Dst, Dst: orig.Src, Proto: syscall.IPPROTO_TCP, SrcPort: 80, DstPort: 1024}
+	start := time.Unix(1000, 5)
+
+	m := testMessage(t, ctMsgType(IPCTNL_MSG_CT_NEW), NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttrNested(CTA_TUPLE_ORIG, orig.toAttrs()),
+		netlink.NewAttrNested(CTA_TUPLE_REPLY, reply.toAttrs()),
+		netlink.NewAttrNetUint32(CTA_STATUS, IPS_CONFIRMED|IPS_SEEN_REPLY),
+		netlink.NewAttrNetUint32(CTA_TIMEOUT, 120),
+		netlink.NewAttrNetUint32(CTA_MARK, 0),
+		netlink.NewAttrNetUint16(CTA_ZONE, 3),
+		netlink.NewAttrNetUint32(CTA_ID, 42),
+		netlink.NewAttrNetUint32(CTA_USE, 1),
+		netlink.NewAttr(CTA_LABELS, []byte{1, 0, 0, 0}),
+		netlink.NewAttrNested(CTA_COUNTERS_ORIG, []netlink.NetlinkAttr{
+			netlink.NewAttrNetUint64(CTA_COUNTERS_PACKETS, 2),
+			netlink.NewAttrNetUint64(CTA_COUNTERS_BYTES, 120),
+		}),
+		netlink.NewAttrNested(CTA_COUNTERS_REPLY, []netlink.NetlinkAttr{
+			netlink.NewAttrNetUint32(CTA_COUNTERS32_PACKETS, 1),
+			netlink.NewAttrNetUint32(CTA_COUNTERS32_BYTES, 60),
+		}),
+		netlink.NewAttrNested(CTA_PROTOINFO, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(CTA_PROTOINFO_TCP, []netlink.NetlinkAttr{
+				netlink.NewAttrUint8(CTA_PROTOINFO_TCP_STATE, TCP_CONNTRACK_ESTABLISHED),
+			}),
+		}),
+		netlink.NewAttrNested(CTA_TIMESTAMP, []netlink.NetlinkAttr{
+			netlink.NewAttrNetUint64(CTA_TIMESTAMP_START, uint64(start.UnixNano())),
+		}),
+	})
+
+	ct, err := ConntrackfromMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.Family != NFPROTO_IPV4 || !reflect.DeepEqual(ct.Orig, orig) || !reflect.DeepEqual(ct.Reply, reply) {
+		t.Errorf("tuples %+v %+v", ct.Orig, ct.Reply)
+	}
+	/* a zero mark is still reported */
+	if ct.Status != IPS_CONFIRMED|IPS_SEEN_REPLY || ct.Timeout != 2*time.Minute || !ct.HasMark || ct.Mark != 0 ||
+		ct.Zone != 3 || ct.Id != 42 || ct.Use != 1 || len(ct.Labels) != 4 {
+		t.Errorf("got %+v", ct)
+	}
+	if *ct.OrigCounters != (ConntrackCounters{Packets: 2, Bytes: 120}) ||
+		*ct.ReplyCounters != (ConntrackCounters{Packets: 1, Bytes: 60}) {
+		t.Errorf("counters %+v %+v", ct.OrigCounters, ct.ReplyCounters)
+	}
+	if !ct.HasTcpState || ct.TcpState != TCP_CONNTRACK_ESTABLISHED {
+		t.Errorf("tcp state %d", ct.TcpState)
+	}
+	if !ct.Start.Equal(start) || !ct.Stop.IsZero() {
+		t.Errorf("timestamps %v %v", ct.Start, ct.Stop)
+	}
+	if len(ct.Attrs) != len(m.Attrs) {
+		t.Errorf("got %d attributes", len(ct.Attrs))
+	}
+}
+
+func TestConntrackFilter(t *testing.T) {
+	tests := []struct {
+		filter *ConntrackFilter
+		attrs  []netlink.NetlinkAttr
+	}{
+		{nil, []netlink.NetlinkAttr{}},
+		{&ConntrackFilter{Family: NFPROTO_IPV6}, []netlink.NetlinkAttr{}},
+		/* a zero mask compares the whole mark */
+		{&ConntrackFilter{Mark: 1, HasMark: true}, []netlink.NetlinkAttr{
+			netlink.NewAttrNetUint32(CTA_MARK, 1),
+			netlink.NewAttrNetUint32(CTA_MARK_MASK, 0xffffffff),
+		}},
+		{&ConntrackFilter{Mark: 0x100, MarkMask: 0xff00, HasMark: true, Zone: 2, HasZone: true}, []netlink.NetlinkAttr{
+			netlink.NewAttrNetUint32(CTA_MARK, 0x100),
+			netlink.NewAttrNetUint32(CTA_MARK_MASK, 0xff00),
+			netlink.NewAttrNetUint16(CTA_ZONE, 2),
+		}},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.toAttrs(); !reflect.DeepEqual(got, test.attrs) {
+			t.Errorf("filter %+v: got %+v, want %+v", test.filter, got, test.attrs)
+		}
+	}
+	if (*ConntrackFilter)(nil).family() != NFPROTO_UNSPEC {
+		t.Error("family of no filter")
+	}
+}
+
+func TestConntrackEventType(t *testing.T) {
+	tests := []struct {
+		msg   uint8
+		flags uint16
+		group uint32
+	}{
+		{IPCTNL_MSG_CT_NEW, syscall.NLM_F_CREATE | syscall.NLM_F_EXCL, NFNLGRP_CONNTRACK_NEW},
+		{IPCTNL_MSG_CT_NEW, 0, NFNLGRP_CONNTRACK_UPDATE},
+		{IPCTNL_MSG_CT_DELETE, 0, NFNLGRP_CONNTRACK_DESTROY},
+	}
+
+	for _, test := range tests {
+		m := &NfMessage{Type: ctMsgType(test.msg)}
+		m.Flags = test.flags
+		if got := conntrackEventType(m); got != test.group {
+			t.Errorf("message %d flags %#x: got %d, want %d", test.msg, test.flags, got, test.group)
+		}
+	}
+}
+
+// addConntrack creates a UDP entry from 192.0.2.1, port sport,
+// to 192.0.2.2, as conntrack(8) -I does.
+func addConntrack(t *testing.T, nfl *NetfilterNLSocket, sport uint16, mark uint32) {
+	t.Helper()
+	orig := &ConntrackTuple{Src: net.ParseIP("192.0.2.1"), Dst: net.ParseIP("192.0.2.2"), Proto: syscall.IPPROTO_UDP,
+		SrcPort: sport, DstPort: 53}
+	reply := &ConntrackTuple{Src: orig.Dst, Dst: orig.Src, Proto: syscall.IPPROTO_UDP, SrcPort: 53, DstPort: sport}
+
+	_, err := nfl.Execute(ctMsgType(IPCTNL_MSG_CT_NEW), syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, NFPROTO_IPV4,
+		[]netlink.NetlinkAttr{
+			netlink.NewAttrNested(CTA_TUPLE_ORIG, orig.toAttrs()),
+			netlink.NewAttrNested(CTA_TUPLE_REPLY, reply.toAttrs()),
+			netlink.NewAttrNetUint32(CTA_TIMEOUT, 60),
+			netlink.NewAttrNetUint32(CTA_MARK, mark),
+		})
+	skipUnsupported(t, err)
+	if err == syscall.ENOENT {
+		t.Skipf("conntrack unavailable: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConntrack(t *testing.T) {
+	nfl := testNetns(t)
+
+	addConntrack(t, nfl, 1000, 0x101)
+	addConntrack(t, nfl, 1001, 0x201)
+	addConntrack(t, nfl, 1002, 0x202)
+
+	cts, err := nfl.ListConntrack(nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cts) != 3 {
+		t.Fatalf("got %+v", cts)
+	}
+	for _, ct := range cts {
+		if ct.Family != NFPROTO_IPV4 || ct.Orig.DstPort != 53 || ct.Reply.SrcPort != 53 || !ct.HasMark ||
+			ct.Id == 0 || ct.Timeout == 0 {
+			t.Errorf("got %+v", ct)
+		}
+	}
+
+	tests := []struct {
+		filter *ConntrackFilter
+		n      int
+	}{
+		{&ConntrackFilter{Family: NFPROTO_IPV6}, 0},
+		{&ConntrackFilter{Family: NFPROTO_IPV4, Mark: 0x201, HasMark: true}, 1},
+		{&ConntrackFilter{Mark: 0x200, MarkMask: 0xf00, HasMark: true}, 2},
+		{&ConntrackFilter{Mark: 0x1, MarkMask: 0xff, HasMark: true}, 2},
+		{&ConntrackFilter{Zone: 1, HasZone: true}, 0},
+	}
+	for _, test := range tests {
+		cts, err = nfl.ListConntrack(test.filter, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(cts) != test.n {
+			t.Errorf("filter %+v: got %d entries, want %d", test.filter, len(cts), test.n)
+		}
+	}
+
+	key := &Conntrack{Family: NFPROTO_IPV4, Orig: ConntrackTuple{Src: net.ParseIP("192.0.2.1"),
+		Dst: net.ParseIP("192.0.2.2"), Proto: syscall.IPPROTO_UDP, SrcPort: 1000, DstPort: 53}}
+	ct, err := nfl.GetConntrack(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ct.Mark != 0x101 || ct.Orig.SrcPort != 1000 {
+		t.Errorf("got %+v", ct)
+	}
+
+	key.Mark, key.HasMark = 7, true
+	key.Timeout = 30 * time.Second
+	err = nfl.UpdateConntrack(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct, _ = nfl.GetConntrack(key)
+	if ct == nil || ct.Mark != 7 || ct.Timeout > 30*time.Second {
+		t.Errorf("updated %+v", ct)
+	}
+
+	/* an entry is only deleted with its own id */
+	stale := *ct
+	stale.Id++
+	err = nfl.DelConntrack(&stale)
+	if err != syscall.ENOENT {
+		t.Errorf("deleting a stale entry: %v", err)
+	}
+	err = nfl.DelConntrack(ct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nfl.GetConntrack(key)
+	if err != syscall.ENOENT {
+		t.Errorf("deleted entry: %v", err)
+	}
+
+	if err := nfl.DelConntrack(&Conntrack{}); err != syscall.EINVAL {
+		t.Errorf("deleting without a tuple: %v", err)
+	}
+
+	/* flushes only delete the selected entries */
+	err = nfl.FlushConntrack(&ConntrackFilter{Family: NFPROTO_IPV6})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cts, _ = nfl.ListConntrack(nil, false)
+	if len(cts) != 2 {
+		t.Errorf("flushed ipv6: %+v", cts)
+	}
+	err = nfl.FlushConntrack(&ConntrackFilter{Mark: 0x202, HasMark: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cts, _ = nfl.ListConntrack(nil, false)
+	if len(cts) != 1 || cts[0].Mark != 0x201 {
+		t.Errorf("flushed by mark: %+v", cts)
+	}
+	err = nfl.FlushConntrack(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cts, _ = nfl.ListConntrack(nil, false)
+	if len(cts) != 0 {
+		t.Errorf("flushed: %+v", cts)
+	}
+}
+
+func TestConntrackMonitor(t *testing.T) {
+	nfl := testNetns(t)
+
+	ml, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ml.CloseLink()
+
+	events := make(chan *ConntrackEvent, 10)
+	cb := func(e *ConntrackEvent, ec chan error, args ...interface{}) {
+		events <- e
+	}
+	err = ml.StartConntrackMonitor([]uint32{NFNLGRP_CONNTRACK_NEW, NFNLGRP_CONNTRACK_DESTROY}, cb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addConntrack(t, nfl, 1000, 1)
+	err = nfl.FlushConntrack(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, group := range []uint32{NFNLGRP_CONNTRACK_NEW, NFNLGRP_CONNTRACK_DESTROY} {
+		select {
+		case e := <-events:
+			if e.Type != group || e.Conntrack.Orig.SrcPort != 1000 || e.Conntrack.Mark != 1 {
+				t.Errorf("got %+v %+v, want group %d", e, e.Conntrack, group)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for group %d", group)
+		}
+	}
+}
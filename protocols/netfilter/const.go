@@ -0,0 +1,832 @@
+package netfilter
+
+const (
+	NFNETLINK_V0 = 0
+	NFNETLINK_V1 = 1
+
+	SizeofNfGenMsg = 4
+
+	/* nfnetlink subsystems */
+	NFNL_SUBSYS_NONE              = 0
+	NFNL_SUBSYS_CTNETLINK         = 1
+	NFNL_SUBSYS_CTNETLINK_EXP     = 2
+	NFNL_SUBSYS_QUEUE             = 3
+	NFNL_SUBSYS_ULOG              = 4
+	NFNL_SUBSYS_OSF               = 5
+	NFNL_SUBSYS_IPSET             = 6
+	NFNL_SUBSYS_ACCT              = 7
+	NFNL_SUBSYS_CTNETLINK_TIMEOUT = 8
+	NFNL_SUBSYS_CTHELPER          = 9
+	NFNL_SUBSYS_NFTABLES          = 10
+	NFNL_SUBSYS_NFT_COMPAT        = 11
+	NFNL_SUBSYS_HOOK              = 12
+
+	NFNL_MSG_BATCH_BEGIN = 0x10
+	NFNL_MSG_BATCH_END   = 0x11
+
+	/* Multicast groups */
+	NFNLGRP_NONE                  = 0
+	NFNLGRP_CONNTRACK_NEW         = 1
+	NFNLGRP_CONNTRACK_UPDATE      = 2
+	NFNLGRP_CONNTRACK_DESTROY     = 3
+	NFNLGRP_CONNTRACK_EXP_NEW     = 4
+	NFNLGRP_CONNTRACK_EXP_UPDATE  = 5
+	NFNLGRP_CONNTRACK_EXP_DESTROY = 6
+	NFNLGRP_NFTABLES              = 7
+	NFNLGRP_ACCT_QUOTA            = 8
+	NFNLGRP_NFTRACE               = 9
+
+	/* Protocol families */
+	NFPROTO_UNSPEC = 0
+	NFPROTO_INET   = 1
+	NFPROTO_IPV4   = 2
+	NFPROTO_ARP    = 3
+	NFPROTO_NETDEV = 5
+	NFPROTO_BRIDGE = 7
+	NFPROTO_IPV6   = 10
+
+	/* Hooks */
+	NF_INET_PRE_ROUTING  = 0
+	NF_INET_LOCAL_IN     = 1
+	NF_INET_FORWARD      = 2
+	NF_INET_LOCAL_OUT    = 3
+	NF_INET_POST_ROUTING = 4
+	NF_INET_INGRESS      = 5
+
+	NF_NETDEV_INGRESS = 0
+	NF_NETDEV_EGRESS  = 1
+
+	/* Standard hook priorities */
+	NF_IP_PRI_RAW      = -300
+	NF_IP_PRI_MANGLE   = -150
+	NF_IP_PRI_NAT_DST  = -100
+	NF_IP_PRI_FILTER   = 0
+	NF_IP_PRI_SECURITY = 50
+	NF_IP_PRI_NAT_SRC  = 100
+
+	/* Verdicts */
+	NF_DROP   = 0
+	NF_ACCEPT = 1
+	NF_STOLEN = 2
+	NF_QUEUE  = 3
+	NF_REPEAT = 4
+	NF_STOP   = 5
+
+	NF_VERDICT_MASK              = 0xff
+	NF_VERDICT_QBITS             = 16
+	NF_VERDICT_FLAG_QUEUE_BYPASS = 0x8000
+
+	NFT_CONTINUE = -1
+	NFT_BREAK    = -2
+	NFT_JUMP     = -3
+	NFT_GOTO     = -4
+	NFT_RETURN   = -5
+
+	/* nf_tables messages */
+	NFT_MSG_NEWTABLE      = 0
+	NFT_MSG_GETTABLE      = 1
+	NFT_MSG_DELTABLE      = 2
+	NFT_MSG_NEWCHAIN      = 3
+	NFT_MSG_GETCHAIN      = 4
+	NFT_MSG_DELCHAIN      = 5
+	NFT_MSG_NEWRULE       = 6
+	NFT_MSG_GETRULE       = 7
+	NFT_MSG_DELRULE       = 8
+	NFT_MSG_NEWSET        = 9
+	NFT_MSG_GETSET        = 10
+	NFT_MSG_DELSET        = 11
+	NFT_MSG_NEWSETELEM    = 12
+	NFT_MSG_GETSETELEM    = 13
+	NFT_MSG_DELSETELEM    = 14
+	NFT_MSG_NEWGEN        = 15
+	NFT_MSG_GETGEN        = 16
+	NFT_MSG_TRACE         = 17
+	NFT_MSG_NEWOBJ        = 18
+	NFT_MSG_GETOBJ        = 19
+	NFT_MSG_DELOBJ        = 20
+	NFT_MSG_GETOBJ_RESET  = 21
+	NFT_MSG_NEWFLOWTABLE  = 22
+	NFT_MSG_GETFLOWTABLE  = 23
+	NFT_MSG_DELFLOWTABLE  = 24
+	NFT_MSG_GETRULE_RESET = 25
+
+	/* Registers */
+	NFT_REG_VERDICT = 0
+	NFT_REG_1       = 1
+	NFT_REG_2       = 2
+	NFT_REG_3       = 3
+	NFT_REG_4       = 4
+	NFT_REG32_00    = 8
+	NFT_REG32_15    = 23
+
+	/* Table attributes */
+	NFTA_TABLE_UNSPEC   = 0
+	NFTA_TABLE_NAME     = 1
+	NFTA_TABLE_FLAGS    = 2
+	NFTA_TABLE_USE      = 3
+	NFTA_TABLE_HANDLE   = 4
+	NFTA_TABLE_PAD      = 5
+	NFTA_TABLE_USERDATA = 6
+	NFTA_TABLE_OWNER    = 7
+
+	NFT_TABLE_F_DORMANT = 0x1
+	NFT_TABLE_F_OWNER   = 0x2
+
+	/* Chain attributes */
+	NFTA_CHAIN_UNSPEC   = 0
+	NFTA_CHAIN_TABLE    = 1
+	NFTA_CHAIN_HANDLE   = 2
+	NFTA_CHAIN_NAME     = 3
+	NFTA_CHAIN_HOOK     = 4
+	NFTA_CHAIN_POLICY   = 5
+	NFTA_CHAIN_USE      = 6
+	NFTA_CHAIN_TYPE     = 7
+	NFTA_CHAIN_COUNTERS = 8
+	NFTA_CHAIN_PAD      = 9
+	NFTA_CHAIN_FLAGS    = 10
+	NFTA_CHAIN_ID       = 11
+	NFTA_CHAIN_USERDATA = 12
+
+	NFT_CHAIN_BASE       = 0x1
+	NFT_CHAIN_HW_OFFLOAD = 0x2
+	NFT_CHAIN_BINDING    = 0x4
+
+	NFTA_HOOK_UNSPEC   = 0
+	NFTA_HOOK_HOOKNUM  = 1
+	NFTA_HOOK_PRIORITY = 2
+	NFTA_HOOK_DEV      = 3
+	NFTA_HOOK_DEVS     = 4
+
+	/* Rule attributes */
+	NFTA_RULE_UNSPEC      = 0
+	NFTA_RULE_TABLE       = 1
+	NFTA_RULE_CHAIN       = 2
+	NFTA_RULE_HANDLE      = 3
+	NFTA_RULE_EXPRESSIONS = 4
+	NFTA_RULE_COMPAT      = 5
+	NFTA_RULE_POSITION    = 6
+	NFTA_RULE_USERDATA    = 7
+	NFTA_RULE_PAD         = 8
+	NFTA_RULE_ID          = 9
+	NFTA_RULE_POSITION_ID = 10
+	NFTA_RULE_CHAIN_ID    = 11
+
+	NFTA_LIST_UNSPEC = 0
+	NFTA_LIST_ELEM   = 1
+
+	NFTA_EXPR_UNSPEC = 0
+	NFTA_EXPR_NAME   = 1
+	NFTA_EXPR_DATA   = 2
+
+	/* Generation attributes, sent with NFT_MSG_NEWGEN after each transaction */
+	NFTA_GEN_UNSPEC    = 0
+	NFTA_GEN_ID        = 1
+	NFTA_GEN_PROC_PID  = 2
+	NFTA_GEN_PROC_NAME = 3
+
+	/* Set attributes */
+	NFTA_SET_UNSPEC      = 0
+	NFTA_SET_TABLE       = 1
+	NFTA_SET_NAME        = 2
+	NFTA_SET_FLAGS       = 3
+	NFTA_SET_KEY_TYPE    = 4
+	NFTA_SET_KEY_LEN     = 5
+	NFTA_SET_DATA_TYPE   = 6
+	NFTA_SET_DATA_LEN    = 7
+	NFTA_SET_POLICY      = 8
+	NFTA_SET_DESC        = 9
+	NFTA_SET_ID          = 10
+	NFTA_SET_TIMEOUT     = 11
+	NFTA_SET_GC_INTERVAL = 12
+	NFTA_SET_USERDATA    = 13
+	NFTA_SET_PAD         = 14
+	NFTA_SET_OBJ_TYPE    = 15
+	NFTA_SET_HANDLE      = 16
+	NFTA_SET_EXPR        = 17
+	NFTA_SET_EXPRESSIONS = 18
+
+	NFT_SET_ANONYMOUS = 0x1
+	NFT_SET_CONSTANT  = 0x2
+	NFT_SET_INTERVAL  = 0x4
+	NFT_SET_MAP       = 0x8
+	NFT_SET_TIMEOUT   = 0x10
+	NFT_SET_EVAL      = 0x20
+	NFT_SET_OBJECT    = 0x40
+	NFT_SET_CONCAT    = 0x80
+	NFT_SET_EXPR      = 0x100
+
+	NFT_SET_POL_PERFORMANCE = 0
+	NFT_SET_POL_MEMORY      = 1
+
+	NFTA_SET_DESC_UNSPEC = 0
+	NFTA_SET_DESC_SIZE   = 1
+	NFTA_SET_DESC_CONCAT = 2
+
+	NFTA_SET_FIELD_UNSPEC = 0
+	NFTA_SET_FIELD_LEN    = 1
+
+	NFTA_SET_ELEM_LIST_UNSPEC   = 0
+	NFTA_SET_ELEM_LIST_TABLE    = 1
+	NFTA_SET_ELEM_LIST_SET      = 2
+	NFTA_SET_ELEM_LIST_ELEMENTS = 3
+	NFTA_SET_ELEM_LIST_SET_ID   = 4
+
+	NFTA_SET_ELEM_UNSPEC      = 0
+	NFTA_SET_ELEM_KEY         = 1
+	NFTA_SET_ELEM_DATA        = 2
+	NFTA_SET_ELEM_FLAGS       = 3
+	NFTA_SET_ELEM_TIMEOUT     = 4
+	NFTA_SET_ELEM_EXPIRATION  = 5
+	NFTA_SET_ELEM_USERDATA    = 6
+	NFTA_SET_ELEM_EXPR        = 7
+	NFTA_SET_ELEM_PAD         = 8
+	NFTA_SET_ELEM_OBJREF      = 9
+	NFTA_SET_ELEM_KEY_END     = 10
+	NFTA_SET_ELEM_EXPRESSIONS = 11
+
+	NFT_SET_ELEM_INTERVAL_END = 0x1
+	NFT_SET_ELEM_CATCHALL     = 0x2
+
+	/* Data types of set keys and map values, as used by nft(8) */
+	NFT_DATA_VALUE   = 0
+	NFT_DATA_VERDICT = 0xffffff00
+
+	NFT_TYPE_INVALID       = 0
+	NFT_TYPE_VERDICT       = 1
+	NFT_TYPE_NFPROTO       = 2
+	NFT_TYPE_BITMASK       = 3
+	NFT_TYPE_INTEGER       = 4
+	NFT_TYPE_STRING        = 5
+	NFT_TYPE_LLADDR        = 6
+	NFT_TYPE_IPADDR        = 7
+	NFT_TYPE_IP6ADDR       = 8
+	NFT_TYPE_ETHERADDR     = 9
+	NFT_TYPE_ETHERTYPE     = 10
+	NFT_TYPE_ARPOP         = 11
+	NFT_TYPE_INET_PROTOCOL = 12
+	NFT_TYPE_INET_SERVICE  = 13
+	NFT_TYPE_ICMP_TYPE     = 14
+	NFT_TYPE_TCP_FLAG      = 15
+	NFT_TYPE_DCCP_PKTTYPE  = 16
+	NFT_TYPE_MH_TYPE       = 17
+	NFT_TYPE_TIME          = 18
+	NFT_TYPE_MARK          = 19
+	NFT_TYPE_IFINDEX       = 20
+	NFT_TYPE_ARPHRD        = 21
+	NFT_TYPE_REALM         = 22
+	NFT_TYPE_CLASSID       = 23
+	NFT_TYPE_UID           = 24
+	NFT_TYPE_GID           = 25
+	NFT_TYPE_CT_STATE      = 26
+	NFT_TYPE_CT_DIR        = 27
+	NFT_TYPE_CT_STATUS     = 28
+	NFT_TYPE_ICMP6_TYPE    = 29
+	NFT_TYPE_IFNAME        = 41
+
+	NFT_TYPE_BITS = 6
+
+	/* Data attributes */
+	NFTA_DATA_UNSPEC  = 0
+	NFTA_DATA_VALUE   = 1
+	NFTA_DATA_VERDICT = 2
+
+	NFTA_VERDICT_UNSPEC   = 0
+	NFTA_VERDICT_CODE     = 1
+	NFTA_VERDICT_CHAIN    = 2
+	NFTA_VERDICT_CHAIN_ID = 3
+
+	/* Expression attributes */
+	NFTA_IMMEDIATE_UNSPEC = 0
+	NFTA_IMMEDIATE_DREG   = 1
+	NFTA_IMMEDIATE_DATA   = 2
+
+	NFTA_CMP_UNSPEC = 0
+	NFTA_CMP_SREG   = 1
+	NFTA_CMP_OP     = 2
+	NFTA_CMP_DATA   = 3
+
+	NFT_CMP_EQ  = 0
+	NFT_CMP_NEQ = 1
+	NFT_CMP_LT  = 2
+	NFT_CMP_LTE = 3
+	NFT_CMP_GT  = 4
+	NFT_CMP_GTE = 5
+
+	NFTA_BITWISE_UNSPEC = 0
+	NFTA_BITWISE_SREG   = 1
+	NFTA_BITWISE_DREG   = 2
+	NFTA_BITWISE_LEN    = 3
+	NFTA_BITWISE_MASK   = 4
+	NFTA_BITWISE_XOR    = 5
+	NFTA_BITWISE_OP     = 6
+	NFTA_BITWISE_DATA   = 7
+
+	NFT_BITWISE_BOOL   = 0
+	NFT_BITWISE_LSHIFT = 1
+	NFT_BITWISE_RSHIFT = 2
+
+	NFTA_LOOKUP_UNSPEC = 0
+	NFTA_LOOKUP_SET    = 1
+	NFTA_LOOKUP_SREG   = 2
+	NFTA_LOOKUP_DREG   = 3
+	NFTA_LOOKUP_SET_ID = 4
+	NFTA_LOOKUP_FLAGS  = 5
+
+	NFT_LOOKUP_F_INV = 0x1
+
+	NFTA_DYNSET_UNSPEC      = 0
+	NFTA_DYNSET_SET_NAME    = 1
+	NFTA_DYNSET_SET_ID      = 2
+	NFTA_DYNSET_OP          = 3
+	NFTA_DYNSET_SREG_KEY    = 4
+	NFTA_DYNSET_SREG_DATA   = 5
+	NFTA_DYNSET_TIMEOUT     = 6
+	NFTA_DYNSET_EXPR        = 7
+	NFTA_DYNSET_PAD         = 8
+	NFTA_DYNSET_FLAGS       = 9
+	NFTA_DYNSET_EXPRESSIONS = 10
+
+	NFT_DYNSET_OP_ADD    = 0
+	NFT_DYNSET_OP_UPDATE = 1
+	NFT_DYNSET_OP_DELETE = 2
+
+	NFT_DYNSET_F_INV  = 0x1
+	NFT_DYNSET_F_EXPR = 0x2
+
+	NFTA_PAYLOAD_UNSPEC      = 0
+	NFTA_PAYLOAD_DREG        = 1
+	NFTA_PAYLOAD_BASE        = 2
+	NFTA_PAYLOAD_OFFSET      = 3
+	NFTA_PAYLOAD_LEN         = 4
+	NFTA_PAYLOAD_SREG        = 5
+	NFTA_PAYLOAD_CSUM_TYPE   = 6
+	NFTA_PAYLOAD_CSUM_OFFSET = 7
+	NFTA_PAYLOAD_CSUM_FLAGS  = 8
+
+	NFT_PAYLOAD_LL_HEADER        = 0
+	NFT_PAYLOAD_NETWORK_HEADER   = 1
+	NFT_PAYLOAD_TRANSPORT_HEADER = 2
+	NFT_PAYLOAD_INNER_HEADER     = 3
+
+	NFT_PAYLOAD_CSUM_NONE = 0
+	NFT_PAYLOAD_CSUM_INET = 1
+	NFT_PAYLOAD_CSUM_SCTP = 2
+
+	NFT_PAYLOAD_L4CSUM_PSEUDOHDR = 0x1
+
+	NFTA_META_UNSPEC = 0
+	NFTA_META_DREG   = 1
+	NFTA_META_KEY    = 2
+	NFTA_META_SREG   = 3
+
+	NFT_META_LEN           = 0
+	NFT_META_PROTOCOL      = 1
+	NFT_META_PRIORITY      = 2
+	NFT_META_MARK          = 3
+	NFT_META_IIF           = 4
+	NFT_META_OIF           = 5
+	NFT_META_IIFNAME       = 6
+	NFT_META_OIFNAME       = 7
+	NFT_META_IIFTYPE       = 8
+	NFT_META_OIFTYPE       = 9
+	NFT_META_SKUID         = 10
+	NFT_META_SKGID         = 11
+	NFT_META_NFTRACE       = 12
+	NFT_META_RTCLASSID     = 13
+	NFT_META_SECMARK       = 14
+	NFT_META_NFPROTO       = 15
+	NFT_META_L4PROTO       = 16
+	NFT_META_BRI_IIFNAME   = 17
+	NFT_META_BRI_OIFNAME   = 18
+	NFT_META_PKTTYPE       = 19
+	NFT_META_CPU           = 20
+	NFT_META_IIFGROUP      = 21
+	NFT_META_OIFGROUP      = 22
+	NFT_META_CGROUP        = 23
+	NFT_META_PRANDOM       = 24
+	NFT_META_SECPATH       = 25
+	NFT_META_IIFKIND       = 26
+	NFT_META_OIFKIND       = 27
+	NFT_META_BRI_IIFPVID   = 28
+	NFT_META_BRI_IIFVPROTO = 29
+	NFT_META_TIME_NS       = 30
+	NFT_META_TIME_DAY      = 31
+	NFT_META_TIME_HOUR     = 32
+	NFT_META_SDIF          = 33
+	NFT_META_SDIFNAME      = 34
+
+	NFTA_COUNTER_UNSPEC  = 0
+	NFTA_COUNTER_BYTES   = 1
+	NFTA_COUNTER_PACKETS = 2
+	NFTA_COUNTER_PAD     = 3
+
+	NFTA_CT_UNSPEC    = 0
+	NFTA_CT_DREG      = 1
+	NFTA_CT_KEY       = 2
+	NFTA_CT_DIRECTION = 3
+	NFTA_CT_SREG      = 4
+
+	NFT_CT_STATE      = 0
+	NFT_CT_DIRECTION  = 1
+	NFT_CT_STATUS     = 2
+	NFT_CT_MARK       = 3
+	NFT_CT_SECMARK    = 4
+	NFT_CT_EXPIRATION = 5
+	NFT_CT_HELPER     = 6
+	NFT_CT_L3PROTOCOL = 7
+	NFT_CT_SRC        = 8
+	NFT_CT_DST        = 9
+	NFT_CT_PROTOCOL   = 10
+	NFT_CT_PROTO_SRC  = 11
+	NFT_CT_PROTO_DST  = 12
+	NFT_CT_LABELS     = 13
+	NFT_CT_PKTS       = 14
+	NFT_CT_BYTES      = 15
+	NFT_CT_AVGPKT     = 16
+	NFT_CT_ZONE       = 17
+	NFT_CT_EVENTMASK  = 18
+	NFT_CT_SRC_IP     = 19
+	NFT_CT_DST_IP     = 20
+	NFT_CT_SRC_IP6    = 21
+	NFT_CT_DST_IP6    = 22
+	NFT_CT_ID         = 23
+
+	/* Connection tracking states, as matched by NFT_CT_STATE */
+	NF_CT_STATE_INVALID     = 0x01
+	NF_CT_STATE_ESTABLISHED = 0x02
+	NF_CT_STATE_RELATED     = 0x04
+	NF_CT_STATE_NEW         = 0x08
+	NF_CT_STATE_UNTRACKED   = 0x40
+
+	IP_CT_DIR_ORIGINAL = 0
+	IP_CT_DIR_REPLY    = 1
+
+	/* ctnetlink messages */
+	IPCTNL_MSG_CT_NEW             = 0
+	IPCTNL_MSG_CT_GET             = 1
+	IPCTNL_MSG_CT_DELETE          = 2
+	IPCTNL_MSG_CT_GET_CTRZERO     = 3
+	IPCTNL_MSG_CT_GET_STATS_CPU   = 4
+	IPCTNL_MSG_CT_GET_STATS       = 5
+	IPCTNL_MSG_CT_GET_DYING       = 6
+	IPCTNL_MSG_CT_GET_UNCONFIRMED = 7
+
+	/* Conntrack attributes */
+	CTA_UNSPEC         = 0
+	CTA_TUPLE_ORIG     = 1
+	CTA_TUPLE_REPLY    = 2
+	CTA_STATUS         = 3
+	CTA_PROTOINFO      = 4
+	CTA_HELP           = 5
+	CTA_NAT_SRC        = 6
+	CTA_TIMEOUT        = 7
+	CTA_MARK           = 8
+	CTA_COUNTERS_ORIG  = 9
+	CTA_COUNTERS_REPLY = 10
+	CTA_USE            = 11
+	CTA_ID             = 12
+	CTA_NAT_DST        = 13
+	CTA_TUPLE_MASTER   = 14
+	CTA_SEQ_ADJ_ORIG   = 15
+	CTA_SEQ_ADJ_REPLY  = 16
+	CTA_SECMARK        = 17
+	CTA_ZONE           = 18
+	CTA_SECCTX         = 19
+	CTA_TIMESTAMP      = 20
+	CTA_MARK_MASK      = 21
+	CTA_LABELS         = 22
+	CTA_LABELS_MASK    = 23
+	CTA_SYNPROXY       = 24
+	CTA_FILTER         = 25
+	CTA_STATUS_MASK    = 26
+
+	CTA_TUPLE_UNSPEC = 0
+	CTA_TUPLE_IP     = 1
+	CTA_TUPLE_PROTO  = 2
+	CTA_TUPLE_ZONE   = 3
+
+	CTA_IP_UNSPEC = 0
+	CTA_IP_V4_SRC = 1
+	CTA_IP_V4_DST = 2
+	CTA_IP_V6_SRC = 3
+	CTA_IP_V6_DST = 4
+
+	CTA_PROTO_UNSPEC      = 0
+	CTA_PROTO_NUM         = 1
+	CTA_PROTO_SRC_PORT    = 2
+	CTA_PROTO_DST_PORT    = 3
+	CTA_PROTO_ICMP_ID     = 4
+	CTA_PROTO_ICMP_TYPE   = 5
+	CTA_PROTO_ICMP_CODE   = 6
+	CTA_PROTO_ICMPV6_ID   = 7
+	CTA_PROTO_ICMPV6_TYPE = 8
+	CTA_PROTO_ICMPV6_CODE = 9
+
+	CTA_COUNTERS_UNSPEC    = 0
+	CTA_COUNTERS_PACKETS   = 1
+	CTA_COUNTERS_BYTES     = 2
+	CTA_COUNTERS32_PACKETS = 3
+	CTA_COUNTERS32_BYTES   = 4
+	CTA_COUNTERS_PAD       = 5
+
+	CTA_TIMESTAMP_UNSPEC = 0
+	CTA_TIMESTAMP_START  = 1
+	CTA_TIMESTAMP_STOP   = 2
+
+	CTA_PROTOINFO_UNSPEC = 0
+	CTA_PROTOINFO_TCP    = 1
+	CTA_PROTOINFO_DCCP   = 2
+	CTA_PROTOINFO_SCTP   = 3
+
+	CTA_PROTOINFO_TCP_UNSPEC          = 0
+	CTA_PROTOINFO_TCP_STATE           = 1
+	CTA_PROTOINFO_TCP_WSCALE_ORIGINAL = 2
+	CTA_PROTOINFO_TCP_WSCALE_REPLY    = 3
+	CTA_PROTOINFO_TCP_FLAGS_ORIGINAL  = 4
+	CTA_PROTOINFO_TCP_FLAGS_REPLY     = 5
+
+	/* Conntrack status bits */
+	IPS_EXPECTED      = 0x1
+	IPS_SEEN_REPLY    = 0x2
+	IPS_ASSURED       = 0x4
+	IPS_CONFIRMED     = 0x8
+	IPS_SRC_NAT       = 0x10
+	IPS_DST_NAT       = 0x20
+	IPS_SEQ_ADJUST    = 0x40
+	IPS_SRC_NAT_DONE  = 0x80
+	IPS_DST_NAT_DONE  = 0x100
+	IPS_DYING         = 0x200
+	IPS_FIXED_TIMEOUT = 0x400
+	IPS_TEMPLATE      = 0x800
+	IPS_UNTRACKED     = 0x1000
+	IPS_HELPER        = 0x2000
+	IPS_OFFLOAD       = 0x4000
+	IPS_HW_OFFLOAD    = 0x8000
+
+	/* TCP conntrack states */
+	TCP_CONNTRACK_NONE        = 0
+	TCP_CONNTRACK_SYN_SENT    = 1
+	TCP_CONNTRACK_SYN_RECV    = 2
+	TCP_CONNTRACK_ESTABLISHED = 3
+	TCP_CONNTRACK_FIN_WAIT    = 4
+	TCP_CONNTRACK_CLOSE_WAIT  = 5
+	TCP_CONNTRACK_LAST_ACK    = 6
+	TCP_CONNTRACK_TIME_WAIT   = 7
+	TCP_CONNTRACK_CLOSE       = 8
+	TCP_CONNTRACK_SYN_SENT2   = 9
+
+	/* nflog messages */
+	NFULNL_MSG_PACKET = 0
+	NFULNL_MSG_CONFIG = 1
+
+	SizeofNfulnlMsgPacketHdr = 4
+	SizeofNfulnlMsgPacketHw  = 12
+
+	/* nflog packet attributes */
+	NFULA_UNSPEC             = 0
+	NFULA_PACKET_HDR         = 1
+	NFULA_MARK               = 2
+	NFULA_TIMESTAMP          = 3
+	NFULA_IFINDEX_INDEV      = 4
+	NFULA_IFINDEX_OUTDEV     = 5
+	NFULA_IFINDEX_PHYSINDEV  = 6
+	NFULA_IFINDEX_PHYSOUTDEV = 7
+	NFULA_HWADDR             = 8
+	NFULA_PAYLOAD            = 9
+	NFULA_PREFIX             = 10
+	NFULA_UID                = 11
+	NFULA_SEQ                = 12
+	NFULA_SEQ_GLOBAL         = 13
+	NFULA_GID                = 14
+	NFULA_HWTYPE             = 15
+	NFULA_HWHEADER           = 16
+	NFULA_HWLEN              = 17
+	NFULA_CT                 = 18
+	NFULA_CT_INFO            = 19
+	NFULA_VLAN               = 20
+	NFULA_L2HDR              = 21
+
+	/* nflog config commands */
+	NFULNL_CFG_CMD_NONE      = 0
+	NFULNL_CFG_CMD_BIND      = 1
+	NFULNL_CFG_CMD_UNBIND    = 2
+	NFULNL_CFG_CMD_PF_BIND   = 3
+	NFULNL_CFG_CMD_PF_UNBIND = 4
+
+	/* nflog config attributes */
+	NFULA_CFG_UNSPEC   = 0
+	NFULA_CFG_CMD      = 1
+	NFULA_CFG_MODE     = 2
+	NFULA_CFG_NLBUFSIZ = 3
+	NFULA_CFG_TIMEOUT  = 4
+	NFULA_CFG_QTHRESH  = 5
+	NFULA_CFG_FLAGS    = 6
+
+	/* nflog copy modes */
+	NFULNL_COPY_NONE     = 0
+	NFULNL_COPY_META     = 1
+	NFULNL_COPY_PACKET   = 2
+	NFULNL_COPY_DISABLED = 3
+
+	/* nflog config flags */
+	NFULNL_CFG_F_SEQ        = 0x1
+	NFULNL_CFG_F_SEQ_GLOBAL = 0x2
+	NFULNL_CFG_F_CONNTRACK  = 0x4
+
+	/* nfqueue messages */
+	NFQNL_MSG_PACKET        = 0
+	NFQNL_MSG_VERDICT       = 1
+	NFQNL_MSG_CONFIG        = 2
+	NFQNL_MSG_VERDICT_BATCH = 3
+
+	SizeofNfqnlMsgPacketHdr  = 7
+	SizeofNfqnlMsgPacketHw   = 12
+	SizeofNfqnlMsgVerdictHdr = 8
+
+	/* nfqueue packet attributes */
+	NFQA_UNSPEC             = 0
+	NFQA_PACKET_HDR         = 1
+	NFQA_VERDICT_HDR        = 2
+	NFQA_MARK               = 3
+	NFQA_TIMESTAMP          = 4
+	NFQA_IFINDEX_INDEV      = 5
+	NFQA_IFINDEX_OUTDEV     = 6
+	NFQA_IFINDEX_PHYSINDEV  = 7
+	NFQA_IFINDEX_PHYSOUTDEV = 8
+	NFQA_HWADDR             = 9
+	NFQA_PAYLOAD            = 10
+	NFQA_CT                 = 11
+	NFQA_CT_INFO            = 12
+	NFQA_CAP_LEN            = 13
+	NFQA_SKB_INFO           = 14
+	NFQA_EXP                = 15
+	NFQA_UID                = 16
+	NFQA_GID                = 17
+	NFQA_SECCTX             = 18
+	NFQA_VLAN               = 19
+	NFQA_L2HDR              = 20
+	NFQA_PRIORITY           = 21
+	NFQA_CGROUP_CLASSID     = 22
+
+	/* nfqueue config commands */
+	NFQNL_CFG_CMD_NONE      = 0
+	NFQNL_CFG_CMD_BIND      = 1
+	NFQNL_CFG_CMD_UNBIND    = 2
+	NFQNL_CFG_CMD_PF_BIND   = 3
+	NFQNL_CFG_CMD_PF_UNBIND = 4
+
+	/* nfqueue copy modes */
+	NFQNL_COPY_NONE   = 0
+	NFQNL_COPY_META   = 1
+	NFQNL_COPY_PACKET = 2
+
+	/* nfqueue config attributes */
+	NFQA_CFG_UNSPEC       = 0
+	NFQA_CFG_CMD          = 1
+	NFQA_CFG_PARAMS       = 2
+	NFQA_CFG_QUEUE_MAXLEN = 3
+	NFQA_CFG_MASK         = 4
+	NFQA_CFG_FLAGS        = 5
+
+	/* nfqueue config flags */
+	NFQA_CFG_F_FAIL_OPEN = 0x1
+	NFQA_CFG_F_CONNTRACK = 0x2
+	NFQA_CFG_F_GSO       = 0x4
+	NFQA_CFG_F_UID_GID   = 0x8
+	NFQA_CFG_F_SECCTX    = 0x10
+
+	/* nfqueue skb info flags */
+	NFQA_SKB_CSUMNOTREADY     = 0x1
+	NFQA_SKB_GSO              = 0x2
+	NFQA_SKB_CSUM_NOTVERIFIED = 0x4
+
+	/* ipset */
+	IPSET_PROTOCOL     = 7
+	IPSET_PROTOCOL_MIN = 6
+	IPSET_MAXNAMELEN   = 32
+
+	/* ipset commands */
+	IPSET_CMD_NONE        = 0
+	IPSET_CMD_PROTOCOL    = 1
+	IPSET_CMD_CREATE      = 2
+	IPSET_CMD_DESTROY     = 3
+	IPSET_CMD_FLUSH       = 4
+	IPSET_CMD_RENAME      = 5
+	IPSET_CMD_SWAP        = 6
+	IPSET_CMD_LIST        = 7
+	IPSET_CMD_SAVE        = 8
+	IPSET_CMD_ADD         = 9
+	IPSET_CMD_DEL         = 10
+	IPSET_CMD_TEST        = 11
+	IPSET_CMD_HEADER      = 12
+	IPSET_CMD_TYPE        = 13
+	IPSET_CMD_GET_BYNAME  = 14
+	IPSET_CMD_GET_BYINDEX = 15
+
+	/* ipset command attributes */
+	IPSET_ATTR_UNSPEC       = 0
+	IPSET_ATTR_PROTOCOL     = 1
+	IPSET_ATTR_SETNAME      = 2
+	IPSET_ATTR_TYPENAME     = 3
+	IPSET_ATTR_SETNAME2     = IPSET_ATTR_TYPENAME
+	IPSET_ATTR_REVISION     = 4
+	IPSET_ATTR_FAMILY       = 5
+	IPSET_ATTR_FLAGS        = 6
+	IPSET_ATTR_DATA         = 7
+	IPSET_ATTR_ADT          = 8
+	IPSET_ATTR_LINENO       = 9
+	IPSET_ATTR_PROTOCOL_MIN = 10
+	IPSET_ATTR_REVISION_MIN = IPSET_ATTR_PROTOCOL_MIN
+	IPSET_ATTR_INDEX        = 11
+
+	/* ipset create and data attributes */
+	IPSET_ATTR_IP          = 1
+	IPSET_ATTR_IP_FROM     = IPSET_ATTR_IP
+	IPSET_ATTR_IP_TO       = 2
+	IPSET_ATTR_CIDR        = 3
+	IPSET_ATTR_PORT        = 4
+	IPSET_ATTR_PORT_FROM   = IPSET_ATTR_PORT
+	IPSET_ATTR_PORT_TO     = 5
+	IPSET_ATTR_TIMEOUT     = 6
+	IPSET_ATTR_PROTO       = 7
+	IPSET_ATTR_CADT_FLAGS  = 8
+	IPSET_ATTR_CADT_LINENO = IPSET_ATTR_LINENO
+	IPSET_ATTR_MARK        = 10
+	IPSET_ATTR_MARKMASK    = 11
+	IPSET_ATTR_CADT_MAX    = 16
+	IPSET_ATTR_INITVAL     = 17
+	IPSET_ATTR_HASHSIZE    = 18
+	IPSET_ATTR_MAXELEM     = 19
+	IPSET_ATTR_NETMASK     = 20
+	IPSET_ATTR_BUCKETSIZE  = 21
+	IPSET_ATTR_RESIZE      = 22
+	IPSET_ATTR_SIZE        = 23
+	IPSET_ATTR_ELEMENTS    = 24
+	IPSET_ATTR_REFERENCES  = 25
+	IPSET_ATTR_MEMSIZE     = 26
+
+	/* ipset add, del and test attributes */
+	IPSET_ATTR_ETHER    = 17
+	IPSET_ATTR_NAME     = 18
+	IPSET_ATTR_NAMEREF  = 19
+	IPSET_ATTR_IP2      = 20
+	IPSET_ATTR_CIDR2    = 21
+	IPSET_ATTR_IP2_TO   = 22
+	IPSET_ATTR_IFACE    = 23
+	IPSET_ATTR_BYTES    = 24
+	IPSET_ATTR_PACKETS  = 25
+	IPSET_ATTR_COMMENT  = 26
+	IPSET_ATTR_SKBMARK  = 27
+	IPSET_ATTR_SKBPRIO  = 28
+	IPSET_ATTR_SKBQUEUE = 29
+	IPSET_ATTR_PAD      = 30
+
+	/* ipset address attributes */
+	IPSET_ATTR_IPADDR_IPV4 = 1
+	IPSET_ATTR_IPADDR_IPV6 = 2
+
+	/* ipset command flags */
+	IPSET_FLAG_EXIST                  = 0x1
+	IPSET_FLAG_LIST_SETNAME           = 0x2
+	IPSET_FLAG_LIST_HEADER            = 0x4
+	IPSET_FLAG_SKIP_COUNTER_UPDATE    = 0x8
+	IPSET_FLAG_SKIP_SUBCOUNTER_UPDATE = 0x10
+	IPSET_FLAG_MATCH_COUNTERS         = 0x20
+	IPSET_FLAG_RETURN_NOMATCH         = 0x80
+	IPSET_FLAG_MAP_SKBMARK            = 0x100
+	IPSET_FLAG_MAP_SKBPRIO            = 0x200
+	IPSET_FLAG_MAP_SKBQUEUE           = 0x400
+
+	/* ipset create and data flags */
+	IPSET_FLAG_BEFORE         = 0x1
+	IPSET_FLAG_PHYSDEV        = 0x2
+	IPSET_FLAG_NOMATCH        = 0x4
+	IPSET_FLAG_WITH_COUNTERS  = 0x8
+	IPSET_FLAG_WITH_COMMENT   = 0x10
+	IPSET_FLAG_WITH_FORCEADD  = 0x20
+	IPSET_FLAG_WITH_SKBINFO   = 0x40
+	IPSET_FLAG_IFACE_WILDCARD = 0x80
+
+	/* ipset errors */
+	IPSET_ERR_PRIVATE              = 4096
+	IPSET_ERR_PROTOCOL             = 4097
+	IPSET_ERR_FIND_TYPE            = 4098
+	IPSET_ERR_MAX_SETS             = 4099
+	IPSET_ERR_BUSY                 = 4100
+	IPSET_ERR_EXIST_SETNAME2       = 4101
+	IPSET_ERR_TYPE_MISMATCH        = 4102
+	IPSET_ERR_EXIST                = 4103
+	IPSET_ERR_INVALID_CIDR         = 4104
+	IPSET_ERR_INVALID_NETMASK      = 4105
+	IPSET_ERR_INVALID_FAMILY       = 4106
+	IPSET_ERR_TIMEOUT              = 4107
+	IPSET_ERR_REFERENCED           = 4108
+	IPSET_ERR_IPADDR_IPV4          = 4109
+	IPSET_ERR_IPADDR_IPV6          = 4110
+	IPSET_ERR_COUNTER              = 4111
+	IPSET_ERR_COMMENT              = 4112
+	IPSET_ERR_INVALID_MARKMASK     = 4113
+	IPSET_ERR_SKBINFO              = 4114
+	IPSET_ERR_BITMASK_NETMASK_EXCL = 4115
+	IPSET_ERR_TYPE_SPECIFIC        = 4352
+)
@@ -0,0 +1,591 @@
+package netfilter
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+// Ipset is an ipset set of Type hash:ip, hash:net, hash:ip,port or
+// bitmap:port, among others. Family is NFPROTO_IPV4 or NFPROTO_IPV6 for
+// hash types and NFPROTO_UNSPEC for bitmap:port, whose range is given by
+// PortFrom and PortTo. The latest revision of the type is used when Revision
+// is 0. Timeout is the default timeout of entries, which can then be given
+// one of their own. Size, References, Elements and MemSize are only reported
+// by the kernel.
+type Ipset struct {
+	Name       string
+	Type       string
+	Revision   uint8
+	Family     uint8
+	HashSize   uint32
+	MaxElem    uint32
+	NetMask    uint8
+	PortFrom   uint16
+	PortTo     uint16
+	Timeout    time.Duration
+	HasTimeout bool
+	Counters   bool
+	Comment    bool
+	Size       uint32
+	References uint32
+	Elements   uint32
+	MemSize    uint32
+	Entries    []*IpsetEntry
+	Attrs      []netlink.NetlinkAttr
+}
+
+// IpsetEntry is an entry of a set, with the fields its type uses: IP, and
+// CIDR for networks, Port and Proto, which hash:ip,port requires. Timeout,
+// Comment and the counters can only be used with sets created with them.
+type IpsetEntry struct {
+	IP      net.IP
+	CIDR    uint8
+	Port    uint16
+	Proto   uint8
+	Timeout time.Duration
+	Comment string
+	Packets uint64
+	Bytes   uint64
+	NoMatch bool
+}
+
+// IpsetError is an ipset specific error reported by the kernel.
+type IpsetError syscall.Errno
+
+var ipsetErrors = map[IpsetError]string{
+	IPSET_ERR_PROTOCOL:             "kernel does not support the protocol",
+	IPSET_ERR_FIND_TYPE:            "set type not supported",
+	IPSET_ERR_MAX_SETS:             "maximal number of sets reached",
+	IPSET_ERR_BUSY:                 "set is in use",
+	IPSET_ERR_EXIST_SETNAME2:       "set with the new name already exists",
+	IPSET_ERR_TYPE_MISMATCH:        "sets have different types",
+	IPSET_ERR_EXIST:                "element or set already exists, or element is missing",
+	IPSET_ERR_INVALID_CIDR:         "invalid CIDR",
+	IPSET_ERR_INVALID_NETMASK:      "invalid netmask",
+	IPSET_ERR_INVALID_FAMILY:       "invalid family",
+	IPSET_ERR_TIMEOUT:              "set created without timeout support",
+	IPSET_ERR_REFERENCED:           "set is referenced",
+	IPSET_ERR_IPADDR_IPV4:          "invalid IPv4 address",
+	IPSET_ERR_IPADDR_IPV6:          "invalid IPv6 address",
+	IPSET_ERR_COUNTER:              "set created without counter support",
+	IPSET_ERR_COMMENT:              "set created without comment support",
+	IPSET_ERR_INVALID_MARKMASK:     "invalid markmask",
+	IPSET_ERR_SKBINFO:              "set created without skbinfo support",
+	IPSET_ERR_BITMASK_NETMASK_EXCL: "bitmask and netmask are mutually exclusive",
+}
+
+func (e IpsetError) Error() string {
+	if msg, ok := ipsetErrors[e]; ok {
+		return "ipset: " + msg
+	}
+	if e >= IPSET_ERR_TYPE_SPECIFIC {
+		return fmt.Sprintf("ipset: set type specific error %d", int(e))
+	}
+	return fmt.Sprintf("ipset: error %d", int(e))
+}
+
+func ipsetError(err error) error {
+	if errno, ok := err.(syscall.Errno); ok && errno >= IPSET_ERR_PRIVATE {
+		return IpsetError(errno)
+	}
+	return err
+}
+
+func ipsetMsgType(cmd uint8) uint16 {
+	return NfMsgType(NFNL_SUBSYS_IPSET, cmd)
+}
+
+// Numeric attributes of ipset must be flagged as being in network byte
+// order.
+func ipsetNetUint16(attrtype uint16, v uint16) netlink.NetlinkAttr {
+	return netlink.NewAttrNetUint16(attrtype|netlink.NLA_F_NET_BYTEORDER, v)
+}
+
+func ipsetNetUint32(attrtype uint16, v uint32) netlink.NetlinkAttr {
+	return netlink.NewAttrNetUint32(attrtype|netlink.NLA_F_NET_BYTEORDER, v)
+}
+
+func ipsetNetUint64(attrtype uint16, v uint64) netlink.NetlinkAttr {
+	return netlink.NewAttrNetUint64(attrtype|netlink.NLA_F_NET_BYTEORDER, v)
+}
+
+func ipsetIPAttr(attrtype uint16, ip net.IP) netlink.NetlinkAttr {
+	if ip4 := ip.To4(); ip4 != nil {
+		return netlink.NewAttrNested(attrtype, []netlink.NetlinkAttr{
+			netlink.NewAttr(IPSET_ATTR_IPADDR_IPV4|netlink.NLA_F_NET_BYTEORDER, ip4),
+		})
+	}
+	return netlink.NewAttrNested(attrtype, []netlink.NetlinkAttr{
+		netlink.NewAttr(IPSET_ATTR_IPADDR_IPV6|netlink.NLA_F_NET_BYTEORDER, ip.To16()),
+	})
+}
+
+func ipsetIPfromAttr(attr *netlink.NetlinkAttr) (net.IP, error) {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attrs {
+		switch a.AttrType() {
+		case IPSET_ATTR_IPADDR_IPV4, IPSET_ATTR_IPADDR_IPV6:
+			return net.IP(a.Data), nil
+		}
+	}
+	return nil, nil
+}
+
+// ipsetExecute sends an ipset command. Every command starts with the
+// protocol version, the oldest one still supported being enough for the
+// commands used here.
+func (nfl *NetfilterNLSocket) ipsetExecute(cmd uint8, flags uint16, family uint8, attrs []netlink.NetlinkAttr) ([]*NfMessage, error) {
+	attrs = append([]netlink.NetlinkAttr{netlink.NewAttrUint8(IPSET_ATTR_PROTOCOL, IPSET_PROTOCOL_MIN)}, attrs...)
+	msgList, err := nfl.Execute(ipsetMsgType(cmd), flags, family, attrs)
+	if err != nil {
+		return nil, ipsetError(err)
+	}
+	return msgList, nil
+}
+
+// ipsetRevision returns the latest revision of a set type the kernel
+// supports.
+func (nfl *NetfilterNLSocket) ipsetRevision(typ string, family uint8) (uint8, error) {
+	msgList, err := nfl.ipsetExecute(IPSET_CMD_TYPE, 0, family, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_TYPENAME, typ),
+		netlink.NewAttrUint8(IPSET_ATTR_FAMILY, family),
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range msgList {
+		for _, attr := range m.Attrs {
+			if attr.AttrType() == IPSET_ATTR_REVISION {
+				return attr.Uint8(), nil
+			}
+		}
+	}
+	return 0, IpsetError(IPSET_ERR_FIND_TYPE)
+}
+
+func (s *Ipset) toAttrs() []netlink.NetlinkAttr {
+	data := []netlink.NetlinkAttr{}
+	if s.HasTimeout {
+		data = append(data, ipsetNetUint32(IPSET_ATTR_TIMEOUT, uint32(s.Timeout/time.Second)))
+	}
+	if s.HashSize != 0 {
+		data = append(data, ipsetNetUint32(IPSET_ATTR_HASHSIZE, s.HashSize))
+	}
+	if s.MaxElem != 0 {
+		data = append(data, ipsetNetUint32(IPSET_ATTR_MAXELEM, s.MaxElem))
+	}
+	if s.NetMask != 0 {
+		data = append(data, netlink.NewAttrUint8(IPSET_ATTR_NETMASK, s.NetMask))
+	}
+	if s.PortFrom != 0 || s.PortTo != 0 {
+		data = append(data,
+			ipsetNetUint16(IPSET_ATTR_PORT_FROM, s.PortFrom),
+			ipsetNetUint16(IPSET_ATTR_PORT_TO, s.PortTo))
+	}
+	cadtFlags := uint32(0)
+	if s.Counters {
+		cadtFlags |= IPSET_FLAG_WITH_COUNTERS
+	}
+	if s.Comment {
+		cadtFlags |= IPSET_FLAG_WITH_COMMENT
+	}
+	if cadtFlags != 0 {
+		data = append(data, ipsetNetUint32(IPSET_ATTR_CADT_FLAGS, cadtFlags))
+	}
+
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, s.Name),
+		netlink.NewAttrString(IPSET_ATTR_TYPENAME, s.Type),
+		netlink.NewAttrUint8(IPSET_ATTR_REVISION, s.Revision),
+		netlink.NewAttrUint8(IPSET_ATTR_FAMILY, s.Family),
+		netlink.NewAttrNested(IPSET_ATTR_DATA, data),
+	}
+}
+
+func (e *IpsetEntry) toAttr() netlink.NetlinkAttr {
+	data := []netlink.NetlinkAttr{}
+	if e.IP != nil {
+		data = append(data, ipsetIPAttr(IPSET_ATTR_IP, e.IP))
+	}
+	if e.CIDR != 0 {
+		data = append(data, netlink.NewAttrUint8(IPSET_ATTR_CIDR, e.CIDR))
+	}
+	if e.Port != 0 || e.Proto != 0 {
+		data = append(data, ipsetNetUint16(IPSET_ATTR_PORT, e.Port))
+	}
+	if e.Proto != 0 {
+		data = append(data, netlink.NewAttrUint8(IPSET_ATTR_PROTO, e.Proto))
+	}
+	if e.Timeout != 0 {
+		data = append(data, ipsetNetUint32(IPSET_ATTR_TIMEOUT, uint32(e.Timeout/time.Second)))
+	}
+	if e.Comment != "" {
+		data = append(data, netlink.NewAttrString(IPSET_ATTR_COMMENT, e.Comment))
+	}
+	if e.Packets != 0 || e.Bytes != 0 {
+		data = append(data,
+			ipsetNetUint64(IPSET_ATTR_PACKETS, e.Packets),
+			ipsetNetUint64(IPSET_ATTR_BYTES, e.Bytes))
+	}
+	if e.NoMatch {
+		data = append(data, ipsetNetUint32(IPSET_ATTR_CADT_FLAGS, IPSET_FLAG_NOMATCH))
+	}
+	return netlink.NewAttrNested(IPSET_ATTR_DATA, data)
+}
+
+func IpsetEntryfromAttr(attr *netlink.NetlinkAttr) (*IpsetEntry, error) {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &IpsetEntry{}
+
+	for _, a := range attrs {
+		switch a.AttrType() {
+		case IPSET_ATTR_IP:
+			e.IP, err = ipsetIPfromAttr(&a)
+			if err != nil {
+				return nil, err
+			}
+		case IPSET_ATTR_CIDR:
+			e.CIDR = a.Uint8()
+		case IPSET_ATTR_PORT:
+			e.Port = a.NetUint16()
+		case IPSET_ATTR_PROTO:
+			e.Proto = a.Uint8()
+		case IPSET_ATTR_TIMEOUT:
+			e.Timeout = time.Duration(a.NetUint32()) * time.Second
+		case IPSET_ATTR_COMMENT:
+			e.Comment = a.String()
+		case IPSET_ATTR_PACKETS:
+			e.Packets = a.NetUint64()
+		case IPSET_ATTR_BYTES:
+			e.Bytes = a.NetUint64()
+		case IPSET_ATTR_CADT_FLAGS:
+			e.NoMatch = a.NetUint32()&IPSET_FLAG_NOMATCH != 0
+		}
+	}
+
+	return e, nil
+}
+
+// IpsetfromMessage decodes a message of a set listing. The header of the set
+// and its entries can come in separate messages, see ListIpsets.
+func IpsetfromMessage(m *NfMessage) (*Ipset, error) {
+	s := &Ipset{Attrs: m.Attrs}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case IPSET_ATTR_SETNAME:
+			s.Name = attr.String()
+		case IPSET_ATTR_TYPENAME:
+			s.Type = attr.String()
+		case IPSET_ATTR_REVISION:
+			s.Revision = attr.Uint8()
+		case IPSET_ATTR_FAMILY:
+			s.Family = attr.Uint8()
+		case IPSET_ATTR_DATA:
+			err := s.parseData(&attr)
+			if err != nil {
+				return nil, err
+			}
+		case IPSET_ATTR_ADT:
+			attrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			for _, a := range attrs {
+				e, err := IpsetEntryfromAttr(&a)
+				if err != nil {
+					return nil, err
+				}
+				s.Entries = append(s.Entries, e)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Ipset) parseData(attr *netlink.NetlinkAttr) error {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return err
+	}
+
+	for _, a := range attrs {
+		switch a.AttrType() {
+		case IPSET_ATTR_TIMEOUT:
+			s.Timeout = time.Duration(a.NetUint32()) * time.Second
+			s.HasTimeout = true
+		case IPSET_ATTR_HASHSIZE:
+			s.HashSize = a.NetUint32()
+		case IPSET_ATTR_MAXELEM:
+			s.MaxElem = a.NetUint32()
+		case IPSET_ATTR_NETMASK:
+			s.NetMask = a.Uint8()
+		case IPSET_ATTR_PORT_FROM:
+			s.PortFrom = a.NetUint16()
+		case IPSET_ATTR_PORT_TO:
+			s.PortTo = a.NetUint16()
+		case IPSET_ATTR_CADT_FLAGS:
+			flags := a.NetUint32()
+			s.Counters = flags&IPSET_FLAG_WITH_COUNTERS != 0
+			s.Comment = flags&IPSET_FLAG_WITH_COMMENT != 0
+		case IPSET_ATTR_SIZE:
+			s.Size = a.NetUint32()
+		case IPSET_ATTR_REFERENCES:
+			s.References = a.NetUint32()
+		case IPSET_ATTR_ELEMENTS:
+			s.Elements = a.NetUint32()
+		case IPSET_ATTR_MEMSIZE:
+			s.MemSize = a.NetUint32()
+		}
+	}
+
+	return nil
+}
+
+// CreateIpset creates a set. With exist set, creating a set that already
+// exists with the same type and options is not an error.
+func (nfl *NetfilterNLSocket) CreateIpset(s *Ipset, exist bool) error {
+	if s.Revision == 0 {
+		rev, err := nfl.ipsetRevision(s.Type, s.Family)
+		if err != nil {
+			return err
+		}
+		s.Revision = rev
+	}
+
+	_, err := nfl.ipsetExecute(IPSET_CMD_CREATE, ipsetFlags(exist), NFPROTO_IPV4, s.toAttrs())
+	return err
+}
+
+// DestroyIpset destroys a set that is not referenced by any rule.
+func (nfl *NetfilterNLSocket) DestroyIpset(name string) error {
+	_, err := nfl.ipsetExecute(IPSET_CMD_DESTROY, 0, NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, name),
+	})
+	return err
+}
+
+// FlushIpset removes every entry of a set.
+func (nfl *NetfilterNLSocket) FlushIpset(name string) error {
+	_, err := nfl.ipsetExecute(IPSET_CMD_FLUSH, 0, NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, name),
+	})
+	return err
+}
+
+func (nfl *NetfilterNLSocket) RenameIpset(name, newName string) error {
+	_, err := nfl.ipsetExecute(IPSET_CMD_RENAME, 0, NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, name),
+		netlink.NewAttrString(IPSET_ATTR_SETNAME2, newName),
+	})
+	return err
+}
+
+// SwapIpset exchanges the names, and so the contents seen by rules, of two
+// sets of compatible types.
+func (nfl *NetfilterNLSocket) SwapIpset(name, name2 string) error {
+	_, err := nfl.ipsetExecute(IPSET_CMD_SWAP, 0, NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, name),
+		netlink.NewAttrString(IPSET_ATTR_SETNAME2, name2),
+	})
+	return err
+}
+
+// ListIpsets returns every set with its entries. The kernel splits large sets
+// in several messages, which are merged here.
+func (nfl *NetfilterNLSocket) ListIpsets() ([]*Ipset, error) {
+	return nfl.listIpsets(nil)
+}
+
+// GetIpset returns a set with its entries.
+func (nfl *NetfilterNLSocket) GetIpset(name string) (*Ipset, error) {
+	sets, err := nfl.listIpsets([]netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return nil, syscall.ENOENT
+	}
+	return sets[0], nil
+}
+
+func (nfl *NetfilterNLSocket) listIpsets(attrs []netlink.NetlinkAttr) ([]*Ipset, error) {
+	msgList, err := nfl.ipsetExecute(IPSET_CMD_LIST, syscall.NLM_F_DUMP, NFPROTO_IPV4, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Ipset{}
+	byName := map[string]*Ipset{}
+
+	for _, m := range msgList {
+		s, err := IpsetfromMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		if prev, ok := byName[s.Name]; ok {
+			prev.Entries = append(prev.Entries, s.Entries...)
+			continue
+		}
+		byName[s.Name] = s
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// ipsetFlags returns the message flags of a command: the kernel ignores
+// existing sets and entries, or missing ones on deletion, unless NLM_F_EXCL
+// is set.
+func ipsetFlags(exist bool) uint16 {
+	if exist {
+		return 0
+	}
+	return syscall.NLM_F_EXCL
+}
+
+func (nfl *NetfilterNLSocket) ipsetEntry(cmd uint8, name string, e *IpsetEntry, flags uint16) error {
+	_, err := nfl.ipsetExecute(cmd, flags, NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, name),
+		e.toAttr(),
+	})
+	return err
+}
+
+// AddIpsetEntry adds an entry to a set. With exist set, adding an entry that
+// is already in the set is not an error and updates its timeout, comment and
+// counters.
+func (nfl *NetfilterNLSocket) AddIpsetEntry(name string, e *IpsetEntry, exist bool) error {
+	return nfl.ipsetEntry(IPSET_CMD_ADD, name, e, ipsetFlags(exist))
+}
+
+// DelIpsetEntry deletes an entry from a set. With exist set, deleting an
+// entry that is not in the set is not an error.
+func (nfl *NetfilterNLSocket) DelIpsetEntry(name string, e *IpsetEntry, exist bool) error {
+	return nfl.ipsetEntry(IPSET_CMD_DEL, name, e, ipsetFlags(exist))
+}
+
+// TestIpsetEntry tells whether an entry is in a set. For sets of networks an
+// address is matched against the networks it belongs to.
+func (nfl *NetfilterNLSocket) TestIpsetEntry(name string, e *IpsetEntry) (bool, error) {
+	err := nfl.ipsetEntry(IPSET_CMD_TEST, name, e, 0)
+	if err == IpsetError(IPSET_ERR_EXIST) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// SaveIpset returns a set with its entries, which RestoreIpset takes back.
+func (nfl *NetfilterNLSocket) SaveIpset(name string) (*Ipset, error) {
+	return nfl.GetIpset(name)
+}
+
+// RestoreIpset makes the contents of the set s.Name that of s, creating the
+// set if it does not exist. An existing set is replaced atomically: a new set
+// is filled and swapped with it, so rules never see it partially restored.
+// The replacing set is created with the options of s, which take the place
+// of those of the existing set; s must have a type compatible with it.
+func (nfl *NetfilterNLSocket) RestoreIpset(s *Ipset) error {
+	_, err := nfl.GetIpset(s.Name)
+	if err != nil && err != syscall.ENOENT && err != IpsetError(IPSET_ERR_EXIST) {
+		return err
+	}
+	if err != nil {
+		return nfl.fillIpset(s.Name, s)
+	}
+
+	tmp, err := nfl.createTmpIpset(s)
+	if err != nil {
+		return err
+	}
+
+	err = nfl.AddIpsetEntries(tmp, s.Entries)
+	if err == nil {
+		err = nfl.SwapIpset(tmp, s.Name)
+	}
+	if err != nil {
+		nfl.DestroyIpset(tmp)
+		return err
+	}
+
+	return nfl.DestroyIpset(tmp)
+}
+
+// createTmpIpset creates an empty set with the options of s under a name
+// derived from s.Name, skipping the names of sets that already exist.
+func (nfl *NetfilterNLSocket) createTmpIpset(s *Ipset) (string, error) {
+	created := *s
+	for i := 0; ; i++ {
+		suffix := "-tmp"
+		if i > 0 {
+			suffix = fmt.Sprintf("-tmp%d", i)
+		}
+		created.Name = s.Name
+		if len(created.Name) > IPSET_MAXNAMELEN-1-len(suffix) {
+			created.Name = created.Name[:IPSET_MAXNAMELEN-1-len(suffix)]
+		}
+		created.Name += suffix
+
+		err := nfl.CreateIpset(&created, false)
+		if err != syscall.EEXIST || i == 9 {
+			return created.Name, err
+		}
+	}
+}
+
+func (nfl *NetfilterNLSocket) fillIpset(name string, s *Ipset) error {
+	created := *s
+	created.Name = name
+	err := nfl.CreateIpset(&created, false)
+	if err != nil {
+		return err
+	}
+	return nfl.AddIpsetEntries(name, s.Entries)
+}
+
+// AddIpsetEntries adds entries to a set, many of them per message, ignoring
+// those already in it. The entries before a failing one stay added. The
+// kernel requires a line number with lists of entries, from which failing
+// entries would be counted.
+func (nfl *NetfilterNLSocket) AddIpsetEntries(name string, entries []*IpsetEntry) error {
+	list := []netlink.NetlinkAttr{}
+	size := 0
+
+	for i, e := range entries {
+		attr := e.toAttr()
+		list = append(list, attr)
+		size += nlaAlignOf(len(attr.Data)) + syscall.NLA_HDRLEN
+
+		if size >= setElemsChunk || i == len(entries)-1 {
+			_, err := nfl.ipsetExecute(IPSET_CMD_ADD, ipsetFlags(true), NFPROTO_IPV4, []netlink.NetlinkAttr{
+				netlink.NewAttrString(IPSET_ATTR_SETNAME, name),
+				netlink.NewAttrNested(IPSET_ATTR_ADT, list),
+				netlink.NewAttrUint32(IPSET_ATTR_LINENO, 0),
+			})
+			if err != nil {
+				return err
+			}
+			list = []netlink.NetlinkAttr{}
+			size = 0
+		}
+	}
+
+	return nil
+}
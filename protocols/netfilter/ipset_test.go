@@ -0,0 +1,373 @@
+package netfilter
+
+import (
+	"fmt"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestIpsetError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{syscall.ENOENT, syscall.ENOENT},
+		{syscall.Errno(IPSET_ERR_EXIST), IpsetError(IPSET_ERR_EXIST)},
+		{nil, nil},
+	}
+	for _, test := range tests {
+		if got := ipsetError(test.err); got != test.want {
+			t.Errorf("ipsetError(%v): got %#v, want %#v", test.err, got, test.want)
+		}
+	}
+
+	if got := IpsetError(IPSET_ERR_BUSY).Error(); got != "ipset: set is in use" {
+		t.Errorf("got %q", got)
+	}
+	if got := IpsetError(IPSET_ERR_TYPE_SPECIFIC + 1).Error(); got != fmt.Sprintf("ipset: set type specific error %d", IPSET_ERR_TYPE_SPECIFIC+1) {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestIpsetWireFormat(t *testing.T) {
+	s := &Ipset{
+		Name:       "allowed",
+		Type:       "hash:ip,port",
+		Revision:   5,
+		Family:     NFPROTO_IPV6,
+		HashSize:   1024,
+		MaxElem:    65536,
+		Timeout:    time.Minute,
+		HasTimeout: true,
+		Counters:   true,
+		Comment:    true,
+	}
+
+	/* numbers are flagged as being in network byte order */
+	data, _ := s.toAttrs()[4].Nested()
+	for _, attr := range data {
+		if len(attr.Data) >= 2 && attr.Type&netlink.NLA_F_NET_BYTEORDER == 0 {
+			t.Errorf("attribute %d not flagged", attr.AttrType())
+		}
+	}
+
+	got, err := IpsetfromMessage(testMessage(t, ipsetMsgType(IPSET_CMD_LIST), NFPROTO_IPV4, s.toAttrs()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Attrs = nil
+	if !reflect.DeepEqual(got, s) {
+		t.Errorf("got %+v, want %+v", got, s)
+	}
+
+	bitmap := &Ipset{Name: "ports", Type: "bitmap:port", PortFrom: 1000, PortTo: 2000}
+	got, _ = IpsetfromMessage(testMessage(t, ipsetMsgType(IPSET_CMD_LIST), NFPROTO_IPV4, bitmap.toAttrs()))
+	if got.PortFrom != 1000 || got.PortTo != 2000 || got.HasTimeout || got.Counters {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestIpsetEntryWireFormat(t *testing.T) {
+	entries := []*IpsetEntry{
+		{IP: net.ParseIP("192.0.2.1").To4(), Port: 80, Proto: syscall.IPPROTO_TCP, Timeout: time.Second, Comment: "web",
+			Packets: 1, Bytes: 60},
+		{IP: net.ParseIP("2001:db8::"), CIDR: 32, NoMatch: true},
+		/* bitmap:port entries have a port only */
+		{Port: 1024},
+	}
+
+	for _, e := range entries {
+		attr := e.toAttr()
+		got, err := IpsetEntryfromAttr(&attr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, e) {
+			t.Errorf("got %+v, want %+v", got, e)
+		}
+	}
+
+	/* a set listing carries the entries in IPSET_ATTR_ADT */
+	list := []netlink.NetlinkAttr{}
+	for _, e := range entries {
+		list = append(list, e.toAttr())
+	}
+	s, err := IpsetfromMessage(testMessage(t, ipsetMsgType(IPSET_CMD_LIST), NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IPSET_ATTR_SETNAME, "s"),
+		netlink.NewAttrNested(IPSET_ATTR_ADT, list),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name != "s" || len(s.Entries) != 3 || s.Entries[2].Port != 1024 {
+		t.Errorf("got %+v", s)
+	}
+
+	if ipsetFlags(true) != 0 || ipsetFlags(false) != syscall.NLM_F_EXCL {
+		t.Error("flags")
+	}
+}
+
+// skipIpset skips the test when the kernel lacks ipset or the set type.
+func skipIpset(t *testing.T, err error) {
+	t.Helper()
+	skipUnsupported(t, err)
+	if err == IpsetError(IPSET_ERR_FIND_TYPE) {
+		t.Skipf("set type unavailable: %v", err)
+	}
+}
+
+func TestIpsets(t *testing.T) {
+	nfl := testNetns(t)
+
+	s := &Ipset{Name: "hosts", Type: "hash:ip", Family: NFPROTO_IPV4, Timeout: time.Hour, HasTimeout: true,
+		Counters: true, Comment: true}
+	err := nfl.CreateIpset(s, false)
+	skipIpset(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Revision == 0 {
+		t.Error("revision not set")
+	}
+
+	err = nfl.CreateIpset(s, false)
+	if err != syscall.EEXIST {
+		t.Errorf("second create: %v", err)
+	}
+	err = nfl.CreateIpset(s, true)
+	if err != nil {
+		t.Errorf("second create with exist: %v", err)
+	}
+
+	host := &IpsetEntry{IP: net.ParseIP("192.0.2.1"), Timeout: time.Minute, Comment: "one"}
+	err = nfl.AddIpsetEntry("hosts", host, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = nfl.AddIpsetEntry("hosts", host, false)
+	if err != IpsetError(IPSET_ERR_EXIST) {
+		t.Errorf("second add: %v", err)
+	}
+	err = nfl.AddIpsetEntry("hosts", &IpsetEntry{IP: net.ParseIP("192.0.2.2")}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := nfl.GetIpset("hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != "hash:ip" || got.Family != NFPROTO_IPV4 || got.Timeout != time.Hour || !got.Counters ||
+		!got.Comment || got.Elements != 2 || len(got.Entries) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	for _, e := range got.Entries {
+		/* entries without a timeout of their own take that of the set */
+		if e.IP.Equal(host.IP) && (e.Comment != "one" || e.Timeout > time.Minute) {
+			t.Errorf("entry %+v", e)
+		}
+		if !e.IP.Equal(host.IP) && (e.Timeout <= time.Minute || e.Timeout > time.Hour) {
+			t.Errorf("entry %+v", e)
+		}
+	}
+
+	ok, err := nfl.TestIpsetEntry("hosts", &IpsetEntry{IP: net.ParseIP("192.0.2.2")})
+	if err != nil || !ok {
+		t.Errorf("test: %v, %v", ok, err)
+	}
+	err = nfl.DelIpsetEntry("hosts", &IpsetEntry{IP: net.ParseIP("192.0.2.2")}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err = nfl.TestIpsetEntry("hosts", &IpsetEntry{IP: net.ParseIP("192.0.2.2")})
+	if err != nil || ok {
+		t.Errorf("test after delete: %v, %v", ok, err)
+	}
+	err = nfl.DelIpsetEntry("hosts", &IpsetEntry{IP: net.ParseIP("192.0.2.2")}, false)
+	if err == nil {
+		t.Error("deleted a missing entry")
+	}
+	err = nfl.DelIpsetEntry("hosts", &IpsetEntry{IP: net.ParseIP("192.0.2.2")}, true)
+	if err != nil {
+		t.Errorf("delete with exist: %v", err)
+	}
+
+	err = nfl.FlushIpset("hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = nfl.GetIpset("hosts")
+	if got == nil || len(got.Entries) != 0 {
+		t.Errorf("flushed %+v", got)
+	}
+
+	err = nfl.RenameIpset("hosts", "renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = nfl.GetIpset("hosts")
+	if err == nil {
+		t.Error("renamed set found by its old name")
+	}
+	err = nfl.DestroyIpset("renamed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, err := nfl.ListIpsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 0 {
+		t.Errorf("sets left %+v", sets)
+	}
+}
+
+func TestIpsetTypes(t *testing.T) {
+	nfl := testNetns(t)
+
+	tests := []struct {
+		set   *Ipset
+		entry *IpsetEntry
+		match *IpsetEntry
+		miss  *IpsetEntry
+	}{
+		{&Ipset{Name: "nets", Type: "hash:net", Family: NFPROTO_IPV6},
+			&IpsetEntry{IP: net.ParseIP("2001:db8::"), CIDR: 32},
+			&IpsetEntry{IP: net.ParseIP("2001:db8::1")},
+			&IpsetEntry{IP: net.ParseIP("2001:db9::1")}},
+		{&Ipset{Name: "services", Type: "hash:ip,port", Family: NFPROTO_IPV4},
+			&IpsetEntry{IP: net.ParseIP("192.0.2.1").To4(), Port: 53, Proto: syscall.IPPROTO_UDP},
+			&IpsetEntry{IP: net.ParseIP("192.0.2.1"), Port: 53, Proto: syscall.IPPROTO_UDP},
+			&IpsetEntry{IP: net.ParseIP("192.0.2.1"), Port: 53, Proto: syscall.IPPROTO_TCP}},
+		{&Ipset{Name: "ports", Type: "bitmap:port", PortFrom: 1000, PortTo: 2000},
+			&IpsetEntry{Port: 1024},
+			&IpsetEntry{Port: 1024},
+			&IpsetEntry{Port: 1025}},
+	}
+
+	for _, test := range tests {
+		err := nfl.CreateIpset(test.set, false)
+		skipIpset(t, err)
+		if err != nil {
+			t.Fatalf("%s: %v", test.set.Type, err)
+		}
+		err = nfl.AddIpsetEntry(test.set.Name, test.entry, false)
+		if err != nil {
+			t.Fatalf("%s: %v", test.set.Type, err)
+		}
+		ok, err := nfl.TestIpsetEntry(test.set.Name, test.match)
+		if err != nil || !ok {
+			t.Errorf("%s: %+v: %v, %v", test.set.Type, test.match, ok, err)
+		}
+		ok, err = nfl.TestIpsetEntry(test.set.Name, test.miss)
+		if err != nil || ok {
+			t.Errorf("%s: %+v: %v, %v", test.set.Type, test.miss, ok, err)
+		}
+
+		got, err := nfl.GetIpset(test.set.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.Entries) != 1 || !reflect.DeepEqual(got.Entries[0], test.entry) {
+			t.Errorf("%s: got %+v", test.set.Type, got.Entries[0])
+		}
+	}
+
+	/* networks marked nomatch are excluded from larger ones */
+	err := nfl.AddIpsetEntry("nets", &IpsetEntry{IP: net.ParseIP("2001:db8:1::"), CIDR: 48, NoMatch: true}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, _ := nfl.TestIpsetEntry("nets", &IpsetEntry{IP: net.ParseIP("2001:db8:1::1")})
+	if ok {
+		t.Error("nomatch network matched")
+	}
+
+	sets, err := nfl.ListIpsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != len(tests) {
+		t.Errorf("got %d sets", len(sets))
+	}
+}
+
+func TestRestoreIpset(t *testing.T) {
+	nfl := testNetns(t)
+
+	s := &Ipset{Name: "hosts", Type: "hash:ip", Family: NFPROTO_IPV4}
+	for i := 0; i < 3000; i++ {
+		s.Entries = append(s.Entries, &IpsetEntry{IP: net.IPv4(10, 0, byte(i>>8), byte(i))})
+	}
+
+	/* a missing set is created */
+	err := nfl.RestoreIpset(s)
+	skipIpset(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := nfl.SaveIpset("hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Entries) != 3000 {
+		t.Errorf("got %d entries", len(got.Entries))
+	}
+
+	/* an existing one is replaced, without its temporary set left, and
+	   leaving alone a set with the name of the temporary one */
+	other := &Ipset{Name: "hosts-tmp", Type: "hash:ip", Family: NFPROTO_IPV4,
+		Entries: []*IpsetEntry{{IP: net.ParseIP("192.0.2.1").To4()}}}
+	err = nfl.RestoreIpset(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got.Entries = got.Entries[:1]
+	err = nfl.RestoreIpset(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, err := nfl.ListIpsets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 2 {
+		t.Fatalf("got %+v", sets)
+	}
+	for _, set := range sets {
+		switch set.Name {
+		case "hosts":
+			if len(set.Entries) != 1 || !set.Entries[0].IP.Equal(got.Entries[0].IP) {
+				t.Errorf("got %+v", set)
+			}
+		case "hosts-tmp":
+			if len(set.Entries) != 1 || !set.Entries[0].IP.Equal(other.Entries[0].IP) {
+				t.Errorf("got %+v", set)
+			}
+		default:
+			t.Errorf("got %+v", set)
+		}
+	}
+
+	/* a failed restore leaves both sets alone */
+	bad := &Ipset{Name: "hosts", Type: "hash:ip", Family: NFPROTO_IPV4,
+		Entries: []*IpsetEntry{{IP: net.ParseIP("2001:db8::1")}}}
+	if err := nfl.RestoreIpset(bad); err == nil {
+		t.Error("restored an ipv6 entry into an ipv4 set")
+	}
+	sets, _ = nfl.ListIpsets()
+	if len(sets) != 2 {
+		t.Errorf("got %+v", sets)
+	}
+
+	err = nfl.SwapIpset("hosts", "missing")
+	if err == nil {
+		t.Error("swapped with a missing set")
+	}
+}
@@ -0,0 +1,276 @@
+package netfilter
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/apuigsech/netlink"
+)
+
+type NetfilterNLSocket netlink.NetlinkSocket
+
+// NfGenMsg is the header of every nfnetlink message. ResId is the
+// subsystem for batch messages and is kept in host byte order here.
+type NfGenMsg struct {
+	Family  uint8
+	Version uint8
+	ResId   uint16
+}
+
+// NfMessage is a decoded nfnetlink message. Type carries both the
+// subsystem and the message, see NfSubsysId and NfMsgId.
+type NfMessage struct {
+	Type   uint16
+	Flags  uint16
+	Header NfGenMsg
+	Attrs  []netlink.NetlinkAttr
+}
+
+// BatchError reports the message of a batch the kernel rejected. The whole
+// batch is aborted when any of its messages fails.
+type BatchError struct {
+	Index int
+	Type  uint16
+	Err   error
+}
+
+// Batch is a list of messages for one subsystem that the kernel applies as
+// a single transaction.
+type Batch struct {
+	Subsys uint16
+	msgs   []*netlink.NetlinkMessage
+	setId  uint32
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("netfilter: batch message %d (type %#x): %v", e.Index, e.Type, e.Err)
+}
+
+// NfMsgType returns the netlink message type of a subsystem message.
+func NfMsgType(subsys uint16, msg uint8) uint16 {
+	return subsys<<8 | uint16(msg)
+}
+
+func NfSubsysId(msgtype uint16) uint16 {
+	return msgtype >> 8
+}
+
+func NfMsgId(msgtype uint16) uint8 {
+	return uint8(msgtype)
+}
+
+func NfGenMsgfromWireFormat(data []byte) *NfGenMsg {
+	return &NfGenMsg{
+		Family:  data[0],
+		Version: data[1],
+		ResId:   binary.BigEndian.Uint16(data[2:4]),
+	}
+}
+
+func (hdr *NfGenMsg) toWireFormat() []byte {
+	b := make([]byte, SizeofNfGenMsg)
+	b[0] = hdr.Family
+	b[1] = hdr.Version
+	binary.BigEndian.PutUint16(b[2:4], hdr.ResId)
+	return b
+}
+
+func ParseNfMessage(msg *netlink.NetlinkMessage) (*NfMessage, error) {
+	if len(msg.Data) < SizeofNfGenMsg {
+		return nil, errors.New("short nfnetlink message")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(msg.Data[SizeofNfGenMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &NfMessage{
+		Type:   msg.Header.Type,
+		Flags:  msg.Header.Flags,
+		Header: *NfGenMsgfromWireFormat(msg.Data),
+		Attrs:  attrs,
+	}, nil
+}
+
+func newNfMessage(msgtype, flags uint16, family uint8, resid uint16, attrs []netlink.NetlinkAttr) *netlink.NetlinkMessage {
+	hdr := &NfGenMsg{
+		Family:  family,
+		Version: NFNETLINK_V0,
+		ResId:   resid,
+	}
+
+	return &netlink.NetlinkMessage{
+		Header: syscall.NlMsghdr{
+			Type:  msgtype,
+			Flags: flags | syscall.NLM_F_REQUEST,
+		},
+		Data: append(hdr.toWireFormat(), netlink.AttrsToWireFormat(attrs)...),
+	}
+}
+
+func OpenLink(group, pid uint32) (*NetfilterNLSocket, error) {
+	nl, err := netlink.OpenLink(syscall.NETLINK_NETFILTER, group, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Errors for every message of a failed batch would otherwise echo it
+	// and overrun the receive buffer.
+	err = nl.SetCapAck(true)
+	if err != nil {
+		nl.CloseLink()
+		return nil, err
+	}
+
+	return (*NetfilterNLSocket)(nl), nil
+}
+
+func (nfl *NetfilterNLSocket) CloseLink() error {
+	nl := (*netlink.NetlinkSocket)(nfl)
+	return nl.CloseLink()
+}
+
+func (nfl *NetfilterNLSocket) AddMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(nfl)
+	return nl.AddMembership(group)
+}
+
+func (nfl *NetfilterNLSocket) DropMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(nfl)
+	return nl.DropMembership(group)
+}
+
+func (nfl *NetfilterNLSocket) RecvMessages(sz int, sockflags int) ([]*NfMessage, error) {
+	nl := (*netlink.NetlinkSocket)(nfl)
+	msgList, err := nl.RecvMessages(sz, sockflags)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*NfMessage{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type < syscall.NLMSG_MIN_TYPE {
+			continue
+		}
+		m, err := ParseNfMessage(&msg)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+
+	return ret, nil
+}
+
+func (nfl *NetfilterNLSocket) Request(msgtype, flags uint16, family uint8, attrs []netlink.NetlinkAttr, sockflags int, ack bool) error {
+	nl := (*netlink.NetlinkSocket)(nfl)
+	return nl.SendMessage(newNfMessage(msgtype, flags, family, 0, attrs), sockflags, ack)
+}
+
+// Execute sends a single nfnetlink request and returns the decoded replies.
+func (nfl *NetfilterNLSocket) Execute(msgtype, flags uint16, family uint8, attrs []netlink.NetlinkAttr) ([]*NfMessage, error) {
+	return nfl.execute(newNfMessage(msgtype, flags, family, 0, attrs))
+}
+
+func (nfl *NetfilterNLSocket) execute(msg *netlink.NetlinkMessage) ([]*NfMessage, error) {
+	nl := (*netlink.NetlinkSocket)(nfl)
+	msgList, err := nl.Execute(msg, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*NfMessage{}
+
+	for _, msg := range msgList {
+		m, err := ParseNfMessage(&msg)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, m)
+	}
+
+	return ret, nil
+}
+
+func NewBatch(subsys uint16) *Batch {
+	return &Batch{Subsys: subsys}
+}
+
+// Add appends a message to the batch. Every message is acknowledged, so
+// that a failure can be tied to the message causing it.
+func (b *Batch) Add(msgtype, flags uint16, family uint8, attrs []netlink.NetlinkAttr) {
+	b.msgs = append(b.msgs, newNfMessage(msgtype, flags|syscall.NLM_F_ACK, family, 0, attrs))
+}
+
+func (b *Batch) Len() int {
+	return len(b.msgs)
+}
+
+// ExecuteBatch sends the batch between NFNL_MSG_BATCH_BEGIN and
+// NFNL_MSG_BATCH_END and waits for every message to be acknowledged. A
+// *BatchError is returned for the first message the kernel rejected.
+func (nfl *NetfilterNLSocket) ExecuteBatch(b *Batch) error {
+	if len(b.msgs) == 0 {
+		return nil
+	}
+
+	nl := (*netlink.NetlinkSocket)(nfl)
+
+	msgs := []*netlink.NetlinkMessage{newNfMessage(NFNL_MSG_BATCH_BEGIN, 0, NFPROTO_UNSPEC, b.Subsys, nil)}
+	msgs = append(msgs, b.msgs...)
+	msgs = append(msgs, newNfMessage(NFNL_MSG_BATCH_END, 0, NFPROTO_UNSPEC, b.Subsys, nil))
+
+	err := nl.SendMessages(msgs, 0)
+	if err != nil {
+		return err
+	}
+
+	index := map[uint32]int{}
+	for i, msg := range b.msgs {
+		index[msg.Header.Seq] = i
+	}
+	begin := msgs[0].Header.Seq
+	end := msgs[len(msgs)-1].Header.Seq
+
+	var batchErr *BatchError
+	pending := len(b.msgs)
+
+	for pending > 0 {
+		msgList, err := nl.RecvMessages(netlink.RECV_BUFFER_SIZE, 0)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range msgList {
+			if m.Header.Type != syscall.NLMSG_ERROR {
+				continue
+			}
+			err := netlink.ParseErrorMessage(&m)
+			if m.Header.Seq == begin || m.Header.Seq == end {
+				if err != nil {
+					return err
+				}
+				continue
+			}
+			i, ok := index[m.Header.Seq]
+			if !ok {
+				continue
+			}
+			delete(index, m.Header.Seq)
+			pending--
+			if err != nil && batchErr == nil {
+				batchErr = &BatchError{Index: i, Type: b.msgs[i].Header.Type, Err: err}
+			}
+		}
+	}
+
+	if batchErr != nil {
+		return batchErr
+	}
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package netfilter
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestNfGenMsgWireFormat(t *testing.T) {
+	hdr := &NfGenMsg{Family: NFPROTO_IPV4, Version: NFNETLINK_V0, ResId: 0x0102}
+
+	b := hdr.toWireFormat()
+	if len(b) != SizeofNfGenMsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	/* res_id is in network byte order */
+	if b[2] != 0x01 || b[3] != 0x02 {
+		t.Errorf("res_id % x", b[2:4])
+	}
+	if got := NfGenMsgfromWireFormat(b); *got != *hdr {
+		t.Errorf("got %+v, want %+v", got, hdr)
+	}
+}
+
+func TestNfMsgType(t *testing.T) {
+	msgtype := NfMsgType(NFNL_SUBSYS_NFTABLES, NFT_MSG_NEWRULE)
+	if msgtype != 0x0a06 || NfSubsysId(msgtype) != NFNL_SUBSYS_NFTABLES || NfMsgId(msgtype) != NFT_MSG_NEWRULE {
+		t.Errorf("message type %#x", msgtype)
+	}
+}
+
+func TestParseNfMessage(t *testing.T) {
+	msg := newNfMessage(nftMsgType(NFT_MSG_NEWTABLE), syscall.NLM_F_CREATE, NFPROTO_INET, 0, []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_TABLE_NAME, "filter"),
+	})
+	if msg.Header.Flags != syscall.NLM_F_CREATE|syscall.NLM_F_REQUEST {
+		t.Errorf("flags %#x", msg.Header.Flags)
+	}
+
+	m, err := ParseNfMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Type != nftMsgType(NFT_MSG_NEWTABLE) || m.Header.Family != NFPROTO_INET || m.Header.Version != NFNETLINK_V0 ||
+		len(m.Attrs) != 1 || m.Attrs[0].String() != "filter" {
+		t.Errorf("got %+v", m)
+	}
+
+	if _, err := ParseNfMessage(&netlink.NetlinkMessage{Data: []byte{1, 0}}); err == nil {
+		t.Error("short message accepted")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_INET, Name: "filter"})
+	b.AddChain(&Chain{Family: NFPROTO_INET, Table: "filter", Name: "input"})
+
+	if b.Len() != 2 {
+		t.Fatalf("got %d messages", b.Len())
+	}
+	/* every message is acknowledged to tie errors to it */
+	for _, msg := range b.msgs {
+		if msg.Header.Flags&syscall.NLM_F_ACK == 0 {
+			t.Errorf("message %#x not acknowledged", msg.Header.Type)
+		}
+	}
+
+	err := &BatchError{Index: 1, Type: nftMsgType(NFT_MSG_NEWCHAIN), Err: syscall.ENOENT}
+	if err.Error() != "netfilter: batch message 1 (type 0xa03): no such file or directory" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestExecuteBatch(t *testing.T) {
+	nfl := testNetns(t)
+
+	err := nfl.ExecuteBatch(NewBatch(NFNL_SUBSYS_NFTABLES))
+	if err != nil {
+		t.Errorf("empty batch: %v", err)
+	}
+
+	/* the chain of a table that does not exist fails the whole batch */
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_INET, Name: "t1"})
+	b.AddChain(&Chain{Family: NFPROTO_INET, Table: "t2", Name: "c"})
+	err = nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	be, ok := err.(*BatchError)
+	if !ok || be.Index != 1 || be.Type != nftMsgType(NFT_MSG_NEWCHAIN) || be.Err != syscall.ENOENT {
+		t.Fatalf("got %v", err)
+	}
+
+	tables, err := nfl.ListTables(NFPROTO_UNSPEC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 0 {
+		t.Errorf("aborted batch left %+v", tables)
+	}
+}
@@ -0,0 +1,95 @@
+package netfilter
+
+import (
+	"net"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+	"github.com/apuigsech/netlink/protocols/route"
+)
+
+// testNetns moves the test to a network namespace of its own and returns a
+// socket in it. The namespace lives on the thread of the test, which is left
+// locked so that the runtime throws it away when the test ends. Tests are
+// skipped when namespaces can not be created, such as when unprivileged.
+func testNetns(t *testing.T) *NetfilterNLSocket {
+	t.Helper()
+	runtime.LockOSThread()
+
+	err := syscall.Unshare(syscall.CLONE_NEWNET)
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+
+	nfl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		nfl.CloseLink()
+	})
+
+	return nfl
+}
+
+// skipUnsupported skips the test when the kernel lacks the subsystem or
+// the feature err says it does, such as nftables built as a module that
+// is not available.
+func skipUnsupported(t *testing.T, err error) {
+	t.Helper()
+	if be, ok := err.(*BatchError); ok {
+		err = be.Err
+	}
+	if err == syscall.EOPNOTSUPP || err == syscall.EAFNOSUPPORT || err == syscall.EPROTONOSUPPORT {
+		t.Skipf("unsupported by the kernel: %v", err)
+	}
+}
+
+// testMessage encodes a request the way it is sent and decodes it the way
+// a reply is.
+func testMessage(t *testing.T, msgtype uint16, family uint8, attrs []netlink.NetlinkAttr) *NfMessage {
+	t.Helper()
+	m, err := ParseNfMessage(newNfMessage(msgtype, 0, family, 0, attrs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// testLoopback brings up the loopback link of the namespace of the test, for
+// tests sending packets through the hooks.
+func testLoopback(t *testing.T) {
+	t.Helper()
+	rl, err := route.OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.CloseLink()
+
+	lo, err := rl.GetLinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.SetLinkUp(lo.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sendUDP sends a datagram to port on the loopback address, which does not
+// need anything listening on it to go through the output hooks.
+func sendUDP(t *testing.T, port int, payload []byte) {
+	t.Helper()
+	conn, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.Write(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
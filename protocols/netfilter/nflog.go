@@ -0,0 +1,201 @@
+package netfilter
+
+import (
+	"encoding/binary"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+// A logged packet is delivered as a single message, which can be larger than
+// RECV_BUFFER_SIZE with the full packet copied.
+const nflogRecvBufferSize = 2 * netlink.RECV_BUFFER_SIZE
+
+// NflogPacket is a packet logged to a nflog group. Payload holds the network
+// header and what follows, up to the copy range of the group. Uid and Gid
+// are only reported for packets of local sockets, Seq and SeqGlobal when the
+// NFULNL_CFG_F_SEQ flags are set.
+type NflogPacket struct {
+	Group      uint16
+	Family     uint8
+	HwProtocol uint16
+	Hook       uint8
+	Prefix     string
+	Mark       uint32
+	Timestamp  time.Time
+	Indev      uint32
+	Outdev     uint32
+	PhysIndev  uint32
+	PhysOutdev uint32
+	HwAddr     net.HardwareAddr
+	HwType     uint16
+	HwHeader   []byte
+	Uid        uint32
+	HasUid     bool
+	Gid        uint32
+	HasGid     bool
+	Seq        uint32
+	SeqGlobal  uint32
+	Payload    []byte
+	Attrs      []netlink.NetlinkAttr
+}
+
+type NflogCallback func(*NflogPacket, chan error, ...interface{})
+
+func nflogMsgType(msg uint8) uint16 {
+	return NfMsgType(NFNL_SUBSYS_ULOG, msg)
+}
+
+func NflogPacketfromMessage(m *NfMessage) (*NflogPacket, error) {
+	p := &NflogPacket{
+		Group:  m.Header.ResId,
+		Family: m.Header.Family,
+		Attrs:  m.Attrs,
+	}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFULA_PACKET_HDR:
+			if len(attr.Data) < SizeofNfulnlMsgPacketHdr {
+				return nil, syscall.EINVAL
+			}
+			p.HwProtocol = binary.BigEndian.Uint16(attr.Data[0:2])
+			p.Hook = attr.Data[2]
+		case NFULA_MARK:
+			p.Mark = attr.NetUint32()
+		case NFULA_TIMESTAMP:
+			if len(attr.Data) < 16 {
+				return nil, syscall.EINVAL
+			}
+			sec := binary.BigEndian.Uint64(attr.Data[0:8])
+			usec := binary.BigEndian.Uint64(attr.Data[8:16])
+			p.Timestamp = time.Unix(int64(sec), int64(usec)*1000)
+		case NFULA_IFINDEX_INDEV:
+			p.Indev = attr.NetUint32()
+		case NFULA_IFINDEX_OUTDEV:
+			p.Outdev = attr.NetUint32()
+		case NFULA_IFINDEX_PHYSINDEV:
+			p.PhysIndev = attr.NetUint32()
+		case NFULA_IFINDEX_PHYSOUTDEV:
+			p.PhysOutdev = attr.NetUint32()
+		case NFULA_HWADDR:
+			if len(attr.Data) < SizeofNfulnlMsgPacketHw {
+				return nil, syscall.EINVAL
+			}
+			n := int(binary.BigEndian.Uint16(attr.Data[0:2]))
+			if n > 8 {
+				n = 8
+			}
+			p.HwAddr = net.HardwareAddr(attr.Data[4 : 4+n])
+		case NFULA_HWTYPE:
+			p.HwType = attr.NetUint16()
+		case NFULA_HWHEADER:
+			p.HwHeader = attr.Data
+		case NFULA_PREFIX:
+			p.Prefix = attr.String()
+		case NFULA_UID:
+			p.Uid = attr.NetUint32()
+			p.HasUid = true
+		case NFULA_GID:
+			p.Gid = attr.NetUint32()
+			p.HasGid = true
+		case NFULA_SEQ:
+			p.Seq = attr.NetUint32()
+		case NFULA_SEQ_GLOBAL:
+			p.SeqGlobal = attr.NetUint32()
+		case NFULA_PAYLOAD:
+			p.Payload = attr.Data
+		}
+	}
+
+	return p, nil
+}
+
+func (nfl *NetfilterNLSocket) nflogConfig(group uint16, attrs []netlink.NetlinkAttr) error {
+	_, err := nfl.execute(newNfMessage(nflogMsgType(NFULNL_MSG_CONFIG), 0, NFPROTO_UNSPEC, group, attrs))
+	return err
+}
+
+func nflogCmd(cmd uint8) netlink.NetlinkAttr {
+	return netlink.NewAttrUint8(NFULA_CFG_CMD, cmd)
+}
+
+// NflogBind binds the socket to a log group, so that the packets logged to it
+// are sent to the socket. A group can only be bound by one socket at a time.
+func (nfl *NetfilterNLSocket) NflogBind(group uint16) error {
+	return nfl.nflogConfig(group, []netlink.NetlinkAttr{nflogCmd(NFULNL_CFG_CMD_BIND)})
+}
+
+func (nfl *NetfilterNLSocket) NflogUnbind(group uint16) error {
+	return nfl.nflogConfig(group, []netlink.NetlinkAttr{nflogCmd(NFULNL_CFG_CMD_UNBIND)})
+}
+
+// NflogSetMode sets what is copied of logged packets: nothing, the metadata
+// only or, with NFULNL_COPY_PACKET, up to copyRange bytes of the packet.
+func (nfl *NetfilterNLSocket) NflogSetMode(group uint16, mode uint8, copyRange uint32) error {
+	b := make([]byte, 6)
+	binary.BigEndian.PutUint32(b[0:4], copyRange)
+	b[4] = mode
+	return nfl.nflogConfig(group, []netlink.NetlinkAttr{netlink.NewAttr(NFULA_CFG_MODE, b)})
+}
+
+// NflogSetQThreshold sets the number of packets the kernel queues before
+// sending them in a single datagram.
+func (nfl *NetfilterNLSocket) NflogSetQThreshold(group uint16, n uint32) error {
+	return nfl.nflogConfig(group, []netlink.NetlinkAttr{netlink.NewAttrNetUint32(NFULA_CFG_QTHRESH, n)})
+}
+
+// NflogSetTimeout sets how long queued packets may wait for the threshold to
+// be reached. It is kept in hundredths of a second.
+func (nfl *NetfilterNLSocket) NflogSetTimeout(group uint16, timeout time.Duration) error {
+	return nfl.nflogConfig(group, []netlink.NetlinkAttr{netlink.NewAttrNetUint32(NFULA_CFG_TIMEOUT, uint32(timeout/(10*time.Millisecond)))})
+}
+
+// NflogSetBufSize sets the size of the datagrams packets are queued in.
+func (nfl *NetfilterNLSocket) NflogSetBufSize(group uint16, size uint32) error {
+	return nfl.nflogConfig(group, []netlink.NetlinkAttr{netlink.NewAttrNetUint32(NFULA_CFG_NLBUFSIZ, size)})
+}
+
+// NflogSetFlags sets the NFULNL_CFG_F_* flags of a group.
+func (nfl *NetfilterNLSocket) NflogSetFlags(group uint16, flags uint16) error {
+	return nfl.nflogConfig(group, []netlink.NetlinkAttr{netlink.NewAttrNetUint16(NFULA_CFG_FLAGS, flags)})
+}
+
+// StartNflog calls cb for every packet logged to the groups the socket is
+// bound to. Packets dropped because the socket could not keep up are
+// reported as ENOBUFS on ec. The socket should not be used for requests once
+// it is running.
+func (nfl *NetfilterNLSocket) StartNflog(cb NflogCallback, ec chan error, args ...interface{}) error {
+	go func() {
+		for {
+			msgList, err := nfl.RecvMessages(nflogRecvBufferSize, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			for _, m := range msgList {
+				if m.Type != nflogMsgType(NFULNL_MSG_PACKET) {
+					continue
+				}
+				p, err := NflogPacketfromMessage(m)
+				if err != nil {
+					if ec != nil {
+						ec <- err
+					}
+					continue
+				}
+				cb(p, ec, args...)
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,158 @@
+package netfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestNflogPacketfromMessage(t *testing.T) {
+	hdr := []byte{0x08, 0x00, NF_INET_LOCAL_OUT, 0}
+	ts := make([]byte, 16)
+	binary.BigEndian.PutUint64(ts[0:8], 1000)
+	binary.BigEndian.PutUint64(ts[8:16], 250)
+	hw := make([]byte, SizeofNfulnlMsgPacketHw)
+	binary.BigEndian.PutUint16(hw[0:2], 6)
+	copy(hw[4:], []byte{2, 0, 0, 0, 0, 1})
+
+	msg := newNfMessage(nflogMsgType(NFULNL_MSG_PACKET), 0, NFPROTO_IPV4, 5, []netlink.NetlinkAttr{
+		netlink.NewAttr(NFULA_PACKET_HDR, hdr),
+		netlink.NewAttrNetUint32(NFULA_MARK, 7),
+		netlink.NewAttr(NFULA_TIMESTAMP, ts),
+		netlink.NewAttrNetUint32(NFULA_IFINDEX_INDEV, 2),
+		netlink.NewAttrNetUint32(NFULA_IFINDEX_OUTDEV, 3),
+		netlink.NewAttr(NFULA_HWADDR, hw),
+		netlink.NewAttrNetUint16(NFULA_HWTYPE, 1),
+		netlink.NewAttrString(NFULA_PREFIX, "dropped"),
+		netlink.NewAttrNetUint32(NFULA_UID, 0),
+		netlink.NewAttrNetUint32(NFULA_SEQ, 10),
+		netlink.NewAttrNetUint32(NFULA_SEQ_GLOBAL, 20),
+		netlink.NewAttr(NFULA_PAYLOAD, []byte{0x45, 0}),
+	})
+	m, err := ParseNfMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NflogPacketfromMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* the group is the resource id of the message */
+	if p.Group != 5 || p.Family != NFPROTO_IPV4 || p.HwProtocol != 0x0800 || p.Hook != NF_INET_LOCAL_OUT {
+		t.Errorf("got %+v", p)
+	}
+	if p.Mark != 7 || !p.Timestamp.Equal(time.Unix(1000, 250000)) || p.Indev != 2 || p.Outdev != 3 ||
+		p.HwAddr.String() != "02:00:00:00:00:01" || p.HwType != 1 || p.Prefix != "dropped" {
+		t.Errorf("got %+v", p)
+	}
+	/* uid 0 is told apart from no uid */
+	if !p.HasUid || p.Uid != 0 || p.HasGid || p.Seq != 10 || p.SeqGlobal != 20 || !bytes.Equal(p.Payload, []byte{0x45, 0}) {
+		t.Errorf("got %+v", p)
+	}
+
+	for _, attr := range []netlink.NetlinkAttr{
+		netlink.NewAttr(NFULA_PACKET_HDR, hdr[:2]),
+		netlink.NewAttr(NFULA_TIMESTAMP, ts[:8]),
+		netlink.NewAttr(NFULA_HWADDR, hw[:4]),
+	} {
+		m := testMessage(t, nflogMsgType(NFULNL_MSG_PACKET), NFPROTO_IPV4, []netlink.NetlinkAttr{attr})
+		if _, err := NflogPacketfromMessage(m); err != syscall.EINVAL {
+			t.Errorf("short attribute %d: %v", attr.AttrType(), err)
+		}
+	}
+}
+
+func TestNflog(t *testing.T) {
+	nfl := testNetns(t)
+	testLoopback(t)
+
+	ll, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ll.CloseLink()
+
+	err = ll.NflogBind(5)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ll.NflogSetMode(5, NFULNL_COPY_PACKET, 0xffff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ll.NflogSetFlags(5, NFULNL_CFG_F_SEQ)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ll.NflogSetQThreshold(5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ll.NflogSetTimeout(5, 100*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* a group is bound by a single socket */
+	err = nfl.NflogBind(5)
+	if err != syscall.EPERM {
+		t.Errorf("second bind: %v", err)
+	}
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_IPV4, Name: "log"})
+	b.AddChain(&Chain{Family: NFPROTO_IPV4, Table: "log", Name: "output", Hook: &ChainHook{Hooknum: NF_INET_LOCAL_OUT}})
+	exprs, _, err := CompileRule(NFPROTO_IPV4, "udp dport 9999 meta mark set 0x2a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs = append(exprs, &GenericExpr{ExprName: "log", Attrs: []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint16(1 /* NFTA_LOG_GROUP */, 5),
+		netlink.NewAttrString(2 /* NFTA_LOG_PREFIX */, "test"),
+	}})
+	b.AddRule(&Rule{Family: NFPROTO_IPV4, Table: "log", Chain: "output", Exprs: exprs})
+	err = nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := make(chan *NflogPacket, 10)
+	cb := func(p *NflogPacket, ec chan error, args ...interface{}) {
+		packets <- p
+	}
+	err = ll.StartNflog(cb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* locally sent packets have no timestamp yet */
+	sendUDP(t, 9999, []byte("hello"))
+	sendUDP(t, 9999, []byte("world"))
+
+	for i, want := range []string{"hello", "world"} {
+		select {
+		case p := <-packets:
+			if p.Group != 5 || p.Family != NFPROTO_IPV4 || p.Hook != NF_INET_LOCAL_OUT || p.Prefix != "test" ||
+				p.Mark != 42 || p.Outdev == 0 || p.Seq != uint32(i) {
+				t.Errorf("got %+v", p)
+			}
+			/* the payload starts with the ip header */
+			if len(p.Payload) != 20+8+len(want) || p.Payload[0]>>4 != 4 || string(p.Payload[28:]) != want {
+				t.Errorf("payload % x", p.Payload)
+			}
+			if !net.IP(p.Payload[16:20]).Equal(net.IPv4(127, 0, 0, 1)) {
+				t.Errorf("destination %v", net.IP(p.Payload[16:20]))
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for packet %d", i)
+		}
+	}
+}
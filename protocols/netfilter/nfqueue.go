@@ -0,0 +1,346 @@
+package netfilter
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+// A queued packet is delivered as a single message, which can be larger than
+// RECV_BUFFER_SIZE with the full packet, or a GSO packet, copied.
+const nfqueueRecvBufferSize = 2 * netlink.RECV_BUFFER_SIZE
+
+// NfqueuePacket is a packet waiting for a verdict. Payload holds the network
+// header and what follows, up to the copy range of the queue; CapLen is the
+// length of the whole packet when it was truncated. Uid and Gid are only
+// reported with NFQA_CFG_F_UID_GID set.
+type NfqueuePacket struct {
+	Queue      uint16
+	Family     uint8
+	Id         uint32
+	HwProtocol uint16
+	Hook       uint8
+	Mark       uint32
+	Timestamp  time.Time
+	Indev      uint32
+	Outdev     uint32
+	PhysIndev  uint32
+	PhysOutdev uint32
+	HwAddr     net.HardwareAddr
+	CapLen     uint32
+	SkbInfo    uint32
+	Uid        uint32
+	HasUid     bool
+	Gid        uint32
+	HasGid     bool
+	Payload    []byte
+	Attrs      []netlink.NetlinkAttr
+}
+
+// NfqueueVerdict is the verdict for the packet with Id, one of NF_ACCEPT,
+// NF_DROP, NF_REPEAT or NfQueueVerdict. The mark of the packet is set when
+// HasMark is set and its content replaced by Payload when it is not nil.
+type NfqueueVerdict struct {
+	Id      uint32
+	Verdict uint32
+	Mark    uint32
+	HasMark bool
+	Payload []byte
+}
+
+// Nfqueue is a queue being processed by StartNfqueue. Its packets are handed
+// to the callback concurrently, at most window of them at a time.
+type Nfqueue struct {
+	Num     uint16
+	nfl     *NetfilterNLSocket
+	window  chan struct{}
+	mu      sync.Mutex
+	pending map[uint32]bool
+}
+
+type NfqueueCallback func(*Nfqueue, *NfqueuePacket, chan error, ...interface{})
+
+func nfqueueMsgType(msg uint8) uint16 {
+	return NfMsgType(NFNL_SUBSYS_QUEUE, msg)
+}
+
+// NfQueueVerdict returns the verdict passing a packet to queue num.
+func NfQueueVerdict(num uint16) uint32 {
+	return NF_QUEUE | uint32(num)<<NF_VERDICT_QBITS
+}
+
+func NfqueuePacketfromMessage(m *NfMessage) (*NfqueuePacket, error) {
+	p := &NfqueuePacket{
+		Queue:  m.Header.ResId,
+		Family: m.Header.Family,
+		Attrs:  m.Attrs,
+	}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFQA_PACKET_HDR:
+			if len(attr.Data) < SizeofNfqnlMsgPacketHdr {
+				return nil, syscall.EINVAL
+			}
+			p.Id = binary.BigEndian.Uint32(attr.Data[0:4])
+			p.HwProtocol = binary.BigEndian.Uint16(attr.Data[4:6])
+			p.Hook = attr.Data[6]
+		case NFQA_MARK:
+			p.Mark = attr.NetUint32()
+		case NFQA_TIMESTAMP:
+			if len(attr.Data) < 16 {
+				return nil, syscall.EINVAL
+			}
+			sec := binary.BigEndian.Uint64(attr.Data[0:8])
+			usec := binary.BigEndian.Uint64(attr.Data[8:16])
+			p.Timestamp = time.Unix(int64(sec), int64(usec)*1000)
+		case NFQA_IFINDEX_INDEV:
+			p.Indev = attr.NetUint32()
+		case NFQA_IFINDEX_OUTDEV:
+			p.Outdev = attr.NetUint32()
+		case NFQA_IFINDEX_PHYSINDEV:
+			p.PhysIndev = attr.NetUint32()
+		case NFQA_IFINDEX_PHYSOUTDEV:
+			p.PhysOutdev = attr.NetUint32()
+		case NFQA_HWADDR:
+			if len(attr.Data) < SizeofNfqnlMsgPacketHw {
+				return nil, syscall.EINVAL
+			}
+			n := int(binary.BigEndian.Uint16(attr.Data[0:2]))
+			if n > 8 {
+				n = 8
+			}
+			p.HwAddr = net.HardwareAddr(attr.Data[4 : 4+n])
+		case NFQA_CAP_LEN:
+			p.CapLen = attr.NetUint32()
+		case NFQA_SKB_INFO:
+			p.SkbInfo = attr.NetUint32()
+		case NFQA_UID:
+			p.Uid = attr.NetUint32()
+			p.HasUid = true
+		case NFQA_GID:
+			p.Gid = attr.NetUint32()
+			p.HasGid = true
+		case NFQA_PAYLOAD:
+			p.Payload = attr.Data
+		}
+	}
+
+	return p, nil
+}
+
+func (nfl *NetfilterNLSocket) nfqueueConfig(num uint16, attrs []netlink.NetlinkAttr) error {
+	_, err := nfl.execute(newNfMessage(nfqueueMsgType(NFQNL_MSG_CONFIG), 0, NFPROTO_UNSPEC, num, attrs))
+	return err
+}
+
+func nfqueueCmd(cmd uint8) netlink.NetlinkAttr {
+	return netlink.NewAttr(NFQA_CFG_CMD, []byte{cmd, 0, 0, 0})
+}
+
+// NfqueueBind binds the socket to queue num, so that the packets queued to
+// it are sent to the socket. A queue can only be bound by one socket at a
+// time.
+func (nfl *NetfilterNLSocket) NfqueueBind(num uint16) error {
+	return nfl.nfqueueConfig(num, []netlink.NetlinkAttr{nfqueueCmd(NFQNL_CFG_CMD_BIND)})
+}
+
+// NfqueueUnbind unbinds the socket from queue num. Packets still waiting for
+// a verdict are dropped.
+func (nfl *NetfilterNLSocket) NfqueueUnbind(num uint16) error {
+	return nfl.nfqueueConfig(num, []netlink.NetlinkAttr{nfqueueCmd(NFQNL_CFG_CMD_UNBIND)})
+}
+
+// NfqueueSetMode sets what is copied of queued packets: nothing, the
+// metadata only or, with NFQNL_COPY_PACKET, up to copyRange bytes of the
+// packet.
+func (nfl *NetfilterNLSocket) NfqueueSetMode(num uint16, mode uint8, copyRange uint32) error {
+	b := make([]byte, 5)
+	binary.BigEndian.PutUint32(b[0:4], copyRange)
+	b[4] = mode
+	return nfl.nfqueueConfig(num, []netlink.NetlinkAttr{netlink.NewAttr(NFQA_CFG_PARAMS, b)})
+}
+
+// NfqueueSetMaxLen sets the number of packets that may wait for a verdict.
+// Further packets are dropped, or accepted with NFQA_CFG_F_FAIL_OPEN set.
+func (nfl *NetfilterNLSocket) NfqueueSetMaxLen(num uint16, n uint32) error {
+	return nfl.nfqueueConfig(num, []netlink.NetlinkAttr{netlink.NewAttrNetUint32(NFQA_CFG_QUEUE_MAXLEN, n)})
+}
+
+// NfqueueSetFlags sets the NFQA_CFG_F_* flags of queue num selected by mask.
+// With NFQA_CFG_F_GSO set, GSO packets are queued whole and their checksum
+// may not be computed yet, see NFQA_SKB_CSUMNOTREADY.
+func (nfl *NetfilterNLSocket) NfqueueSetFlags(num uint16, flags, mask uint32) error {
+	return nfl.nfqueueConfig(num, []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFQA_CFG_FLAGS, flags),
+		netlink.NewAttrNetUint32(NFQA_CFG_MASK, mask),
+	})
+}
+
+func verdictHdr(v *NfqueueVerdict) netlink.NetlinkAttr {
+	b := make([]byte, SizeofNfqnlMsgVerdictHdr)
+	binary.BigEndian.PutUint32(b[0:4], v.Verdict)
+	binary.BigEndian.PutUint32(b[4:8], v.Id)
+	return netlink.NewAttr(NFQA_VERDICT_HDR, b)
+}
+
+// SetVerdict issues the verdict for a single packet of queue num.
+func (nfl *NetfilterNLSocket) SetVerdict(num uint16, v *NfqueueVerdict) error {
+	attrs := []netlink.NetlinkAttr{verdictHdr(v)}
+	if v.HasMark {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFQA_MARK, v.Mark))
+	}
+	if v.Payload != nil {
+		attrs = append(attrs, netlink.NewAttr(NFQA_PAYLOAD, v.Payload))
+	}
+	return nfl.sendVerdict(nfqueueMsgType(NFQNL_MSG_VERDICT), num, attrs)
+}
+
+// SetVerdictBatch issues the verdict for every packet of queue num with an id
+// up to v.Id still waiting for one. Payload can not be set for a batch.
+func (nfl *NetfilterNLSocket) SetVerdictBatch(num uint16, v *NfqueueVerdict) error {
+	if v.Payload != nil {
+		return syscall.EINVAL
+	}
+	attrs := []netlink.NetlinkAttr{verdictHdr(v)}
+	if v.HasMark {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFQA_MARK, v.Mark))
+	}
+	return nfl.sendVerdict(nfqueueMsgType(NFQNL_MSG_VERDICT_BATCH), num, attrs)
+}
+
+// sendVerdict sends a verdict without asking for an acknowledgement, so that
+// it can be sent while packets are being received. Errors are received with
+// the packets.
+func (nfl *NetfilterNLSocket) sendVerdict(msgtype, num uint16, attrs []netlink.NetlinkAttr) error {
+	nl := (*netlink.NetlinkSocket)(nfl)
+	return nl.SendMessage(newNfMessage(msgtype, 0, NFPROTO_UNSPEC, num, attrs), 0, false)
+}
+
+// idAfter tells whether packet id a was queued after b, allowing for ids
+// wrapping around.
+func idAfter(a, b uint32) bool {
+	return int32(b-a) < 0
+}
+
+// SetVerdict issues the verdict for a packet of the queue and frees its slot
+// of the window. The slot is freed even when the verdict can not be sent, so
+// that the queue does not stall; the packet then stays queued in the kernel
+// until SetVerdict is called again for it.
+func (q *Nfqueue) SetVerdict(v *NfqueueVerdict) error {
+	err := q.nfl.SetVerdict(q.Num, v)
+
+	q.mu.Lock()
+	if q.pending[v.Id] {
+		delete(q.pending, v.Id)
+		<-q.window
+	}
+	q.mu.Unlock()
+
+	return err
+}
+
+// SetVerdictBatch issues the verdict for every packet of the queue up to
+// v.Id, including those still handled by other callbacks, and frees their
+// slots of the window, even when the verdict can not be sent, as SetVerdict
+// does.
+func (q *Nfqueue) SetVerdictBatch(v *NfqueueVerdict) error {
+	err := q.nfl.SetVerdictBatch(q.Num, v)
+
+	q.mu.Lock()
+	for id := range q.pending {
+		if !idAfter(id, v.Id) {
+			delete(q.pending, id)
+			<-q.window
+		}
+	}
+	q.mu.Unlock()
+
+	return err
+}
+
+// StartNfqueue calls cb, in a goroutine of its own, for every packet of
+// queue num, which the socket must be bound to with NfqueueBind and
+// configured. Every packet must be given a verdict with the SetVerdict
+// methods of the Nfqueue passed to cb. At most window packets wait for a
+// verdict: the queue is limited to that many packets in the kernel, beyond
+// which they are dropped, or accepted with NFQA_CFG_F_FAIL_OPEN set, and no
+// packet is received while the window is full. The window must hold at
+// least a packet. Errors for verdicts are reported on ec. The socket should
+// not be used for other requests once processing is running.
+func (nfl *NetfilterNLSocket) StartNfqueue(num uint16, window int, cb NfqueueCallback, ec chan error, args ...interface{}) (*Nfqueue, error) {
+	if window <= 0 {
+		return nil, syscall.EINVAL
+	}
+
+	err := nfl.NfqueueSetMaxLen(num, uint32(window))
+	if err != nil {
+		return nil, err
+	}
+
+	q := &Nfqueue{
+		Num:     num,
+		nfl:     nfl,
+		window:  make(chan struct{}, window),
+		pending: map[uint32]bool{},
+	}
+
+	nl := (*netlink.NetlinkSocket)(nfl)
+
+	go func() {
+		for {
+			msgList, err := nl.RecvMessages(nfqueueRecvBufferSize, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			for _, msg := range msgList {
+				p, err := q.packet(&msg)
+				if err != nil {
+					if ec != nil {
+						ec <- err
+					}
+					continue
+				}
+				if p == nil {
+					continue
+				}
+				q.window <- struct{}{}
+				q.mu.Lock()
+				q.pending[p.Id] = true
+				q.mu.Unlock()
+				go cb(q, p, ec, args...)
+			}
+		}
+	}()
+
+	return q, nil
+}
+
+// packet decodes a packet of the queue. It returns the error of error
+// messages and nil for other messages.
+func (q *Nfqueue) packet(msg *netlink.NetlinkMessage) (*NfqueuePacket, error) {
+	switch msg.Header.Type {
+	case syscall.NLMSG_ERROR:
+		return nil, netlink.ParseErrorMessage(msg)
+	case nfqueueMsgType(NFQNL_MSG_PACKET):
+	default:
+		return nil, nil
+	}
+
+	m, err := ParseNfMessage(msg)
+	if err != nil {
+		return nil, err
+	}
+	return NfqueuePacketfromMessage(m)
+}
@@ -0,0 +1,244 @@
+package netfilter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestNfQueueVerdict(t *testing.T) {
+	if v := NfQueueVerdict(3); v != 0x00030003 {
+		t.Errorf("got %#x", v)
+	}
+
+	hdr := verdictHdr(&NfqueueVerdict{Id: 7, Verdict: NF_ACCEPT})
+	if hdr.AttrType() != NFQA_VERDICT_HDR || !bytes.Equal(hdr.Data, []byte{0, 0, 0, 1, 0, 0, 0, 7}) {
+		t.Errorf("got %+v", hdr)
+	}
+}
+
+func TestNfqueuePacketfromMessage(t *testing.T) {
+	hdr := []byte{0, 0, 0, 9, 0x86, 0xdd, NF_INET_LOCAL_IN}
+	hw := make([]byte, SizeofNfqnlMsgPacketHw)
+	binary.BigEndian.PutUint16(hw[0:2], 6)
+	copy(hw[4:], []byte{2, 0, 0, 0, 0, 1})
+
+	msg := newNfMessage(nfqueueMsgType(NFQNL_MSG_PACKET), 0, NFPROTO_IPV6, 4, []netlink.NetlinkAttr{
+		netlink.NewAttr(NFQA_PACKET_HDR, hdr),
+		netlink.NewAttrNetUint32(NFQA_MARK, 1),
+		netlink.NewAttrNetUint32(NFQA_IFINDEX_INDEV, 2),
+		netlink.NewAttr(NFQA_HWADDR, hw),
+		netlink.NewAttrNetUint32(NFQA_CAP_LEN, 1500),
+		netlink.NewAttrNetUint32(NFQA_SKB_INFO, NFQA_SKB_CSUMNOTREADY),
+		netlink.NewAttrNetUint32(NFQA_GID, 100),
+		netlink.NewAttr(NFQA_PAYLOAD, []byte{0x60}),
+	})
+	m, err := ParseNfMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NfqueuePacketfromMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Queue != 4 || p.Family != NFPROTO_IPV6 || p.Id != 9 || p.HwProtocol != 0x86dd || p.Hook != NF_INET_LOCAL_IN {
+		t.Errorf("got %+v", p)
+	}
+	if p.Mark != 1 || p.Indev != 2 || p.HwAddr.String() != "02:00:00:00:00:01" || p.CapLen != 1500 ||
+		p.SkbInfo != NFQA_SKB_CSUMNOTREADY || p.HasUid || !p.HasGid || p.Gid != 100 || !bytes.Equal(p.Payload, []byte{0x60}) {
+		t.Errorf("got %+v", p)
+	}
+
+	m = testMessage(t, nfqueueMsgType(NFQNL_MSG_PACKET), NFPROTO_IPV4, []netlink.NetlinkAttr{
+		netlink.NewAttr(NFQA_PACKET_HDR, hdr[:6]),
+	})
+	if _, err := NfqueuePacketfromMessage(m); err != syscall.EINVAL {
+		t.Errorf("short header: %v", err)
+	}
+}
+
+func TestIdAfter(t *testing.T) {
+	tests := []struct {
+		a, b  uint32
+		after bool
+	}{
+		{2, 1, true},
+		{1, 2, false},
+		{1, 1, false},
+		/* ids wrap around */
+		{0, 0xffffffff, true},
+		{0xffffffff, 0, false},
+		{0x80000000, 1, true},
+	}
+
+	for _, test := range tests {
+		if got := idAfter(test.a, test.b); got != test.after {
+			t.Errorf("idAfter(%#x, %#x): got %v", test.a, test.b, got)
+		}
+	}
+}
+
+func TestNfqueuePacketMessage(t *testing.T) {
+	q := &Nfqueue{Num: 1}
+
+	errno := int32(syscall.ENOENT)
+	msg := &netlink.NetlinkMessage{Data: netlink.NewAttrUint32(0, uint32(-errno)).Data}
+	msg.Header.Type = syscall.NLMSG_ERROR
+	if _, err := q.packet(msg); err != syscall.ENOENT {
+		t.Errorf("error message: %v", err)
+	}
+
+	/* configuration replies and other messages are skipped */
+	msg = newNfMessage(nfqueueMsgType(NFQNL_MSG_CONFIG), 0, NFPROTO_UNSPEC, 1, nil)
+	if p, err := q.packet(msg); p != nil || err != nil {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	msg = newNfMessage(nfqueueMsgType(NFQNL_MSG_PACKET), 0, NFPROTO_IPV4, 1, []netlink.NetlinkAttr{
+		netlink.NewAttr(NFQA_PACKET_HDR, []byte{0, 0, 0, 5, 8, 0, NF_INET_LOCAL_OUT}),
+	})
+	if p, err := q.packet(msg); err != nil || p == nil || p.Id != 5 {
+		t.Errorf("got %+v, %v", p, err)
+	}
+}
+
+// testWindow returns a queue on a closed socket, on which every verdict
+// fails, with the window taken by packets ids.
+func testWindow(t *testing.T, ids ...uint32) *Nfqueue {
+	t.Helper()
+	nfl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nfl.CloseLink()
+
+	q := &Nfqueue{Num: 1, nfl: nfl, window: make(chan struct{}, len(ids)), pending: map[uint32]bool{}}
+	for _, id := range ids {
+		q.window <- struct{}{}
+		q.pending[id] = true
+	}
+	return q
+}
+
+func TestNfqueueWindow(t *testing.T) {
+	/* slots are freed even when the verdict can not be sent */
+	q := testWindow(t, 1, 2, 3)
+	if err := q.SetVerdict(&NfqueueVerdict{Id: 2, Verdict: NF_ACCEPT}); err == nil {
+		t.Error("verdict sent on a closed socket")
+	}
+	if len(q.window) != 2 || q.pending[2] {
+		t.Errorf("window %d pending %v", len(q.window), q.pending)
+	}
+
+	/* a verdict for a packet not waiting for one frees nothing */
+	q.SetVerdict(&NfqueueVerdict{Id: 2, Verdict: NF_ACCEPT})
+	if len(q.window) != 2 {
+		t.Errorf("window %d", len(q.window))
+	}
+
+	q.SetVerdictBatch(&NfqueueVerdict{Id: 1, Verdict: NF_DROP})
+	if len(q.window) != 1 || !q.pending[3] {
+		t.Errorf("window %d pending %v", len(q.window), q.pending)
+	}
+
+	/* batches include the ids before a wrap around */
+	q = testWindow(t, 0xfffffffe, 0xffffffff, 0, 1)
+	q.SetVerdictBatch(&NfqueueVerdict{Id: 0, Verdict: NF_ACCEPT})
+	if len(q.window) != 1 || !q.pending[1] {
+		t.Errorf("window %d pending %v", len(q.window), q.pending)
+	}
+
+	if err := q.nfl.SetVerdictBatch(1, &NfqueueVerdict{Id: 1, Payload: []byte{}}); err != syscall.EINVAL {
+		t.Errorf("batch with a payload: %v", err)
+	}
+
+	/* the window holds at least a packet */
+	for _, window := range []int{0, -1} {
+		if _, err := q.nfl.StartNfqueue(1, window, nil, nil); err != syscall.EINVAL {
+			t.Errorf("window %d: %v", window, err)
+		}
+	}
+}
+
+func TestNfqueue(t *testing.T) {
+	nfl := testNetns(t)
+	testLoopback(t)
+
+	ql, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ql.CloseLink()
+
+	err = ql.NfqueueBind(1)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ql.NfqueueSetMode(1, NFQNL_COPY_PACKET, 0xffff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ql.NfqueueSetFlags(1, NFQA_CFG_F_UID_GID, NFQA_CFG_F_UID_GID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* a queue is bound by a single socket */
+	err = nfl.NfqueueBind(1)
+	if err != syscall.EPERM {
+		t.Errorf("second bind: %v", err)
+	}
+
+	exprs, _, err := CompileRule(NFPROTO_IPV4, "udp dport 9999")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs = append(exprs, &GenericExpr{ExprName: "queue", Attrs: []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint16(1 /* NFTA_QUEUE_NUM */, 1),
+	}})
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_IPV4, Name: "queue"})
+	b.AddChain(&Chain{Family: NFPROTO_IPV4, Table: "queue", Name: "output", Hook: &ChainHook{Hooknum: NF_INET_LOCAL_OUT}})
+	b.AddRule(&Rule{Family: NFPROTO_IPV4, Table: "queue", Chain: "output", Exprs: exprs})
+	err = nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if be, ok := err.(*BatchError); ok && be.Err == syscall.ENOENT {
+		t.Skip("queue expression unavailable")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets := make(chan *NfqueuePacket, 10)
+	cb := func(q *Nfqueue, p *NfqueuePacket, ec chan error, args ...interface{}) {
+		packets <- p
+		err := q.SetVerdict(&NfqueueVerdict{Id: p.Id, Verdict: NF_ACCEPT, Mark: 7, HasMark: true})
+		if err != nil {
+			ec <- err
+		}
+	}
+	ec := make(chan error, 10)
+	_, err = ql.StartNfqueue(1, 4, cb, ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sendUDP(t, 9999, []byte("hello"))
+
+	select {
+	case p := <-packets:
+		if p.Queue != 1 || p.Hook != NF_INET_LOCAL_OUT || p.Id == 0 || !p.HasUid || string(p.Payload[28:]) != "hello" {
+			t.Errorf("got %+v", p)
+		}
+	case err := <-ec:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the packet")
+	}
+}
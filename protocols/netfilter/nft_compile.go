@@ -0,0 +1,454 @@
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// AnonSet is an anonymous set built for a set literal of a compiled rule.
+// It must be created in the same batch as the rule, before it; see
+// Batch.AddRuleText.
+type AnonSet struct {
+	Set    *Set
+	Elems  []SetElem
+	Lookup *Lookup
+}
+
+type compiler struct {
+	family uint8
+	toks   []string
+	pos    int
+	exprs  []Expr
+	sets   []AnonSet
+	deps   map[string]bool
+}
+
+// value is an element of a match: a single value, or the range from key to
+// end, which prefix gives in bits when it was written as one.
+type value struct {
+	key    []byte
+	end    []byte
+	prefix int
+}
+
+// CompileRule compiles a rule written in nft(8) syntax into expressions, for
+// a table of the given family. The supported subset covers the ip, ip6,
+// tcp, udp, icmp, meta and ct fields listed by the decompiler, with
+// comparison operators, masks ("meta mark & 0xff == 0x1"), prefixes,
+// ranges, set literals and named sets ("@name"), the "meta mark set" and
+// "ct mark set" statements, the "add", "update" and "delete" set
+// statements, counters and verdicts, for example:
+//
+//	ip saddr 10.0.0.0/8 tcp dport { 22, 443 } counter accept
+//
+// Flag fields such as "tcp flags" match any of the given bits when no
+// operator is written, and the whole field otherwise. Protocol
+// dependencies, such as "meta l4proto tcp" before a match on a tcp port,
+// are added as nft(8) does.
+func CompileRule(family uint8, text string) ([]Expr, []AnonSet, error) {
+	toks, err := tokenize(text)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c := &compiler{
+		family: family,
+		toks:   toks,
+		deps:   map[string]bool{},
+	}
+
+	for c.pos < len(c.toks) {
+		err = c.statement()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return c.exprs, c.sets, nil
+}
+
+func (c *compiler) next() string {
+	if c.pos >= len(c.toks) {
+		return ""
+	}
+	tok := c.toks[c.pos]
+	c.pos++
+	return tok
+}
+
+func (c *compiler) peek() string {
+	if c.pos >= len(c.toks) {
+		return ""
+	}
+	return c.toks[c.pos]
+}
+
+func (c *compiler) statement() error {
+	tok := c.next()
+
+	switch tok {
+	case "counter":
+		e := &Counter{}
+		for c.peek() == "packets" || c.peek() == "bytes" {
+			name := c.next()
+			n, err := strconv.ParseUint(c.next(), 10, 64)
+			if err != nil {
+				return fmt.Errorf("bad counter %s", name)
+			}
+			if name == "packets" {
+				e.Packets = n
+			} else {
+				e.Bytes = n
+			}
+		}
+		c.exprs = append(c.exprs, e)
+		return nil
+	case "jump", "goto":
+		chain := strings.Trim(c.next(), "\"")
+		if chain == "" {
+			return fmt.Errorf("%s needs a chain", tok)
+		}
+		code := int32(NFT_JUMP)
+		if tok == "goto" {
+			code = NFT_GOTO
+		}
+		c.exprs = append(c.exprs, &Verdict{Code: code, Chain: chain})
+		return nil
+	case "add", "update", "delete":
+		return c.dynset(tok)
+	}
+
+	for code, name := range verdictNames {
+		if name == tok && code != NFT_JUMP && code != NFT_GOTO {
+			c.exprs = append(c.exprs, &Verdict{Code: code})
+			return nil
+		}
+	}
+
+	f, err := c.field(tok)
+	if err != nil {
+		return err
+	}
+
+	if c.peek() == "set" {
+		c.next()
+		return c.setStatement(f)
+	}
+
+	return c.match(f)
+}
+
+func (c *compiler) field(tok string) (*nftField, error) {
+	if strings.HasPrefix(tok, "@") {
+		return parseRawField(tok)
+	}
+
+	proto, name := tok, ""
+	if bareMetaKeys[tok] {
+		proto, name = "meta", tok
+	} else {
+		name = c.next()
+	}
+
+	f := lookupField(proto, name)
+	if f == nil {
+		return nil, fmt.Errorf("unknown expression %q", strings.TrimSpace(proto+" "+name))
+	}
+	return f, nil
+}
+
+func (c *compiler) setStatement(f *nftField) error {
+	if f.kind == fieldPayload {
+		return fmt.Errorf("cannot set %s", f)
+	}
+
+	v, err := f.typ.parse(f.typ, c.next())
+	if err != nil {
+		return err
+	}
+
+	c.exprs = append(c.exprs, &Immediate{Dreg: NFT_REG_1, Data: v})
+	if f.kind == fieldMeta {
+		c.exprs = append(c.exprs, &Meta{Key: f.key, Sreg: NFT_REG_1})
+	} else {
+		c.exprs = append(c.exprs, &Ct{Key: f.key, Sreg: NFT_REG_1})
+	}
+	return nil
+}
+
+// dynset compiles a statement adding the key of the packet to a set, or
+// updating or deleting it, such as "add @seen { ip saddr }".
+func (c *compiler) dynset(op string) error {
+	name := c.next()
+	if !strings.HasPrefix(name, "@") {
+		return fmt.Errorf("%s needs a set", op)
+	}
+	if c.next() != "{" {
+		return fmt.Errorf("%s needs a key", op)
+	}
+
+	f, err := c.field(c.next())
+	if err != nil {
+		return err
+	}
+	if c.next() != "}" {
+		return fmt.Errorf("%s takes a single key", op)
+	}
+
+	err = c.dependency(f)
+	if err != nil {
+		return err
+	}
+
+	code := uint32(0)
+	for i, o := range dynsetOps {
+		if o == op {
+			code = uint32(i)
+		}
+	}
+
+	c.exprs = append(c.exprs, f.load(NFT_REG_1), &Dynset{SetName: name[1:], Op: code, SregKey: NFT_REG_1})
+	return nil
+}
+
+func (c *compiler) dependency(f *nftField) error {
+	dep := f.dependency(c.family)
+	if dep == "" || c.deps[dep] {
+		return nil
+	}
+
+	exprs, _, err := CompileRule(c.family, dep)
+	if err != nil {
+		return err
+	}
+	c.exprs = append(c.exprs, exprs...)
+	c.deps[dep] = true
+	return nil
+}
+
+func (c *compiler) match(f *nftField) error {
+	var mask []byte
+	if c.peek() == "&" {
+		c.next()
+		m, err := f.typ.parse(f.typ, c.next())
+		if err != nil {
+			return err
+		}
+		mask = m
+	}
+
+	op := uint32(NFT_CMP_EQ)
+	explicit := false
+	if o, ok := cmpOps[c.peek()]; ok {
+		op = o
+		explicit = true
+		c.next()
+	}
+
+	err := c.dependency(f)
+	if err != nil {
+		return err
+	}
+
+	tok := c.next()
+	if tok == "" {
+		return fmt.Errorf("%s needs a value", f)
+	}
+
+	if mask != nil && (strings.HasPrefix(tok, "@") || tok == "{") {
+		return fmt.Errorf("masks are not supported with sets")
+	}
+
+	if strings.HasPrefix(tok, "@") {
+		return c.lookup(f, op, &Lookup{SetName: tok[1:]})
+	}
+
+	if tok == "{" {
+		values := []value{}
+		for {
+			tok = c.next()
+			if tok == "}" {
+				break
+			}
+			if tok == "," {
+				continue
+			}
+			if tok == "" {
+				return fmt.Errorf("unterminated set")
+			}
+			v, err := parseValue(f.typ, tok)
+			if err != nil {
+				return err
+			}
+			values = append(values, v)
+		}
+		return c.anonSet(f, op, values)
+	}
+
+	v, err := parseValue(f.typ, tok)
+	if err != nil {
+		return err
+	}
+	if f.typ.host && op != NFT_CMP_EQ && op != NFT_CMP_NEQ {
+		/* cmp compares the bytes of the register, which are in host order */
+		return fmt.Errorf("only == and != are supported with %s", f)
+	}
+
+	c.exprs = append(c.exprs, f.load(NFT_REG_1))
+
+	switch {
+	case mask != nil:
+		if v.end != nil {
+			return fmt.Errorf("masks are not supported with ranges")
+		}
+		c.exprs = append(c.exprs,
+			&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: uint32(f.typ.len), Mask: mask, Xor: make([]byte, f.typ.len)},
+			&Cmp{Op: op, Sreg: NFT_REG_1, Data: v.key})
+	case f.typ.bitmask && !explicit:
+		/* any of the bits, an explicit operator compares the whole field */
+		zero := make([]byte, f.typ.len)
+		c.exprs = append(c.exprs,
+			&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: uint32(f.typ.len), Mask: v.key, Xor: zero},
+			&Cmp{Op: NFT_CMP_NEQ, Sreg: NFT_REG_1, Data: zero})
+	case v.prefix != 0:
+		mask := prefixMask(f.typ.len, v.prefix)
+		c.exprs = append(c.exprs,
+			&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: uint32(f.typ.len), Mask: mask, Xor: make([]byte, f.typ.len)},
+			&Cmp{Op: op, Sreg: NFT_REG_1, Data: v.key})
+	case v.end != nil:
+		if op != NFT_CMP_EQ {
+			return fmt.Errorf("only == is supported with ranges")
+		}
+		c.exprs = append(c.exprs,
+			&Cmp{Op: NFT_CMP_GTE, Sreg: NFT_REG_1, Data: v.key},
+			&Cmp{Op: NFT_CMP_LTE, Sreg: NFT_REG_1, Data: v.end})
+	default:
+		c.exprs = append(c.exprs, &Cmp{Op: op, Sreg: NFT_REG_1, Data: v.key})
+		if op == NFT_CMP_EQ {
+			c.deps[f.String()+" "+f.typ.format(f.typ, v.key)] = true
+		}
+	}
+
+	return nil
+}
+
+func (c *compiler) lookup(f *nftField, op uint32, l *Lookup) error {
+	if op != NFT_CMP_EQ && op != NFT_CMP_NEQ {
+		return fmt.Errorf("bad operator for a set")
+	}
+	l.Sreg = NFT_REG_1
+	l.Invert = op == NFT_CMP_NEQ
+	c.exprs = append(c.exprs, f.load(NFT_REG_1), l)
+	return nil
+}
+
+func (c *compiler) anonSet(f *nftField, op uint32, values []value) error {
+	s := &Set{
+		Family:  c.family,
+		Name:    "__set%d",
+		Flags:   NFT_SET_ANONYMOUS | NFT_SET_CONSTANT,
+		KeyType: f.typ.id,
+		KeyLen:  uint32(f.typ.len),
+	}
+
+	for _, v := range values {
+		if v.end != nil {
+			s.Flags |= NFT_SET_INTERVAL
+		}
+	}
+
+	elems := []SetElem{}
+	for _, v := range values {
+		if s.Flags&NFT_SET_INTERVAL == 0 {
+			elems = append(elems, SetElem{Key: v.key})
+			continue
+		}
+		end := v.end
+		if end == nil {
+			end = v.key
+		}
+		elems = append(elems, IntervalElems(v.key, end)...)
+	}
+
+	l := &Lookup{SetName: s.Name}
+	c.sets = append(c.sets, AnonSet{Set: s, Elems: elems, Lookup: l})
+	return c.lookup(f, op, l)
+}
+
+// parseValue parses a single value, a prefix or a range. Prefixes are also
+// returned as the range they cover, for sets.
+func parseValue(t *nftType, s string) (value, error) {
+	if i := strings.IndexByte(s, '/'); i >= 0 && t.prefix {
+		key, err := t.parse(t, s[:i])
+		if err != nil {
+			return value{}, err
+		}
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n < 0 || n > t.len*8 {
+			return value{}, fmt.Errorf("bad prefix %q", s)
+		}
+		mask := prefixMask(t.len, n)
+		start := make([]byte, t.len)
+		end := make([]byte, t.len)
+		for j := range key {
+			start[j] = key[j] & mask[j]
+			end[j] = key[j] | ^mask[j]
+		}
+		return value{key: start, end: end, prefix: n}, nil
+	}
+
+	if i := strings.IndexByte(s, '-'); i > 0 && t.id != NFT_TYPE_IFNAME {
+		if t.host {
+			return value{}, fmt.Errorf("ranges are not supported for %q", s)
+		}
+		start, err := t.parse(t, s[:i])
+		if err != nil {
+			return value{}, err
+		}
+		end, err := t.parse(t, s[i+1:])
+		if err != nil {
+			return value{}, err
+		}
+		if bytes.Compare(start, end) > 0 {
+			return value{}, fmt.Errorf("bad range %q", s)
+		}
+		return value{key: start, end: end}, nil
+	}
+
+	key, err := t.parse(t, s)
+	if err != nil {
+		return value{}, err
+	}
+	return value{key: key}, nil
+}
+
+func prefixMask(length, bits int) []byte {
+	mask := make([]byte, length)
+	for i := 0; i < bits; i++ {
+		mask[i/8] |= 0x80 >> uint(i%8)
+	}
+	return mask
+}
+
+// AddRuleText compiles text with CompileRule into the expressions of r and
+// appends r to its chain, creating the anonymous sets it uses first.
+func (b *Batch) AddRuleText(r *Rule, text string) error {
+	exprs, sets, err := CompileRule(r.Family, text)
+	if err != nil {
+		return err
+	}
+
+	for _, as := range sets {
+		as.Set.Family = r.Family
+		as.Set.Table = r.Table
+		b.AddSet(as.Set)
+		b.AddSetElems(as.Set, as.Elems)
+		as.Lookup.SetId = as.Set.Id
+	}
+
+	r.Exprs = exprs
+	b.AddRule(r)
+	return nil
+}
@@ -0,0 +1,397 @@
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+// decompile writes exprs back as text, naming the anonymous sets they use
+// the way the kernel does.
+func decompile(family uint8, exprs []Expr, sets []AnonSet) string {
+	elems := map[string][]*SetElem{}
+	for i, as := range sets {
+		name := fmt.Sprintf("__set%d", i)
+		as.Lookup.SetName = name
+		for j := range as.Elems {
+			elems[name] = append(elems[name], &as.Elems[j])
+		}
+	}
+	return DecompileRule(family, exprs, elems)
+}
+
+func TestCompileRoundTrip(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"ip saddr 10.0.0.0/8 tcp dport { 22, 443 } accept", ""},
+		{"ip saddr != 10.0.0.0/8 drop", ""},
+		{"ip daddr { 10.0.0.0/8, 192.0.2.1 } drop", ""},
+		{"ip6 saddr ::1 udp dport 53", ""},
+		{"ip protocol tcp tcp dport 22", ""},
+		{"tcp dport 1000-2000 drop", ""},
+		{"tcp dport { 1000-2000, 3000 } drop", ""},
+		{"tcp dport < 1024", ""},
+		{"tcp dport ssh", "tcp dport 22"},
+		{"tcp flags syn,ack", ""},
+		{"tcp flags == syn", ""},
+		{"tcp flags != syn", ""},
+		{"ct state established,related accept", ""},
+		{"ct state == established accept", ""},
+		{"ct mark set 0x10", "ct mark set 0x00000010"},
+		{"meta mark set 0x10", "meta mark set 0x00000010"},
+		{"mark 0x00000001 counter packets 1 bytes 2 jump other", "meta mark 0x00000001 counter packets 1 bytes 2 jump other"},
+		{"meta l4proto tcp counter goto other", "meta l4proto tcp counter packets 0 bytes 0 goto other"},
+		{"meta skuid 1000 return", ""},
+		{`iifname "eth0" accept`, ""},
+		{`oifname "veth*" continue`, ""},
+		{"ip saddr @blocked drop", ""},
+		{"ip saddr != @blocked drop", ""},
+		{"add @seen { ip saddr }", ""},
+		{"update @seen { tcp sport }", ""},
+		{"delete @seen { meta mark }", ""},
+		{"@th,16,16 0x0016", ""},
+		{"meta mark & 0xff == 0x1", "meta mark & 0x000000ff == 0x00000001"},
+		{"ct mark & 0xff00 != 0x100 drop", "ct mark & 0x0000ff00 != 0x00000100 drop"},
+		{"tcp flags & syn,ack == syn", ""},
+		{"ip saddr & 0.255.0.255 == 0.1.0.1", ""},
+	}
+
+	for _, test := range tests {
+		want := test.want
+		if want == "" {
+			want = test.text
+		}
+		for _, family := range []uint8{NFPROTO_INET, NFPROTO_IPV4} {
+			exprs, sets, err := CompileRule(family, test.text)
+			if err != nil {
+				t.Errorf("%q: %v", test.text, err)
+				continue
+			}
+			if got := decompile(family, exprs, sets); got != want {
+				t.Errorf("family %d: got %q, want %q", family, got, want)
+			}
+		}
+	}
+}
+
+func TestCompileExprs(t *testing.T) {
+	zero := []byte{0}
+	tests := []struct {
+		family uint8
+		text   string
+		exprs  []Expr
+	}{
+		{NFPROTO_IPV4, "tcp dport 22 accept", []Expr{
+			&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_TCP}},
+			&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 2, Len: 2, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{0, 22}},
+			&Verdict{Code: NF_ACCEPT},
+		}},
+		/* mixed families match the network protocol first */
+		{NFPROTO_INET, "ip saddr 192.0.2.0/24", []Expr{
+			&Meta{Key: NFT_META_NFPROTO, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{NFPROTO_IPV4}},
+			&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 12, Len: 4, Dreg: NFT_REG_1},
+			&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: 4, Mask: []byte{255, 255, 255, 0}, Xor: make([]byte, 4)},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{192, 0, 2, 0}},
+		}},
+		{NFPROTO_BRIDGE, "ip6 hoplimit 1", []Expr{
+			&Meta{Key: NFT_META_PROTOCOL, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{0x86, 0xdd}},
+			&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 7, Len: 1, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{1}},
+		}},
+		/* bare flags match any of the bits, an operator the whole field */
+		{NFPROTO_IPV4, "tcp flags syn,ack", []Expr{
+			&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_TCP}},
+			&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 13, Len: 1, Dreg: NFT_REG_1},
+			&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: 1, Mask: []byte{0x12}, Xor: zero},
+			&Cmp{Op: NFT_CMP_NEQ, Sreg: NFT_REG_1, Data: zero},
+		}},
+		{NFPROTO_IPV4, "tcp flags == syn", []Expr{
+			&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_TCP}},
+			&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 13, Len: 1, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{0x02}},
+		}},
+		/* conntrack state and marks are in host byte order */
+		{NFPROTO_IPV4, "ct state == new", []Expr{
+			&Ct{Key: NFT_CT_STATE, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: netlink.NewAttrUint32(0, NF_CT_STATE_NEW).Data},
+		}},
+		{NFPROTO_IPV4, "meta mark set 7", []Expr{
+			&Immediate{Dreg: NFT_REG_1, Data: netlink.NewAttrUint32(0, 7).Data},
+			&Meta{Key: NFT_META_MARK, Sreg: NFT_REG_1},
+		}},
+		{NFPROTO_IPV4, "tcp dport 1-1023", []Expr{
+			&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_TCP}},
+			&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 2, Len: 2, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_GTE, Sreg: NFT_REG_1, Data: []byte{0, 1}},
+			&Cmp{Op: NFT_CMP_LTE, Sreg: NFT_REG_1, Data: []byte{3, 255}},
+		}},
+		{NFPROTO_IPV4, `iifname "eth*"`, []Expr{
+			&Meta{Key: NFT_META_IIFNAME, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte("eth")},
+		}},
+		{NFPROTO_IPV4, "add @seen { ip saddr }", []Expr{
+			&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 12, Len: 4, Dreg: NFT_REG_1},
+			&Dynset{SetName: "seen", Op: NFT_DYNSET_OP_ADD, SregKey: NFT_REG_1},
+		}},
+		/* a dependency is matched once */
+		{NFPROTO_IPV4, "tcp sport 1 tcp dport 2", []Expr{
+			&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_TCP}},
+			&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 0, Len: 2, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{0, 1}},
+			&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 2, Len: 2, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{0, 2}},
+		}},
+	}
+
+	for _, test := range tests {
+		exprs, _, err := CompileRule(test.family, test.text)
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(exprs, test.exprs) {
+			t.Errorf("%q:\ngot  %+v\nwant %+v", test.text, exprs, test.exprs)
+		}
+	}
+}
+
+func TestCompileSets(t *testing.T) {
+	exprs, sets, err := CompileRule(NFPROTO_IPV4, "ip daddr != { 10.0.0.0/8, 192.0.2.1 } tcp dport { 22, 80 } drop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 2 {
+		t.Fatalf("got %d sets", len(sets))
+	}
+
+	/* prefixes make an interval set */
+	addrs := sets[0]
+	if addrs.Set.Flags != NFT_SET_ANONYMOUS|NFT_SET_CONSTANT|NFT_SET_INTERVAL || addrs.Set.KeyType != NFT_TYPE_IPADDR ||
+		addrs.Set.KeyLen != 4 {
+		t.Errorf("address set %+v", addrs.Set)
+	}
+	want := []SetElem{
+		{Key: []byte{10, 0, 0, 0}},
+		{Key: []byte{11, 0, 0, 0}, Flags: NFT_SET_ELEM_INTERVAL_END},
+		{Key: []byte{192, 0, 2, 1}},
+		{Key: []byte{192, 0, 2, 2}, Flags: NFT_SET_ELEM_INTERVAL_END},
+	}
+	if !reflect.DeepEqual(addrs.Elems, want) {
+		t.Errorf("address elements %+v", addrs.Elems)
+	}
+	if !addrs.Lookup.Invert || addrs.Lookup != exprs[1] {
+		t.Errorf("address lookup %+v", addrs.Lookup)
+	}
+
+	ports := sets[1]
+	if ports.Set.Flags != NFT_SET_ANONYMOUS|NFT_SET_CONSTANT || ports.Set.KeyType != NFT_TYPE_INET_SERVICE {
+		t.Errorf("port set %+v", ports.Set)
+	}
+	if len(ports.Elems) != 2 || !bytes.Equal(ports.Elems[1].Key, []byte{0, 80}) || ports.Lookup.Invert {
+		t.Errorf("port set %+v %+v", ports.Elems, ports.Lookup)
+	}
+
+	/* the sets come before the rule in the batch and are referenced by id */
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	r := &Rule{Family: NFPROTO_IPV4, Table: "filter", Chain: "input"}
+	err = b.AddRuleText(r, "tcp dport { 22, 80 } accept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != 3 || NfMsgId(b.msgs[0].Header.Type) != NFT_MSG_NEWSET ||
+		NfMsgId(b.msgs[1].Header.Type) != NFT_MSG_NEWSETELEM || NfMsgId(b.msgs[2].Header.Type) != NFT_MSG_NEWRULE {
+		t.Fatalf("got %d messages", b.Len())
+	}
+	l, ok := r.Exprs[3].(*Lookup)
+	if !ok || l.SetId == 0 {
+		t.Errorf("lookup %#v", r.Exprs[3])
+	}
+	s, err := SetfromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWSET), NFPROTO_IPV4, mustParse(t, b.msgs[0]).Attrs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Table != "filter" || s.Id != l.SetId {
+		t.Errorf("set %+v", s)
+	}
+}
+
+func mustParse(t *testing.T, msg *netlink.NetlinkMessage) *NfMessage {
+	t.Helper()
+	m, err := ParseNfMessage(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestCompileErrors(t *testing.T) {
+	for _, text := range []string{
+		"tcp dport",
+		"tcp port 22",
+		"foo",
+		"ip saddr 10.0.0.0/33",
+		"ip saddr ::1",
+		"ip saddr 10.0.0.2-10.0.0.1",
+		"meta mark 1-2",
+		/* host order values can not be ordered by cmp */
+		"meta mark > 0x10",
+		"ct mark < 256",
+		"meta skuid >= 1000",
+		"tcp dport != 1-2",
+		"tcp dport { 22, 80",
+		"tcp dport 22 }",
+		`iifname "eth0`,
+		`iifname "abcdefghijklmnopq"`,
+		"tcp dport set 22",
+		"tcp dport < @ports",
+		"jump",
+		"add seen { ip saddr }",
+		"add @seen { ip saddr, ip daddr }",
+		"counter packets x",
+		"@xh,0,8 1",
+		"@th,4,8 1",
+		"tcp flags foo",
+		"ip protocol tcp,udp",
+		"meta mark & 0xff { 1, 2 }",
+		"meta mark & 0xff @marks",
+		"tcp dport & 0xff00 1-2",
+		"meta mark & foo 1",
+	} {
+		if _, _, err := CompileRule(NFPROTO_IPV4, text); err == nil {
+			t.Errorf("%q compiled", text)
+		}
+	}
+}
+
+func TestDecompile(t *testing.T) {
+	/* without their dependency fields are written by position */
+	exprs := []Expr{
+		&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 2, Len: 2, Dreg: NFT_REG_1},
+		&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{0, 22}},
+	}
+	if got := DecompileRule(NFPROTO_IPV4, exprs, nil); got != "@th,16,16 0x0016" {
+		t.Errorf("got %q", got)
+	}
+
+	/* the dependency of udp tells the port apart from a tcp one */
+	exprs = append([]Expr{
+		&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+		&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_UDP}},
+	}, exprs...)
+	if got := DecompileRule(NFPROTO_IPV4, exprs, nil); got != "udp dport 22" {
+		t.Errorf("got %q", got)
+	}
+
+	/* a match standing alone is kept */
+	exprs = exprs[:2]
+	if got := DecompileRule(NFPROTO_IPV4, exprs, nil); got != "meta l4proto udp" {
+		t.Errorf("got %q", got)
+	}
+
+	tests := []struct {
+		exprs []Expr
+		want  string
+	}{
+		{[]Expr{
+			&Meta{Key: NFT_META_MARK, Dreg: NFT_REG_1},
+			&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: 4, Mask: netlink.NewAttrUint32(0, 0xff).Data, Xor: make([]byte, 4)},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: netlink.NewAttrUint32(0, 1).Data},
+		}, "meta mark & 0x000000ff == 0x00000001"},
+		{[]Expr{
+			&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 12, Len: 4, Dreg: NFT_REG_1},
+			&Lookup{SetName: "map", Sreg: NFT_REG_1, Dreg: NFT_REG_VERDICT, HasDreg: true},
+		}, "ip saddr [lookup]"},
+		{[]Expr{
+			&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 12, Len: 4, Dreg: NFT_REG_1},
+			&Lookup{SetName: "__set0", Sreg: NFT_REG_1},
+		}, "ip saddr @__set0"},
+		{[]Expr{
+			&Meta{Key: NFT_META_MARK, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_GT, Sreg: NFT_REG_1, Data: netlink.NewAttrUint32(0, 0x10).Data},
+		}, "meta mark [cmp]"},
+		{[]Expr{&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{1}}}, "[cmp]"},
+		{[]Expr{&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Len: 1, Sreg: NFT_REG_1}}, "[payload]"},
+		{[]Expr{&Verdict{Code: 5}}, "[verdict 5]"},
+		{[]Expr{&GenericExpr{ExprName: "log"}, &Verdict{Code: NF_DROP}}, "[log] drop"},
+	}
+	for _, test := range tests {
+		if got := DecompileRule(NFPROTO_IPV4, test.exprs, nil); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+
+	/* interval ends are joined into ranges and prefixes */
+	elems := map[string][]*SetElem{"__set0": {
+		{Key: []byte{192, 0, 2, 1}},
+		{Key: []byte{192, 0, 2, 2}, Flags: NFT_SET_ELEM_INTERVAL_END},
+		{Key: []byte{10, 0, 0, 0}},
+		{Key: []byte{10, 0, 0, 10}, Flags: NFT_SET_ELEM_INTERVAL_END},
+		{Key: []byte{0, 0, 0, 0}, Flags: NFT_SET_ELEM_INTERVAL_END},
+		{Key: []byte{224, 0, 0, 0}},
+	}}
+	exprs = []Expr{
+		&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 16, Len: 4, Dreg: NFT_REG_1},
+		&Lookup{SetName: "__set0", Sreg: NFT_REG_1},
+	}
+	want := "ip daddr { 10.0.0.0-10.0.0.9, 192.0.2.1, 224.0.0.0/3 }"
+	if got := DecompileRule(NFPROTO_IPV4, exprs, elems); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRuleText(t *testing.T) {
+	nfl := testNetns(t)
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_INET, Name: "filter"})
+	b.AddChain(&Chain{Family: NFPROTO_INET, Table: "filter", Name: "input", Hook: &ChainHook{Hooknum: NF_INET_LOCAL_IN}})
+	b.AddChain(&Chain{Family: NFPROTO_INET, Table: "filter", Name: "other"})
+	b.AddSet(&Set{Family: NFPROTO_INET, Table: "filter", Name: "seen", KeyType: NFT_TYPE_IPADDR, KeyLen: 4,
+		Flags: NFT_SET_EVAL})
+	texts := []string{
+		"ip saddr 10.0.0.0/8 tcp dport { 22, 443 } counter packets 0 bytes 0 accept",
+		"ip6 daddr != { ::1, 2001:db8::/32 } udp dport 53-54 drop",
+		"tcp flags syn,ack ct state established,related jump other",
+		"tcp flags == syn meta mark set 0x00000010",
+		`iifname "veth*" add @seen { ip saddr }`,
+		"meta mark & 0x0000ff00 == 0x00000100 ip saddr & 255.0.0.255 != 10.0.0.1 drop",
+	}
+	for _, text := range texts {
+		err := b.AddRuleText(&Rule{Family: NFPROTO_INET, Table: "filter", Chain: "input"}, text)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := nfl.GetRuleset(NFPROTO_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Rules) != len(texts) || len(rs.Sets) != len(rs.Elems) {
+		t.Fatalf("got %d rules and %d sets", len(rs.Rules), len(rs.Sets))
+	}
+	for i, r := range rs.Rules {
+		if got := rs.RuleText(r); got != texts[i] {
+			t.Errorf("got %q, want %q", got, texts[i])
+		}
+	}
+}
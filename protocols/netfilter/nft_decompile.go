@@ -0,0 +1,360 @@
+package netfilter
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var dynsetOps = []string{
+	NFT_DYNSET_OP_ADD:    "add",
+	NFT_DYNSET_OP_UPDATE: "update",
+	NFT_DYNSET_OP_DELETE: "delete",
+}
+
+// statement is a decompiled part of a rule, with the dependency it needs
+// and, for equality matches, the dependency it fulfils.
+type statement struct {
+	text     string
+	requires string
+	provides string
+}
+
+type decompiler struct {
+	family uint8
+	sets   map[string][]*SetElem
+	out    []statement
+	deps   map[string]bool
+	cur    *nftField
+	mask   []byte
+}
+
+// DecompileRule writes the expressions of a rule in the nft(8) syntax
+// accepted by CompileRule, leaving out the protocol dependencies it adds.
+// Anonymous sets are written as set literals when their elements are found
+// in sets, keyed by set name, and by name otherwise. Expressions that have
+// no text form are written as their name in brackets.
+func DecompileRule(family uint8, exprs []Expr, sets map[string][]*SetElem) string {
+	d := &decompiler{
+		family: family,
+		sets:   sets,
+		deps:   map[string]bool{},
+	}
+
+	for i := 0; i < len(exprs); i++ {
+		i += d.expr(exprs[i], exprs[i+1:])
+	}
+
+	words := []string{}
+	for i, st := range d.out {
+		if st.provides != "" && i+1 < len(d.out) && d.out[i+1].requires == st.provides {
+			continue
+		}
+		words = append(words, st.text)
+	}
+	return strings.Join(words, " ")
+}
+
+func (d *decompiler) emit(text string) {
+	d.out = append(d.out, statement{text: text})
+}
+
+func (d *decompiler) unknown(e Expr) {
+	d.emit("[" + e.Name() + "]")
+	d.cur = nil
+}
+
+func metaField(kind int, key uint32) *nftField {
+	for _, f := range nftFields {
+		if f.kind == kind && f.key == key {
+			return f
+		}
+	}
+	return nil
+}
+
+// payloadField finds the field loaded by e. Named fields need their
+// dependency to be matched before, which also tells apart fields of
+// different protocols at the same offset, such as tcp and udp ports.
+func (d *decompiler) payloadField(e *Payload) *nftField {
+	for _, f := range nftFields {
+		if f.kind != fieldPayload || f.base != e.Base || f.off != e.Offset || uint32(f.typ.len) != e.Len {
+			continue
+		}
+		if dep := f.dependency(d.family); dep == "" || d.deps[dep] {
+			return f
+		}
+	}
+	return rawField(e.Base, e.Offset, e.Len)
+}
+
+// expr decompiles e, looking ahead at the expressions following it, and
+// returns how many of them it consumed.
+func (d *decompiler) expr(e Expr, rest []Expr) int {
+	switch e := e.(type) {
+	case *Meta:
+		if e.Sreg != 0 {
+			d.unknown(e)
+			return 0
+		}
+		d.load(metaField(fieldMeta, e.Key), e)
+	case *Ct:
+		if e.Sreg != 0 {
+			d.unknown(e)
+			return 0
+		}
+		d.load(metaField(fieldCt, e.Key), e)
+	case *Payload:
+		if e.Sreg != 0 {
+			d.unknown(e)
+			return 0
+		}
+		d.load(d.payloadField(e), e)
+	case *Bitwise:
+		if d.cur == nil || e.Op != NFT_BITWISE_BOOL || !isZero(e.Xor) {
+			d.unknown(e)
+			return 0
+		}
+		d.mask = e.Mask
+	case *Cmp:
+		if d.cur == nil || d.cur.typ.host && e.Op != NFT_CMP_EQ && e.Op != NFT_CMP_NEQ {
+			d.unknown(e)
+			return 0
+		}
+		if len(rest) > 0 && e.Op == NFT_CMP_GTE && d.mask == nil {
+			if next, ok := rest[0].(*Cmp); ok && next.Op == NFT_CMP_LTE && next.Sreg == e.Sreg {
+				d.match("", formatRange(d.cur.typ, e.Data, next.Data), false)
+				return 1
+			}
+		}
+		d.cmp(e)
+	case *Lookup:
+		if d.cur == nil || e.HasDreg {
+			d.unknown(e)
+			return 0
+		}
+		op := ""
+		if e.Invert {
+			op = "!="
+		}
+		d.match(op, d.setText(e.SetName), false)
+	case *Immediate:
+		if len(rest) > 0 {
+			f := (*nftField)(nil)
+			switch next := rest[0].(type) {
+			case *Meta:
+				if next.Sreg == e.Dreg {
+					f = metaField(fieldMeta, next.Key)
+				}
+			case *Ct:
+				if next.Sreg == e.Dreg {
+					f = metaField(fieldCt, next.Key)
+				}
+			}
+			if f != nil {
+				d.emit(f.String() + " set " + f.typ.format(f.typ, e.Data))
+				return 1
+			}
+		}
+		d.unknown(e)
+	case *Counter:
+		d.emit(fmt.Sprintf("counter packets %d bytes %d", e.Packets, e.Bytes))
+	case *Verdict:
+		text := verdictNames[e.Code]
+		if text == "" {
+			text = fmt.Sprintf("[verdict %d]", e.Code)
+		}
+		if e.Chain != "" {
+			text += " " + e.Chain
+		}
+		d.emit(text)
+	case *Dynset:
+		if d.cur == nil || d.mask != nil || int(e.Op) >= len(dynsetOps) ||
+			e.SregData != 0 || e.Timeout != 0 || e.Invert {
+			d.unknown(e)
+			return 0
+		}
+		st := &d.out[len(d.out)-1]
+		st.text = fmt.Sprintf("%s @%s { %s }", dynsetOps[e.Op], e.SetName, d.cur)
+		d.cur = nil
+		d.mask = nil
+	default:
+		d.unknown(e)
+	}
+	return 0
+}
+
+// load starts a match on f. The loaded field is kept as a statement of its
+// own until the match is complete, for expressions such as dynset that use
+// it without comparing it.
+func (d *decompiler) load(f *nftField, e Expr) {
+	if f == nil {
+		d.unknown(e)
+		return
+	}
+	d.cur = f
+	d.mask = nil
+	d.out = append(d.out, statement{text: f.String(), requires: f.dependency(d.family)})
+}
+
+func (d *decompiler) match(op, value string, provides bool) {
+	st := &d.out[len(d.out)-1]
+	if op != "" {
+		st.text += " " + op
+	}
+	st.text += " " + value
+	if provides {
+		st.provides = st.text
+		d.deps[st.text] = true
+	}
+	d.cur = nil
+	d.mask = nil
+}
+
+func (d *decompiler) cmp(e *Cmp) {
+	t := d.cur.typ
+
+	op := ""
+	for name, o := range cmpOps {
+		if o == e.Op && name != "==" {
+			op = name
+		}
+	}
+
+	if d.mask == nil {
+		if t.bitmask && e.Op == NFT_CMP_EQ {
+			/* without an operator it would match any of the bits */
+			op = "=="
+		}
+		d.match(op, t.format(t, e.Data), e.Op == NFT_CMP_EQ)
+		return
+	}
+
+	if t.bitmask && isZero(e.Data) && e.Op == NFT_CMP_NEQ {
+		d.match("", t.format(t, d.mask), false)
+		return
+	}
+
+	if n := prefixLen(d.mask); t.prefix && n >= 0 {
+		d.match(op, fmt.Sprintf("%s/%d", t.format(t, e.Data), n), false)
+		return
+	}
+
+	if op == "" {
+		op = "=="
+	}
+	d.out[len(d.out)-1].text += " & " + t.format(t, d.mask)
+	d.match(op, t.format(t, e.Data), false)
+}
+
+// setText writes the elements of an anonymous set, or the name of any other
+// set.
+func (d *decompiler) setText(name string) string {
+	elems, ok := d.sets[name]
+	if !ok || !strings.HasPrefix(name, "__set") {
+		return "@" + name
+	}
+	return "{ " + strings.Join(formatElems(d.cur.typ, elems), ", ") + " }"
+}
+
+// formatElems writes the keys of set elements, joining the start and end
+// elements of intervals into ranges.
+func formatElems(t *nftType, elems []*SetElem) []string {
+	sorted := append([]*SetElem{}, elems...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		c := bytes.Compare(sorted[i].Key, sorted[j].Key)
+		if c == 0 {
+			return sorted[i].Flags&NFT_SET_ELEM_INTERVAL_END != 0 && sorted[j].Flags&NFT_SET_ELEM_INTERVAL_END == 0
+		}
+		return c < 0
+	})
+
+	interval := false
+	for _, e := range sorted {
+		if e.Flags&NFT_SET_ELEM_INTERVAL_END != 0 {
+			interval = true
+		}
+	}
+
+	values := []string{}
+	for i, e := range sorted {
+		switch {
+		case e.Flags&NFT_SET_ELEM_INTERVAL_END != 0:
+			continue
+		case e.KeyEnd != nil:
+			values = append(values, formatRange(t, e.Key, e.KeyEnd))
+		case i+1 < len(sorted) && sorted[i+1].Flags&NFT_SET_ELEM_INTERVAL_END != 0:
+			values = append(values, formatRange(t, e.Key, prevKey(sorted[i+1].Key)))
+		case interval:
+			/* the last range runs to the largest key */
+			values = append(values, formatRange(t, e.Key, bytes.Repeat([]byte{0xff}, len(e.Key))))
+		default:
+			values = append(values, t.format(t, e.Key))
+		}
+	}
+
+	return values
+}
+
+// formatRange writes the range from start to end, as a single value or a
+// prefix when it is one.
+func formatRange(t *nftType, start, end []byte) string {
+	if bytes.Equal(start, end) {
+		return t.format(t, start)
+	}
+
+	if t.prefix && len(start) == len(end) {
+		for n := 0; n <= len(start)*8; n++ {
+			mask := prefixMask(len(start), n)
+			match := true
+			for i := range start {
+				if start[i]&^mask[i] != 0 || end[i] != start[i]|^mask[i] {
+					match = false
+				}
+			}
+			if match {
+				return fmt.Sprintf("%s/%d", t.format(t, start), n)
+			}
+		}
+	}
+
+	return t.format(t, start) + "-" + t.format(t, end)
+}
+
+func prevKey(key []byte) []byte {
+	prev := append([]byte{}, key...)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
+
+// prefixLen returns the length of a prefix mask, or -1 if mask is not one.
+func prefixLen(mask []byte) int {
+	n := 0
+	for _, b := range mask {
+		for bit := 7; bit >= 0; bit-- {
+			if b&(1<<uint(bit)) == 0 {
+				if !bytes.Equal(mask, prefixMask(len(mask), n)) {
+					return -1
+				}
+				return n
+			}
+			n++
+		}
+	}
+	return n
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
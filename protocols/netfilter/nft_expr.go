@@ -0,0 +1,652 @@
+package netfilter
+
+import (
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+// Expr is an nftables expression. Options returns the attributes nested
+// in NFTA_EXPR_DATA and ParseOptions decodes them.
+type Expr interface {
+	Name() string
+	Options() []netlink.NetlinkAttr
+	ParseOptions(attrs []netlink.NetlinkAttr) error
+}
+
+// GenericExpr keeps the raw attributes of expressions without typed
+// support.
+type GenericExpr struct {
+	ExprName string
+	Attrs    []netlink.NetlinkAttr
+}
+
+// Meta loads packet metadata, one of NFT_META_*, into Dreg, or sets it
+// from Sreg when Sreg is not 0.
+type Meta struct {
+	Key  uint32
+	Dreg uint32
+	Sreg uint32
+}
+
+// Payload loads Len bytes at Offset from the header given by Base, one of
+// NFT_PAYLOAD_*_HEADER, into Dreg. With Sreg set it writes them instead,
+// fixing up the checksum given by CsumType at CsumOffset.
+type Payload struct {
+	Base       uint32
+	Offset     uint32
+	Len        uint32
+	Dreg       uint32
+	Sreg       uint32
+	CsumType   uint32
+	CsumOffset uint32
+	CsumFlags  uint32
+}
+
+// Cmp compares Sreg with Data, which is in the byte order of the loaded
+// value: network order for payload, host order for most metadata.
+type Cmp struct {
+	Op   uint32
+	Sreg uint32
+	Data []byte
+}
+
+// Bitwise computes Dreg = (Sreg & Mask) ^ Xor over Len bytes. With Op
+// NFT_BITWISE_LSHIFT or NFT_BITWISE_RSHIFT it shifts Sreg by Shift bits
+// instead.
+type Bitwise struct {
+	Sreg  uint32
+	Dreg  uint32
+	Len   uint32
+	Op    uint32
+	Mask  []byte
+	Xor   []byte
+	Shift uint32
+}
+
+// Immediate loads Data into Dreg.
+type Immediate struct {
+	Dreg uint32
+	Data []byte
+}
+
+// Verdict ends the evaluation of the rule with Code, one of NF_ACCEPT,
+// NF_DROP or NFT_*. Chain is the target of NFT_JUMP and NFT_GOTO. On the
+// wire it is an immediate expression loading the verdict register.
+type Verdict struct {
+	Code  int32
+	Chain string
+}
+
+// Counter counts the packets and bytes reaching it.
+type Counter struct {
+	Bytes   uint64
+	Packets uint64
+}
+
+// Ct loads conntrack data, one of NFT_CT_*, into Dreg, or sets it from
+// Sreg when Sreg is not 0. Direction selects the tuple for keys that
+// depend on it.
+type Ct struct {
+	Key          uint32
+	Dreg         uint32
+	Sreg         uint32
+	Direction    uint8
+	HasDirection bool
+}
+
+// Lookup matches Sreg against the elements of a set, named or given by the
+// id of a set created in the same batch. With HasDreg set, the value of a
+// map element is loaded into Dreg, which is NFT_REG_VERDICT for verdict
+// maps.
+type Lookup struct {
+	SetName string
+	SetId   uint32
+	Sreg    uint32
+	Dreg    uint32
+	HasDreg bool
+	Invert  bool
+}
+
+// Dynset adds, updates or deletes, as given by Op, the element keyed by
+// SregKey in a set from the packet path. Sets updated this way need the
+// NFT_SET_EVAL flag.
+type Dynset struct {
+	SetName  string
+	SetId    uint32
+	Op       uint32
+	SregKey  uint32
+	SregData uint32
+	Timeout  time.Duration
+	Invert   bool
+}
+
+var exprKinds = map[string]func() Expr{
+	"meta":      func() Expr { return &Meta{} },
+	"payload":   func() Expr { return &Payload{} },
+	"cmp":       func() Expr { return &Cmp{} },
+	"immediate": func() Expr { return &Immediate{} },
+	"bitwise":   func() Expr { return &Bitwise{} },
+	"counter":   func() Expr { return &Counter{} },
+	"ct":        func() Expr { return &Ct{} },
+	"lookup":    func() Expr { return &Lookup{} },
+	"dynset":    func() Expr { return &Dynset{} },
+}
+
+// ExprfromAttrs decodes an expression from the attributes of an
+// NFTA_LIST_ELEM.
+func ExprfromAttrs(attrs []netlink.NetlinkAttr) (Expr, error) {
+	var name string
+	var data []netlink.NetlinkAttr
+	var err error
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_EXPR_NAME:
+			name = attr.String()
+		case NFTA_EXPR_DATA:
+			data, err = attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	newExpr, ok := exprKinds[name]
+	if !ok {
+		return &GenericExpr{ExprName: name, Attrs: data}, nil
+	}
+
+	e := newExpr()
+	err = e.ParseOptions(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if imm, ok := e.(*Immediate); ok && imm.Dreg == NFT_REG_VERDICT {
+		v := &Verdict{}
+		err = v.ParseOptions(data)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+
+	return e, nil
+}
+
+// ExprsfromAttr decodes an expression list, such as NFTA_RULE_EXPRESSIONS.
+func ExprsfromAttr(attr *netlink.NetlinkAttr) ([]Expr, error) {
+	elems, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []Expr{}
+
+	for _, elem := range elems {
+		if elem.AttrType() != NFTA_LIST_ELEM {
+			continue
+		}
+		attrs, err := elem.Nested()
+		if err != nil {
+			return nil, err
+		}
+		e, err := ExprfromAttrs(attrs)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, e)
+	}
+
+	return ret, nil
+}
+
+func exprAttrs(e Expr) []netlink.NetlinkAttr {
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_EXPR_NAME, e.Name()),
+		netlink.NewAttrNested(NFTA_EXPR_DATA, e.Options()),
+	}
+}
+
+func exprsAttr(attrtype uint16, exprs []Expr) netlink.NetlinkAttr {
+	elems := []netlink.NetlinkAttr{}
+	for _, e := range exprs {
+		elems = append(elems, netlink.NewAttrNested(NFTA_LIST_ELEM, exprAttrs(e)))
+	}
+	return netlink.NewAttrNested(attrtype, elems)
+}
+
+func dataValueAttr(attrtype uint16, data []byte) netlink.NetlinkAttr {
+	return netlink.NewAttrNested(attrtype, []netlink.NetlinkAttr{
+		netlink.NewAttr(NFTA_DATA_VALUE, data),
+	})
+}
+
+func dataValue(attr *netlink.NetlinkAttr) ([]byte, error) {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attrs {
+		if a.AttrType() == NFTA_DATA_VALUE {
+			return a.Data, nil
+		}
+	}
+	return nil, nil
+}
+
+func (e *GenericExpr) Name() string {
+	return e.ExprName
+}
+
+func (e *GenericExpr) Options() []netlink.NetlinkAttr {
+	return e.Attrs
+}
+
+func (e *GenericExpr) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	e.Attrs = attrs
+	return nil
+}
+
+func (e *Meta) Name() string {
+	return "meta"
+}
+
+func (e *Meta) Options() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_META_KEY, e.Key),
+	}
+	if e.Sreg != 0 {
+		return append(attrs, netlink.NewAttrNetUint32(NFTA_META_SREG, e.Sreg))
+	}
+	return append(attrs, netlink.NewAttrNetUint32(NFTA_META_DREG, e.Dreg))
+}
+
+func (e *Meta) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_META_KEY:
+			e.Key = attr.NetUint32()
+		case NFTA_META_DREG:
+			e.Dreg = attr.NetUint32()
+		case NFTA_META_SREG:
+			e.Sreg = attr.NetUint32()
+		}
+	}
+	return nil
+}
+
+func (e *Payload) Name() string {
+	return "payload"
+}
+
+func (e *Payload) Options() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_PAYLOAD_BASE, e.Base),
+		netlink.NewAttrNetUint32(NFTA_PAYLOAD_OFFSET, e.Offset),
+		netlink.NewAttrNetUint32(NFTA_PAYLOAD_LEN, e.Len),
+	}
+	if e.Sreg != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_PAYLOAD_SREG, e.Sreg))
+		if e.CsumType != NFT_PAYLOAD_CSUM_NONE {
+			attrs = append(attrs,
+				netlink.NewAttrNetUint32(NFTA_PAYLOAD_CSUM_TYPE, e.CsumType),
+				netlink.NewAttrNetUint32(NFTA_PAYLOAD_CSUM_OFFSET, e.CsumOffset))
+		}
+		if e.CsumFlags != 0 {
+			attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_PAYLOAD_CSUM_FLAGS, e.CsumFlags))
+		}
+		return attrs
+	}
+	return append(attrs, netlink.NewAttrNetUint32(NFTA_PAYLOAD_DREG, e.Dreg))
+}
+
+func (e *Payload) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_PAYLOAD_BASE:
+			e.Base = attr.NetUint32()
+		case NFTA_PAYLOAD_OFFSET:
+			e.Offset = attr.NetUint32()
+		case NFTA_PAYLOAD_LEN:
+			e.Len = attr.NetUint32()
+		case NFTA_PAYLOAD_DREG:
+			e.Dreg = attr.NetUint32()
+		case NFTA_PAYLOAD_SREG:
+			e.Sreg = attr.NetUint32()
+		case NFTA_PAYLOAD_CSUM_TYPE:
+			e.CsumType = attr.NetUint32()
+		case NFTA_PAYLOAD_CSUM_OFFSET:
+			e.CsumOffset = attr.NetUint32()
+		case NFTA_PAYLOAD_CSUM_FLAGS:
+			e.CsumFlags = attr.NetUint32()
+		}
+	}
+	return nil
+}
+
+func (e *Cmp) Name() string {
+	return "cmp"
+}
+
+func (e *Cmp) Options() []netlink.NetlinkAttr {
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_CMP_SREG, e.Sreg),
+		netlink.NewAttrNetUint32(NFTA_CMP_OP, e.Op),
+		dataValueAttr(NFTA_CMP_DATA, e.Data),
+	}
+}
+
+func (e *Cmp) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	var err error
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_CMP_SREG:
+			e.Sreg = attr.NetUint32()
+		case NFTA_CMP_OP:
+			e.Op = attr.NetUint32()
+		case NFTA_CMP_DATA:
+			e.Data, err = dataValue(&attr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Bitwise) Name() string {
+	return "bitwise"
+}
+
+func (e *Bitwise) Options() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_BITWISE_SREG, e.Sreg),
+		netlink.NewAttrNetUint32(NFTA_BITWISE_DREG, e.Dreg),
+		netlink.NewAttrNetUint32(NFTA_BITWISE_LEN, e.Len),
+	}
+	if e.Op != NFT_BITWISE_BOOL {
+		/* the shift is in host byte order */
+		shift := netlink.NewAttrUint32(NFTA_DATA_VALUE, e.Shift)
+		return append(attrs,
+			netlink.NewAttrNetUint32(NFTA_BITWISE_OP, e.Op),
+			netlink.NewAttrNested(NFTA_BITWISE_DATA, []netlink.NetlinkAttr{shift}))
+	}
+	xor := e.Xor
+	if xor == nil {
+		xor = make([]byte, len(e.Mask))
+	}
+	return append(attrs,
+		dataValueAttr(NFTA_BITWISE_MASK, e.Mask),
+		dataValueAttr(NFTA_BITWISE_XOR, xor))
+}
+
+func (e *Bitwise) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	var err error
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_BITWISE_SREG:
+			e.Sreg = attr.NetUint32()
+		case NFTA_BITWISE_DREG:
+			e.Dreg = attr.NetUint32()
+		case NFTA_BITWISE_LEN:
+			e.Len = attr.NetUint32()
+		case NFTA_BITWISE_OP:
+			e.Op = attr.NetUint32()
+		case NFTA_BITWISE_MASK:
+			e.Mask, err = dataValue(&attr)
+		case NFTA_BITWISE_XOR:
+			e.Xor, err = dataValue(&attr)
+		case NFTA_BITWISE_DATA:
+			var shift []byte
+			shift, err = dataValue(&attr)
+			if len(shift) == 4 {
+				e.Shift = (&netlink.NetlinkAttr{Data: shift}).Uint32()
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Immediate) Name() string {
+	return "immediate"
+}
+
+func (e *Immediate) Options() []netlink.NetlinkAttr {
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_IMMEDIATE_DREG, e.Dreg),
+		dataValueAttr(NFTA_IMMEDIATE_DATA, e.Data),
+	}
+}
+
+func (e *Immediate) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	var err error
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_IMMEDIATE_DREG:
+			e.Dreg = attr.NetUint32()
+		case NFTA_IMMEDIATE_DATA:
+			e.Data, err = dataValue(&attr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Verdict) Name() string {
+	return "immediate"
+}
+
+func (e *Verdict) verdictAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_VERDICT_CODE, uint32(e.Code)),
+	}
+	if e.Chain != "" {
+		attrs = append(attrs, netlink.NewAttrString(NFTA_VERDICT_CHAIN, e.Chain))
+	}
+	return attrs
+}
+
+func (e *Verdict) Options() []netlink.NetlinkAttr {
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_IMMEDIATE_DREG, NFT_REG_VERDICT),
+		netlink.NewAttrNested(NFTA_IMMEDIATE_DATA, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(NFTA_DATA_VERDICT, e.verdictAttrs()),
+		}),
+	}
+}
+
+// VerdictfromAttr decodes an NFTA_DATA_VERDICT attribute.
+func VerdictfromAttr(attr *netlink.NetlinkAttr) (*Verdict, error) {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+	v := &Verdict{}
+	for _, a := range attrs {
+		switch a.AttrType() {
+		case NFTA_VERDICT_CODE:
+			v.Code = int32(a.NetUint32())
+		case NFTA_VERDICT_CHAIN:
+			v.Chain = a.String()
+		}
+	}
+	return v, nil
+}
+
+func (e *Verdict) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		if attr.AttrType() != NFTA_IMMEDIATE_DATA {
+			continue
+		}
+		dattrs, err := attr.Nested()
+		if err != nil {
+			return err
+		}
+		for _, dattr := range dattrs {
+			if dattr.AttrType() == NFTA_DATA_VERDICT {
+				v, err := VerdictfromAttr(&dattr)
+				if err != nil {
+					return err
+				}
+				*e = *v
+			}
+		}
+	}
+	return nil
+}
+
+func (e *Counter) Name() string {
+	return "counter"
+}
+
+func (e *Counter) Options() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+	if e.Bytes != 0 || e.Packets != 0 {
+		attrs = append(attrs,
+			netlink.NewAttrNetUint64(NFTA_COUNTER_BYTES, e.Bytes),
+			netlink.NewAttrNetUint64(NFTA_COUNTER_PACKETS, e.Packets))
+	}
+	return attrs
+}
+
+func (e *Counter) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_COUNTER_BYTES:
+			e.Bytes = attr.NetUint64()
+		case NFTA_COUNTER_PACKETS:
+			e.Packets = attr.NetUint64()
+		}
+	}
+	return nil
+}
+
+func (e *Ct) Name() string {
+	return "ct"
+}
+
+func (e *Ct) Options() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_CT_KEY, e.Key),
+	}
+	if e.Sreg != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_CT_SREG, e.Sreg))
+	} else {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_CT_DREG, e.Dreg))
+	}
+	if e.HasDirection {
+		attrs = append(attrs, netlink.NewAttrUint8(NFTA_CT_DIRECTION, e.Direction))
+	}
+	return attrs
+}
+
+func (e *Ct) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_CT_KEY:
+			e.Key = attr.NetUint32()
+		case NFTA_CT_DREG:
+			e.Dreg = attr.NetUint32()
+		case NFTA_CT_SREG:
+			e.Sreg = attr.NetUint32()
+		case NFTA_CT_DIRECTION:
+			e.Direction = attr.Uint8()
+			e.HasDirection = true
+		}
+	}
+	return nil
+}
+
+func (e *Lookup) Name() string {
+	return "lookup"
+}
+
+func (e *Lookup) Options() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_LOOKUP_SET, e.SetName),
+		netlink.NewAttrNetUint32(NFTA_LOOKUP_SREG, e.Sreg),
+	}
+	if e.SetId != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_LOOKUP_SET_ID, e.SetId))
+	}
+	if e.HasDreg {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_LOOKUP_DREG, e.Dreg))
+	}
+	if e.Invert {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_LOOKUP_FLAGS, NFT_LOOKUP_F_INV))
+	}
+	return attrs
+}
+
+func (e *Lookup) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_LOOKUP_SET:
+			e.SetName = attr.String()
+		case NFTA_LOOKUP_SET_ID:
+			e.SetId = attr.NetUint32()
+		case NFTA_LOOKUP_SREG:
+			e.Sreg = attr.NetUint32()
+		case NFTA_LOOKUP_DREG:
+			e.Dreg = attr.NetUint32()
+			e.HasDreg = true
+		case NFTA_LOOKUP_FLAGS:
+			e.Invert = attr.NetUint32()&NFT_LOOKUP_F_INV != 0
+		}
+	}
+	return nil
+}
+
+func (e *Dynset) Name() string {
+	return "dynset"
+}
+
+func (e *Dynset) Options() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_DYNSET_SET_NAME, e.SetName),
+		netlink.NewAttrNetUint32(NFTA_DYNSET_OP, e.Op),
+		netlink.NewAttrNetUint32(NFTA_DYNSET_SREG_KEY, e.SregKey),
+	}
+	if e.SetId != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_DYNSET_SET_ID, e.SetId))
+	}
+	if e.SregData != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_DYNSET_SREG_DATA, e.SregData))
+	}
+	if e.Timeout != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint64(NFTA_DYNSET_TIMEOUT, uint64(e.Timeout/time.Millisecond)))
+	}
+	if e.Invert {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_DYNSET_FLAGS, NFT_DYNSET_F_INV))
+	}
+	return attrs
+}
+
+func (e *Dynset) ParseOptions(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_DYNSET_SET_NAME:
+			e.SetName = attr.String()
+		case NFTA_DYNSET_SET_ID:
+			e.SetId = attr.NetUint32()
+		case NFTA_DYNSET_OP:
+			e.Op = attr.NetUint32()
+		case NFTA_DYNSET_SREG_KEY:
+			e.SregKey = attr.NetUint32()
+		case NFTA_DYNSET_SREG_DATA:
+			e.SregData = attr.NetUint32()
+		case NFTA_DYNSET_TIMEOUT:
+			e.Timeout = time.Duration(attr.NetUint64()) * time.Millisecond
+		case NFTA_DYNSET_FLAGS:
+			e.Invert = attr.NetUint32()&NFT_DYNSET_F_INV != 0
+		}
+	}
+	return nil
+}
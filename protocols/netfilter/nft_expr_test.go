@@ -0,0 +1,157 @@
+package netfilter
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+// exprRoundTrip encodes exprs in an expression list and decodes them back.
+func exprRoundTrip(t *testing.T, exprs ...Expr) []Expr {
+	t.Helper()
+	attr := exprsAttr(NFTA_RULE_EXPRESSIONS, exprs)
+	got, err := ExprsfromAttr(&attr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(exprs) {
+		t.Fatalf("got %d expressions, want %d", len(got), len(exprs))
+	}
+	return got
+}
+
+func TestExprs(t *testing.T) {
+	exprs := []Expr{
+		&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+		&Meta{Key: NFT_META_MARK, Sreg: NFT_REG_1},
+		&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 12, Len: 4, Dreg: NFT_REG_1},
+		&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 2, Len: 2, Sreg: NFT_REG_1,
+			CsumType: NFT_PAYLOAD_CSUM_INET, CsumOffset: 16, CsumFlags: NFT_PAYLOAD_L4CSUM_PSEUDOHDR},
+		&Cmp{Op: NFT_CMP_NEQ, Sreg: NFT_REG_1, Data: []byte{6}},
+		&Immediate{Dreg: NFT_REG_1, Data: []byte{0, 0, 0, 1}},
+		&Counter{Bytes: 100, Packets: 2},
+		&Ct{Key: NFT_CT_STATE, Dreg: NFT_REG_1},
+		&Ct{Key: NFT_CT_SRC, Dreg: NFT_REG_1, Direction: IP_CT_DIR_REPLY, HasDirection: true},
+		&Lookup{SetName: "blocked", SetId: 3, Sreg: NFT_REG_1, Invert: true},
+		&Lookup{SetName: "ports", Sreg: NFT_REG_1, Dreg: NFT_REG32_00, HasDreg: true},
+		&Verdict{Code: NF_DROP},
+		&Verdict{Code: NFT_JUMP, Chain: "other"},
+		&GenericExpr{ExprName: "log", Attrs: []netlink.NetlinkAttr{netlink.NewAttrString(2 /* NFTA_LOG_PREFIX */, "x")}},
+	}
+
+	got := exprRoundTrip(t, exprs...)
+	for i := range exprs {
+		if g, ok := got[i].(*GenericExpr); ok {
+			if g.ExprName != "log" || len(g.Attrs) != 1 || g.Attrs[0].String() != "x" {
+				t.Errorf("expression %d: got %+v", i, g)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got[i], exprs[i]) {
+			t.Errorf("expression %d: got %+v, want %+v", i, got[i], exprs[i])
+		}
+	}
+}
+
+func TestVerdictExpr(t *testing.T) {
+	/* verdicts are immediates loading the verdict register */
+	attrs := (&Verdict{Code: NF_ACCEPT}).Options()
+	if attrs[0].AttrType() != NFTA_IMMEDIATE_DREG || attrs[0].NetUint32() != NFT_REG_VERDICT {
+		t.Errorf("dreg %+v", attrs[0])
+	}
+	if (&Verdict{}).Name() != "immediate" {
+		t.Error("verdict name")
+	}
+
+	/* other immediates stay immediates */
+	got := exprRoundTrip(t, &Immediate{Dreg: NFT_REG32_00, Data: []byte{1, 2}})
+	if imm, ok := got[0].(*Immediate); !ok || imm.Dreg != NFT_REG32_00 || !bytes.Equal(imm.Data, []byte{1, 2}) {
+		t.Errorf("got %#v", got[0])
+	}
+
+	/* negative codes survive the network byte order */
+	got = exprRoundTrip(t, &Verdict{Code: NFT_RETURN})
+	if v, ok := got[0].(*Verdict); !ok || v.Code != NFT_RETURN || v.Chain != "" {
+		t.Errorf("got %#v", got[0])
+	}
+}
+
+func TestExprOptions(t *testing.T) {
+	/* a store sends no destination register */
+	attrs := (&Meta{Key: NFT_META_MARK, Sreg: NFT_REG_1}).Options()
+	if len(attrs) != 2 || attrs[1].AttrType() != NFTA_META_SREG {
+		t.Errorf("meta set %+v", attrs)
+	}
+	attrs = (&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Len: 4, Sreg: NFT_REG_1}).Options()
+	if len(attrs) != 4 || attrs[3].AttrType() != NFTA_PAYLOAD_SREG {
+		t.Errorf("payload set %+v", attrs)
+	}
+
+	/* a new counter starts from zero */
+	if attrs := (&Counter{}).Options(); len(attrs) != 0 {
+		t.Errorf("counter %+v", attrs)
+	}
+
+	/* without an id the set is looked up by name */
+	attrs = (&Lookup{SetName: "s", Sreg: NFT_REG_1}).Options()
+	if len(attrs) != 2 {
+		t.Errorf("lookup %+v", attrs)
+	}
+}
+
+func TestBitwiseExpr(t *testing.T) {
+	exprs := []Expr{
+		&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: 4, Mask: []byte{255, 255, 0, 0}, Xor: []byte{0, 0, 0, 1}},
+		&Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_2, Len: 4, Op: NFT_BITWISE_LSHIFT, Shift: 8},
+	}
+	got := exprRoundTrip(t, exprs...)
+	for i := range exprs {
+		if !reflect.DeepEqual(got[i], exprs[i]) {
+			t.Errorf("expression %d: got %+v, want %+v", i, got[i], exprs[i])
+		}
+	}
+
+	/* a missing xor leaves the masked bits alone */
+	got = exprRoundTrip(t, &Bitwise{Sreg: NFT_REG_1, Dreg: NFT_REG_1, Len: 2, Mask: []byte{0xff, 0}})
+	if b := got[0].(*Bitwise); !bytes.Equal(b.Xor, []byte{0, 0}) {
+		t.Errorf("xor % x", b.Xor)
+	}
+
+	/* unlike every other value, the shift is in host byte order */
+	attrs := (&Bitwise{Op: NFT_BITWISE_RSHIFT, Shift: 3}).Options()
+	data := attrs[len(attrs)-1]
+	if data.AttrType() != NFTA_BITWISE_DATA {
+		t.Fatalf("got %+v", attrs)
+	}
+	shift, err := dataValue(&data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(shift, netlink.NewAttrUint32(0, 3).Data) {
+		t.Errorf("shift % x", shift)
+	}
+}
+
+func TestDynsetExpr(t *testing.T) {
+	exprs := []Expr{
+		&Dynset{SetName: "seen", Op: NFT_DYNSET_OP_ADD, SregKey: NFT_REG_1},
+		&Dynset{SetName: "__set0", SetId: 2, Op: NFT_DYNSET_OP_UPDATE, SregKey: NFT_REG_1, SregData: NFT_REG_2,
+			Timeout: 30 * time.Second, Invert: true},
+	}
+	got := exprRoundTrip(t, exprs...)
+	for i := range exprs {
+		if !reflect.DeepEqual(got[i], exprs[i]) {
+			t.Errorf("expression %d: got %+v, want %+v", i, got[i], exprs[i])
+		}
+	}
+
+	/* the timeout is sent in milliseconds */
+	for _, attr := range exprs[1].Options() {
+		if attr.AttrType() == NFTA_DYNSET_TIMEOUT && attr.NetUint64() != 30000 {
+			t.Errorf("timeout %d", attr.NetUint64())
+		}
+	}
+}
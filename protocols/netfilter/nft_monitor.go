@@ -0,0 +1,122 @@
+package netfilter
+
+import (
+	"syscall"
+
+	"github.com/apuigsech/netlink"
+)
+
+// Event is a decoded nftables notification. Type is the NFT_MSG_* message
+// and the object field matching it is set. Set element events carry the
+// set, with only its family, table and name, and the elements. A
+// NFT_MSG_NEWGEN event, with Gen set, follows every committed transaction.
+type Event struct {
+	Type  uint8
+	Table *Table
+	Chain *Chain
+	Rule  *Rule
+	Set   *Set
+	Elems []*SetElem
+	Gen   *Gen
+}
+
+// Gen is the ruleset generation created by a transaction, and the process
+// that committed it.
+type Gen struct {
+	Id       uint32
+	ProcPid  uint32
+	ProcName string
+}
+
+type EventCallback func(*Event, chan error, ...interface{})
+
+// EventfromMessage decodes a notification. It returns nil for messages of
+// other subsystems and unknown types.
+func EventfromMessage(m *NfMessage) (*Event, error) {
+	if NfSubsysId(m.Type) != NFNL_SUBSYS_NFTABLES {
+		return nil, nil
+	}
+
+	e := &Event{Type: NfMsgId(m.Type)}
+
+	var err error
+
+	switch e.Type {
+	case NFT_MSG_NEWTABLE, NFT_MSG_DELTABLE:
+		e.Table, err = TablefromMessage(m)
+	case NFT_MSG_NEWCHAIN, NFT_MSG_DELCHAIN:
+		e.Chain, err = ChainfromMessage(m)
+	case NFT_MSG_NEWRULE, NFT_MSG_DELRULE:
+		e.Rule, err = RulefromMessage(m)
+	case NFT_MSG_NEWSET, NFT_MSG_DELSET:
+		e.Set, err = SetfromMessage(m)
+	case NFT_MSG_NEWSETELEM, NFT_MSG_DELSETELEM:
+		e.Set, e.Elems, err = SetElemsfromMessage(m)
+	case NFT_MSG_NEWGEN:
+		e.Gen = GenfromMessage(m)
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+func GenfromMessage(m *NfMessage) *Gen {
+	g := &Gen{}
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFTA_GEN_ID:
+			g.Id = attr.NetUint32()
+		case NFTA_GEN_PROC_PID:
+			g.ProcPid = attr.NetUint32()
+		case NFTA_GEN_PROC_NAME:
+			g.ProcName = attr.String()
+		}
+	}
+	return g
+}
+
+// StartMonitor joins the nftables group and calls cb for every change of
+// the ruleset. The socket should not be used for requests once the monitor
+// is running.
+func (nfl *NetfilterNLSocket) StartMonitor(cb EventCallback, ec chan error, args ...interface{}) error {
+	err := nfl.AddMembership(NFNLGRP_NFTABLES)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		for {
+			msgList, err := nfl.RecvMessages(netlink.RECV_BUFFER_SIZE, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			for _, m := range msgList {
+				e, err := EventfromMessage(m)
+				if err != nil {
+					if ec != nil {
+						ec <- err
+					}
+					continue
+				}
+				if e == nil {
+					continue
+				}
+				cb(e, ec, args...)
+			}
+		}
+	}()
+
+	return nil
+}
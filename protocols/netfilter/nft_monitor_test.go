@@ -0,0 +1,126 @@
+package netfilter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestEventfromMessage(t *testing.T) {
+	e, err := EventfromMessage(testMessage(t, nftMsgType(NFT_MSG_DELCHAIN), NFPROTO_INET,
+		(&Chain{Table: "filter", Name: "input"}).toAttrs()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != NFT_MSG_DELCHAIN || e.Chain == nil || e.Chain.Name != "input" || e.Table != nil {
+		t.Errorf("got %+v", e)
+	}
+
+	e, err = EventfromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWGEN), NFPROTO_UNSPEC, []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_GEN_ID, 7),
+		netlink.NewAttrNetUint32(NFTA_GEN_PROC_PID, 100),
+		netlink.NewAttrString(NFTA_GEN_PROC_NAME, "nft"),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Gen == nil || *e.Gen != (Gen{Id: 7, ProcPid: 100, ProcName: "nft"}) {
+		t.Errorf("got %+v", e.Gen)
+	}
+
+	/* other subsystems and messages are ignored */
+	for _, msgtype := range []uint16{NfMsgType(NFNL_SUBSYS_CTNETLINK, 0), nftMsgType(NFT_MSG_GETTABLE)} {
+		e, err = EventfromMessage(testMessage(t, msgtype, NFPROTO_UNSPEC, nil))
+		if e != nil || err != nil {
+			t.Errorf("message %#x: got %+v, %v", msgtype, e, err)
+		}
+	}
+}
+
+func nextEvent(t *testing.T, events chan *Event, match func(*Event) bool) *Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if match(e) {
+				return e
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for an event")
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	nfl := testNetns(t)
+
+	ml, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ml.CloseLink()
+
+	events := make(chan *Event, 100)
+	cb := func(e *Event, ec chan error, args ...interface{}) {
+		events <- e
+	}
+	err = ml.StartMonitor(cb, nil)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := &Set{Family: NFPROTO_INET, Table: "filter", Name: "s", KeyType: NFT_TYPE_INET_SERVICE, KeyLen: 2}
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_INET, Name: "filter"})
+	b.AddChain(&Chain{Family: NFPROTO_INET, Table: "filter", Name: "c"})
+	b.AddSet(set)
+	b.AddSetElems(set, []SetElem{{Key: []byte{0, 22}}})
+	err = b.AddRuleText(&Rule{Family: NFPROTO_INET, Table: "filter", Chain: "c"}, "tcp dport @s accept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* the changes are notified in the order of the batch, then the generation */
+	e := nextEvent(t, events, func(e *Event) bool { return true })
+	if e.Type != NFT_MSG_NEWTABLE || e.Table == nil || e.Table.Name != "filter" || e.Table.Family != NFPROTO_INET {
+		t.Errorf("table added: %+v", e)
+	}
+	e = nextEvent(t, events, func(e *Event) bool { return true })
+	if e.Type != NFT_MSG_NEWCHAIN || e.Chain == nil || e.Chain.Name != "c" {
+		t.Errorf("chain added: %+v", e)
+	}
+	e = nextEvent(t, events, func(e *Event) bool { return true })
+	if e.Type != NFT_MSG_NEWSET || e.Set == nil || e.Set.Name != "s" {
+		t.Errorf("set added: %+v", e)
+	}
+	e = nextEvent(t, events, func(e *Event) bool { return true })
+	if e.Type != NFT_MSG_NEWSETELEM || e.Set == nil || e.Set.Name != "s" || len(e.Elems) != 1 {
+		t.Errorf("element added: %+v", e)
+	}
+	e = nextEvent(t, events, func(e *Event) bool { return true })
+	if e.Type != NFT_MSG_NEWRULE || e.Rule == nil || e.Rule.Chain != "c" || e.Rule.Handle == 0 {
+		t.Errorf("rule added: %+v", e)
+	} else if text := DecompileRule(NFPROTO_INET, e.Rule.Exprs, nil); text != "tcp dport @s accept" {
+		t.Errorf("rule added: %q", text)
+	}
+	e = nextEvent(t, events, func(e *Event) bool { return true })
+	if e.Type != NFT_MSG_NEWGEN || e.Gen == nil || e.Gen.Id == 0 {
+		t.Errorf("generation: %+v", e)
+	}
+
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.DelTable(&Table{Family: NFPROTO_INET, Name: "filter"})
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, events, func(e *Event) bool { return e.Type == NFT_MSG_DELTABLE && e.Table.Name == "filter" })
+}
@@ -0,0 +1,261 @@
+package netfilter
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// Ruleset is a snapshot of the nftables objects of a family. Elems holds
+// the elements of every set, in the order of Sets.
+type Ruleset struct {
+	Tables []*Table
+	Chains []*Chain
+	Sets   []*Set
+	Elems  [][]*SetElem
+	Rules  []*Rule
+}
+
+var familyNames = map[uint8]string{
+	NFPROTO_INET:   "inet",
+	NFPROTO_IPV4:   "ip",
+	NFPROTO_ARP:    "arp",
+	NFPROTO_NETDEV: "netdev",
+	NFPROTO_BRIDGE: "bridge",
+	NFPROTO_IPV6:   "ip6",
+}
+
+var hookNames = map[uint32]string{
+	NF_INET_PRE_ROUTING:  "prerouting",
+	NF_INET_LOCAL_IN:     "input",
+	NF_INET_FORWARD:      "forward",
+	NF_INET_LOCAL_OUT:    "output",
+	NF_INET_POST_ROUTING: "postrouting",
+}
+
+var setFlagNames = []struct {
+	flag uint32
+	name string
+}{
+	{NFT_SET_CONSTANT, "constant"},
+	{NFT_SET_INTERVAL, "interval"},
+	{NFT_SET_TIMEOUT, "timeout"},
+	{NFT_SET_EVAL, "dynamic"},
+}
+
+var setTypes = map[uint32]struct {
+	name string
+	typ  *nftType
+}{
+	NFT_TYPE_IPADDR:        {"ipv4_addr", ipaddrType},
+	NFT_TYPE_IP6ADDR:       {"ipv6_addr", ip6addrType},
+	NFT_TYPE_INET_SERVICE:  {"inet_service", serviceType},
+	NFT_TYPE_INET_PROTOCOL: {"inet_proto", protoType},
+	NFT_TYPE_MARK:          {"mark", markType},
+	NFT_TYPE_IFNAME:        {"ifname", ifnameType},
+	NFT_TYPE_NFPROTO:       {"nf_proto", nfprotoType},
+	NFT_TYPE_ETHERTYPE:     {"ether_type", ethertypeType},
+	NFT_TYPE_CT_STATE:      {"ct_state", ctStateType},
+	NFT_TYPE_TCP_FLAG:      {"tcp_flag", tcpFlagType},
+	NFT_TYPE_UID:           {"uid", uidType},
+}
+
+// GetRuleset dumps the tables, chains, sets with their elements and rules
+// of the given family, NFPROTO_UNSPEC for all.
+func (nfl *NetfilterNLSocket) GetRuleset(family uint8) (*Ruleset, error) {
+	rs := &Ruleset{}
+	var err error
+
+	rs.Tables, err = nfl.ListTables(family)
+	if err != nil {
+		return nil, err
+	}
+	rs.Chains, err = nfl.ListChains(family, "")
+	if err != nil {
+		return nil, err
+	}
+	rs.Sets, err = nfl.ListSets(family, "")
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range rs.Sets {
+		elems, err := nfl.ListSetElems(s)
+		if err != nil {
+			return nil, err
+		}
+		rs.Elems = append(rs.Elems, elems)
+	}
+	rs.Rules, err = nfl.ListRules(family, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	return rs, nil
+}
+
+// RuleText decompiles a rule of the ruleset, with the elements of the
+// anonymous sets it uses, see DecompileRule.
+func (rs *Ruleset) RuleText(r *Rule) string {
+	sets := map[string][]*SetElem{}
+	for i, s := range rs.Sets {
+		if s.Family == r.Family && s.Table == r.Table {
+			sets[s.Name] = rs.Elems[i]
+		}
+	}
+	return DecompileRule(r.Family, r.Exprs, sets)
+}
+
+// MarshalJSON encodes the ruleset in the layout of "nft -j list ruleset",
+// a list of objects keyed by their kind. Rules are given in text form in
+// "rule" instead of as expression lists, and anonymous sets are only found
+// inlined in them.
+func (rs *Ruleset) MarshalJSON() ([]byte, error) {
+	objs := []map[string]interface{}{}
+
+	for _, t := range rs.Tables {
+		objs = append(objs, map[string]interface{}{"table": map[string]interface{}{
+			"family": familyNames[t.Family],
+			"name":   t.Name,
+			"handle": t.Handle,
+		}})
+	}
+
+	for _, c := range rs.Chains {
+		obj := map[string]interface{}{
+			"family": familyNames[c.Family],
+			"table":  c.Table,
+			"name":   c.Name,
+			"handle": c.Handle,
+		}
+		if c.Hook != nil {
+			obj["type"] = c.Type
+			obj["hook"] = hookNames[c.Hook.Hooknum]
+			obj["prio"] = c.Hook.Priority
+			if c.Family == NFPROTO_NETDEV {
+				obj["hook"] = "ingress"
+				obj["dev"] = c.Hook.Dev
+			}
+			if c.HasPolicy {
+				obj["policy"] = map[uint32]string{NF_ACCEPT: "accept", NF_DROP: "drop"}[c.Policy]
+			}
+		}
+		objs = append(objs, map[string]interface{}{"chain": obj})
+	}
+
+	for i, s := range rs.Sets {
+		if s.Flags&NFT_SET_ANONYMOUS != 0 {
+			continue
+		}
+		objs = append(objs, map[string]interface{}{setKind(s): setJSON(s, rs.Elems[i])})
+	}
+
+	for _, r := range rs.Rules {
+		objs = append(objs, map[string]interface{}{"rule": map[string]interface{}{
+			"family": familyNames[r.Family],
+			"table":  r.Table,
+			"chain":  r.Chain,
+			"handle": r.Handle,
+			"rule":   rs.RuleText(r),
+		}})
+	}
+
+	return json.Marshal(map[string]interface{}{"nftables": objs})
+}
+
+func setKind(s *Set) string {
+	if s.Flags&NFT_SET_MAP != 0 {
+		return "map"
+	}
+	return "set"
+}
+
+func setJSON(s *Set, elems []*SetElem) map[string]interface{} {
+	obj := map[string]interface{}{
+		"family": familyNames[s.Family],
+		"table":  s.Table,
+		"name":   s.Name,
+		"handle": s.Handle,
+		"type":   typeName(s.KeyType, s.Fields),
+	}
+
+	flags := []string{}
+	for _, f := range setFlagNames {
+		if s.Flags&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	if len(flags) != 0 {
+		obj["flags"] = flags
+	}
+	if s.Timeout != 0 {
+		obj["timeout"] = int64(s.Timeout / time.Second)
+	}
+
+	if s.Flags&NFT_SET_MAP != 0 {
+		if s.DataType == NFT_DATA_VERDICT {
+			obj["map"] = "verdict"
+		} else {
+			obj["map"] = typeName(s.DataType, nil)
+		}
+	}
+
+	if len(elems) == 0 {
+		return obj
+	}
+
+	keyType := elemType(s.KeyType, s.KeyLen)
+
+	if s.Flags&NFT_SET_MAP == 0 {
+		obj["elem"] = formatElems(keyType, elems)
+		return obj
+	}
+
+	dataType := elemType(s.DataType, s.DataLen)
+	pairs := [][]string{}
+	for _, e := range elems {
+		if e.Flags&NFT_SET_ELEM_INTERVAL_END != 0 {
+			continue
+		}
+		data := ""
+		if e.Verdict != nil {
+			data = DecompileRule(s.Family, []Expr{e.Verdict}, nil)
+		} else {
+			data = dataType.format(dataType, e.Data)
+		}
+		pairs = append(pairs, []string{keyType.format(keyType, e.Key), data})
+	}
+	obj["elem"] = pairs
+	return obj
+}
+
+// typeName returns the nft(8) name of a key type, with the names of the
+// fields of concatenations joined by " . ".
+func typeName(id uint32, fields []uint32) string {
+	if t, ok := setTypes[id]; ok {
+		return t.name
+	}
+
+	n := len(fields)
+	if n < 2 {
+		return "integer"
+	}
+
+	names := make([]string, n)
+	for i := n - 1; i >= 0; i-- {
+		names[i] = typeName(id&(1<<NFT_TYPE_BITS-1), nil)
+		id >>= NFT_TYPE_BITS
+	}
+	return strings.Join(names, " . ")
+}
+
+// elemType returns the type used to write values of a set, falling back to
+// hexadecimal for types without a text form and for concatenations.
+func elemType(id, length uint32) *nftType {
+	if t, ok := setTypes[id]; ok && uint32(t.typ.len) == length {
+		return t.typ
+	}
+	return &nftType{len: int(length), format: func(t *nftType, b []byte) string {
+		return "0x" + hex.EncodeToString(b)
+	}}
+}
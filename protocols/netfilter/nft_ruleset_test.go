@@ -0,0 +1,104 @@
+package netfilter
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRulesetJSON(t *testing.T) {
+	rs := &Ruleset{
+		Tables: []*Table{{Family: NFPROTO_INET, Name: "filter", Handle: 1}},
+		Chains: []*Chain{
+			{Family: NFPROTO_INET, Table: "filter", Name: "input", Handle: 2, Type: "filter",
+				Hook: &ChainHook{Hooknum: NF_INET_LOCAL_IN}, Policy: NF_DROP, HasPolicy: true},
+			{Family: NFPROTO_INET, Table: "filter", Name: "other", Handle: 3},
+		},
+		Sets: []*Set{
+			{Family: NFPROTO_INET, Table: "filter", Name: "blocked", Handle: 4, KeyType: NFT_TYPE_IPADDR, KeyLen: 4,
+				Flags: NFT_SET_INTERVAL | NFT_SET_TIMEOUT, Timeout: time.Minute},
+			{Family: NFPROTO_INET, Table: "filter", Name: "ports", Handle: 5, KeyType: NFT_TYPE_INET_SERVICE, KeyLen: 2,
+				Flags: NFT_SET_MAP, DataType: NFT_DATA_VERDICT},
+			{Family: NFPROTO_INET, Table: "filter", Name: "pairs", Handle: 6,
+				KeyType: ConcatType(NFT_TYPE_IPADDR, NFT_TYPE_INET_SERVICE), KeyLen: 8, Fields: []uint32{4, 2}},
+			{Family: NFPROTO_INET, Table: "filter", Name: "__set0", Handle: 7, KeyType: NFT_TYPE_INET_SERVICE, KeyLen: 2,
+				Flags: NFT_SET_ANONYMOUS | NFT_SET_CONSTANT},
+		},
+		Elems: [][]*SetElem{
+			{{Key: []byte{10, 0, 0, 0}}, {Key: []byte{11, 0, 0, 0}, Flags: NFT_SET_ELEM_INTERVAL_END}},
+			{{Key: []byte{0, 22}, Verdict: &Verdict{Code: NFT_JUMP, Chain: "other"}}},
+			{{Key: []byte{192, 0, 2, 1, 0, 80, 0, 0}}},
+			{{Key: []byte{0, 80}}, {Key: []byte{1, 187}}},
+		},
+	}
+	exprs, _, err := CompileRule(NFPROTO_INET, "tcp dport { 80, 443 } accept")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exprs[len(exprs)-2].(*Lookup).SetName = "__set0"
+	rs.Rules = []*Rule{{Family: NFPROTO_INET, Table: "filter", Chain: "input", Handle: 8, Exprs: exprs}}
+
+	b, err := json.Marshal(rs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Nftables []map[string]map[string]interface{}
+	}
+	err = json.Unmarshal(b, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* anonymous sets are only found in the rules using them */
+	want := []map[string]map[string]interface{}{
+		{"table": {"family": "inet", "name": "filter", "handle": 1.0}},
+		{"chain": {"family": "inet", "table": "filter", "name": "input", "handle": 2.0,
+			"type": "filter", "hook": "input", "prio": 0.0, "policy": "drop"}},
+		{"chain": {"family": "inet", "table": "filter", "name": "other", "handle": 3.0}},
+		{"set": {"family": "inet", "table": "filter", "name": "blocked", "handle": 4.0, "type": "ipv4_addr",
+			"flags": []interface{}{"interval", "timeout"}, "timeout": 60.0, "elem": []interface{}{"10.0.0.0/8"}}},
+		{"map": {"family": "inet", "table": "filter", "name": "ports", "handle": 5.0, "type": "inet_service",
+			"map": "verdict", "elem": []interface{}{[]interface{}{"22", "jump other"}}}},
+		{"set": {"family": "inet", "table": "filter", "name": "pairs", "handle": 6.0, "type": "ipv4_addr . inet_service",
+			"elem": []interface{}{"0xc000020100500000"}}},
+		{"rule": {"family": "inet", "table": "filter", "chain": "input", "handle": 8.0,
+			"rule": "tcp dport { 80, 443 } accept"}},
+	}
+	if !reflect.DeepEqual(got.Nftables, want) {
+		t.Errorf("got  %v\nwant %v", got.Nftables, want)
+	}
+}
+
+func TestGetRuleset(t *testing.T) {
+	nfl := testNetns(t)
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_IPV4, Name: "t4"})
+	b.AddChain(&Chain{Family: NFPROTO_IPV4, Table: "t4", Name: "c"})
+	b.AddTable(&Table{Family: NFPROTO_IPV6, Name: "t6"})
+	b.AddSet(&Set{Family: NFPROTO_IPV6, Table: "t6", Name: "s", KeyType: NFT_TYPE_INET_SERVICE, KeyLen: 2})
+	b.AddSetElems(&Set{Family: NFPROTO_IPV6, Table: "t6", Name: "s"}, []SetElem{{Key: []byte{0, 22}}})
+	err := nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs, err := nfl.GetRuleset(NFPROTO_IPV4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Tables) != 1 || rs.Tables[0].Name != "t4" || len(rs.Chains) != 1 || len(rs.Sets) != 0 {
+		t.Errorf("ipv4 ruleset %+v", rs)
+	}
+
+	rs, err = nfl.GetRuleset(NFPROTO_UNSPEC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.Tables) != 2 || len(rs.Sets) != 1 || len(rs.Elems) != 1 || len(rs.Elems[0]) != 1 {
+		t.Errorf("ruleset %+v", rs)
+	}
+}
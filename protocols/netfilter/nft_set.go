@@ -0,0 +1,506 @@
+package netfilter
+
+import (
+	"syscall"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+// Largest NFTA_SET_ELEM_LIST_ELEMENTS attribute sent in a single message.
+// Attribute lengths are 16 bits, so bigger element lists are split.
+const setElemsChunk = 32768
+
+// Set is an nftables set, or a map when DataType is set. KeyType and
+// DataType are NFT_TYPE_* values, or NFT_DATA_VERDICT for verdict maps.
+//
+// Fields holds the length of every field of a concatenated key, whose
+// KeyLen is computed from them when not given. Id identifies the set in
+// the batch creating it, and is assigned by AddSet when not given; Lookup
+// refers to anonymous sets by it.
+type Set struct {
+	Family     uint8
+	Table      string
+	Name       string
+	Handle     uint64
+	Id         uint32
+	Flags      uint32
+	KeyType    uint32
+	KeyLen     uint32
+	DataType   uint32
+	DataLen    uint32
+	Fields     []uint32
+	Timeout    time.Duration
+	GcInterval time.Duration
+	Size       uint32
+	Policy     uint32
+	HasPolicy  bool
+	Counter    bool // keep a counter in every element
+	UserData   []byte
+	Attrs      []netlink.NetlinkAttr
+}
+
+// SetElem is an element of a set. Data or Verdict is the value of the
+// element in maps. KeyEnd closes the range started by Key in interval sets
+// with concatenated keys, see also IntervalElems.
+type SetElem struct {
+	Key        []byte
+	KeyEnd     []byte
+	Data       []byte
+	Verdict    *Verdict
+	Flags      uint32
+	Timeout    time.Duration
+	Expiration time.Duration
+	Counter    *Counter
+	UserData   []byte
+}
+
+// ConcatType returns the key type of a concatenation of the given types.
+func ConcatType(types ...uint32) uint32 {
+	t := uint32(0)
+	for _, v := range types {
+		t = t<<NFT_TYPE_BITS | v
+	}
+	return t
+}
+
+// Concat builds a concatenated key, padding every field to 32 bits.
+func Concat(fields ...[]byte) []byte {
+	b := []byte{}
+	for _, f := range fields {
+		b = append(b, f...)
+		b = append(b, make([]byte, regAlignOf(len(f))-len(f))...)
+	}
+	return b
+}
+
+// IntervalElems returns the elements covering the range from start to end,
+// both included, in an interval set. The kernel closes a range with an
+// element flagged NFT_SET_ELEM_INTERVAL_END holding the first key past it,
+// which is left out when the range runs to the largest key.
+func IntervalElems(start, end []byte) []SetElem {
+	elems := []SetElem{{Key: start}}
+
+	next := append([]byte{}, end...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return append(elems, SetElem{Key: next, Flags: NFT_SET_ELEM_INTERVAL_END})
+		}
+	}
+
+	return elems
+}
+
+func regAlignOf(n int) int {
+	return (n + 3) &^ 3
+}
+
+func SetfromMessage(m *NfMessage) (*Set, error) {
+	s := &Set{
+		Family: m.Header.Family,
+		Attrs:  m.Attrs,
+	}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFTA_SET_TABLE:
+			s.Table = attr.String()
+		case NFTA_SET_NAME:
+			s.Name = attr.String()
+		case NFTA_SET_HANDLE:
+			s.Handle = attr.NetUint64()
+		case NFTA_SET_ID:
+			s.Id = attr.NetUint32()
+		case NFTA_SET_FLAGS:
+			s.Flags = attr.NetUint32()
+		case NFTA_SET_KEY_TYPE:
+			s.KeyType = attr.NetUint32()
+		case NFTA_SET_KEY_LEN:
+			s.KeyLen = attr.NetUint32()
+		case NFTA_SET_DATA_TYPE:
+			s.DataType = attr.NetUint32()
+		case NFTA_SET_DATA_LEN:
+			s.DataLen = attr.NetUint32()
+		case NFTA_SET_TIMEOUT:
+			s.Timeout = time.Duration(attr.NetUint64()) * time.Millisecond
+		case NFTA_SET_GC_INTERVAL:
+			s.GcInterval = time.Duration(attr.NetUint32()) * time.Millisecond
+		case NFTA_SET_POLICY:
+			s.Policy = attr.NetUint32()
+			s.HasPolicy = true
+		case NFTA_SET_USERDATA:
+			s.UserData = attr.Data
+		case NFTA_SET_EXPR:
+			eattrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			e, err := ExprfromAttrs(eattrs)
+			if err != nil {
+				return nil, err
+			}
+			_, s.Counter = e.(*Counter)
+		case NFTA_SET_DESC:
+			dattrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			err = s.parseDesc(dattrs)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Set) parseDesc(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_SET_DESC_SIZE:
+			s.Size = attr.NetUint32()
+		case NFTA_SET_DESC_CONCAT:
+			elems, err := attr.Nested()
+			if err != nil {
+				return err
+			}
+			s.Fields = []uint32{}
+			for _, elem := range elems {
+				fattrs, err := elem.Nested()
+				if err != nil {
+					return err
+				}
+				for _, fattr := range fattrs {
+					if fattr.AttrType() == NFTA_SET_FIELD_LEN {
+						s.Fields = append(s.Fields, fattr.NetUint32())
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Set) toAttrs() []netlink.NetlinkAttr {
+	flags := s.Flags
+	if s.DataType != 0 {
+		flags |= NFT_SET_MAP
+	}
+	if s.Timeout != 0 {
+		flags |= NFT_SET_TIMEOUT
+	}
+	if len(s.Fields) > 1 && flags&NFT_SET_INTERVAL != 0 {
+		flags |= NFT_SET_CONCAT
+	}
+
+	keyLen := s.KeyLen
+	if keyLen == 0 {
+		for _, f := range s.Fields {
+			keyLen += uint32(regAlignOf(int(f)))
+		}
+	}
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_SET_TABLE, s.Table),
+		netlink.NewAttrString(NFTA_SET_NAME, s.Name),
+		netlink.NewAttrNetUint32(NFTA_SET_FLAGS, flags),
+		netlink.NewAttrNetUint32(NFTA_SET_KEY_TYPE, s.KeyType),
+		netlink.NewAttrNetUint32(NFTA_SET_KEY_LEN, keyLen),
+		netlink.NewAttrNetUint32(NFTA_SET_ID, s.Id),
+	}
+	if s.DataType != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_SET_DATA_TYPE, s.DataType))
+		if s.DataType != NFT_DATA_VERDICT {
+			attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_SET_DATA_LEN, s.DataLen))
+		}
+	}
+	if s.HasPolicy {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_SET_POLICY, s.Policy))
+	}
+	if s.Timeout != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint64(NFTA_SET_TIMEOUT, uint64(s.Timeout/time.Millisecond)))
+	}
+	if s.GcInterval != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_SET_GC_INTERVAL, uint32(s.GcInterval/time.Millisecond)))
+	}
+
+	desc := []netlink.NetlinkAttr{}
+	if s.Size != 0 {
+		desc = append(desc, netlink.NewAttrNetUint32(NFTA_SET_DESC_SIZE, s.Size))
+	}
+	if len(s.Fields) > 1 {
+		fields := []netlink.NetlinkAttr{}
+		for _, f := range s.Fields {
+			fields = append(fields, netlink.NewAttrNested(NFTA_LIST_ELEM, []netlink.NetlinkAttr{
+				netlink.NewAttrNetUint32(NFTA_SET_FIELD_LEN, f),
+			}))
+		}
+		desc = append(desc, netlink.NewAttrNested(NFTA_SET_DESC_CONCAT, fields))
+	}
+	if len(desc) != 0 {
+		attrs = append(attrs, netlink.NewAttrNested(NFTA_SET_DESC, desc))
+	}
+
+	if s.Counter {
+		attrs = append(attrs, netlink.NewAttrNested(NFTA_SET_EXPR, exprAttrs(&Counter{})))
+	}
+	if s.UserData != nil {
+		attrs = append(attrs, netlink.NewAttr(NFTA_SET_USERDATA, s.UserData))
+	}
+	return attrs
+}
+
+// setRef identifies the set in element messages.
+func (s *Set) setRef() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_SET_ELEM_LIST_TABLE, s.Table),
+		netlink.NewAttrString(NFTA_SET_ELEM_LIST_SET, s.Name),
+	}
+	if s.Id != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_SET_ELEM_LIST_SET_ID, s.Id))
+	}
+	return attrs
+}
+
+func SetElemfromAttrs(attrs []netlink.NetlinkAttr) (*SetElem, error) {
+	e := &SetElem{}
+	var err error
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_SET_ELEM_KEY:
+			e.Key, err = dataValue(&attr)
+		case NFTA_SET_ELEM_KEY_END:
+			e.KeyEnd, err = dataValue(&attr)
+		case NFTA_SET_ELEM_DATA:
+			err = e.parseData(&attr)
+		case NFTA_SET_ELEM_FLAGS:
+			e.Flags = attr.NetUint32()
+		case NFTA_SET_ELEM_TIMEOUT:
+			e.Timeout = time.Duration(attr.NetUint64()) * time.Millisecond
+		case NFTA_SET_ELEM_EXPIRATION:
+			e.Expiration = time.Duration(attr.NetUint64()) * time.Millisecond
+		case NFTA_SET_ELEM_USERDATA:
+			e.UserData = attr.Data
+		case NFTA_SET_ELEM_EXPR:
+			err = e.parseExpr(&attr)
+		case NFTA_SET_ELEM_EXPRESSIONS:
+			var exprs []netlink.NetlinkAttr
+			exprs, err = attr.Nested()
+			for _, expr := range exprs {
+				if err == nil {
+					err = e.parseExpr(&expr)
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// SetElemsfromMessage decodes a set element message, returning the set,
+// with only its family, table and name, and the elements.
+func SetElemsfromMessage(m *NfMessage) (*Set, []*SetElem, error) {
+	s := &Set{Family: m.Header.Family}
+	ret := []*SetElem{}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFTA_SET_ELEM_LIST_TABLE:
+			s.Table = attr.String()
+		case NFTA_SET_ELEM_LIST_SET:
+			s.Name = attr.String()
+		case NFTA_SET_ELEM_LIST_ELEMENTS:
+			elems, err := attr.Nested()
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, elem := range elems {
+				eattrs, err := elem.Nested()
+				if err != nil {
+					return nil, nil, err
+				}
+				e, err := SetElemfromAttrs(eattrs)
+				if err != nil {
+					return nil, nil, err
+				}
+				ret = append(ret, e)
+			}
+		}
+	}
+
+	return s, ret, nil
+}
+
+func (e *SetElem) parseData(attr *netlink.NetlinkAttr) error {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return err
+	}
+	for _, a := range attrs {
+		switch a.AttrType() {
+		case NFTA_DATA_VALUE:
+			e.Data = a.Data
+		case NFTA_DATA_VERDICT:
+			e.Verdict, err = VerdictfromAttr(&a)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (e *SetElem) parseExpr(attr *netlink.NetlinkAttr) error {
+	attrs, err := attr.Nested()
+	if err != nil {
+		return err
+	}
+	expr, err := ExprfromAttrs(attrs)
+	if err != nil {
+		return err
+	}
+	if c, ok := expr.(*Counter); ok {
+		e.Counter = c
+	}
+	return nil
+}
+
+func (e *SetElem) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+	if e.Key != nil {
+		attrs = append(attrs, dataValueAttr(NFTA_SET_ELEM_KEY, e.Key))
+	}
+	if e.KeyEnd != nil {
+		attrs = append(attrs, dataValueAttr(NFTA_SET_ELEM_KEY_END, e.KeyEnd))
+	}
+	if e.Verdict != nil {
+		attrs = append(attrs, netlink.NewAttrNested(NFTA_SET_ELEM_DATA, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(NFTA_DATA_VERDICT, e.Verdict.verdictAttrs()),
+		}))
+	} else if e.Data != nil {
+		attrs = append(attrs, dataValueAttr(NFTA_SET_ELEM_DATA, e.Data))
+	}
+	if e.Flags != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_SET_ELEM_FLAGS, e.Flags))
+	}
+	if e.Timeout != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint64(NFTA_SET_ELEM_TIMEOUT, uint64(e.Timeout/time.Millisecond)))
+	}
+	if e.UserData != nil {
+		attrs = append(attrs, netlink.NewAttr(NFTA_SET_ELEM_USERDATA, e.UserData))
+	}
+	return attrs
+}
+
+// AddSet creates the set, or does nothing if it exists.
+func (b *Batch) AddSet(s *Set) {
+	if s.Id == 0 {
+		b.setId++
+		s.Id = b.setId
+	}
+	b.Add(nftMsgType(NFT_MSG_NEWSET), syscall.NLM_F_CREATE, s.Family, s.toAttrs())
+}
+
+// DelSet deletes the set, which must not be referenced by any rule.
+func (b *Batch) DelSet(s *Set) {
+	b.Add(nftMsgType(NFT_MSG_DELSET), 0, s.Family, []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_SET_TABLE, s.Table),
+		netlink.NewAttrString(NFTA_SET_NAME, s.Name),
+	})
+}
+
+// FlushSet deletes every element of the set.
+func (b *Batch) FlushSet(s *Set) {
+	b.Add(nftMsgType(NFT_MSG_DELSETELEM), 0, s.Family, s.setRef())
+}
+
+// AddSetElems adds elements to the set. Large lists are split across
+// several messages of the batch.
+func (b *Batch) AddSetElems(s *Set, elems []SetElem) {
+	b.setElems(NFT_MSG_NEWSETELEM, syscall.NLM_F_CREATE, s, elems)
+}
+
+// DelSetElems deletes elements from the set, only Key and KeyEnd are used.
+func (b *Batch) DelSetElems(s *Set, elems []SetElem) {
+	b.setElems(NFT_MSG_DELSETELEM, 0, s, elems)
+}
+
+func (b *Batch) setElems(msg uint8, flags uint16, s *Set, elems []SetElem) {
+	list := []netlink.NetlinkAttr{}
+	size := 0
+
+	for i, e := range elems {
+		attr := netlink.NewAttrNested(NFTA_LIST_ELEM, e.toAttrs())
+		list = append(list, attr)
+		size += nlaAlignOf(len(attr.Data)) + syscall.NLA_HDRLEN
+
+		if size >= setElemsChunk || i == len(elems)-1 {
+			attrs := append(s.setRef(), netlink.NewAttrNested(NFTA_SET_ELEM_LIST_ELEMENTS, list))
+			b.Add(nftMsgType(msg), flags, s.Family, attrs)
+			list = []netlink.NetlinkAttr{}
+			size = 0
+		}
+	}
+}
+
+func nlaAlignOf(attrlen int) int {
+	return (attrlen + syscall.NLA_ALIGNTO - 1) & ^(syscall.NLA_ALIGNTO - 1)
+}
+
+// ListSets dumps the sets and maps of the given family, limited to one
+// table when table is not empty.
+func (nfl *NetfilterNLSocket) ListSets(family uint8, table string) ([]*Set, error) {
+	attrs := []netlink.NetlinkAttr{}
+	if table != "" {
+		attrs = append(attrs, netlink.NewAttrString(NFTA_SET_TABLE, table))
+	}
+
+	msgList, err := nfl.dump(NFT_MSG_GETSET, family, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Set{}
+
+	for _, m := range msgList {
+		s, err := SetfromMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		if table != "" && s.Table != table {
+			continue
+		}
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// ListSetElems dumps the elements of the set.
+func (nfl *NetfilterNLSocket) ListSetElems(s *Set) ([]*SetElem, error) {
+	msgList, err := nfl.dump(NFT_MSG_GETSETELEM, s.Family, []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_SET_ELEM_LIST_TABLE, s.Table),
+		netlink.NewAttrString(NFTA_SET_ELEM_LIST_SET, s.Name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*SetElem{}
+
+	for _, m := range msgList {
+		_, elems, err := SetElemsfromMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, elems...)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,400 @@
+package netfilter
+
+import (
+	"bytes"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestConcat(t *testing.T) {
+	if ConcatType(NFT_TYPE_IPADDR, NFT_TYPE_INET_SERVICE) != NFT_TYPE_IPADDR<<NFT_TYPE_BITS|NFT_TYPE_INET_SERVICE {
+		t.Errorf("concat type %#x", ConcatType(NFT_TYPE_IPADDR, NFT_TYPE_INET_SERVICE))
+	}
+
+	/* every field takes a whole register */
+	key := Concat(net.ParseIP("192.0.2.1").To4(), []byte{0, 80}, []byte{6})
+	want := []byte{192, 0, 2, 1, 0, 80, 0, 0, 6, 0, 0, 0}
+	if !bytes.Equal(key, want) {
+		t.Errorf("got % x, want % x", key, want)
+	}
+}
+
+func TestIntervalElems(t *testing.T) {
+	tests := []struct {
+		start, end []byte
+		next       []byte
+	}{
+		{[]byte{10, 0, 0, 0}, []byte{10, 255, 255, 255}, []byte{11, 0, 0, 0}},
+		{[]byte{0, 80}, []byte{0, 80}, []byte{0, 81}},
+		{[]byte{0, 1}, []byte{0, 0xff}, []byte{1, 0}},
+		/* a range up to the largest key is left open */
+		{[]byte{0x80, 0}, []byte{0xff, 0xff}, nil},
+	}
+
+	for _, test := range tests {
+		elems := IntervalElems(test.start, test.end)
+		if !bytes.Equal(elems[0].Key, test.start) || elems[0].Flags != 0 {
+			t.Errorf("% x-% x: start %+v", test.start, test.end, elems[0])
+		}
+		if test.next == nil {
+			if len(elems) != 1 {
+				t.Errorf("% x-% x: got %+v", test.start, test.end, elems)
+			}
+			continue
+		}
+		if len(elems) != 2 || !bytes.Equal(elems[1].Key, test.next) || elems[1].Flags != NFT_SET_ELEM_INTERVAL_END {
+			t.Errorf("% x-% x: got %+v", test.start, test.end, elems)
+		}
+	}
+
+	/* the end key of the caller is left alone */
+	end := []byte{1, 2}
+	IntervalElems([]byte{0, 0}, end)
+	if end[1] != 2 {
+		t.Error("end key modified")
+	}
+}
+
+func TestSetWireFormat(t *testing.T) {
+	set := &Set{
+		Family:     NFPROTO_INET,
+		Table:      "filter",
+		Name:       "allowed",
+		Id:         3,
+		Flags:      NFT_SET_INTERVAL,
+		KeyType:    ConcatType(NFT_TYPE_IPADDR, NFT_TYPE_INET_SERVICE),
+		Fields:     []uint32{4, 2},
+		DataType:   NFT_DATA_VERDICT,
+		Timeout:    time.Minute,
+		GcInterval: 10 * time.Second,
+		Size:       1024,
+		Policy:     NFT_SET_POL_MEMORY,
+		HasPolicy:  true,
+		Counter:    true,
+		UserData:   []byte{1},
+	}
+
+	got, err := SetfromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWSET), set.Family, set.toAttrs()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* the flags follow from the other fields and the key length from the fields */
+	if got.Flags != NFT_SET_INTERVAL|NFT_SET_MAP|NFT_SET_TIMEOUT|NFT_SET_CONCAT || got.KeyLen != 8 {
+		t.Errorf("flags %#x key length %d", got.Flags, got.KeyLen)
+	}
+	if got.Table != "filter" || got.Name != "allowed" || got.Id != 3 || got.KeyType != set.KeyType ||
+		got.DataType != NFT_DATA_VERDICT || got.DataLen != 0 || got.Timeout != time.Minute ||
+		got.GcInterval != 10*time.Second || got.Size != 1024 || !got.HasPolicy || got.Policy != NFT_SET_POL_MEMORY ||
+		!got.Counter || !bytes.Equal(got.UserData, []byte{1}) {
+		t.Errorf("got %+v", got)
+	}
+	if len(got.Fields) != 2 || got.Fields[0] != 4 || got.Fields[1] != 2 {
+		t.Errorf("fields %v", got.Fields)
+	}
+
+	/* verdict maps have no data length and single fields no description */
+	attrs := (&Set{KeyType: NFT_TYPE_INET_SERVICE, KeyLen: 2, DataType: NFT_DATA_VERDICT, Fields: []uint32{2}}).toAttrs()
+	for _, attr := range attrs {
+		if attr.AttrType() == NFTA_SET_DATA_LEN || attr.AttrType() == NFTA_SET_DESC {
+			t.Errorf("attribute %d sent", attr.AttrType())
+		}
+	}
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	s1, s2, s3 := &Set{Name: "a"}, &Set{Name: "b"}, &Set{Name: "c", Id: 10}
+	b.AddSet(s1)
+	b.AddSet(s2)
+	b.AddSet(s3)
+	if s1.Id != 1 || s2.Id != 2 || s3.Id != 10 {
+		t.Errorf("set ids %d %d %d", s1.Id, s2.Id, s3.Id)
+	}
+}
+
+func TestSetElemWireFormat(t *testing.T) {
+	elems := []SetElem{
+		{Key: []byte{10, 0, 0, 1}, Data: []byte{0, 0, 0, 7}, Timeout: time.Second, UserData: []byte{1, 2}},
+		{Key: []byte{10, 0, 0, 2}, Verdict: &Verdict{Code: NFT_JUMP, Chain: "other"}},
+		{Key: []byte{10, 0, 0, 0}, KeyEnd: []byte{10, 0, 0, 255}},
+		{Key: []byte{11, 0, 0, 0}, Flags: NFT_SET_ELEM_INTERVAL_END},
+	}
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddSetElems(&Set{Family: NFPROTO_IPV4, Table: "filter", Name: "s", Id: 4}, elems)
+	if b.Len() != 1 {
+		t.Fatalf("got %d messages", b.Len())
+	}
+	m, err := ParseNfMessage(b.msgs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findAttr(m.Attrs, NFTA_SET_ELEM_LIST_SET_ID); !ok {
+		t.Error("set id not sent")
+	}
+
+	s, got, err := SetElemsfromMessage(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Family != NFPROTO_IPV4 || s.Table != "filter" || s.Name != "s" || len(got) != 4 {
+		t.Fatalf("got %+v %+v", s, got)
+	}
+	if !bytes.Equal(got[0].Key, elems[0].Key) || !bytes.Equal(got[0].Data, elems[0].Data) ||
+		got[0].Timeout != time.Second || !bytes.Equal(got[0].UserData, elems[0].UserData) {
+		t.Errorf("element 0: %+v", got[0])
+	}
+	if got[1].Verdict == nil || *got[1].Verdict != *elems[1].Verdict || got[1].Data != nil {
+		t.Errorf("element 1: %+v", got[1])
+	}
+	if !bytes.Equal(got[2].KeyEnd, elems[2].KeyEnd) || got[3].Flags != NFT_SET_ELEM_INTERVAL_END {
+		t.Errorf("intervals: %+v %+v", got[2], got[3])
+	}
+
+	/* counters come in either expression attribute */
+	counter := netlink.NewAttrNested(NFTA_SET_ELEM_EXPR, exprAttrs(&Counter{Bytes: 10, Packets: 1}))
+	e, err := SetElemfromAttrs([]netlink.NetlinkAttr{counter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Counter == nil || e.Counter.Packets != 1 {
+		t.Errorf("counter %+v", e.Counter)
+	}
+	e, _ = SetElemfromAttrs([]netlink.NetlinkAttr{
+		netlink.NewAttrNested(NFTA_SET_ELEM_EXPRESSIONS, []netlink.NetlinkAttr{
+			netlink.NewAttrNested(NFTA_LIST_ELEM, exprAttrs(&Counter{Bytes: 20, Packets: 2})),
+		}),
+	})
+	if e == nil || e.Counter == nil || e.Counter.Packets != 2 {
+		t.Errorf("counter %+v", e)
+	}
+}
+
+func TestSetElemsChunks(t *testing.T) {
+	elems := make([]SetElem, 5000)
+	for i := range elems {
+		elems[i] = SetElem{Key: []byte{10, 0, byte(i >> 8), byte(i)}}
+	}
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddSetElems(&Set{Table: "filter", Name: "s"}, elems)
+	if b.Len() < 2 {
+		t.Fatalf("got %d messages", b.Len())
+	}
+
+	n := 0
+	for _, msg := range b.msgs {
+		m, err := ParseNfMessage(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, attr := range m.Attrs {
+			if attr.AttrType() == NFTA_SET_ELEM_LIST_ELEMENTS && len(attr.Data) > 0xffff-syscall.NLA_HDRLEN {
+				t.Errorf("elements attribute of %d bytes", len(attr.Data))
+			}
+		}
+		_, got, err := SetElemsfromMessage(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range got {
+			if !bytes.Equal(e.Key, elems[n].Key) {
+				t.Fatalf("element %d: got % x", n, e.Key)
+			}
+			n++
+		}
+	}
+	if n != len(elems) {
+		t.Errorf("got %d elements", n)
+	}
+}
+
+func findAttr(attrs []netlink.NetlinkAttr, attrtype uint16) (netlink.NetlinkAttr, bool) {
+	for _, attr := range attrs {
+		if attr.AttrType() == attrtype {
+			return attr, true
+		}
+	}
+	return netlink.NetlinkAttr{}, false
+}
+
+func TestSets(t *testing.T) {
+	nfl := testNetns(t)
+
+	table := &Table{Family: NFPROTO_IPV4, Name: "filter"}
+	chain := &Chain{Family: NFPROTO_IPV4, Table: "filter", Name: "input"}
+	blocked := &Set{Family: NFPROTO_IPV4, Table: "filter", Name: "blocked", KeyType: NFT_TYPE_IPADDR, KeyLen: 4,
+		Flags: NFT_SET_INTERVAL}
+	ports := &Set{Family: NFPROTO_IPV4, Table: "filter", Name: "ports", KeyType: NFT_TYPE_INET_SERVICE, KeyLen: 2,
+		DataType: NFT_DATA_VERDICT}
+	/* an anonymous set is referenced by its id in the batch creating it */
+	anon := &Set{Family: NFPROTO_IPV4, Table: "filter", Name: "__set%d", KeyType: NFT_TYPE_INET_SERVICE, KeyLen: 2,
+		Flags: NFT_SET_ANONYMOUS | NFT_SET_CONSTANT}
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(table)
+	b.AddChain(chain)
+	b.AddSet(blocked)
+	b.AddSet(ports)
+	b.AddSet(anon)
+	b.AddSetElems(blocked, append(IntervalElems([]byte{10, 0, 0, 0}, []byte{10, 255, 255, 255}),
+		IntervalElems([]byte{192, 0, 2, 1}, []byte{192, 0, 2, 1})...))
+	b.AddSetElems(ports, []SetElem{
+		{Key: []byte{0, 22}, Verdict: &Verdict{Code: NF_ACCEPT}},
+		{Key: []byte{0, 23}, Verdict: &Verdict{Code: NF_DROP}},
+	})
+	b.AddSetElems(anon, []SetElem{{Key: []byte{0, 80}}, {Key: []byte{1, 187}}})
+	b.AddRule(&Rule{Family: NFPROTO_IPV4, Table: "filter", Chain: "input", Exprs: []Expr{
+		&Payload{Base: NFT_PAYLOAD_NETWORK_HEADER, Offset: 12, Len: 4, Dreg: NFT_REG_1},
+		&Lookup{SetName: "blocked", Sreg: NFT_REG_1},
+		&Verdict{Code: NF_DROP},
+	}})
+	b.AddRule(&Rule{Family: NFPROTO_IPV4, Table: "filter", Chain: "input", Exprs: []Expr{
+		&Payload{Base: NFT_PAYLOAD_TRANSPORT_HEADER, Offset: 2, Len: 2, Dreg: NFT_REG_1},
+		&Lookup{SetName: anon.Name, SetId: anon.Id, Sreg: NFT_REG_1},
+		&Lookup{SetName: "ports", Sreg: NFT_REG_1, Dreg: NFT_REG_VERDICT, HasDreg: true},
+	}})
+	err := nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sets, err := nfl.ListSets(NFPROTO_IPV4, "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]*Set{}
+	for _, s := range sets {
+		byName[s.Name] = s
+	}
+	if s := byName["blocked"]; s == nil || s.Flags&NFT_SET_INTERVAL == 0 || s.KeyType != NFT_TYPE_IPADDR || s.KeyLen != 4 {
+		t.Errorf("blocked: %+v", s)
+	}
+	if s := byName["ports"]; s == nil || s.Flags&NFT_SET_MAP == 0 || s.DataType != NFT_DATA_VERDICT {
+		t.Errorf("ports: %+v", s)
+	}
+	if s := byName["__set0"]; s == nil || s.Flags&NFT_SET_ANONYMOUS == 0 {
+		t.Errorf("anonymous set: %+v", sets)
+	}
+
+	elems, err := nfl.ListSetElems(blocked)
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts := 0
+	for _, e := range elems {
+		if e.Flags&NFT_SET_ELEM_INTERVAL_END == 0 {
+			starts++
+		}
+	}
+	if len(elems) != 4 || starts != 2 {
+		t.Errorf("blocked elements: %+v", elems)
+	}
+
+	elems, err = nfl.ListSetElems(ports)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verdicts := map[uint16]int32{}
+	for _, e := range elems {
+		if e.Verdict != nil {
+			verdicts[uint16(e.Key[0])<<8|uint16(e.Key[1])] = e.Verdict.Code
+		}
+	}
+	if len(elems) != 2 || verdicts[22] != NF_ACCEPT || verdicts[23] != NF_DROP {
+		t.Errorf("ports elements: %+v", elems)
+	}
+
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.DelSetElems(ports, []SetElem{{Key: []byte{0, 23}}})
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems, _ = nfl.ListSetElems(ports)
+	if len(elems) != 1 || elems[0].Key[1] != 22 {
+		t.Errorf("ports elements after delete: %+v", elems)
+	}
+
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.FlushSet(blocked)
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elems, _ = nfl.ListSetElems(blocked)
+	if len(elems) != 0 {
+		t.Errorf("flushed set: %+v", elems)
+	}
+
+	/* a set used by a rule can not be deleted */
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.DelSet(blocked)
+	err = nfl.ExecuteBatch(b)
+	if be, ok := err.(*BatchError); !ok || be.Err != syscall.EBUSY {
+		t.Errorf("deleting a used set: %v", err)
+	}
+
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.FlushChain(chain)
+	b.DelSet(blocked)
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sets, _ = nfl.ListSets(NFPROTO_IPV4, "filter")
+	for _, s := range sets {
+		if s.Name == "blocked" || s.Flags&NFT_SET_ANONYMOUS != 0 {
+			t.Errorf("set left: %+v", s)
+		}
+	}
+}
+
+func TestSetTimeouts(t *testing.T) {
+	nfl := testNetns(t)
+
+	set := &Set{Family: NFPROTO_INET, Table: "filter", Name: "seen", KeyType: NFT_TYPE_IPADDR, KeyLen: 4,
+		Timeout: time.Hour, Counter: true}
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(&Table{Family: NFPROTO_INET, Name: "filter"})
+	b.AddSet(set)
+	b.AddSetElems(set, []SetElem{
+		{Key: []byte{192, 0, 2, 1}},
+		{Key: []byte{192, 0, 2, 2}, Timeout: time.Minute},
+	})
+	err := nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sets, err := nfl.ListSets(NFPROTO_INET, "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sets) != 1 || sets[0].Timeout != time.Hour || sets[0].Flags&NFT_SET_TIMEOUT == 0 || !sets[0].Counter {
+		t.Fatalf("sets %+v", sets)
+	}
+
+	elems, err := nfl.ListSetElems(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(elems) != 2 {
+		t.Fatalf("elements %+v", elems)
+	}
+	for _, e := range elems {
+		/* the set timeout applies to elements without one */
+		want := time.Hour
+		if e.Key[3] == 2 {
+			want = time.Minute
+		}
+		if e.Expiration <= 0 || e.Expiration > want || e.Counter == nil {
+			t.Errorf("element %v: %+v", e.Key, e)
+		}
+	}
+}
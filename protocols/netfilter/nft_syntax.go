@@ -0,0 +1,433 @@
+package netfilter
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/apuigsech/netlink"
+)
+
+// nftType describes how the values of a key type are written in rules.
+// Host order values are compared as loaded, so they cannot be ranges.
+type nftType struct {
+	id      uint32
+	len     int
+	host    bool
+	bitmask bool
+	prefix  bool
+	hex     bool
+	names   map[string]uint64
+	parse   func(t *nftType, s string) ([]byte, error)
+	format  func(t *nftType, b []byte) string
+}
+
+// nftField is a value a rule can match, loaded from the packet payload, its
+// metadata or its conntrack entry.
+type nftField struct {
+	proto string
+	name  string
+	typ   *nftType
+	kind  int
+	base  uint32
+	off   uint32
+	key   uint32
+}
+
+const (
+	fieldPayload = iota
+	fieldMeta
+	fieldCt
+)
+
+var (
+	ipaddrType  = &nftType{id: NFT_TYPE_IPADDR, len: 4, prefix: true, parse: parseAddr, format: formatAddr}
+	ip6addrType = &nftType{id: NFT_TYPE_IP6ADDR, len: 16, prefix: true, parse: parseAddr, format: formatAddr}
+	ifnameType  = &nftType{id: NFT_TYPE_IFNAME, len: 16, parse: parseIfname, format: formatIfname}
+
+	serviceType = &nftType{id: NFT_TYPE_INET_SERVICE, len: 2, parse: parseService, format: formatInt}
+	u8Type      = &nftType{id: NFT_TYPE_INTEGER, len: 1, parse: parseInt, format: formatInt}
+	u16Type     = &nftType{id: NFT_TYPE_INTEGER, len: 2, parse: parseInt, format: formatInt}
+	markType    = &nftType{id: NFT_TYPE_MARK, len: 4, host: true, hex: true, parse: parseInt, format: formatInt}
+	uidType     = &nftType{id: NFT_TYPE_UID, len: 4, host: true, parse: parseInt, format: formatInt}
+
+	protoType = &nftType{id: NFT_TYPE_INET_PROTOCOL, len: 1, parse: parseInt, format: formatInt,
+		names: map[string]uint64{
+			"icmp": 1, "igmp": 2, "tcp": 6, "udp": 17, "gre": 47, "esp": 50,
+			"ah": 51, "icmpv6": 58, "sctp": 132, "udplite": 136,
+		}}
+	nfprotoType = &nftType{id: NFT_TYPE_NFPROTO, len: 1, parse: parseInt, format: formatInt,
+		names: map[string]uint64{"ipv4": NFPROTO_IPV4, "ipv6": NFPROTO_IPV6}}
+	ethertypeType = &nftType{id: NFT_TYPE_ETHERTYPE, len: 2, hex: true, parse: parseInt, format: formatInt,
+		names: map[string]uint64{"ip": 0x0800, "arp": 0x0806, "ip6": 0x86dd, "vlan": 0x8100}}
+	ctStateType = &nftType{id: NFT_TYPE_CT_STATE, len: 4, host: true, bitmask: true, parse: parseInt, format: formatInt,
+		names: map[string]uint64{
+			"invalid": NF_CT_STATE_INVALID, "established": NF_CT_STATE_ESTABLISHED,
+			"related": NF_CT_STATE_RELATED, "new": NF_CT_STATE_NEW, "untracked": NF_CT_STATE_UNTRACKED,
+		}}
+	tcpFlagType = &nftType{id: NFT_TYPE_TCP_FLAG, len: 1, bitmask: true, parse: parseInt, format: formatInt,
+		names: map[string]uint64{
+			"fin": 0x01, "syn": 0x02, "rst": 0x04, "psh": 0x08,
+			"ack": 0x10, "urg": 0x20, "ecn": 0x40, "cwr": 0x80,
+		}}
+)
+
+var nftFields = []*nftField{
+	{proto: "ip", name: "protocol", typ: protoType, base: NFT_PAYLOAD_NETWORK_HEADER, off: 9},
+	{proto: "ip", name: "ttl", typ: u8Type, base: NFT_PAYLOAD_NETWORK_HEADER, off: 8},
+	{proto: "ip", name: "length", typ: u16Type, base: NFT_PAYLOAD_NETWORK_HEADER, off: 2},
+	{proto: "ip", name: "saddr", typ: ipaddrType, base: NFT_PAYLOAD_NETWORK_HEADER, off: 12},
+	{proto: "ip", name: "daddr", typ: ipaddrType, base: NFT_PAYLOAD_NETWORK_HEADER, off: 16},
+	{proto: "ip6", name: "nexthdr", typ: protoType, base: NFT_PAYLOAD_NETWORK_HEADER, off: 6},
+	{proto: "ip6", name: "hoplimit", typ: u8Type, base: NFT_PAYLOAD_NETWORK_HEADER, off: 7},
+	{proto: "ip6", name: "saddr", typ: ip6addrType, base: NFT_PAYLOAD_NETWORK_HEADER, off: 8},
+	{proto: "ip6", name: "daddr", typ: ip6addrType, base: NFT_PAYLOAD_NETWORK_HEADER, off: 24},
+	{proto: "tcp", name: "sport", typ: serviceType, base: NFT_PAYLOAD_TRANSPORT_HEADER, off: 0},
+	{proto: "tcp", name: "dport", typ: serviceType, base: NFT_PAYLOAD_TRANSPORT_HEADER, off: 2},
+	{proto: "tcp", name: "flags", typ: tcpFlagType, base: NFT_PAYLOAD_TRANSPORT_HEADER, off: 13},
+	{proto: "udp", name: "sport", typ: serviceType, base: NFT_PAYLOAD_TRANSPORT_HEADER, off: 0},
+	{proto: "udp", name: "dport", typ: serviceType, base: NFT_PAYLOAD_TRANSPORT_HEADER, off: 2},
+	{proto: "icmp", name: "type", typ: u8Type, base: NFT_PAYLOAD_TRANSPORT_HEADER, off: 0},
+	{proto: "icmpv6", name: "type", typ: u8Type, base: NFT_PAYLOAD_TRANSPORT_HEADER, off: 0},
+	{proto: "meta", name: "l4proto", typ: protoType, kind: fieldMeta, key: NFT_META_L4PROTO},
+	{proto: "meta", name: "nfproto", typ: nfprotoType, kind: fieldMeta, key: NFT_META_NFPROTO},
+	{proto: "meta", name: "protocol", typ: ethertypeType, kind: fieldMeta, key: NFT_META_PROTOCOL},
+	{proto: "meta", name: "mark", typ: markType, kind: fieldMeta, key: NFT_META_MARK},
+	{proto: "meta", name: "iifname", typ: ifnameType, kind: fieldMeta, key: NFT_META_IIFNAME},
+	{proto: "meta", name: "oifname", typ: ifnameType, kind: fieldMeta, key: NFT_META_OIFNAME},
+	{proto: "meta", name: "skuid", typ: uidType, kind: fieldMeta, key: NFT_META_SKUID},
+	{proto: "ct", name: "state", typ: ctStateType, kind: fieldCt, key: NFT_CT_STATE},
+	{proto: "ct", name: "mark", typ: markType, kind: fieldCt, key: NFT_CT_MARK},
+}
+
+// Meta keys that can be written without the meta keyword.
+var bareMetaKeys = map[string]bool{
+	"iifname": true,
+	"oifname": true,
+	"mark":    true,
+	"l4proto": true,
+	"nfproto": true,
+	"skuid":   true,
+}
+
+var payloadBases = []string{
+	NFT_PAYLOAD_LL_HEADER:        "ll",
+	NFT_PAYLOAD_NETWORK_HEADER:   "nh",
+	NFT_PAYLOAD_TRANSPORT_HEADER: "th",
+	NFT_PAYLOAD_INNER_HEADER:     "ih",
+}
+
+var verdictNames = map[int32]string{
+	NF_ACCEPT:    "accept",
+	NF_DROP:      "drop",
+	NFT_CONTINUE: "continue",
+	NFT_RETURN:   "return",
+	NFT_JUMP:     "jump",
+	NFT_GOTO:     "goto",
+}
+
+var cmpOps = map[string]uint32{
+	"==": NFT_CMP_EQ,
+	"!=": NFT_CMP_NEQ,
+	"<":  NFT_CMP_LT,
+	"<=": NFT_CMP_LTE,
+	">":  NFT_CMP_GT,
+	">=": NFT_CMP_GTE,
+}
+
+func lookupField(proto, name string) *nftField {
+	for _, f := range nftFields {
+		if f.proto == proto && f.name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// rawField describes a payload range that has no name, written as
+// @base,offset,length with offset and length in bits.
+func rawField(base, off, length uint32) *nftField {
+	if base >= uint32(len(payloadBases)) {
+		return nil
+	}
+	return &nftField{
+		proto: fmt.Sprintf("@%s,%d,%d", payloadBases[base], off*8, length*8),
+		typ:   &nftType{id: NFT_TYPE_INTEGER, len: int(length), hex: true, parse: parseInt, format: formatInt},
+		base:  base,
+		off:   off,
+	}
+}
+
+func parseRawField(s string) (*nftField, error) {
+	parts := strings.Split(strings.TrimPrefix(s, "@"), ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("bad raw payload %q", s)
+	}
+	base := -1
+	for i, name := range payloadBases {
+		if name == parts[0] {
+			base = i
+		}
+	}
+	off, err1 := strconv.ParseUint(parts[1], 10, 32)
+	length, err2 := strconv.ParseUint(parts[2], 10, 32)
+	if base < 0 || err1 != nil || err2 != nil || off%8 != 0 || length%8 != 0 || length == 0 {
+		return nil, fmt.Errorf("bad raw payload %q", s)
+	}
+	return rawField(uint32(base), uint32(off/8), uint32(length/8)), nil
+}
+
+func (f *nftField) String() string {
+	switch {
+	case f.name == "":
+		return f.proto
+	case f.key == NFT_META_IIFNAME || f.key == NFT_META_OIFNAME:
+		if f.kind == fieldMeta {
+			return f.name
+		}
+	}
+	return f.proto + " " + f.name
+}
+
+// load returns the expression loading the field into dreg.
+func (f *nftField) load(dreg uint32) Expr {
+	switch f.kind {
+	case fieldMeta:
+		return &Meta{Key: f.key, Dreg: dreg}
+	case fieldCt:
+		return &Ct{Key: f.key, Dreg: dreg}
+	}
+	return &Payload{Base: f.base, Offset: f.off, Len: uint32(f.typ.len), Dreg: dreg}
+}
+
+// dependency returns the match, in text form, a rule needs before matching
+// the field in a table of the given family: the network protocol for ip and
+// ip6 headers in mixed families, the transport protocol for transport
+// headers.
+func (f *nftField) dependency(family uint8) string {
+	if f.kind != fieldPayload || f.name == "" {
+		return ""
+	}
+
+	if f.proto == "ip" || f.proto == "ip6" {
+		switch family {
+		case NFPROTO_INET:
+			return "meta nfproto " + map[string]string{"ip": "ipv4", "ip6": "ipv6"}[f.proto]
+		case NFPROTO_BRIDGE, NFPROTO_NETDEV:
+			return "meta protocol " + f.proto
+		}
+		return ""
+	}
+
+	return "meta l4proto " + f.proto
+}
+
+func (t *nftType) value(b []byte) uint64 {
+	if t.host {
+		switch len(b) {
+		case 2:
+			return uint64((&netlink.NetlinkAttr{Data: b}).Uint16())
+		case 4:
+			return uint64((&netlink.NetlinkAttr{Data: b}).Uint32())
+		case 8:
+			return (&netlink.NetlinkAttr{Data: b}).Uint64()
+		}
+	}
+	v := uint64(0)
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func (t *nftType) bytes(v uint64) []byte {
+	if t.host {
+		switch t.len {
+		case 2:
+			return netlink.NewAttrUint16(0, uint16(v)).Data
+		case 4:
+			return netlink.NewAttrUint32(0, uint32(v)).Data
+		case 8:
+			return netlink.NewAttrUint64(0, v).Data
+		}
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b[8-t.len:]
+}
+
+func parseAddr(t *nftType, s string) ([]byte, error) {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("bad address %q", s)
+	}
+	if t.len == net.IPv4len {
+		ip = ip.To4()
+		if ip == nil {
+			return nil, fmt.Errorf("%q is not an IPv4 address", s)
+		}
+	}
+	return []byte(ip), nil
+}
+
+func formatAddr(t *nftType, b []byte) string {
+	return net.IP(b).String()
+}
+
+// parseIfname encodes a link name, or a name prefix when it ends with "*".
+func parseIfname(t *nftType, s string) ([]byte, error) {
+	s = strings.Trim(s, "\"")
+	if strings.HasSuffix(s, "*") {
+		return []byte(strings.TrimSuffix(s, "*")), nil
+	}
+	if len(s) >= t.len {
+		return nil, fmt.Errorf("link name %q too long", s)
+	}
+	b := make([]byte, t.len)
+	copy(b, s)
+	return b, nil
+}
+
+func formatIfname(t *nftType, b []byte) string {
+	if i := strings.IndexByte(string(b), 0); i >= 0 {
+		return strconv.Quote(string(b[:i]))
+	}
+	return strconv.Quote(string(b) + "*")
+}
+
+func parseService(t *nftType, s string) ([]byte, error) {
+	v, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		port, err := net.LookupPort("tcp", s)
+		if err != nil {
+			return nil, fmt.Errorf("bad port %q", s)
+		}
+		v = uint64(port)
+	}
+	return t.bytes(v), nil
+}
+
+// parseInt parses a number or a symbolic name. Bitmask types take a list of
+// names separated by commas.
+func parseInt(t *nftType, s string) ([]byte, error) {
+	v := uint64(0)
+	for _, name := range strings.Split(s, ",") {
+		n, ok := t.names[name]
+		if !ok {
+			var err error
+			n, err = strconv.ParseUint(name, 0, t.len*8)
+			if err != nil && t.len > 8 && strings.HasPrefix(name, "0x") {
+				return parseHex(t, name)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("bad value %q", name)
+			}
+		}
+		if !t.bitmask && v != 0 {
+			return nil, fmt.Errorf("bad value %q", s)
+		}
+		v |= n
+	}
+	return t.bytes(v), nil
+}
+
+func parseHex(t *nftType, s string) ([]byte, error) {
+	s = strings.TrimPrefix(s, "0x")
+	if len(s)%2 != 0 {
+		s = "0" + s
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) > t.len {
+		return nil, fmt.Errorf("bad value %q", s)
+	}
+	return append(make([]byte, t.len-len(b)), b...), nil
+}
+
+func formatInt(t *nftType, b []byte) string {
+	if len(b) > 8 {
+		return "0x" + hex.EncodeToString(b)
+	}
+
+	v := t.value(b)
+
+	if t.bitmask {
+		names := []string{}
+		for bit := uint64(1); bit != 0 && bit <= v; bit <<= 1 {
+			if v&bit == 0 {
+				continue
+			}
+			name := nameOf(t.names, bit)
+			if name == "" {
+				return fmt.Sprintf("%#x", v)
+			}
+			names = append(names, name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	if name := nameOf(t.names, v); name != "" {
+		return name
+	}
+	if t.hex {
+		return fmt.Sprintf("0x%0*x", len(b)*2, v)
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+func nameOf(names map[string]uint64, v uint64) string {
+	for name, n := range names {
+		if n == v {
+			return name
+		}
+	}
+	return ""
+}
+
+// tokenize splits a rule into words, keeping quoted strings whole and
+// making braces and commas inside braces words of their own.
+func tokenize(s string) ([]string, error) {
+	toks := []string{}
+	depth := 0
+	i := 0
+
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '{' || c == '}':
+			if c == '{' {
+				depth++
+			} else {
+				depth--
+			}
+			toks = append(toks, string(c))
+			i++
+		case c == ',' && depth > 0:
+			toks = append(toks, ",")
+			i++
+		case c == '"':
+			j := strings.IndexByte(s[i+1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated string in %q", s)
+			}
+			toks = append(toks, s[i:i+j+2])
+			i += j + 2
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n{}\"", rune(s[j])) && !(s[j] == ',' && depth > 0) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		}
+	}
+
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced braces in %q", s)
+	}
+	return toks, nil
+}
@@ -0,0 +1,380 @@
+package netfilter
+
+import (
+	"syscall"
+
+	"github.com/apuigsech/netlink"
+)
+
+// Table is an nftables table. Family is one of NFPROTO_*.
+type Table struct {
+	Family uint8
+	Name   string
+	Flags  uint32
+	Handle uint64
+	Use    uint32
+	Attrs  []netlink.NetlinkAttr
+}
+
+// ChainHook attaches a base chain to a netfilter hook. Dev is the link of
+// netdev family chains.
+type ChainHook struct {
+	Hooknum  uint32
+	Priority int32
+	Dev      string
+}
+
+// Chain is an nftables chain. Chains with a Hook are base chains, of the
+// given Type ("filter" by default, "nat" or "route"), and Policy is their
+// default verdict, NF_ACCEPT or NF_DROP.
+type Chain struct {
+	Family    uint8
+	Table     string
+	Name      string
+	Handle    uint64
+	Hook      *ChainHook
+	Type      string
+	Policy    uint32
+	HasPolicy bool
+	Flags     uint32
+	Use       uint32
+	Attrs     []netlink.NetlinkAttr
+}
+
+// Rule is an nftables rule, a list of expressions evaluated in order.
+// Position is the handle of the rule a new rule is placed next to.
+type Rule struct {
+	Family   uint8
+	Table    string
+	Chain    string
+	Handle   uint64
+	Position uint64
+	Exprs    []Expr
+	UserData []byte
+	Attrs    []netlink.NetlinkAttr
+}
+
+func nftMsgType(msg uint8) uint16 {
+	return NfMsgType(NFNL_SUBSYS_NFTABLES, msg)
+}
+
+func TablefromMessage(m *NfMessage) (*Table, error) {
+	t := &Table{
+		Family: m.Header.Family,
+		Attrs:  m.Attrs,
+	}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFTA_TABLE_NAME:
+			t.Name = attr.String()
+		case NFTA_TABLE_FLAGS:
+			t.Flags = attr.NetUint32()
+		case NFTA_TABLE_USE:
+			t.Use = attr.NetUint32()
+		case NFTA_TABLE_HANDLE:
+			t.Handle = attr.NetUint64()
+		}
+	}
+
+	return t, nil
+}
+
+func (t *Table) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_TABLE_NAME, t.Name),
+	}
+	if t.Flags != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_TABLE_FLAGS, t.Flags))
+	}
+	return attrs
+}
+
+func ChainHookfromAttrs(attrs []netlink.NetlinkAttr) *ChainHook {
+	h := &ChainHook{}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NFTA_HOOK_HOOKNUM:
+			h.Hooknum = attr.NetUint32()
+		case NFTA_HOOK_PRIORITY:
+			h.Priority = int32(attr.NetUint32())
+		case NFTA_HOOK_DEV:
+			h.Dev = attr.String()
+		}
+	}
+	return h
+}
+
+func (h *ChainHook) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNetUint32(NFTA_HOOK_HOOKNUM, h.Hooknum),
+		netlink.NewAttrNetUint32(NFTA_HOOK_PRIORITY, uint32(h.Priority)),
+	}
+	if h.Dev != "" {
+		attrs = append(attrs, netlink.NewAttrString(NFTA_HOOK_DEV, h.Dev))
+	}
+	return attrs
+}
+
+func ChainfromMessage(m *NfMessage) (*Chain, error) {
+	c := &Chain{
+		Family: m.Header.Family,
+		Attrs:  m.Attrs,
+	}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFTA_CHAIN_TABLE:
+			c.Table = attr.String()
+		case NFTA_CHAIN_NAME:
+			c.Name = attr.String()
+		case NFTA_CHAIN_HANDLE:
+			c.Handle = attr.NetUint64()
+		case NFTA_CHAIN_HOOK:
+			hattrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			c.Hook = ChainHookfromAttrs(hattrs)
+		case NFTA_CHAIN_TYPE:
+			c.Type = attr.String()
+		case NFTA_CHAIN_POLICY:
+			c.Policy = attr.NetUint32()
+			c.HasPolicy = true
+		case NFTA_CHAIN_FLAGS:
+			c.Flags = attr.NetUint32()
+		case NFTA_CHAIN_USE:
+			c.Use = attr.NetUint32()
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Chain) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_CHAIN_TABLE, c.Table),
+		netlink.NewAttrString(NFTA_CHAIN_NAME, c.Name),
+	}
+	if c.Hook != nil {
+		chainType := c.Type
+		if chainType == "" {
+			chainType = "filter"
+		}
+		attrs = append(attrs,
+			netlink.NewAttrNested(NFTA_CHAIN_HOOK, c.Hook.toAttrs()),
+			netlink.NewAttrString(NFTA_CHAIN_TYPE, chainType))
+		if c.HasPolicy {
+			attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_CHAIN_POLICY, c.Policy))
+		}
+	}
+	if c.Flags != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(NFTA_CHAIN_FLAGS, c.Flags))
+	}
+	return attrs
+}
+
+func RulefromMessage(m *NfMessage) (*Rule, error) {
+	r := &Rule{
+		Family: m.Header.Family,
+		Attrs:  m.Attrs,
+	}
+
+	for _, attr := range m.Attrs {
+		switch attr.AttrType() {
+		case NFTA_RULE_TABLE:
+			r.Table = attr.String()
+		case NFTA_RULE_CHAIN:
+			r.Chain = attr.String()
+		case NFTA_RULE_HANDLE:
+			r.Handle = attr.NetUint64()
+		case NFTA_RULE_POSITION:
+			r.Position = attr.NetUint64()
+		case NFTA_RULE_USERDATA:
+			r.UserData = attr.Data
+		case NFTA_RULE_EXPRESSIONS:
+			exprs, err := ExprsfromAttr(&attr)
+			if err != nil {
+				return nil, err
+			}
+			r.Exprs = exprs
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Rule) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_RULE_TABLE, r.Table),
+		netlink.NewAttrString(NFTA_RULE_CHAIN, r.Chain),
+	}
+	if r.Handle != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint64(NFTA_RULE_HANDLE, r.Handle))
+	}
+	if r.Position != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint64(NFTA_RULE_POSITION, r.Position))
+	}
+	if len(r.Exprs) != 0 {
+		attrs = append(attrs, exprsAttr(NFTA_RULE_EXPRESSIONS, r.Exprs))
+	}
+	if r.UserData != nil {
+		attrs = append(attrs, netlink.NewAttr(NFTA_RULE_USERDATA, r.UserData))
+	}
+	return attrs
+}
+
+// AddTable creates the table, or does nothing if it exists.
+func (b *Batch) AddTable(t *Table) {
+	b.Add(nftMsgType(NFT_MSG_NEWTABLE), syscall.NLM_F_CREATE, t.Family, t.toAttrs())
+}
+
+// DelTable deletes the table with everything it contains.
+func (b *Batch) DelTable(t *Table) {
+	b.Add(nftMsgType(NFT_MSG_DELTABLE), 0, t.Family, t.toAttrs())
+}
+
+// FlushTable deletes every rule of the table.
+func (b *Batch) FlushTable(t *Table) {
+	b.Add(nftMsgType(NFT_MSG_DELRULE), 0, t.Family, []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_RULE_TABLE, t.Name),
+	})
+}
+
+// AddChain creates the chain, or updates the policy of an existing one.
+func (b *Batch) AddChain(c *Chain) {
+	b.Add(nftMsgType(NFT_MSG_NEWCHAIN), syscall.NLM_F_CREATE, c.Family, c.toAttrs())
+}
+
+// DelChain deletes the chain, which must be empty and not referenced.
+func (b *Batch) DelChain(c *Chain) {
+	b.Add(nftMsgType(NFT_MSG_DELCHAIN), 0, c.Family, []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_CHAIN_TABLE, c.Table),
+		netlink.NewAttrString(NFTA_CHAIN_NAME, c.Name),
+	})
+}
+
+// FlushChain deletes every rule of the chain.
+func (b *Batch) FlushChain(c *Chain) {
+	b.Add(nftMsgType(NFT_MSG_DELRULE), 0, c.Family, []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_RULE_TABLE, c.Table),
+		netlink.NewAttrString(NFTA_RULE_CHAIN, c.Name),
+	})
+}
+
+// AddRule appends the rule to its chain, or places it after the rule given
+// by Position.
+func (b *Batch) AddRule(r *Rule) {
+	b.Add(nftMsgType(NFT_MSG_NEWRULE), syscall.NLM_F_CREATE|syscall.NLM_F_APPEND, r.Family, r.toAttrs())
+}
+
+// InsertRule prepends the rule to its chain, or places it before the rule
+// given by Position.
+func (b *Batch) InsertRule(r *Rule) {
+	b.Add(nftMsgType(NFT_MSG_NEWRULE), syscall.NLM_F_CREATE, r.Family, r.toAttrs())
+}
+
+// ReplaceRule replaces the rule with the same Handle.
+func (b *Batch) ReplaceRule(r *Rule) {
+	b.Add(nftMsgType(NFT_MSG_NEWRULE), syscall.NLM_F_REPLACE, r.Family, r.toAttrs())
+}
+
+// DelRule deletes the rule with the given Handle.
+func (b *Batch) DelRule(r *Rule) {
+	b.Add(nftMsgType(NFT_MSG_DELRULE), 0, r.Family, []netlink.NetlinkAttr{
+		netlink.NewAttrString(NFTA_RULE_TABLE, r.Table),
+		netlink.NewAttrString(NFTA_RULE_CHAIN, r.Chain),
+		netlink.NewAttrNetUint64(NFTA_RULE_HANDLE, r.Handle),
+	})
+}
+
+func (nfl *NetfilterNLSocket) dump(msg uint8, family uint8, attrs []netlink.NetlinkAttr) ([]*NfMessage, error) {
+	msgList, err := nfl.Execute(nftMsgType(msg), syscall.NLM_F_DUMP, family, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*NfMessage{}
+	for _, m := range msgList {
+		if NfSubsysId(m.Type) == NFNL_SUBSYS_NFTABLES {
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+// ListTables dumps the tables of the given family, NFPROTO_UNSPEC for all.
+func (nfl *NetfilterNLSocket) ListTables(family uint8) ([]*Table, error) {
+	msgList, err := nfl.dump(NFT_MSG_GETTABLE, family, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Table{}
+
+	for _, m := range msgList {
+		t, err := TablefromMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, t)
+	}
+
+	return ret, nil
+}
+
+// ListChains dumps the chains of the given family, limited to one table
+// when table is not empty.
+func (nfl *NetfilterNLSocket) ListChains(family uint8, table string) ([]*Chain, error) {
+	msgList, err := nfl.dump(NFT_MSG_GETCHAIN, family, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Chain{}
+
+	for _, m := range msgList {
+		c, err := ChainfromMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		if table != "" && c.Table != table {
+			continue
+		}
+		ret = append(ret, c)
+	}
+
+	return ret, nil
+}
+
+// ListRules dumps the rules of the given family, limited to one table and
+// chain when they are not empty.
+func (nfl *NetfilterNLSocket) ListRules(family uint8, table, chain string) ([]*Rule, error) {
+	attrs := []netlink.NetlinkAttr{}
+	if table != "" {
+		attrs = append(attrs, netlink.NewAttrString(NFTA_RULE_TABLE, table))
+		if chain != "" {
+			attrs = append(attrs, netlink.NewAttrString(NFTA_RULE_CHAIN, chain))
+		}
+	}
+
+	msgList, err := nfl.dump(NFT_MSG_GETRULE, family, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Rule{}
+
+	for _, m := range msgList {
+		r, err := RulefromMessage(m)
+		if err != nil {
+			return nil, err
+		}
+		if (table != "" && r.Table != table) || (chain != "" && r.Chain != chain) {
+			continue
+		}
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
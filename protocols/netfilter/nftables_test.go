@@ -0,0 +1,232 @@
+package netfilter
+
+import (
+	"bytes"
+	"syscall"
+	"testing"
+)
+
+func TestTableWireFormat(t *testing.T) {
+	table := &Table{Family: NFPROTO_INET, Name: "filter", Flags: NFT_TABLE_F_DORMANT}
+
+	got, err := TablefromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWTABLE), table.Family, table.toAttrs()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Family != NFPROTO_INET || got.Name != "filter" || got.Flags != NFT_TABLE_F_DORMANT {
+		t.Errorf("got %+v", got)
+	}
+
+	if attrs := (&Table{Name: "filter"}).toAttrs(); len(attrs) != 1 {
+		t.Errorf("flags sent: %+v", attrs)
+	}
+}
+
+func TestChainWireFormat(t *testing.T) {
+	chain := &Chain{
+		Family:    NFPROTO_IPV4,
+		Table:     "filter",
+		Name:      "input",
+		Hook:      &ChainHook{Hooknum: NF_INET_LOCAL_IN, Priority: -150},
+		Policy:    NF_DROP,
+		HasPolicy: true,
+	}
+
+	got, err := ChainfromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWCHAIN), chain.Family, chain.toAttrs()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* base chains are filter chains by default */
+	if got.Table != "filter" || got.Name != "input" || got.Type != "filter" || !got.HasPolicy || got.Policy != NF_DROP {
+		t.Errorf("got %+v", got)
+	}
+	if got.Hook == nil || *got.Hook != *chain.Hook {
+		t.Errorf("hook %+v", got.Hook)
+	}
+
+	netdev := &Chain{Family: NFPROTO_NETDEV, Table: "t", Name: "ingress", Type: "filter",
+		Hook: &ChainHook{Hooknum: NF_NETDEV_INGRESS, Dev: "eth0"}}
+	got, _ = ChainfromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWCHAIN), netdev.Family, netdev.toAttrs()))
+	if got.Hook == nil || got.Hook.Dev != "eth0" || got.HasPolicy {
+		t.Errorf("netdev hook %+v", got.Hook)
+	}
+
+	/* regular chains have neither a type nor a policy */
+	got, _ = ChainfromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWCHAIN), NFPROTO_IPV4,
+		(&Chain{Table: "filter", Name: "other", Policy: NF_DROP, HasPolicy: true}).toAttrs()))
+	if got.Hook != nil || got.Type != "" || got.HasPolicy {
+		t.Errorf("regular chain %+v", got)
+	}
+}
+
+func TestRuleWireFormat(t *testing.T) {
+	rule := &Rule{
+		Family:   NFPROTO_INET,
+		Table:    "filter",
+		Chain:    "input",
+		Handle:   4,
+		Position: 2,
+		Exprs: []Expr{
+			&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+			&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_TCP}},
+			&Verdict{Code: NF_ACCEPT},
+		},
+		UserData: []byte{0, 3, 'a', 'b', 'c'},
+	}
+
+	got, err := RulefromMessage(testMessage(t, nftMsgType(NFT_MSG_NEWRULE), rule.Family, rule.toAttrs()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Table != "filter" || got.Chain != "input" || got.Handle != 4 || got.Position != 2 ||
+		!bytes.Equal(got.UserData, rule.UserData) || len(got.Exprs) != 3 {
+		t.Fatalf("got %+v", got)
+	}
+	if v, ok := got.Exprs[2].(*Verdict); !ok || v.Code != NF_ACCEPT {
+		t.Errorf("verdict %#v", got.Exprs[2])
+	}
+
+	/* a new rule has no handle, position, expressions or user data */
+	if attrs := (&Rule{Table: "filter", Chain: "input"}).toAttrs(); len(attrs) != 2 {
+		t.Errorf("got %+v", attrs)
+	}
+}
+
+func findChain(chains []*Chain, name string) *Chain {
+	for _, c := range chains {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func TestNftables(t *testing.T) {
+	nfl := testNetns(t)
+
+	table := &Table{Family: NFPROTO_INET, Name: "filter"}
+	input := &Chain{Family: NFPROTO_INET, Table: "filter", Name: "input",
+		Hook: &ChainHook{Hooknum: NF_INET_LOCAL_IN}, Policy: NF_ACCEPT, HasPolicy: true}
+	other := &Chain{Family: NFPROTO_INET, Table: "filter", Name: "other"}
+	tcp := []Expr{
+		&Meta{Key: NFT_META_L4PROTO, Dreg: NFT_REG_1},
+		&Cmp{Op: NFT_CMP_EQ, Sreg: NFT_REG_1, Data: []byte{syscall.IPPROTO_TCP}},
+		&Counter{},
+		&Verdict{Code: NFT_JUMP, Chain: "other"},
+	}
+
+	b := NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.AddTable(table)
+	b.AddChain(input)
+	b.AddChain(other)
+	b.AddRule(&Rule{Family: NFPROTO_INET, Table: "filter", Chain: "input", Exprs: tcp})
+	b.AddRule(&Rule{Family: NFPROTO_INET, Table: "filter", Chain: "other", Exprs: []Expr{&Verdict{Code: NF_DROP}}})
+	err := nfl.ExecuteBatch(b)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tables, err := nfl.ListTables(NFPROTO_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tables) != 1 || tables[0].Name != "filter" || tables[0].Use != 2 || tables[0].Handle == 0 {
+		t.Errorf("tables %+v", tables)
+	}
+	tables, _ = nfl.ListTables(NFPROTO_IPV6)
+	if len(tables) != 0 {
+		t.Errorf("inet table listed as IPv6: %+v", tables)
+	}
+
+	chains, err := nfl.ListChains(NFPROTO_INET, "filter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := findChain(chains, "input")
+	if c == nil || c.Hook == nil || c.Hook.Hooknum != NF_INET_LOCAL_IN || c.Type != "filter" || !c.HasPolicy ||
+		c.Policy != NF_ACCEPT || c.Use != 1 {
+		t.Errorf("input chain %+v", c)
+	}
+	/* other is used by its rule and by the jump to it */
+	if c := findChain(chains, "other"); c == nil || c.Hook != nil || c.Use != 2 {
+		t.Errorf("other chain %+v", c)
+	}
+
+	rules, err := nfl.ListRules(NFPROTO_INET, "filter", "input")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 1 || rules[0].Chain != "input" || rules[0].Handle == 0 || len(rules[0].Exprs) != 4 {
+		t.Fatalf("rules of input: %+v", rules)
+	}
+	if v, ok := rules[0].Exprs[3].(*Verdict); !ok || v.Code != NFT_JUMP || v.Chain != "other" {
+		t.Errorf("verdict %#v", rules[0].Exprs[3])
+	}
+	handle := rules[0].Handle
+	rules, _ = nfl.ListRules(NFPROTO_INET, "filter", "")
+	if len(rules) != 2 {
+		t.Errorf("rules of filter: %+v", rules)
+	}
+
+	/* a rule is inserted before the one given by Position */
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.InsertRule(&Rule{Family: NFPROTO_INET, Table: "filter", Chain: "input", Position: handle,
+		Exprs: []Expr{&Counter{}}})
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _ = nfl.ListRules(NFPROTO_INET, "filter", "input")
+	if len(rules) != 2 || len(rules[0].Exprs) != 1 || rules[1].Handle != handle {
+		t.Fatalf("rules after insert: %+v", rules)
+	}
+
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.ReplaceRule(&Rule{Family: NFPROTO_INET, Table: "filter", Chain: "input", Handle: handle,
+		Exprs: []Expr{&Verdict{Code: NF_ACCEPT}}})
+	b.DelRule(rules[0])
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _ = nfl.ListRules(NFPROTO_INET, "filter", "input")
+	if len(rules) != 1 || rules[0].Handle != handle || len(rules[0].Exprs) != 1 {
+		t.Errorf("rules after replace: %+v", rules)
+	}
+
+	/* nothing jumps to other any more */
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.FlushChain(other)
+	b.DelChain(other)
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains, _ = nfl.ListChains(NFPROTO_INET, "filter")
+	if findChain(chains, "other") != nil {
+		t.Error("deleted chain still listed")
+	}
+
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.FlushTable(table)
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _ = nfl.ListRules(NFPROTO_INET, "filter", "")
+	if len(rules) != 0 {
+		t.Errorf("rules of a flushed table: %+v", rules)
+	}
+
+	b = NewBatch(NFNL_SUBSYS_NFTABLES)
+	b.DelTable(table)
+	err = nfl.ExecuteBatch(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, _ = nfl.ListTables(NFPROTO_UNSPEC)
+	if len(tables) != 0 {
+		t.Errorf("deleted table still listed: %+v", tables)
+	}
+}
@@ -0,0 +1,242 @@
+package route
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofIfAddrmsg    = 8
+	SizeofIfaCacheinfo = 16
+)
+
+type IfAddrmsg struct {
+	Family    uint8
+	PrefixLen uint8
+	Flags     uint8 /* IFA_F_*, see IFA_FLAGS for the full set */
+	Scope     uint8 /* RT_SCOPE_* */
+	Index     int32
+}
+
+type IfaCacheinfo struct {
+	Prefered uint32
+	Valid    uint32
+	Cstamp   uint32 /* created timestamp, hundredths of seconds */
+	Tstamp   uint32 /* updated timestamp, hundredths of seconds */
+}
+
+// Address is an interface address. For point to point addresses Peer holds
+// the remote end. Lifetimes are in seconds, INFINITY_LIFE_TIME means forever
+// and a zero ValidLft leaves the address permanent when it is added.
+type Address struct {
+	Index        int32
+	Family       uint8
+	Local        net.IP
+	PrefixLen    uint8
+	Peer         net.IP
+	Broadcast    net.IP
+	Label        string
+	Scope        uint8  /* RT_SCOPE_* */
+	Flags        uint32 /* IFA_F_* */
+	ValidLft     uint32
+	PreferredLft uint32
+	Cacheinfo    *IfaCacheinfo
+	Attrs        []netlink.NetlinkAttr
+}
+
+func IfAddrmsgfromWireFormat(data []byte) *IfAddrmsg {
+	return &IfAddrmsg{
+		Family:    data[0],
+		PrefixLen: data[1],
+		Flags:     data[2],
+		Scope:     data[3],
+		Index:     *(*int32)(unsafe.Pointer(&data[4:8][0])),
+	}
+}
+
+func (ifa *IfAddrmsg) toWireFormat() []byte {
+	b := make([]byte, SizeofIfAddrmsg)
+	b[0] = ifa.Family
+	b[1] = ifa.PrefixLen
+	b[2] = ifa.Flags
+	b[3] = ifa.Scope
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = ifa.Index
+	return b
+}
+
+func IfaCacheinfofromWireFormat(data []byte) *IfaCacheinfo {
+	return &IfaCacheinfo{
+		Prefered: *(*uint32)(unsafe.Pointer(&data[0:4][0])),
+		Valid:    *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		Cstamp:   *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+		Tstamp:   *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+	}
+}
+
+func (ci *IfaCacheinfo) toWireFormat() []byte {
+	b := make([]byte, SizeofIfaCacheinfo)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = ci.Prefered
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = ci.Valid
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = ci.Cstamp
+	*(*uint32)(unsafe.Pointer(&b[12:16][0])) = ci.Tstamp
+	return b
+}
+
+// ipFamily returns the address family of ip and its wire representation.
+func ipFamily(ip net.IP) (uint8, []byte) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return syscall.AF_INET, ip4
+	}
+	return syscall.AF_INET6, ip.To16()
+}
+
+func (a *Address) IPNet() *net.IPNet {
+	bits := 128
+	if a.Family == syscall.AF_INET {
+		bits = 32
+	}
+	return &net.IPNet{IP: a.Local, Mask: net.CIDRMask(int(a.PrefixLen), bits)}
+}
+
+func AddressfromWireFormat(data []byte) (*Address, error) {
+	if len(data) < SizeofIfAddrmsg {
+		return nil, errors.New("short ifaddrmsg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofIfAddrmsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	ifa := IfAddrmsgfromWireFormat(data)
+	a := &Address{
+		Index:     ifa.Index,
+		Family:    ifa.Family,
+		PrefixLen: ifa.PrefixLen,
+		Scope:     ifa.Scope,
+		Flags:     uint32(ifa.Flags),
+		Attrs:     attrs,
+	}
+
+	var address net.IP
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFA_ADDRESS:
+			address = net.IP(attr.Data)
+		case IFA_LOCAL:
+			a.Local = net.IP(attr.Data)
+		case IFA_BROADCAST:
+			a.Broadcast = net.IP(attr.Data)
+		case IFA_LABEL:
+			a.Label = attr.String()
+		case IFA_FLAGS:
+			a.Flags = attr.Uint32()
+		case IFA_CACHEINFO:
+			if len(attr.Data) >= SizeofIfaCacheinfo {
+				a.Cacheinfo = IfaCacheinfofromWireFormat(attr.Data)
+				a.ValidLft = a.Cacheinfo.Valid
+				a.PreferredLft = a.Cacheinfo.Prefered
+			}
+		}
+	}
+
+	if a.Local == nil {
+		a.Local = address
+	} else if address != nil && !address.Equal(a.Local) {
+		a.Peer = address
+	}
+
+	return a, nil
+}
+
+func (a *Address) toWireFormat() []byte {
+	family, local := ipFamily(a.Local)
+
+	ifa := &IfAddrmsg{
+		Family:    family,
+		PrefixLen: a.PrefixLen,
+		Flags:     uint8(a.Flags),
+		Scope:     a.Scope,
+		Index:     a.Index,
+	}
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(IFA_LOCAL, local),
+	}
+
+	if a.Peer != nil {
+		_, peer := ipFamily(a.Peer)
+		attrs = append(attrs, netlink.NewAttr(IFA_ADDRESS, peer))
+	} else {
+		attrs = append(attrs, netlink.NewAttr(IFA_ADDRESS, local))
+	}
+	if a.Broadcast != nil {
+		_, brd := ipFamily(a.Broadcast)
+		attrs = append(attrs, netlink.NewAttr(IFA_BROADCAST, brd))
+	}
+	if a.Label != "" {
+		attrs = append(attrs, netlink.NewAttrString(IFA_LABEL, a.Label))
+	}
+	if a.Flags != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFA_FLAGS, a.Flags))
+	}
+	if a.ValidLft != 0 {
+		ci := &IfaCacheinfo{Prefered: a.PreferredLft, Valid: a.ValidLft}
+		attrs = append(attrs, netlink.NewAttr(IFA_CACHEINFO, ci.toWireFormat()))
+	}
+
+	return append(ifa.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+}
+
+// ListAddrs dumps the addresses of the given family (AF_UNSPEC for all) on
+// the given interface (0 for all). The kernel filters the dump itself when
+// it supports strict checking.
+func (rl *RouteNLSocket) ListAddrs(family uint8, index int32) ([]*Address, error) {
+	ifa := &IfAddrmsg{Family: family, Index: index}
+
+	msgList, err := rl.dumpStrict(RTM_GETADDR, ifa.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Address{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWADDR {
+			continue
+		}
+		a, err := AddressfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if family != syscall.AF_UNSPEC && a.Family != family {
+			continue
+		}
+		if index != 0 && a.Index != index {
+			continue
+		}
+		ret = append(ret, a)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddAddr(addr *Address) error {
+	_, err := rl.Execute(RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, addr.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) ReplaceAddr(addr *Address) error {
+	_, err := rl.Execute(RTM_NEWADDR, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, addr.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) DelAddr(addr *Address) error {
+	_, err := rl.Execute(RTM_DELADDR, 0, addr.toWireFormat())
+	return err
+}
@@ -0,0 +1,164 @@
+package route
+
+import (
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestIfAddrmsgWireFormat(t *testing.T) {
+	ifa := &IfAddrmsg{Family: syscall.AF_INET6, PrefixLen: 64, Flags: IFA_F_NODAD, Scope: RT_SCOPE_LINK, Index: 4}
+
+	b := ifa.toWireFormat()
+	if len(b) != SizeofIfAddrmsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := IfAddrmsgfromWireFormat(b); *got != *ifa {
+		t.Errorf("got %+v, want %+v", got, ifa)
+	}
+}
+
+func TestAddressWireFormat(t *testing.T) {
+	a := &Address{
+		Index:        2,
+		Local:        net.ParseIP("192.0.2.1"),
+		PrefixLen:    24,
+		Broadcast:    net.ParseIP("192.0.2.255"),
+		Label:        "eth0:1",
+		Flags:        IFA_F_NOPREFIXROUTE,
+		ValidLft:     600,
+		PreferredLft: 300,
+	}
+
+	got, err := AddressfromWireFormat(a.toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Family != syscall.AF_INET || got.Index != 2 || !got.Local.Equal(a.Local) || got.PrefixLen != 24 ||
+		!got.Broadcast.Equal(a.Broadcast) || got.Label != "eth0:1" || got.Flags != IFA_F_NOPREFIXROUTE {
+		t.Errorf("got %+v", got)
+	}
+	if got.Peer != nil {
+		t.Errorf("peer %s", got.Peer)
+	}
+	if got.Cacheinfo == nil || got.ValidLft != 600 || got.PreferredLft != 300 {
+		t.Errorf("lifetimes %d/%d", got.ValidLft, got.PreferredLft)
+	}
+	if n := got.IPNet().String(); n != "192.0.2.1/24" {
+		t.Errorf("IPNet %s", n)
+	}
+
+	/* the flags above 8 bits only fit in IFA_FLAGS */
+	if ifa := IfAddrmsgfromWireFormat(a.toWireFormat()); ifa.Flags != 0 {
+		t.Errorf("ifa_flags %#x", ifa.Flags)
+	}
+}
+
+func TestAddressPeer(t *testing.T) {
+	a := &Address{Local: net.ParseIP("2001:db8::1"), Peer: net.ParseIP("2001:db8::2"), PrefixLen: 128}
+
+	got, err := AddressfromWireFormat(a.toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Family != syscall.AF_INET6 || !got.Local.Equal(a.Local) || !got.Peer.Equal(a.Peer) {
+		t.Errorf("got %+v", got)
+	}
+
+	if _, err := AddressfromWireFormat(make([]byte, SizeofIfAddrmsg-1)); err == nil {
+		t.Error("short ifaddrmsg accepted")
+	}
+}
+
+func TestAddrs(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	veth := mustLink(t, rl, "veth0")
+	peer := mustLink(t, rl, "veth1")
+
+	addrs := []*Address{
+		{Index: veth.Index, Local: net.ParseIP("192.0.2.1"), PrefixLen: 24, Label: "veth0:a"},
+		{Index: veth.Index, Local: net.ParseIP("2001:db8::1"), PrefixLen: 64, Flags: IFA_F_NODAD},
+		{Index: peer.Index, Local: net.ParseIP("198.51.100.1"), PrefixLen: 32, ValidLft: 600, PreferredLft: 300},
+	}
+	for _, a := range addrs {
+		err := rl.AddAddr(a)
+		if err != nil {
+			t.Fatalf("%s: %v", a.Local, err)
+		}
+	}
+
+	err = rl.AddAddr(addrs[0])
+	if err != syscall.EEXIST {
+		t.Errorf("adding %s again: %v", addrs[0].Local, err)
+	}
+
+	got, err := rl.ListAddrs(syscall.AF_INET, veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].Local.Equal(addrs[0].Local) || got[0].Label != "veth0:a" {
+		t.Errorf("IPv4 addresses of veth0: %+v", got)
+	}
+
+	got, err = rl.ListAddrs(syscall.AF_INET6, veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, a := range got {
+		if a.Index != veth.Index || a.Family != syscall.AF_INET6 {
+			t.Errorf("unexpected address %+v", a)
+		}
+		if a.Local.Equal(addrs[1].Local) {
+			found = a.Flags&IFA_F_NODAD != 0 && a.Flags&IFA_F_PERMANENT != 0
+		}
+	}
+	if !found {
+		t.Errorf("IPv6 addresses of veth0: %+v", got)
+	}
+
+	got, err = rl.ListAddrs(syscall.AF_UNSPEC, peer.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ValidLft == 0 || got[0].ValidLft > 600 || got[0].Flags&IFA_F_PERMANENT != 0 {
+		t.Errorf("addresses of veth1: %+v", got)
+	}
+
+	/* replacing updates the lifetimes */
+	addrs[2].ValidLft = INFINITY_LIFE_TIME
+	addrs[2].PreferredLft = INFINITY_LIFE_TIME
+	err = rl.ReplaceAddr(addrs[2])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = rl.ListAddrs(syscall.AF_INET, peer.Index)
+	if len(got) != 1 || got[0].ValidLft != INFINITY_LIFE_TIME {
+		t.Errorf("replaced address: %+v", got)
+	}
+
+	err = rl.DelAddr(addrs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = rl.ListAddrs(syscall.AF_INET, veth.Index)
+	if len(got) != 0 {
+		t.Errorf("deleted address still listed: %+v", got)
+	}
+	err = rl.DelAddr(addrs[0])
+	if err != syscall.EADDRNOTAVAIL {
+		t.Errorf("deleting %s again: %v", addrs[0].Local, err)
+	}
+
+	/* the dump leaves strict checking as it was */
+	strict, err := rl.StrictCheck()
+	if err == nil && strict {
+		t.Error("strict checking left on")
+	}
+}
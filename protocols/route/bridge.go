@@ -0,0 +1,324 @@
+package route
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofBridgeVlanInfo = 4
+	SizeofBrVlanMsg      = 8
+)
+
+// BridgePort holds the options of a bridge port. State is read only here,
+// see SetBridgePortState.
+type BridgePort struct {
+	State          uint8 /* BR_STATE_* */
+	Priority       uint16
+	Cost           uint32
+	Hairpin        bool
+	Guard          bool
+	RootBlock      bool
+	FastLeave      bool
+	Learning       bool
+	UnicastFlood   bool
+	MulticastFlood bool
+	BroadcastFlood bool
+	ProxyArp       bool
+	NeighSuppress  bool
+	Isolated       bool
+}
+
+type BridgeVlanInfo struct {
+	Flags uint16 /* BRIDGE_VLAN_INFO_* */
+	Vid   uint16
+}
+
+type BrVlanMsg struct {
+	Family uint8
+	Index  int32
+}
+
+// BridgeVlan is the membership of a bridge port, or of the bridge itself, in
+// a vlan or, when VidEnd is set, in the range Vid to VidEnd. Flags carries
+// BRIDGE_VLAN_INFO_PVID and BRIDGE_VLAN_INFO_UNTAGGED.
+type BridgeVlan struct {
+	Index  int32
+	Vid    uint16
+	VidEnd uint16
+	Flags  uint16
+	State  uint8 /* BR_STATE_*, per vlan STP state */
+}
+
+func BridgePortfromAttrs(attrs []netlink.NetlinkAttr) *BridgePort {
+	p := &BridgePort{}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_BRPORT_STATE:
+			p.State = attr.Uint8()
+		case IFLA_BRPORT_PRIORITY:
+			p.Priority = attr.Uint16()
+		case IFLA_BRPORT_COST:
+			p.Cost = attr.Uint32()
+		case IFLA_BRPORT_MODE:
+			p.Hairpin = attr.Uint8() != 0
+		case IFLA_BRPORT_GUARD:
+			p.Guard = attr.Uint8() != 0
+		case IFLA_BRPORT_PROTECT:
+			p.RootBlock = attr.Uint8() != 0
+		case IFLA_BRPORT_FAST_LEAVE:
+			p.FastLeave = attr.Uint8() != 0
+		case IFLA_BRPORT_LEARNING:
+			p.Learning = attr.Uint8() != 0
+		case IFLA_BRPORT_UNICAST_FLOOD:
+			p.UnicastFlood = attr.Uint8() != 0
+		case IFLA_BRPORT_MCAST_FLOOD:
+			p.MulticastFlood = attr.Uint8() != 0
+		case IFLA_BRPORT_BCAST_FLOOD:
+			p.BroadcastFlood = attr.Uint8() != 0
+		case IFLA_BRPORT_PROXYARP:
+			p.ProxyArp = attr.Uint8() != 0
+		case IFLA_BRPORT_NEIGH_SUPPRESS:
+			p.NeighSuppress = attr.Uint8() != 0
+		case IFLA_BRPORT_ISOLATED:
+			p.Isolated = attr.Uint8() != 0
+		}
+	}
+	return p
+}
+
+// toAttrs encodes every option but the state, so a port read with
+// GetBridgePort can be changed and written back as a whole.
+func (p *BridgePort) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+	if p.Priority != 0 {
+		attrs = append(attrs, netlink.NewAttrUint16(IFLA_BRPORT_PRIORITY, p.Priority))
+	}
+	if p.Cost != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_BRPORT_COST, p.Cost))
+	}
+	attrs = append(attrs,
+		netlink.NewAttrUint8(IFLA_BRPORT_MODE, boolToUint8(p.Hairpin)),
+		netlink.NewAttrUint8(IFLA_BRPORT_GUARD, boolToUint8(p.Guard)),
+		netlink.NewAttrUint8(IFLA_BRPORT_PROTECT, boolToUint8(p.RootBlock)),
+		netlink.NewAttrUint8(IFLA_BRPORT_FAST_LEAVE, boolToUint8(p.FastLeave)),
+		netlink.NewAttrUint8(IFLA_BRPORT_LEARNING, boolToUint8(p.Learning)),
+		netlink.NewAttrUint8(IFLA_BRPORT_UNICAST_FLOOD, boolToUint8(p.UnicastFlood)),
+		netlink.NewAttrUint8(IFLA_BRPORT_MCAST_FLOOD, boolToUint8(p.MulticastFlood)),
+		netlink.NewAttrUint8(IFLA_BRPORT_BCAST_FLOOD, boolToUint8(p.BroadcastFlood)),
+		netlink.NewAttrUint8(IFLA_BRPORT_PROXYARP, boolToUint8(p.ProxyArp)),
+		netlink.NewAttrUint8(IFLA_BRPORT_NEIGH_SUPPRESS, boolToUint8(p.NeighSuppress)),
+		netlink.NewAttrUint8(IFLA_BRPORT_ISOLATED, boolToUint8(p.Isolated)),
+	)
+	return attrs
+}
+
+func BridgeVlanInfofromWireFormat(data []byte) *BridgeVlanInfo {
+	return &BridgeVlanInfo{
+		Flags: *(*uint16)(unsafe.Pointer(&data[0:2][0])),
+		Vid:   *(*uint16)(unsafe.Pointer(&data[2:4][0])),
+	}
+}
+
+func (vi *BridgeVlanInfo) toWireFormat() []byte {
+	b := make([]byte, SizeofBridgeVlanInfo)
+	*(*uint16)(unsafe.Pointer(&b[0:2][0])) = vi.Flags
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = vi.Vid
+	return b
+}
+
+func BrVlanMsgfromWireFormat(data []byte) *BrVlanMsg {
+	return &BrVlanMsg{
+		Family: data[0],
+		Index:  *(*int32)(unsafe.Pointer(&data[4:8][0])),
+	}
+}
+
+func (bvm *BrVlanMsg) toWireFormat() []byte {
+	b := make([]byte, SizeofBrVlanMsg)
+	b[0] = bvm.Family
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = bvm.Index
+	return b
+}
+
+// BridgeVlansfromWireFormat decodes a RTM_NEWVLAN message, which holds the
+// vlans of a single port.
+func BridgeVlansfromWireFormat(data []byte) ([]*BridgeVlan, error) {
+	if len(data) < SizeofBrVlanMsg {
+		return nil, errors.New("short br_vlan_msg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofBrVlanMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	bvm := BrVlanMsgfromWireFormat(data)
+	ret := []*BridgeVlan{}
+
+	for _, attr := range attrs {
+		if attr.AttrType() != BRIDGE_VLANDB_ENTRY {
+			continue
+		}
+		entry, err := attr.Nested()
+		if err != nil {
+			return nil, err
+		}
+		v := &BridgeVlan{Index: bvm.Index}
+		for _, eattr := range entry {
+			switch eattr.AttrType() {
+			case BRIDGE_VLANDB_ENTRY_INFO:
+				if len(eattr.Data) >= SizeofBridgeVlanInfo {
+					vi := BridgeVlanInfofromWireFormat(eattr.Data)
+					v.Vid = vi.Vid
+					v.Flags = vi.Flags
+				}
+			case BRIDGE_VLANDB_ENTRY_RANGE:
+				v.VidEnd = eattr.Uint16()
+			case BRIDGE_VLANDB_ENTRY_STATE:
+				v.State = eattr.Uint8()
+			}
+		}
+		if v.VidEnd == v.Vid {
+			v.VidEnd = 0
+		}
+		ret = append(ret, v)
+	}
+
+	return ret, nil
+}
+
+func (v *BridgeVlan) toAttrs() []netlink.NetlinkAttr {
+	flags := v.Flags &^ (BRIDGE_VLAN_INFO_RANGE_BEGIN | BRIDGE_VLAN_INFO_RANGE_END)
+
+	if v.VidEnd == 0 || v.VidEnd == v.Vid {
+		vi := &BridgeVlanInfo{Flags: flags, Vid: v.Vid}
+		return []netlink.NetlinkAttr{netlink.NewAttr(IFLA_BRIDGE_VLAN_INFO, vi.toWireFormat())}
+	}
+
+	begin := &BridgeVlanInfo{Flags: flags | BRIDGE_VLAN_INFO_RANGE_BEGIN, Vid: v.Vid}
+	end := &BridgeVlanInfo{Flags: flags | BRIDGE_VLAN_INFO_RANGE_END, Vid: v.VidEnd}
+	return []netlink.NetlinkAttr{
+		netlink.NewAttr(IFLA_BRIDGE_VLAN_INFO, begin.toWireFormat()),
+		netlink.NewAttr(IFLA_BRIDGE_VLAN_INFO, end.toWireFormat()),
+	}
+}
+
+// GetBridgePort returns the bridge port options of the given link.
+func (rl *RouteNLSocket) GetBridgePort(index int32) (*BridgePort, error) {
+	l, err := rl.GetLink(index)
+	if err != nil {
+		return nil, err
+	}
+	if l.BridgePort == nil {
+		return nil, errors.New("not a bridge port")
+	}
+	return l.BridgePort, nil
+}
+
+func (rl *RouteNLSocket) setBridgePort(index int32, attrs []netlink.NetlinkAttr) error {
+	ifi := &IfInfomsg{Family: syscall.AF_BRIDGE, Index: index}
+	data := append(ifi.toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttrNested(IFLA_PROTINFO, attrs),
+	})...)
+	_, err := rl.Execute(RTM_SETLINK, 0, data)
+	return err
+}
+
+// SetBridgePort writes all the options of p, but the state, to the port.
+func (rl *RouteNLSocket) SetBridgePort(index int32, p *BridgePort) error {
+	return rl.setBridgePort(index, p.toAttrs())
+}
+
+// SetBridgePortState sets the STP state of a port. The kernel refuses it
+// while STP is running on the bridge.
+func (rl *RouteNLSocket) SetBridgePortState(index int32, state uint8) error {
+	return rl.setBridgePort(index, []netlink.NetlinkAttr{
+		netlink.NewAttrUint8(IFLA_BRPORT_STATE, state),
+	})
+}
+
+// ListBridgeVlans dumps the vlan membership of the given bridge or bridge
+// port, or of all of them when index is 0. Consecutive vlans with the same
+// flags come as a single range.
+func (rl *RouteNLSocket) ListBridgeVlans(index int32) ([]*BridgeVlan, error) {
+	bvm := &BrVlanMsg{Family: syscall.AF_BRIDGE, Index: index}
+
+	msgList, err := rl.Execute(RTM_GETVLAN, syscall.NLM_F_DUMP, bvm.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*BridgeVlan{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWVLAN {
+			continue
+		}
+		vlans, err := BridgeVlansfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range vlans {
+			if index != 0 && v.Index != index {
+				continue
+			}
+			ret = append(ret, v)
+		}
+	}
+
+	return ret, nil
+}
+
+// bridgeVlanRequest changes the vlans of a port through IFLA_AF_SPEC. The
+// bridge device itself needs BRIDGE_FLAGS_SELF, ports go through their master.
+func (rl *RouteNLSocket) bridgeVlanRequest(msgtype uint16, index int32, v *BridgeVlan) error {
+	l, err := rl.GetLink(index)
+	if err != nil {
+		return err
+	}
+
+	spec := []netlink.NetlinkAttr{}
+	if l.Info != nil && l.Info.Kind() == "bridge" {
+		spec = append(spec, netlink.NewAttrUint16(IFLA_BRIDGE_FLAGS, BRIDGE_FLAGS_SELF))
+	}
+	spec = append(spec, v.toAttrs()...)
+
+	ifi := &IfInfomsg{Family: syscall.AF_BRIDGE, Index: index}
+	data := append(ifi.toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttrNested(IFLA_AF_SPEC, spec),
+	})...)
+
+	_, err = rl.Execute(msgtype, 0, data)
+	return err
+}
+
+// AddBridgeVlan adds the port, or the bridge itself, to the vlans of v.
+// Adding an existing vlan updates its flags.
+func (rl *RouteNLSocket) AddBridgeVlan(index int32, v *BridgeVlan) error {
+	return rl.bridgeVlanRequest(RTM_SETLINK, index, v)
+}
+
+func (rl *RouteNLSocket) DelBridgeVlan(index int32, v *BridgeVlan) error {
+	return rl.bridgeVlanRequest(RTM_DELLINK, index, v)
+}
+
+// SetBridgeVlanState sets the per vlan STP state of a port, which needs
+// the bridge to run with vlan filtering.
+func (rl *RouteNLSocket) SetBridgeVlanState(index int32, vid uint16, state uint8) error {
+	bvm := &BrVlanMsg{Family: syscall.AF_BRIDGE, Index: index}
+	vi := &BridgeVlanInfo{Vid: vid}
+
+	data := append(bvm.toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttrNested(BRIDGE_VLANDB_ENTRY, []netlink.NetlinkAttr{
+			netlink.NewAttr(BRIDGE_VLANDB_ENTRY_INFO, vi.toWireFormat()),
+			netlink.NewAttrUint8(BRIDGE_VLANDB_ENTRY_STATE, state),
+		}),
+	})...)
+
+	_, err := rl.Execute(RTM_NEWVLAN, 0, data)
+	return err
+}
@@ -0,0 +1,254 @@
+package route
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestBridgePortAttrs(t *testing.T) {
+	p := &BridgePort{Priority: 32, Cost: 100, Hairpin: true, Learning: true, BroadcastFlood: true, Isolated: true}
+
+	attrs := p.toAttrs()
+	if _, ok := findAttr(attrs, IFLA_BRPORT_STATE); ok {
+		t.Error("state sent")
+	}
+	/* false options are sent too, so that they can be cleared */
+	if attr, ok := findAttr(attrs, IFLA_BRPORT_GUARD); !ok || attr.Uint8() != 0 {
+		t.Error("guard not cleared")
+	}
+
+	got := BridgePortfromAttrs(append(attrs, netlink.NewAttrUint8(IFLA_BRPORT_STATE, BR_STATE_BLOCKING)))
+	want := *p
+	want.State = BR_STATE_BLOCKING
+	if *got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestBridgeVlanInfoWireFormat(t *testing.T) {
+	vi := &BridgeVlanInfo{Flags: BRIDGE_VLAN_INFO_PVID | BRIDGE_VLAN_INFO_UNTAGGED, Vid: 100}
+
+	b := vi.toWireFormat()
+	if len(b) != SizeofBridgeVlanInfo {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := BridgeVlanInfofromWireFormat(b); *got != *vi {
+		t.Errorf("got %+v, want %+v", got, vi)
+	}
+
+	bvm := &BrVlanMsg{Family: syscall.AF_BRIDGE, Index: 7}
+	b = bvm.toWireFormat()
+	if len(b) != SizeofBrVlanMsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := BrVlanMsgfromWireFormat(b); *got != *bvm {
+		t.Errorf("got %+v, want %+v", got, bvm)
+	}
+}
+
+func TestBridgeVlanAttrs(t *testing.T) {
+	attrs := (&BridgeVlan{Vid: 10, Flags: BRIDGE_VLAN_INFO_PVID}).toAttrs()
+	if len(attrs) != 1 {
+		t.Fatalf("got %d attributes", len(attrs))
+	}
+	if vi := BridgeVlanInfofromWireFormat(attrs[0].Data); vi.Vid != 10 || vi.Flags != BRIDGE_VLAN_INFO_PVID {
+		t.Errorf("got %+v", vi)
+	}
+
+	/* a range is a begin and an end entry */
+	attrs = (&BridgeVlan{Vid: 20, VidEnd: 30, Flags: BRIDGE_VLAN_INFO_UNTAGGED | BRIDGE_VLAN_INFO_RANGE_END}).toAttrs()
+	if len(attrs) != 2 {
+		t.Fatalf("got %d attributes", len(attrs))
+	}
+	begin := BridgeVlanInfofromWireFormat(attrs[0].Data)
+	end := BridgeVlanInfofromWireFormat(attrs[1].Data)
+	if begin.Vid != 20 || begin.Flags != BRIDGE_VLAN_INFO_UNTAGGED|BRIDGE_VLAN_INFO_RANGE_BEGIN ||
+		end.Vid != 30 || end.Flags != BRIDGE_VLAN_INFO_UNTAGGED|BRIDGE_VLAN_INFO_RANGE_END {
+		t.Errorf("got %+v %+v", begin, end)
+	}
+}
+
+func TestBridgeVlansfromWireFormat(t *testing.T) {
+	entry := func(vid, end uint16, state uint8) netlink.NetlinkAttr {
+		vi := &BridgeVlanInfo{Flags: BRIDGE_VLAN_INFO_UNTAGGED, Vid: vid}
+		return netlink.NewAttrNested(BRIDGE_VLANDB_ENTRY, []netlink.NetlinkAttr{
+			netlink.NewAttr(BRIDGE_VLANDB_ENTRY_INFO, vi.toWireFormat()),
+			netlink.NewAttrUint16(BRIDGE_VLANDB_ENTRY_RANGE, end),
+			netlink.NewAttrUint8(BRIDGE_VLANDB_ENTRY_STATE, state),
+		})
+	}
+	data := append((&BrVlanMsg{Family: syscall.AF_BRIDGE, Index: 4}).toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		entry(1, 1, BR_STATE_FORWARDING),
+		entry(10, 19, BR_STATE_BLOCKING),
+	})...)
+
+	vlans, err := BridgeVlansfromWireFormat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vlans) != 2 {
+		t.Fatalf("got %d vlans", len(vlans))
+	}
+	/* a range of one vlan is a single vlan */
+	if *vlans[0] != (BridgeVlan{Index: 4, Vid: 1, Flags: BRIDGE_VLAN_INFO_UNTAGGED, State: BR_STATE_FORWARDING}) {
+		t.Errorf("got %+v", vlans[0])
+	}
+	if *vlans[1] != (BridgeVlan{Index: 4, Vid: 10, VidEnd: 19, Flags: BRIDGE_VLAN_INFO_UNTAGGED, State: BR_STATE_BLOCKING}) {
+		t.Errorf("got %+v", vlans[1])
+	}
+
+	if _, err := BridgeVlansfromWireFormat(make([]byte, SizeofBrVlanMsg-1)); err == nil {
+		t.Error("short br_vlan_msg accepted")
+	}
+}
+
+// testBridge sets up the bridge br0 and its port veth0.
+func testBridge(t *testing.T, rl *RouteNLSocket, info *Bridge) (*Link, *Link) {
+	t.Helper()
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddLink(&Link{Name: "br0", Info: info})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := mustLink(t, rl, "veth0")
+	br := mustLink(t, rl, "br0")
+
+	err = rl.SetLinkMaster(port.Index, br.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return br, port
+}
+
+func TestBridgePort(t *testing.T) {
+	rl := testNetns(t)
+	br, port := testBridge(t, rl, &Bridge{})
+
+	_, err := rl.GetBridgePort(br.Index)
+	if err == nil {
+		t.Error("bridge reported as a port")
+	}
+
+	p, err := rl.GetBridgePort(port.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Learning || !p.UnicastFlood || p.Isolated {
+		t.Errorf("default options: %+v", p)
+	}
+
+	p.Cost = 42
+	p.Learning = false
+	p.Isolated = true
+	p.Hairpin = true
+	err = rl.SetBridgePort(port.Index, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := rl.GetBridgePort(port.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Cost != 42 || got.Learning || !got.Isolated || !got.Hairpin || !got.UnicastFlood {
+		t.Errorf("got %+v", got)
+	}
+
+	/* the state of a port can only be set while it is running */
+	for _, name := range []string{"br0", "veth0", "veth1"} {
+		err = rl.SetLinkUp(mustLink(t, rl, name).Index)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	/* without STP a running port forwards right away */
+	if got, _ := rl.GetBridgePort(port.Index); got == nil || got.State != BR_STATE_FORWARDING {
+		t.Errorf("state: %+v", got)
+	}
+	err = rl.SetBridgePortState(port.Index, BR_STATE_DISABLED)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rl.GetBridgePort(port.Index); got == nil || got.State != BR_STATE_DISABLED {
+		t.Errorf("state: %+v", got)
+	}
+}
+
+func findVlan(vlans []*BridgeVlan, vid uint16) *BridgeVlan {
+	for _, v := range vlans {
+		if v.Vid == vid {
+			return v
+		}
+	}
+	return nil
+}
+
+func TestBridgeVlans(t *testing.T) {
+	rl := testNetns(t)
+	/* kernels without CONFIG_BRIDGE_VLAN_FILTERING refuse it */
+	br, port := testBridge(t, rl, &Bridge{VlanFiltering: true, HasVlanFiltering: true})
+
+	err := rl.AddBridgeVlan(port.Index, &BridgeVlan{Vid: 10, Flags: BRIDGE_VLAN_INFO_PVID | BRIDGE_VLAN_INFO_UNTAGGED})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddBridgeVlan(port.Index, &BridgeVlan{Vid: 20, VidEnd: 29})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddBridgeVlan(br.Index, &BridgeVlan{Vid: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vlans, err := rl.ListBridgeVlans(port.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := findVlan(vlans, 10)
+	if v == nil || v.Index != port.Index || v.Flags&BRIDGE_VLAN_INFO_PVID == 0 || v.Flags&BRIDGE_VLAN_INFO_UNTAGGED == 0 {
+		t.Errorf("vlan 10: %+v", v)
+	}
+	if v := findVlan(vlans, 20); v == nil || v.VidEnd != 29 {
+		t.Errorf("vlans 20-29: %+v", v)
+	}
+	/* the default pvid moved to vlan 10 */
+	if v := findVlan(vlans, 1); v != nil {
+		t.Errorf("vlan 1: %+v", v)
+	}
+
+	vlans, err = rl.ListBridgeVlans(br.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := findVlan(vlans, 10); v == nil || v.Index != br.Index {
+		t.Errorf("vlans of br0: %+v", vlans)
+	}
+
+	err = rl.SetBridgeVlanState(port.Index, 10, BR_STATE_BLOCKING)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vlans, _ = rl.ListBridgeVlans(port.Index)
+	if v := findVlan(vlans, 10); v == nil || v.State != BR_STATE_BLOCKING {
+		t.Errorf("vlan 10 state: %+v", v)
+	}
+
+	err = rl.DelBridgeVlan(port.Index, &BridgeVlan{Vid: 20, VidEnd: 29})
+	if err != nil {
+		t.Fatal(err)
+	}
+	vlans, _ = rl.ListBridgeVlans(port.Index)
+	if v := findVlan(vlans, 20); v != nil {
+		t.Errorf("deleted vlans still listed: %+v", v)
+	}
+}
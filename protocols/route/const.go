@@ -0,0 +1,943 @@
+package route
+
+const (
+	/* Message types */
+	RTM_NEWLINK  = 16
+	RTM_DELLINK  = 17
+	RTM_GETLINK  = 18
+	RTM_SETLINK  = 19
+	RTM_NEWADDR  = 20
+	RTM_DELADDR  = 21
+	RTM_GETADDR  = 22
+	RTM_NEWROUTE = 24
+	RTM_DELROUTE = 25
+	RTM_GETROUTE = 26
+	RTM_NEWNEIGH = 28
+	RTM_DELNEIGH = 29
+	RTM_GETNEIGH = 30
+	RTM_NEWRULE  = 32
+	RTM_DELRULE  = 33
+	RTM_GETRULE  = 34
+
+	RTM_NEWQDISC   = 36
+	RTM_DELQDISC   = 37
+	RTM_GETQDISC   = 38
+	RTM_NEWTCLASS  = 40
+	RTM_DELTCLASS  = 41
+	RTM_GETTCLASS  = 42
+	RTM_NEWTFILTER = 44
+	RTM_DELTFILTER = 45
+	RTM_GETTFILTER = 46
+
+	RTM_NEWCHAIN         = 100
+	RTM_DELCHAIN         = 101
+	RTM_GETCHAIN         = 102
+	RTM_NEWNEXTHOP       = 104
+	RTM_DELNEXTHOP       = 105
+	RTM_GETNEXTHOP       = 106
+	RTM_NEWVLAN          = 112
+	RTM_DELVLAN          = 113
+	RTM_GETVLAN          = 114
+	RTM_NEWNEXTHOPBUCKET = 116
+	RTM_DELNEXTHOPBUCKET = 117
+	RTM_GETNEXTHOPBUCKET = 118
+
+	/* Multicast groups */
+	RTNLGRP_NONE          = 0
+	RTNLGRP_LINK          = 1
+	RTNLGRP_NOTIFY        = 2
+	RTNLGRP_NEIGH         = 3
+	RTNLGRP_TC            = 4
+	RTNLGRP_IPV4_IFADDR   = 5
+	RTNLGRP_IPV4_MROUTE   = 6
+	RTNLGRP_IPV4_ROUTE    = 7
+	RTNLGRP_IPV4_RULE     = 8
+	RTNLGRP_IPV6_IFADDR   = 9
+	RTNLGRP_IPV6_MROUTE   = 10
+	RTNLGRP_IPV6_ROUTE    = 11
+	RTNLGRP_IPV6_IFINFO   = 12
+	RTNLGRP_IPV6_PREFIX   = 18
+	RTNLGRP_IPV6_RULE     = 19
+	RTNLGRP_ND_USEROPT    = 20
+	RTNLGRP_IPV4_NETCONF  = 24
+	RTNLGRP_IPV6_NETCONF  = 25
+	RTNLGRP_MDB           = 26
+	RTNLGRP_MPLS_ROUTE    = 27
+	RTNLGRP_NSID          = 28
+	RTNLGRP_MPLS_NETCONF  = 29
+	RTNLGRP_IPV4_MROUTE_R = 30
+	RTNLGRP_IPV6_MROUTE_R = 31
+	RTNLGRP_NEXTHOP       = 32
+	RTNLGRP_BRVLAN        = 33
+
+	/* Link attributes */
+	IFLA_UNSPEC             = 0
+	IFLA_ADDRESS            = 1
+	IFLA_BROADCAST          = 2
+	IFLA_IFNAME             = 3
+	IFLA_MTU                = 4
+	IFLA_LINK               = 5
+	IFLA_QDISC              = 6
+	IFLA_STATS              = 7
+	IFLA_COST               = 8
+	IFLA_PRIORITY           = 9
+	IFLA_MASTER             = 10
+	IFLA_WIRELESS           = 11
+	IFLA_PROTINFO           = 12
+	IFLA_TXQLEN             = 13
+	IFLA_MAP                = 14
+	IFLA_WEIGHT             = 15
+	IFLA_OPERSTATE          = 16
+	IFLA_LINKMODE           = 17
+	IFLA_LINKINFO           = 18
+	IFLA_NET_NS_PID         = 19
+	IFLA_IFALIAS            = 20
+	IFLA_NUM_VF             = 21
+	IFLA_VFINFO_LIST        = 22
+	IFLA_STATS64            = 23
+	IFLA_VF_PORTS           = 24
+	IFLA_PORT_SELF          = 25
+	IFLA_AF_SPEC            = 26
+	IFLA_GROUP              = 27
+	IFLA_NET_NS_FD          = 28
+	IFLA_EXT_MASK           = 29
+	IFLA_PROMISCUITY        = 30
+	IFLA_NUM_TX_QUEUES      = 31
+	IFLA_NUM_RX_QUEUES      = 32
+	IFLA_CARRIER            = 33
+	IFLA_PHYS_PORT_ID       = 34
+	IFLA_CARRIER_CHANGES    = 35
+	IFLA_PHYS_SWITCH_ID     = 36
+	IFLA_LINK_NETNSID       = 37
+	IFLA_PHYS_PORT_NAME     = 38
+	IFLA_PROTO_DOWN         = 39
+	IFLA_GSO_MAX_SEGS       = 40
+	IFLA_GSO_MAX_SIZE       = 41
+	IFLA_PAD                = 42
+	IFLA_XDP                = 43
+	IFLA_EVENT              = 44
+	IFLA_NEW_NETNSID        = 45
+	IFLA_TARGET_NETNSID     = 46
+	IFLA_CARRIER_UP_COUNT   = 47
+	IFLA_CARRIER_DOWN_COUNT = 48
+	IFLA_NEW_IFINDEX        = 49
+	IFLA_MIN_MTU            = 50
+	IFLA_MAX_MTU            = 51
+	IFLA_PROP_LIST          = 52
+	IFLA_ALT_IFNAME         = 53
+	IFLA_PERM_ADDRESS       = 54
+
+	IFLA_INFO_UNSPEC     = 0
+	IFLA_INFO_KIND       = 1
+	IFLA_INFO_DATA       = 2
+	IFLA_INFO_XSTATS     = 3
+	IFLA_INFO_SLAVE_KIND = 4
+	IFLA_INFO_SLAVE_DATA = 5
+
+	VETH_INFO_UNSPEC = 0
+	VETH_INFO_PEER   = 1
+
+	IFLA_VLAN_UNSPEC      = 0
+	IFLA_VLAN_ID          = 1
+	IFLA_VLAN_FLAGS       = 2
+	IFLA_VLAN_EGRESS_QOS  = 3
+	IFLA_VLAN_INGRESS_QOS = 4
+	IFLA_VLAN_PROTOCOL    = 5
+
+	IFLA_VXLAN_UNSPEC            = 0
+	IFLA_VXLAN_ID                = 1
+	IFLA_VXLAN_GROUP             = 2
+	IFLA_VXLAN_LINK              = 3
+	IFLA_VXLAN_LOCAL             = 4
+	IFLA_VXLAN_TTL               = 5
+	IFLA_VXLAN_TOS               = 6
+	IFLA_VXLAN_LEARNING          = 7
+	IFLA_VXLAN_AGEING            = 8
+	IFLA_VXLAN_LIMIT             = 9
+	IFLA_VXLAN_PORT_RANGE        = 10
+	IFLA_VXLAN_PROXY             = 11
+	IFLA_VXLAN_RSC               = 12
+	IFLA_VXLAN_L2MISS            = 13
+	IFLA_VXLAN_L3MISS            = 14
+	IFLA_VXLAN_PORT              = 15
+	IFLA_VXLAN_GROUP6            = 16
+	IFLA_VXLAN_LOCAL6            = 17
+	IFLA_VXLAN_UDP_CSUM          = 18
+	IFLA_VXLAN_UDP_ZERO_CSUM6_TX = 19
+	IFLA_VXLAN_UDP_ZERO_CSUM6_RX = 20
+	IFLA_VXLAN_REMCSUM_TX        = 21
+	IFLA_VXLAN_REMCSUM_RX        = 22
+	IFLA_VXLAN_GBP               = 23
+	IFLA_VXLAN_REMCSUM_NOPARTIAL = 24
+	IFLA_VXLAN_COLLECT_METADATA  = 25
+	IFLA_VXLAN_LABEL             = 26
+	IFLA_VXLAN_GPE               = 27
+	IFLA_VXLAN_TTL_INHERIT       = 28
+	IFLA_VXLAN_DF                = 29
+
+	IFLA_GRE_UNSPEC           = 0
+	IFLA_GRE_LINK             = 1
+	IFLA_GRE_IFLAGS           = 2
+	IFLA_GRE_OFLAGS           = 3
+	IFLA_GRE_IKEY             = 4
+	IFLA_GRE_OKEY             = 5
+	IFLA_GRE_LOCAL            = 6
+	IFLA_GRE_REMOTE           = 7
+	IFLA_GRE_TTL              = 8
+	IFLA_GRE_TOS              = 9
+	IFLA_GRE_PMTUDISC         = 10
+	IFLA_GRE_ENCAP_LIMIT      = 11
+	IFLA_GRE_FLOWINFO         = 12
+	IFLA_GRE_FLAGS            = 13
+	IFLA_GRE_ENCAP_TYPE       = 14
+	IFLA_GRE_ENCAP_FLAGS      = 15
+	IFLA_GRE_ENCAP_SPORT      = 16
+	IFLA_GRE_ENCAP_DPORT      = 17
+	IFLA_GRE_COLLECT_METADATA = 18
+	IFLA_GRE_IGNORE_DF        = 19
+	IFLA_GRE_FWMARK           = 20
+
+	/* GRE header flags, as carried in IFLA_GRE_[IO]FLAGS */
+	GRE_CSUM    = 0x8000
+	GRE_ROUTING = 0x4000
+	GRE_KEY     = 0x2000
+	GRE_SEQ     = 0x1000
+
+	IFLA_IPTUN_UNSPEC              = 0
+	IFLA_IPTUN_LINK                = 1
+	IFLA_IPTUN_LOCAL               = 2
+	IFLA_IPTUN_REMOTE              = 3
+	IFLA_IPTUN_TTL                 = 4
+	IFLA_IPTUN_TOS                 = 5
+	IFLA_IPTUN_ENCAP_LIMIT         = 6
+	IFLA_IPTUN_FLOWINFO            = 7
+	IFLA_IPTUN_FLAGS               = 8
+	IFLA_IPTUN_PROTO               = 9
+	IFLA_IPTUN_PMTUDISC            = 10
+	IFLA_IPTUN_6RD_PREFIX          = 11
+	IFLA_IPTUN_6RD_RELAY_PREFIX    = 12
+	IFLA_IPTUN_6RD_PREFIXLEN       = 13
+	IFLA_IPTUN_6RD_RELAY_PREFIXLEN = 14
+	IFLA_IPTUN_ENCAP_TYPE          = 15
+	IFLA_IPTUN_ENCAP_FLAGS         = 16
+	IFLA_IPTUN_ENCAP_SPORT         = 17
+	IFLA_IPTUN_ENCAP_DPORT         = 18
+	IFLA_IPTUN_COLLECT_METADATA    = 19
+	IFLA_IPTUN_FWMARK              = 20
+
+	SIT_ISATAP = 0x0001
+
+	IFLA_GENEVE_UNSPEC              = 0
+	IFLA_GENEVE_ID                  = 1
+	IFLA_GENEVE_REMOTE              = 2
+	IFLA_GENEVE_TTL                 = 3
+	IFLA_GENEVE_TOS                 = 4
+	IFLA_GENEVE_PORT                = 5
+	IFLA_GENEVE_COLLECT_METADATA    = 6
+	IFLA_GENEVE_REMOTE6             = 7
+	IFLA_GENEVE_UDP_CSUM            = 8
+	IFLA_GENEVE_UDP_ZERO_CSUM6_TX   = 9
+	IFLA_GENEVE_UDP_ZERO_CSUM6_RX   = 10
+	IFLA_GENEVE_LABEL               = 11
+	IFLA_GENEVE_TTL_INHERIT         = 12
+	IFLA_GENEVE_DF                  = 13
+	IFLA_GENEVE_INNER_PROTO_INHERIT = 14
+
+	IFLA_MACVLAN_UNSPEC        = 0
+	IFLA_MACVLAN_MODE          = 1
+	IFLA_MACVLAN_FLAGS         = 2
+	IFLA_MACVLAN_MACADDR_MODE  = 3
+	IFLA_MACVLAN_MACADDR       = 4
+	IFLA_MACVLAN_MACADDR_DATA  = 5
+	IFLA_MACVLAN_MACADDR_COUNT = 6
+	IFLA_MACVLAN_BC_QUEUE_LEN  = 7
+
+	MACVLAN_MODE_PRIVATE  = 1
+	MACVLAN_MODE_VEPA     = 2
+	MACVLAN_MODE_BRIDGE   = 4
+	MACVLAN_MODE_PASSTHRU = 8
+	MACVLAN_MODE_SOURCE   = 16
+
+	MACVLAN_FLAG_NOPROMISC = 1
+	MACVLAN_FLAG_NODST     = 2
+
+	IFLA_IPVLAN_UNSPEC = 0
+	IFLA_IPVLAN_MODE   = 1
+	IFLA_IPVLAN_FLAGS  = 2
+
+	IPVLAN_MODE_L2  = 0
+	IPVLAN_MODE_L3  = 1
+	IPVLAN_MODE_L3S = 2
+
+	IPVLAN_F_PRIVATE = 0x01
+	IPVLAN_F_VEPA    = 0x02
+
+	IFLA_VRF_UNSPEC = 0
+	IFLA_VRF_TABLE  = 1
+
+	/* Address attributes */
+	IFA_UNSPEC         = 0
+	IFA_ADDRESS        = 1
+	IFA_LOCAL          = 2
+	IFA_LABEL          = 3
+	IFA_BROADCAST      = 4
+	IFA_ANYCAST        = 5
+	IFA_CACHEINFO      = 6
+	IFA_MULTICAST      = 7
+	IFA_FLAGS          = 8
+	IFA_RT_PRIORITY    = 9
+	IFA_TARGET_NETNSID = 10
+	IFA_PROTO          = 11
+
+	/* Address flags */
+	IFA_F_SECONDARY      = 0x01
+	IFA_F_TEMPORARY      = IFA_F_SECONDARY
+	IFA_F_NODAD          = 0x02
+	IFA_F_OPTIMISTIC     = 0x04
+	IFA_F_DADFAILED      = 0x08
+	IFA_F_HOMEADDRESS    = 0x10
+	IFA_F_DEPRECATED     = 0x20
+	IFA_F_TENTATIVE      = 0x40
+	IFA_F_PERMANENT      = 0x80
+	IFA_F_MANAGETEMPADDR = 0x100
+	IFA_F_NOPREFIXROUTE  = 0x200
+	IFA_F_MCAUTOJOIN     = 0x400
+	IFA_F_STABLE_PRIVACY = 0x800
+
+	INFINITY_LIFE_TIME = 0xffffffff
+
+	/* Scopes */
+	RT_SCOPE_UNIVERSE = 0
+	RT_SCOPE_SITE     = 200
+	RT_SCOPE_LINK     = 253
+	RT_SCOPE_HOST     = 254
+	RT_SCOPE_NOWHERE  = 255
+
+	/* Route attributes */
+	RTA_UNSPEC        = 0
+	RTA_DST           = 1
+	RTA_SRC           = 2
+	RTA_IIF           = 3
+	RTA_OIF           = 4
+	RTA_GATEWAY       = 5
+	RTA_PRIORITY      = 6
+	RTA_PREFSRC       = 7
+	RTA_METRICS       = 8
+	RTA_MULTIPATH     = 9
+	RTA_PROTOINFO     = 10
+	RTA_FLOW          = 11
+	RTA_CACHEINFO     = 12
+	RTA_SESSION       = 13
+	RTA_MP_ALGO       = 14
+	RTA_TABLE         = 15
+	RTA_MARK          = 16
+	RTA_MFC_STATS     = 17
+	RTA_VIA           = 18
+	RTA_NEWDST        = 19
+	RTA_PREF          = 20
+	RTA_ENCAP_TYPE    = 21
+	RTA_ENCAP         = 22
+	RTA_EXPIRES       = 23
+	RTA_PAD           = 24
+	RTA_UID           = 25
+	RTA_TTL_PROPAGATE = 26
+	RTA_IP_PROTO      = 27
+	RTA_SPORT         = 28
+	RTA_DPORT         = 29
+	RTA_NH_ID         = 30
+
+	/* Route types */
+	RTN_UNSPEC      = 0
+	RTN_UNICAST     = 1
+	RTN_LOCAL       = 2
+	RTN_BROADCAST   = 3
+	RTN_ANYCAST     = 4
+	RTN_MULTICAST   = 5
+	RTN_BLACKHOLE   = 6
+	RTN_UNREACHABLE = 7
+	RTN_PROHIBIT    = 8
+	RTN_THROW       = 9
+	RTN_NAT         = 10
+	RTN_XRESOLVE    = 11
+
+	/* Route origins */
+	RTPROT_UNSPEC     = 0
+	RTPROT_REDIRECT   = 1
+	RTPROT_KERNEL     = 2
+	RTPROT_BOOT       = 3
+	RTPROT_STATIC     = 4
+	RTPROT_RA         = 9
+	RTPROT_ZEBRA      = 11
+	RTPROT_BIRD       = 12
+	RTPROT_DHCP       = 16
+	RTPROT_KEEPALIVED = 18
+	RTPROT_BABEL      = 42
+	RTPROT_BGP        = 186
+	RTPROT_ISIS       = 187
+	RTPROT_OSPF       = 188
+	RTPROT_RIP        = 189
+
+	/* Reserved tables */
+	RT_TABLE_UNSPEC  = 0
+	RT_TABLE_COMPAT  = 252
+	RT_TABLE_DEFAULT = 253
+	RT_TABLE_MAIN    = 254
+	RT_TABLE_LOCAL   = 255
+
+	RTM_F_NOTIFY       = 0x100
+	RTM_F_CLONED       = 0x200
+	RTM_F_EQUALIZE     = 0x400
+	RTM_F_PREFIX       = 0x800
+	RTM_F_LOOKUP_TABLE = 0x1000
+	RTM_F_FIB_MATCH    = 0x2000
+	RTM_F_OFFLOAD      = 0x4000
+	RTM_F_TRAP         = 0x8000
+
+	/* Nexthop flags */
+	RTNH_F_DEAD       = 1
+	RTNH_F_PERVASIVE  = 2
+	RTNH_F_ONLINK     = 4
+	RTNH_F_OFFLOAD    = 8
+	RTNH_F_LINKDOWN   = 16
+	RTNH_F_UNRESOLVED = 32
+	RTNH_F_TRAP       = 64
+
+	/* Route metrics, nested in RTA_METRICS */
+	RTAX_UNSPEC             = 0
+	RTAX_LOCK               = 1
+	RTAX_MTU                = 2
+	RTAX_WINDOW             = 3
+	RTAX_RTT                = 4
+	RTAX_RTTVAR             = 5
+	RTAX_SSTHRESH           = 6
+	RTAX_CWND               = 7
+	RTAX_ADVMSS             = 8
+	RTAX_REORDERING         = 9
+	RTAX_HOPLIMIT           = 10
+	RTAX_INITCWND           = 11
+	RTAX_FEATURES           = 12
+	RTAX_RTO_MIN            = 13
+	RTAX_INITRWND           = 14
+	RTAX_QUICKACK           = 15
+	RTAX_CC_ALGO            = 16
+	RTAX_FASTOPEN_NO_COOKIE = 17
+
+	/* Neighbour attributes */
+	NDA_UNSPEC        = 0
+	NDA_DST           = 1
+	NDA_LLADDR        = 2
+	NDA_CACHEINFO     = 3
+	NDA_PROBES        = 4
+	NDA_VLAN          = 5
+	NDA_PORT          = 6
+	NDA_VNI           = 7
+	NDA_IFINDEX       = 8
+	NDA_MASTER        = 9
+	NDA_LINK_NETNSID  = 10
+	NDA_SRC_VNI       = 11
+	NDA_PROTOCOL      = 12
+	NDA_NH_ID         = 13
+	NDA_FDB_EXT_ATTRS = 14
+	NDA_FLAGS_EXT     = 15
+
+	/* Neighbour states */
+	NUD_NONE       = 0x00
+	NUD_INCOMPLETE = 0x01
+	NUD_REACHABLE  = 0x02
+	NUD_STALE      = 0x04
+	NUD_DELAY      = 0x08
+	NUD_PROBE      = 0x10
+	NUD_FAILED     = 0x20
+	NUD_NOARP      = 0x40
+	NUD_PERMANENT  = 0x80
+
+	/* Neighbour flags */
+	NTF_USE         = 0x01
+	NTF_SELF        = 0x02
+	NTF_MASTER      = 0x04
+	NTF_PROXY       = 0x08
+	NTF_EXT_LEARNED = 0x10
+	NTF_OFFLOADED   = 0x20
+	NTF_STICKY      = 0x40
+	NTF_ROUTER      = 0x80
+
+	/* Rule attributes */
+	FRA_UNSPEC             = 0
+	FRA_DST                = 1
+	FRA_SRC                = 2
+	FRA_IIFNAME            = 3
+	FRA_GOTO               = 4
+	FRA_PRIORITY           = 6
+	FRA_FWMARK             = 10
+	FRA_FLOW               = 11
+	FRA_TUN_ID             = 12
+	FRA_SUPPRESS_IFGROUP   = 13
+	FRA_SUPPRESS_PREFIXLEN = 14
+	FRA_TABLE              = 15
+	FRA_FWMASK             = 16
+	FRA_OIFNAME            = 17
+	FRA_PAD                = 18
+	FRA_L3MDEV             = 19
+	FRA_UID_RANGE          = 20
+	FRA_PROTOCOL           = 21
+	FRA_IP_PROTO           = 22
+	FRA_SPORT_RANGE        = 23
+	FRA_DPORT_RANGE        = 24
+
+	/* Rule actions */
+	FR_ACT_UNSPEC      = 0
+	FR_ACT_TO_TBL      = 1
+	FR_ACT_GOTO        = 2
+	FR_ACT_NOP         = 3
+	FR_ACT_BLACKHOLE   = 6
+	FR_ACT_UNREACHABLE = 7
+	FR_ACT_PROHIBIT    = 8
+
+	/* Rule flags */
+	FIB_RULE_PERMANENT    = 0x00000001
+	FIB_RULE_INVERT       = 0x00000002
+	FIB_RULE_UNRESOLVED   = 0x00000004
+	FIB_RULE_IIF_DETACHED = 0x00000008
+	FIB_RULE_OIF_DETACHED = 0x00000010
+	FIB_RULE_FIND_SADDR   = 0x00010000
+
+	/* Nexthop object attributes */
+	NHA_UNSPEC          = 0
+	NHA_ID              = 1
+	NHA_GROUP           = 2
+	NHA_GROUP_TYPE      = 3
+	NHA_BLACKHOLE       = 4
+	NHA_OIF             = 5
+	NHA_GATEWAY         = 6
+	NHA_ENCAP_TYPE      = 7
+	NHA_ENCAP           = 8
+	NHA_GROUPS          = 9
+	NHA_MASTER          = 10
+	NHA_FDB             = 11
+	NHA_RES_GROUP       = 12
+	NHA_RES_BUCKET      = 13
+	NHA_HW_STATS_ENABLE = 14
+	NHA_HW_STATS_USED   = 15
+
+	NEXTHOP_GRP_TYPE_MPATH = 0
+	NEXTHOP_GRP_TYPE_RES   = 1
+
+	NHA_RES_GROUP_UNSPEC           = 0
+	NHA_RES_GROUP_BUCKETS          = 1
+	NHA_RES_GROUP_IDLE_TIMER       = 2
+	NHA_RES_GROUP_UNBALANCED_TIMER = 3
+	NHA_RES_GROUP_UNBALANCED_TIME  = 4
+
+	NHA_RES_BUCKET_UNSPEC    = 0
+	NHA_RES_BUCKET_INDEX     = 1
+	NHA_RES_BUCKET_IDLE_TIME = 2
+	NHA_RES_BUCKET_NH_ID     = 3
+
+	/* Bridge options */
+	IFLA_BR_UNSPEC             = 0
+	IFLA_BR_FORWARD_DELAY      = 1
+	IFLA_BR_HELLO_TIME         = 2
+	IFLA_BR_MAX_AGE            = 3
+	IFLA_BR_AGEING_TIME        = 4
+	IFLA_BR_STP_STATE          = 5
+	IFLA_BR_PRIORITY           = 6
+	IFLA_BR_VLAN_FILTERING     = 7
+	IFLA_BR_VLAN_PROTOCOL      = 8
+	IFLA_BR_GROUP_FWD_MASK     = 9
+	IFLA_BR_ROOT_ID            = 10
+	IFLA_BR_BRIDGE_ID          = 11
+	IFLA_BR_ROOT_PORT          = 12
+	IFLA_BR_ROOT_PATH_COST     = 13
+	IFLA_BR_MCAST_SNOOPING     = 23
+	IFLA_BR_VLAN_DEFAULT_PVID  = 39
+	IFLA_BR_VLAN_STATS_ENABLED = 41
+
+	/* Bridge port options */
+	IFLA_BRPORT_UNSPEC           = 0
+	IFLA_BRPORT_STATE            = 1
+	IFLA_BRPORT_PRIORITY         = 2
+	IFLA_BRPORT_COST             = 3
+	IFLA_BRPORT_MODE             = 4
+	IFLA_BRPORT_GUARD            = 5
+	IFLA_BRPORT_PROTECT          = 6
+	IFLA_BRPORT_FAST_LEAVE       = 7
+	IFLA_BRPORT_LEARNING         = 8
+	IFLA_BRPORT_UNICAST_FLOOD    = 9
+	IFLA_BRPORT_PROXYARP         = 10
+	IFLA_BRPORT_LEARNING_SYNC    = 11
+	IFLA_BRPORT_PROXYARP_WIFI    = 12
+	IFLA_BRPORT_ROOT_ID          = 13
+	IFLA_BRPORT_BRIDGE_ID        = 14
+	IFLA_BRPORT_DESIGNATED_PORT  = 15
+	IFLA_BRPORT_DESIGNATED_COST  = 16
+	IFLA_BRPORT_ID               = 17
+	IFLA_BRPORT_NO               = 18
+	IFLA_BRPORT_MULTICAST_ROUTER = 25
+	IFLA_BRPORT_MCAST_FLOOD      = 27
+	IFLA_BRPORT_MCAST_TO_UCAST   = 28
+	IFLA_BRPORT_VLAN_TUNNEL      = 29
+	IFLA_BRPORT_BCAST_FLOOD      = 30
+	IFLA_BRPORT_GROUP_FWD_MASK   = 31
+	IFLA_BRPORT_NEIGH_SUPPRESS   = 32
+	IFLA_BRPORT_ISOLATED         = 33
+	IFLA_BRPORT_BACKUP_PORT      = 34
+
+	BR_STATE_DISABLED   = 0
+	BR_STATE_LISTENING  = 1
+	BR_STATE_LEARNING   = 2
+	BR_STATE_FORWARDING = 3
+	BR_STATE_BLOCKING   = 4
+
+	/* Bridge IFLA_AF_SPEC attributes */
+	IFLA_BRIDGE_FLAGS            = 0
+	IFLA_BRIDGE_MODE             = 1
+	IFLA_BRIDGE_VLAN_INFO        = 2
+	IFLA_BRIDGE_VLAN_TUNNEL_INFO = 3
+
+	BRIDGE_FLAGS_MASTER = 1
+	BRIDGE_FLAGS_SELF   = 2
+
+	BRIDGE_VLAN_INFO_MASTER      = 0x01
+	BRIDGE_VLAN_INFO_PVID        = 0x02
+	BRIDGE_VLAN_INFO_UNTAGGED    = 0x04
+	BRIDGE_VLAN_INFO_RANGE_BEGIN = 0x08
+	BRIDGE_VLAN_INFO_RANGE_END   = 0x10
+	BRIDGE_VLAN_INFO_BRENTRY     = 0x20
+	BRIDGE_VLAN_INFO_ONLY_OPTS   = 0x40
+
+	RTEXT_FILTER_VF                = 0x1
+	RTEXT_FILTER_BRVLAN            = 0x2
+	RTEXT_FILTER_BRVLAN_COMPRESSED = 0x4
+
+	/* Bridge VLAN database (RTM_*VLAN) attributes */
+	BRIDGE_VLANDB_UNSPEC         = 0
+	BRIDGE_VLANDB_ENTRY          = 1
+	BRIDGE_VLANDB_GLOBAL_OPTIONS = 2
+
+	BRIDGE_VLANDB_ENTRY_UNSPEC      = 0
+	BRIDGE_VLANDB_ENTRY_INFO        = 1
+	BRIDGE_VLANDB_ENTRY_RANGE       = 2
+	BRIDGE_VLANDB_ENTRY_STATE       = 3
+	BRIDGE_VLANDB_ENTRY_TUNNEL_INFO = 4
+	BRIDGE_VLANDB_ENTRY_STATS       = 5
+
+	/* Traffic control */
+	TC_H_UNSPEC      = 0
+	TC_H_ROOT        = 0xffffffff
+	TC_H_INGRESS     = 0xfffffff1
+	TC_H_CLSACT      = TC_H_INGRESS
+	TC_H_MIN_INGRESS = 0xfff2
+	TC_H_MIN_EGRESS  = 0xfff3
+
+	TCA_UNSPEC         = 0
+	TCA_KIND           = 1
+	TCA_OPTIONS        = 2
+	TCA_STATS          = 3
+	TCA_XSTATS         = 4
+	TCA_RATE           = 5
+	TCA_FCNT           = 6
+	TCA_STATS2         = 7
+	TCA_STAB           = 8
+	TCA_PAD            = 9
+	TCA_DUMP_INVISIBLE = 10
+	TCA_CHAIN          = 11
+	TCA_HW_OFFLOAD     = 12
+	TCA_INGRESS_BLOCK  = 13
+	TCA_EGRESS_BLOCK   = 14
+
+	TCA_STATS_UNSPEC     = 0
+	TCA_STATS_BASIC      = 1
+	TCA_STATS_RATE_EST   = 2
+	TCA_STATS_QUEUE      = 3
+	TCA_STATS_APP        = 4
+	TCA_STATS_RATE_EST64 = 5
+	TCA_STATS_PAD        = 6
+	TCA_STATS_BASIC_HW   = 7
+	TCA_STATS_PKT64      = 8
+
+	TC_LINKLAYER_UNAWARE  = 0
+	TC_LINKLAYER_ETHERNET = 1
+	TC_LINKLAYER_ATM      = 2
+
+	TC_PRIO_MAX = 15
+
+	TCA_TBF_UNSPEC  = 0
+	TCA_TBF_PARMS   = 1
+	TCA_TBF_RTAB    = 2
+	TCA_TBF_PTAB    = 3
+	TCA_TBF_RATE64  = 4
+	TCA_TBF_PRATE64 = 5
+	TCA_TBF_BURST   = 6
+	TCA_TBF_PBURST  = 7
+
+	TCA_HTB_UNSPEC      = 0
+	TCA_HTB_PARMS       = 1
+	TCA_HTB_INIT        = 2
+	TCA_HTB_CTAB        = 3
+	TCA_HTB_RTAB        = 4
+	TCA_HTB_DIRECT_QLEN = 5
+	TCA_HTB_RATE64      = 6
+	TCA_HTB_CEIL64      = 7
+	TCA_HTB_PAD         = 8
+	TCA_HTB_OFFLOAD     = 9
+
+	TCA_FQ_CODEL_UNSPEC          = 0
+	TCA_FQ_CODEL_TARGET          = 1
+	TCA_FQ_CODEL_LIMIT           = 2
+	TCA_FQ_CODEL_INTERVAL        = 3
+	TCA_FQ_CODEL_ECN             = 4
+	TCA_FQ_CODEL_FLOWS           = 5
+	TCA_FQ_CODEL_QUANTUM         = 6
+	TCA_FQ_CODEL_CE_THRESHOLD    = 7
+	TCA_FQ_CODEL_DROP_BATCH_SIZE = 8
+	TCA_FQ_CODEL_MEMORY_LIMIT    = 9
+
+	TCA_FQ_UNSPEC             = 0
+	TCA_FQ_PLIMIT             = 1
+	TCA_FQ_FLOW_PLIMIT        = 2
+	TCA_FQ_QUANTUM            = 3
+	TCA_FQ_INITIAL_QUANTUM    = 4
+	TCA_FQ_RATE_ENABLE        = 5
+	TCA_FQ_FLOW_DEFAULT_RATE  = 6
+	TCA_FQ_FLOW_MAX_RATE      = 7
+	TCA_FQ_BUCKETS_LOG        = 8
+	TCA_FQ_FLOW_REFILL_DELAY  = 9
+	TCA_FQ_ORPHAN_MASK        = 10
+	TCA_FQ_LOW_RATE_THRESHOLD = 11
+	TCA_FQ_CE_THRESHOLD       = 12
+	TCA_FQ_TIMER_SLACK        = 13
+	TCA_FQ_HORIZON            = 14
+	TCA_FQ_HORIZON_DROP       = 15
+
+	TCA_NETEM_UNSPEC     = 0
+	TCA_NETEM_CORR       = 1
+	TCA_NETEM_DELAY_DIST = 2
+	TCA_NETEM_REORDER    = 3
+	TCA_NETEM_CORRUPT    = 4
+	TCA_NETEM_LOSS       = 5
+	TCA_NETEM_RATE       = 6
+	TCA_NETEM_ECN        = 7
+	TCA_NETEM_RATE64     = 8
+	TCA_NETEM_PAD        = 9
+	TCA_NETEM_LATENCY64  = 10
+	TCA_NETEM_JITTER64   = 11
+	TCA_NETEM_SLOT       = 12
+	TCA_NETEM_SLOT_DIST  = 13
+
+	/* Traffic control filters */
+	TCA_CLS_FLAGS_SKIP_HW   = 0x1
+	TCA_CLS_FLAGS_SKIP_SW   = 0x2
+	TCA_CLS_FLAGS_IN_HW     = 0x4
+	TCA_CLS_FLAGS_NOT_IN_HW = 0x8
+	TCA_CLS_FLAGS_VERBOSE   = 0x10
+
+	TC_U32_TERMINAL  = 0x1
+	TC_U32_OFFSET    = 0x2
+	TC_U32_VAROFFSET = 0x4
+	TC_U32_EAT       = 0x8
+
+	TCA_U32_UNSPEC  = 0
+	TCA_U32_CLASSID = 1
+	TCA_U32_HASH    = 2
+	TCA_U32_LINK    = 3
+	TCA_U32_DIVISOR = 4
+	TCA_U32_SEL     = 5
+	TCA_U32_POLICE  = 6
+	TCA_U32_ACT     = 7
+	TCA_U32_INDEV   = 8
+	TCA_U32_PCNT    = 9
+	TCA_U32_MARK    = 10
+	TCA_U32_FLAGS   = 11
+	TCA_U32_PAD     = 12
+
+	TCA_FLOWER_UNSPEC               = 0
+	TCA_FLOWER_CLASSID              = 1
+	TCA_FLOWER_INDEV                = 2
+	TCA_FLOWER_ACT                  = 3
+	TCA_FLOWER_KEY_ETH_DST          = 4
+	TCA_FLOWER_KEY_ETH_DST_MASK     = 5
+	TCA_FLOWER_KEY_ETH_SRC          = 6
+	TCA_FLOWER_KEY_ETH_SRC_MASK     = 7
+	TCA_FLOWER_KEY_ETH_TYPE         = 8
+	TCA_FLOWER_KEY_IP_PROTO         = 9
+	TCA_FLOWER_KEY_IPV4_SRC         = 10
+	TCA_FLOWER_KEY_IPV4_SRC_MASK    = 11
+	TCA_FLOWER_KEY_IPV4_DST         = 12
+	TCA_FLOWER_KEY_IPV4_DST_MASK    = 13
+	TCA_FLOWER_KEY_IPV6_SRC         = 14
+	TCA_FLOWER_KEY_IPV6_SRC_MASK    = 15
+	TCA_FLOWER_KEY_IPV6_DST         = 16
+	TCA_FLOWER_KEY_IPV6_DST_MASK    = 17
+	TCA_FLOWER_KEY_TCP_SRC          = 18
+	TCA_FLOWER_KEY_TCP_DST          = 19
+	TCA_FLOWER_KEY_UDP_SRC          = 20
+	TCA_FLOWER_KEY_UDP_DST          = 21
+	TCA_FLOWER_FLAGS                = 22
+	TCA_FLOWER_KEY_VLAN_ID          = 23
+	TCA_FLOWER_KEY_VLAN_PRIO        = 24
+	TCA_FLOWER_KEY_VLAN_ETH_TYPE    = 25
+	TCA_FLOWER_KEY_TCP_SRC_MASK     = 35
+	TCA_FLOWER_KEY_TCP_DST_MASK     = 36
+	TCA_FLOWER_KEY_UDP_SRC_MASK     = 37
+	TCA_FLOWER_KEY_UDP_DST_MASK     = 38
+	TCA_FLOWER_KEY_SCTP_SRC_MASK    = 39
+	TCA_FLOWER_KEY_SCTP_DST_MASK    = 40
+	TCA_FLOWER_KEY_SCTP_SRC         = 41
+	TCA_FLOWER_KEY_SCTP_DST         = 42
+	TCA_FLOWER_KEY_ICMPV4_CODE      = 49
+	TCA_FLOWER_KEY_ICMPV4_CODE_MASK = 50
+	TCA_FLOWER_KEY_ICMPV4_TYPE      = 51
+	TCA_FLOWER_KEY_ICMPV4_TYPE_MASK = 52
+	TCA_FLOWER_KEY_ICMPV6_CODE      = 53
+	TCA_FLOWER_KEY_ICMPV6_CODE_MASK = 54
+	TCA_FLOWER_KEY_ICMPV6_TYPE      = 55
+	TCA_FLOWER_KEY_ICMPV6_TYPE_MASK = 56
+	TCA_FLOWER_KEY_TCP_FLAGS        = 71
+	TCA_FLOWER_KEY_TCP_FLAGS_MASK   = 72
+	TCA_FLOWER_KEY_IP_TOS           = 73
+	TCA_FLOWER_KEY_IP_TOS_MASK      = 74
+	TCA_FLOWER_KEY_IP_TTL           = 75
+	TCA_FLOWER_KEY_IP_TTL_MASK      = 76
+	TCA_FLOWER_IN_HW_COUNT          = 85
+	TCA_FLOWER_KEY_PORT_SRC_MIN     = 86
+	TCA_FLOWER_KEY_PORT_SRC_MAX     = 87
+	TCA_FLOWER_KEY_PORT_DST_MIN     = 88
+	TCA_FLOWER_KEY_PORT_DST_MAX     = 89
+
+	TCA_MATCHALL_UNSPEC  = 0
+	TCA_MATCHALL_CLASSID = 1
+	TCA_MATCHALL_ACT     = 2
+	TCA_MATCHALL_FLAGS   = 3
+	TCA_MATCHALL_PCNT    = 4
+	TCA_MATCHALL_PAD     = 5
+
+	TCA_BASIC_UNSPEC   = 0
+	TCA_BASIC_CLASSID  = 1
+	TCA_BASIC_EMATCHES = 2
+	TCA_BASIC_ACT      = 3
+	TCA_BASIC_POLICE   = 4
+	TCA_BASIC_PCNT     = 5
+	TCA_BASIC_PAD      = 6
+
+	TCA_FW_UNSPEC  = 0
+	TCA_FW_CLASSID = 1
+	TCA_FW_POLICE  = 2
+	TCA_FW_INDEV   = 3
+	TCA_FW_ACT     = 4
+	TCA_FW_MASK    = 5
+
+	/* Traffic control actions */
+	TCA_ACT_UNSPEC        = 0
+	TCA_ACT_KIND          = 1
+	TCA_ACT_OPTIONS       = 2
+	TCA_ACT_INDEX         = 3
+	TCA_ACT_STATS         = 4
+	TCA_ACT_PAD           = 5
+	TCA_ACT_COOKIE        = 6
+	TCA_ACT_FLAGS         = 7
+	TCA_ACT_HW_STATS      = 8
+	TCA_ACT_USED_HW_STATS = 9
+	TCA_ACT_IN_HW_COUNT   = 10
+
+	TC_ACT_UNSPEC     = -1
+	TC_ACT_OK         = 0
+	TC_ACT_RECLASSIFY = 1
+	TC_ACT_SHOT       = 2
+	TC_ACT_PIPE       = 3
+	TC_ACT_STOLEN     = 4
+	TC_ACT_QUEUED     = 5
+	TC_ACT_REPEAT     = 6
+	TC_ACT_REDIRECT   = 7
+	TC_ACT_TRAP       = 8
+	TC_ACT_JUMP       = 0x10000000
+	TC_ACT_GOTO_CHAIN = 0x20000000
+
+	TCA_GACT_UNSPEC = 0
+	TCA_GACT_TM     = 1
+	TCA_GACT_PARMS  = 2
+	TCA_GACT_PROB   = 3
+	TCA_GACT_PAD    = 4
+
+	TCA_MIRRED_UNSPEC = 0
+	TCA_MIRRED_TM     = 1
+	TCA_MIRRED_PARMS  = 2
+	TCA_MIRRED_PAD    = 3
+
+	TCA_EGRESS_REDIR   = 1
+	TCA_EGRESS_MIRROR  = 2
+	TCA_INGRESS_REDIR  = 3
+	TCA_INGRESS_MIRROR = 4
+
+	TCA_POLICE_UNSPEC     = 0
+	TCA_POLICE_TBF        = 1
+	TCA_POLICE_RATE       = 2
+	TCA_POLICE_PEAKRATE   = 3
+	TCA_POLICE_AVRATE     = 4
+	TCA_POLICE_RESULT     = 5
+	TCA_POLICE_TM         = 6
+	TCA_POLICE_PAD        = 7
+	TCA_POLICE_RATE64     = 8
+	TCA_POLICE_PEAKRATE64 = 9
+
+	TCA_SKBEDIT_UNSPEC        = 0
+	TCA_SKBEDIT_TM            = 1
+	TCA_SKBEDIT_PARMS         = 2
+	TCA_SKBEDIT_PRIORITY      = 3
+	TCA_SKBEDIT_QUEUE_MAPPING = 4
+	TCA_SKBEDIT_MARK          = 5
+	TCA_SKBEDIT_PAD           = 6
+	TCA_SKBEDIT_PTYPE         = 7
+	TCA_SKBEDIT_MASK          = 8
+	TCA_SKBEDIT_FLAGS         = 9
+
+	TCA_VLAN_UNSPEC             = 0
+	TCA_VLAN_TM                 = 1
+	TCA_VLAN_PARMS              = 2
+	TCA_VLAN_PUSH_VLAN_ID       = 3
+	TCA_VLAN_PUSH_VLAN_PROTOCOL = 4
+	TCA_VLAN_PAD                = 5
+	TCA_VLAN_PUSH_VLAN_PRIORITY = 6
+
+	TCA_VLAN_ACT_POP    = 1
+	TCA_VLAN_ACT_PUSH   = 2
+	TCA_VLAN_ACT_MODIFY = 3
+
+	TCA_PEDIT_UNSPEC   = 0
+	TCA_PEDIT_TM       = 1
+	TCA_PEDIT_PARMS    = 2
+	TCA_PEDIT_PAD      = 3
+	TCA_PEDIT_PARMS_EX = 4
+	TCA_PEDIT_KEYS_EX  = 5
+	TCA_PEDIT_KEY_EX   = 6
+
+	TCA_PEDIT_KEY_EX_HTYPE = 1
+	TCA_PEDIT_KEY_EX_CMD   = 2
+
+	TCA_PEDIT_KEY_EX_HDR_TYPE_NETWORK = 0
+	TCA_PEDIT_KEY_EX_HDR_TYPE_ETH     = 1
+	TCA_PEDIT_KEY_EX_HDR_TYPE_IP4     = 2
+	TCA_PEDIT_KEY_EX_HDR_TYPE_IP6     = 3
+	TCA_PEDIT_KEY_EX_HDR_TYPE_TCP     = 4
+	TCA_PEDIT_KEY_EX_HDR_TYPE_UDP     = 5
+
+	TCA_PEDIT_KEY_EX_CMD_SET = 0
+	TCA_PEDIT_KEY_EX_CMD_ADD = 1
+
+	ETH_P_ALL    = 0x0003
+	ETH_P_IP     = 0x0800
+	ETH_P_ARP    = 0x0806
+	ETH_P_IPV6   = 0x86dd
+	ETH_P_8021Q  = 0x8100
+	ETH_P_8021AD = 0x88a8
+
+	/* Operational states (RFC 2863) */
+	IF_OPER_UNKNOWN        = 0
+	IF_OPER_NOTPRESENT     = 1
+	IF_OPER_DOWN           = 2
+	IF_OPER_LOWERLAYERDOWN = 3
+	IF_OPER_TESTING        = 4
+	IF_OPER_DORMANT        = 5
+	IF_OPER_UP             = 6
+
+	IFNAMSIZ = 16
+)
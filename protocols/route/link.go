@@ -0,0 +1,580 @@
+package route
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const SizeofIfInfomsg = 16
+
+type IfInfomsg struct {
+	Family uint8
+	Type   uint16 /* ARPHRD_* */
+	Index  int32
+	Flags  uint32 /* IFF_* */
+	Change uint32
+}
+
+type LinkStats64 struct {
+	RxPackets         uint64
+	TxPackets         uint64
+	RxBytes           uint64
+	TxBytes           uint64
+	RxErrors          uint64
+	TxErrors          uint64
+	RxDropped         uint64
+	TxDropped         uint64
+	Multicast         uint64
+	Collisions        uint64
+	RxLengthErrors    uint64
+	RxOverErrors      uint64
+	RxCrcErrors       uint64
+	RxFrameErrors     uint64
+	RxFifoErrors      uint64
+	RxMissedErrors    uint64
+	TxAbortedErrors   uint64
+	TxCarrierErrors   uint64
+	TxFifoErrors      uint64
+	TxHeartbeatErrors uint64
+	TxWindowErrors    uint64
+	RxCompressed      uint64
+	TxCompressed      uint64
+	RxNohandler       uint64
+	RxOtherhostDrop   uint64
+}
+
+// LinkInfo is the kind specific part of a link, carried in IFLA_LINKINFO.
+type LinkInfo interface {
+	Kind() string
+	InfoData() []netlink.NetlinkAttr
+	ParseInfoData(attrs []netlink.NetlinkAttr) error
+}
+
+// linkKinds holds a constructor for every kind with typed IFLA_INFO_DATA.
+var linkKinds = map[string]func() LinkInfo{
+	"dummy":     func() LinkInfo { return &Dummy{} },
+	"veth":      func() LinkInfo { return &Veth{} },
+	"bridge":    func() LinkInfo { return &Bridge{} },
+	"vlan":      func() LinkInfo { return &Vlan{} },
+	"vxlan":     func() LinkInfo { return &Vxlan{} },
+	"gre":       func() LinkInfo { return &Gre{KindName: "gre"} },
+	"gretap":    func() LinkInfo { return &Gre{KindName: "gretap"} },
+	"ip6gre":    func() LinkInfo { return &Gre{KindName: "ip6gre"} },
+	"ip6gretap": func() LinkInfo { return &Gre{KindName: "ip6gretap"} },
+	"ipip":      func() LinkInfo { return &Iptun{KindName: "ipip"} },
+	"sit":       func() LinkInfo { return &Iptun{KindName: "sit"} },
+	"geneve":    func() LinkInfo { return &Geneve{} },
+	"macvlan":   func() LinkInfo { return &Macvlan{KindName: "macvlan"} },
+	"macvtap":   func() LinkInfo { return &Macvlan{KindName: "macvtap"} },
+	"ipvlan":    func() LinkInfo { return &Ipvlan{} },
+	"vrf":       func() LinkInfo { return &Vrf{} },
+}
+
+type Link struct {
+	IfInfomsg
+	Name         string
+	MTU          uint32
+	TxQLen       uint32
+	HardwareAddr net.HardwareAddr
+	Broadcast    net.HardwareAddr
+	OperState    uint8 /* IF_OPER_* */
+	MasterIndex  int32
+	ParentIndex  int32 /* IFLA_LINK */
+	Alias        string
+	Stats64      *LinkStats64
+	Info         LinkInfo
+	SlaveKind    string
+	BridgePort   *BridgePort
+	Attrs        []netlink.NetlinkAttr
+}
+
+// GenericLinkInfo keeps the raw IFLA_INFO_DATA of kinds without typed support.
+type GenericLinkInfo struct {
+	KindName string
+	Data     []netlink.NetlinkAttr
+}
+
+type Dummy struct{}
+
+type Veth struct {
+	PeerName         string
+	PeerHardwareAddr net.HardwareAddr
+}
+
+// Bridge holds the global bridge options. Timers are in hundredths of a
+// second and zero values are left to the kernel; the Has* fields tell
+// whether the boolean options next to them are set.
+type Bridge struct {
+	ForwardDelay        uint32
+	HelloTime           uint32
+	MaxAge              uint32
+	AgeingTime          uint32
+	StpState            uint32
+	HasStpState         bool
+	Priority            uint16
+	VlanFiltering       bool
+	HasVlanFiltering    bool
+	VlanProtocol        uint16 /* ETH_P_8021Q, ETH_P_8021AD */
+	VlanDefaultPvid     uint16
+	VlanStatsEnabled    bool
+	HasVlanStatsEnabled bool
+	McastSnooping       bool
+	HasMcastSnooping    bool
+}
+
+type Vlan struct {
+	Id       uint16
+	Protocol uint16 /* ETH_P_8021Q, ETH_P_8021AD */
+}
+
+func IfInfomsgfromWireFormat(data []byte) *IfInfomsg {
+	return &IfInfomsg{
+		Family: data[0],
+		Type:   *(*uint16)(unsafe.Pointer(&data[2:4][0])),
+		Index:  *(*int32)(unsafe.Pointer(&data[4:8][0])),
+		Flags:  *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+		Change: *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+	}
+}
+
+func (ifi *IfInfomsg) toWireFormat() []byte {
+	b := make([]byte, SizeofIfInfomsg)
+	b[0] = ifi.Family
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = ifi.Type
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = ifi.Index
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = ifi.Flags
+	*(*uint32)(unsafe.Pointer(&b[12:16][0])) = ifi.Change
+	return b
+}
+
+func LinkStats64fromWireFormat(data []byte) *LinkStats64 {
+	st := &LinkStats64{}
+	n := int(unsafe.Sizeof(*st))
+	if len(data) < n {
+		n = len(data)
+	}
+	copy((*[unsafe.Sizeof(LinkStats64{})]byte)(unsafe.Pointer(st))[:n], data[:n])
+	return st
+}
+
+func LinkfromWireFormat(data []byte) (*Link, error) {
+	if len(data) < SizeofIfInfomsg {
+		return nil, errors.New("short ifinfomsg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofIfInfomsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Link{
+		IfInfomsg: *IfInfomsgfromWireFormat(data),
+		Attrs:     attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_IFNAME:
+			l.Name = attr.String()
+		case IFLA_MTU:
+			l.MTU = attr.Uint32()
+		case IFLA_TXQLEN:
+			l.TxQLen = attr.Uint32()
+		case IFLA_ADDRESS:
+			l.HardwareAddr = net.HardwareAddr(attr.Data)
+		case IFLA_BROADCAST:
+			l.Broadcast = net.HardwareAddr(attr.Data)
+		case IFLA_OPERSTATE:
+			l.OperState = attr.Uint8()
+		case IFLA_MASTER:
+			l.MasterIndex = int32(attr.Uint32())
+		case IFLA_LINK:
+			l.ParentIndex = int32(attr.Uint32())
+		case IFLA_IFALIAS:
+			l.Alias = attr.String()
+		case IFLA_STATS64:
+			l.Stats64 = LinkStats64fromWireFormat(attr.Data)
+		case IFLA_LINKINFO:
+			err := l.parseLinkInfo(attr)
+			if err != nil {
+				return nil, err
+			}
+		case IFLA_PROTINFO:
+			if l.Family == syscall.AF_BRIDGE {
+				pattrs, err := attr.Nested()
+				if err != nil {
+					return nil, err
+				}
+				l.BridgePort = BridgePortfromAttrs(pattrs)
+			}
+		}
+	}
+
+	return l, nil
+}
+
+func (l *Link) parseLinkInfo(attr netlink.NetlinkAttr) error {
+	infoAttrs, err := attr.Nested()
+	if err != nil {
+		return err
+	}
+
+	kind := ""
+	var data, slaveData []netlink.NetlinkAttr
+
+	for _, iattr := range infoAttrs {
+		switch iattr.AttrType() {
+		case IFLA_INFO_KIND:
+			kind = iattr.String()
+		case IFLA_INFO_DATA:
+			data, err = iattr.Nested()
+			if err != nil {
+				return err
+			}
+		case IFLA_INFO_SLAVE_KIND:
+			l.SlaveKind = iattr.String()
+		case IFLA_INFO_SLAVE_DATA:
+			slaveData, err = iattr.Nested()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if l.SlaveKind == "bridge" {
+		l.BridgePort = BridgePortfromAttrs(slaveData)
+	}
+
+	if kind == "" {
+		return nil
+	}
+
+	newInfo, ok := linkKinds[kind]
+	if !ok {
+		l.Info = &GenericLinkInfo{KindName: kind, Data: data}
+		return nil
+	}
+
+	l.Info = newInfo()
+	return l.Info.ParseInfoData(data)
+}
+
+func (l *Link) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+
+	if l.Name != "" {
+		attrs = append(attrs, netlink.NewAttrString(IFLA_IFNAME, l.Name))
+	}
+	if l.MTU != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_MTU, l.MTU))
+	}
+	if l.TxQLen != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_TXQLEN, l.TxQLen))
+	}
+	if len(l.HardwareAddr) != 0 {
+		attrs = append(attrs, netlink.NewAttr(IFLA_ADDRESS, l.HardwareAddr))
+	}
+	if len(l.Broadcast) != 0 {
+		attrs = append(attrs, netlink.NewAttr(IFLA_BROADCAST, l.Broadcast))
+	}
+	if l.MasterIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_MASTER, uint32(l.MasterIndex)))
+	}
+	if l.ParentIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_LINK, uint32(l.ParentIndex)))
+	}
+	if l.Alias != "" {
+		attrs = append(attrs, netlink.NewAttrString(IFLA_IFALIAS, l.Alias))
+	}
+	if l.Info != nil {
+		info := []netlink.NetlinkAttr{
+			netlink.NewAttrString(IFLA_INFO_KIND, l.Info.Kind()),
+		}
+		if data := l.Info.InfoData(); len(data) != 0 {
+			info = append(info, netlink.NewAttrNested(IFLA_INFO_DATA, data))
+		}
+		attrs = append(attrs, netlink.NewAttrNested(IFLA_LINKINFO, info))
+	}
+
+	return attrs
+}
+
+func (l *Link) toWireFormat() []byte {
+	ifi := l.IfInfomsg
+	if ifi.Change == 0 && ifi.Flags != 0 {
+		ifi.Change = ifi.Flags
+	}
+	b := ifi.toWireFormat()
+	return append(b, netlink.AttrsToWireFormat(l.toAttrs())...)
+}
+
+func (info *GenericLinkInfo) Kind() string {
+	return info.KindName
+}
+
+func (info *GenericLinkInfo) InfoData() []netlink.NetlinkAttr {
+	return info.Data
+}
+
+func (info *GenericLinkInfo) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	info.Data = attrs
+	return nil
+}
+
+func (info *Dummy) Kind() string {
+	return "dummy"
+}
+
+func (info *Dummy) InfoData() []netlink.NetlinkAttr {
+	return nil
+}
+
+func (info *Dummy) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	return nil
+}
+
+func (info *Veth) Kind() string {
+	return "veth"
+}
+
+func (info *Veth) InfoData() []netlink.NetlinkAttr {
+	if info.PeerName == "" && len(info.PeerHardwareAddr) == 0 {
+		return nil
+	}
+
+	peer := &Link{Name: info.PeerName, HardwareAddr: info.PeerHardwareAddr}
+	return []netlink.NetlinkAttr{
+		netlink.NewAttr(VETH_INFO_PEER, peer.toWireFormat()),
+	}
+}
+
+func (info *Veth) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		if attr.AttrType() != VETH_INFO_PEER {
+			continue
+		}
+		peer, err := LinkfromWireFormat(attr.Data)
+		if err != nil {
+			return err
+		}
+		info.PeerName = peer.Name
+		info.PeerHardwareAddr = peer.HardwareAddr
+	}
+	return nil
+}
+
+func (info *Bridge) Kind() string {
+	return "bridge"
+}
+
+func (info *Bridge) InfoData() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+	if info.ForwardDelay != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_BR_FORWARD_DELAY, info.ForwardDelay))
+	}
+	if info.HelloTime != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_BR_HELLO_TIME, info.HelloTime))
+	}
+	if info.MaxAge != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_BR_MAX_AGE, info.MaxAge))
+	}
+	if info.AgeingTime != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_BR_AGEING_TIME, info.AgeingTime))
+	}
+	if info.HasStpState {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_BR_STP_STATE, info.StpState))
+	}
+	if info.Priority != 0 {
+		attrs = append(attrs, netlink.NewAttrUint16(IFLA_BR_PRIORITY, info.Priority))
+	}
+	if info.HasVlanFiltering {
+		attrs = append(attrs, netlink.NewAttrUint8(IFLA_BR_VLAN_FILTERING, boolToUint8(info.VlanFiltering)))
+	}
+	if info.VlanProtocol != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(IFLA_BR_VLAN_PROTOCOL, info.VlanProtocol))
+	}
+	if info.VlanDefaultPvid != 0 {
+		attrs = append(attrs, netlink.NewAttrUint16(IFLA_BR_VLAN_DEFAULT_PVID, info.VlanDefaultPvid))
+	}
+	if info.HasVlanStatsEnabled {
+		attrs = append(attrs, netlink.NewAttrUint8(IFLA_BR_VLAN_STATS_ENABLED, boolToUint8(info.VlanStatsEnabled)))
+	}
+	if info.HasMcastSnooping {
+		attrs = append(attrs, netlink.NewAttrUint8(IFLA_BR_MCAST_SNOOPING, boolToUint8(info.McastSnooping)))
+	}
+	return attrs
+}
+
+func (info *Bridge) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_BR_FORWARD_DELAY:
+			info.ForwardDelay = attr.Uint32()
+		case IFLA_BR_HELLO_TIME:
+			info.HelloTime = attr.Uint32()
+		case IFLA_BR_MAX_AGE:
+			info.MaxAge = attr.Uint32()
+		case IFLA_BR_AGEING_TIME:
+			info.AgeingTime = attr.Uint32()
+		case IFLA_BR_STP_STATE:
+			info.StpState = attr.Uint32()
+			info.HasStpState = true
+		case IFLA_BR_PRIORITY:
+			info.Priority = attr.Uint16()
+		case IFLA_BR_VLAN_FILTERING:
+			info.VlanFiltering = attr.Uint8() != 0
+			info.HasVlanFiltering = true
+		case IFLA_BR_VLAN_PROTOCOL:
+			info.VlanProtocol = attr.NetUint16()
+		case IFLA_BR_VLAN_DEFAULT_PVID:
+			info.VlanDefaultPvid = attr.Uint16()
+		case IFLA_BR_VLAN_STATS_ENABLED:
+			info.VlanStatsEnabled = attr.Uint8() != 0
+			info.HasVlanStatsEnabled = true
+		case IFLA_BR_MCAST_SNOOPING:
+			info.McastSnooping = attr.Uint8() != 0
+			info.HasMcastSnooping = true
+		}
+	}
+	return nil
+}
+
+func (info *Vlan) Kind() string {
+	return "vlan"
+}
+
+func (info *Vlan) InfoData() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrUint16(IFLA_VLAN_ID, info.Id),
+	}
+	if info.Protocol != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(IFLA_VLAN_PROTOCOL, info.Protocol))
+	}
+	return attrs
+}
+
+func (info *Vlan) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_VLAN_ID:
+			info.Id = attr.Uint16()
+		case IFLA_VLAN_PROTOCOL:
+			info.Protocol = attr.NetUint16()
+		}
+	}
+	return nil
+}
+
+func (rl *RouteNLSocket) ListLinks() ([]*Link, error) {
+	ifi := &IfInfomsg{Family: syscall.AF_UNSPEC}
+
+	msgList, err := rl.Execute(RTM_GETLINK, syscall.NLM_F_DUMP, ifi.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Link{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWLINK {
+			continue
+		}
+		l, err := LinkfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, l)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) getLink(ifi *IfInfomsg, attrs []netlink.NetlinkAttr) (*Link, error) {
+	data := append(ifi.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+
+	msgList, err := rl.Execute(RTM_GETLINK, 0, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgList {
+		if msg.Header.Type == RTM_NEWLINK {
+			return LinkfromWireFormat(msg.Data)
+		}
+	}
+
+	return nil, syscall.ENODEV
+}
+
+func (rl *RouteNLSocket) GetLink(index int32) (*Link, error) {
+	return rl.getLink(&IfInfomsg{Family: syscall.AF_UNSPEC, Index: index}, nil)
+}
+
+func (rl *RouteNLSocket) GetLinkByName(name string) (*Link, error) {
+	return rl.getLink(&IfInfomsg{Family: syscall.AF_UNSPEC}, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IFLA_IFNAME, name),
+	})
+}
+
+// AddLink creates a new link. The link kind is taken from link.Info.
+func (rl *RouteNLSocket) AddLink(link *Link) error {
+	_, err := rl.Execute(RTM_NEWLINK, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, link.toWireFormat())
+	return err
+}
+
+// ModifyLink applies the attributes set in link to the existing link with
+// the same index.
+func (rl *RouteNLSocket) ModifyLink(link *Link) error {
+	_, err := rl.Execute(RTM_NEWLINK, 0, link.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) DelLink(index int32) error {
+	ifi := &IfInfomsg{Family: syscall.AF_UNSPEC, Index: index}
+	_, err := rl.Execute(RTM_DELLINK, 0, ifi.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) setLink(ifi *IfInfomsg, attrs []netlink.NetlinkAttr) error {
+	data := append(ifi.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+	_, err := rl.Execute(RTM_NEWLINK, 0, data)
+	return err
+}
+
+func (rl *RouteNLSocket) SetLinkUp(index int32) error {
+	return rl.setLink(&IfInfomsg{Index: index, Flags: syscall.IFF_UP, Change: syscall.IFF_UP}, nil)
+}
+
+func (rl *RouteNLSocket) SetLinkDown(index int32) error {
+	return rl.setLink(&IfInfomsg{Index: index, Flags: 0, Change: syscall.IFF_UP}, nil)
+}
+
+func (rl *RouteNLSocket) SetLinkMTU(index int32, mtu uint32) error {
+	return rl.setLink(&IfInfomsg{Index: index}, []netlink.NetlinkAttr{
+		netlink.NewAttrUint32(IFLA_MTU, mtu),
+	})
+}
+
+func (rl *RouteNLSocket) SetLinkName(index int32, name string) error {
+	return rl.setLink(&IfInfomsg{Index: index}, []netlink.NetlinkAttr{
+		netlink.NewAttrString(IFLA_IFNAME, name),
+	})
+}
+
+func (rl *RouteNLSocket) SetLinkHardwareAddr(index int32, addr net.HardwareAddr) error {
+	return rl.setLink(&IfInfomsg{Index: index}, []netlink.NetlinkAttr{
+		netlink.NewAttr(IFLA_ADDRESS, addr),
+	})
+}
+
+// SetLinkMaster enslaves the link to master. A master index of 0 releases
+// the link from its current master.
+func (rl *RouteNLSocket) SetLinkMaster(index, master int32) error {
+	return rl.setLink(&IfInfomsg{Index: index}, []netlink.NetlinkAttr{
+		netlink.NewAttrUint32(IFLA_MASTER, uint32(master)),
+	})
+}
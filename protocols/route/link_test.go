@@ -0,0 +1,264 @@
+package route
+
+import (
+	"bytes"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestIfInfomsgWireFormat(t *testing.T) {
+	ifi := &IfInfomsg{Family: syscall.AF_BRIDGE, Type: syscall.ARPHRD_ETHER, Index: 7, Flags: syscall.IFF_UP, Change: 0xffffffff}
+
+	b := ifi.toWireFormat()
+	if len(b) != SizeofIfInfomsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if b[1] != 0 {
+		t.Error("padding byte set")
+	}
+	if got := IfInfomsgfromWireFormat(b); *got != *ifi {
+		t.Errorf("got %+v, want %+v", got, ifi)
+	}
+}
+
+func TestLinkWireFormat(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	peerMac, _ := net.ParseMAC("02:00:00:00:00:02")
+
+	l := &Link{
+		IfInfomsg:    IfInfomsg{Index: 3, Flags: syscall.IFF_UP},
+		Name:         "veth0",
+		MTU:          1400,
+		TxQLen:       100,
+		HardwareAddr: mac,
+		MasterIndex:  5,
+		Alias:        "uplink",
+		Info:         &Veth{PeerName: "veth1", PeerHardwareAddr: peerMac},
+	}
+
+	b := l.toWireFormat()
+
+	/* Change defaults to the flags that are set */
+	if ifi := IfInfomsgfromWireFormat(b); ifi.Change != syscall.IFF_UP {
+		t.Errorf("change %#x", ifi.Change)
+	}
+
+	got, err := LinkfromWireFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 3 || got.Name != "veth0" || got.MTU != 1400 || got.TxQLen != 100 ||
+		!bytes.Equal(got.HardwareAddr, mac) || got.MasterIndex != 5 || got.Alias != "uplink" {
+		t.Errorf("got %+v", got)
+	}
+
+	veth, ok := got.Info.(*Veth)
+	if !ok {
+		t.Fatalf("info %T", got.Info)
+	}
+	if veth.PeerName != "veth1" || !bytes.Equal(veth.PeerHardwareAddr, peerMac) {
+		t.Errorf("peer %+v", veth)
+	}
+}
+
+func TestLinkInfoKinds(t *testing.T) {
+	tests := []LinkInfo{
+		&Dummy{},
+		&Bridge{ForwardDelay: 1500, StpState: 1, HasStpState: true, Priority: 0x8000,
+			VlanFiltering: true, HasVlanFiltering: true, VlanProtocol: 0x88a8, VlanDefaultPvid: 1},
+		&Vlan{Id: 100, Protocol: 0x8100},
+		&GenericLinkInfo{KindName: "other", Data: []netlink.NetlinkAttr{netlink.NewAttrUint32(1, 2)}},
+	}
+
+	for _, info := range tests {
+		l := &Link{Name: "x", Info: info}
+		got, err := LinkfromWireFormat(l.toWireFormat())
+		if err != nil {
+			t.Fatalf("%s: %v", info.Kind(), err)
+		}
+		if got.Info == nil || got.Info.Kind() != info.Kind() {
+			t.Errorf("%s: got %#v", info.Kind(), got.Info)
+			continue
+		}
+		want := netlink.AttrsToWireFormat(info.InfoData())
+		have := netlink.AttrsToWireFormat(got.Info.InfoData())
+		if !bytes.Equal(have, want) {
+			t.Errorf("%s: info data % x, want % x", info.Kind(), have, want)
+		}
+	}
+}
+
+func TestLinkStats64fromWireFormat(t *testing.T) {
+	b := make([]byte, 8*3)
+	b[0] = 1
+	b[8] = 2
+	b[16] = 3
+
+	/* older kernels send fewer counters */
+	st := LinkStats64fromWireFormat(b)
+	if st.RxPackets != 1 || st.TxPackets != 2 || st.RxBytes != 3 || st.TxBytes != 0 {
+		t.Errorf("got %+v", st)
+	}
+}
+
+func TestLinkfromWireFormatShort(t *testing.T) {
+	_, err := LinkfromWireFormat(make([]byte, SizeofIfInfomsg-1))
+	if err == nil {
+		t.Error("short ifinfomsg accepted")
+	}
+}
+
+func TestLinks(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddLink(&Link{Name: "br0", Info: &Bridge{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := rl.ListLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := map[string]string{}
+	for _, l := range links {
+		kind := ""
+		if l.Info != nil {
+			kind = l.Info.Kind()
+		}
+		kinds[l.Name] = kind
+	}
+	if kinds["lo"] != "" || kinds["veth0"] != "veth" || kinds["veth1"] != "veth" || kinds["br0"] != "bridge" {
+		t.Errorf("links %v", kinds)
+	}
+
+	veth := mustLink(t, rl, "veth0")
+	br := mustLink(t, rl, "br0")
+
+	if l, err := rl.GetLink(veth.Index); err != nil || l.Name != "veth0" {
+		t.Errorf("GetLink(%d): %v %v", veth.Index, l, err)
+	}
+	if veth.Stats64 == nil {
+		t.Error("no stats64")
+	}
+
+	err = rl.SetLinkUp(br.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := mustLink(t, rl, "br0"); l.Flags&syscall.IFF_UP == 0 {
+		t.Error("br0 not up")
+	}
+	err = rl.SetLinkDown(br.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := mustLink(t, rl, "br0"); l.Flags&syscall.IFF_UP != 0 {
+		t.Error("br0 still up")
+	}
+
+	err = rl.SetLinkMTU(veth.Index, 1400)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac, _ := net.ParseMAC("02:11:22:33:44:55")
+	err = rl.SetLinkHardwareAddr(veth.Index, mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.ModifyLink(&Link{IfInfomsg: IfInfomsg{Index: veth.Index}, Alias: "test link"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := mustLink(t, rl, "veth0")
+	if l.MTU != 1400 || !bytes.Equal(l.HardwareAddr, mac) || l.Alias != "test link" {
+		t.Errorf("veth0: mtu %d address %s alias %q", l.MTU, l.HardwareAddr, l.Alias)
+	}
+
+	err = rl.SetLinkName(veth.Index, "eth9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := mustLink(t, rl, "eth9"); l.Index != veth.Index {
+		t.Errorf("eth9 has index %d, want %d", l.Index, veth.Index)
+	}
+
+	err = rl.SetLinkMaster(veth.Index, br.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = mustLink(t, rl, "eth9")
+	if l.MasterIndex != br.Index || l.SlaveKind != "bridge" {
+		t.Errorf("eth9: master %d slave kind %q", l.MasterIndex, l.SlaveKind)
+	}
+	err = rl.SetLinkMaster(veth.Index, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := mustLink(t, rl, "eth9"); l.MasterIndex != 0 {
+		t.Errorf("eth9 still enslaved to %d", l.MasterIndex)
+	}
+
+	err = rl.DelLink(veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rl.GetLink(veth.Index); err != syscall.ENODEV {
+		t.Errorf("deleted link: %v", err)
+	}
+	/* the peer goes away with it */
+	if _, err := rl.GetLinkByName("veth1"); err != syscall.ENODEV {
+		t.Errorf("veth1: %v", err)
+	}
+
+	err = rl.AddLink(&Link{Name: "br0", Info: &Bridge{}})
+	if err != syscall.EEXIST {
+		t.Errorf("adding br0 again: %v", err)
+	}
+}
+
+func TestLinkDummy(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "dummy0", MTU: 9000, Info: &Dummy{}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := mustLink(t, rl, "dummy0")
+	if _, ok := l.Info.(*Dummy); !ok || l.MTU != 9000 {
+		t.Errorf("dummy0: info %T mtu %d", l.Info, l.MTU)
+	}
+}
+
+func TestLinkVlan(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parent := mustLink(t, rl, "veth0")
+
+	err = rl.AddLink(&Link{Name: "veth0.10", ParentIndex: parent.Index, Info: &Vlan{Id: 10}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := mustLink(t, rl, "veth0.10")
+	vlan, ok := l.Info.(*Vlan)
+	if !ok || vlan.Id != 10 || vlan.Protocol != 0x8100 || l.ParentIndex != parent.Index {
+		t.Errorf("veth0.10: parent %d info %#v", l.ParentIndex, l.Info)
+	}
+}
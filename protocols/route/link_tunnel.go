@@ -0,0 +1,459 @@
+package route
+
+import (
+	"net"
+
+	"github.com/apuigsech/netlink"
+)
+
+// Vxlan is a VXLAN overlay device. Group is either the remote VTEP or the
+// multicast group used for flooding. Boolean options are always sent, so
+// the zero value disables them.
+type Vxlan struct {
+	Id              uint32
+	Group           net.IP
+	Local           net.IP
+	LinkIndex       int32
+	TTL             uint8
+	TOS             uint8
+	Learning        bool
+	Proxy           bool
+	RSC             bool
+	L2Miss          bool
+	L3Miss          bool
+	Ageing          uint32
+	Limit           uint32
+	Port            uint16
+	PortLow         uint16
+	PortHigh        uint16
+	UDPCsum         bool
+	UDPZeroCsum6Tx  bool
+	UDPZeroCsum6Rx  bool
+	GBP             bool
+	CollectMetadata bool
+}
+
+// Gre covers the gre, gretap, ip6gre and ip6gretap kinds. EncapLimit,
+// FlowInfo and Flags only apply to the IPv6 kinds. PMtuDisc is only sent
+// with HasPMtuDisc set, the kernel enables path MTU discovery otherwise.
+type Gre struct {
+	KindName        string
+	LinkIndex       int32
+	IFlags          uint16 /* GRE_* */
+	OFlags          uint16
+	IKey            uint32
+	OKey            uint32
+	Local           net.IP
+	Remote          net.IP
+	TTL             uint8
+	TOS             uint8
+	PMtuDisc        bool
+	HasPMtuDisc     bool
+	EncapLimit      uint8
+	FlowInfo        uint32
+	Flags           uint32
+	IgnoreDF        bool
+	CollectMetadata bool
+	FwMark          uint32
+}
+
+// Iptun covers the ipip and sit kinds. PMtuDisc is only sent with
+// HasPMtuDisc set, as for Gre.
+type Iptun struct {
+	KindName        string
+	LinkIndex       int32
+	Local           net.IP
+	Remote          net.IP
+	TTL             uint8
+	TOS             uint8
+	Proto           uint8
+	PMtuDisc        bool
+	HasPMtuDisc     bool
+	Flags           uint16 /* SIT_ISATAP */
+	FwMark          uint32
+	CollectMetadata bool
+}
+
+type Geneve struct {
+	Id              uint32
+	Remote          net.IP
+	TTL             uint8
+	TOS             uint8
+	TTLInherit      bool
+	DF              uint8
+	Label           uint32
+	Port            uint16
+	UDPCsum         bool
+	UDPZeroCsum6Tx  bool
+	UDPZeroCsum6Rx  bool
+	CollectMetadata bool
+}
+
+func boolToUint8(b bool) uint8 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (info *Vxlan) Kind() string {
+	return "vxlan"
+}
+
+func (info *Vxlan) InfoData() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrUint32(IFLA_VXLAN_ID, info.Id),
+	}
+
+	if ip4 := info.Group.To4(); ip4 != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_VXLAN_GROUP, ip4))
+	} else if info.Group != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_VXLAN_GROUP6, info.Group.To16()))
+	}
+	if ip4 := info.Local.To4(); ip4 != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_VXLAN_LOCAL, ip4))
+	} else if info.Local != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_VXLAN_LOCAL6, info.Local.To16()))
+	}
+	if info.LinkIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_VXLAN_LINK, uint32(info.LinkIndex)))
+	}
+	if info.Ageing != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_VXLAN_AGEING, info.Ageing))
+	}
+	if info.Limit != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_VXLAN_LIMIT, info.Limit))
+	}
+	if info.Port != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(IFLA_VXLAN_PORT, info.Port))
+	}
+	if info.PortLow != 0 || info.PortHigh != 0 {
+		pr := netlink.NewAttrNetUint32(IFLA_VXLAN_PORT_RANGE, uint32(info.PortLow)<<16|uint32(info.PortHigh))
+		attrs = append(attrs, pr)
+	}
+	if info.GBP {
+		attrs = append(attrs, netlink.NewAttrFlag(IFLA_VXLAN_GBP))
+	}
+	if info.CollectMetadata {
+		attrs = append(attrs, netlink.NewAttrUint8(IFLA_VXLAN_COLLECT_METADATA, 1))
+	}
+
+	attrs = append(attrs,
+		netlink.NewAttrUint8(IFLA_VXLAN_TTL, info.TTL),
+		netlink.NewAttrUint8(IFLA_VXLAN_TOS, info.TOS),
+		netlink.NewAttrUint8(IFLA_VXLAN_LEARNING, boolToUint8(info.Learning)),
+		netlink.NewAttrUint8(IFLA_VXLAN_PROXY, boolToUint8(info.Proxy)),
+		netlink.NewAttrUint8(IFLA_VXLAN_RSC, boolToUint8(info.RSC)),
+		netlink.NewAttrUint8(IFLA_VXLAN_L2MISS, boolToUint8(info.L2Miss)),
+		netlink.NewAttrUint8(IFLA_VXLAN_L3MISS, boolToUint8(info.L3Miss)),
+		netlink.NewAttrUint8(IFLA_VXLAN_UDP_CSUM, boolToUint8(info.UDPCsum)),
+		netlink.NewAttrUint8(IFLA_VXLAN_UDP_ZERO_CSUM6_TX, boolToUint8(info.UDPZeroCsum6Tx)),
+		netlink.NewAttrUint8(IFLA_VXLAN_UDP_ZERO_CSUM6_RX, boolToUint8(info.UDPZeroCsum6Rx)),
+	)
+
+	return attrs
+}
+
+func (info *Vxlan) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_VXLAN_ID:
+			info.Id = attr.Uint32()
+		case IFLA_VXLAN_GROUP, IFLA_VXLAN_GROUP6:
+			info.Group = net.IP(attr.Data)
+		case IFLA_VXLAN_LOCAL, IFLA_VXLAN_LOCAL6:
+			info.Local = net.IP(attr.Data)
+		case IFLA_VXLAN_LINK:
+			info.LinkIndex = int32(attr.Uint32())
+		case IFLA_VXLAN_TTL:
+			info.TTL = attr.Uint8()
+		case IFLA_VXLAN_TOS:
+			info.TOS = attr.Uint8()
+		case IFLA_VXLAN_LEARNING:
+			info.Learning = attr.Uint8() != 0
+		case IFLA_VXLAN_PROXY:
+			info.Proxy = attr.Uint8() != 0
+		case IFLA_VXLAN_RSC:
+			info.RSC = attr.Uint8() != 0
+		case IFLA_VXLAN_L2MISS:
+			info.L2Miss = attr.Uint8() != 0
+		case IFLA_VXLAN_L3MISS:
+			info.L3Miss = attr.Uint8() != 0
+		case IFLA_VXLAN_AGEING:
+			info.Ageing = attr.Uint32()
+		case IFLA_VXLAN_LIMIT:
+			info.Limit = attr.Uint32()
+		case IFLA_VXLAN_PORT:
+			info.Port = attr.NetUint16()
+		case IFLA_VXLAN_PORT_RANGE:
+			pr := attr.NetUint32()
+			info.PortLow = uint16(pr >> 16)
+			info.PortHigh = uint16(pr)
+		case IFLA_VXLAN_UDP_CSUM:
+			info.UDPCsum = attr.Uint8() != 0
+		case IFLA_VXLAN_UDP_ZERO_CSUM6_TX:
+			info.UDPZeroCsum6Tx = attr.Uint8() != 0
+		case IFLA_VXLAN_UDP_ZERO_CSUM6_RX:
+			info.UDPZeroCsum6Rx = attr.Uint8() != 0
+		case IFLA_VXLAN_GBP:
+			info.GBP = true
+		case IFLA_VXLAN_COLLECT_METADATA:
+			info.CollectMetadata = attr.Uint8() != 0
+		}
+	}
+	return nil
+}
+
+func (info *Gre) Kind() string {
+	if info.KindName == "" {
+		return "gre"
+	}
+	return info.KindName
+}
+
+func (info *Gre) isIPv6() bool {
+	kind := info.Kind()
+	return kind == "ip6gre" || kind == "ip6gretap"
+}
+
+func (info *Gre) InfoData() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+
+	if info.LinkIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_GRE_LINK, uint32(info.LinkIndex)))
+	}
+	if info.IFlags != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(IFLA_GRE_IFLAGS, info.IFlags))
+	}
+	if info.OFlags != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(IFLA_GRE_OFLAGS, info.OFlags))
+	}
+	if info.IKey != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(IFLA_GRE_IKEY, info.IKey))
+	}
+	if info.OKey != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(IFLA_GRE_OKEY, info.OKey))
+	}
+
+	if info.isIPv6() {
+		if info.Local != nil {
+			attrs = append(attrs, netlink.NewAttr(IFLA_GRE_LOCAL, info.Local.To16()))
+		}
+		if info.Remote != nil {
+			attrs = append(attrs, netlink.NewAttr(IFLA_GRE_REMOTE, info.Remote.To16()))
+		}
+		attrs = append(attrs,
+			netlink.NewAttrUint8(IFLA_GRE_ENCAP_LIMIT, info.EncapLimit),
+			netlink.NewAttrNetUint32(IFLA_GRE_FLOWINFO, info.FlowInfo),
+			netlink.NewAttrUint32(IFLA_GRE_FLAGS, info.Flags),
+		)
+	} else {
+		if ip4 := info.Local.To4(); ip4 != nil {
+			attrs = append(attrs, netlink.NewAttr(IFLA_GRE_LOCAL, ip4))
+		}
+		if ip4 := info.Remote.To4(); ip4 != nil {
+			attrs = append(attrs, netlink.NewAttr(IFLA_GRE_REMOTE, ip4))
+		}
+		if info.HasPMtuDisc {
+			attrs = append(attrs, netlink.NewAttrUint8(IFLA_GRE_PMTUDISC, boolToUint8(info.PMtuDisc)))
+		}
+		if info.IgnoreDF {
+			attrs = append(attrs, netlink.NewAttrUint8(IFLA_GRE_IGNORE_DF, 1))
+		}
+	}
+
+	attrs = append(attrs,
+		netlink.NewAttrUint8(IFLA_GRE_TTL, info.TTL),
+		netlink.NewAttrUint8(IFLA_GRE_TOS, info.TOS),
+	)
+	if info.FwMark != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_GRE_FWMARK, info.FwMark))
+	}
+	if info.CollectMetadata {
+		attrs = append(attrs, netlink.NewAttrFlag(IFLA_GRE_COLLECT_METADATA))
+	}
+
+	return attrs
+}
+
+func (info *Gre) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_GRE_LINK:
+			info.LinkIndex = int32(attr.Uint32())
+		case IFLA_GRE_IFLAGS:
+			info.IFlags = attr.NetUint16()
+		case IFLA_GRE_OFLAGS:
+			info.OFlags = attr.NetUint16()
+		case IFLA_GRE_IKEY:
+			info.IKey = attr.NetUint32()
+		case IFLA_GRE_OKEY:
+			info.OKey = attr.NetUint32()
+		case IFLA_GRE_LOCAL:
+			info.Local = net.IP(attr.Data)
+		case IFLA_GRE_REMOTE:
+			info.Remote = net.IP(attr.Data)
+		case IFLA_GRE_TTL:
+			info.TTL = attr.Uint8()
+		case IFLA_GRE_TOS:
+			info.TOS = attr.Uint8()
+		case IFLA_GRE_PMTUDISC:
+			info.PMtuDisc = attr.Uint8() != 0
+			info.HasPMtuDisc = true
+		case IFLA_GRE_ENCAP_LIMIT:
+			info.EncapLimit = attr.Uint8()
+		case IFLA_GRE_FLOWINFO:
+			info.FlowInfo = attr.NetUint32()
+		case IFLA_GRE_FLAGS:
+			info.Flags = attr.Uint32()
+		case IFLA_GRE_IGNORE_DF:
+			info.IgnoreDF = attr.Uint8() != 0
+		case IFLA_GRE_FWMARK:
+			info.FwMark = attr.Uint32()
+		case IFLA_GRE_COLLECT_METADATA:
+			info.CollectMetadata = true
+		}
+	}
+	return nil
+}
+
+func (info *Iptun) Kind() string {
+	if info.KindName == "" {
+		return "ipip"
+	}
+	return info.KindName
+}
+
+func (info *Iptun) InfoData() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+
+	if info.LinkIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_IPTUN_LINK, uint32(info.LinkIndex)))
+	}
+	if ip4 := info.Local.To4(); ip4 != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_IPTUN_LOCAL, ip4))
+	}
+	if ip4 := info.Remote.To4(); ip4 != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_IPTUN_REMOTE, ip4))
+	}
+	if info.Proto != 0 {
+		attrs = append(attrs, netlink.NewAttrUint8(IFLA_IPTUN_PROTO, info.Proto))
+	}
+	if info.Kind() == "sit" {
+		attrs = append(attrs, netlink.NewAttrUint16(IFLA_IPTUN_FLAGS, info.Flags))
+	}
+	if info.FwMark != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_IPTUN_FWMARK, info.FwMark))
+	}
+	if info.CollectMetadata {
+		attrs = append(attrs, netlink.NewAttrFlag(IFLA_IPTUN_COLLECT_METADATA))
+	}
+
+	attrs = append(attrs,
+		netlink.NewAttrUint8(IFLA_IPTUN_TTL, info.TTL),
+		netlink.NewAttrUint8(IFLA_IPTUN_TOS, info.TOS),
+	)
+	if info.HasPMtuDisc {
+		attrs = append(attrs, netlink.NewAttrUint8(IFLA_IPTUN_PMTUDISC, boolToUint8(info.PMtuDisc)))
+	}
+
+	return attrs
+}
+
+func (info *Iptun) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_IPTUN_LINK:
+			info.LinkIndex = int32(attr.Uint32())
+		case IFLA_IPTUN_LOCAL:
+			info.Local = net.IP(attr.Data)
+		case IFLA_IPTUN_REMOTE:
+			info.Remote = net.IP(attr.Data)
+		case IFLA_IPTUN_TTL:
+			info.TTL = attr.Uint8()
+		case IFLA_IPTUN_TOS:
+			info.TOS = attr.Uint8()
+		case IFLA_IPTUN_PROTO:
+			info.Proto = attr.Uint8()
+		case IFLA_IPTUN_PMTUDISC:
+			info.PMtuDisc = attr.Uint8() != 0
+			info.HasPMtuDisc = true
+		case IFLA_IPTUN_FLAGS:
+			info.Flags = attr.Uint16()
+		case IFLA_IPTUN_FWMARK:
+			info.FwMark = attr.Uint32()
+		case IFLA_IPTUN_COLLECT_METADATA:
+			info.CollectMetadata = true
+		}
+	}
+	return nil
+}
+
+func (info *Geneve) Kind() string {
+	return "geneve"
+}
+
+func (info *Geneve) InfoData() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrUint32(IFLA_GENEVE_ID, info.Id),
+	}
+
+	if ip4 := info.Remote.To4(); ip4 != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_GENEVE_REMOTE, ip4))
+	} else if info.Remote != nil {
+		attrs = append(attrs, netlink.NewAttr(IFLA_GENEVE_REMOTE6, info.Remote.To16()))
+	}
+	if info.Port != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(IFLA_GENEVE_PORT, info.Port))
+	}
+	if info.Label != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint32(IFLA_GENEVE_LABEL, info.Label))
+	}
+	if info.CollectMetadata {
+		attrs = append(attrs, netlink.NewAttrFlag(IFLA_GENEVE_COLLECT_METADATA))
+	}
+
+	attrs = append(attrs,
+		netlink.NewAttrUint8(IFLA_GENEVE_TTL, info.TTL),
+		netlink.NewAttrUint8(IFLA_GENEVE_TOS, info.TOS),
+		netlink.NewAttrUint8(IFLA_GENEVE_TTL_INHERIT, boolToUint8(info.TTLInherit)),
+		netlink.NewAttrUint8(IFLA_GENEVE_DF, info.DF),
+		netlink.NewAttrUint8(IFLA_GENEVE_UDP_CSUM, boolToUint8(info.UDPCsum)),
+		netlink.NewAttrUint8(IFLA_GENEVE_UDP_ZERO_CSUM6_TX, boolToUint8(info.UDPZeroCsum6Tx)),
+		netlink.NewAttrUint8(IFLA_GENEVE_UDP_ZERO_CSUM6_RX, boolToUint8(info.UDPZeroCsum6Rx)),
+	)
+
+	return attrs
+}
+
+func (info *Geneve) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_GENEVE_ID:
+			info.Id = attr.Uint32()
+		case IFLA_GENEVE_REMOTE, IFLA_GENEVE_REMOTE6:
+			info.Remote = net.IP(attr.Data)
+		case IFLA_GENEVE_TTL:
+			info.TTL = attr.Uint8()
+		case IFLA_GENEVE_TOS:
+			info.TOS = attr.Uint8()
+		case IFLA_GENEVE_TTL_INHERIT:
+			info.TTLInherit = attr.Uint8() != 0
+		case IFLA_GENEVE_DF:
+			info.DF = attr.Uint8()
+		case IFLA_GENEVE_LABEL:
+			info.Label = attr.NetUint32()
+		case IFLA_GENEVE_PORT:
+			info.Port = attr.NetUint16()
+		case IFLA_GENEVE_UDP_CSUM:
+			info.UDPCsum = attr.Uint8() != 0
+		case IFLA_GENEVE_UDP_ZERO_CSUM6_TX:
+			info.UDPZeroCsum6Tx = attr.Uint8() != 0
+		case IFLA_GENEVE_UDP_ZERO_CSUM6_RX:
+			info.UDPZeroCsum6Rx = attr.Uint8() != 0
+		case IFLA_GENEVE_COLLECT_METADATA:
+			info.CollectMetadata = true
+		}
+	}
+	return nil
+}
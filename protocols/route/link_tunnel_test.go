@@ -0,0 +1,233 @@
+package route
+
+import (
+	"net"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+// roundTrip encodes info in a link message and decodes it back.
+func roundTrip(t *testing.T, info LinkInfo) LinkInfo {
+	t.Helper()
+	l, err := LinkfromWireFormat((&Link{Name: "x", Info: info}).toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Info == nil || l.Info.Kind() != info.Kind() {
+		t.Fatalf("%s: got %#v", info.Kind(), l.Info)
+	}
+	return l.Info
+}
+
+func findAttr(attrs []netlink.NetlinkAttr, attrtype uint16) (netlink.NetlinkAttr, bool) {
+	for _, attr := range attrs {
+		if attr.AttrType() == attrtype {
+			return attr, true
+		}
+	}
+	return netlink.NetlinkAttr{}, false
+}
+
+func TestVxlanInfo(t *testing.T) {
+	info := &Vxlan{
+		Id:        42,
+		Group:     net.ParseIP("239.1.1.1"),
+		Local:     net.ParseIP("2001:db8::1"),
+		LinkIndex: 3,
+		TTL:       64,
+		Learning:  true,
+		L2Miss:    true,
+		Ageing:    300,
+		Port:      4789,
+		PortLow:   1000,
+		PortHigh:  2000,
+		UDPCsum:   true,
+		GBP:       true,
+	}
+
+	got := roundTrip(t, info).(*Vxlan)
+	if got.Id != 42 || !got.Group.Equal(info.Group) || !got.Local.Equal(info.Local) || got.LinkIndex != 3 ||
+		got.TTL != 64 || !got.Learning || got.Proxy || !got.L2Miss || got.Ageing != 300 || got.Port != 4789 ||
+		got.PortLow != 1000 || got.PortHigh != 2000 || !got.UDPCsum || !got.GBP || got.CollectMetadata {
+		t.Errorf("got %+v", got)
+	}
+
+	/* the port is in network byte order */
+	attr, _ := findAttr(info.InfoData(), IFLA_VXLAN_PORT)
+	if attr.Data[0] != 4789>>8 || attr.Data[1] != 4789&0xff {
+		t.Errorf("port % x", attr.Data)
+	}
+	attr, _ = findAttr(info.InfoData(), IFLA_VXLAN_GROUP)
+	if len(attr.Data) != 4 {
+		t.Errorf("IPv4 group sent as %d bytes", len(attr.Data))
+	}
+	if _, ok := findAttr(info.InfoData(), IFLA_VXLAN_LOCAL6); !ok {
+		t.Error("IPv6 local address not sent as IFLA_VXLAN_LOCAL6")
+	}
+}
+
+func TestGreInfo(t *testing.T) {
+	info := &Gre{
+		LinkIndex: 2,
+		IFlags:    GRE_KEY,
+		OFlags:    GRE_KEY,
+		IKey:      7,
+		OKey:      8,
+		Local:     net.ParseIP("10.0.0.1"),
+		Remote:    net.ParseIP("10.0.0.2"),
+		TTL:       10,
+		IgnoreDF:  true,
+		FwMark:    5,
+	}
+
+	got := roundTrip(t, info).(*Gre)
+	if got.Kind() != "gre" || got.LinkIndex != 2 || got.IFlags != GRE_KEY || got.OFlags != GRE_KEY ||
+		got.IKey != 7 || got.OKey != 8 || !got.Local.Equal(info.Local) || !got.Remote.Equal(info.Remote) ||
+		got.TTL != 10 || !got.IgnoreDF || got.FwMark != 5 {
+		t.Errorf("got %+v", got)
+	}
+
+	info6 := &Gre{KindName: "ip6gretap", Local: net.ParseIP("2001:db8::1"), Remote: net.ParseIP("2001:db8::2"),
+		EncapLimit: 4, FlowInfo: 0x12345, IgnoreDF: true}
+	got = roundTrip(t, info6).(*Gre)
+	if got.Kind() != "ip6gretap" || !got.Local.Equal(info6.Local) || got.EncapLimit != 4 || got.FlowInfo != 0x12345 {
+		t.Errorf("got %+v", got)
+	}
+	if _, ok := findAttr(info6.InfoData(), IFLA_GRE_IGNORE_DF); ok {
+		t.Error("IFLA_GRE_IGNORE_DF sent for an IPv6 kind")
+	}
+}
+
+func TestTunnelPMtuDisc(t *testing.T) {
+	tests := []LinkInfo{
+		&Gre{},
+		&Gre{HasPMtuDisc: true},
+		&Gre{PMtuDisc: true, HasPMtuDisc: true},
+		&Iptun{},
+		&Iptun{HasPMtuDisc: true},
+		&Iptun{PMtuDisc: true, HasPMtuDisc: true},
+	}
+
+	for _, info := range tests {
+		var attrtype uint16
+		var has, want bool
+		switch info := info.(type) {
+		case *Gre:
+			attrtype, has, want = IFLA_GRE_PMTUDISC, info.HasPMtuDisc, info.PMtuDisc
+		case *Iptun:
+			attrtype, has, want = IFLA_IPTUN_PMTUDISC, info.HasPMtuDisc, info.PMtuDisc
+		}
+
+		/* left unset, the kernel keeps path MTU discovery on */
+		attr, ok := findAttr(info.InfoData(), attrtype)
+		if ok != has {
+			t.Errorf("%s %+v: PMTUDISC sent: %v", info.Kind(), info, ok)
+			continue
+		}
+		if ok && (attr.Uint8() != 0) != want {
+			t.Errorf("%s %+v: PMTUDISC %d", info.Kind(), info, attr.Uint8())
+		}
+
+		switch got := roundTrip(t, info).(type) {
+		case *Gre:
+			if got.HasPMtuDisc != has || got.PMtuDisc != want {
+				t.Errorf("gre: got %+v", got)
+			}
+		case *Iptun:
+			if got.HasPMtuDisc != has || got.PMtuDisc != want {
+				t.Errorf("ipip: got %+v", got)
+			}
+		}
+	}
+}
+
+func TestIptunInfo(t *testing.T) {
+	info := &Iptun{KindName: "sit", Local: net.ParseIP("192.0.2.1"), TTL: 64, Proto: 41, Flags: SIT_ISATAP, FwMark: 3}
+
+	got := roundTrip(t, info).(*Iptun)
+	if got.Kind() != "sit" || !got.Local.Equal(info.Local) || got.Remote != nil || got.TTL != 64 ||
+		got.Proto != 41 || got.Flags != SIT_ISATAP || got.FwMark != 3 {
+		t.Errorf("got %+v", got)
+	}
+
+	if _, ok := findAttr((&Iptun{}).InfoData(), IFLA_IPTUN_FLAGS); ok {
+		t.Error("IFLA_IPTUN_FLAGS sent for ipip")
+	}
+}
+
+func TestGeneveInfo(t *testing.T) {
+	info := &Geneve{Id: 9, Remote: net.ParseIP("2001:db8::9"), TTLInherit: true, DF: 1, Label: 0xabcde, Port: 6081, UDPZeroCsum6Tx: true}
+
+	got := roundTrip(t, info).(*Geneve)
+	if got.Id != 9 || !got.Remote.Equal(info.Remote) || !got.TTLInherit || got.DF != 1 || got.Label != 0xabcde ||
+		got.Port != 6081 || !got.UDPZeroCsum6Tx || got.UDPCsum {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestVirtualInfo(t *testing.T) {
+	mv := roundTrip(t, &Macvlan{KindName: "macvtap", Mode: MACVLAN_MODE_BRIDGE, Flags: 1}).(*Macvlan)
+	if mv.Kind() != "macvtap" || mv.Mode != MACVLAN_MODE_BRIDGE || mv.Flags != 1 {
+		t.Errorf("macvtap: got %+v", mv)
+	}
+
+	iv := roundTrip(t, &Ipvlan{Mode: IPVLAN_MODE_L3, Flags: 2}).(*Ipvlan)
+	if iv.Mode != IPVLAN_MODE_L3 || iv.Flags != 2 {
+		t.Errorf("ipvlan: got %+v", iv)
+	}
+
+	vrf := roundTrip(t, &Vrf{Table: 100}).(*Vrf)
+	if vrf.Table != 100 {
+		t.Errorf("vrf: got %+v", vrf)
+	}
+}
+
+func TestTunnelLinks(t *testing.T) {
+	rl := testNetns(t)
+
+	tests := []*Link{
+		{Name: "vx0", Info: &Vxlan{Id: 10, Port: 4789, Learning: true}},
+		{Name: "gre0", Info: &Gre{Local: net.ParseIP("10.0.0.1"), Remote: net.ParseIP("10.0.0.2"), TTL: 64}},
+		{Name: "ipip0", Info: &Iptun{Remote: net.ParseIP("10.0.0.3"), TTL: 64}},
+		{Name: "gnv0", Info: &Geneve{Id: 11, Remote: net.ParseIP("10.0.0.4")}},
+		{Name: "vrf0", Info: &Vrf{Table: 10}},
+	}
+
+	for _, l := range tests {
+		t.Run(l.Info.Kind(), func(t *testing.T) {
+			err := rl.AddLink(l)
+			skipUnsupported(t, err)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := mustLink(t, rl, l.Name).Info
+			switch info := got.(type) {
+			case *Vxlan:
+				if info.Id != 10 || info.Port != 4789 || !info.Learning {
+					t.Errorf("got %+v", info)
+				}
+			case *Gre:
+				/* path MTU discovery stays on when left unset */
+				if !info.Remote.Equal(net.ParseIP("10.0.0.2")) || info.TTL != 64 || !info.PMtuDisc {
+					t.Errorf("got %+v", info)
+				}
+			case *Iptun:
+				if !info.Remote.Equal(net.ParseIP("10.0.0.3")) || !info.PMtuDisc {
+					t.Errorf("got %+v", info)
+				}
+			case *Geneve:
+				if info.Id != 11 {
+					t.Errorf("got %+v", info)
+				}
+			case *Vrf:
+				if info.Table != 10 {
+					t.Errorf("got %+v", info)
+				}
+			default:
+				t.Errorf("info %T", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package route
+
+import (
+	"github.com/apuigsech/netlink"
+)
+
+// Macvlan covers the macvlan and macvtap kinds. The lower device is given by
+// Link.ParentIndex.
+type Macvlan struct {
+	KindName string
+	Mode     uint32 /* MACVLAN_MODE_* */
+	Flags    uint16 /* MACVLAN_FLAG_* */
+}
+
+// Ipvlan is an ipvlan device. The lower device is given by Link.ParentIndex.
+type Ipvlan struct {
+	Mode  uint16 /* IPVLAN_MODE_* */
+	Flags uint16 /* IPVLAN_F_* */
+}
+
+type Vrf struct {
+	Table uint32
+}
+
+func (info *Macvlan) Kind() string {
+	if info.KindName == "" {
+		return "macvlan"
+	}
+	return info.KindName
+}
+
+func (info *Macvlan) InfoData() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+
+	if info.Mode != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(IFLA_MACVLAN_MODE, info.Mode))
+	}
+	if info.Flags != 0 {
+		attrs = append(attrs, netlink.NewAttrUint16(IFLA_MACVLAN_FLAGS, info.Flags))
+	}
+
+	return attrs
+}
+
+func (info *Macvlan) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_MACVLAN_MODE:
+			info.Mode = attr.Uint32()
+		case IFLA_MACVLAN_FLAGS:
+			info.Flags = attr.Uint16()
+		}
+	}
+	return nil
+}
+
+func (info *Ipvlan) Kind() string {
+	return "ipvlan"
+}
+
+func (info *Ipvlan) InfoData() []netlink.NetlinkAttr {
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrUint16(IFLA_IPVLAN_MODE, info.Mode),
+		netlink.NewAttrUint16(IFLA_IPVLAN_FLAGS, info.Flags),
+	}
+}
+
+func (info *Ipvlan) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case IFLA_IPVLAN_MODE:
+			info.Mode = attr.Uint16()
+		case IFLA_IPVLAN_FLAGS:
+			info.Flags = attr.Uint16()
+		}
+	}
+	return nil
+}
+
+func (info *Vrf) Kind() string {
+	return "vrf"
+}
+
+func (info *Vrf) InfoData() []netlink.NetlinkAttr {
+	return []netlink.NetlinkAttr{
+		netlink.NewAttrUint32(IFLA_VRF_TABLE, info.Table),
+	}
+}
+
+func (info *Vrf) ParseInfoData(attrs []netlink.NetlinkAttr) error {
+	for _, attr := range attrs {
+		if attr.AttrType() == IFLA_VRF_TABLE {
+			info.Table = attr.Uint32()
+		}
+	}
+	return nil
+}
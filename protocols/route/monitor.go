@@ -0,0 +1,284 @@
+package route
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	/* pseudo event types delimiting a full dump */
+	EVENT_DUMP_BEGIN = 0xfffe
+	EVENT_DUMP_END   = 0xffff
+
+	maxDumpRetries = 10
+)
+
+// Event is a decoded rtnetlink notification. Type is the RTM_NEW* or RTM_DEL*
+// message type and exactly one of the object fields is set accordingly.
+// Objects coming from a dump have Dump set. RTM_NEWLINK is sent both for new
+// links and for changes to existing ones.
+type Event struct {
+	Type    uint16
+	Dump    bool
+	Link    *Link
+	Addr    *Address
+	Route   *Route
+	Neigh   *Neigh
+	Rule    *Rule
+	Nexthop *NexthopObject
+}
+
+type EventCallback func(*Event, chan error, ...interface{})
+
+// MonitorOptions selects the objects to monitor. With Dump set the current
+// state is delivered first, between EVENT_DUMP_BEGIN and EVENT_DUMP_END
+// events, and delivered again the same way whenever notifications are lost,
+// so that a consumer can keep an exact mirror by dropping it on
+// EVENT_DUMP_BEGIN and applying every event in order.
+type MonitorOptions struct {
+	Links    bool
+	Addrs    bool
+	Routes   bool
+	Neighs   bool
+	Rules    bool
+	Nexthops bool
+	Dump     bool
+}
+
+type dumpRequest struct {
+	msgtype uint16
+	data    []byte
+}
+
+func (o *MonitorOptions) groups() []uint32 {
+	groups := []uint32{}
+	if o.Links {
+		groups = append(groups, RTNLGRP_LINK)
+	}
+	if o.Addrs {
+		groups = append(groups, RTNLGRP_IPV4_IFADDR, RTNLGRP_IPV6_IFADDR)
+	}
+	if o.Routes {
+		groups = append(groups, RTNLGRP_IPV4_ROUTE, RTNLGRP_IPV6_ROUTE)
+	}
+	if o.Neighs {
+		groups = append(groups, RTNLGRP_NEIGH)
+	}
+	if o.Rules {
+		groups = append(groups, RTNLGRP_IPV4_RULE, RTNLGRP_IPV6_RULE)
+	}
+	if o.Nexthops {
+		groups = append(groups, RTNLGRP_NEXTHOP)
+	}
+	return groups
+}
+
+func (o *MonitorOptions) dumpRequests() []dumpRequest {
+	reqs := []dumpRequest{}
+	if o.Links {
+		reqs = append(reqs, dumpRequest{RTM_GETLINK, (&IfInfomsg{}).toWireFormat()})
+	}
+	if o.Nexthops {
+		/* before routes, which may reference them */
+		reqs = append(reqs, dumpRequest{RTM_GETNEXTHOP, (&NhMsg{}).toWireFormat()})
+	}
+	if o.Addrs {
+		reqs = append(reqs, dumpRequest{RTM_GETADDR, (&IfAddrmsg{}).toWireFormat()})
+	}
+	if o.Routes {
+		reqs = append(reqs, dumpRequest{RTM_GETROUTE, (&RtMsg{}).toWireFormat()})
+	}
+	if o.Neighs {
+		reqs = append(reqs, dumpRequest{RTM_GETNEIGH, (&NdMsg{}).toWireFormat()})
+	}
+	if o.Rules {
+		reqs = append(reqs, dumpRequest{RTM_GETRULE, (&FibRuleHdr{}).toWireFormat()})
+	}
+	return reqs
+}
+
+// EventfromMessage decodes a notification. It returns nil for messages that
+// do not describe a monitored object: unknown types, cached route clones and
+// the AF_BRIDGE port view of links.
+func EventfromMessage(msg *netlink.NetlinkMessage) (*Event, error) {
+	e := &Event{Type: msg.Header.Type}
+
+	var err error
+
+	switch msg.Header.Type {
+	case RTM_NEWLINK, RTM_DELLINK:
+		e.Link, err = LinkfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if e.Link.Family == syscall.AF_BRIDGE {
+			return nil, nil
+		}
+	case RTM_NEWADDR, RTM_DELADDR:
+		e.Addr, err = AddressfromWireFormat(msg.Data)
+	case RTM_NEWROUTE, RTM_DELROUTE:
+		e.Route, err = RoutefromWireFormat(msg.Data)
+		if err == nil && e.Route.Flags&RTM_F_CLONED != 0 {
+			return nil, nil
+		}
+	case RTM_NEWNEIGH, RTM_DELNEIGH:
+		e.Neigh, err = NeighfromWireFormat(msg.Data)
+	case RTM_NEWRULE, RTM_DELRULE:
+		e.Rule, err = RulefromWireFormat(msg.Data)
+	case RTM_NEWNEXTHOP, RTM_DELNEXTHOP:
+		e.Nexthop, err = NexthopObjectfromWireFormat(msg.Data)
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// dump collects a consistent dump of one object type, starting over when
+// the kernel flags it as interrupted by a concurrent change.
+func (rl *RouteNLSocket) dump(req dumpRequest) ([]*Event, error) {
+	for i := 0; i < maxDumpRetries; i++ {
+		msgList, err := rl.Execute(req.msgtype, syscall.NLM_F_DUMP, req.data)
+		if err != nil {
+			return nil, err
+		}
+
+		ret := []*Event{}
+		intr := false
+
+		for j := range msgList {
+			if msgList[j].Header.Flags&netlink.NLM_F_DUMP_INTR != 0 {
+				intr = true
+				break
+			}
+			e, err := EventfromMessage(&msgList[j])
+			if err != nil {
+				return nil, err
+			}
+			if e == nil {
+				continue
+			}
+			e.Dump = true
+			ret = append(ret, e)
+		}
+
+		if !intr {
+			return ret, nil
+		}
+	}
+
+	return nil, errors.New("dump interrupted too many times")
+}
+
+// dumpState dumps the monitored objects through dl, a socket other than the
+// monitor one so that the notifications queued meanwhile on it are kept, and
+// delivers them to cb.
+func dumpState(dl *RouteNLSocket, opts *MonitorOptions, cb EventCallback, ec chan error, args ...interface{}) error {
+	evList := []*Event{}
+	for _, req := range opts.dumpRequests() {
+		evs, err := dl.dump(req)
+		if err != nil {
+			return err
+		}
+		evList = append(evList, evs...)
+	}
+
+	cb(&Event{Type: EVENT_DUMP_BEGIN, Dump: true}, ec, args...)
+	for _, e := range evList {
+		cb(e, ec, args...)
+	}
+	cb(&Event{Type: EVENT_DUMP_END, Dump: true}, ec, args...)
+
+	return nil
+}
+
+// StartMonitor joins the rtnetlink groups selected by opts and calls cb for
+// every change. The groups are joined before the initial dump, so no change
+// is missed in between; a change may be seen both in the dump and as an
+// event, which is harmless when events are applied in order. The socket
+// should not be used for requests once the monitor is running.
+func (rl *RouteNLSocket) StartMonitor(opts *MonitorOptions, cb EventCallback, ec chan error, args ...interface{}) error {
+	return rl.startMonitor(opts, cb, nil, ec, args...)
+}
+
+// startMonitor is StartMonitor calling stop, when not nil, once the monitor
+// is gone.
+func (rl *RouteNLSocket) startMonitor(opts *MonitorOptions, cb EventCallback, stop func(), ec chan error, args ...interface{}) error {
+	for _, group := range opts.groups() {
+		err := rl.AddMembership(group)
+		if err != nil {
+			return err
+		}
+	}
+
+	var dl *RouteNLSocket
+
+	if opts.Dump {
+		/* opened here, as a socket opened later by the goroutine below
+		   would belong to the network namespace of whatever thread it
+		   happens to run on */
+		var err error
+		dl, err = OpenLink(0, 0)
+		if err != nil {
+			return err
+		}
+		err = dumpState(dl, opts, cb, ec, args...)
+		if err != nil {
+			dl.CloseLink()
+			return err
+		}
+	}
+
+	go func() {
+		defer func() {
+			if dl != nil {
+				dl.CloseLink()
+			}
+			if stop != nil {
+				stop()
+			}
+		}()
+
+		for {
+			msgList, err := rl.RecvMessages(netlink.RECV_BUFFER_SIZE, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				if err == syscall.ENOBUFS && opts.Dump {
+					/* notifications were dropped, resynchronise */
+					err = dumpState(dl, opts, cb, ec, args...)
+					if err != nil && ec != nil {
+						ec <- err
+					}
+				}
+				continue
+			}
+
+			for i := range msgList {
+				e, err := EventfromMessage(&msgList[i])
+				if err != nil {
+					if ec != nil {
+						ec <- err
+					}
+					continue
+				}
+				if e == nil {
+					continue
+				}
+				cb(e, ec, args...)
+			}
+		}
+	}()
+
+	return nil
+}
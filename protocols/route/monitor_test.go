@@ -0,0 +1,168 @@
+package route
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/apuigsech/netlink"
+)
+
+func testMessage(msgtype uint16, data []byte) *netlink.NetlinkMessage {
+	msg := &netlink.NetlinkMessage{Data: data}
+	msg.Header.Type = msgtype
+	return msg
+}
+
+func TestEventfromMessage(t *testing.T) {
+	e, err := EventfromMessage(testMessage(RTM_NEWLINK, (&Link{Name: "eth0", Info: &Bridge{}}).toWireFormat()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil || e.Type != RTM_NEWLINK || e.Link == nil || e.Link.Name != "eth0" || e.Dump {
+		t.Errorf("link: got %+v", e)
+	}
+
+	e, err = EventfromMessage(testMessage(RTM_DELADDR, (&Address{Local: net.ParseIP("192.0.2.1"), PrefixLen: 24}).toWireFormat()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e == nil || e.Type != RTM_DELADDR || e.Addr == nil || e.Link != nil {
+		t.Errorf("address: got %+v", e)
+	}
+
+	tests := []struct {
+		msgtype uint16
+		data    []byte
+		check   func(*Event) bool
+	}{
+		{RTM_NEWROUTE, (&Route{Dst: mustCIDR("10.0.0.0/8")}).toWireFormat(), func(e *Event) bool { return e.Route != nil }},
+		{RTM_NEWNEIGH, (&Neigh{IP: net.ParseIP("192.0.2.2")}).toWireFormat(), func(e *Event) bool { return e.Neigh != nil }},
+		{RTM_DELRULE, (&Rule{Priority: 10}).toWireFormat(), func(e *Event) bool { return e.Rule != nil }},
+		{RTM_NEWNEXTHOP, (&NexthopObject{Id: 1, Blackhole: true}).toWireFormat(), func(e *Event) bool { return e.Nexthop != nil }},
+	}
+	for _, test := range tests {
+		e, err := EventfromMessage(testMessage(test.msgtype, test.data))
+		if err != nil {
+			t.Fatalf("type %d: %v", test.msgtype, err)
+		}
+		if e == nil || e.Type != test.msgtype || !test.check(e) {
+			t.Errorf("type %d: got %+v", test.msgtype, e)
+		}
+	}
+}
+
+func TestEventfromMessageIgnored(t *testing.T) {
+	bridgePort := &Link{IfInfomsg: IfInfomsg{Family: syscall.AF_BRIDGE}, Name: "eth0"}
+	cloned := &RtMsg{Family: syscall.AF_INET, Flags: RTM_F_CLONED}
+
+	tests := []*netlink.NetlinkMessage{
+		testMessage(RTM_NEWLINK, bridgePort.toWireFormat()),
+		testMessage(RTM_NEWROUTE, cloned.toWireFormat()),
+		testMessage(RTM_NEWQDISC, (&IfInfomsg{}).toWireFormat()),
+	}
+	for _, msg := range tests {
+		e, err := EventfromMessage(msg)
+		if err != nil || e != nil {
+			t.Errorf("type %d: got %+v %v", msg.Header.Type, e, err)
+		}
+	}
+
+	if _, err := EventfromMessage(testMessage(RTM_NEWADDR, []byte{1})); err == nil {
+		t.Error("short message accepted")
+	}
+}
+
+func TestMonitorOptions(t *testing.T) {
+	opts := &MonitorOptions{Addrs: true, Routes: true, Nexthops: true}
+
+	groups := opts.groups()
+	want := []uint32{RTNLGRP_IPV4_IFADDR, RTNLGRP_IPV6_IFADDR, RTNLGRP_IPV4_ROUTE, RTNLGRP_IPV6_ROUTE, RTNLGRP_NEXTHOP}
+	if len(groups) != len(want) {
+		t.Fatalf("groups %v", groups)
+	}
+	for i := range want {
+		if groups[i] != want[i] {
+			t.Errorf("groups %v, want %v", groups, want)
+			break
+		}
+	}
+
+	/* nexthops are dumped before the routes that reference them */
+	reqs := opts.dumpRequests()
+	if len(reqs) != 3 || reqs[0].msgtype != RTM_GETNEXTHOP || reqs[1].msgtype != RTM_GETADDR || reqs[2].msgtype != RTM_GETROUTE {
+		t.Errorf("dump requests %+v", reqs)
+	}
+}
+
+// nextEvent waits for the next event matching match.
+func nextEvent(t *testing.T, events chan *Event, match func(*Event) bool) *Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-events:
+			if match(e) {
+				return e
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for an event")
+		}
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	rl := testNetns(t)
+
+	ml, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ml.CloseLink()
+
+	events := make(chan *Event, 100)
+	cb := func(e *Event, ec chan error, args ...interface{}) {
+		events <- e
+	}
+	err = ml.StartMonitor(&MonitorOptions{Links: true, Addrs: true, Dump: true}, cb, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* the dump is delivered before StartMonitor returns */
+	if e := <-events; e.Type != EVENT_DUMP_BEGIN || !e.Dump {
+		t.Fatalf("first event %+v", e)
+	}
+	if e := <-events; e.Link == nil || e.Link.Name != "lo" || !e.Dump {
+		t.Errorf("dumped %+v", e)
+	}
+	if e := <-events; e.Type != EVENT_DUMP_END {
+		t.Errorf("dump not ended: %+v", e)
+	}
+
+	err = rl.AddLink(&Link{Name: "br0", Info: &Bridge{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := nextEvent(t, events, func(e *Event) bool { return e.Link != nil && e.Link.Name == "br0" })
+	if e.Type != RTM_NEWLINK || e.Dump {
+		t.Errorf("br0 added: %+v", e)
+	}
+	br := e.Link
+
+	err = rl.AddAddr(&Address{Index: br.Index, Local: net.ParseIP("192.0.2.1"), PrefixLen: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e = nextEvent(t, events, func(e *Event) bool { return e.Addr != nil && e.Addr.Family == syscall.AF_INET })
+	if e.Type != RTM_NEWADDR || e.Addr.Index != br.Index || !e.Addr.Local.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("address added: %+v", e)
+	}
+
+	err = rl.DelLink(br.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, events, func(e *Event) bool { return e.Type == RTM_DELLINK && e.Link.Index == br.Index })
+}
@@ -0,0 +1,311 @@
+package route
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofNdMsg        = 12
+	SizeofNdaCacheinfo = 16
+)
+
+type NdMsg struct {
+	Family uint8
+	Index  int32
+	State  uint16 /* NUD_* */
+	Flags  uint8  /* NTF_* */
+	Type   uint8  /* RTN_* */
+}
+
+type NdaCacheinfo struct {
+	Confirmed uint32
+	Used      uint32
+	Updated   uint32
+	Refcnt    uint32
+}
+
+// Neigh is an ARP/NDP neighbour entry or, when Family is AF_BRIDGE, a bridge
+// forwarding database entry. For vxlan FDB entries IP holds the remote VTEP.
+type Neigh struct {
+	Family       uint8
+	Index        int32
+	State        uint16
+	Flags        uint8
+	Type         uint8
+	IP           net.IP
+	HardwareAddr net.HardwareAddr
+	Vlan         uint16
+	Port         uint16
+	Vni          uint32
+	LinkIndex    int32 /* NDA_IFINDEX, vxlan remote device */
+	MasterIndex  int32
+	Probes       uint32
+	Cacheinfo    *NdaCacheinfo
+	Attrs        []netlink.NetlinkAttr
+}
+
+func NdMsgfromWireFormat(data []byte) *NdMsg {
+	return &NdMsg{
+		Family: data[0],
+		Index:  *(*int32)(unsafe.Pointer(&data[4:8][0])),
+		State:  *(*uint16)(unsafe.Pointer(&data[8:10][0])),
+		Flags:  data[10],
+		Type:   data[11],
+	}
+}
+
+func (ndm *NdMsg) toWireFormat() []byte {
+	b := make([]byte, SizeofNdMsg)
+	b[0] = ndm.Family
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = ndm.Index
+	*(*uint16)(unsafe.Pointer(&b[8:10][0])) = ndm.State
+	b[10] = ndm.Flags
+	b[11] = ndm.Type
+	return b
+}
+
+func NdaCacheinfofromWireFormat(data []byte) *NdaCacheinfo {
+	return &NdaCacheinfo{
+		Confirmed: *(*uint32)(unsafe.Pointer(&data[0:4][0])),
+		Used:      *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		Updated:   *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+		Refcnt:    *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+	}
+}
+
+func NeighfromWireFormat(data []byte) (*Neigh, error) {
+	if len(data) < SizeofNdMsg {
+		return nil, errors.New("short ndmsg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofNdMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	ndm := NdMsgfromWireFormat(data)
+	n := &Neigh{
+		Family: ndm.Family,
+		Index:  ndm.Index,
+		State:  ndm.State,
+		Flags:  ndm.Flags,
+		Type:   ndm.Type,
+		Attrs:  attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NDA_DST:
+			n.IP = net.IP(attr.Data)
+		case NDA_LLADDR:
+			n.HardwareAddr = net.HardwareAddr(attr.Data)
+		case NDA_VLAN:
+			n.Vlan = attr.Uint16()
+		case NDA_PORT:
+			n.Port = attr.NetUint16()
+		case NDA_VNI:
+			n.Vni = attr.Uint32()
+		case NDA_IFINDEX:
+			n.LinkIndex = int32(attr.Uint32())
+		case NDA_MASTER:
+			n.MasterIndex = int32(attr.Uint32())
+		case NDA_PROBES:
+			n.Probes = attr.Uint32()
+		case NDA_CACHEINFO:
+			if len(attr.Data) >= SizeofNdaCacheinfo {
+				n.Cacheinfo = NdaCacheinfofromWireFormat(attr.Data)
+			}
+		}
+	}
+
+	return n, nil
+}
+
+func (n *Neigh) family() uint8 {
+	if n.Family != syscall.AF_UNSPEC {
+		return n.Family
+	}
+	if n.IP == nil {
+		return syscall.AF_BRIDGE
+	}
+	f, _ := ipFamily(n.IP)
+	return f
+}
+
+func (n *Neigh) toWireFormat() []byte {
+	ndm := &NdMsg{
+		Family: n.family(),
+		Index:  n.Index,
+		State:  n.State,
+		Flags:  n.Flags,
+		Type:   n.Type,
+	}
+
+	attrs := []netlink.NetlinkAttr{}
+
+	if n.IP != nil {
+		_, ip := ipFamily(n.IP)
+		attrs = append(attrs, netlink.NewAttr(NDA_DST, ip))
+	}
+	if len(n.HardwareAddr) != 0 {
+		attrs = append(attrs, netlink.NewAttr(NDA_LLADDR, n.HardwareAddr))
+	}
+	if n.Vlan != 0 {
+		attrs = append(attrs, netlink.NewAttrUint16(NDA_VLAN, n.Vlan))
+	}
+	if n.Port != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(NDA_PORT, n.Port))
+	}
+	if n.Vni != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NDA_VNI, n.Vni))
+	}
+	if n.LinkIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NDA_IFINDEX, uint32(n.LinkIndex)))
+	}
+	if n.MasterIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NDA_MASTER, uint32(n.MasterIndex)))
+	}
+
+	return append(ndm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+}
+
+func (rl *RouteNLSocket) listNeighs(ndm *NdMsg, attrs []netlink.NetlinkAttr) ([]*Neigh, error) {
+	data := append(ndm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+
+	msgList, err := rl.dumpStrict(RTM_GETNEIGH, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Neigh{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWNEIGH {
+			continue
+		}
+		n, err := NeighfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if ndm.Family != syscall.AF_UNSPEC && n.Family != ndm.Family {
+			continue
+		}
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// ListNeighs dumps the neighbour tables of the given family (AF_UNSPEC for
+// all) on the given interface (0 for all).
+func (rl *RouteNLSocket) ListNeighs(family uint8, index int32) ([]*Neigh, error) {
+	attrs := []netlink.NetlinkAttr{}
+	if index != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NDA_IFINDEX, uint32(index)))
+	}
+
+	neighs, err := rl.listNeighs(&NdMsg{Family: family}, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Neigh{}
+	for _, n := range neighs {
+		if index != 0 && n.Index != index {
+			continue
+		}
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+// ListProxyNeighs dumps the proxy ARP/NDP entries of the given family.
+func (rl *RouteNLSocket) ListProxyNeighs(family uint8) ([]*Neigh, error) {
+	neighs, err := rl.listNeighs(&NdMsg{Family: family, Flags: NTF_PROXY}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Neigh{}
+	for _, n := range neighs {
+		if n.Flags&NTF_PROXY != 0 {
+			ret = append(ret, n)
+		}
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddNeigh(n *Neigh) error {
+	_, err := rl.Execute(RTM_NEWNEIGH, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, n.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) ReplaceNeigh(n *Neigh) error {
+	_, err := rl.Execute(RTM_NEWNEIGH, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, n.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) DelNeigh(n *Neigh) error {
+	_, err := rl.Execute(RTM_DELNEIGH, 0, n.toWireFormat())
+	return err
+}
+
+// ListFdb dumps the bridge forwarding database. A non zero master restricts
+// the dump to the ports of that bridge and a non zero index to a single port.
+func (rl *RouteNLSocket) ListFdb(master, index int32) ([]*Neigh, error) {
+	attrs := []netlink.NetlinkAttr{}
+	if master != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NDA_MASTER, uint32(master)))
+	}
+	if index != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NDA_IFINDEX, uint32(index)))
+	}
+
+	neighs, err := rl.listNeighs(&NdMsg{Family: syscall.AF_BRIDGE}, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Neigh{}
+	for _, n := range neighs {
+		if index != 0 && n.Index != index {
+			continue
+		}
+		if master != 0 && n.MasterIndex != master && n.Index != master {
+			continue
+		}
+		ret = append(ret, n)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddFdb(n *Neigh) error {
+	n.Family = syscall.AF_BRIDGE
+	return rl.AddNeigh(n)
+}
+
+func (rl *RouteNLSocket) ReplaceFdb(n *Neigh) error {
+	n.Family = syscall.AF_BRIDGE
+	return rl.ReplaceNeigh(n)
+}
+
+// AppendFdb adds another remote destination to a vxlan FDB entry, as used
+// for head end replication of the all zeros address.
+func (rl *RouteNLSocket) AppendFdb(n *Neigh) error {
+	n.Family = syscall.AF_BRIDGE
+	_, err := rl.Execute(RTM_NEWNEIGH, syscall.NLM_F_CREATE|syscall.NLM_F_APPEND, n.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) DelFdb(n *Neigh) error {
+	n.Family = syscall.AF_BRIDGE
+	return rl.DelNeigh(n)
+}
@@ -0,0 +1,263 @@
+package route
+
+import (
+	"bytes"
+	"net"
+	"syscall"
+	"testing"
+)
+
+func TestNdMsgWireFormat(t *testing.T) {
+	ndm := &NdMsg{Family: syscall.AF_BRIDGE, Index: 5, State: NUD_PERMANENT, Flags: NTF_MASTER, Type: RTN_UNICAST}
+
+	b := ndm.toWireFormat()
+	if len(b) != SizeofNdMsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := NdMsgfromWireFormat(b); *got != *ndm {
+		t.Errorf("got %+v, want %+v", got, ndm)
+	}
+}
+
+func TestNeighWireFormat(t *testing.T) {
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	n := &Neigh{
+		Index:        2,
+		State:        NUD_REACHABLE,
+		IP:           net.ParseIP("192.0.2.2"),
+		HardwareAddr: mac,
+	}
+
+	b := n.toWireFormat()
+	if ndm := NdMsgfromWireFormat(b); ndm.Family != syscall.AF_INET {
+		t.Errorf("family %d", ndm.Family)
+	}
+
+	got, err := NeighfromWireFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 2 || got.State != NUD_REACHABLE || !got.IP.Equal(n.IP) || len(got.IP) != 4 ||
+		!bytes.Equal(got.HardwareAddr, mac) {
+		t.Errorf("got %+v", got)
+	}
+
+	if _, err := NeighfromWireFormat(make([]byte, SizeofNdMsg-1)); err == nil {
+		t.Error("short ndmsg accepted")
+	}
+}
+
+func TestFdbWireFormat(t *testing.T) {
+	mac, _ := net.ParseMAC("00:00:00:00:00:00")
+	n := &Neigh{
+		Index:        4,
+		State:        NUD_PERMANENT,
+		Flags:        NTF_SELF,
+		HardwareAddr: mac,
+		IP:           net.ParseIP("2001:db8::1"),
+		Family:       syscall.AF_BRIDGE,
+		Vlan:         10,
+		Port:         4789,
+		Vni:          100,
+		LinkIndex:    3,
+		MasterIndex:  6,
+	}
+
+	b := n.toWireFormat()
+	got, err := NeighfromWireFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Family != syscall.AF_BRIDGE || got.Flags != NTF_SELF || !got.IP.Equal(n.IP) || got.Vlan != 10 ||
+		got.Port != 4789 || got.Vni != 100 || got.LinkIndex != 3 || got.MasterIndex != 6 {
+		t.Errorf("got %+v", got)
+	}
+
+	/* the port is in network byte order */
+	attr, _ := findAttr(got.Attrs, NDA_PORT)
+	if attr.Data[0] != 4789>>8 || attr.Data[1] != 4789&0xff {
+		t.Errorf("port % x", attr.Data)
+	}
+
+	/* without an IP an entry belongs to the bridge FDB */
+	if f := (&Neigh{HardwareAddr: mac}).family(); f != syscall.AF_BRIDGE {
+		t.Errorf("family %d", f)
+	}
+}
+
+func TestNeighs(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	veth := mustLink(t, rl, "veth0")
+	peer := mustLink(t, rl, "veth1")
+
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	neighs := []*Neigh{
+		{Index: veth.Index, State: NUD_PERMANENT, IP: net.ParseIP("192.0.2.2"), HardwareAddr: mac},
+		{Index: veth.Index, State: NUD_PERMANENT, IP: net.ParseIP("2001:db8::2"), HardwareAddr: mac},
+		{Index: peer.Index, State: NUD_PERMANENT, IP: net.ParseIP("192.0.2.3"), HardwareAddr: mac},
+	}
+	for _, n := range neighs {
+		err := rl.AddNeigh(n)
+		if err != nil {
+			t.Fatalf("%s: %v", n.IP, err)
+		}
+	}
+
+	err = rl.AddNeigh(neighs[0])
+	if err != syscall.EEXIST {
+		t.Errorf("adding %s again: %v", neighs[0].IP, err)
+	}
+
+	got, err := rl.ListNeighs(syscall.AF_INET, veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].IP.Equal(neighs[0].IP) || !bytes.Equal(got[0].HardwareAddr, mac) ||
+		got[0].State != NUD_PERMANENT || got[0].Cacheinfo == nil {
+		t.Errorf("IPv4 neighbours of veth0: %+v", got)
+	}
+
+	got, err = rl.ListNeighs(syscall.AF_UNSPEC, veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 {
+		t.Errorf("neighbours of veth0: %+v", got)
+	}
+
+	mac2, _ := net.ParseMAC("02:00:00:00:00:02")
+	err = rl.ReplaceNeigh(&Neigh{Index: veth.Index, State: NUD_PERMANENT, IP: neighs[0].IP, HardwareAddr: mac2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = rl.ListNeighs(syscall.AF_INET, veth.Index)
+	if len(got) != 1 || !bytes.Equal(got[0].HardwareAddr, mac2) {
+		t.Errorf("replaced neighbour: %+v", got)
+	}
+
+	err = rl.AddNeigh(&Neigh{Index: veth.Index, Flags: NTF_PROXY, IP: net.ParseIP("192.0.2.100")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = rl.ListProxyNeighs(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || !got[0].IP.Equal(net.ParseIP("192.0.2.100")) || got[0].Index != veth.Index {
+		t.Errorf("proxy neighbours: %+v", got)
+	}
+
+	err = rl.DelNeigh(neighs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = rl.ListNeighs(syscall.AF_INET, veth.Index)
+	if len(got) != 0 {
+		t.Errorf("deleted neighbour still listed: %+v", got)
+	}
+	err = rl.DelNeigh(neighs[0])
+	if err != syscall.ENOENT {
+		t.Errorf("deleting %s again: %v", neighs[0].IP, err)
+	}
+
+	/* the dumps leave strict checking as it was */
+	strict, err := rl.StrictCheck()
+	if err == nil && strict {
+		t.Error("strict checking left on")
+	}
+}
+
+func TestFdb(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddLink(&Link{Name: "br0", Info: &Bridge{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	veth := mustLink(t, rl, "veth0")
+	br := mustLink(t, rl, "br0")
+	err = rl.SetLinkMaster(veth.Index, br.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mac, _ := net.ParseMAC("02:00:00:00:00:01")
+	fdb := &Neigh{Index: veth.Index, State: NUD_PERMANENT, Flags: NTF_MASTER, HardwareAddr: mac}
+	err = rl.AddFdb(fdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rl.ListFdb(br.Index, veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, n := range got {
+		if n.Index != veth.Index || n.Family != syscall.AF_BRIDGE {
+			t.Errorf("unexpected entry %+v", n)
+		}
+		if bytes.Equal(n.HardwareAddr, mac) {
+			found = n.MasterIndex == br.Index && n.State&NUD_PERMANENT != 0
+		}
+	}
+	if !found {
+		t.Errorf("FDB of veth0: %+v", got)
+	}
+
+	err = rl.DelFdb(fdb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = rl.ListFdb(br.Index, veth.Index)
+	for _, n := range got {
+		if bytes.Equal(n.HardwareAddr, mac) {
+			t.Errorf("deleted entry still listed: %+v", n)
+		}
+	}
+}
+
+func TestVxlanFdb(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "vx0", Info: &Vxlan{Id: 10, Port: 4789}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vx := mustLink(t, rl, "vx0")
+
+	/* head end replication to two VTEPs */
+	zero, _ := net.ParseMAC("00:00:00:00:00:00")
+	for _, vtep := range []string{"10.0.0.1", "10.0.0.2"} {
+		err := rl.AppendFdb(&Neigh{Index: vx.Index, State: NUD_PERMANENT, Flags: NTF_SELF, HardwareAddr: zero, IP: net.ParseIP(vtep)})
+		if err != nil {
+			t.Fatalf("%s: %v", vtep, err)
+		}
+	}
+
+	got, err := rl.ListFdb(0, vx.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vteps := map[string]bool{}
+	for _, n := range got {
+		if bytes.Equal(n.HardwareAddr, zero) && n.IP != nil {
+			vteps[n.IP.String()] = true
+		}
+	}
+	if !vteps["10.0.0.1"] || !vteps["10.0.0.2"] {
+		t.Errorf("FDB of vx0: %+v", got)
+	}
+}
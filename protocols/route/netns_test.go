@@ -0,0 +1,50 @@
+package route
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+)
+
+// testNetns moves the test to a network namespace of its own and returns a
+// socket in it. The namespace lives on the thread of the test, which is left
+// locked so that the runtime throws it away when the test ends. Tests are
+// skipped when namespaces can not be created, such as when unprivileged.
+func testNetns(t *testing.T) *RouteNLSocket {
+	t.Helper()
+	runtime.LockOSThread()
+
+	err := syscall.Unshare(syscall.CLONE_NEWNET)
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+
+	rl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rl.CloseLink()
+	})
+
+	return rl
+}
+
+// skipUnsupported skips the test when the kernel lacks what err says it
+// does, such as a link kind built as a module that is not available.
+func skipUnsupported(t *testing.T, err error) {
+	t.Helper()
+	if err == syscall.EOPNOTSUPP || err == syscall.EAFNOSUPPORT || err == syscall.EPROTONOSUPPORT {
+		t.Skipf("unsupported by the kernel: %v", err)
+	}
+}
+
+func mustLink(t *testing.T, rl *RouteNLSocket, name string) *Link {
+	t.Helper()
+	l, err := rl.GetLinkByName(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return l
+}
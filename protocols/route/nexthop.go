@@ -0,0 +1,419 @@
+package route
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofNhMsg      = 8
+	SizeofNexthopGrp = 8
+)
+
+type NhMsg struct {
+	Family   uint8
+	Scope    uint8
+	Protocol uint8  /* RTPROT_* */
+	Flags    uint32 /* RTNH_F_* */
+}
+
+type NexthopGroupMember struct {
+	Id     uint32
+	Weight uint16 /* 1 to 256, 0 means 1 */
+}
+
+// NexthopResGroup holds the parameters of a resilient group. Timers are in
+// clock ticks (USER_HZ). UnbalancedTime is only reported by the kernel.
+type NexthopResGroup struct {
+	Buckets         uint16
+	IdleTimer       uint32
+	UnbalancedTimer uint32
+	UnbalancedTime  uint64
+}
+
+// NexthopObject is a standalone nexthop that routes reference through
+// Route.NhId. It is either a single nexthop (a device, a gateway, both or a
+// blackhole) or, when Group is set, a group of other nexthop objects.
+type NexthopObject struct {
+	Id        uint32
+	Family    uint8
+	Protocol  uint8
+	Flags     uint32
+	Gateway   net.IP
+	OutIndex  int32
+	Blackhole bool
+	Fdb       bool
+	Group     []NexthopGroupMember
+	GroupType uint16 /* NEXTHOP_GRP_TYPE_* */
+	Resilient *NexthopResGroup
+	Attrs     []netlink.NetlinkAttr
+}
+
+// NexthopBucket is a bucket of a resilient group and the nexthop it
+// currently points to. IdleTime is in clock ticks.
+type NexthopBucket struct {
+	GroupId  uint32
+	Index    uint16
+	IdleTime uint64
+	NhId     uint32
+}
+
+// NexthopFilter restricts a nexthop dump. Zero values match everything.
+type NexthopFilter struct {
+	Family     uint8
+	OutIndex   int32
+	Master     int32
+	GroupsOnly bool
+	FdbOnly    bool
+}
+
+func NhMsgfromWireFormat(data []byte) *NhMsg {
+	return &NhMsg{
+		Family:   data[0],
+		Scope:    data[1],
+		Protocol: data[2],
+		Flags:    *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+	}
+}
+
+func (nhm *NhMsg) toWireFormat() []byte {
+	b := make([]byte, SizeofNhMsg)
+	b[0] = nhm.Family
+	b[1] = nhm.Scope
+	b[2] = nhm.Protocol
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = nhm.Flags
+	return b
+}
+
+func parseNexthopGroup(data []byte) []NexthopGroupMember {
+	ret := []NexthopGroupMember{}
+	for len(data) >= SizeofNexthopGrp {
+		ret = append(ret, NexthopGroupMember{
+			Id:     *(*uint32)(unsafe.Pointer(&data[0:4][0])),
+			Weight: (uint16(data[5])<<8 | uint16(data[4])) + 1,
+		})
+		data = data[SizeofNexthopGrp:]
+	}
+	return ret
+}
+
+func nexthopGroupToWireFormat(group []NexthopGroupMember) []byte {
+	b := make([]byte, 0, len(group)*SizeofNexthopGrp)
+	for _, m := range group {
+		e := make([]byte, SizeofNexthopGrp)
+		*(*uint32)(unsafe.Pointer(&e[0:4][0])) = m.Id
+		if m.Weight > 1 {
+			/* the kernel stores weight - 1 */
+			e[4] = uint8(m.Weight - 1)
+			e[5] = uint8((m.Weight - 1) >> 8)
+		}
+		b = append(b, e...)
+	}
+	return b
+}
+
+func NexthopResGroupfromAttrs(attrs []netlink.NetlinkAttr) *NexthopResGroup {
+	g := &NexthopResGroup{}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NHA_RES_GROUP_BUCKETS:
+			g.Buckets = attr.Uint16()
+		case NHA_RES_GROUP_IDLE_TIMER:
+			g.IdleTimer = attr.Uint32()
+		case NHA_RES_GROUP_UNBALANCED_TIMER:
+			g.UnbalancedTimer = attr.Uint32()
+		case NHA_RES_GROUP_UNBALANCED_TIME:
+			g.UnbalancedTime = attr.Uint64()
+		}
+	}
+	return g
+}
+
+func (g *NexthopResGroup) toAttrs() []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{}
+	if g.Buckets != 0 {
+		attrs = append(attrs, netlink.NewAttrUint16(NHA_RES_GROUP_BUCKETS, g.Buckets))
+	}
+	if g.IdleTimer != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NHA_RES_GROUP_IDLE_TIMER, g.IdleTimer))
+	}
+	if g.UnbalancedTimer != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NHA_RES_GROUP_UNBALANCED_TIMER, g.UnbalancedTimer))
+	}
+	return attrs
+}
+
+func NexthopObjectfromWireFormat(data []byte) (*NexthopObject, error) {
+	if len(data) < SizeofNhMsg {
+		return nil, errors.New("short nhmsg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofNhMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	nhm := NhMsgfromWireFormat(data)
+	nh := &NexthopObject{
+		Family:   nhm.Family,
+		Protocol: nhm.Protocol,
+		Flags:    nhm.Flags,
+		Attrs:    attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NHA_ID:
+			nh.Id = attr.Uint32()
+		case NHA_GROUP:
+			nh.Group = parseNexthopGroup(attr.Data)
+		case NHA_GROUP_TYPE:
+			nh.GroupType = attr.Uint16()
+		case NHA_BLACKHOLE:
+			nh.Blackhole = true
+		case NHA_OIF:
+			nh.OutIndex = int32(attr.Uint32())
+		case NHA_GATEWAY:
+			nh.Gateway = net.IP(attr.Data)
+		case NHA_FDB:
+			nh.Fdb = true
+		case NHA_RES_GROUP:
+			nested, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			nh.Resilient = NexthopResGroupfromAttrs(nested)
+		}
+	}
+
+	return nh, nil
+}
+
+func (nh *NexthopObject) family() uint8 {
+	if nh.Family != syscall.AF_UNSPEC {
+		return nh.Family
+	}
+	if nh.Gateway != nil {
+		f, _ := ipFamily(nh.Gateway)
+		return f
+	}
+	if len(nh.Group) != 0 {
+		/* the kernel only accepts AF_UNSPEC for groups */
+		return syscall.AF_UNSPEC
+	}
+	return syscall.AF_INET
+}
+
+func (nh *NexthopObject) toWireFormat() []byte {
+	nhm := &NhMsg{
+		Family:   nh.family(),
+		Protocol: nh.Protocol,
+		Flags:    nh.Flags,
+	}
+
+	attrs := []netlink.NetlinkAttr{}
+
+	if nh.Id != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NHA_ID, nh.Id))
+	}
+	if len(nh.Group) != 0 {
+		attrs = append(attrs, netlink.NewAttr(NHA_GROUP, nexthopGroupToWireFormat(nh.Group)))
+		groupType := nh.GroupType
+		if nh.Resilient != nil {
+			groupType = NEXTHOP_GRP_TYPE_RES
+		}
+		attrs = append(attrs, netlink.NewAttrUint16(NHA_GROUP_TYPE, groupType))
+		if nh.Resilient != nil {
+			attrs = append(attrs, netlink.NewAttrNested(NHA_RES_GROUP, nh.Resilient.toAttrs()))
+		}
+	}
+	if nh.Blackhole {
+		attrs = append(attrs, netlink.NewAttrFlag(NHA_BLACKHOLE))
+	}
+	if nh.OutIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NHA_OIF, uint32(nh.OutIndex)))
+	}
+	if nh.Gateway != nil {
+		attrs = append(attrs, netlink.NewAttr(NHA_GATEWAY, ipBytes(nhm.Family, nh.Gateway)))
+	}
+	if nh.Fdb {
+		attrs = append(attrs, netlink.NewAttrFlag(NHA_FDB))
+	}
+
+	return append(nhm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+}
+
+func NexthopBucketfromWireFormat(data []byte) (*NexthopBucket, error) {
+	if len(data) < SizeofNhMsg {
+		return nil, errors.New("short nhmsg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofNhMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	b := &NexthopBucket{}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NHA_ID:
+			b.GroupId = attr.Uint32()
+		case NHA_RES_BUCKET:
+			nested, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			for _, battr := range nested {
+				switch battr.AttrType() {
+				case NHA_RES_BUCKET_INDEX:
+					b.Index = battr.Uint16()
+				case NHA_RES_BUCKET_IDLE_TIME:
+					b.IdleTime = battr.Uint64()
+				case NHA_RES_BUCKET_NH_ID:
+					b.NhId = battr.Uint32()
+				}
+			}
+		}
+	}
+
+	return b, nil
+}
+
+// ListNexthops dumps the nexthop objects matching filter, which may be nil.
+// Filtering on the master device is left to the kernel.
+func (rl *RouteNLSocket) ListNexthops(filter *NexthopFilter) ([]*NexthopObject, error) {
+	if filter == nil {
+		filter = &NexthopFilter{}
+	}
+
+	attrs := []netlink.NetlinkAttr{}
+	if filter.OutIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NHA_OIF, uint32(filter.OutIndex)))
+	}
+	if filter.Master != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NHA_MASTER, uint32(filter.Master)))
+	}
+	if filter.GroupsOnly {
+		attrs = append(attrs, netlink.NewAttrFlag(NHA_GROUPS))
+	}
+	if filter.FdbOnly {
+		attrs = append(attrs, netlink.NewAttrFlag(NHA_FDB))
+	}
+
+	nhm := &NhMsg{Family: filter.Family}
+	data := append(nhm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+
+	msgList, err := rl.Execute(RTM_GETNEXTHOP, syscall.NLM_F_DUMP, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*NexthopObject{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWNEXTHOP {
+			continue
+		}
+		nh, err := NexthopObjectfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if filter.Family != syscall.AF_UNSPEC && nh.Family != filter.Family {
+			continue
+		}
+		if filter.OutIndex != 0 && nh.OutIndex != filter.OutIndex {
+			continue
+		}
+		if filter.GroupsOnly && len(nh.Group) == 0 {
+			continue
+		}
+		if filter.FdbOnly && !nh.Fdb {
+			continue
+		}
+		ret = append(ret, nh)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) GetNexthop(id uint32) (*NexthopObject, error) {
+	nhm := &NhMsg{}
+	data := append(nhm.toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttrUint32(NHA_ID, id),
+	})...)
+
+	msgList, err := rl.Execute(RTM_GETNEXTHOP, 0, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgList {
+		if msg.Header.Type == RTM_NEWNEXTHOP {
+			return NexthopObjectfromWireFormat(msg.Data)
+		}
+	}
+
+	return nil, syscall.ENOENT
+}
+
+func (rl *RouteNLSocket) AddNexthop(nh *NexthopObject) error {
+	_, err := rl.Execute(RTM_NEWNEXTHOP, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, nh.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) ReplaceNexthop(nh *NexthopObject) error {
+	_, err := rl.Execute(RTM_NEWNEXTHOP, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, nh.toWireFormat())
+	return err
+}
+
+// DelNexthop deletes a nexthop object. Routes using it are removed by the
+// kernel and groups referencing it drop it.
+func (rl *RouteNLSocket) DelNexthop(id uint32) error {
+	nhm := &NhMsg{}
+	data := append(nhm.toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttrUint32(NHA_ID, id),
+	})...)
+
+	_, err := rl.Execute(RTM_DELNEXTHOP, 0, data)
+	return err
+}
+
+// ListNexthopBuckets dumps the buckets of the resilient group id, or of all
+// resilient groups when id is 0.
+func (rl *RouteNLSocket) ListNexthopBuckets(id uint32) ([]*NexthopBucket, error) {
+	attrs := []netlink.NetlinkAttr{}
+	if id != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(NHA_ID, id))
+	}
+
+	nhm := &NhMsg{}
+	data := append(nhm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+
+	msgList, err := rl.Execute(RTM_GETNEXTHOPBUCKET, syscall.NLM_F_DUMP, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*NexthopBucket{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWNEXTHOPBUCKET {
+			continue
+		}
+		b, err := NexthopBucketfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if id != 0 && b.GroupId != id {
+			continue
+		}
+		ret = append(ret, b)
+	}
+
+	return ret, nil
+}
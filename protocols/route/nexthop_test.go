@@ -0,0 +1,236 @@
+package route
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestNhMsgWireFormat(t *testing.T) {
+	nhm := &NhMsg{Family: syscall.AF_INET6, Scope: RT_SCOPE_LINK, Protocol: RTPROT_STATIC, Flags: RTNH_F_ONLINK}
+
+	b := nhm.toWireFormat()
+	if len(b) != SizeofNhMsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := NhMsgfromWireFormat(b); *got != *nhm {
+		t.Errorf("got %+v, want %+v", got, nhm)
+	}
+}
+
+func TestNexthopObjectWireFormat(t *testing.T) {
+	nh := &NexthopObject{Id: 1, Protocol: RTPROT_STATIC, Gateway: net.ParseIP("192.0.2.254"), OutIndex: 2, Fdb: true}
+
+	b := nh.toWireFormat()
+	if nhm := NhMsgfromWireFormat(b); nhm.Family != syscall.AF_INET {
+		t.Errorf("family %d", nhm.Family)
+	}
+
+	got, err := NexthopObjectfromWireFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Id != 1 || got.Protocol != RTPROT_STATIC || !got.Gateway.Equal(nh.Gateway) || len(got.Gateway) != 4 ||
+		got.OutIndex != 2 || !got.Fdb || got.Blackhole || got.Group != nil {
+		t.Errorf("got %+v", got)
+	}
+
+	got, _ = NexthopObjectfromWireFormat((&NexthopObject{Id: 2, Blackhole: true}).toWireFormat())
+	if !got.Blackhole || got.Family != syscall.AF_INET {
+		t.Errorf("blackhole: got %+v", got)
+	}
+
+	if _, err := NexthopObjectfromWireFormat(make([]byte, SizeofNhMsg-1)); err == nil {
+		t.Error("short nhmsg accepted")
+	}
+}
+
+func TestNexthopGroupWireFormat(t *testing.T) {
+	nh := &NexthopObject{
+		Id:        10,
+		Group:     []NexthopGroupMember{{Id: 1}, {Id: 2, Weight: 256}},
+		Resilient: &NexthopResGroup{Buckets: 32, IdleTimer: 100},
+	}
+
+	b := nh.toWireFormat()
+	if nhm := NhMsgfromWireFormat(b); nhm.Family != syscall.AF_UNSPEC {
+		t.Errorf("group sent with family %d", nhm.Family)
+	}
+
+	got, err := NexthopObjectfromWireFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Group) != 2 || got.Group[0] != (NexthopGroupMember{Id: 1, Weight: 1}) ||
+		got.Group[1] != (NexthopGroupMember{Id: 2, Weight: 256}) {
+		t.Errorf("group %+v", got.Group)
+	}
+	/* a resilient group implies its group type */
+	if got.GroupType != NEXTHOP_GRP_TYPE_RES || got.Resilient == nil || got.Resilient.Buckets != 32 ||
+		got.Resilient.IdleTimer != 100 {
+		t.Errorf("got %+v %+v", got, got.Resilient)
+	}
+
+	/* the kernel stores the weight minus one */
+	e := nexthopGroupToWireFormat([]NexthopGroupMember{{Id: 3, Weight: 0x102}})
+	if len(e) != SizeofNexthopGrp || e[4] != 0x01 || e[5] != 0x01 {
+		t.Errorf("nexthop_grp % x", e)
+	}
+}
+
+func TestNexthopBucketfromWireFormat(t *testing.T) {
+	data := append((&NhMsg{}).toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttrUint32(NHA_ID, 10),
+		netlink.NewAttrNested(NHA_RES_BUCKET, []netlink.NetlinkAttr{
+			netlink.NewAttrUint16(NHA_RES_BUCKET_INDEX, 7),
+			netlink.NewAttrUint64(NHA_RES_BUCKET_IDLE_TIME, 1234),
+			netlink.NewAttrUint32(NHA_RES_BUCKET_NH_ID, 2),
+		}),
+	})...)
+
+	b, err := NexthopBucketfromWireFormat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *b != (NexthopBucket{GroupId: 10, Index: 7, IdleTime: 1234, NhId: 2}) {
+		t.Errorf("got %+v", b)
+	}
+}
+
+func TestNexthops(t *testing.T) {
+	rl := testNetns(t)
+	veth := testRoutedLink(t, rl)
+
+	_, err := rl.ListNexthops(nil)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* blackhole nexthops sit on the loopback device */
+	lo := mustLink(t, rl, "lo")
+	err = rl.SetLinkUp(lo.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nhs := []*NexthopObject{
+		{Id: 1, Gateway: net.ParseIP("192.0.2.10"), OutIndex: veth.Index},
+		{Id: 2, Gateway: net.ParseIP("192.0.2.11"), OutIndex: veth.Index},
+		{Id: 3, Blackhole: true},
+		{Id: 10, Group: []NexthopGroupMember{{Id: 1}, {Id: 2, Weight: 3}}},
+	}
+	for _, nh := range nhs {
+		err := rl.AddNexthop(nh)
+		if err != nil {
+			t.Fatalf("nexthop %d: %v", nh.Id, err)
+		}
+	}
+
+	err = rl.AddNexthop(nhs[0])
+	if err != syscall.EEXIST {
+		t.Errorf("adding nexthop 1 again: %v", err)
+	}
+
+	got, err := rl.GetNexthop(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Gateway.Equal(nhs[0].Gateway) || got.OutIndex != veth.Index {
+		t.Errorf("nexthop 1: %+v", got)
+	}
+	_, err = rl.GetNexthop(99)
+	if err != syscall.ENOENT {
+		t.Errorf("missing nexthop: %v", err)
+	}
+
+	list, err := rl.ListNexthops(&NexthopFilter{GroupsOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Id != 10 || len(list[0].Group) != 2 || list[0].Group[1].Weight != 3 {
+		t.Errorf("groups: %+v", list)
+	}
+	list, err = rl.ListNexthops(&NexthopFilter{OutIndex: veth.Index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Errorf("nexthops of veth0: %+v", list)
+	}
+
+	err = rl.AddRoute(&Route{Dst: mustCIDR("10.1.0.0/16"), NhId: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, _ := rl.ListRoutes(syscall.AF_INET, RT_TABLE_MAIN)
+	if r := findRoute(routes, "10.1.0.0/16"); r == nil || r.NhId != 10 {
+		t.Errorf("route via group 10: %+v", r)
+	}
+
+	err = rl.ReplaceNexthop(&NexthopObject{Id: 2, Gateway: net.ParseIP("192.0.2.12"), OutIndex: veth.Index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rl.GetNexthop(2); got == nil || !got.Gateway.Equal(net.ParseIP("192.0.2.12")) {
+		t.Errorf("replaced nexthop 2: %+v", got)
+	}
+
+	/* groups drop deleted members */
+	err = rl.DelNexthop(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := rl.GetNexthop(10); got == nil || len(got.Group) != 1 || got.Group[0].Id != 2 {
+		t.Errorf("group 10 after deleting nexthop 1: %+v", got)
+	}
+
+	/* routes go away with their nexthop */
+	err = rl.DelNexthop(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, _ = rl.ListRoutes(syscall.AF_INET, RT_TABLE_MAIN)
+	if findRoute(routes, "10.1.0.0/16") != nil {
+		t.Error("route outlived its nexthop")
+	}
+}
+
+func TestNexthopBuckets(t *testing.T) {
+	rl := testNetns(t)
+	veth := testRoutedLink(t, rl)
+
+	err := rl.AddNexthop(&NexthopObject{Id: 1, Gateway: net.ParseIP("192.0.2.10"), OutIndex: veth.Index})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddNexthop(&NexthopObject{Id: 10, Group: []NexthopGroupMember{{Id: 1}},
+		Resilient: &NexthopResGroup{Buckets: 8}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := rl.GetNexthop(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.GroupType != NEXTHOP_GRP_TYPE_RES || got.Resilient == nil || got.Resilient.Buckets != 8 {
+		t.Errorf("group 10: %+v", got)
+	}
+
+	buckets, err := rl.ListNexthopBuckets(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 8 {
+		t.Fatalf("got %d buckets", len(buckets))
+	}
+	for _, b := range buckets {
+		if b.GroupId != 10 || b.NhId != 1 {
+			t.Errorf("bucket %+v", b)
+		}
+	}
+}
@@ -0,0 +1,801 @@
+package route
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	CHANGE_ADD    = 1
+	CHANGE_MODIFY = 2
+	CHANGE_DEL    = 3
+
+	DRIFT_CHECK_DELAY = 100 * time.Millisecond
+)
+
+// LinkSpec is a desired link. MasterName enslaves it to a link by name,
+// which may be created by the same plan.
+type LinkSpec struct {
+	Link       *Link
+	MasterName string
+}
+
+// AddrSpec is a desired address. IfName places it on a link by name instead
+// of Addr.Index.
+type AddrSpec struct {
+	Addr   *Address
+	IfName string
+}
+
+// RouteSpec is a desired route. IfName sets the output link by name instead
+// of Route.OutIndex.
+type RouteSpec struct {
+	Route  *Route
+	IfName string
+}
+
+// Spec is the desired network state. Links are matched by name and are
+// created or updated but never deleted; the addresses of the links in the
+// spec are owned, so addresses not in the spec are removed from them (IPv6
+// link local addresses aside). Routes and rules are owned when they carry
+// Protocol or live in one of Tables, and owned ones not in the spec are
+// removed. Routes and rules installed by the kernel itself are never owned.
+type Spec struct {
+	Protocol uint8 /* RTPROT_*, 0 to own by table only */
+	Tables   []uint32
+	Links    []*LinkSpec
+	Addrs    []*AddrSpec
+	Routes   []*RouteSpec
+	Rules    []*Rule
+}
+
+// Change is a single step of a Plan. Exactly one of the object fields is set.
+// IfName and MasterName are resolved to indexes when the change is applied.
+type Change struct {
+	Op         uint8 /* CHANGE_* */
+	IfName     string
+	MasterName string
+	Link       *Link
+	Addr       *Address
+	Route      *Route
+	Rule       *Rule
+}
+
+// Plan is the ordered list of changes that brings the kernel to a Spec.
+type Plan []*Change
+
+type DriftCallback func(Plan, chan error, ...interface{})
+
+type ApplyError struct {
+	Change *Change
+	Err    error
+}
+
+func (e *ApplyError) Error() string {
+	return fmt.Sprintf("route: %s: %v", e.Change, e.Err)
+}
+
+func (s *Spec) owns(table uint32, protocol uint8) bool {
+	if protocol == RTPROT_KERNEL {
+		return false
+	}
+	if s.Protocol != RTPROT_UNSPEC && protocol == s.Protocol {
+		return true
+	}
+	for _, t := range s.Tables {
+		if t == table {
+			return true
+		}
+	}
+	return false
+}
+
+// state is a snapshot of the kernel objects a plan is computed against.
+type state struct {
+	links   []*Link
+	byName  map[string]*Link
+	byIndex map[int32]*Link
+	addrs   []*Address
+	routes  []*Route
+	rules   []*Rule
+}
+
+func (rl *RouteNLSocket) getState() (*state, error) {
+	var err error
+
+	st := &state{
+		byName:  map[string]*Link{},
+		byIndex: map[int32]*Link{},
+	}
+
+	st.links, err = rl.ListLinks()
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range st.links {
+		st.byName[l.Name] = l
+		st.byIndex[l.Index] = l
+	}
+
+	st.addrs, err = rl.ListAddrs(syscall.AF_UNSPEC, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	st.routes, err = rl.ListRoutes(syscall.AF_UNSPEC, RT_TABLE_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+
+	st.rules, err = rl.ListRules(syscall.AF_UNSPEC)
+	if err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+func (st *state) ifName(index int32) string {
+	if l, ok := st.byIndex[index]; ok {
+		return l.Name
+	}
+	return ""
+}
+
+// resolve returns the index of the named link, or fallback when name is
+// empty. ok is false when the link does not exist yet.
+func (st *state) resolve(name string, fallback int32) (int32, bool) {
+	if name == "" {
+		return fallback, true
+	}
+	if l, ok := st.byName[name]; ok {
+		return l.Index, true
+	}
+	return 0, false
+}
+
+// forget drops a link that the plan deletes from the snapshot, along with
+// the addresses and routes that go away with it, so that those wanted on
+// the link that replaces it are planned again.
+func (st *state) forget(l *Link) {
+	delete(st.byName, l.Name)
+	delete(st.byIndex, l.Index)
+
+	addrs := []*Address{}
+	for _, a := range st.addrs {
+		if a.Index != l.Index {
+			addrs = append(addrs, a)
+		}
+	}
+	st.addrs = addrs
+
+	routes := []*Route{}
+	for _, r := range st.routes {
+		if !r.usesLink(l.Index) {
+			routes = append(routes, r)
+		}
+	}
+	st.routes = routes
+}
+
+func (st *state) planLinks(spec *Spec) Plan {
+	plan := Plan{}
+
+	for _, ls := range spec.Links {
+		des := ls.Link
+		cur, ok := st.byName[des.Name]
+
+		if ok && des.Info != nil && cur.Info != nil && des.Info.Kind() != cur.Info.Kind() {
+			/* the kind of a link cannot be changed, recreate it */
+			plan = append(plan, &Change{Op: CHANGE_DEL, Link: cur})
+			st.forget(cur)
+			ok = false
+		}
+
+		if !ok {
+			nl := *des
+			plan = append(plan, &Change{Op: CHANGE_ADD, MasterName: ls.MasterName, Link: &nl})
+			continue
+		}
+
+		mod := &Link{Name: des.Name}
+		mod.Index = cur.Index
+		changed := false
+
+		if des.MTU != 0 && des.MTU != cur.MTU {
+			mod.MTU = des.MTU
+			changed = true
+		}
+		if des.TxQLen != 0 && des.TxQLen != cur.TxQLen {
+			mod.TxQLen = des.TxQLen
+			changed = true
+		}
+		if len(des.HardwareAddr) != 0 && !bytes.Equal(des.HardwareAddr, cur.HardwareAddr) {
+			mod.HardwareAddr = des.HardwareAddr
+			changed = true
+		}
+		if des.Alias != "" && des.Alias != cur.Alias {
+			mod.Alias = des.Alias
+			changed = true
+		}
+
+		masterName := ""
+		master, mok := st.resolve(ls.MasterName, des.MasterIndex)
+		if (ls.MasterName != "" || des.MasterIndex != 0) && (!mok || master != cur.MasterIndex) {
+			mod.MasterIndex = master
+			masterName = ls.MasterName
+			changed = true
+		}
+
+		mask := des.Change
+		if mask == 0 {
+			mask = des.Flags
+		}
+		if (cur.Flags^des.Flags)&mask != 0 {
+			mod.Flags = des.Flags & mask
+			mod.Change = mask
+			changed = true
+		}
+
+		if changed {
+			plan = append(plan, &Change{Op: CHANGE_MODIFY, MasterName: masterName, Link: mod})
+		}
+	}
+
+	return plan
+}
+
+func addrKey(index int32, a *Address) string {
+	return fmt.Sprintf("%d %s/%d", index, a.Local, a.PrefixLen)
+}
+
+func (st *state) planAddrs(spec *Spec) Plan {
+	dels := Plan{}
+	adds := Plan{}
+
+	managed := map[int32]bool{}
+	for _, ls := range spec.Links {
+		if l, ok := st.byName[ls.Link.Name]; ok {
+			managed[l.Index] = true
+		}
+	}
+
+	current := map[string]bool{}
+	for _, a := range st.addrs {
+		current[addrKey(a.Index, a)] = true
+	}
+
+	desired := map[string]bool{}
+	for _, as := range spec.Addrs {
+		index, ok := st.resolve(as.IfName, as.Addr.Index)
+		key := addrKey(index, as.Addr)
+		desired[key] = true
+		if ok && current[key] {
+			continue
+		}
+		na := *as.Addr
+		na.Index = index
+		adds = append(adds, &Change{Op: CHANGE_ADD, IfName: as.IfName, Addr: &na})
+	}
+
+	for _, a := range st.addrs {
+		if !managed[a.Index] || desired[addrKey(a.Index, a)] {
+			continue
+		}
+		if a.Family == syscall.AF_INET6 && a.Local.IsLinkLocalUnicast() {
+			continue
+		}
+		dels = append(dels, &Change{Op: CHANGE_DEL, IfName: st.ifName(a.Index), Addr: a})
+	}
+
+	return append(dels, adds...)
+}
+
+func routeDst(r *Route) string {
+	if r.Dst == nil {
+		return "default"
+	}
+	return (&net.IPNet{IP: r.Dst.IP.Mask(r.Dst.Mask), Mask: r.Dst.Mask}).String()
+}
+
+// routeKey identifies a route the way the kernel does when replacing it.
+func routeKey(r *Route) string {
+	priority := r.Priority
+	if r.Family == syscall.AF_INET6 && priority == 0 {
+		/* the kernel default IPv6 metric */
+		priority = 1024
+	}
+	return fmt.Sprintf("%d %d %s %d %d", r.Family, r.Table, routeDst(r), priority, r.Tos)
+}
+
+func weight(w uint16) uint16 {
+	if w == 0 {
+		return 1
+	}
+	return w
+}
+
+func routeEqual(des, cur *Route) bool {
+	if des.Type != cur.Type || des.Scope != cur.Scope || des.Protocol != cur.Protocol {
+		return false
+	}
+	if des.NhId != 0 || cur.NhId != 0 {
+		/* the nexthop object carries the rest */
+		return des.NhId == cur.NhId
+	}
+	if !des.Gateway.Equal(cur.Gateway) || !des.PrefSrc.Equal(cur.PrefSrc) {
+		return false
+	}
+	/* the kernel resolves the output link of gateway routes */
+	if des.OutIndex != 0 && des.OutIndex != cur.OutIndex {
+		return false
+	}
+	if len(des.MultiPath) != len(cur.MultiPath) {
+		return false
+	}
+	for i, nh := range des.MultiPath {
+		cnh := cur.MultiPath[i]
+		if !nh.Gateway.Equal(cnh.Gateway) || weight(nh.Weight) != weight(cnh.Weight) {
+			return false
+		}
+		if nh.Index != 0 && nh.Index != cnh.Index {
+			return false
+		}
+	}
+	return true
+}
+
+// usesLink tells whether r goes through the link with the given index, in
+// which case the kernel removes it along with the link.
+func (r *Route) usesLink(index int32) bool {
+	if r.OutIndex == index {
+		return true
+	}
+	for _, nh := range r.MultiPath {
+		if nh.Index == index {
+			return true
+		}
+	}
+	return false
+}
+
+func (st *state) planRoutes(spec *Spec) Plan {
+	dels := Plan{}
+	adds := Plan{}
+
+	current := map[string]*Route{}
+	for _, r := range st.routes {
+		current[routeKey(r)] = r
+	}
+
+	desired := map[string]bool{}
+	for _, rs := range spec.Routes {
+		nr := *rs.Route
+		if nr.Protocol == RTPROT_UNSPEC {
+			nr.Protocol = spec.Protocol
+		}
+		r := nr.withDefaults()
+		r.Family = r.family()
+
+		index, ok := st.resolve(rs.IfName, r.OutIndex)
+		r.OutIndex = index
+
+		key := routeKey(r)
+		desired[key] = true
+
+		cur, exists := current[key]
+		switch {
+		case !exists || !ok:
+			adds = append(adds, &Change{Op: CHANGE_ADD, IfName: rs.IfName, Route: r})
+		case !routeEqual(r, cur):
+			adds = append(adds, &Change{Op: CHANGE_MODIFY, IfName: rs.IfName, Route: r})
+		}
+	}
+
+	for _, r := range st.routes {
+		if desired[routeKey(r)] || !spec.owns(r.Table, r.Protocol) {
+			continue
+		}
+		dels = append(dels, &Change{Op: CHANGE_DEL, IfName: st.ifName(r.OutIndex), Route: r})
+	}
+
+	return append(dels, adds...)
+}
+
+func ipNetEqual(a, b *net.IPNet) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.String() == b.String()
+}
+
+func ruleMask(r *Rule) uint32 {
+	/* the kernel matches the whole mark when no mask is given */
+	if r.Mask == 0 && r.Mark != 0 {
+		return 0xffffffff
+	}
+	return r.Mask
+}
+
+func ruleEqual(des, cur *Rule) bool {
+	if des.Family != cur.Family || des.Tos != cur.Tos || des.Table != cur.Table || des.Action != cur.Action {
+		return false
+	}
+	if des.Priority != 0 && des.Priority != cur.Priority {
+		return false
+	}
+	if !ipNetEqual(des.Src, cur.Src) || !ipNetEqual(des.Dst, cur.Dst) {
+		return false
+	}
+	if des.Flags&FIB_RULE_INVERT != cur.Flags&FIB_RULE_INVERT {
+		return false
+	}
+	if des.Mark != cur.Mark || ruleMask(des) != ruleMask(cur) {
+		return false
+	}
+	if des.IifName != cur.IifName || des.OifName != cur.OifName || des.Goto != cur.Goto {
+		return false
+	}
+	if des.HasSuppressPrefixLen != cur.HasSuppressPrefixLen || des.SuppressPrefixLen != cur.SuppressPrefixLen {
+		return false
+	}
+	if des.L3mdev != cur.L3mdev || des.IPProto != cur.IPProto || des.Protocol != cur.Protocol {
+		return false
+	}
+	if (des.UidRange == nil) != (cur.UidRange == nil) || des.UidRange != nil && *des.UidRange != *cur.UidRange {
+		return false
+	}
+	if (des.SportRange == nil) != (cur.SportRange == nil) || des.SportRange != nil && *des.SportRange != *cur.SportRange {
+		return false
+	}
+	if (des.DportRange == nil) != (cur.DportRange == nil) || des.DportRange != nil && *des.DportRange != *cur.DportRange {
+		return false
+	}
+	return true
+}
+
+func (st *state) planRules(spec *Spec) Plan {
+	dels := Plan{}
+	adds := Plan{}
+
+	matched := map[*Rule]bool{}
+
+	for _, dr := range spec.Rules {
+		nr := *dr
+		if nr.Protocol == RTPROT_UNSPEC {
+			nr.Protocol = spec.Protocol
+		}
+		r := nr.withDefaults()
+		r.Family = r.family()
+
+		found := false
+		for _, cur := range st.rules {
+			if !matched[cur] && ruleEqual(r, cur) {
+				matched[cur] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			adds = append(adds, &Change{Op: CHANGE_ADD, Rule: r})
+		}
+	}
+
+	for _, r := range st.rules {
+		if matched[r] || !spec.owns(r.Table, r.Protocol) {
+			continue
+		}
+		dels = append(dels, &Change{Op: CHANGE_DEL, Rule: r})
+	}
+
+	return append(dels, adds...)
+}
+
+// PlanSpec diffs spec against the current kernel state and returns the
+// changes needed to reach it, without applying them.
+func (rl *RouteNLSocket) PlanSpec(spec *Spec) (Plan, error) {
+	st, err := rl.getState()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := Plan{}
+	plan = append(plan, st.planLinks(spec)...)
+	plan = append(plan, st.planAddrs(spec)...)
+	plan = append(plan, st.planRoutes(spec)...)
+	plan = append(plan, st.planRules(spec)...)
+
+	return plan, nil
+}
+
+func (rl *RouteNLSocket) resolve(name string, fallback int32) (int32, error) {
+	if name == "" || fallback != 0 {
+		return fallback, nil
+	}
+	l, err := rl.GetLinkByName(name)
+	if err != nil {
+		return 0, err
+	}
+	return l.Index, nil
+}
+
+func (rl *RouteNLSocket) applyChange(c *Change) error {
+	var err error
+
+	switch {
+	case c.Link != nil:
+		l := *c.Link
+		l.MasterIndex, err = rl.resolve(c.MasterName, l.MasterIndex)
+		if err != nil {
+			return err
+		}
+		switch c.Op {
+		case CHANGE_ADD:
+			return rl.AddLink(&l)
+		case CHANGE_MODIFY:
+			return rl.ModifyLink(&l)
+		case CHANGE_DEL:
+			return rl.DelLink(l.Index)
+		}
+	case c.Addr != nil:
+		a := *c.Addr
+		a.Index, err = rl.resolve(c.IfName, a.Index)
+		if err != nil {
+			return err
+		}
+		switch c.Op {
+		case CHANGE_ADD:
+			return rl.AddAddr(&a)
+		case CHANGE_DEL:
+			return rl.DelAddr(&a)
+		}
+	case c.Route != nil:
+		r := *c.Route
+		if c.Op != CHANGE_DEL {
+			r.OutIndex, err = rl.resolve(c.IfName, r.OutIndex)
+			if err != nil {
+				return err
+			}
+		}
+		switch c.Op {
+		case CHANGE_ADD:
+			return rl.AddRoute(&r)
+		case CHANGE_MODIFY:
+			return rl.ReplaceRoute(&r)
+		case CHANGE_DEL:
+			return rl.DelRoute(&r)
+		}
+	case c.Rule != nil:
+		switch c.Op {
+		case CHANGE_ADD:
+			return rl.AddRule(c.Rule)
+		case CHANGE_DEL:
+			return rl.DelRule(c.Rule)
+		}
+	}
+
+	return syscall.EINVAL
+}
+
+// ApplyPlan applies the changes of plan in order and stops at the first
+// failure, which is returned as an *ApplyError.
+func (rl *RouteNLSocket) ApplyPlan(plan Plan) error {
+	for _, c := range plan {
+		err := rl.applyChange(c)
+		if err != nil {
+			return &ApplyError{Change: c, Err: err}
+		}
+	}
+	return nil
+}
+
+// Reconcile brings the kernel to spec and returns the plan it applied.
+func (rl *RouteNLSocket) Reconcile(spec *Spec) (Plan, error) {
+	plan, err := rl.PlanSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	return plan, rl.ApplyPlan(plan)
+}
+
+// StartDriftMonitor watches the change notifications on rl and calls cb
+// with the plan needed to get back to spec every time it changes, so an
+// empty plan reports that the drift is gone. The initial drift, if any, is
+// reported before it returns. Notifications are coalesced: a burst of them
+// triggers a single check, DRIFT_CHECK_DELAY after the first one. The
+// socket should not be used for requests once the monitor is running.
+func (rl *RouteNLSocket) StartDriftMonitor(spec *Spec, cb DriftCallback, ec chan error, args ...interface{}) error {
+	var mu sync.Mutex /* serialises the checks */
+	var pending int32
+	last := ""
+	stopped := false
+
+	/* the checks run from other goroutines, whose threads may be in
+	   another network namespace, so they share a socket opened here */
+	pl, err := OpenLink(0, 0)
+	if err != nil {
+		return err
+	}
+
+	check := func(ec chan error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if stopped {
+			return
+		}
+
+		plan, err := pl.PlanSpec(spec)
+		if err != nil {
+			if ec != nil {
+				ec <- err
+			}
+			return
+		}
+		if s := plan.String(); s != last {
+			last = s
+			cb(plan, ec, args...)
+		}
+	}
+
+	opts := &MonitorOptions{Links: true, Addrs: true, Routes: true, Rules: true, Dump: true}
+
+	stop := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped = true
+		pl.CloseLink()
+	}
+
+	err = rl.startMonitor(opts, func(e *Event, ec chan error, args ...interface{}) {
+		if e.Dump {
+			if e.Type == EVENT_DUMP_END {
+				check(ec)
+			}
+			return
+		}
+		if atomic.CompareAndSwapInt32(&pending, 0, 1) {
+			time.AfterFunc(DRIFT_CHECK_DELAY, func() {
+				atomic.StoreInt32(&pending, 0)
+				check(ec)
+			})
+		}
+	}, stop, ec)
+	if err != nil {
+		pl.CloseLink()
+	}
+	return err
+}
+
+func devName(name string, index int32) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("index %d", index)
+}
+
+func (c *Change) String() string {
+	op := map[uint8]string{CHANGE_ADD: "add", CHANGE_MODIFY: "modify", CHANGE_DEL: "del"}[c.Op]
+
+	s := []string{}
+
+	switch {
+	case c.Link != nil:
+		l := c.Link
+		s = append(s, op, "link", devName(l.Name, l.Index))
+		if c.Op == CHANGE_DEL {
+			break
+		}
+		if l.Info != nil {
+			s = append(s, "type", l.Info.Kind())
+		}
+		if l.MTU != 0 {
+			s = append(s, "mtu", fmt.Sprint(l.MTU))
+		}
+		if l.TxQLen != 0 {
+			s = append(s, "txqlen", fmt.Sprint(l.TxQLen))
+		}
+		if len(l.HardwareAddr) != 0 {
+			s = append(s, "address", l.HardwareAddr.String())
+		}
+		if l.Alias != "" {
+			s = append(s, "alias", l.Alias)
+		}
+		if c.MasterName != "" {
+			s = append(s, "master", c.MasterName)
+		} else if l.MasterIndex != 0 {
+			s = append(s, "master", devName("", l.MasterIndex))
+		}
+		mask := l.Change
+		if mask == 0 {
+			mask = l.Flags
+		}
+		if mask&syscall.IFF_UP != 0 {
+			if l.Flags&syscall.IFF_UP != 0 {
+				s = append(s, "up")
+			} else {
+				s = append(s, "down")
+			}
+		}
+	case c.Addr != nil:
+		a := c.Addr
+		s = append(s, op, "addr", fmt.Sprintf("%s/%d", a.Local, a.PrefixLen), "dev", devName(c.IfName, a.Index))
+	case c.Route != nil:
+		r := c.Route
+		if c.Op == CHANGE_MODIFY {
+			op = "replace"
+		}
+		s = append(s, op, "route", routeDst(r))
+		if r.Type != RTN_UNICAST {
+			s = append(s, "type", fmt.Sprint(r.Type))
+		}
+		if r.Gateway != nil {
+			s = append(s, "via", r.Gateway.String())
+		}
+		if c.IfName != "" || r.OutIndex != 0 {
+			s = append(s, "dev", devName(c.IfName, r.OutIndex))
+		}
+		for _, nh := range r.MultiPath {
+			s = append(s, "nexthop", "via", nh.Gateway.String(), "weight", fmt.Sprint(weight(nh.Weight)))
+		}
+		if r.NhId != 0 {
+			s = append(s, "nhid", fmt.Sprint(r.NhId))
+		}
+		if r.PrefSrc != nil {
+			s = append(s, "src", r.PrefSrc.String())
+		}
+		if r.Priority != 0 {
+			s = append(s, "metric", fmt.Sprint(r.Priority))
+		}
+		s = append(s, "table", fmt.Sprint(r.Table), "proto", fmt.Sprint(r.Protocol))
+	case c.Rule != nil:
+		r := c.Rule
+		s = append(s, op, "rule")
+		if r.Priority != 0 {
+			s = append(s, "pref", fmt.Sprint(r.Priority))
+		}
+		if r.Flags&FIB_RULE_INVERT != 0 {
+			s = append(s, "not")
+		}
+		if r.Src != nil {
+			s = append(s, "from", r.Src.String())
+		}
+		if r.Dst != nil {
+			s = append(s, "to", r.Dst.String())
+		}
+		if r.Mark != 0 || r.Mask != 0 {
+			s = append(s, "fwmark", fmt.Sprintf("%#x/%#x", r.Mark, ruleMask(r)))
+		}
+		if r.IifName != "" {
+			s = append(s, "iif", r.IifName)
+		}
+		if r.OifName != "" {
+			s = append(s, "oif", r.OifName)
+		}
+		switch r.Action {
+		case FR_ACT_TO_TBL:
+			s = append(s, "lookup", fmt.Sprint(r.Table))
+		case FR_ACT_GOTO:
+			s = append(s, "goto", fmt.Sprint(r.Goto))
+		default:
+			s = append(s, "action", fmt.Sprint(r.Action))
+		}
+		s = append(s, "proto", fmt.Sprint(r.Protocol))
+	}
+
+	return strings.Join(s, " ")
+}
+
+func (p Plan) String() string {
+	lines := make([]string, len(p))
+	for i, c := range p {
+		lines[i] = c.String()
+	}
+	return strings.Join(lines, "\n")
+}
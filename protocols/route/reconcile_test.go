@@ -0,0 +1,389 @@
+package route
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func testState(links []*Link, addrs []*Address, routes []*Route, rules []*Rule) *state {
+	st := &state{
+		links:   links,
+		byName:  map[string]*Link{},
+		byIndex: map[int32]*Link{},
+		addrs:   addrs,
+		routes:  routes,
+		rules:   rules,
+	}
+	for _, l := range links {
+		st.byName[l.Name] = l
+		st.byIndex[l.Index] = l
+	}
+	return st
+}
+
+func testLink(index int32, name string, info LinkInfo) *Link {
+	return &Link{IfInfomsg: IfInfomsg{Index: index}, Name: name, MTU: 1500, Info: info}
+}
+
+func checkPlan(t *testing.T, plan Plan, want ...string) {
+	t.Helper()
+	if got := plan.String(); got != strings.Join(want, "\n") {
+		t.Errorf("plan:\n%s\nwant:\n%s", got, strings.Join(want, "\n"))
+	}
+}
+
+func TestPlanLinks(t *testing.T) {
+	st := testState([]*Link{
+		testLink(2, "br0", &Bridge{}),
+		testLink(3, "eth0", &Veth{}),
+	}, nil, nil, nil)
+
+	spec := &Spec{Links: []*LinkSpec{
+		{Link: &Link{Name: "br0", MTU: 1500, Info: &Bridge{}}},
+		{Link: &Link{Name: "eth0", MTU: 9000, IfInfomsg: IfInfomsg{Flags: syscall.IFF_UP}}, MasterName: "br0"},
+		{Link: &Link{Name: "br1", Info: &Bridge{}}},
+		{Link: &Link{Name: "eth1", Info: &Veth{PeerName: "eth2"}}, MasterName: "br1"},
+	}}
+
+	checkPlan(t, st.planLinks(spec),
+		"modify link eth0 mtu 9000 master br0 up",
+		"add link br1 type bridge",
+		"add link eth1 type veth master br1",
+	)
+
+	/* a link already in its desired state is left alone */
+	st.byName["eth0"].MasterIndex = 2
+	st.byName["eth0"].MTU = 9000
+	st.byName["eth0"].Flags = syscall.IFF_UP
+	checkPlan(t, st.planLinks(&Spec{Links: spec.Links[:2]}))
+}
+
+func TestPlanLinkRecreate(t *testing.T) {
+	st := testState(
+		[]*Link{testLink(2, "lan", &Veth{}), testLink(3, "eth0", &Veth{})},
+		[]*Address{
+			{Index: 2, Family: syscall.AF_INET, Local: net.ParseIP("192.0.2.1"), PrefixLen: 24},
+			{Index: 3, Family: syscall.AF_INET, Local: net.ParseIP("198.51.100.1"), PrefixLen: 24},
+		},
+		[]*Route{
+			{Family: syscall.AF_INET, Dst: mustCIDR("10.0.0.0/8"), OutIndex: 2, Table: RT_TABLE_MAIN,
+				Protocol: RTPROT_STATIC, Type: RTN_UNICAST, Gateway: net.ParseIP("192.0.2.254")},
+		},
+		nil)
+
+	spec := &Spec{
+		Protocol: RTPROT_STATIC,
+		Links:    []*LinkSpec{{Link: &Link{Name: "lan", Info: &Bridge{}}}},
+		Addrs:    []*AddrSpec{{Addr: &Address{Local: net.ParseIP("192.0.2.1"), PrefixLen: 24}, IfName: "lan"}},
+		Routes:   []*RouteSpec{{Route: &Route{Dst: mustCIDR("10.0.0.0/8"), Gateway: net.ParseIP("192.0.2.254")}, IfName: "lan"}},
+	}
+
+	/* what lived on the old link is planned again on the new one */
+	plan := st.planLinks(spec)
+	plan = append(plan, st.planAddrs(spec)...)
+	plan = append(plan, st.planRoutes(spec)...)
+	checkPlan(t, plan,
+		"del link lan",
+		"add link lan type bridge",
+		"add addr 192.0.2.1/24 dev lan",
+		"add route 10.0.0.0/8 via 192.0.2.254 dev lan table 254 proto 4",
+	)
+
+	if _, ok := st.byIndex[2]; ok || len(st.addrs) != 1 || len(st.routes) != 0 {
+		t.Errorf("old link not forgotten: %+v %+v", st.addrs, st.routes)
+	}
+}
+
+func TestPlanAddrs(t *testing.T) {
+	st := testState([]*Link{testLink(2, "eth0", nil), testLink(3, "eth1", nil)}, []*Address{
+		{Index: 2, Family: syscall.AF_INET, Local: net.ParseIP("192.0.2.1"), PrefixLen: 24},
+		{Index: 2, Family: syscall.AF_INET, Local: net.ParseIP("192.0.2.2"), PrefixLen: 24},
+		{Index: 2, Family: syscall.AF_INET6, Local: net.ParseIP("fe80::1"), PrefixLen: 64},
+		{Index: 3, Family: syscall.AF_INET, Local: net.ParseIP("198.51.100.1"), PrefixLen: 24},
+	}, nil, nil)
+
+	/* only the addresses of the links in the spec are owned */
+	spec := &Spec{
+		Links: []*LinkSpec{{Link: &Link{Name: "eth0"}}},
+		Addrs: []*AddrSpec{
+			{Addr: &Address{Local: net.ParseIP("192.0.2.1"), PrefixLen: 24}, IfName: "eth0"},
+			{Addr: &Address{Local: net.ParseIP("2001:db8::1"), PrefixLen: 64, Index: 2}},
+		},
+	}
+	checkPlan(t, st.planAddrs(spec),
+		"del addr 192.0.2.2/24 dev eth0",
+		"add addr 2001:db8::1/64 dev index 2",
+	)
+}
+
+func TestRouteKey(t *testing.T) {
+	r4 := &Route{Family: syscall.AF_INET, Table: RT_TABLE_MAIN, Dst: &net.IPNet{IP: net.ParseIP("10.1.2.3").To4(), Mask: net.CIDRMask(8, 32)}}
+	if k := routeKey(r4); k != "2 254 10.0.0.0/8 0 0" {
+		t.Errorf("key %q", k)
+	}
+	if k := routeKey(&Route{Family: syscall.AF_INET, Table: RT_TABLE_MAIN}); k != "2 254 default 0 0" {
+		t.Errorf("default route key %q", k)
+	}
+
+	/* IPv6 routes get a metric of 1024 when none is given */
+	r6 := &Route{Family: syscall.AF_INET6, Table: RT_TABLE_MAIN, Dst: mustCIDR("2001:db8::/32")}
+	if routeKey(r6) != routeKey(&Route{Family: syscall.AF_INET6, Table: RT_TABLE_MAIN, Dst: mustCIDR("2001:db8::/32"), Priority: 1024}) {
+		t.Errorf("key %q", routeKey(r6))
+	}
+}
+
+func TestRouteEqual(t *testing.T) {
+	base := func() *Route {
+		return &Route{Type: RTN_UNICAST, Protocol: RTPROT_STATIC, Gateway: net.ParseIP("192.0.2.254"), OutIndex: 2}
+	}
+
+	tests := []struct {
+		name  string
+		des   func(*Route)
+		cur   func(*Route)
+		equal bool
+	}{
+		{"same", nil, nil, true},
+		{"gateway", func(r *Route) { r.Gateway = net.ParseIP("192.0.2.253") }, nil, false},
+		{"output link resolved by the kernel", func(r *Route) { r.OutIndex = 0 }, nil, true},
+		{"output link", func(r *Route) { r.OutIndex = 3 }, nil, false},
+		{"protocol", nil, func(r *Route) { r.Protocol = RTPROT_BOOT }, false},
+		{"nexthop object", func(r *Route) { r.NhId = 5 }, func(r *Route) { r.NhId = 5; r.Gateway = nil }, true},
+		{"weight 0 is 1",
+			func(r *Route) { r.MultiPath = []*NextHop{{Gateway: net.ParseIP("192.0.2.1")}} },
+			func(r *Route) { r.MultiPath = []*NextHop{{Gateway: net.ParseIP("192.0.2.1"), Weight: 1, Index: 2}} },
+			true},
+		{"weight",
+			func(r *Route) { r.MultiPath = []*NextHop{{Gateway: net.ParseIP("192.0.2.1"), Weight: 2}} },
+			func(r *Route) { r.MultiPath = []*NextHop{{Gateway: net.ParseIP("192.0.2.1"), Weight: 1}} },
+			false},
+	}
+
+	for _, test := range tests {
+		des, cur := base(), base()
+		if test.des != nil {
+			test.des(des)
+		}
+		if test.cur != nil {
+			test.cur(cur)
+		}
+		if routeEqual(des, cur) != test.equal {
+			t.Errorf("%s: equal %v", test.name, !test.equal)
+		}
+	}
+}
+
+func TestPlanRoutes(t *testing.T) {
+	st := testState([]*Link{testLink(2, "eth0", nil)}, nil, []*Route{
+		{Family: syscall.AF_INET, Dst: mustCIDR("10.1.0.0/16"), Table: RT_TABLE_MAIN, Protocol: RTPROT_STATIC,
+			Type: RTN_UNICAST, Gateway: net.ParseIP("192.0.2.254"), OutIndex: 2},
+		{Family: syscall.AF_INET, Dst: mustCIDR("10.2.0.0/16"), Table: RT_TABLE_MAIN, Protocol: RTPROT_STATIC,
+			Type: RTN_UNICAST, Gateway: net.ParseIP("192.0.2.254"), OutIndex: 2},
+		{Family: syscall.AF_INET, Dst: mustCIDR("10.3.0.0/16"), Table: RT_TABLE_MAIN, Protocol: RTPROT_STATIC,
+			Type: RTN_UNICAST, Gateway: net.ParseIP("192.0.2.254"), OutIndex: 2},
+		{Family: syscall.AF_INET, Dst: mustCIDR("192.0.2.0/24"), Table: RT_TABLE_MAIN, Protocol: RTPROT_KERNEL,
+			Type: RTN_UNICAST, Scope: RT_SCOPE_LINK, OutIndex: 2},
+		{Family: syscall.AF_INET, Dst: mustCIDR("172.16.0.0/12"), Table: RT_TABLE_MAIN, Protocol: RTPROT_BOOT,
+			Type: RTN_UNICAST, Gateway: net.ParseIP("192.0.2.254"), OutIndex: 2},
+		{Family: syscall.AF_INET, Table: 100, Protocol: RTPROT_BOOT, Type: RTN_UNICAST, Gateway: net.ParseIP("192.0.2.1"), OutIndex: 2},
+	}, nil)
+
+	spec := &Spec{
+		Protocol: RTPROT_STATIC,
+		Tables:   []uint32{100},
+		Routes: []*RouteSpec{
+			{Route: &Route{Dst: mustCIDR("10.1.0.0/16"), Gateway: net.ParseIP("192.0.2.254")}},
+			{Route: &Route{Dst: mustCIDR("10.2.0.0/16"), Gateway: net.ParseIP("192.0.2.253")}, IfName: "eth0"},
+			{Route: &Route{Dst: mustCIDR("10.4.0.0/16"), Gateway: net.ParseIP("192.0.2.254")}, IfName: "eth1"},
+		},
+	}
+
+	/* kernel routes and routes of other protocols and tables are kept */
+	checkPlan(t, st.planRoutes(spec),
+		"del route 10.3.0.0/16 via 192.0.2.254 dev eth0 table 254 proto 4",
+		"del route default via 192.0.2.1 dev eth0 table 100 proto 3",
+		"replace route 10.2.0.0/16 via 192.0.2.253 dev eth0 table 254 proto 4",
+		"add route 10.4.0.0/16 via 192.0.2.254 dev eth1 table 254 proto 4",
+	)
+}
+
+func TestPlanRules(t *testing.T) {
+	st := testState(nil, nil, nil, []*Rule{
+		{Family: syscall.AF_INET, Priority: 0, Table: RT_TABLE_LOCAL, Action: FR_ACT_TO_TBL, Protocol: RTPROT_KERNEL},
+		{Family: syscall.AF_INET, Priority: 100, Table: 100, Action: FR_ACT_TO_TBL, Mark: 1, Mask: 0xffffffff, Protocol: RTPROT_STATIC},
+		{Family: syscall.AF_INET, Priority: 101, Table: 101, Action: FR_ACT_TO_TBL, Src: mustCIDR("10.0.0.0/8"), Protocol: RTPROT_STATIC},
+	})
+
+	/* a mark without a mask matches the whole mark */
+	spec := &Spec{
+		Protocol: RTPROT_STATIC,
+		Rules: []*Rule{
+			{Priority: 100, Table: 100, Mark: 1},
+			{Priority: 102, Table: 102, Src: mustCIDR("10.0.0.0/8")},
+		},
+	}
+	checkPlan(t, st.planRules(spec),
+		"del rule pref 101 from 10.0.0.0/8 lookup 101 proto 4",
+		"add rule pref 102 from 10.0.0.0/8 lookup 102 proto 4",
+	)
+}
+
+func TestChangeString(t *testing.T) {
+	tests := []struct {
+		c    *Change
+		want string
+	}{
+		{&Change{Op: CHANGE_DEL, Link: &Link{IfInfomsg: IfInfomsg{Index: 4}}}, "del link index 4"},
+		{&Change{Op: CHANGE_MODIFY, Link: &Link{Name: "eth0", IfInfomsg: IfInfomsg{Change: syscall.IFF_UP}}}, "modify link eth0 down"},
+		{&Change{Op: CHANGE_ADD, Route: &Route{Type: RTN_BLACKHOLE, Table: 100, Priority: 5, Protocol: RTPROT_STATIC}},
+			"add route default type 6 metric 5 table 100 proto 4"},
+		{&Change{Op: CHANGE_ADD, Rule: &Rule{Flags: FIB_RULE_INVERT, Mark: 1, IifName: "lo", Action: FR_ACT_GOTO, Goto: 10}},
+			"add rule not fwmark 0x1/0xffffffff iif lo goto 10 proto 0"},
+	}
+
+	for _, test := range tests {
+		if got := test.c.String(); got != test.want {
+			t.Errorf("got %q, want %q", got, test.want)
+		}
+	}
+}
+
+func testSpec() *Spec {
+	return &Spec{
+		Protocol: RTPROT_STATIC,
+		Links: []*LinkSpec{
+			{Link: &Link{Name: "br0", MTU: 1400, IfInfomsg: IfInfomsg{Flags: syscall.IFF_UP}, Info: &Bridge{}}},
+		},
+		Addrs: []*AddrSpec{
+			{Addr: &Address{Local: net.ParseIP("192.0.2.1"), PrefixLen: 24}, IfName: "br0"},
+		},
+		Routes: []*RouteSpec{
+			{Route: &Route{Dst: mustCIDR("10.0.0.0/8"), OutIndex: 0, Scope: RT_SCOPE_LINK}, IfName: "br0"},
+		},
+		Rules: []*Rule{
+			{Priority: 100, Table: 100, Mark: 1},
+		},
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	rl := testNetns(t)
+	spec := testSpec()
+
+	plan, err := rl.Reconcile(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan) != 4 {
+		t.Errorf("plan:\n%s", plan)
+	}
+
+	br := mustLink(t, rl, "br0")
+	if br.MTU != 1400 || br.Flags&syscall.IFF_UP == 0 {
+		t.Errorf("br0: mtu %d flags %#x", br.MTU, br.Flags)
+	}
+
+	/* a second run has nothing left to do */
+	plan, err = rl.PlanSpec(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlan(t, plan)
+
+	err = rl.AddAddr(&Address{Index: br.Index, Local: net.ParseIP("198.51.100.1"), PrefixLen: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.SetLinkMTU(br.Index, 1300)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err = rl.Reconcile(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkPlan(t, plan,
+		"modify link br0 mtu 1400",
+		"del addr 198.51.100.1/24 dev br0",
+	)
+	plan, _ = rl.PlanSpec(spec)
+	checkPlan(t, plan)
+
+	/* failures name the change that failed */
+	bad := &Spec{Addrs: []*AddrSpec{{Addr: &Address{Local: net.ParseIP("192.0.2.9"), PrefixLen: 24}, IfName: "missing"}}}
+	_, err = rl.Reconcile(bad)
+	if ae, ok := err.(*ApplyError); !ok || ae.Err != syscall.ENODEV || ae.Change.IfName != "missing" {
+		t.Errorf("got %v", err)
+	}
+}
+
+func TestDriftMonitor(t *testing.T) {
+	rl := testNetns(t)
+	spec := testSpec()
+
+	_, err := rl.Reconcile(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	br := mustLink(t, rl, "br0")
+
+	ml, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ml.CloseLink()
+
+	plans := make(chan Plan, 10)
+	err = ml.StartDriftMonitor(spec, func(p Plan, ec chan error, args ...interface{}) {
+		plans <- p
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nextPlan := func() Plan {
+		t.Helper()
+		select {
+		case p := <-plans:
+			return p
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a plan")
+		}
+		return nil
+	}
+
+	/* no drift, nothing reported */
+	select {
+	case p := <-plans:
+		t.Fatalf("initial plan:\n%s", p)
+	default:
+	}
+
+	/* drift is reported as it is found */
+	for i := 1; i <= 10; i++ {
+		err := rl.AddAddr(&Address{Index: br.Index, Local: net.IPv4(198, 51, 100, byte(i)), PrefixLen: 32})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for p := nextPlan(); len(p) != 10; p = nextPlan() {
+		for _, c := range p {
+			if c.Op != CHANGE_DEL || c.Addr == nil {
+				t.Fatalf("plan:\n%s", p)
+			}
+		}
+	}
+
+	for i := 1; i <= 10; i++ {
+		err := rl.DelAddr(&Address{Index: br.Index, Local: net.IPv4(198, 51, 100, byte(i)), PrefixLen: 32})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if p := nextPlan(); len(p) != 0 {
+		t.Errorf("drift not gone:\n%s", p)
+	}
+}
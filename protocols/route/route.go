@@ -0,0 +1,100 @@
+package route
+
+import (
+	"syscall"
+
+	"github.com/apuigsech/netlink"
+)
+
+type RouteNLSocket netlink.NetlinkSocket
+
+func OpenLink(group, pid uint32) (*RouteNLSocket, error) {
+	nl, err := netlink.OpenLink(syscall.NETLINK_ROUTE, group, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*RouteNLSocket)(nl), nil
+}
+
+func (rl *RouteNLSocket) CloseLink() error {
+	nl := (*netlink.NetlinkSocket)(rl)
+	return nl.CloseLink()
+}
+
+func (rl *RouteNLSocket) AddMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(rl)
+	return nl.AddMembership(group)
+}
+
+func (rl *RouteNLSocket) DropMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(rl)
+	return nl.DropMembership(group)
+}
+
+func (rl *RouteNLSocket) SetStrictCheck(enable bool) error {
+	nl := (*netlink.NetlinkSocket)(rl)
+	return nl.SetStrictCheck(enable)
+}
+
+func (rl *RouteNLSocket) StrictCheck() (bool, error) {
+	nl := (*netlink.NetlinkSocket)(rl)
+	return nl.StrictCheck()
+}
+
+// dumpStrict runs a dump with strict checking enabled, so that the kernel
+// filters it by the values set in the request header, and restores the
+// previous setting of the socket afterwards. Kernels without strict
+// checking dump everything, which is why callers filter the replies too.
+func (rl *RouteNLSocket) dumpStrict(msgtype uint16, data []byte) ([]netlink.NetlinkMessage, error) {
+	prev, err := rl.StrictCheck()
+	if err == syscall.ENOPROTOOPT {
+		return rl.Execute(msgtype, syscall.NLM_F_DUMP, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !prev {
+		err = rl.SetStrictCheck(true)
+		if err != nil {
+			return nil, err
+		}
+		defer rl.SetStrictCheck(false)
+	}
+
+	return rl.Execute(msgtype, syscall.NLM_F_DUMP, data)
+}
+
+func (rl *RouteNLSocket) RecvMessages(sz int, sockflags int) ([]netlink.NetlinkMessage, error) {
+	nl := (*netlink.NetlinkSocket)(rl)
+	return nl.RecvMessages(sz, sockflags)
+}
+
+func (rl *RouteNLSocket) Request(msgtype, flags uint16, data []byte, sockflags int, ack bool) error {
+	nl := (*netlink.NetlinkSocket)(rl)
+	msg := &netlink.NetlinkMessage{
+		Header: syscall.NlMsghdr{
+			Type:  msgtype,
+			Flags: flags | syscall.NLM_F_REQUEST,
+		},
+		Data: data,
+	}
+
+	return nl.SendMessage(msg, sockflags, ack)
+}
+
+// Execute sends a request and waits for the kernel to acknowledge it,
+// returning the replies it produced.
+func (rl *RouteNLSocket) Execute(msgtype, flags uint16, data []byte) ([]netlink.NetlinkMessage, error) {
+	nl := (*netlink.NetlinkSocket)(rl)
+	msg := &netlink.NetlinkMessage{
+		Header: syscall.NlMsghdr{
+			Type:  msgtype,
+			Flags: flags,
+		},
+		Data: data,
+	}
+
+	return nl.Execute(msg, 0)
+}
@@ -0,0 +1,466 @@
+package route
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofRtMsg     = 12
+	SizeofRtNexthop = 8
+)
+
+type RtMsg struct {
+	Family   uint8
+	DstLen   uint8
+	SrcLen   uint8
+	Tos      uint8
+	Table    uint8 /* RT_TABLE_*, see RTA_TABLE for ids above 255 */
+	Protocol uint8 /* RTPROT_* */
+	Scope    uint8 /* RT_SCOPE_* */
+	Type     uint8 /* RTN_* */
+	Flags    uint32
+}
+
+// NextHop is one of the paths of a multipath route. A zero Weight is sent
+// as the default weight of 1.
+type NextHop struct {
+	Index   int32
+	Gateway net.IP
+	Weight  uint16
+	Flags   uint8 /* RTNH_F_* */
+}
+
+// Route is a routing table entry. A nil Dst is the default route. Metrics is
+// keyed by RTAX_* values.
+type Route struct {
+	Family    uint8
+	Dst       *net.IPNet
+	Src       *net.IPNet
+	Tos       uint8
+	Table     uint32
+	Protocol  uint8
+	Scope     uint8
+	Type      uint8
+	Flags     uint32
+	OutIndex  int32
+	InIndex   int32
+	Gateway   net.IP
+	PrefSrc   net.IP
+	Priority  uint32
+	Mark      uint32
+	NhId      uint32 /* nexthop object, see NexthopObject */
+	Metrics   map[uint16]uint32
+	MultiPath []*NextHop
+	Attrs     []netlink.NetlinkAttr
+}
+
+// RouteQuery describes the packet used to ask the kernel which route it
+// would take, as ip route get does.
+type RouteQuery struct {
+	Dst      net.IP
+	Src      net.IP
+	OutIndex int32
+	InIndex  int32
+	Mark     uint32
+	Tos      uint8
+	FibMatch bool
+}
+
+func RtMsgfromWireFormat(data []byte) *RtMsg {
+	return &RtMsg{
+		Family:   data[0],
+		DstLen:   data[1],
+		SrcLen:   data[2],
+		Tos:      data[3],
+		Table:    data[4],
+		Protocol: data[5],
+		Scope:    data[6],
+		Type:     data[7],
+		Flags:    *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+	}
+}
+
+func (rtm *RtMsg) toWireFormat() []byte {
+	b := make([]byte, SizeofRtMsg)
+	b[0] = rtm.Family
+	b[1] = rtm.DstLen
+	b[2] = rtm.SrcLen
+	b[3] = rtm.Tos
+	b[4] = rtm.Table
+	b[5] = rtm.Protocol
+	b[6] = rtm.Scope
+	b[7] = rtm.Type
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = rtm.Flags
+	return b
+}
+
+func ipNet(ip []byte, plen uint8) *net.IPNet {
+	return &net.IPNet{IP: net.IP(ip), Mask: net.CIDRMask(int(plen), len(ip)*8)}
+}
+
+func parseMultiPath(data []byte) ([]*NextHop, error) {
+	ret := []*NextHop{}
+
+	for len(data) >= SizeofRtNexthop {
+		l := int(*(*uint16)(unsafe.Pointer(&data[0:2][0])))
+		if l < SizeofRtNexthop || l > len(data) {
+			return nil, errors.New("rtnexthop out of range")
+		}
+
+		nh := &NextHop{
+			Flags:  data[2],
+			Weight: uint16(data[3]) + 1,
+			Index:  *(*int32)(unsafe.Pointer(&data[4:8][0])),
+		}
+
+		attrs, err := netlink.ParseNetlinkAttrs(data[SizeofRtNexthop:l])
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range attrs {
+			if attr.AttrType() == RTA_GATEWAY {
+				nh.Gateway = net.IP(attr.Data)
+			}
+		}
+		ret = append(ret, nh)
+
+		l = (l + netlink.NLA_ALIGNTO - 1) & ^(netlink.NLA_ALIGNTO - 1)
+		if l > len(data) {
+			break
+		}
+		data = data[l:]
+	}
+
+	return ret, nil
+}
+
+func (nh *NextHop) toWireFormat() []byte {
+	attrs := []netlink.NetlinkAttr{}
+	if nh.Gateway != nil {
+		_, gw := ipFamily(nh.Gateway)
+		attrs = append(attrs, netlink.NewAttr(RTA_GATEWAY, gw))
+	}
+	data := netlink.AttrsToWireFormat(attrs)
+
+	hops := uint8(0)
+	if nh.Weight > 0 {
+		hops = uint8(nh.Weight - 1)
+	}
+
+	b := make([]byte, SizeofRtNexthop, SizeofRtNexthop+len(data))
+	*(*uint16)(unsafe.Pointer(&b[0:2][0])) = uint16(SizeofRtNexthop + len(data))
+	b[2] = nh.Flags
+	b[3] = hops
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = nh.Index
+	return append(b, data...)
+}
+
+func RoutefromWireFormat(data []byte) (*Route, error) {
+	if len(data) < SizeofRtMsg {
+		return nil, errors.New("short rtmsg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofRtMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	rtm := RtMsgfromWireFormat(data)
+	r := &Route{
+		Family:   rtm.Family,
+		Tos:      rtm.Tos,
+		Table:    uint32(rtm.Table),
+		Protocol: rtm.Protocol,
+		Scope:    rtm.Scope,
+		Type:     rtm.Type,
+		Flags:    rtm.Flags,
+		Attrs:    attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case RTA_DST:
+			r.Dst = ipNet(attr.Data, rtm.DstLen)
+		case RTA_SRC:
+			r.Src = ipNet(attr.Data, rtm.SrcLen)
+		case RTA_OIF:
+			r.OutIndex = int32(attr.Uint32())
+		case RTA_IIF:
+			r.InIndex = int32(attr.Uint32())
+		case RTA_GATEWAY:
+			r.Gateway = net.IP(attr.Data)
+		case RTA_PREFSRC:
+			r.PrefSrc = net.IP(attr.Data)
+		case RTA_PRIORITY:
+			r.Priority = attr.Uint32()
+		case RTA_TABLE:
+			r.Table = attr.Uint32()
+		case RTA_MARK:
+			r.Mark = attr.Uint32()
+		case RTA_NH_ID:
+			r.NhId = attr.Uint32()
+		case RTA_METRICS:
+			metrics, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			r.Metrics = map[uint16]uint32{}
+			for _, m := range metrics {
+				if m.AttrType() == RTAX_CC_ALGO {
+					continue
+				}
+				r.Metrics[m.AttrType()] = m.Uint32()
+			}
+		case RTA_MULTIPATH:
+			mp, err := parseMultiPath(attr.Data)
+			if err != nil {
+				return nil, err
+			}
+			r.MultiPath = mp
+		}
+	}
+
+	return r, nil
+}
+
+func (r *Route) family() uint8 {
+	if r.Family != syscall.AF_UNSPEC {
+		return r.Family
+	}
+	for _, ip := range []net.IP{r.dstIP(), r.Gateway, r.PrefSrc} {
+		if ip != nil {
+			f, _ := ipFamily(ip)
+			return f
+		}
+	}
+	for _, nh := range r.MultiPath {
+		if nh.Gateway != nil {
+			f, _ := ipFamily(nh.Gateway)
+			return f
+		}
+	}
+	return syscall.AF_INET
+}
+
+func (r *Route) dstIP() net.IP {
+	if r.Dst == nil {
+		return nil
+	}
+	return r.Dst.IP
+}
+
+// ipBytes returns ip in the wire representation of family.
+func ipBytes(family uint8, ip net.IP) []byte {
+	if family == syscall.AF_INET {
+		return ip.To4()
+	}
+	return ip.To16()
+}
+
+func (r *Route) toWireFormat() []byte {
+	family := r.family()
+
+	rtm := &RtMsg{
+		Family:   family,
+		Tos:      r.Tos,
+		Protocol: r.Protocol,
+		Scope:    r.Scope,
+		Type:     r.Type,
+		Flags:    r.Flags,
+	}
+
+	attrs := []netlink.NetlinkAttr{}
+
+	if r.Table < 256 {
+		rtm.Table = uint8(r.Table)
+	} else {
+		rtm.Table = RT_TABLE_UNSPEC
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_TABLE, r.Table))
+	}
+	if r.Dst != nil {
+		plen, _ := r.Dst.Mask.Size()
+		rtm.DstLen = uint8(plen)
+		attrs = append(attrs, netlink.NewAttr(RTA_DST, ipBytes(family, r.Dst.IP)))
+	}
+	if r.Src != nil {
+		plen, _ := r.Src.Mask.Size()
+		rtm.SrcLen = uint8(plen)
+		attrs = append(attrs, netlink.NewAttr(RTA_SRC, ipBytes(family, r.Src.IP)))
+	}
+	if r.OutIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_OIF, uint32(r.OutIndex)))
+	}
+	if r.InIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_IIF, uint32(r.InIndex)))
+	}
+	if r.Gateway != nil {
+		attrs = append(attrs, netlink.NewAttr(RTA_GATEWAY, ipBytes(family, r.Gateway)))
+	}
+	if r.PrefSrc != nil {
+		attrs = append(attrs, netlink.NewAttr(RTA_PREFSRC, ipBytes(family, r.PrefSrc)))
+	}
+	if r.Priority != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_PRIORITY, r.Priority))
+	}
+	if r.Mark != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_MARK, r.Mark))
+	}
+	if r.NhId != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_NH_ID, r.NhId))
+	}
+	if len(r.Metrics) != 0 {
+		metrics := []netlink.NetlinkAttr{}
+		for t, v := range r.Metrics {
+			metrics = append(metrics, netlink.NewAttrUint32(t, v))
+		}
+		attrs = append(attrs, netlink.NewAttrNested(RTA_METRICS, metrics))
+	}
+	if len(r.MultiPath) != 0 {
+		mp := []byte{}
+		for _, nh := range r.MultiPath {
+			mp = append(mp, nh.toWireFormat()...)
+		}
+		attrs = append(attrs, netlink.NewAttr(RTA_MULTIPATH, mp))
+	}
+
+	return append(rtm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+}
+
+// withDefaults fills the fields a new route needs, like ip route add does.
+func (r *Route) withDefaults() *Route {
+	nr := *r
+	if nr.Protocol == RTPROT_UNSPEC {
+		nr.Protocol = RTPROT_BOOT
+	}
+	if nr.Type == RTN_UNSPEC {
+		nr.Type = RTN_UNICAST
+	}
+	if nr.Table == RT_TABLE_UNSPEC {
+		nr.Table = RT_TABLE_MAIN
+	}
+	if nr.Scope == RT_SCOPE_UNIVERSE && nr.Type == RTN_LOCAL {
+		nr.Scope = RT_SCOPE_HOST
+	}
+	return &nr
+}
+
+// ListRoutes dumps the routes of the given family (AF_UNSPEC for all) in the
+// given table (0 for all tables). Cached clones are not included.
+func (rl *RouteNLSocket) ListRoutes(family uint8, table uint32) ([]*Route, error) {
+	rtm := &RtMsg{Family: family}
+	data := rtm.toWireFormat()
+	if table != RT_TABLE_UNSPEC {
+		data = append(data, netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+			netlink.NewAttrUint32(RTA_TABLE, table),
+		})...)
+	}
+
+	msgList, err := rl.dumpStrict(RTM_GETROUTE, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Route{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWROUTE {
+			continue
+		}
+		r, err := RoutefromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if r.Flags&RTM_F_CLONED != 0 {
+			continue
+		}
+		if family != syscall.AF_UNSPEC && r.Family != family {
+			continue
+		}
+		if table != RT_TABLE_UNSPEC && r.Table != table {
+			continue
+		}
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddRoute(r *Route) error {
+	_, err := rl.Execute(RTM_NEWROUTE, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, r.withDefaults().toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) ReplaceRoute(r *Route) error {
+	_, err := rl.Execute(RTM_NEWROUTE, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, r.withDefaults().toWireFormat())
+	return err
+}
+
+// AppendRoute adds r as an additional path of an existing IPv6 route.
+func (rl *RouteNLSocket) AppendRoute(r *Route) error {
+	_, err := rl.Execute(RTM_NEWROUTE, syscall.NLM_F_CREATE|syscall.NLM_F_APPEND, r.withDefaults().toWireFormat())
+	return err
+}
+
+// DelRoute deletes the first route matching r. Unset fields act as
+// wildcards. As with ip route del, a zero Scope matches any scope, since
+// the kernel only treats RT_SCOPE_NOWHERE as a wildcard.
+func (rl *RouteNLSocket) DelRoute(r *Route) error {
+	nr := *r
+	if nr.Scope == RT_SCOPE_UNIVERSE {
+		nr.Scope = RT_SCOPE_NOWHERE
+	}
+	_, err := rl.Execute(RTM_DELROUTE, 0, nr.toWireFormat())
+	return err
+}
+
+// LookupRoute asks the kernel which route, and which source address, it
+// would use for a packet matching q.
+func (rl *RouteNLSocket) LookupRoute(q *RouteQuery) (*Route, error) {
+	family, dst := ipFamily(q.Dst)
+
+	rtm := &RtMsg{
+		Family: family,
+		DstLen: uint8(len(dst) * 8),
+		Tos:    q.Tos,
+	}
+	if q.FibMatch {
+		rtm.Flags = RTM_F_FIB_MATCH
+	}
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(RTA_DST, dst),
+	}
+	if q.Src != nil {
+		rtm.SrcLen = rtm.DstLen
+		attrs = append(attrs, netlink.NewAttr(RTA_SRC, ipBytes(family, q.Src)))
+	}
+	if q.OutIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_OIF, uint32(q.OutIndex)))
+	}
+	if q.InIndex != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_IIF, uint32(q.InIndex)))
+	}
+	if q.Mark != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(RTA_MARK, q.Mark))
+	}
+
+	data := append(rtm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+
+	msgList, err := rl.Execute(RTM_GETROUTE, 0, data)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgList {
+		if msg.Header.Type == RTM_NEWROUTE {
+			return RoutefromWireFormat(msg.Data)
+		}
+	}
+
+	return nil, syscall.ENETUNREACH
+}
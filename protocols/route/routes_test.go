@@ -0,0 +1,299 @@
+package route
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+func mustCIDR(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func TestRtMsgWireFormat(t *testing.T) {
+	rtm := &RtMsg{Family: syscall.AF_INET, DstLen: 24, SrcLen: 8, Tos: 0x10, Table: RT_TABLE_MAIN,
+		Protocol: RTPROT_STATIC, Scope: RT_SCOPE_LINK, Type: RTN_UNICAST, Flags: RTM_F_CLONED}
+
+	b := rtm.toWireFormat()
+	if len(b) != SizeofRtMsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := RtMsgfromWireFormat(b); *got != *rtm {
+		t.Errorf("got %+v, want %+v", got, rtm)
+	}
+}
+
+func TestRouteWireFormat(t *testing.T) {
+	r := &Route{
+		Dst:      mustCIDR("10.1.0.0/16"),
+		Table:    1000,
+		Protocol: RTPROT_STATIC,
+		Gateway:  net.ParseIP("192.0.2.254"),
+		PrefSrc:  net.ParseIP("192.0.2.1"),
+		OutIndex: 3,
+		Priority: 20,
+		Mark:     7,
+		Metrics:  map[uint16]uint32{RTAX_MTU: 1400},
+	}
+
+	b := r.toWireFormat()
+
+	rtm := RtMsgfromWireFormat(b)
+	if rtm.Family != syscall.AF_INET || rtm.DstLen != 16 || rtm.Table != RT_TABLE_UNSPEC {
+		t.Errorf("rtmsg %+v", rtm)
+	}
+
+	got, err := RoutefromWireFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Dst.String() != "10.1.0.0/16" || got.Table != 1000 || got.Protocol != RTPROT_STATIC ||
+		!got.Gateway.Equal(r.Gateway) || !got.PrefSrc.Equal(r.PrefSrc) || got.OutIndex != 3 ||
+		got.Priority != 20 || got.Mark != 7 || got.Metrics[RTAX_MTU] != 1400 {
+		t.Errorf("got %+v", got)
+	}
+
+	/* tables below 256 fit in the header */
+	r = &Route{Dst: mustCIDR("2001:db8::/32"), Table: RT_TABLE_MAIN}
+	b = r.toWireFormat()
+	if rtm := RtMsgfromWireFormat(b); rtm.Family != syscall.AF_INET6 || rtm.Table != RT_TABLE_MAIN {
+		t.Errorf("rtmsg %+v", rtm)
+	}
+	attrs, _ := netlink.ParseNetlinkAttrs(b[SizeofRtMsg:])
+	if _, ok := findAttr(attrs, RTA_TABLE); ok {
+		t.Error("RTA_TABLE sent for the main table")
+	}
+}
+
+func TestRouteMultiPath(t *testing.T) {
+	r := &Route{
+		Dst: mustCIDR("10.0.0.0/8"),
+		MultiPath: []*NextHop{
+			{Index: 2, Gateway: net.ParseIP("192.0.2.1")},
+			{Index: 3, Gateway: net.ParseIP("192.0.2.2"), Weight: 3, Flags: RTNH_F_ONLINK},
+		},
+	}
+
+	got, err := RoutefromWireFormat(r.toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.MultiPath) != 2 {
+		t.Fatalf("got %d next hops", len(got.MultiPath))
+	}
+
+	nh := got.MultiPath[0]
+	if nh.Index != 2 || !nh.Gateway.Equal(net.ParseIP("192.0.2.1")) || nh.Weight != 1 {
+		t.Errorf("next hop 0: %+v", nh)
+	}
+	nh = got.MultiPath[1]
+	if nh.Index != 3 || !nh.Gateway.Equal(net.ParseIP("192.0.2.2")) || nh.Weight != 3 || nh.Flags != RTNH_F_ONLINK {
+		t.Errorf("next hop 1: %+v", nh)
+	}
+
+	/* rtnh_hops holds the weight minus one */
+	if b := r.MultiPath[1].toWireFormat(); b[3] != 2 || len(b) != SizeofRtNexthop+8 {
+		t.Errorf("rtnexthop % x", b)
+	}
+
+	if _, err := parseMultiPath([]byte{4, 0, 0, 0, 0, 0, 0, 0}); err == nil {
+		t.Error("rtnexthop shorter than its header accepted")
+	}
+}
+
+func TestRouteDefaults(t *testing.T) {
+	r := (&Route{Dst: mustCIDR("10.0.0.0/8")}).withDefaults()
+	if r.Protocol != RTPROT_BOOT || r.Type != RTN_UNICAST || r.Table != RT_TABLE_MAIN || r.Scope != RT_SCOPE_UNIVERSE {
+		t.Errorf("got %+v", r)
+	}
+
+	r = (&Route{Dst: mustCIDR("10.0.0.1/32"), Type: RTN_LOCAL, Table: RT_TABLE_LOCAL}).withDefaults()
+	if r.Scope != RT_SCOPE_HOST || r.Table != RT_TABLE_LOCAL {
+		t.Errorf("got %+v", r)
+	}
+
+	if (&Route{}).family() != syscall.AF_INET {
+		t.Error("route without addresses is not IPv4")
+	}
+	if (&Route{Gateway: net.ParseIP("fe80::1")}).family() != syscall.AF_INET6 {
+		t.Error("route via an IPv6 gateway is not IPv6")
+	}
+}
+
+// testRoutedLink sets up a veth pair, up, with 192.0.2.1/24 on veth0.
+func testRoutedLink(t *testing.T, rl *RouteNLSocket) *Link {
+	t.Helper()
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	veth := mustLink(t, rl, "veth0")
+	peer := mustLink(t, rl, "veth1")
+
+	for _, index := range []int32{veth.Index, peer.Index} {
+		err = rl.SetLinkUp(index)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = rl.AddAddr(&Address{Index: veth.Index, Local: net.ParseIP("192.0.2.1"), PrefixLen: 24})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return veth
+}
+
+func findRoute(routes []*Route, dst string) *Route {
+	for _, r := range routes {
+		if r.Dst != nil && r.Dst.String() == dst {
+			return r
+		}
+	}
+	return nil
+}
+
+func TestRoutes(t *testing.T) {
+	rl := testNetns(t)
+	veth := testRoutedLink(t, rl)
+
+	gw := net.ParseIP("192.0.2.254")
+	routes := []*Route{
+		{Dst: mustCIDR("10.1.0.0/16"), Gateway: gw, Protocol: RTPROT_STATIC},
+		{Dst: mustCIDR("10.2.0.0/16"), OutIndex: veth.Index, Scope: RT_SCOPE_LINK},
+		{Dst: mustCIDR("10.3.0.0/16"), Gateway: gw, Table: 1000, Metrics: map[uint16]uint32{RTAX_MTU: 1300}},
+		{Dst: mustCIDR("10.4.0.0/16"), MultiPath: []*NextHop{
+			{Index: veth.Index, Gateway: net.ParseIP("192.0.2.10")},
+			{Index: veth.Index, Gateway: net.ParseIP("192.0.2.11"), Weight: 2},
+		}},
+	}
+	for _, r := range routes {
+		err := rl.AddRoute(r)
+		if err != nil {
+			t.Fatalf("%s: %v", r.Dst, err)
+		}
+	}
+
+	err := rl.AddRoute(routes[0])
+	if err != syscall.EEXIST {
+		t.Errorf("adding %s again: %v", routes[0].Dst, err)
+	}
+
+	main, err := rl.ListRoutes(syscall.AF_INET, RT_TABLE_MAIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := findRoute(main, "10.1.0.0/16")
+	if r == nil || !r.Gateway.Equal(gw) || r.OutIndex != veth.Index || r.Protocol != RTPROT_STATIC || r.Table != RT_TABLE_MAIN {
+		t.Errorf("10.1.0.0/16: %+v", r)
+	}
+	r = findRoute(main, "10.2.0.0/16")
+	if r == nil || r.Scope != RT_SCOPE_LINK || r.Gateway != nil {
+		t.Errorf("10.2.0.0/16: %+v", r)
+	}
+	r = findRoute(main, "10.4.0.0/16")
+	if r == nil || len(r.MultiPath) != 2 || r.MultiPath[1].Weight != 2 {
+		t.Errorf("10.4.0.0/16: %+v", r)
+	}
+	if findRoute(main, "10.3.0.0/16") != nil {
+		t.Error("route of table 1000 listed in the main table")
+	}
+
+	other, err := rl.ListRoutes(syscall.AF_INET, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(other) != 1 || other[0].Table != 1000 || other[0].Metrics[RTAX_MTU] != 1300 {
+		t.Errorf("table 1000: %+v", other)
+	}
+
+	lr, err := rl.LookupRoute(&RouteQuery{Dst: net.ParseIP("10.1.2.3")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lr.Gateway.Equal(gw) || lr.OutIndex != veth.Index || !lr.PrefSrc.Equal(net.ParseIP("192.0.2.1")) {
+		t.Errorf("lookup of 10.1.2.3: %+v", lr)
+	}
+	lr, err = rl.LookupRoute(&RouteQuery{Dst: net.ParseIP("10.1.2.3"), FibMatch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lr.Dst == nil || lr.Dst.String() != "10.1.0.0/16" {
+		t.Errorf("fib match of 10.1.2.3: %+v", lr)
+	}
+	_, err = rl.LookupRoute(&RouteQuery{Dst: net.ParseIP("198.51.100.1")})
+	if err != syscall.ENETUNREACH {
+		t.Errorf("lookup without a route: %v", err)
+	}
+
+	err = rl.ReplaceRoute(&Route{Dst: mustCIDR("10.1.0.0/16"), Gateway: net.ParseIP("192.0.2.253"), Protocol: RTPROT_STATIC})
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, _ = rl.ListRoutes(syscall.AF_INET, RT_TABLE_MAIN)
+	if r := findRoute(main, "10.1.0.0/16"); r == nil || !r.Gateway.Equal(net.ParseIP("192.0.2.253")) {
+		t.Errorf("replaced 10.1.0.0/16: %+v", r)
+	}
+
+	/* a zero scope deletes routes of any scope */
+	err = rl.DelRoute(&Route{Dst: mustCIDR("10.2.0.0/16")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.DelRoute(&Route{Dst: mustCIDR("10.3.0.0/16"), Table: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	main, _ = rl.ListRoutes(syscall.AF_INET, RT_TABLE_UNSPEC)
+	if findRoute(main, "10.2.0.0/16") != nil || findRoute(main, "10.3.0.0/16") != nil {
+		t.Error("deleted routes still listed")
+	}
+	err = rl.DelRoute(&Route{Dst: mustCIDR("10.2.0.0/16")})
+	if err != syscall.ESRCH {
+		t.Errorf("deleting 10.2.0.0/16 again: %v", err)
+	}
+
+	/* the dumps leave strict checking as it was */
+	strict, err := rl.StrictCheck()
+	if err == nil && strict {
+		t.Error("strict checking left on")
+	}
+}
+
+func TestAppendRoute(t *testing.T) {
+	rl := testNetns(t)
+	veth := testRoutedLink(t, rl)
+
+	err := rl.AddAddr(&Address{Index: veth.Index, Local: net.ParseIP("2001:db8::1"), PrefixLen: 64, Flags: IFA_F_NODAD})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := mustCIDR("2001:db8:1::/48")
+	err = rl.AddRoute(&Route{Dst: dst, Gateway: net.ParseIP("2001:db8::a"), OutIndex: veth.Index})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AppendRoute(&Route{Dst: dst, Gateway: net.ParseIP("2001:db8::b"), OutIndex: veth.Index})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	routes, err := rl.ListRoutes(syscall.AF_INET6, RT_TABLE_MAIN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := findRoute(routes, dst.String())
+	if r == nil || len(r.MultiPath) != 2 {
+		t.Errorf("%s: %+v", dst, r)
+	}
+}
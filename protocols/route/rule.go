@@ -0,0 +1,309 @@
+package route
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const SizeofFibRuleHdr = 12
+
+type FibRuleHdr struct {
+	Family uint8
+	DstLen uint8
+	SrcLen uint8
+	Tos    uint8
+	Table  uint8
+	Action uint8 /* FR_ACT_* */
+	Flags  uint32
+}
+
+type RuleUidRange struct {
+	Start uint32
+	End   uint32
+}
+
+type RulePortRange struct {
+	Start uint16
+	End   uint16
+}
+
+// Rule is a policy routing rule. A zero Priority lets the kernel choose one
+// when the rule is added. HasSuppressPrefixLen tells whether
+// SuppressPrefixLen is set, since 0 is a meaningful value.
+type Rule struct {
+	Family               uint8
+	Priority             uint32
+	Src                  *net.IPNet
+	Dst                  *net.IPNet
+	Tos                  uint8
+	Table                uint32
+	Action               uint8
+	Flags                uint32 /* FIB_RULE_* */
+	Mark                 uint32
+	Mask                 uint32
+	IifName              string
+	OifName              string
+	Goto                 uint32
+	SuppressPrefixLen    uint32
+	HasSuppressPrefixLen bool
+	L3mdev               bool
+	UidRange             *RuleUidRange
+	IPProto              uint8
+	SportRange           *RulePortRange
+	DportRange           *RulePortRange
+	Protocol             uint8 /* RTPROT_* */
+	Attrs                []netlink.NetlinkAttr
+}
+
+func FibRuleHdrfromWireFormat(data []byte) *FibRuleHdr {
+	return &FibRuleHdr{
+		Family: data[0],
+		DstLen: data[1],
+		SrcLen: data[2],
+		Tos:    data[3],
+		Table:  data[4],
+		Action: data[7],
+		Flags:  *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+	}
+}
+
+func (frh *FibRuleHdr) toWireFormat() []byte {
+	b := make([]byte, SizeofFibRuleHdr)
+	b[0] = frh.Family
+	b[1] = frh.DstLen
+	b[2] = frh.SrcLen
+	b[3] = frh.Tos
+	b[4] = frh.Table
+	b[7] = frh.Action
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = frh.Flags
+	return b
+}
+
+func RulefromWireFormat(data []byte) (*Rule, error) {
+	if len(data) < SizeofFibRuleHdr {
+		return nil, errors.New("short fib_rule_hdr")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofFibRuleHdr:])
+	if err != nil {
+		return nil, err
+	}
+
+	frh := FibRuleHdrfromWireFormat(data)
+	r := &Rule{
+		Family: frh.Family,
+		Tos:    frh.Tos,
+		Table:  uint32(frh.Table),
+		Action: frh.Action,
+		Flags:  frh.Flags,
+		Attrs:  attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case FRA_PRIORITY:
+			r.Priority = attr.Uint32()
+		case FRA_SRC:
+			r.Src = ipNet(attr.Data, frh.SrcLen)
+		case FRA_DST:
+			r.Dst = ipNet(attr.Data, frh.DstLen)
+		case FRA_TABLE:
+			r.Table = attr.Uint32()
+		case FRA_FWMARK:
+			r.Mark = attr.Uint32()
+		case FRA_FWMASK:
+			r.Mask = attr.Uint32()
+		case FRA_IIFNAME:
+			r.IifName = attr.String()
+		case FRA_OIFNAME:
+			r.OifName = attr.String()
+		case FRA_GOTO:
+			r.Goto = attr.Uint32()
+		case FRA_SUPPRESS_PREFIXLEN:
+			/* the kernel reports an unset value as -1 */
+			if attr.Uint32() != 0xffffffff {
+				r.SuppressPrefixLen = attr.Uint32()
+				r.HasSuppressPrefixLen = true
+			}
+		case FRA_L3MDEV:
+			r.L3mdev = attr.Uint8() != 0
+		case FRA_UID_RANGE:
+			if len(attr.Data) >= 8 {
+				r.UidRange = &RuleUidRange{
+					Start: *(*uint32)(unsafe.Pointer(&attr.Data[0:4][0])),
+					End:   *(*uint32)(unsafe.Pointer(&attr.Data[4:8][0])),
+				}
+			}
+		case FRA_IP_PROTO:
+			r.IPProto = attr.Uint8()
+		case FRA_SPORT_RANGE:
+			r.SportRange = portRangefromWireFormat(attr.Data)
+		case FRA_DPORT_RANGE:
+			r.DportRange = portRangefromWireFormat(attr.Data)
+		case FRA_PROTOCOL:
+			r.Protocol = attr.Uint8()
+		}
+	}
+
+	return r, nil
+}
+
+func portRangefromWireFormat(data []byte) *RulePortRange {
+	if len(data) < 4 {
+		return nil
+	}
+	return &RulePortRange{
+		Start: *(*uint16)(unsafe.Pointer(&data[0:2][0])),
+		End:   *(*uint16)(unsafe.Pointer(&data[2:4][0])),
+	}
+}
+
+func (pr *RulePortRange) toWireFormat() []byte {
+	b := make([]byte, 4)
+	*(*uint16)(unsafe.Pointer(&b[0:2][0])) = pr.Start
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = pr.End
+	return b
+}
+
+func (r *Rule) family() uint8 {
+	if r.Family != syscall.AF_UNSPEC {
+		return r.Family
+	}
+	for _, n := range []*net.IPNet{r.Src, r.Dst} {
+		if n != nil {
+			f, _ := ipFamily(n.IP)
+			return f
+		}
+	}
+	return syscall.AF_INET
+}
+
+func (r *Rule) toWireFormat() []byte {
+	family := r.family()
+
+	frh := &FibRuleHdr{
+		Family: family,
+		Tos:    r.Tos,
+		Action: r.Action,
+		Flags:  r.Flags,
+	}
+
+	attrs := []netlink.NetlinkAttr{}
+
+	if r.Table < 256 {
+		frh.Table = uint8(r.Table)
+	} else {
+		attrs = append(attrs, netlink.NewAttrUint32(FRA_TABLE, r.Table))
+	}
+	if r.Priority != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(FRA_PRIORITY, r.Priority))
+	}
+	if r.Src != nil {
+		plen, _ := r.Src.Mask.Size()
+		frh.SrcLen = uint8(plen)
+		attrs = append(attrs, netlink.NewAttr(FRA_SRC, ipBytes(family, r.Src.IP)))
+	}
+	if r.Dst != nil {
+		plen, _ := r.Dst.Mask.Size()
+		frh.DstLen = uint8(plen)
+		attrs = append(attrs, netlink.NewAttr(FRA_DST, ipBytes(family, r.Dst.IP)))
+	}
+	if r.Mark != 0 || r.Mask != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(FRA_FWMARK, r.Mark))
+	}
+	if r.Mask != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(FRA_FWMASK, r.Mask))
+	}
+	if r.IifName != "" {
+		attrs = append(attrs, netlink.NewAttrString(FRA_IIFNAME, r.IifName))
+	}
+	if r.OifName != "" {
+		attrs = append(attrs, netlink.NewAttrString(FRA_OIFNAME, r.OifName))
+	}
+	if r.Goto != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(FRA_GOTO, r.Goto))
+	}
+	if r.HasSuppressPrefixLen {
+		attrs = append(attrs, netlink.NewAttrUint32(FRA_SUPPRESS_PREFIXLEN, r.SuppressPrefixLen))
+	}
+	if r.L3mdev {
+		attrs = append(attrs, netlink.NewAttrUint8(FRA_L3MDEV, 1))
+	}
+	if r.UidRange != nil {
+		b := make([]byte, 8)
+		*(*uint32)(unsafe.Pointer(&b[0:4][0])) = r.UidRange.Start
+		*(*uint32)(unsafe.Pointer(&b[4:8][0])) = r.UidRange.End
+		attrs = append(attrs, netlink.NewAttr(FRA_UID_RANGE, b))
+	}
+	if r.IPProto != 0 {
+		attrs = append(attrs, netlink.NewAttrUint8(FRA_IP_PROTO, r.IPProto))
+	}
+	if r.SportRange != nil {
+		attrs = append(attrs, netlink.NewAttr(FRA_SPORT_RANGE, r.SportRange.toWireFormat()))
+	}
+	if r.DportRange != nil {
+		attrs = append(attrs, netlink.NewAttr(FRA_DPORT_RANGE, r.DportRange.toWireFormat()))
+	}
+	if r.Protocol != 0 {
+		attrs = append(attrs, netlink.NewAttrUint8(FRA_PROTOCOL, r.Protocol))
+	}
+
+	return append(frh.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+}
+
+// withDefaults picks the action implied by the rule when none is given.
+func (r *Rule) withDefaults() *Rule {
+	nr := *r
+	if nr.Action == FR_ACT_UNSPEC {
+		if nr.Goto != 0 {
+			nr.Action = FR_ACT_GOTO
+		} else {
+			nr.Action = FR_ACT_TO_TBL
+		}
+	}
+	if nr.Action == FR_ACT_TO_TBL && nr.Table == RT_TABLE_UNSPEC && !nr.L3mdev {
+		nr.Table = RT_TABLE_MAIN
+	}
+	return &nr
+}
+
+// ListRules dumps the policy routing rules of the given family (AF_UNSPEC
+// for both IPv4 and IPv6).
+func (rl *RouteNLSocket) ListRules(family uint8) ([]*Rule, error) {
+	frh := &FibRuleHdr{Family: family}
+
+	msgList, err := rl.Execute(RTM_GETRULE, syscall.NLM_F_DUMP, frh.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Rule{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWRULE {
+			continue
+		}
+		r, err := RulefromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddRule(r *Rule) error {
+	_, err := rl.Execute(RTM_NEWRULE, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, r.withDefaults().toWireFormat())
+	return err
+}
+
+// DelRule deletes the first rule matching r. Unset fields act as wildcards.
+func (rl *RouteNLSocket) DelRule(r *Rule) error {
+	_, err := rl.Execute(RTM_DELRULE, 0, r.toWireFormat())
+	return err
+}
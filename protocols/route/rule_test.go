@@ -0,0 +1,179 @@
+package route
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestFibRuleHdrWireFormat(t *testing.T) {
+	frh := &FibRuleHdr{Family: syscall.AF_INET6, DstLen: 64, SrcLen: 48, Tos: 0x10, Table: 100,
+		Action: FR_ACT_TO_TBL, Flags: FIB_RULE_INVERT}
+
+	b := frh.toWireFormat()
+	if len(b) != SizeofFibRuleHdr {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := FibRuleHdrfromWireFormat(b); *got != *frh {
+		t.Errorf("got %+v, want %+v", got, frh)
+	}
+}
+
+func TestRuleWireFormat(t *testing.T) {
+	r := &Rule{
+		Priority:             100,
+		Src:                  mustCIDR("10.0.0.0/8"),
+		Dst:                  mustCIDR("192.0.2.0/24"),
+		Table:                1000,
+		Action:               FR_ACT_TO_TBL,
+		Flags:                FIB_RULE_INVERT,
+		Mark:                 0x10,
+		Mask:                 0xf0,
+		IifName:              "eth0",
+		OifName:              "eth1",
+		SuppressPrefixLen:    0,
+		HasSuppressPrefixLen: true,
+		UidRange:             &RuleUidRange{Start: 1000, End: 1999},
+		IPProto:              syscall.IPPROTO_TCP,
+		SportRange:           &RulePortRange{Start: 1024, End: 2048},
+		DportRange:           &RulePortRange{Start: 80, End: 80},
+		Protocol:             RTPROT_STATIC,
+	}
+
+	b := r.toWireFormat()
+
+	/* tables above 255 only fit in FRA_TABLE */
+	frh := FibRuleHdrfromWireFormat(b)
+	if frh.Family != syscall.AF_INET || frh.SrcLen != 8 || frh.DstLen != 24 || frh.Table != RT_TABLE_UNSPEC {
+		t.Errorf("fib_rule_hdr %+v", frh)
+	}
+
+	got, err := RulefromWireFormat(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Priority != 100 || got.Src.String() != "10.0.0.0/8" || got.Dst.String() != "192.0.2.0/24" ||
+		got.Table != 1000 || got.Action != FR_ACT_TO_TBL || got.Flags != FIB_RULE_INVERT || got.Mark != 0x10 ||
+		got.Mask != 0xf0 || got.IifName != "eth0" || got.OifName != "eth1" || !got.HasSuppressPrefixLen ||
+		got.SuppressPrefixLen != 0 || got.IPProto != syscall.IPPROTO_TCP || got.Protocol != RTPROT_STATIC {
+		t.Errorf("got %+v", got)
+	}
+	if got.UidRange == nil || *got.UidRange != *r.UidRange {
+		t.Errorf("uid range %+v", got.UidRange)
+	}
+	if got.SportRange == nil || *got.SportRange != *r.SportRange || got.DportRange == nil || *got.DportRange != *r.DportRange {
+		t.Errorf("port ranges %+v %+v", got.SportRange, got.DportRange)
+	}
+
+	/* a mask alone still sends the mark it applies to */
+	got, _ = RulefromWireFormat((&Rule{Mask: 0xff}).toWireFormat())
+	if _, ok := findAttr(got.Attrs, FRA_FWMARK); !ok || got.Mask != 0xff {
+		t.Errorf("got %+v", got)
+	}
+
+	if _, err := RulefromWireFormat(make([]byte, SizeofFibRuleHdr-1)); err == nil {
+		t.Error("short fib_rule_hdr accepted")
+	}
+}
+
+func TestRuleDefaults(t *testing.T) {
+	tests := []struct {
+		rule   Rule
+		action uint8
+		table  uint32
+	}{
+		{Rule{}, FR_ACT_TO_TBL, RT_TABLE_MAIN},
+		{Rule{Table: 100}, FR_ACT_TO_TBL, 100},
+		{Rule{Goto: 200}, FR_ACT_GOTO, RT_TABLE_UNSPEC},
+		{Rule{L3mdev: true}, FR_ACT_TO_TBL, RT_TABLE_UNSPEC},
+		{Rule{Action: FR_ACT_BLACKHOLE}, FR_ACT_BLACKHOLE, RT_TABLE_UNSPEC},
+	}
+
+	for _, test := range tests {
+		r := test.rule.withDefaults()
+		if r.Action != test.action || r.Table != test.table {
+			t.Errorf("%+v: action %d table %d", test.rule, r.Action, r.Table)
+		}
+	}
+}
+
+func findRule(rules []*Rule, priority uint32) *Rule {
+	for _, r := range rules {
+		if r.Priority == priority {
+			return r
+		}
+	}
+	return nil
+}
+
+func TestRules(t *testing.T) {
+	rl := testNetns(t)
+
+	rules, err := rl.ListRules(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := findRule(rules, 32766); r == nil || r.Table != RT_TABLE_MAIN {
+		t.Errorf("default rules: %+v", rules)
+	}
+
+	added := []*Rule{
+		{Priority: 100, Src: mustCIDR("10.0.0.0/8"), Table: 1000},
+		{Priority: 101, Mark: 0x1, Mask: 0xff, Table: 200, IifName: "lo"},
+		{Priority: 102, Dst: mustCIDR("2001:db8::/32"), Action: FR_ACT_UNREACHABLE},
+		{Priority: 103, Goto: 32766},
+	}
+	for _, r := range added {
+		err := rl.AddRule(r)
+		if err != nil {
+			t.Fatalf("rule %d: %v", r.Priority, err)
+		}
+	}
+
+	err = rl.AddRule(added[0])
+	if err != syscall.EEXIST {
+		t.Errorf("adding rule %d again: %v", added[0].Priority, err)
+	}
+
+	rules, err = rl.ListRules(syscall.AF_INET)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := findRule(rules, 100)
+	if r == nil || r.Src.String() != "10.0.0.0/8" || r.Table != 1000 || r.Action != FR_ACT_TO_TBL {
+		t.Errorf("rule 100: %+v", r)
+	}
+	r = findRule(rules, 101)
+	if r == nil || r.Mark != 0x1 || r.Mask != 0xff || r.IifName != "lo" || r.Table != 200 {
+		t.Errorf("rule 101: %+v", r)
+	}
+	r = findRule(rules, 103)
+	if r == nil || r.Action != FR_ACT_GOTO || r.Goto != 32766 {
+		t.Errorf("rule 103: %+v", r)
+	}
+	if findRule(rules, 102) != nil {
+		t.Error("IPv6 rule listed with the IPv4 ones")
+	}
+
+	rules, err = rl.ListRules(syscall.AF_INET6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = findRule(rules, 102)
+	if r == nil || r.Family != syscall.AF_INET6 || r.Dst.String() != "2001:db8::/32" || r.Action != FR_ACT_UNREACHABLE {
+		t.Errorf("rule 102: %+v", r)
+	}
+
+	/* unset fields are wildcards */
+	err = rl.DelRule(&Rule{Priority: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, _ = rl.ListRules(syscall.AF_INET)
+	if findRule(rules, 100) != nil {
+		t.Error("deleted rule still listed")
+	}
+	err = rl.DelRule(&Rule{Priority: 100})
+	if err != syscall.ENOENT {
+		t.Errorf("deleting rule 100 again: %v", err)
+	}
+}
@@ -0,0 +1,488 @@
+package route
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofTcMsg              = 20
+	SizeofTcRateSpec         = 12
+	SizeofGnetStatsBasic     = 16
+	SizeofGnetStatsRateEst   = 8
+	SizeofGnetStatsQueue     = 20
+	SizeofGnetStatsRateEst64 = 16
+)
+
+type TcMsg struct {
+	Family uint8
+	Index  int32
+	Handle uint32
+	Parent uint32
+	Info   uint32
+}
+
+// TcRateSpec is the kernel tc_ratespec. Rate is in bytes per second.
+type TcRateSpec struct {
+	CellLog   uint8
+	Linklayer uint8 /* TC_LINKLAYER_* */
+	Overhead  uint16
+	CellAlign int16
+	Mpu       uint16
+	Rate      uint32
+}
+
+// TcStats holds the statistics of a qdisc, class or action from TCA_STATS2.
+type TcStats struct {
+	Bytes      uint64
+	Packets    uint64
+	Bps        uint64
+	Pps        uint64
+	Qlen       uint32
+	Backlog    uint32
+	Drops      uint32
+	Requeues   uint32
+	Overlimits uint32
+}
+
+// TcInfo is implemented by the kind specific options of qdiscs, classes
+// and filters, carried in TCA_OPTIONS.
+type TcInfo interface {
+	Kind() string
+	Options() []byte
+	ParseOptions(data []byte) error
+}
+
+// GenericTcInfo keeps the raw TCA_OPTIONS of kinds without typed support.
+type GenericTcInfo struct {
+	KindName string
+	Data     []byte
+}
+
+// Qdisc is a queueing discipline. Handle and Parent are tc handles, see
+// MakeHandle; the root qdisc has TC_H_ROOT as parent.
+type Qdisc struct {
+	Index  int32
+	Handle uint32
+	Parent uint32
+	Info   TcInfo
+	Stats  *TcStats
+	XStats []byte
+	Attrs  []netlink.NetlinkAttr
+}
+
+// TcClass is a class of a classful qdisc.
+type TcClass struct {
+	Index  int32
+	Handle uint32
+	Parent uint32
+	Info   TcInfo
+	Stats  *TcStats
+	XStats []byte
+	Attrs  []netlink.NetlinkAttr
+}
+
+var qdiscKinds = map[string]func() TcInfo{
+	"pfifo":           func() TcInfo { return &Fifo{KindName: "pfifo"} },
+	"bfifo":           func() TcInfo { return &Fifo{KindName: "bfifo"} },
+	"pfifo_head_drop": func() TcInfo { return &Fifo{KindName: "pfifo_head_drop"} },
+	"pfifo_fast":      func() TcInfo { return &PfifoFast{} },
+	"prio":            func() TcInfo { return &Prio{} },
+	"fq_codel":        func() TcInfo { return &FqCodel{} },
+	"fq":              func() TcInfo { return &Fq{} },
+	"tbf":             func() TcInfo { return &Tbf{} },
+	"htb":             func() TcInfo { return &Htb{} },
+	"netem":           func() TcInfo { return &Netem{} },
+	"clsact":          func() TcInfo { return &Clsact{} },
+	"ingress":         func() TcInfo { return &Ingress{} },
+}
+
+var classKinds = map[string]func() TcInfo{
+	"htb": func() TcInfo { return &HtbClass{} },
+}
+
+func MakeHandle(major, minor uint16) uint32 {
+	return uint32(major)<<16 | uint32(minor)
+}
+
+func HandleMajor(handle uint32) uint16 {
+	return uint16(handle >> 16)
+}
+
+func HandleMinor(handle uint32) uint16 {
+	return uint16(handle)
+}
+
+func TcMsgfromWireFormat(data []byte) *TcMsg {
+	return &TcMsg{
+		Family: data[0],
+		Index:  *(*int32)(unsafe.Pointer(&data[4:8][0])),
+		Handle: *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+		Parent: *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+		Info:   *(*uint32)(unsafe.Pointer(&data[16:20][0])),
+	}
+}
+
+func (tcm *TcMsg) toWireFormat() []byte {
+	b := make([]byte, SizeofTcMsg)
+	b[0] = tcm.Family
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = tcm.Index
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = tcm.Handle
+	*(*uint32)(unsafe.Pointer(&b[12:16][0])) = tcm.Parent
+	*(*uint32)(unsafe.Pointer(&b[16:20][0])) = tcm.Info
+	return b
+}
+
+func TcRateSpecfromWireFormat(data []byte) *TcRateSpec {
+	return &TcRateSpec{
+		CellLog:   data[0],
+		Linklayer: data[1],
+		Overhead:  *(*uint16)(unsafe.Pointer(&data[2:4][0])),
+		CellAlign: *(*int16)(unsafe.Pointer(&data[4:6][0])),
+		Mpu:       *(*uint16)(unsafe.Pointer(&data[6:8][0])),
+		Rate:      *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+	}
+}
+
+func (rs *TcRateSpec) toWireFormat() []byte {
+	b := make([]byte, SizeofTcRateSpec)
+	b[0] = rs.CellLog
+	b[1] = rs.Linklayer
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = rs.Overhead
+	*(*int16)(unsafe.Pointer(&b[4:6][0])) = rs.CellAlign
+	*(*uint16)(unsafe.Pointer(&b[6:8][0])) = rs.Mpu
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = rs.Rate
+	return b
+}
+
+// rateSpec returns the ratespec for rate, saturated to 32 bits as the
+// kernel wants the full value in a separate 64 bit attribute. The link
+// layer is set so that no rate table is needed.
+func rateSpec(rate uint64) *TcRateSpec {
+	rs := &TcRateSpec{Linklayer: TC_LINKLAYER_ETHERNET, Rate: 0xffffffff}
+	if rate < 0xffffffff {
+		rs.Rate = uint32(rate)
+	}
+	return rs
+}
+
+/* the kernel packet scheduler clock ticks every 64 nanoseconds */
+const pschedShift = 6
+
+// xmitTicks returns the scheduler ticks needed to send size bytes at rate.
+func xmitTicks(rate uint64, size uint32) uint32 {
+	if rate == 0 {
+		return 0
+	}
+	return uint32(uint64(size) * 1000000000 / rate >> pschedShift)
+}
+
+// xmitSize is the inverse of xmitTicks.
+func xmitSize(rate uint64, ticks uint32) uint32 {
+	return uint32(rate * (uint64(ticks) << pschedShift) / 1000000000)
+}
+
+func TcStatsfromAttrs(attrs []netlink.NetlinkAttr) *TcStats {
+	st := &TcStats{}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_STATS_BASIC:
+			if len(attr.Data) >= 12 {
+				st.Bytes = *(*uint64)(unsafe.Pointer(&attr.Data[0:8][0]))
+				if st.Packets == 0 {
+					st.Packets = uint64(*(*uint32)(unsafe.Pointer(&attr.Data[8:12][0])))
+				}
+			}
+		case TCA_STATS_PKT64:
+			st.Packets = attr.Uint64()
+		case TCA_STATS_RATE_EST:
+			if len(attr.Data) >= SizeofGnetStatsRateEst && st.Bps == 0 {
+				st.Bps = uint64(*(*uint32)(unsafe.Pointer(&attr.Data[0:4][0])))
+				st.Pps = uint64(*(*uint32)(unsafe.Pointer(&attr.Data[4:8][0])))
+			}
+		case TCA_STATS_RATE_EST64:
+			if len(attr.Data) >= SizeofGnetStatsRateEst64 {
+				st.Bps = *(*uint64)(unsafe.Pointer(&attr.Data[0:8][0]))
+				st.Pps = *(*uint64)(unsafe.Pointer(&attr.Data[8:16][0]))
+			}
+		case TCA_STATS_QUEUE:
+			if len(attr.Data) >= SizeofGnetStatsQueue {
+				st.Qlen = *(*uint32)(unsafe.Pointer(&attr.Data[0:4][0]))
+				st.Backlog = *(*uint32)(unsafe.Pointer(&attr.Data[4:8][0]))
+				st.Drops = *(*uint32)(unsafe.Pointer(&attr.Data[8:12][0]))
+				st.Requeues = *(*uint32)(unsafe.Pointer(&attr.Data[12:16][0]))
+				st.Overlimits = *(*uint32)(unsafe.Pointer(&attr.Data[16:20][0]))
+			}
+		}
+	}
+	return st
+}
+
+func (info *GenericTcInfo) Kind() string {
+	return info.KindName
+}
+
+func (info *GenericTcInfo) Options() []byte {
+	return info.Data
+}
+
+func (info *GenericTcInfo) ParseOptions(data []byte) error {
+	info.Data = data
+	return nil
+}
+
+// tcObject is the part common to qdiscs, classes and filters on the wire.
+type tcObject struct {
+	tcm    *TcMsg
+	kind   string
+	opts   []byte
+	stats  *TcStats
+	xstats []byte
+	attrs  []netlink.NetlinkAttr
+}
+
+func tcObjectfromWireFormat(data []byte) (*tcObject, error) {
+	if len(data) < SizeofTcMsg {
+		return nil, errors.New("short tcmsg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofTcMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	o := &tcObject{
+		tcm:   TcMsgfromWireFormat(data),
+		attrs: attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_KIND:
+			o.kind = attr.String()
+		case TCA_OPTIONS:
+			o.opts = attr.Data
+		case TCA_XSTATS:
+			o.xstats = attr.Data
+		case TCA_STATS2:
+			sattrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			o.stats = TcStatsfromAttrs(sattrs)
+		}
+	}
+
+	return o, nil
+}
+
+func (o *tcObject) info(kinds map[string]func() TcInfo) (TcInfo, error) {
+	if o.kind == "" {
+		return nil, nil
+	}
+
+	newInfo, ok := kinds[o.kind]
+	if !ok {
+		return &GenericTcInfo{KindName: o.kind, Data: o.opts}, nil
+	}
+
+	info := newInfo()
+	err := info.ParseOptions(o.opts)
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func tcInfoAttrs(info TcInfo) []netlink.NetlinkAttr {
+	if info == nil {
+		return nil
+	}
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrString(TCA_KIND, info.Kind()),
+	}
+	if opts := info.Options(); opts != nil {
+		attrs = append(attrs, netlink.NewAttr(TCA_OPTIONS, opts))
+	}
+	return attrs
+}
+
+func QdiscfromWireFormat(data []byte) (*Qdisc, error) {
+	o, err := tcObjectfromWireFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := o.info(qdiscKinds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Qdisc{
+		Index:  o.tcm.Index,
+		Handle: o.tcm.Handle,
+		Parent: o.tcm.Parent,
+		Info:   info,
+		Stats:  o.stats,
+		XStats: o.xstats,
+		Attrs:  o.attrs,
+	}, nil
+}
+
+// withDefaults places ingress and clsact qdiscs where the kernel expects
+// them.
+func (q *Qdisc) withDefaults() *Qdisc {
+	nq := *q
+	switch nq.Info.(type) {
+	case *Clsact, *Ingress:
+		if nq.Parent == TC_H_UNSPEC {
+			nq.Parent = TC_H_CLSACT
+		}
+		if nq.Handle == TC_H_UNSPEC {
+			nq.Handle = MakeHandle(0xffff, 0)
+		}
+	default:
+		if nq.Parent == TC_H_UNSPEC {
+			nq.Parent = TC_H_ROOT
+		}
+	}
+	return &nq
+}
+
+func (q *Qdisc) toWireFormat() []byte {
+	tcm := &TcMsg{
+		Family: syscall.AF_UNSPEC,
+		Index:  q.Index,
+		Handle: q.Handle,
+		Parent: q.Parent,
+	}
+	return append(tcm.toWireFormat(), netlink.AttrsToWireFormat(tcInfoAttrs(q.Info))...)
+}
+
+func TcClassfromWireFormat(data []byte) (*TcClass, error) {
+	o, err := tcObjectfromWireFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := o.info(classKinds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TcClass{
+		Index:  o.tcm.Index,
+		Handle: o.tcm.Handle,
+		Parent: o.tcm.Parent,
+		Info:   info,
+		Stats:  o.stats,
+		XStats: o.xstats,
+		Attrs:  o.attrs,
+	}, nil
+}
+
+func (c *TcClass) toWireFormat() []byte {
+	tcm := &TcMsg{
+		Family: syscall.AF_UNSPEC,
+		Index:  c.Index,
+		Handle: c.Handle,
+		Parent: c.Parent,
+	}
+	return append(tcm.toWireFormat(), netlink.AttrsToWireFormat(tcInfoAttrs(c.Info))...)
+}
+
+// ListQdiscs dumps the qdiscs of the given link (0 for all links).
+func (rl *RouteNLSocket) ListQdiscs(index int32) ([]*Qdisc, error) {
+	tcm := &TcMsg{Index: index}
+
+	msgList, err := rl.Execute(RTM_GETQDISC, syscall.NLM_F_DUMP, tcm.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Qdisc{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWQDISC {
+			continue
+		}
+		q, err := QdiscfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if index != 0 && q.Index != index {
+			continue
+		}
+		ret = append(ret, q)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddQdisc(q *Qdisc) error {
+	_, err := rl.Execute(RTM_NEWQDISC, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, q.withDefaults().toWireFormat())
+	return err
+}
+
+// ReplaceQdisc creates the qdisc or replaces the one at the same parent.
+func (rl *RouteNLSocket) ReplaceQdisc(q *Qdisc) error {
+	_, err := rl.Execute(RTM_NEWQDISC, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, q.withDefaults().toWireFormat())
+	return err
+}
+
+// ChangeQdisc changes the options of an existing qdisc in place.
+func (rl *RouteNLSocket) ChangeQdisc(q *Qdisc) error {
+	_, err := rl.Execute(RTM_NEWQDISC, 0, q.withDefaults().toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) DelQdisc(q *Qdisc) error {
+	_, err := rl.Execute(RTM_DELQDISC, 0, q.withDefaults().toWireFormat())
+	return err
+}
+
+// ListClasses dumps the classes of the given link.
+func (rl *RouteNLSocket) ListClasses(index int32) ([]*TcClass, error) {
+	tcm := &TcMsg{Index: index}
+
+	msgList, err := rl.Execute(RTM_GETTCLASS, syscall.NLM_F_DUMP, tcm.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*TcClass{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWTCLASS {
+			continue
+		}
+		c, err := TcClassfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if index != 0 && c.Index != index {
+			continue
+		}
+		ret = append(ret, c)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddClass(c *TcClass) error {
+	_, err := rl.Execute(RTM_NEWTCLASS, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, c.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) ReplaceClass(c *TcClass) error {
+	_, err := rl.Execute(RTM_NEWTCLASS, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, c.toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) DelClass(c *TcClass) error {
+	_, err := rl.Execute(RTM_DELTCLASS, 0, c.toWireFormat())
+	return err
+}
@@ -0,0 +1,559 @@
+package route
+
+import (
+	"encoding/binary"
+	"errors"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofTcGen       = 20
+	SizeofTcMirred    = 28
+	SizeofTcPolice    = 56
+	SizeofTcVlan      = 24
+	SizeofTcPeditSel  = 24
+	SizeofTcPeditKey  = 24
+	SizeofTcRateTable = 1024
+)
+
+// TcGen holds the parameters common to all actions. Index identifies the
+// action instance, 0 to create a new one, and Action is the TC_ACT_*
+// verdict given once the action is done.
+type TcGen struct {
+	Index   uint32
+	Capab   uint32
+	Action  int32
+	Refcnt  int32
+	Bindcnt int32
+}
+
+// TcAction is an action attached to a filter. Info is one of the typed
+// actions below, or GenericTcInfo for the unknown ones.
+type TcAction struct {
+	Info  TcInfo
+	Stats *TcStats
+}
+
+// Gact is the generic action, giving a fixed verdict such as TC_ACT_SHOT
+// or TC_ACT_OK.
+type Gact struct {
+	TcGen
+}
+
+// Mirred mirrors or redirects packets to another link. Eaction is one of
+// TCA_EGRESS_REDIR, TCA_EGRESS_MIRROR, TCA_INGRESS_REDIR or
+// TCA_INGRESS_MIRROR. A TC_ACT_OK verdict is taken as the tc default,
+// TC_ACT_STOLEN for redirects and TC_ACT_PIPE for mirrors.
+type Mirred struct {
+	TcGen
+	Eaction int32
+	Ifindex uint32
+}
+
+// Police rate limits packets. Rates are in bytes per second and Burst and
+// Mtu in bytes. ExceedAction and ConformAction are the TC_ACT_* verdicts
+// for packets over and under the limit.
+type Police struct {
+	Index         uint32
+	ExceedAction  int32
+	ConformAction int32
+	Rate          uint64
+	Burst         uint32
+	PeakRate      uint64
+	Mtu           uint32
+}
+
+// Skbedit changes the packet metadata. Mask limits the bits of the mark
+// that are changed, 0 for all of them.
+type Skbedit struct {
+	TcGen
+	Priority        uint32
+	HasPriority     bool
+	QueueMapping    uint16
+	HasQueueMapping bool
+	Mark            uint32
+	HasMark         bool
+	Mask            uint32
+	Ptype           uint16
+	HasPtype        bool
+}
+
+// VlanAction pops, pushes or modifies the outer VLAN tag. Op is one of
+// TCA_VLAN_ACT_* and Protocol defaults to ETH_P_8021Q.
+type VlanAction struct {
+	TcGen
+	Op          int32
+	Id          uint16
+	Protocol    uint16
+	Priority    uint8
+	HasPriority bool
+}
+
+// PeditKey edits the 32 bit word at Offset from the start of the header
+// given by HeaderType, one of TCA_PEDIT_KEY_EX_HDR_TYPE_*. Value and Mask
+// are in host byte order as read from the packet: the bits set in Mask
+// are replaced by Value, or Value is added to them when Cmd is
+// TCA_PEDIT_KEY_EX_CMD_ADD.
+type PeditKey struct {
+	HeaderType uint16
+	Cmd        uint16
+	Offset     uint32
+	Value      uint32
+	Mask       uint32
+}
+
+// Pedit edits packet headers.
+type Pedit struct {
+	TcGen
+	Keys []PeditKey
+}
+
+var actionKinds = map[string]func() TcInfo{
+	"gact":    func() TcInfo { return &Gact{} },
+	"mirred":  func() TcInfo { return &Mirred{} },
+	"police":  func() TcInfo { return &Police{} },
+	"skbedit": func() TcInfo { return &Skbedit{} },
+	"vlan":    func() TcInfo { return &VlanAction{} },
+	"pedit":   func() TcInfo { return &Pedit{} },
+}
+
+func TcGenfromWireFormat(data []byte) *TcGen {
+	return &TcGen{
+		Index:   *(*uint32)(unsafe.Pointer(&data[0:4][0])),
+		Capab:   *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		Action:  *(*int32)(unsafe.Pointer(&data[8:12][0])),
+		Refcnt:  *(*int32)(unsafe.Pointer(&data[12:16][0])),
+		Bindcnt: *(*int32)(unsafe.Pointer(&data[16:20][0])),
+	}
+}
+
+func (gen *TcGen) toWireFormat() []byte {
+	b := make([]byte, SizeofTcGen)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = gen.Index
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = gen.Capab
+	*(*int32)(unsafe.Pointer(&b[8:12][0])) = gen.Action
+	*(*int32)(unsafe.Pointer(&b[12:16][0])) = gen.Refcnt
+	*(*int32)(unsafe.Pointer(&b[16:20][0])) = gen.Bindcnt
+	return b
+}
+
+// TcActionfromAttrs decodes a single action from the attributes nested in
+// an entry of an action list.
+func TcActionfromAttrs(attrs []netlink.NetlinkAttr) (*TcAction, error) {
+	o := &tcObject{}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_ACT_KIND:
+			o.kind = attr.String()
+		case TCA_ACT_OPTIONS:
+			o.opts = attr.Data
+		case TCA_ACT_STATS:
+			sattrs, err := attr.Nested()
+			if err != nil {
+				return nil, err
+			}
+			o.stats = TcStatsfromAttrs(sattrs)
+		}
+	}
+
+	info, err := o.info(actionKinds)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TcAction{
+		Info:  info,
+		Stats: o.stats,
+	}, nil
+}
+
+// TcActionsfromAttr decodes an action list, such as TCA_FLOWER_ACT.
+func TcActionsfromAttr(attr *netlink.NetlinkAttr) ([]*TcAction, error) {
+	entries, err := attr.Nested()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*TcAction{}
+
+	for _, entry := range entries {
+		attrs, err := entry.Nested()
+		if err != nil {
+			return nil, err
+		}
+		a, err := TcActionfromAttrs(attrs)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, a)
+	}
+
+	return ret, nil
+}
+
+// tcActionsAttr encodes an action list. Entries are numbered from 1 in
+// the order the actions are run.
+func tcActionsAttr(attrtype uint16, actions []*TcAction) netlink.NetlinkAttr {
+	entries := []netlink.NetlinkAttr{}
+	for i, a := range actions {
+		attrs := []netlink.NetlinkAttr{
+			netlink.NewAttrString(TCA_ACT_KIND, a.Info.Kind()),
+			{Type: TCA_ACT_OPTIONS | netlink.NLA_F_NESTED, Data: a.Info.Options()},
+		}
+		entries = append(entries, netlink.NewAttrNested(uint16(i+1), attrs))
+	}
+	return netlink.NewAttrNested(attrtype, entries)
+}
+
+func (info *Gact) Kind() string {
+	return "gact"
+}
+
+func (info *Gact) Options() []byte {
+	return netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_GACT_PARMS, info.TcGen.toWireFormat()),
+	})
+}
+
+func (info *Gact) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		if attr.AttrType() == TCA_GACT_PARMS && len(attr.Data) >= SizeofTcGen {
+			info.TcGen = *TcGenfromWireFormat(attr.Data)
+		}
+	}
+	return nil
+}
+
+func (info *Mirred) Kind() string {
+	return "mirred"
+}
+
+func (info *Mirred) Options() []byte {
+	gen := info.TcGen
+	if gen.Action == TC_ACT_OK {
+		switch info.Eaction {
+		case TCA_EGRESS_REDIR, TCA_INGRESS_REDIR:
+			gen.Action = TC_ACT_STOLEN
+		default:
+			gen.Action = TC_ACT_PIPE
+		}
+	}
+
+	b := make([]byte, SizeofTcMirred)
+	copy(b, gen.toWireFormat())
+	*(*int32)(unsafe.Pointer(&b[20:24][0])) = info.Eaction
+	*(*uint32)(unsafe.Pointer(&b[24:28][0])) = info.Ifindex
+
+	return netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_MIRRED_PARMS, b),
+	})
+}
+
+func (info *Mirred) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		if attr.AttrType() == TCA_MIRRED_PARMS && len(attr.Data) >= SizeofTcMirred {
+			info.TcGen = *TcGenfromWireFormat(attr.Data)
+			info.Eaction = *(*int32)(unsafe.Pointer(&attr.Data[20:24][0]))
+			info.Ifindex = *(*uint32)(unsafe.Pointer(&attr.Data[24:28][0]))
+		}
+	}
+	return nil
+}
+
+// rateTable fills in the cell size of rs and returns the matching rate
+// table, the transmission time of packets up to mtu bytes, which the
+// kernel still requires for policing.
+func rateTable(rs *TcRateSpec, rate uint64, mtu uint32) []byte {
+	if mtu == 0 {
+		mtu = 2047
+	}
+	for (mtu >> rs.CellLog) > 255 {
+		rs.CellLog++
+	}
+
+	b := make([]byte, SizeofTcRateTable)
+	for i := 0; i < SizeofTcRateTable/4; i++ {
+		*(*uint32)(unsafe.Pointer(&b[i*4 : i*4+4][0])) = xmitTicks(rate, uint32(i+1)<<rs.CellLog)
+	}
+	return b
+}
+
+func (info *Police) Kind() string {
+	return "police"
+}
+
+func (info *Police) Options() []byte {
+	rate := rateSpec(info.Rate)
+	rtab := rateTable(rate, info.Rate, info.Mtu)
+
+	b := make([]byte, SizeofTcPolice)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = info.Index
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = info.ExceedAction
+	*(*uint32)(unsafe.Pointer(&b[12:16][0])) = xmitTicks(info.Rate, info.Burst)
+	*(*uint32)(unsafe.Pointer(&b[16:20][0])) = info.Mtu
+	copy(b[20:32], rate.toWireFormat())
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_POLICE_RATE, rtab),
+		netlink.NewAttrUint32(TCA_POLICE_RESULT, uint32(info.ConformAction)),
+	}
+	if info.Rate >= 0xffffffff {
+		attrs = append(attrs, netlink.NewAttrUint64(TCA_POLICE_RATE64, info.Rate))
+	}
+	if info.PeakRate != 0 {
+		peak := rateSpec(info.PeakRate)
+		attrs = append(attrs, netlink.NewAttr(TCA_POLICE_PEAKRATE, rateTable(peak, info.PeakRate, info.Mtu)))
+		copy(b[32:44], peak.toWireFormat())
+		if info.PeakRate >= 0xffffffff {
+			attrs = append(attrs, netlink.NewAttrUint64(TCA_POLICE_PEAKRATE64, info.PeakRate))
+		}
+	}
+
+	return netlink.AttrsToWireFormat(append([]netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_POLICE_TBF, b),
+	}, attrs...))
+}
+
+func (info *Police) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+
+	var burst uint32
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_POLICE_TBF:
+			if len(attr.Data) < SizeofTcPolice {
+				return errors.New("short tc_police")
+			}
+			info.Index = *(*uint32)(unsafe.Pointer(&attr.Data[0:4][0]))
+			info.ExceedAction = *(*int32)(unsafe.Pointer(&attr.Data[4:8][0]))
+			burst = *(*uint32)(unsafe.Pointer(&attr.Data[12:16][0]))
+			info.Mtu = *(*uint32)(unsafe.Pointer(&attr.Data[16:20][0]))
+			if info.Rate == 0 {
+				info.Rate = uint64(TcRateSpecfromWireFormat(attr.Data[20:32]).Rate)
+			}
+			if info.PeakRate == 0 {
+				info.PeakRate = uint64(TcRateSpecfromWireFormat(attr.Data[32:44]).Rate)
+			}
+		case TCA_POLICE_RESULT:
+			info.ConformAction = int32(attr.Uint32())
+		case TCA_POLICE_RATE64:
+			info.Rate = attr.Uint64()
+		case TCA_POLICE_PEAKRATE64:
+			info.PeakRate = attr.Uint64()
+		}
+	}
+
+	info.Burst = xmitSize(info.Rate, burst)
+
+	return nil
+}
+
+func (info *Skbedit) Kind() string {
+	return "skbedit"
+}
+
+func (info *Skbedit) Options() []byte {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_SKBEDIT_PARMS, info.TcGen.toWireFormat()),
+	}
+	if info.HasPriority {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_SKBEDIT_PRIORITY, info.Priority))
+	}
+	if info.HasQueueMapping {
+		attrs = append(attrs, netlink.NewAttrUint16(TCA_SKBEDIT_QUEUE_MAPPING, info.QueueMapping))
+	}
+	if info.HasMark {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_SKBEDIT_MARK, info.Mark))
+		if info.Mask != 0 {
+			attrs = append(attrs, netlink.NewAttrUint32(TCA_SKBEDIT_MASK, info.Mask))
+		}
+	}
+	if info.HasPtype {
+		attrs = append(attrs, netlink.NewAttrUint16(TCA_SKBEDIT_PTYPE, info.Ptype))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *Skbedit) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_SKBEDIT_PARMS:
+			if len(attr.Data) >= SizeofTcGen {
+				info.TcGen = *TcGenfromWireFormat(attr.Data)
+			}
+		case TCA_SKBEDIT_PRIORITY:
+			info.Priority = attr.Uint32()
+			info.HasPriority = true
+		case TCA_SKBEDIT_QUEUE_MAPPING:
+			info.QueueMapping = attr.Uint16()
+			info.HasQueueMapping = true
+		case TCA_SKBEDIT_MARK:
+			info.Mark = attr.Uint32()
+			info.HasMark = true
+		case TCA_SKBEDIT_MASK:
+			if mask := attr.Uint32(); mask != 0xffffffff {
+				info.Mask = mask
+			}
+		case TCA_SKBEDIT_PTYPE:
+			info.Ptype = attr.Uint16()
+			info.HasPtype = true
+		}
+	}
+	return nil
+}
+
+func (info *VlanAction) Kind() string {
+	return "vlan"
+}
+
+func (info *VlanAction) Options() []byte {
+	b := make([]byte, SizeofTcVlan)
+	copy(b, info.TcGen.toWireFormat())
+	*(*int32)(unsafe.Pointer(&b[20:24][0])) = info.Op
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_VLAN_PARMS, b),
+	}
+	if info.Op == TCA_VLAN_ACT_PUSH || info.Op == TCA_VLAN_ACT_MODIFY {
+		proto := info.Protocol
+		if proto == 0 {
+			proto = ETH_P_8021Q
+		}
+		attrs = append(attrs,
+			netlink.NewAttrUint16(TCA_VLAN_PUSH_VLAN_ID, info.Id),
+			netlink.NewAttrNetUint16(TCA_VLAN_PUSH_VLAN_PROTOCOL, proto))
+		if info.HasPriority {
+			attrs = append(attrs, netlink.NewAttrUint8(TCA_VLAN_PUSH_VLAN_PRIORITY, info.Priority))
+		}
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *VlanAction) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_VLAN_PARMS:
+			if len(attr.Data) >= SizeofTcVlan {
+				info.TcGen = *TcGenfromWireFormat(attr.Data)
+				info.Op = *(*int32)(unsafe.Pointer(&attr.Data[20:24][0]))
+			}
+		case TCA_VLAN_PUSH_VLAN_ID:
+			info.Id = attr.Uint16()
+		case TCA_VLAN_PUSH_VLAN_PROTOCOL:
+			info.Protocol = attr.NetUint16()
+		case TCA_VLAN_PUSH_VLAN_PRIORITY:
+			info.Priority = attr.Uint8()
+			info.HasPriority = true
+		}
+	}
+	return nil
+}
+
+func (info *Pedit) Kind() string {
+	return "pedit"
+}
+
+// Options encodes the keys in the extended format, which carries the
+// header type and command of each key.
+func (info *Pedit) Options() []byte {
+	b := make([]byte, SizeofTcPeditSel+len(info.Keys)*SizeofTcPeditKey)
+	copy(b, info.TcGen.toWireFormat())
+	b[20] = uint8(len(info.Keys))
+
+	keysEx := []netlink.NetlinkAttr{}
+
+	for i, key := range info.Keys {
+		k := b[SizeofTcPeditSel+i*SizeofTcPeditKey:]
+		binary.BigEndian.PutUint32(k[0:4], ^key.Mask)
+		binary.BigEndian.PutUint32(k[4:8], key.Value&key.Mask)
+		*(*uint32)(unsafe.Pointer(&k[8:12][0])) = key.Offset
+
+		keysEx = append(keysEx, netlink.NewAttrNested(TCA_PEDIT_KEY_EX, []netlink.NetlinkAttr{
+			netlink.NewAttrUint16(TCA_PEDIT_KEY_EX_HTYPE, key.HeaderType),
+			netlink.NewAttrUint16(TCA_PEDIT_KEY_EX_CMD, key.Cmd),
+		}))
+	}
+
+	return netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_PEDIT_PARMS_EX, b),
+		netlink.NewAttrNested(TCA_PEDIT_KEYS_EX, keysEx),
+	})
+}
+
+func (info *Pedit) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+
+	var keysEx []netlink.NetlinkAttr
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_PEDIT_PARMS, TCA_PEDIT_PARMS_EX:
+			if len(attr.Data) < SizeofTcPeditSel {
+				return errors.New("short tc_pedit_sel")
+			}
+			info.TcGen = *TcGenfromWireFormat(attr.Data)
+			nkeys := int(attr.Data[20])
+			if len(attr.Data) < SizeofTcPeditSel+nkeys*SizeofTcPeditKey {
+				return errors.New("short tc_pedit_sel keys")
+			}
+			info.Keys = make([]PeditKey, nkeys)
+			for i := range info.Keys {
+				k := attr.Data[SizeofTcPeditSel+i*SizeofTcPeditKey:]
+				info.Keys[i].Mask = ^binary.BigEndian.Uint32(k[0:4])
+				info.Keys[i].Value = binary.BigEndian.Uint32(k[4:8])
+				info.Keys[i].Offset = *(*uint32)(unsafe.Pointer(&k[8:12][0]))
+			}
+		case TCA_PEDIT_KEYS_EX:
+			keysEx, err = attr.Nested()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	for i := range keysEx {
+		if i >= len(info.Keys) {
+			break
+		}
+		kattrs, err := keysEx[i].Nested()
+		if err != nil {
+			return err
+		}
+		for _, kattr := range kattrs {
+			switch kattr.AttrType() {
+			case TCA_PEDIT_KEY_EX_HTYPE:
+				info.Keys[i].HeaderType = kattr.Uint16()
+			case TCA_PEDIT_KEY_EX_CMD:
+				info.Keys[i].Cmd = kattr.Uint16()
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,185 @@
+package route
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+// actionRoundTrip encodes info in an action list and decodes it back.
+func actionRoundTrip(t *testing.T, info TcInfo) TcInfo {
+	t.Helper()
+	attr := tcActionsAttr(TCA_FLOWER_ACT, []*TcAction{{Info: info}})
+	actions, err := TcActionsfromAttr(&attr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Info == nil || actions[0].Info.Kind() != info.Kind() {
+		t.Fatalf("%s: got %+v", info.Kind(), actions)
+	}
+	return actions[0].Info
+}
+
+func TestTcGenWireFormat(t *testing.T) {
+	gen := &TcGen{Index: 1, Capab: 2, Action: TC_ACT_SHOT, Refcnt: 3, Bindcnt: 4}
+
+	b := gen.toWireFormat()
+	if len(b) != SizeofTcGen {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := TcGenfromWireFormat(b); *got != *gen {
+		t.Errorf("got %+v, want %+v", got, gen)
+	}
+}
+
+func TestTcActionsAttr(t *testing.T) {
+	actions := []*TcAction{
+		{Info: &Skbedit{Mark: 1, HasMark: true}},
+		{Info: &Gact{TcGen{Action: TC_ACT_OK}}},
+		{Info: &GenericTcInfo{KindName: "ct"}},
+	}
+
+	/* the entries are numbered from 1 in order */
+	attr := tcActionsAttr(TCA_U32_ACT, actions)
+	entries, err := attr.Nested()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, e := range entries {
+		if e.AttrType() != uint16(i+1) {
+			t.Errorf("entry %d numbered %d", i, e.AttrType())
+		}
+	}
+
+	got, err := TcActionsfromAttr(&attr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].Info.Kind() != "skbedit" || got[1].Info.Kind() != "gact" || got[2].Info.Kind() != "ct" {
+		t.Errorf("got %+v", got)
+	}
+	if _, ok := got[2].Info.(*GenericTcInfo); !ok {
+		t.Errorf("unknown kind: got %#v", got[2].Info)
+	}
+}
+
+func TestMirredOptions(t *testing.T) {
+	tests := []struct {
+		mirred Mirred
+		action int32
+	}{
+		{Mirred{Eaction: TCA_EGRESS_REDIR, Ifindex: 3}, TC_ACT_STOLEN},
+		{Mirred{Eaction: TCA_INGRESS_REDIR, Ifindex: 3}, TC_ACT_STOLEN},
+		{Mirred{Eaction: TCA_EGRESS_MIRROR, Ifindex: 3}, TC_ACT_PIPE},
+		{Mirred{TcGen: TcGen{Action: TC_ACT_SHOT}, Eaction: TCA_EGRESS_MIRROR, Ifindex: 3}, TC_ACT_SHOT},
+	}
+
+	for _, test := range tests {
+		got := actionRoundTrip(t, &test.mirred).(*Mirred)
+		if got.Eaction != test.mirred.Eaction || got.Ifindex != 3 || got.Action != test.action {
+			t.Errorf("%+v: got %+v", test.mirred, got)
+		}
+	}
+}
+
+func TestPoliceOptions(t *testing.T) {
+	police := &Police{Index: 4, ExceedAction: TC_ACT_SHOT, ConformAction: TC_ACT_OK, Rate: 125000, Burst: 1500,
+		PeakRate: 250000, Mtu: 1514}
+
+	if got := actionRoundTrip(t, police).(*Police); *got != *police {
+		t.Errorf("got %+v, want %+v", got, police)
+	}
+
+	fast := &Police{ExceedAction: TC_ACT_SHOT, Rate: 12500000000, Burst: 1 << 20}
+	got := actionRoundTrip(t, fast).(*Police)
+	if got.Rate != fast.Rate || got.Burst > fast.Burst || fast.Burst-got.Burst > 800 {
+		t.Errorf("got %+v, want %+v", got, fast)
+	}
+
+	/* the rate table covers the mtu in 256 cells */
+	rs := rateSpec(125000)
+	rtab := rateTable(rs, 125000, 0)
+	if len(rtab) != SizeofTcRateTable || rs.CellLog != 3 {
+		t.Fatalf("cell log %d", rs.CellLog)
+	}
+	for _, cell := range []int{0, 255} {
+		ticks := *(*uint32)(unsafe.Pointer(&rtab[cell*4 : cell*4+4][0]))
+		if ticks != xmitTicks(125000, uint32(cell+1)<<3) {
+			t.Errorf("cell %d: %d ticks", cell, ticks)
+		}
+	}
+	rs = rateSpec(125000)
+	rateTable(rs, 125000, 255)
+	if rs.CellLog != 0 {
+		t.Errorf("cell log %d for a 255 bytes mtu", rs.CellLog)
+	}
+}
+
+func TestSkbeditOptions(t *testing.T) {
+	skbedit := &Skbedit{TcGen: TcGen{Action: TC_ACT_PIPE}, Priority: MakeHandle(1, 10), HasPriority: true,
+		Mark: 0x10, HasMark: true, Mask: 0xf0, QueueMapping: 0, HasQueueMapping: true}
+	if got := actionRoundTrip(t, skbedit).(*Skbedit); *got != *skbedit {
+		t.Errorf("got %+v, want %+v", got, skbedit)
+	}
+
+	/* the kernel reports the default mask, which is no mask */
+	opts := append((&Skbedit{Mark: 1, HasMark: true}).Options(),
+		netlink.AttrsToWireFormat([]netlink.NetlinkAttr{netlink.NewAttrUint32(TCA_SKBEDIT_MASK, 0xffffffff)})...)
+	got := &Skbedit{}
+	err := got.ParseOptions(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Mask != 0 || got.Mark != 1 {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestVlanActionOptions(t *testing.T) {
+	push := &VlanAction{TcGen: TcGen{Action: TC_ACT_PIPE}, Op: TCA_VLAN_ACT_PUSH, Id: 100, Priority: 0, HasPriority: true}
+	got := actionRoundTrip(t, push).(*VlanAction)
+	if got.Op != TCA_VLAN_ACT_PUSH || got.Id != 100 || got.Protocol != ETH_P_8021Q || !got.HasPriority || got.Action != TC_ACT_PIPE {
+		t.Errorf("got %+v", got)
+	}
+
+	got = actionRoundTrip(t, &VlanAction{Op: TCA_VLAN_ACT_MODIFY, Id: 200, Protocol: ETH_P_8021AD}).(*VlanAction)
+	if got.Protocol != ETH_P_8021AD || got.Id != 200 || got.HasPriority {
+		t.Errorf("got %+v", got)
+	}
+
+	/* popping takes no tag */
+	attrs, _ := netlink.ParseNetlinkAttrs((&VlanAction{Op: TCA_VLAN_ACT_POP, Id: 1}).Options())
+	if len(attrs) != 1 {
+		t.Errorf("pop sent %+v", attrs)
+	}
+}
+
+func TestPeditOptions(t *testing.T) {
+	pedit := &Pedit{
+		TcGen: TcGen{Action: TC_ACT_PIPE},
+		Keys: []PeditKey{
+			/* the destination address of IPv4 and the decrement of its TTL */
+			{HeaderType: TCA_PEDIT_KEY_EX_HDR_TYPE_IP4, Cmd: TCA_PEDIT_KEY_EX_CMD_SET, Offset: 16, Value: 0xc0000201, Mask: 0xffffffff},
+			{HeaderType: TCA_PEDIT_KEY_EX_HDR_TYPE_IP4, Cmd: TCA_PEDIT_KEY_EX_CMD_ADD, Offset: 8, Value: 0xff000000, Mask: 0xff000000},
+		},
+	}
+
+	got := actionRoundTrip(t, pedit).(*Pedit)
+	if got.Action != TC_ACT_PIPE || len(got.Keys) != 2 {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range pedit.Keys {
+		if got.Keys[i] != pedit.Keys[i] {
+			t.Errorf("key %d: got %+v, want %+v", i, got.Keys[i], pedit.Keys[i])
+		}
+	}
+
+	/* the kernel keeps the bits outside the mask, which it takes inverted */
+	attrs, _ := netlink.ParseNetlinkAttrs(pedit.Options())
+	parms, _ := findAttr(attrs, TCA_PEDIT_PARMS_EX)
+	k := parms.Data[SizeofTcPeditSel+SizeofTcPeditKey:]
+	if k[0] != 0x00 || k[1] != 0xff || k[4] != 0xff || k[5] != 0x00 {
+		t.Errorf("tc_pedit_key % x", k[:8])
+	}
+}
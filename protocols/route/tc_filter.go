@@ -0,0 +1,727 @@
+package route
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofTcU32Sel = 16
+	SizeofTcU32Key = 16
+)
+
+// Filter is a classifier attached to a qdisc or class. Filters are run by
+// increasing Priority within a chain and Protocol, an ETH_P_* value in host
+// byte order, defaults to ETH_P_ALL. The kernel picks a Handle when it is 0.
+type Filter struct {
+	Index    int32
+	Parent   uint32
+	Priority uint16
+	Protocol uint16
+	Handle   uint32
+	Chain    uint32
+	Info     TcInfo
+	Attrs    []netlink.NetlinkAttr
+}
+
+// U32Key matches the 32 bit word at Offset from the network header. Value
+// and Mask are in host byte order as read from the packet.
+type U32Key struct {
+	Mask    uint32
+	Value   uint32
+	Offset  int32
+	OffMask int32
+}
+
+// U32 is the u32 classifier. A non zero Divisor creates a hash table
+// instead of a filter. Flags are TCA_CLS_FLAGS_*.
+type U32 struct {
+	ClassId uint32
+	Divisor uint32
+	Hash    uint32
+	Link    uint32
+	Keys    []U32Key
+	Flags   uint32
+	Actions []*TcAction
+}
+
+// Flower is the flower classifier. EthType defaults to the filter protocol
+// and has to be ETH_P_IP or ETH_P_IPV6 for the IP keys to be used. The
+// ports are matched for the protocol given in IPProto and the ICMP keys
+// for ICMP or ICMPv6. Zero values, and nil masks, are not matched.
+type Flower struct {
+	ClassId      uint32
+	Indev        string
+	Flags        uint32
+	EthType      uint16
+	EthDst       net.HardwareAddr
+	EthDstMask   net.HardwareAddr
+	EthSrc       net.HardwareAddr
+	EthSrcMask   net.HardwareAddr
+	VlanId       uint16
+	HasVlanId    bool
+	VlanPrio     uint8
+	HasVlanPrio  bool
+	VlanEthType  uint16
+	IPProto      uint8
+	Src          *net.IPNet
+	Dst          *net.IPNet
+	IPTos        uint8
+	IPTosMask    uint8
+	IPTtl        uint8
+	IPTtlMask    uint8
+	SrcPort      uint16
+	DstPort      uint16
+	TcpFlags     uint16
+	TcpFlagsMask uint16
+	IcmpType     uint8
+	HasIcmpType  bool
+	IcmpCode     uint8
+	HasIcmpCode  bool
+	Actions      []*TcAction
+}
+
+// Matchall is the classifier matching every packet.
+type Matchall struct {
+	ClassId uint32
+	Flags   uint32
+	Actions []*TcAction
+}
+
+// Basic is the basic classifier. Extended matches are not supported, so it
+// matches every packet.
+type Basic struct {
+	ClassId uint32
+	Actions []*TcAction
+}
+
+// Fw classifies by firewall mark. The filter handle is the mark to match,
+// after applying Mask when it is not 0.
+type Fw struct {
+	ClassId uint32
+	Mask    uint32
+	Indev   string
+	Actions []*TcAction
+}
+
+var filterKinds = map[string]func() TcInfo{
+	"u32":      func() TcInfo { return &U32{} },
+	"flower":   func() TcInfo { return &Flower{} },
+	"matchall": func() TcInfo { return &Matchall{} },
+	"basic":    func() TcInfo { return &Basic{} },
+	"fw":       func() TcInfo { return &Fw{} },
+}
+
+// GotoChain returns the verdict that continues classification at the
+// given chain.
+func GotoChain(chain uint32) int32 {
+	return TC_ACT_GOTO_CHAIN | int32(chain)
+}
+
+// htons converts a value between host and network byte order.
+func htons(v uint16) uint16 {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, v)
+	return *(*uint16)(unsafe.Pointer(&b[0]))
+}
+
+func FilterfromWireFormat(data []byte) (*Filter, error) {
+	o, err := tcObjectfromWireFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := o.info(filterKinds)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &Filter{
+		Index:    o.tcm.Index,
+		Parent:   o.tcm.Parent,
+		Priority: uint16(o.tcm.Info >> 16),
+		Protocol: htons(uint16(o.tcm.Info)),
+		Handle:   o.tcm.Handle,
+		Info:     info,
+		Attrs:    o.attrs,
+	}
+
+	for _, attr := range o.attrs {
+		if attr.AttrType() == TCA_CHAIN {
+			f.Chain = attr.Uint32()
+		}
+	}
+
+	return f, nil
+}
+
+func (f *Filter) withDefaults() *Filter {
+	nf := *f
+	if nf.Protocol == 0 {
+		nf.Protocol = ETH_P_ALL
+	}
+	if fl, ok := nf.Info.(*Flower); ok && fl.EthType == 0 && nf.Protocol != ETH_P_ALL {
+		nfl := *fl
+		nfl.EthType = nf.Protocol
+		nf.Info = &nfl
+	}
+	return &nf
+}
+
+func (f *Filter) toWireFormat() []byte {
+	tcm := &TcMsg{
+		Family: syscall.AF_UNSPEC,
+		Index:  f.Index,
+		Handle: f.Handle,
+		Parent: f.Parent,
+		Info:   uint32(f.Priority)<<16 | uint32(htons(f.Protocol)),
+	}
+
+	attrs := tcInfoAttrs(f.Info)
+	attrs = append(attrs, netlink.NewAttrUint32(TCA_CHAIN, f.Chain))
+
+	return append(tcm.toWireFormat(), netlink.AttrsToWireFormat(attrs)...)
+}
+
+func (info *U32) Kind() string {
+	return "u32"
+}
+
+func (info *U32) Options() []byte {
+	attrs := []netlink.NetlinkAttr{}
+
+	if info.Divisor != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_U32_DIVISOR, info.Divisor))
+		return netlink.AttrsToWireFormat(attrs)
+	}
+
+	sel := make([]byte, SizeofTcU32Sel+len(info.Keys)*SizeofTcU32Key)
+	if info.ClassId != 0 || len(info.Actions) != 0 {
+		sel[0] = TC_U32_TERMINAL
+	}
+	sel[2] = uint8(len(info.Keys))
+	for i, key := range info.Keys {
+		k := sel[SizeofTcU32Sel+i*SizeofTcU32Key:]
+		binary.BigEndian.PutUint32(k[0:4], key.Mask)
+		binary.BigEndian.PutUint32(k[4:8], key.Value&key.Mask)
+		*(*int32)(unsafe.Pointer(&k[8:12][0])) = key.Offset
+		*(*int32)(unsafe.Pointer(&k[12:16][0])) = key.OffMask
+	}
+	attrs = append(attrs, netlink.NewAttr(TCA_U32_SEL, sel))
+
+	if info.ClassId != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_U32_CLASSID, info.ClassId))
+	}
+	if info.Hash != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_U32_HASH, info.Hash))
+	}
+	if info.Link != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_U32_LINK, info.Link))
+	}
+	if info.Flags != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_U32_FLAGS, info.Flags))
+	}
+	if len(info.Actions) != 0 {
+		attrs = append(attrs, tcActionsAttr(TCA_U32_ACT, info.Actions))
+	}
+
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *U32) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_U32_CLASSID:
+			info.ClassId = attr.Uint32()
+		case TCA_U32_DIVISOR:
+			info.Divisor = attr.Uint32()
+		case TCA_U32_HASH:
+			info.Hash = attr.Uint32()
+		case TCA_U32_LINK:
+			info.Link = attr.Uint32()
+		case TCA_U32_FLAGS:
+			info.Flags = attr.Uint32()
+		case TCA_U32_SEL:
+			if len(attr.Data) < SizeofTcU32Sel {
+				return errors.New("short tc_u32_sel")
+			}
+			nkeys := int(attr.Data[2])
+			if len(attr.Data) < SizeofTcU32Sel+nkeys*SizeofTcU32Key {
+				return errors.New("short tc_u32_sel keys")
+			}
+			info.Keys = make([]U32Key, nkeys)
+			for i := range info.Keys {
+				k := attr.Data[SizeofTcU32Sel+i*SizeofTcU32Key:]
+				info.Keys[i] = U32Key{
+					Mask:    binary.BigEndian.Uint32(k[0:4]),
+					Value:   binary.BigEndian.Uint32(k[4:8]),
+					Offset:  *(*int32)(unsafe.Pointer(&k[8:12][0])),
+					OffMask: *(*int32)(unsafe.Pointer(&k[12:16][0])),
+				}
+			}
+		case TCA_U32_ACT:
+			info.Actions, err = TcActionsfromAttr(&attr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (info *Flower) Kind() string {
+	return "flower"
+}
+
+// flowerPorts returns the source and destination port attributes for the
+// transport protocol of the filter.
+func (info *Flower) flowerPorts() (uint16, uint16, bool) {
+	switch info.IPProto {
+	case syscall.IPPROTO_TCP:
+		return TCA_FLOWER_KEY_TCP_SRC, TCA_FLOWER_KEY_TCP_DST, true
+	case syscall.IPPROTO_UDP:
+		return TCA_FLOWER_KEY_UDP_SRC, TCA_FLOWER_KEY_UDP_DST, true
+	case syscall.IPPROTO_SCTP:
+		return TCA_FLOWER_KEY_SCTP_SRC, TCA_FLOWER_KEY_SCTP_DST, true
+	}
+	return 0, 0, false
+}
+
+// flowerIcmp returns the ICMP type and code attributes for the protocol of
+// the filter.
+func (info *Flower) flowerIcmp() (uint16, uint16, bool) {
+	switch info.IPProto {
+	case syscall.IPPROTO_ICMP:
+		return TCA_FLOWER_KEY_ICMPV4_TYPE, TCA_FLOWER_KEY_ICMPV4_CODE, true
+	case syscall.IPPROTO_ICMPV6:
+		return TCA_FLOWER_KEY_ICMPV6_TYPE, TCA_FLOWER_KEY_ICMPV6_CODE, true
+	}
+	return 0, 0, false
+}
+
+func flowerAddrAttrs(n *net.IPNet, v4key, v6key uint16) []netlink.NetlinkAttr {
+	if ip := n.IP.To4(); ip != nil {
+		mask := n.Mask
+		if len(mask) == net.IPv6len {
+			mask = mask[12:]
+		}
+		return []netlink.NetlinkAttr{
+			netlink.NewAttr(v4key, ip),
+			netlink.NewAttr(v4key+1, mask),
+		}
+	}
+	return []netlink.NetlinkAttr{
+		netlink.NewAttr(v6key, n.IP.To16()),
+		netlink.NewAttr(v6key+1, n.Mask),
+	}
+}
+
+func flowerMacAttrs(mac, mask net.HardwareAddr, key uint16) []netlink.NetlinkAttr {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(key, mac),
+	}
+	if mask != nil {
+		attrs = append(attrs, netlink.NewAttr(key+1, mask))
+	}
+	return attrs
+}
+
+func (info *Flower) Options() []byte {
+	attrs := []netlink.NetlinkAttr{}
+
+	if info.ClassId != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FLOWER_CLASSID, info.ClassId))
+	}
+	if info.Indev != "" {
+		attrs = append(attrs, netlink.NewAttrString(TCA_FLOWER_INDEV, info.Indev))
+	}
+	attrs = append(attrs, netlink.NewAttrUint32(TCA_FLOWER_FLAGS, info.Flags))
+
+	if info.EthType != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(TCA_FLOWER_KEY_ETH_TYPE, info.EthType))
+	}
+	if info.EthDst != nil {
+		attrs = append(attrs, flowerMacAttrs(info.EthDst, info.EthDstMask, TCA_FLOWER_KEY_ETH_DST)...)
+	}
+	if info.EthSrc != nil {
+		attrs = append(attrs, flowerMacAttrs(info.EthSrc, info.EthSrcMask, TCA_FLOWER_KEY_ETH_SRC)...)
+	}
+	if info.HasVlanId {
+		attrs = append(attrs, netlink.NewAttrUint16(TCA_FLOWER_KEY_VLAN_ID, info.VlanId))
+	}
+	if info.HasVlanPrio {
+		attrs = append(attrs, netlink.NewAttrUint8(TCA_FLOWER_KEY_VLAN_PRIO, info.VlanPrio))
+	}
+	if info.VlanEthType != 0 {
+		attrs = append(attrs, netlink.NewAttrNetUint16(TCA_FLOWER_KEY_VLAN_ETH_TYPE, info.VlanEthType))
+	}
+
+	if info.IPProto != 0 {
+		attrs = append(attrs, netlink.NewAttrUint8(TCA_FLOWER_KEY_IP_PROTO, info.IPProto))
+	}
+	if info.Src != nil {
+		attrs = append(attrs, flowerAddrAttrs(info.Src, TCA_FLOWER_KEY_IPV4_SRC, TCA_FLOWER_KEY_IPV6_SRC)...)
+	}
+	if info.Dst != nil {
+		attrs = append(attrs, flowerAddrAttrs(info.Dst, TCA_FLOWER_KEY_IPV4_DST, TCA_FLOWER_KEY_IPV6_DST)...)
+	}
+	if info.IPTosMask != 0 {
+		attrs = append(attrs,
+			netlink.NewAttrUint8(TCA_FLOWER_KEY_IP_TOS, info.IPTos),
+			netlink.NewAttrUint8(TCA_FLOWER_KEY_IP_TOS_MASK, info.IPTosMask))
+	}
+	if info.IPTtlMask != 0 {
+		attrs = append(attrs,
+			netlink.NewAttrUint8(TCA_FLOWER_KEY_IP_TTL, info.IPTtl),
+			netlink.NewAttrUint8(TCA_FLOWER_KEY_IP_TTL_MASK, info.IPTtlMask))
+	}
+
+	if src, dst, ok := info.flowerPorts(); ok {
+		if info.SrcPort != 0 {
+			attrs = append(attrs, netlink.NewAttrNetUint16(src, info.SrcPort))
+		}
+		if info.DstPort != 0 {
+			attrs = append(attrs, netlink.NewAttrNetUint16(dst, info.DstPort))
+		}
+	}
+	if info.TcpFlagsMask != 0 {
+		attrs = append(attrs,
+			netlink.NewAttrNetUint16(TCA_FLOWER_KEY_TCP_FLAGS, info.TcpFlags),
+			netlink.NewAttrNetUint16(TCA_FLOWER_KEY_TCP_FLAGS_MASK, info.TcpFlagsMask))
+	}
+	if typ, code, ok := info.flowerIcmp(); ok {
+		if info.HasIcmpType {
+			attrs = append(attrs, netlink.NewAttrUint8(typ, info.IcmpType))
+		}
+		if info.HasIcmpCode {
+			attrs = append(attrs, netlink.NewAttrUint8(code, info.IcmpCode))
+		}
+	}
+
+	if len(info.Actions) != 0 {
+		attrs = append(attrs, tcActionsAttr(TCA_FLOWER_ACT, info.Actions))
+	}
+
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+// fullMask returns nil for a mask matching every bit, which is what the
+// kernel reports for exact matches.
+func fullMask(mask []byte) []byte {
+	if bytes.Count(mask, []byte{0xff}) == len(mask) {
+		return nil
+	}
+	return mask
+}
+
+func (info *Flower) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+
+	var src, srcMask, dst, dstMask []byte
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_FLOWER_CLASSID:
+			info.ClassId = attr.Uint32()
+		case TCA_FLOWER_INDEV:
+			info.Indev = attr.String()
+		case TCA_FLOWER_FLAGS:
+			info.Flags = attr.Uint32()
+		case TCA_FLOWER_KEY_ETH_TYPE:
+			info.EthType = attr.NetUint16()
+		case TCA_FLOWER_KEY_ETH_DST:
+			info.EthDst = net.HardwareAddr(attr.Data)
+		case TCA_FLOWER_KEY_ETH_DST_MASK:
+			info.EthDstMask = fullMask(attr.Data)
+		case TCA_FLOWER_KEY_ETH_SRC:
+			info.EthSrc = net.HardwareAddr(attr.Data)
+		case TCA_FLOWER_KEY_ETH_SRC_MASK:
+			info.EthSrcMask = fullMask(attr.Data)
+		case TCA_FLOWER_KEY_VLAN_ID:
+			info.VlanId = attr.Uint16()
+			info.HasVlanId = true
+		case TCA_FLOWER_KEY_VLAN_PRIO:
+			info.VlanPrio = attr.Uint8()
+			info.HasVlanPrio = true
+		case TCA_FLOWER_KEY_VLAN_ETH_TYPE:
+			info.VlanEthType = attr.NetUint16()
+		case TCA_FLOWER_KEY_IP_PROTO:
+			info.IPProto = attr.Uint8()
+		case TCA_FLOWER_KEY_IPV4_SRC, TCA_FLOWER_KEY_IPV6_SRC:
+			src = attr.Data
+		case TCA_FLOWER_KEY_IPV4_SRC_MASK, TCA_FLOWER_KEY_IPV6_SRC_MASK:
+			srcMask = attr.Data
+		case TCA_FLOWER_KEY_IPV4_DST, TCA_FLOWER_KEY_IPV6_DST:
+			dst = attr.Data
+		case TCA_FLOWER_KEY_IPV4_DST_MASK, TCA_FLOWER_KEY_IPV6_DST_MASK:
+			dstMask = attr.Data
+		case TCA_FLOWER_KEY_IP_TOS:
+			info.IPTos = attr.Uint8()
+		case TCA_FLOWER_KEY_IP_TOS_MASK:
+			info.IPTosMask = attr.Uint8()
+		case TCA_FLOWER_KEY_IP_TTL:
+			info.IPTtl = attr.Uint8()
+		case TCA_FLOWER_KEY_IP_TTL_MASK:
+			info.IPTtlMask = attr.Uint8()
+		case TCA_FLOWER_KEY_TCP_SRC, TCA_FLOWER_KEY_UDP_SRC, TCA_FLOWER_KEY_SCTP_SRC:
+			info.SrcPort = attr.NetUint16()
+		case TCA_FLOWER_KEY_TCP_DST, TCA_FLOWER_KEY_UDP_DST, TCA_FLOWER_KEY_SCTP_DST:
+			info.DstPort = attr.NetUint16()
+		case TCA_FLOWER_KEY_TCP_FLAGS:
+			info.TcpFlags = attr.NetUint16()
+		case TCA_FLOWER_KEY_TCP_FLAGS_MASK:
+			info.TcpFlagsMask = attr.NetUint16()
+		case TCA_FLOWER_KEY_ICMPV4_TYPE, TCA_FLOWER_KEY_ICMPV6_TYPE:
+			info.IcmpType = attr.Uint8()
+			info.HasIcmpType = true
+		case TCA_FLOWER_KEY_ICMPV4_CODE, TCA_FLOWER_KEY_ICMPV6_CODE:
+			info.IcmpCode = attr.Uint8()
+			info.HasIcmpCode = true
+		case TCA_FLOWER_ACT:
+			info.Actions, err = TcActionsfromAttr(&attr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if src != nil && len(srcMask) == len(src) {
+		info.Src = &net.IPNet{IP: net.IP(src), Mask: net.IPMask(srcMask)}
+	}
+	if dst != nil && len(dstMask) == len(dst) {
+		info.Dst = &net.IPNet{IP: net.IP(dst), Mask: net.IPMask(dstMask)}
+	}
+
+	return nil
+}
+
+func (info *Matchall) Kind() string {
+	return "matchall"
+}
+
+func (info *Matchall) Options() []byte {
+	attrs := []netlink.NetlinkAttr{}
+	if info.ClassId != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_MATCHALL_CLASSID, info.ClassId))
+	}
+	if info.Flags != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_MATCHALL_FLAGS, info.Flags))
+	}
+	if len(info.Actions) != 0 {
+		attrs = append(attrs, tcActionsAttr(TCA_MATCHALL_ACT, info.Actions))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *Matchall) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_MATCHALL_CLASSID:
+			info.ClassId = attr.Uint32()
+		case TCA_MATCHALL_FLAGS:
+			info.Flags = attr.Uint32()
+		case TCA_MATCHALL_ACT:
+			info.Actions, err = TcActionsfromAttr(&attr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (info *Basic) Kind() string {
+	return "basic"
+}
+
+func (info *Basic) Options() []byte {
+	attrs := []netlink.NetlinkAttr{}
+	if info.ClassId != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_BASIC_CLASSID, info.ClassId))
+	}
+	if len(info.Actions) != 0 {
+		attrs = append(attrs, tcActionsAttr(TCA_BASIC_ACT, info.Actions))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *Basic) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_BASIC_CLASSID:
+			info.ClassId = attr.Uint32()
+		case TCA_BASIC_ACT:
+			info.Actions, err = TcActionsfromAttr(&attr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (info *Fw) Kind() string {
+	return "fw"
+}
+
+func (info *Fw) Options() []byte {
+	attrs := []netlink.NetlinkAttr{}
+	if info.ClassId != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FW_CLASSID, info.ClassId))
+	}
+	if info.Mask != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FW_MASK, info.Mask))
+	}
+	if info.Indev != "" {
+		attrs = append(attrs, netlink.NewAttrString(TCA_FW_INDEV, info.Indev))
+	}
+	if len(info.Actions) != 0 {
+		attrs = append(attrs, tcActionsAttr(TCA_FW_ACT, info.Actions))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *Fw) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_FW_CLASSID:
+			info.ClassId = attr.Uint32()
+		case TCA_FW_MASK:
+			info.Mask = attr.Uint32()
+		case TCA_FW_INDEV:
+			info.Indev = attr.String()
+		case TCA_FW_ACT:
+			info.Actions, err = TcActionsfromAttr(&attr)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ListFilters dumps the filters of every chain attached to the given
+// parent, TC_H_UNSPEC for the root qdisc.
+func (rl *RouteNLSocket) ListFilters(index int32, parent uint32) ([]*Filter, error) {
+	tcm := &TcMsg{Index: index, Parent: parent}
+
+	msgList, err := rl.Execute(RTM_GETTFILTER, syscall.NLM_F_DUMP, tcm.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Filter{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWTFILTER {
+			continue
+		}
+		f, err := FilterfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, f)
+	}
+
+	return ret, nil
+}
+
+func (rl *RouteNLSocket) AddFilter(f *Filter) error {
+	_, err := rl.Execute(RTM_NEWTFILTER, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, f.withDefaults().toWireFormat())
+	return err
+}
+
+func (rl *RouteNLSocket) ReplaceFilter(f *Filter) error {
+	_, err := rl.Execute(RTM_NEWTFILTER, syscall.NLM_F_CREATE|syscall.NLM_F_REPLACE, f.withDefaults().toWireFormat())
+	return err
+}
+
+// DelFilter deletes a filter. Without Handle every filter with the same
+// priority is deleted, and without Priority every filter of the chain, in
+// which case Protocol, Handle and Info are ignored. A zero Protocol matches
+// the filters of any protocol.
+func (rl *RouteNLSocket) DelFilter(f *Filter) error {
+	nf := *f
+	if nf.Priority == 0 {
+		/* the kernel refuses to flush filters of a protocol, handle or kind */
+		nf.Protocol = 0
+		nf.Handle = 0
+		nf.Info = nil
+	}
+	_, err := rl.Execute(RTM_DELTFILTER, 0, nf.toWireFormat())
+	return err
+}
+
+func chainRequest(index int32, parent uint32, chain uint32) []byte {
+	tcm := &TcMsg{Index: index, Parent: parent}
+	return append(tcm.toWireFormat(), netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttrUint32(TCA_CHAIN, chain),
+	})...)
+}
+
+// ListChains returns the filter chains of the given parent.
+func (rl *RouteNLSocket) ListChains(index int32, parent uint32) ([]uint32, error) {
+	tcm := &TcMsg{Index: index, Parent: parent}
+
+	msgList, err := rl.Execute(RTM_GETCHAIN, syscall.NLM_F_DUMP, tcm.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []uint32{}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != RTM_NEWCHAIN {
+			continue
+		}
+		o, err := tcObjectfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		for _, attr := range o.attrs {
+			if attr.AttrType() == TCA_CHAIN {
+				ret = append(ret, attr.Uint32())
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// AddChain creates an empty chain. Chains are also created implicitly by
+// the first filter added to them.
+func (rl *RouteNLSocket) AddChain(index int32, parent uint32, chain uint32) error {
+	_, err := rl.Execute(RTM_NEWCHAIN, syscall.NLM_F_CREATE|syscall.NLM_F_EXCL, chainRequest(index, parent, chain))
+	return err
+}
+
+// DelChain deletes a chain with all its filters.
+func (rl *RouteNLSocket) DelChain(index int32, parent uint32, chain uint32) error {
+	_, err := rl.Execute(RTM_DELCHAIN, 0, chainRequest(index, parent, chain))
+	return err
+}
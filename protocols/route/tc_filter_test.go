@@ -0,0 +1,409 @@
+package route
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink"
+)
+
+// filterRoundTrip encodes info in a filter message and decodes it back.
+func filterRoundTrip(t *testing.T, info TcInfo) TcInfo {
+	t.Helper()
+	f := &Filter{Index: 2, Parent: MakeHandle(0xffff, 0), Priority: 10, Protocol: ETH_P_IP, Handle: 1, Chain: 3, Info: info}
+	got, err := FilterfromWireFormat(f.toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Index != 2 || got.Parent != f.Parent || got.Priority != 10 || got.Protocol != ETH_P_IP || got.Handle != 1 ||
+		got.Chain != 3 || got.Info == nil || got.Info.Kind() != info.Kind() {
+		t.Fatalf("%s: got %+v", info.Kind(), got)
+	}
+	return got.Info
+}
+
+func TestFilterWireFormat(t *testing.T) {
+	if htons(0x0800) != 0x0008 || htons(htons(ETH_P_IPV6)) != ETH_P_IPV6 {
+		t.Error("htons")
+	}
+
+	/* the priority and the protocol, in network byte order, share tcm_info */
+	tcm := TcMsgfromWireFormat((&Filter{Priority: 0x1234, Protocol: ETH_P_IP}).toWireFormat())
+	if tcm.Info != 0x12340008 {
+		t.Errorf("tcm_info %#x", tcm.Info)
+	}
+
+	if GotoChain(5) != TC_ACT_GOTO_CHAIN|5 {
+		t.Errorf("goto chain %#x", GotoChain(5))
+	}
+
+	if _, err := FilterfromWireFormat(make([]byte, SizeofTcMsg-1)); err == nil {
+		t.Error("short tcmsg accepted")
+	}
+}
+
+func TestFilterDefaults(t *testing.T) {
+	f := (&Filter{Info: &Flower{}}).withDefaults()
+	if f.Protocol != ETH_P_ALL || f.Info.(*Flower).EthType != 0 {
+		t.Errorf("got %+v %+v", f, f.Info)
+	}
+
+	/* flower matches the filter protocol unless told otherwise */
+	fl := &Flower{}
+	f = (&Filter{Protocol: ETH_P_IPV6, Info: fl}).withDefaults()
+	if f.Info.(*Flower).EthType != ETH_P_IPV6 || fl.EthType != 0 {
+		t.Errorf("got %+v, caller's %+v", f.Info, fl)
+	}
+	f = (&Filter{Protocol: ETH_P_IP, Info: &Flower{EthType: ETH_P_8021Q}}).withDefaults()
+	if f.Info.(*Flower).EthType != ETH_P_8021Q {
+		t.Errorf("got %+v", f.Info)
+	}
+}
+
+func TestU32Options(t *testing.T) {
+	u32 := &U32{
+		ClassId: MakeHandle(1, 10),
+		Keys: []U32Key{
+			{Mask: 0xffffff00, Value: 0xc0000200, Offset: 16},
+			{Mask: 0x0000ffff, Value: 0x00000050, Offset: 20, OffMask: 0},
+		},
+		Flags:   TCA_CLS_FLAGS_SKIP_HW,
+		Actions: []*TcAction{{Info: &Gact{TcGen{Action: TC_ACT_OK}}}},
+	}
+
+	got := filterRoundTrip(t, u32).(*U32)
+	if got.ClassId != u32.ClassId || got.Flags != u32.Flags || len(got.Keys) != 2 || len(got.Actions) != 1 {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range u32.Keys {
+		if got.Keys[i] != u32.Keys[i] {
+			t.Errorf("key %d: got %+v, want %+v", i, got.Keys[i], u32.Keys[i])
+		}
+	}
+
+	/* keys are sent in network byte order and classifying ones terminal */
+	attrs, _ := netlink.ParseNetlinkAttrs(u32.Options())
+	sel, _ := findAttr(attrs, TCA_U32_SEL)
+	if len(sel.Data) != SizeofTcU32Sel+2*SizeofTcU32Key || sel.Data[0] != TC_U32_TERMINAL || sel.Data[2] != 2 {
+		t.Errorf("tc_u32_sel % x", sel.Data[:SizeofTcU32Sel])
+	}
+	if k := sel.Data[SizeofTcU32Sel:]; k[0] != 0xff || k[3] != 0x00 || k[4] != 0xc0 || k[6] != 0x02 {
+		t.Errorf("tc_u32_key % x", k[:8])
+	}
+
+	/* a value outside the mask is not sent */
+	got = filterRoundTrip(t, &U32{Keys: []U32Key{{Mask: 0xff, Value: 0x1234}}}).(*U32)
+	if got.Keys[0].Value != 0x34 {
+		t.Errorf("got %+v", got.Keys[0])
+	}
+
+	/* a divisor makes a hash table, not a filter */
+	attrs, _ = netlink.ParseNetlinkAttrs((&U32{Divisor: 256, ClassId: 1}).Options())
+	if len(attrs) != 1 || attrs[0].AttrType() != TCA_U32_DIVISOR || attrs[0].Uint32() != 256 {
+		t.Errorf("hash table %+v", attrs)
+	}
+}
+
+func TestFlowerOptions(t *testing.T) {
+	fl := &Flower{
+		ClassId:      MakeHandle(1, 1),
+		Indev:        "eth0",
+		Flags:        TCA_CLS_FLAGS_SKIP_HW,
+		EthType:      ETH_P_IP,
+		EthDst:       net.HardwareAddr{0x02, 0, 0, 0, 0, 1},
+		EthDstMask:   net.HardwareAddr{0xff, 0xff, 0xff, 0, 0, 0},
+		EthSrc:       net.HardwareAddr{0x02, 0, 0, 0, 0, 2},
+		IPProto:      syscall.IPPROTO_TCP,
+		Src:          mustCIDR("10.0.0.0/8"),
+		Dst:          mustCIDR("192.0.2.1/32"),
+		IPTos:        0x10,
+		IPTosMask:    0xfc,
+		SrcPort:      1024,
+		DstPort:      443,
+		TcpFlags:     0x02,
+		TcpFlagsMask: 0x12,
+	}
+
+	got := filterRoundTrip(t, fl).(*Flower)
+	if got.ClassId != fl.ClassId || got.Indev != "eth0" || got.Flags != fl.Flags || got.EthType != ETH_P_IP ||
+		got.EthDst.String() != fl.EthDst.String() || got.EthDstMask.String() != fl.EthDstMask.String() ||
+		got.EthSrc.String() != fl.EthSrc.String() || got.EthSrcMask != nil || got.IPProto != syscall.IPPROTO_TCP ||
+		got.IPTos != 0x10 || got.IPTosMask != 0xfc || got.SrcPort != 1024 || got.DstPort != 443 ||
+		got.TcpFlags != 0x02 || got.TcpFlagsMask != 0x12 || got.HasIcmpType || got.HasVlanId {
+		t.Errorf("got %+v", got)
+	}
+	if got.Src == nil || got.Src.String() != "10.0.0.0/8" || got.Dst == nil || got.Dst.String() != "192.0.2.1/32" {
+		t.Errorf("addresses %v %v", got.Src, got.Dst)
+	}
+
+	/* the ports go in the attributes of the transport protocol */
+	attrs, _ := netlink.ParseNetlinkAttrs((&Flower{IPProto: syscall.IPPROTO_UDP, DstPort: 53}).Options())
+	if attr, ok := findAttr(attrs, TCA_FLOWER_KEY_UDP_DST); !ok || attr.NetUint16() != 53 {
+		t.Errorf("udp port %+v", attrs)
+	}
+	if _, ok := findAttr(attrs, TCA_FLOWER_KEY_TCP_DST); ok {
+		t.Error("tcp port sent for udp")
+	}
+	attrs, _ = netlink.ParseNetlinkAttrs((&Flower{DstPort: 53}).Options())
+	if _, ok := findAttr(attrs, TCA_FLOWER_KEY_UDP_DST); ok {
+		t.Error("port sent without a protocol")
+	}
+
+	icmp := &Flower{EthType: ETH_P_IPV6, IPProto: syscall.IPPROTO_ICMPV6, Dst: mustCIDR("2001:db8::/32"),
+		IcmpType: 128, HasIcmpType: true, IcmpCode: 0, HasIcmpCode: true, VlanId: 0, HasVlanId: true}
+	got = filterRoundTrip(t, icmp).(*Flower)
+	if !got.HasIcmpType || got.IcmpType != 128 || !got.HasIcmpCode || got.IcmpCode != 0 || !got.HasVlanId ||
+		got.Dst == nil || got.Dst.String() != "2001:db8::/32" || got.Src != nil {
+		t.Errorf("got %+v", got)
+	}
+	attrs, _ = netlink.ParseNetlinkAttrs(icmp.Options())
+	if _, ok := findAttr(attrs, TCA_FLOWER_KEY_ICMPV6_TYPE); !ok {
+		t.Error("ICMPv6 type not sent")
+	}
+
+	/* exact matches are reported with a full mask */
+	if fullMask([]byte{0xff, 0xff}) != nil || fullMask([]byte{0xff, 0}) == nil {
+		t.Error("fullMask")
+	}
+}
+
+func TestFilterKinds(t *testing.T) {
+	ma := &Matchall{ClassId: 5, Flags: TCA_CLS_FLAGS_SKIP_HW}
+	if got := filterRoundTrip(t, ma).(*Matchall); got.ClassId != 5 || got.Flags != TCA_CLS_FLAGS_SKIP_HW || got.Actions != nil {
+		t.Errorf("matchall: got %+v", got)
+	}
+
+	basic := &Basic{ClassId: 6, Actions: []*TcAction{{Info: &Gact{TcGen{Action: TC_ACT_SHOT}}}}}
+	if got := filterRoundTrip(t, basic).(*Basic); got.ClassId != 6 || len(got.Actions) != 1 {
+		t.Errorf("basic: got %+v", got)
+	}
+
+	fw := &Fw{ClassId: 7, Mask: 0xff, Indev: "eth0"}
+	if got := filterRoundTrip(t, fw).(*Fw); got.ClassId != 7 || got.Mask != 0xff || got.Indev != "eth0" {
+		t.Errorf("fw: got %+v", got)
+	}
+
+	if g, ok := filterRoundTrip(t, &GenericTcInfo{KindName: "bpf"}).(*GenericTcInfo); !ok || g.KindName != "bpf" {
+		t.Errorf("unknown kind: got %#v", g)
+	}
+}
+
+// testClsact sets up veth0 with a clsact qdisc and returns its ingress
+// parent and the peer link.
+func testClsact(t *testing.T, rl *RouteNLSocket) (*Link, *Link) {
+	t.Helper()
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	veth := mustLink(t, rl, "veth0")
+
+	err = rl.AddQdisc(&Qdisc{Index: veth.Index, Info: &Clsact{}})
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return veth, mustLink(t, rl, "veth1")
+}
+
+func TestFilters(t *testing.T) {
+	rl := testNetns(t)
+	veth, peer := testClsact(t, rl)
+	ingress := MakeHandle(0xffff, TC_H_MIN_INGRESS)
+
+	/* packets to 192.0.2.0/24 are mirrored to the peer */
+	u32 := &U32{
+		Keys:    []U32Key{{Mask: 0xffffff00, Value: 0xc0000200, Offset: 16}},
+		Actions: []*TcAction{{Info: &Mirred{Eaction: TCA_EGRESS_MIRROR, Ifindex: uint32(peer.Index)}}},
+	}
+	err := rl.AddFilter(&Filter{Index: veth.Index, Parent: ingress, Priority: 10, Protocol: ETH_P_IP, Info: u32})
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := rl.ListFilters(veth.Index, ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	/* u32 lists its hash table before the filter in it */
+	var f *Filter
+	for _, lf := range filters {
+		if lf.Priority != 10 || lf.Protocol != ETH_P_IP {
+			t.Errorf("filter %+v", lf)
+		}
+		if lf.Handle != 0 && HandleMinor(lf.Handle) != 0 {
+			f = lf
+		}
+	}
+	if f == nil {
+		t.Fatalf("ingress filters: %+v", filters)
+	}
+	got, ok := f.Info.(*U32)
+	if !ok || len(got.Keys) != 1 || got.Keys[0] != u32.Keys[0] || len(got.Actions) != 1 {
+		t.Fatalf("u32: %+v", f.Info)
+	}
+	/* mirrors default to passing the packet on */
+	m, ok := got.Actions[0].Info.(*Mirred)
+	if !ok || m.Eaction != TCA_EGRESS_MIRROR || m.Ifindex != uint32(peer.Index) || m.Action != TC_ACT_PIPE || m.Index == 0 {
+		t.Errorf("mirred: %+v", got.Actions[0].Info)
+	}
+	if got.Actions[0].Stats == nil {
+		t.Error("no action stats")
+	}
+
+	err = rl.AddFilter(&Filter{Index: veth.Index, Parent: ingress, Priority: 10, Protocol: ETH_P_IP, Handle: f.Handle, Info: u32})
+	if err != syscall.EEXIST {
+		t.Errorf("adding filter again: %v", err)
+	}
+
+	/* u32 keeps the selector of a replaced filter */
+	u32.ClassId = MakeHandle(1, 1)
+	err = rl.ReplaceFilter(&Filter{Index: veth.Index, Parent: ingress, Priority: 10, Protocol: ETH_P_IP, Handle: f.Handle, Info: u32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, _ = rl.ListFilters(veth.Index, ingress)
+	replaced := false
+	for _, lf := range filters {
+		if lf.Handle == f.Handle {
+			replaced = lf.Info.(*U32).ClassId == MakeHandle(1, 1)
+		}
+	}
+	if !replaced {
+		t.Errorf("replaced filter: %+v", filters)
+	}
+
+	/* without a protocol the filters of every protocol are deleted */
+	err = rl.DelFilter(&Filter{Index: veth.Index, Parent: ingress, Priority: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, _ = rl.ListFilters(veth.Index, ingress)
+	if len(filters) != 0 {
+		t.Errorf("deleted filter still listed: %+v", filters)
+	}
+
+	/* without a priority the whole chain is flushed, whatever the filter */
+	err = rl.AddFilter(&Filter{Index: veth.Index, Parent: ingress, Priority: 10, Protocol: ETH_P_IP, Info: u32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.DelFilter(&Filter{Index: veth.Index, Parent: ingress, Protocol: ETH_P_IP, Handle: f.Handle, Info: u32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, _ = rl.ListFilters(veth.Index, ingress)
+	if len(filters) != 0 {
+		t.Errorf("flushed filters still listed: %+v", filters)
+	}
+}
+
+func TestFlowerFilter(t *testing.T) {
+	rl := testNetns(t)
+	veth, _ := testClsact(t, rl)
+	ingress := MakeHandle(0xffff, TC_H_MIN_INGRESS)
+
+	flower := &Filter{
+		Index:    veth.Index,
+		Parent:   ingress,
+		Priority: 10,
+		Protocol: ETH_P_IP,
+		Handle:   1,
+		Info: &Flower{
+			IPProto: syscall.IPPROTO_TCP,
+			Dst:     mustCIDR("192.0.2.0/24"),
+			DstPort: 80,
+			Actions: []*TcAction{{Info: &Gact{TcGen{Action: GotoChain(5)}}}},
+		},
+	}
+	err := rl.AddFilter(flower)
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filters, err := rl.ListFilters(veth.Index, ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 1 || filters[0].Handle != 1 {
+		t.Fatalf("ingress filters: %+v", filters)
+	}
+	fl, ok := filters[0].Info.(*Flower)
+	if !ok || fl.EthType != ETH_P_IP || fl.IPProto != syscall.IPPROTO_TCP || fl.DstPort != 80 ||
+		fl.Dst == nil || fl.Dst.String() != "192.0.2.0/24" || len(fl.Actions) != 1 {
+		t.Fatalf("flower: %+v", filters[0].Info)
+	}
+	if gact, ok := fl.Actions[0].Info.(*Gact); !ok || gact.Action != GotoChain(5) {
+		t.Errorf("gact: %+v", fl.Actions[0].Info)
+	}
+
+	flower.Info.(*Flower).DstPort = 443
+	err = rl.ReplaceFilter(flower)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, _ = rl.ListFilters(veth.Index, ingress)
+	if len(filters) != 1 || filters[0].Info.(*Flower).DstPort != 443 {
+		t.Errorf("replaced filter: %+v", filters)
+	}
+}
+
+func TestChains(t *testing.T) {
+	rl := testNetns(t)
+	veth, peer := testClsact(t, rl)
+	ingress := MakeHandle(0xffff, TC_H_MIN_INGRESS)
+
+	err := rl.AddChain(veth.Index, ingress, 5)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddChain(veth.Index, ingress, 5)
+	if err != syscall.EEXIST {
+		t.Errorf("adding chain again: %v", err)
+	}
+
+	/* chains are also created by their first filter */
+	err = rl.AddFilter(&Filter{Index: veth.Index, Parent: ingress, Priority: 1, Chain: 7,
+		Info: &U32{Actions: []*TcAction{{Info: &Mirred{Eaction: TCA_EGRESS_MIRROR, Ifindex: uint32(peer.Index)}}}}})
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chains, err := rl.ListChains(veth.Index, ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[uint32]bool{}
+	for _, c := range chains {
+		found[c] = true
+	}
+	if !found[5] || !found[7] {
+		t.Errorf("chains %v", chains)
+	}
+
+	filters, _ := rl.ListFilters(veth.Index, ingress)
+	if len(filters) == 0 || filters[0].Chain != 7 {
+		t.Errorf("filters of chain 7: %+v", filters)
+	}
+
+	err = rl.DelChain(veth.Index, ingress, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filters, _ = rl.ListFilters(veth.Index, ingress)
+	if len(filters) != 0 {
+		t.Errorf("filters of a deleted chain still listed: %+v", filters)
+	}
+	chains, _ = rl.ListChains(veth.Index, ingress)
+	if len(chains) != 1 || chains[0] != 5 {
+		t.Errorf("chains %v", chains)
+	}
+}
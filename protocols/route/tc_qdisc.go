@@ -0,0 +1,667 @@
+package route
+
+import (
+	"errors"
+	"time"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+const (
+	SizeofTcFifoQopt  = 4
+	SizeofTcPrioQopt  = 20
+	SizeofTcTbfQopt   = 36
+	SizeofTcHtbGlob   = 20
+	SizeofTcHtbOpt    = 44
+	SizeofTcNetemQopt = 24
+	SizeofTcNetemRate = 16
+
+	/* version of the htb qdisc options understood by the kernel */
+	htbVersion = 3
+	htbMtu     = 1600
+)
+
+// Fifo is the pfifo, bfifo and pfifo_head_drop qdisc. Limit is in packets,
+// or in bytes for bfifo, and 0 leaves the kernel default.
+type Fifo struct {
+	KindName string
+	Limit    uint32
+}
+
+// PfifoFast is the default qdisc of most links. Its options are read only.
+type PfifoFast struct {
+	Bands   int32
+	PrioMap [TC_PRIO_MAX + 1]uint8
+}
+
+// Prio is the prio qdisc. A zero Bands uses the kernel default of three
+// bands and priority map.
+type Prio struct {
+	Bands   int32
+	PrioMap [TC_PRIO_MAX + 1]uint8
+}
+
+// FqCodel is the fq_codel qdisc. Times are in microseconds and zero values
+// are left to the kernel.
+type FqCodel struct {
+	Target        uint32
+	Limit         uint32
+	Interval      uint32
+	ECN           bool
+	HasECN        bool
+	Flows         uint32
+	Quantum       uint32
+	CEThreshold   uint32
+	DropBatchSize uint32
+	MemoryLimit   uint32
+}
+
+// Fq is the fq qdisc. Rates are in bytes per second, times in microseconds
+// and zero values are left to the kernel.
+type Fq struct {
+	PLimit           uint32
+	FlowPLimit       uint32
+	Quantum          uint32
+	InitialQuantum   uint32
+	Pacing           bool
+	HasPacing        bool
+	FlowDefaultRate  uint32
+	FlowMaxRate      uint32
+	BucketsLog       uint32
+	FlowRefillDelay  uint32
+	LowRateThreshold uint32
+	CEThreshold      uint32
+	Horizon          uint32
+}
+
+// Tbf is the token bucket filter qdisc. Rates are in bytes per second,
+// Burst and Mtu, the size of the peak rate bucket, in bytes and Limit is
+// the number of bytes that can be queued.
+type Tbf struct {
+	Rate     uint64
+	Burst    uint32
+	Limit    uint32
+	PeakRate uint64
+	Mtu      uint32
+}
+
+// Htb is the htb qdisc. Defcls is the minor handle of the class taking the
+// unclassified traffic.
+type Htb struct {
+	Rate2Quantum uint32
+	Defcls       uint32
+	DirectPkts   uint32
+	DirectQlen   uint32
+}
+
+// HtbClass is a class of the htb qdisc. Rates are in bytes per second and
+// Ceil defaults to Rate. Burst and Cburst are in bytes and default to a
+// single 1600 bytes packet, as tc does. Level is read only.
+type HtbClass struct {
+	Rate    uint64
+	Ceil    uint64
+	Burst   uint32
+	Cburst  uint32
+	Quantum uint32
+	Level   uint32
+	Prio    uint32
+}
+
+// Netem is the network emulator qdisc. Probabilities are percentages and
+// Rate is in bytes per second. A zero Limit uses the default of 1000
+// packets.
+type Netem struct {
+	Latency       time.Duration
+	Jitter        time.Duration
+	Limit         uint32
+	Loss          float64
+	Gap           uint32
+	Duplicate     float64
+	DelayCorr     float64
+	LossCorr      float64
+	DuplicateCorr float64
+	Reorder       float64
+	ReorderCorr   float64
+	Corrupt       float64
+	CorruptCorr   float64
+	Rate          uint64
+	ECN           bool
+}
+
+// Clsact is the qdisc holding the ingress and egress filters of a link,
+// see TC_H_MIN_INGRESS and TC_H_MIN_EGRESS.
+type Clsact struct{}
+
+type Ingress struct{}
+
+func (info *Fifo) Kind() string {
+	return info.KindName
+}
+
+func (info *Fifo) Options() []byte {
+	if info.Limit == 0 {
+		return nil
+	}
+	b := make([]byte, SizeofTcFifoQopt)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = info.Limit
+	return b
+}
+
+func (info *Fifo) ParseOptions(data []byte) error {
+	if len(data) >= SizeofTcFifoQopt {
+		info.Limit = *(*uint32)(unsafe.Pointer(&data[0:4][0]))
+	}
+	return nil
+}
+
+func parsePrioQopt(data []byte, bands *int32, priomap *[TC_PRIO_MAX + 1]uint8) {
+	if len(data) < SizeofTcPrioQopt {
+		return
+	}
+	*bands = *(*int32)(unsafe.Pointer(&data[0:4][0]))
+	copy(priomap[:], data[4:SizeofTcPrioQopt])
+}
+
+func (info *PfifoFast) Kind() string {
+	return "pfifo_fast"
+}
+
+func (info *PfifoFast) Options() []byte {
+	return nil
+}
+
+func (info *PfifoFast) ParseOptions(data []byte) error {
+	parsePrioQopt(data, &info.Bands, &info.PrioMap)
+	return nil
+}
+
+func (info *Prio) Kind() string {
+	return "prio"
+}
+
+func (info *Prio) Options() []byte {
+	bands := info.Bands
+	priomap := info.PrioMap
+	if bands == 0 {
+		bands = 3
+		priomap = [TC_PRIO_MAX + 1]uint8{1, 2, 2, 2, 1, 2, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1}
+	}
+	b := make([]byte, SizeofTcPrioQopt)
+	*(*int32)(unsafe.Pointer(&b[0:4][0])) = bands
+	copy(b[4:], priomap[:])
+	return b
+}
+
+func (info *Prio) ParseOptions(data []byte) error {
+	parsePrioQopt(data, &info.Bands, &info.PrioMap)
+	return nil
+}
+
+func (info *FqCodel) Kind() string {
+	return "fq_codel"
+}
+
+func (info *FqCodel) Options() []byte {
+	attrs := []netlink.NetlinkAttr{}
+	if info.Target != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_TARGET, info.Target))
+	}
+	if info.Limit != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_LIMIT, info.Limit))
+	}
+	if info.Interval != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_INTERVAL, info.Interval))
+	}
+	if info.HasECN {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_ECN, uint32(boolToUint8(info.ECN))))
+	}
+	if info.Flows != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_FLOWS, info.Flows))
+	}
+	if info.Quantum != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_QUANTUM, info.Quantum))
+	}
+	if info.CEThreshold != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_CE_THRESHOLD, info.CEThreshold))
+	}
+	if info.DropBatchSize != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_DROP_BATCH_SIZE, info.DropBatchSize))
+	}
+	if info.MemoryLimit != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_CODEL_MEMORY_LIMIT, info.MemoryLimit))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *FqCodel) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_FQ_CODEL_TARGET:
+			info.Target = attr.Uint32()
+		case TCA_FQ_CODEL_LIMIT:
+			info.Limit = attr.Uint32()
+		case TCA_FQ_CODEL_INTERVAL:
+			info.Interval = attr.Uint32()
+		case TCA_FQ_CODEL_ECN:
+			info.ECN = attr.Uint32() != 0
+			info.HasECN = true
+		case TCA_FQ_CODEL_FLOWS:
+			info.Flows = attr.Uint32()
+		case TCA_FQ_CODEL_QUANTUM:
+			info.Quantum = attr.Uint32()
+		case TCA_FQ_CODEL_CE_THRESHOLD:
+			info.CEThreshold = attr.Uint32()
+		case TCA_FQ_CODEL_DROP_BATCH_SIZE:
+			info.DropBatchSize = attr.Uint32()
+		case TCA_FQ_CODEL_MEMORY_LIMIT:
+			info.MemoryLimit = attr.Uint32()
+		}
+	}
+	return nil
+}
+
+func (info *Fq) Kind() string {
+	return "fq"
+}
+
+func (info *Fq) Options() []byte {
+	attrs := []netlink.NetlinkAttr{}
+	for _, opt := range []struct {
+		attrtype uint16
+		value    uint32
+	}{
+		{TCA_FQ_PLIMIT, info.PLimit},
+		{TCA_FQ_FLOW_PLIMIT, info.FlowPLimit},
+		{TCA_FQ_QUANTUM, info.Quantum},
+		{TCA_FQ_INITIAL_QUANTUM, info.InitialQuantum},
+		{TCA_FQ_FLOW_DEFAULT_RATE, info.FlowDefaultRate},
+		{TCA_FQ_FLOW_MAX_RATE, info.FlowMaxRate},
+		{TCA_FQ_BUCKETS_LOG, info.BucketsLog},
+		{TCA_FQ_FLOW_REFILL_DELAY, info.FlowRefillDelay},
+		{TCA_FQ_LOW_RATE_THRESHOLD, info.LowRateThreshold},
+		{TCA_FQ_CE_THRESHOLD, info.CEThreshold},
+		{TCA_FQ_HORIZON, info.Horizon},
+	} {
+		if opt.value != 0 {
+			attrs = append(attrs, netlink.NewAttrUint32(opt.attrtype, opt.value))
+		}
+	}
+	if info.HasPacing {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_FQ_RATE_ENABLE, uint32(boolToUint8(info.Pacing))))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *Fq) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_FQ_PLIMIT:
+			info.PLimit = attr.Uint32()
+		case TCA_FQ_FLOW_PLIMIT:
+			info.FlowPLimit = attr.Uint32()
+		case TCA_FQ_QUANTUM:
+			info.Quantum = attr.Uint32()
+		case TCA_FQ_INITIAL_QUANTUM:
+			info.InitialQuantum = attr.Uint32()
+		case TCA_FQ_RATE_ENABLE:
+			info.Pacing = attr.Uint32() != 0
+			info.HasPacing = true
+		case TCA_FQ_FLOW_DEFAULT_RATE:
+			info.FlowDefaultRate = attr.Uint32()
+		case TCA_FQ_FLOW_MAX_RATE:
+			info.FlowMaxRate = attr.Uint32()
+		case TCA_FQ_BUCKETS_LOG:
+			info.BucketsLog = attr.Uint32()
+		case TCA_FQ_FLOW_REFILL_DELAY:
+			info.FlowRefillDelay = attr.Uint32()
+		case TCA_FQ_LOW_RATE_THRESHOLD:
+			info.LowRateThreshold = attr.Uint32()
+		case TCA_FQ_CE_THRESHOLD:
+			info.CEThreshold = attr.Uint32()
+		case TCA_FQ_HORIZON:
+			info.Horizon = attr.Uint32()
+		}
+	}
+	return nil
+}
+
+func (info *Tbf) Kind() string {
+	return "tbf"
+}
+
+func (info *Tbf) Options() []byte {
+	b := make([]byte, SizeofTcTbfQopt)
+	copy(b[0:12], rateSpec(info.Rate).toWireFormat())
+	if info.PeakRate != 0 {
+		copy(b[12:24], rateSpec(info.PeakRate).toWireFormat())
+		*(*uint32)(unsafe.Pointer(&b[32:36][0])) = xmitTicks(info.PeakRate, info.Mtu)
+	}
+	*(*uint32)(unsafe.Pointer(&b[24:28][0])) = info.Limit
+	*(*uint32)(unsafe.Pointer(&b[28:32][0])) = xmitTicks(info.Rate, info.Burst)
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_TBF_PARMS, b),
+		netlink.NewAttrUint32(TCA_TBF_BURST, info.Burst),
+	}
+	if info.Rate >= 0xffffffff {
+		attrs = append(attrs, netlink.NewAttrUint64(TCA_TBF_RATE64, info.Rate))
+	}
+	if info.PeakRate != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_TBF_PBURST, info.Mtu))
+		if info.PeakRate >= 0xffffffff {
+			attrs = append(attrs, netlink.NewAttrUint64(TCA_TBF_PRATE64, info.PeakRate))
+		}
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *Tbf) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+
+	var buffer, mtu uint32
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_TBF_PARMS:
+			if len(attr.Data) < SizeofTcTbfQopt {
+				return errors.New("short tc_tbf_qopt")
+			}
+			if info.Rate == 0 {
+				info.Rate = uint64(TcRateSpecfromWireFormat(attr.Data[0:12]).Rate)
+			}
+			if info.PeakRate == 0 {
+				info.PeakRate = uint64(TcRateSpecfromWireFormat(attr.Data[12:24]).Rate)
+			}
+			info.Limit = *(*uint32)(unsafe.Pointer(&attr.Data[24:28][0]))
+			buffer = *(*uint32)(unsafe.Pointer(&attr.Data[28:32][0]))
+			mtu = *(*uint32)(unsafe.Pointer(&attr.Data[32:36][0]))
+		case TCA_TBF_RATE64:
+			info.Rate = attr.Uint64()
+		case TCA_TBF_PRATE64:
+			info.PeakRate = attr.Uint64()
+		}
+	}
+
+	info.Burst = xmitSize(info.Rate, buffer)
+	info.Mtu = xmitSize(info.PeakRate, mtu)
+
+	return nil
+}
+
+func (info *Htb) Kind() string {
+	return "htb"
+}
+
+func (info *Htb) Options() []byte {
+	r2q := info.Rate2Quantum
+	if r2q == 0 {
+		r2q = 10
+	}
+
+	b := make([]byte, SizeofTcHtbGlob)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = htbVersion
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = r2q
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = info.Defcls
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_HTB_INIT, b),
+	}
+	if info.DirectQlen != 0 {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_HTB_DIRECT_QLEN, info.DirectQlen))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *Htb) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_HTB_INIT:
+			if len(attr.Data) >= SizeofTcHtbGlob {
+				info.Rate2Quantum = *(*uint32)(unsafe.Pointer(&attr.Data[4:8][0]))
+				info.Defcls = *(*uint32)(unsafe.Pointer(&attr.Data[8:12][0]))
+				info.DirectPkts = *(*uint32)(unsafe.Pointer(&attr.Data[16:20][0]))
+			}
+		case TCA_HTB_DIRECT_QLEN:
+			info.DirectQlen = attr.Uint32()
+		}
+	}
+	return nil
+}
+
+func (info *HtbClass) Kind() string {
+	return "htb"
+}
+
+func (info *HtbClass) Options() []byte {
+	ceil := info.Ceil
+	if ceil == 0 {
+		ceil = info.Rate
+	}
+	burst := info.Burst
+	if burst == 0 {
+		burst = htbMtu
+	}
+	cburst := info.Cburst
+	if cburst == 0 {
+		cburst = htbMtu
+	}
+
+	b := make([]byte, SizeofTcHtbOpt)
+	copy(b[0:12], rateSpec(info.Rate).toWireFormat())
+	copy(b[12:24], rateSpec(ceil).toWireFormat())
+	*(*uint32)(unsafe.Pointer(&b[24:28][0])) = xmitTicks(info.Rate, burst)
+	*(*uint32)(unsafe.Pointer(&b[28:32][0])) = xmitTicks(ceil, cburst)
+	*(*uint32)(unsafe.Pointer(&b[32:36][0])) = info.Quantum
+	*(*uint32)(unsafe.Pointer(&b[40:44][0])) = info.Prio
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_HTB_PARMS, b),
+	}
+	if info.Rate >= 0xffffffff {
+		attrs = append(attrs, netlink.NewAttrUint64(TCA_HTB_RATE64, info.Rate))
+	}
+	if ceil >= 0xffffffff {
+		attrs = append(attrs, netlink.NewAttrUint64(TCA_HTB_CEIL64, ceil))
+	}
+	return netlink.AttrsToWireFormat(attrs)
+}
+
+func (info *HtbClass) ParseOptions(data []byte) error {
+	attrs, err := netlink.ParseNetlinkAttrs(data)
+	if err != nil {
+		return err
+	}
+
+	var buffer, cbuffer uint32
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_HTB_PARMS:
+			if len(attr.Data) < SizeofTcHtbOpt {
+				return errors.New("short tc_htb_opt")
+			}
+			if info.Rate == 0 {
+				info.Rate = uint64(TcRateSpecfromWireFormat(attr.Data[0:12]).Rate)
+			}
+			if info.Ceil == 0 {
+				info.Ceil = uint64(TcRateSpecfromWireFormat(attr.Data[12:24]).Rate)
+			}
+			buffer = *(*uint32)(unsafe.Pointer(&attr.Data[24:28][0]))
+			cbuffer = *(*uint32)(unsafe.Pointer(&attr.Data[28:32][0]))
+			info.Quantum = *(*uint32)(unsafe.Pointer(&attr.Data[32:36][0]))
+			info.Level = *(*uint32)(unsafe.Pointer(&attr.Data[36:40][0]))
+			info.Prio = *(*uint32)(unsafe.Pointer(&attr.Data[40:44][0]))
+		case TCA_HTB_RATE64:
+			info.Rate = attr.Uint64()
+		case TCA_HTB_CEIL64:
+			info.Ceil = attr.Uint64()
+		}
+	}
+
+	info.Burst = xmitSize(info.Rate, buffer)
+	info.Cburst = xmitSize(info.Ceil, cbuffer)
+
+	return nil
+}
+
+// probability scales a percentage to the kernel 32 bit representation.
+func probability(percent float64) uint32 {
+	if percent >= 100 {
+		return 0xffffffff
+	}
+	return uint32(percent / 100 * 0xffffffff)
+}
+
+func percentage(prob uint32) float64 {
+	return float64(prob) * 100 / 0xffffffff
+}
+
+func (info *Netem) Kind() string {
+	return "netem"
+}
+
+func (info *Netem) Options() []byte {
+	limit := info.Limit
+	if limit == 0 {
+		limit = 1000
+	}
+
+	b := make([]byte, SizeofTcNetemQopt)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = uint32(info.Latency.Nanoseconds() >> pschedShift)
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = limit
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = probability(info.Loss)
+	*(*uint32)(unsafe.Pointer(&b[12:16][0])) = info.Gap
+	*(*uint32)(unsafe.Pointer(&b[16:20][0])) = probability(info.Duplicate)
+	*(*uint32)(unsafe.Pointer(&b[20:24][0])) = uint32(info.Jitter.Nanoseconds() >> pschedShift)
+
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrUint64(TCA_NETEM_LATENCY64, uint64(info.Latency.Nanoseconds())),
+		netlink.NewAttrUint64(TCA_NETEM_JITTER64, uint64(info.Jitter.Nanoseconds())),
+	}
+
+	if info.DelayCorr != 0 || info.LossCorr != 0 || info.DuplicateCorr != 0 {
+		corr := make([]byte, 12)
+		*(*uint32)(unsafe.Pointer(&corr[0:4][0])) = probability(info.DelayCorr)
+		*(*uint32)(unsafe.Pointer(&corr[4:8][0])) = probability(info.LossCorr)
+		*(*uint32)(unsafe.Pointer(&corr[8:12][0])) = probability(info.DuplicateCorr)
+		attrs = append(attrs, netlink.NewAttr(TCA_NETEM_CORR, corr))
+	}
+	if info.Reorder != 0 {
+		reorder := make([]byte, 8)
+		*(*uint32)(unsafe.Pointer(&reorder[0:4][0])) = probability(info.Reorder)
+		*(*uint32)(unsafe.Pointer(&reorder[4:8][0])) = probability(info.ReorderCorr)
+		attrs = append(attrs, netlink.NewAttr(TCA_NETEM_REORDER, reorder))
+	}
+	if info.Corrupt != 0 {
+		corrupt := make([]byte, 8)
+		*(*uint32)(unsafe.Pointer(&corrupt[0:4][0])) = probability(info.Corrupt)
+		*(*uint32)(unsafe.Pointer(&corrupt[4:8][0])) = probability(info.CorruptCorr)
+		attrs = append(attrs, netlink.NewAttr(TCA_NETEM_CORRUPT, corrupt))
+	}
+	if info.Rate != 0 {
+		rate := make([]byte, SizeofTcNetemRate)
+		*(*uint32)(unsafe.Pointer(&rate[0:4][0])) = rateSpec(info.Rate).Rate
+		attrs = append(attrs, netlink.NewAttr(TCA_NETEM_RATE, rate))
+		if info.Rate >= 0xffffffff {
+			attrs = append(attrs, netlink.NewAttrUint64(TCA_NETEM_RATE64, info.Rate))
+		}
+	}
+	if info.ECN {
+		attrs = append(attrs, netlink.NewAttrUint32(TCA_NETEM_ECN, 1))
+	}
+
+	return append(b, netlink.AttrsToWireFormat(attrs)...)
+}
+
+func (info *Netem) ParseOptions(data []byte) error {
+	if len(data) < SizeofTcNetemQopt {
+		return errors.New("short tc_netem_qopt")
+	}
+
+	info.Latency = time.Duration(int64(*(*uint32)(unsafe.Pointer(&data[0:4][0]))) << pschedShift)
+	info.Limit = *(*uint32)(unsafe.Pointer(&data[4:8][0]))
+	info.Loss = percentage(*(*uint32)(unsafe.Pointer(&data[8:12][0])))
+	info.Gap = *(*uint32)(unsafe.Pointer(&data[12:16][0]))
+	info.Duplicate = percentage(*(*uint32)(unsafe.Pointer(&data[16:20][0])))
+	info.Jitter = time.Duration(int64(*(*uint32)(unsafe.Pointer(&data[20:24][0]))) << pschedShift)
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofTcNetemQopt:])
+	if err != nil {
+		return err
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case TCA_NETEM_LATENCY64:
+			info.Latency = time.Duration(attr.Uint64())
+		case TCA_NETEM_JITTER64:
+			info.Jitter = time.Duration(attr.Uint64())
+		case TCA_NETEM_CORR:
+			if len(attr.Data) >= 12 {
+				info.DelayCorr = percentage(*(*uint32)(unsafe.Pointer(&attr.Data[0:4][0])))
+				info.LossCorr = percentage(*(*uint32)(unsafe.Pointer(&attr.Data[4:8][0])))
+				info.DuplicateCorr = percentage(*(*uint32)(unsafe.Pointer(&attr.Data[8:12][0])))
+			}
+		case TCA_NETEM_REORDER:
+			if len(attr.Data) >= 8 {
+				info.Reorder = percentage(*(*uint32)(unsafe.Pointer(&attr.Data[0:4][0])))
+				info.ReorderCorr = percentage(*(*uint32)(unsafe.Pointer(&attr.Data[4:8][0])))
+			}
+		case TCA_NETEM_CORRUPT:
+			if len(attr.Data) >= 8 {
+				info.Corrupt = percentage(*(*uint32)(unsafe.Pointer(&attr.Data[0:4][0])))
+				info.CorruptCorr = percentage(*(*uint32)(unsafe.Pointer(&attr.Data[4:8][0])))
+			}
+		case TCA_NETEM_RATE:
+			if len(attr.Data) >= 4 && info.Rate == 0 {
+				info.Rate = uint64(*(*uint32)(unsafe.Pointer(&attr.Data[0:4][0])))
+			}
+		case TCA_NETEM_RATE64:
+			info.Rate = attr.Uint64()
+		case TCA_NETEM_ECN:
+			info.ECN = attr.Uint32() != 0
+		}
+	}
+
+	return nil
+}
+
+func (info *Clsact) Kind() string {
+	return "clsact"
+}
+
+func (info *Clsact) Options() []byte {
+	return nil
+}
+
+func (info *Clsact) ParseOptions(data []byte) error {
+	return nil
+}
+
+func (info *Ingress) Kind() string {
+	return "ingress"
+}
+
+func (info *Ingress) Options() []byte {
+	return nil
+}
+
+func (info *Ingress) ParseOptions(data []byte) error {
+	return nil
+}
@@ -0,0 +1,438 @@
+package route
+
+import (
+	"math"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestHandles(t *testing.T) {
+	h := MakeHandle(0x10, 0x20)
+	if h != 0x100020 || HandleMajor(h) != 0x10 || HandleMinor(h) != 0x20 {
+		t.Errorf("handle %#x", h)
+	}
+	if HandleMajor(TC_H_ROOT) != 0xffff || HandleMinor(TC_H_ROOT) != 0xffff {
+		t.Error("root handle")
+	}
+}
+
+func TestTcMsgWireFormat(t *testing.T) {
+	tcm := &TcMsg{Family: syscall.AF_UNSPEC, Index: 3, Handle: MakeHandle(1, 0), Parent: TC_H_ROOT, Info: 0x12345678}
+
+	b := tcm.toWireFormat()
+	if len(b) != SizeofTcMsg {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := TcMsgfromWireFormat(b); *got != *tcm {
+		t.Errorf("got %+v, want %+v", got, tcm)
+	}
+}
+
+func TestTcRateSpecWireFormat(t *testing.T) {
+	rs := &TcRateSpec{CellLog: 3, Linklayer: TC_LINKLAYER_ATM, Overhead: 10, CellAlign: -1, Mpu: 64, Rate: 125000}
+
+	b := rs.toWireFormat()
+	if len(b) != SizeofTcRateSpec {
+		t.Fatalf("got %d bytes", len(b))
+	}
+	if got := TcRateSpecfromWireFormat(b); *got != *rs {
+		t.Errorf("got %+v, want %+v", got, rs)
+	}
+
+	/* rates that do not fit go in the 64 bit attributes */
+	if rs := rateSpec(1 << 40); rs.Rate != 0xffffffff || rs.Linklayer != TC_LINKLAYER_ETHERNET {
+		t.Errorf("got %+v", rs)
+	}
+	if rs := rateSpec(125000); rs.Rate != 125000 {
+		t.Errorf("got %+v", rs)
+	}
+}
+
+func TestXmitTicks(t *testing.T) {
+	tests := []struct {
+		rate  uint64
+		size  uint32
+		ticks uint32
+	}{
+		/* 1500 bytes at 1mbit take 12ms, 187500 ticks of 64ns */
+		{125000, 1500, 187500},
+		{125000000, 1600, 200},
+		{1250000000, 64000, 800},
+		{0, 1500, 0},
+	}
+
+	for _, test := range tests {
+		if got := xmitTicks(test.rate, test.size); got != test.ticks {
+			t.Errorf("xmitTicks(%d, %d) = %d, want %d", test.rate, test.size, got, test.ticks)
+		}
+		if test.rate != 0 {
+			if got := xmitSize(test.rate, test.ticks); got != test.size {
+				t.Errorf("xmitSize(%d, %d) = %d, want %d", test.rate, test.ticks, got, test.size)
+			}
+		}
+	}
+
+	/* the conversion back loses at most the bytes sent in a tick, as long
+	   as the ticks fit the 32 bits the kernel has for them */
+	for _, rate := range []uint64{1000, 125000, 12500000, 1250000000, 12500000000} {
+		for _, size := range []uint32{1, 1514, 10000, 1 << 20, math.MaxUint32 / 2} {
+			if uint64(size)*1000000000/rate>>pschedShift > math.MaxUint32 {
+				continue
+			}
+			got := xmitSize(rate, xmitTicks(rate, size))
+			if got > size || uint64(size-got) > rate*64/1000000000+1 {
+				t.Errorf("rate %d size %d: got %d back", rate, size, got)
+			}
+		}
+	}
+}
+
+func TestTcStatsfromAttrs(t *testing.T) {
+	basic := make([]byte, SizeofGnetStatsBasic)
+	basic[0] = 100
+	basic[8] = 2
+	est := make([]byte, SizeofGnetStatsRateEst)
+	est[0] = 10
+	est[4] = 1
+	queue := make([]byte, SizeofGnetStatsQueue)
+	queue[0], queue[4], queue[8], queue[12], queue[16] = 1, 2, 3, 4, 5
+
+	st := TcStatsfromAttrs([]netlink.NetlinkAttr{
+		netlink.NewAttr(TCA_STATS_BASIC, basic),
+		netlink.NewAttr(TCA_STATS_RATE_EST, est),
+		netlink.NewAttr(TCA_STATS_QUEUE, queue),
+	})
+	if *st != (TcStats{Bytes: 100, Packets: 2, Bps: 10, Pps: 1, Qlen: 1, Backlog: 2, Drops: 3, Requeues: 4, Overlimits: 5}) {
+		t.Errorf("got %+v", st)
+	}
+
+	/* the 64 bit counters win whatever their order */
+	est64 := make([]byte, SizeofGnetStatsRateEst64)
+	est64[4] = 1
+	st = TcStatsfromAttrs([]netlink.NetlinkAttr{
+		netlink.NewAttrUint64(TCA_STATS_PKT64, 1<<33),
+		netlink.NewAttr(TCA_STATS_RATE_EST64, est64),
+		netlink.NewAttr(TCA_STATS_BASIC, basic),
+		netlink.NewAttr(TCA_STATS_RATE_EST, est),
+	})
+	if st.Packets != 1<<33 || st.Bps != 1<<32 || st.Bytes != 100 {
+		t.Errorf("got %+v", st)
+	}
+}
+
+// qdiscRoundTrip encodes info in a qdisc message and decodes it back.
+func qdiscRoundTrip(t *testing.T, info TcInfo) TcInfo {
+	t.Helper()
+	q, err := QdiscfromWireFormat((&Qdisc{Index: 2, Handle: MakeHandle(1, 0), Parent: TC_H_ROOT, Info: info}).toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Index != 2 || q.Handle != MakeHandle(1, 0) || q.Parent != TC_H_ROOT || q.Info == nil || q.Info.Kind() != info.Kind() {
+		t.Fatalf("%s: got %+v", info.Kind(), q)
+	}
+	return q.Info
+}
+
+func TestQdiscKinds(t *testing.T) {
+	if got := qdiscRoundTrip(t, &Fifo{KindName: "bfifo", Limit: 10000}).(*Fifo); got.Limit != 10000 {
+		t.Errorf("bfifo: got %+v", got)
+	}
+	if (&Fifo{KindName: "pfifo"}).Options() != nil {
+		t.Error("default fifo limit sent")
+	}
+
+	/* the default prio map is the one of pfifo_fast */
+	prio := qdiscRoundTrip(t, &Prio{}).(*Prio)
+	if prio.Bands != 3 || prio.PrioMap != [TC_PRIO_MAX + 1]uint8{1, 2, 2, 2, 1, 2, 0, 0, 1, 1, 1, 1, 1, 1, 1, 1} {
+		t.Errorf("prio: got %+v", prio)
+	}
+
+	fqc := &FqCodel{Target: 5000, Limit: 10240, Interval: 100000, ECN: false, HasECN: true, Flows: 1024, Quantum: 1514, CEThreshold: 1000}
+	if got := qdiscRoundTrip(t, fqc).(*FqCodel); *got != *fqc {
+		t.Errorf("fq_codel: got %+v, want %+v", got, fqc)
+	}
+
+	fq := &Fq{PLimit: 10000, FlowPLimit: 100, Pacing: true, HasPacing: true, FlowMaxRate: 125000, Horizon: 10000000}
+	if got := qdiscRoundTrip(t, fq).(*Fq); *got != *fq {
+		t.Errorf("fq: got %+v, want %+v", got, fq)
+	}
+
+	for _, info := range []TcInfo{&Clsact{}, &Ingress{}} {
+		qdiscRoundTrip(t, info)
+	}
+
+	q, err := QdiscfromWireFormat((&Qdisc{Info: &GenericTcInfo{KindName: "cake", Data: []byte{4, 0, 1, 0}}}).toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g, ok := q.Info.(*GenericTcInfo); !ok || g.KindName != "cake" || len(g.Data) != 4 {
+		t.Errorf("unknown kind: got %#v", q.Info)
+	}
+
+	if _, err := QdiscfromWireFormat(make([]byte, SizeofTcMsg-1)); err == nil {
+		t.Error("short tcmsg accepted")
+	}
+}
+
+func TestTbfOptions(t *testing.T) {
+	tbf := &Tbf{Rate: 125000, Burst: 10000, Limit: 20000, PeakRate: 250000, Mtu: 1600}
+
+	got := qdiscRoundTrip(t, tbf).(*Tbf)
+	if *got != *tbf {
+		t.Errorf("got %+v, want %+v", got, tbf)
+	}
+
+	attrs, _ := netlink.ParseNetlinkAttrs(tbf.Options())
+	parms, _ := findAttr(attrs, TCA_TBF_PARMS)
+	rate := TcRateSpecfromWireFormat(parms.Data[0:12])
+	if rate.Rate != 125000 || rate.Linklayer != TC_LINKLAYER_ETHERNET {
+		t.Errorf("rate %+v", rate)
+	}
+	if _, ok := findAttr(attrs, TCA_TBF_RATE64); ok {
+		t.Error("TCA_TBF_RATE64 sent for a 32 bit rate")
+	}
+
+	/* 100gbit needs the 64 bit rate */
+	fast := &Tbf{Rate: 12500000000, Burst: 1 << 20, Limit: 1 << 21}
+	got = qdiscRoundTrip(t, fast).(*Tbf)
+	if got.Rate != fast.Rate || got.PeakRate != 0 || got.Burst > fast.Burst || fast.Burst-got.Burst > 800 {
+		t.Errorf("got %+v, want %+v", got, fast)
+	}
+}
+
+func TestHtbOptions(t *testing.T) {
+	htb := &Htb{Rate2Quantum: 10, Defcls: 0x20, DirectQlen: 100}
+	if got := qdiscRoundTrip(t, htb).(*Htb); *got != *htb {
+		t.Errorf("got %+v, want %+v", got, htb)
+	}
+	if got := qdiscRoundTrip(t, &Htb{}).(*Htb); got.Rate2Quantum != 10 {
+		t.Errorf("default r2q %d", got.Rate2Quantum)
+	}
+
+	class := &HtbClass{Rate: 125000, Ceil: 250000, Burst: 15000, Cburst: 3000, Quantum: 1500, Prio: 1}
+	c, err := TcClassfromWireFormat((&TcClass{Index: 2, Handle: MakeHandle(1, 10), Parent: MakeHandle(1, 0), Info: class}).toWireFormat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := c.Info.(*HtbClass); !ok || *got != *class || c.Handle != MakeHandle(1, 10) {
+		t.Errorf("got %+v %+v, want %+v", c, c.Info, class)
+	}
+
+	/* the ceiling defaults to the rate and bursts to a packet of htbMtu bytes */
+	c, _ = TcClassfromWireFormat((&TcClass{Info: &HtbClass{Rate: 125000}}).toWireFormat())
+	if got := c.Info.(*HtbClass); got.Ceil != 125000 || got.Burst != htbMtu || got.Cburst != htbMtu {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestNetemOptions(t *testing.T) {
+	/* percentages survive the 32 bit scale only at its ends */
+	netem := &Netem{
+		Latency:     100 * time.Millisecond,
+		Jitter:      10 * time.Millisecond,
+		Limit:       500,
+		Loss:        100,
+		Gap:         5,
+		Duplicate:   0,
+		DelayCorr:   100,
+		Reorder:     100,
+		ReorderCorr: 0,
+		Corrupt:     100,
+		Rate:        125000,
+		ECN:         true,
+	}
+
+	got := qdiscRoundTrip(t, netem).(*Netem)
+	if *got != *netem {
+		t.Errorf("got %+v, want %+v", got, netem)
+	}
+
+	opts := (&Netem{Latency: 100 * time.Millisecond}).Options()
+	if *(*uint32)(unsafe.Pointer(&opts[0:4][0])) != uint32(100*time.Millisecond>>pschedShift) {
+		t.Errorf("latency ticks % x", opts[0:4])
+	}
+	if got := qdiscRoundTrip(t, &Netem{}).(*Netem); got.Limit != 1000 {
+		t.Errorf("default limit %d", got.Limit)
+	}
+
+	if probability(50) != 0x7fffffff || probability(200) != 0xffffffff || percentage(0xffffffff) != 100 {
+		t.Error("probability scale")
+	}
+}
+
+func TestQdiscDefaults(t *testing.T) {
+	q := (&Qdisc{Info: &Clsact{}}).withDefaults()
+	if q.Parent != TC_H_CLSACT || q.Handle != MakeHandle(0xffff, 0) {
+		t.Errorf("clsact: got %+v", q)
+	}
+	q = (&Qdisc{Info: &Tbf{}}).withDefaults()
+	if q.Parent != TC_H_ROOT || q.Handle != TC_H_UNSPEC {
+		t.Errorf("tbf: got %+v", q)
+	}
+}
+
+// skipUnknownKind skips the test when the kernel lacks a qdisc, class,
+// filter or action kind.
+func skipUnknownKind(t *testing.T, err error) {
+	t.Helper()
+	if err == syscall.ENOENT {
+		t.Skipf("kind unknown to the kernel: %v", err)
+	}
+	skipUnsupported(t, err)
+}
+
+func TestQdiscs(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	veth := mustLink(t, rl, "veth0")
+
+	tbf := &Tbf{Rate: 125000, Burst: 10000, Limit: 20000}
+	err = rl.AddQdisc(&Qdisc{Index: veth.Index, Handle: MakeHandle(1, 0), Info: tbf})
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.AddQdisc(&Qdisc{Index: veth.Index, Handle: MakeHandle(1, 0), Info: tbf})
+	if err != syscall.EEXIST {
+		t.Errorf("adding tbf again: %v", err)
+	}
+
+	qdiscs, err := rl.ListQdiscs(veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(qdiscs) != 1 || qdiscs[0].Parent != TC_H_ROOT || qdiscs[0].Handle != MakeHandle(1, 0) || qdiscs[0].Stats == nil {
+		t.Fatalf("qdiscs of veth0: %+v", qdiscs)
+	}
+	if got, ok := qdiscs[0].Info.(*Tbf); !ok || got.Rate != 125000 || got.Burst != 10000 || got.Limit != 20000 {
+		t.Errorf("tbf: got %+v", qdiscs[0].Info)
+	}
+
+	tbf.Rate = 250000
+	err = rl.ChangeQdisc(&Qdisc{Index: veth.Index, Handle: MakeHandle(1, 0), Info: tbf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qdiscs, _ = rl.ListQdiscs(veth.Index)
+	if len(qdiscs) != 1 || qdiscs[0].Info.(*Tbf).Rate != 250000 {
+		t.Errorf("changed tbf: %+v", qdiscs)
+	}
+
+	err = rl.ReplaceQdisc(&Qdisc{Index: veth.Index, Handle: MakeHandle(2, 0), Info: &Fifo{KindName: "pfifo", Limit: 50}})
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qdiscs, _ = rl.ListQdiscs(veth.Index)
+	if len(qdiscs) != 1 || qdiscs[0].Handle != MakeHandle(2, 0) {
+		t.Fatalf("replaced qdisc: %+v", qdiscs)
+	}
+	if got, ok := qdiscs[0].Info.(*Fifo); !ok || got.KindName != "pfifo" || got.Limit != 50 {
+		t.Errorf("pfifo: got %+v", qdiscs[0].Info)
+	}
+
+	err = rl.AddQdisc(&Qdisc{Index: veth.Index, Info: &Clsact{}})
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qdiscs, _ = rl.ListQdiscs(veth.Index)
+	if len(qdiscs) != 2 {
+		t.Errorf("qdiscs with clsact: %+v", qdiscs)
+	}
+
+	err = rl.DelQdisc(&Qdisc{Index: veth.Index, Info: &Clsact{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.DelQdisc(&Qdisc{Index: veth.Index, Handle: MakeHandle(2, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	qdiscs, _ = rl.ListQdiscs(veth.Index)
+	for _, q := range qdiscs {
+		if q.Handle == MakeHandle(2, 0) || q.Info.Kind() == "clsact" {
+			t.Errorf("deleted qdisc still listed: %+v", q)
+		}
+	}
+}
+
+func TestClasses(t *testing.T) {
+	rl := testNetns(t)
+
+	err := rl.AddLink(&Link{Name: "veth0", Info: &Veth{PeerName: "veth1"}})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	veth := mustLink(t, rl, "veth0")
+
+	err = rl.AddQdisc(&Qdisc{Index: veth.Index, Handle: MakeHandle(1, 0), Info: &Htb{Defcls: 20}})
+	skipUnknownKind(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	classes := []*TcClass{
+		{Index: veth.Index, Parent: MakeHandle(1, 0), Handle: MakeHandle(1, 1), Info: &HtbClass{Rate: 12500000}},
+		{Index: veth.Index, Parent: MakeHandle(1, 1), Handle: MakeHandle(1, 10), Info: &HtbClass{Rate: 1250000, Ceil: 12500000, Prio: 1}},
+		{Index: veth.Index, Parent: MakeHandle(1, 1), Handle: MakeHandle(1, 20), Info: &HtbClass{Rate: 125000, Burst: 15000}},
+	}
+	for _, c := range classes {
+		err := rl.AddClass(c)
+		if err != nil {
+			t.Fatalf("class %#x: %v", c.Handle, err)
+		}
+	}
+
+	got, err := rl.ListClasses(veth.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byHandle := map[uint32]*TcClass{}
+	for _, c := range got {
+		byHandle[c.Handle] = c
+	}
+	if len(byHandle) != 3 {
+		t.Fatalf("classes: %+v", got)
+	}
+	if c := byHandle[MakeHandle(1, 1)].Info.(*HtbClass); c.Rate != 12500000 || c.Ceil != 12500000 || c.Level == 0 {
+		t.Errorf("class 1:1: %+v", c)
+	}
+	if c := byHandle[MakeHandle(1, 10)].Info.(*HtbClass); c.Rate != 1250000 || c.Ceil != 12500000 || c.Prio != 1 {
+		t.Errorf("class 1:10: %+v", c)
+	}
+	if c := byHandle[MakeHandle(1, 20)].Info.(*HtbClass); c.Burst != 15000 || c.Cburst != htbMtu {
+		t.Errorf("class 1:20: %+v", c)
+	}
+	if c := byHandle[MakeHandle(1, 20)]; c.Parent != MakeHandle(1, 1) || c.Stats == nil {
+		t.Errorf("class 1:20: %+v", c)
+	}
+
+	err = rl.ReplaceClass(&TcClass{Index: veth.Index, Parent: MakeHandle(1, 1), Handle: MakeHandle(1, 20), Info: &HtbClass{Rate: 250000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.DelClass(classes[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = rl.ListClasses(veth.Index)
+	for _, c := range got {
+		if c.Handle == MakeHandle(1, 10) {
+			t.Error("deleted class still listed")
+		}
+		if c.Handle == MakeHandle(1, 20) && c.Info.(*HtbClass).Rate != 250000 {
+			t.Errorf("replaced class: %+v", c.Info)
+		}
+	}
+}
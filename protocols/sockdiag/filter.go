@@ -0,0 +1,180 @@
+package sockdiag
+
+import (
+	"net"
+	"syscall"
+	"unsafe"
+)
+
+// InetDiagFilter is inet_diag bytecode, run by the kernel against every
+// socket of a dump. Filters are built from the conditions below and
+// combined with And, Or and Not, the way ss compiles its expressions. An
+// empty filter matches every socket.
+type InetDiagFilter []byte
+
+const sizeofInetDiagBcOp = 4
+
+// bcOp builds a struct inet_diag_bc_op. The kernel moves yes bytes forward
+// when the condition holds and no bytes otherwise, accepting the socket if
+// it lands exactly at the end of the program.
+func bcOp(code, yes uint8, no uint16) []byte {
+	b := make([]byte, sizeofInetDiagBcOp)
+	b[0] = code
+	b[1] = yes
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = no
+	return b
+}
+
+// bcLeaf builds a condition followed by its arguments, jumping past the end
+// of the program when it does not match.
+func bcLeaf(code uint8, args []byte) InetDiagFilter {
+	n := sizeofInetDiagBcOp + len(args)
+	return InetDiagFilter(append(bcOp(code, uint8(n), uint16(n+4)), args...))
+}
+
+func bcPort(code uint8, port uint16) InetDiagFilter {
+	return bcLeaf(code, bcOp(INET_DIAG_BC_NOP, 0, port))
+}
+
+// bcHost matches the addresses in prefix and, unless port is negative, the
+// port. A nil prefix matches any address.
+func bcHost(code uint8, prefix *net.IPNet, port int) InetDiagFilter {
+	family := uint8(syscall.AF_UNSPEC)
+	var addr []byte
+	var plen int
+	if prefix != nil {
+		plen, _ = prefix.Mask.Size()
+		if ip := prefix.IP.To4(); ip != nil && len(prefix.Mask) == net.IPv4len {
+			family = syscall.AF_INET
+			addr = ip
+		} else {
+			family = syscall.AF_INET6
+			addr = prefix.IP.To16()
+		}
+	}
+
+	/* the kernel only takes -1 for any port */
+	if port < 0 {
+		port = -1
+	}
+
+	b := make([]byte, 8+len(addr))
+	b[0] = family
+	b[1] = uint8(plen)
+	*(*int32)(unsafe.Pointer(&b[4:8][0])) = int32(port)
+	copy(b[8:], addr)
+	return bcLeaf(code, b)
+}
+
+// FilterSrc matches the local address and port, see FilterDst.
+func FilterSrc(prefix *net.IPNet, port int) InetDiagFilter {
+	return bcHost(INET_DIAG_BC_S_COND, prefix, port)
+}
+
+// FilterDst matches the remote address against prefix, any address if nil,
+// and the remote port unless port is negative.
+func FilterDst(prefix *net.IPNet, port int) InetDiagFilter {
+	return bcHost(INET_DIAG_BC_D_COND, prefix, port)
+}
+
+func FilterSrcPortEq(port uint16) InetDiagFilter {
+	return bcPort(INET_DIAG_BC_S_EQ, port)
+}
+
+func FilterSrcPortGe(port uint16) InetDiagFilter {
+	return bcPort(INET_DIAG_BC_S_GE, port)
+}
+
+func FilterSrcPortLe(port uint16) InetDiagFilter {
+	return bcPort(INET_DIAG_BC_S_LE, port)
+}
+
+func FilterDstPortEq(port uint16) InetDiagFilter {
+	return bcPort(INET_DIAG_BC_D_EQ, port)
+}
+
+func FilterDstPortGe(port uint16) InetDiagFilter {
+	return bcPort(INET_DIAG_BC_D_GE, port)
+}
+
+func FilterDstPortLe(port uint16) InetDiagFilter {
+	return bcPort(INET_DIAG_BC_D_LE, port)
+}
+
+// FilterDev matches sockets bound to an interface.
+func FilterDev(ifindex uint32) InetDiagFilter {
+	b := make([]byte, 4)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = ifindex
+	return bcLeaf(INET_DIAG_BC_DEV_COND, b)
+}
+
+// FilterMark matches sockets whose mark masked with mask equals mark. The
+// kernel only accepts it from CAP_NET_ADMIN.
+func FilterMark(mark, mask uint32) InetDiagFilter {
+	b := make([]byte, 8)
+	*(*uint32)(unsafe.Pointer(&b[0:4][0])) = mark
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = mask
+	return bcLeaf(INET_DIAG_BC_MARK_COND, b)
+}
+
+// FilterCgroup matches sockets of a cgroup v2, by the inode of its directory.
+func FilterCgroup(id uint64) InetDiagFilter {
+	b := make([]byte, 8)
+	*(*uint64)(unsafe.Pointer(&b[0:8][0])) = id
+	return bcLeaf(INET_DIAG_BC_CGROUP_COND, b)
+}
+
+// FilterAuto matches sockets bound to an automatically assigned port.
+func FilterAuto() InetDiagFilter {
+	return bcLeaf(INET_DIAG_BC_AUTO, nil)
+}
+
+// And matches sockets matching both f and g. The jumps of f rejecting the
+// socket are moved past the end of g.
+func (f InetDiagFilter) And(g InetDiagFilter) InetDiagFilter {
+	if len(f) == 0 {
+		return g
+	}
+	if len(g) == 0 {
+		return f
+	}
+
+	b := make(InetDiagFilter, 0, len(f)+len(g))
+	b = append(b, f...)
+	b = append(b, g...)
+
+	for off := 0; off < len(f); {
+		no := (*uint16)(unsafe.Pointer(&b[off+2 : off+4][0]))
+		if int(*no) == len(f)-off+4 {
+			*no += uint16(len(g))
+		}
+		if b[off+1] == 0 {
+			break
+		}
+		off += int(b[off+1])
+	}
+
+	return b
+}
+
+// Or matches sockets matching f or g. Sockets rejected by f fall through to
+// g, the others jump over it.
+func (f InetDiagFilter) Or(g InetDiagFilter) InetDiagFilter {
+	if len(f) == 0 || len(g) == 0 {
+		return InetDiagFilter{}
+	}
+
+	b := make(InetDiagFilter, 0, len(f)+sizeofInetDiagBcOp+len(g))
+	b = append(b, f...)
+	b = append(b, bcOp(INET_DIAG_BC_JMP, sizeofInetDiagBcOp, uint16(len(g)+sizeofInetDiagBcOp))...)
+	b = append(b, g...)
+	return b
+}
+
+// Not matches sockets f rejects.
+func (f InetDiagFilter) Not() InetDiagFilter {
+	b := make(InetDiagFilter, 0, len(f)+sizeofInetDiagBcOp)
+	b = append(b, f...)
+	b = append(b, bcOp(INET_DIAG_BC_JMP, sizeofInetDiagBcOp, 2*sizeofInetDiagBcOp)...)
+	return b
+}
@@ -0,0 +1,323 @@
+package sockdiag
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// bcEntry is what the kernel runs bytecode against for a socket.
+type bcEntry struct {
+	family       uint8
+	saddr, daddr net.IP
+	sport, dport uint16
+	ifindex      uint32
+	mark         uint32
+	cgroup       uint64
+	userlocks    bool
+}
+
+func (e *bcEntry) String() string {
+	return fmt.Sprintf("%v:%d -> %v:%d", e.saddr, e.sport, e.daddr, e.dport)
+}
+
+func bcUint16(b []byte) uint16 {
+	return *(*uint16)(unsafe.Pointer(&b[0:2][0]))
+}
+
+func bcUint32(b []byte) uint32 {
+	return *(*uint32)(unsafe.Pointer(&b[0:4][0]))
+}
+
+// bcMatch compares the first plen bits of two addresses.
+func bcMatch(a, b []byte, plen int) bool {
+	n := plen / 8
+	if !bytes.Equal(a[:n], b[:n]) {
+		return false
+	}
+	if bits := plen % 8; bits != 0 {
+		mask := byte(0xff << uint(8-bits))
+		return a[n]&mask == b[n]&mask
+	}
+	return true
+}
+
+// bcRun runs bytecode the way inet_diag_bc_run does.
+func bcRun(bc []byte, e *bcEntry) bool {
+	off, left := 0, len(bc)
+	for left > 0 {
+		op := bc[off:]
+		yes := true
+		switch op[0] {
+		case INET_DIAG_BC_NOP:
+		case INET_DIAG_BC_JMP:
+			yes = false
+		case INET_DIAG_BC_S_EQ:
+			yes = e.sport == bcUint16(op[6:])
+		case INET_DIAG_BC_S_GE:
+			yes = e.sport >= bcUint16(op[6:])
+		case INET_DIAG_BC_S_LE:
+			yes = e.sport <= bcUint16(op[6:])
+		case INET_DIAG_BC_D_EQ:
+			yes = e.dport == bcUint16(op[6:])
+		case INET_DIAG_BC_D_GE:
+			yes = e.dport >= bcUint16(op[6:])
+		case INET_DIAG_BC_D_LE:
+			yes = e.dport <= bcUint16(op[6:])
+		case INET_DIAG_BC_AUTO:
+			yes = !e.userlocks
+		case INET_DIAG_BC_S_COND, INET_DIAG_BC_D_COND:
+			family, plen, port := op[4], int(op[5]), int32(bcUint32(op[8:]))
+			eport, addr := e.sport, e.saddr
+			if op[0] == INET_DIAG_BC_D_COND {
+				eport, addr = e.dport, e.daddr
+			}
+			if port != -1 && port != int32(eport) {
+				yes = false
+				break
+			}
+			if family != syscall.AF_UNSPEC && family != e.family {
+				yes = false
+				break
+			}
+			if plen == 0 {
+				break
+			}
+			if e.family == syscall.AF_INET {
+				addr = addr.To4()
+			}
+			yes = bcMatch(addr, op[12:], plen)
+		case INET_DIAG_BC_DEV_COND:
+			yes = e.ifindex == bcUint32(op[4:])
+		case INET_DIAG_BC_MARK_COND:
+			yes = e.mark&bcUint32(op[8:]) == bcUint32(op[4:])
+		case INET_DIAG_BC_CGROUP_COND:
+			yes = e.cgroup == *(*uint64)(unsafe.Pointer(&op[4:12][0]))
+		}
+
+		n := int(op[1])
+		if !yes {
+			n = int(bcUint16(op[2:]))
+		}
+		off += n
+		left -= n
+	}
+	return left == 0
+}
+
+// bcValidJump tells whether a jump leaving left bytes of the program lands
+// on an operation, the way valid_cc does.
+func bcValidJump(bc []byte, left int) bool {
+	off, n := 0, len(bc)
+	for n >= 0 {
+		if left > n {
+			return false
+		}
+		if left == n {
+			return true
+		}
+		yes := int(bc[off+1])
+		if yes < 4 || yes&3 != 0 {
+			return false
+		}
+		off += yes
+		n -= yes
+	}
+	return false
+}
+
+// bcAudit checks bytecode the way inet_diag_bc_audit does before running it.
+func bcAudit(bc []byte) error {
+	off, left := 0, len(bc)
+	for left > 0 {
+		if left < sizeofInetDiagBcOp {
+			return fmt.Errorf("%d: truncated operation", off)
+		}
+		op := bc[off:]
+		min := sizeofInetDiagBcOp
+		switch op[0] {
+		case INET_DIAG_BC_S_COND, INET_DIAG_BC_D_COND:
+			min += 8
+			if left < min {
+				return fmt.Errorf("%d: truncated condition", off)
+			}
+			alen := map[uint8]int{syscall.AF_UNSPEC: 0, syscall.AF_INET: 4, syscall.AF_INET6: 16}
+			n, ok := alen[op[4]]
+			if !ok || int(op[5]) > n*8 {
+				return fmt.Errorf("%d: bad address", off)
+			}
+			min += n
+		case INET_DIAG_BC_S_EQ, INET_DIAG_BC_S_GE, INET_DIAG_BC_S_LE,
+			INET_DIAG_BC_D_EQ, INET_DIAG_BC_D_GE, INET_DIAG_BC_D_LE:
+			min += sizeofInetDiagBcOp
+		case INET_DIAG_BC_DEV_COND:
+			min += 4
+		case INET_DIAG_BC_MARK_COND, INET_DIAG_BC_CGROUP_COND:
+			min += 8
+		case INET_DIAG_BC_AUTO, INET_DIAG_BC_JMP, INET_DIAG_BC_NOP:
+		default:
+			return fmt.Errorf("%d: bad operation %d", off, op[0])
+		}
+		if left < min {
+			return fmt.Errorf("%d: truncated arguments", off)
+		}
+
+		if op[0] != INET_DIAG_BC_NOP {
+			no := int(bcUint16(op[2:]))
+			if no < min || no > left+4 || no&3 != 0 {
+				return fmt.Errorf("%d: bad no jump %d", off, no)
+			}
+			if no < left && !bcValidJump(bc, left-no) {
+				return fmt.Errorf("%d: no jump %d into an operation", off, no)
+			}
+		}
+		yes := int(op[1])
+		if yes < min || yes > left+4 || yes&3 != 0 {
+			return fmt.Errorf("%d: bad yes jump %d", off, yes)
+		}
+		off += yes
+		left -= yes
+	}
+	return nil
+}
+
+func TestBcOp(t *testing.T) {
+	b := bcOp(INET_DIAG_BC_S_GE, 8, 0x1234)
+	if len(b) != sizeofInetDiagBcOp || b[0] != INET_DIAG_BC_S_GE || b[1] != 8 || bcUint16(b[2:]) != 0x1234 {
+		t.Errorf("got % x", b)
+	}
+}
+
+func TestFilterWireFormat(t *testing.T) {
+	nport := func(p uint16) []byte {
+		b := make([]byte, 2)
+		*(*uint16)(unsafe.Pointer(&b[0])) = p
+		return b
+	}
+	host := func(family, plen uint8, port int32, addr ...byte) []byte {
+		b := make([]byte, 8)
+		b[0], b[1] = family, plen
+		*(*int32)(unsafe.Pointer(&b[4])) = port
+		return append(b, addr...)
+	}
+	op := func(code, yes uint8, no uint16, args ...byte) []byte {
+		return append(bcOp(code, yes, no), args...)
+	}
+	_, v4, _ := net.ParseCIDR("192.0.2.0/24")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+
+	tests := []struct {
+		name   string
+		filter InetDiagFilter
+		want   []byte
+	}{
+		{"sport eq", FilterSrcPortEq(80),
+			append(op(INET_DIAG_BC_S_EQ, 8, 12), append([]byte{INET_DIAG_BC_NOP, 0}, nport(80)...)...)},
+		{"dport le", FilterDstPortLe(1024),
+			append(op(INET_DIAG_BC_D_LE, 8, 12), append([]byte{INET_DIAG_BC_NOP, 0}, nport(1024)...)...)},
+		{"src v4", FilterSrc(v4, 80),
+			op(INET_DIAG_BC_S_COND, 16, 20, host(syscall.AF_INET, 24, 80, 192, 0, 2, 0)...)},
+		{"dst v6", FilterDst(v6, -1),
+			op(INET_DIAG_BC_D_COND, 28, 32, host(syscall.AF_INET6, 32, -1, 0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)...)},
+		{"any address", FilterDst(nil, 443),
+			op(INET_DIAG_BC_D_COND, 12, 16, host(syscall.AF_UNSPEC, 0, 443)...)},
+		/* only -1 means any port to the kernel */
+		{"negative port", FilterSrc(nil, -2),
+			op(INET_DIAG_BC_S_COND, 12, 16, host(syscall.AF_UNSPEC, 0, -1)...)},
+		{"auto", FilterAuto(), op(INET_DIAG_BC_AUTO, 4, 8)},
+		{"and", FilterSrcPortEq(80).And(FilterAuto()),
+			append(op(INET_DIAG_BC_S_EQ, 8, 16, append([]byte{INET_DIAG_BC_NOP, 0}, nport(80)...)...), op(INET_DIAG_BC_AUTO, 4, 8)...)},
+		{"or", FilterAuto().Or(FilterAuto()),
+			append(append(op(INET_DIAG_BC_AUTO, 4, 8), op(INET_DIAG_BC_JMP, 4, 8)...), op(INET_DIAG_BC_AUTO, 4, 8)...)},
+		{"not", FilterAuto().Not(), append(op(INET_DIAG_BC_AUTO, 4, 8), op(INET_DIAG_BC_JMP, 4, 8)...)},
+		/* an empty filter matches everything */
+		{"and empty", InetDiagFilter{}.And(FilterAuto()), op(INET_DIAG_BC_AUTO, 4, 8)},
+		{"or empty", FilterAuto().Or(InetDiagFilter{}), []byte{}},
+	}
+
+	for _, test := range tests {
+		if !bytes.Equal(test.filter, test.want) {
+			t.Errorf("%s: got % x, want % x", test.name, []byte(test.filter), test.want)
+		}
+		if err := bcAudit(test.filter); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+	}
+}
+
+// testFilter is a filter along with what it should match.
+type testFilter struct {
+	name   string
+	filter InetDiagFilter
+	match  func(e *bcEntry) bool
+}
+
+func TestFilterRun(t *testing.T) {
+	_, v4, _ := net.ParseCIDR("192.0.2.0/25")
+	_, v6, _ := net.ParseCIDR("2001:db8::/32")
+
+	entries := []*bcEntry{
+		{family: syscall.AF_INET, saddr: net.ParseIP("192.0.2.1"), daddr: net.ParseIP("198.51.100.1"),
+			sport: 80, dport: 40000, ifindex: 2, mark: 0x12},
+		{family: syscall.AF_INET, saddr: net.ParseIP("192.0.2.200"), daddr: net.ParseIP("192.0.2.1"),
+			sport: 40000, dport: 80, userlocks: true, cgroup: 7},
+		{family: syscall.AF_INET6, saddr: net.ParseIP("2001:db8::1"), daddr: net.ParseIP("2001:db9::1"),
+			sport: 443, dport: 1024, ifindex: 3, mark: 0x10},
+		{family: syscall.AF_INET6, saddr: net.ParseIP("::1"), daddr: net.ParseIP("2001:db8::2"),
+			sport: 1024, dport: 443, userlocks: true, cgroup: 7},
+	}
+
+	leaves := []testFilter{
+		{"sport=80", FilterSrcPortEq(80), func(e *bcEntry) bool { return e.sport == 80 }},
+		{"sport>=1024", FilterSrcPortGe(1024), func(e *bcEntry) bool { return e.sport >= 1024 }},
+		{"dport<=1024", FilterDstPortLe(1024), func(e *bcEntry) bool { return e.dport <= 1024 }},
+		{"src v4", FilterSrc(v4, -1), func(e *bcEntry) bool { return v4.Contains(e.saddr) && e.family == syscall.AF_INET }},
+		{"dst v6:443", FilterDst(v6, 443), func(e *bcEntry) bool { return v6.Contains(e.daddr) && e.dport == 443 }},
+		{"auto", FilterAuto(), func(e *bcEntry) bool { return !e.userlocks }},
+		{"dev", FilterDev(3), func(e *bcEntry) bool { return e.ifindex == 3 }},
+		{"mark", FilterMark(0x10, 0xf0), func(e *bcEntry) bool { return e.mark&0xf0 == 0x10 }},
+		{"cgroup", FilterCgroup(7), func(e *bcEntry) bool { return e.cgroup == 7 }},
+	}
+
+	and := func(f, g testFilter) testFilter {
+		return testFilter{"(" + f.name + " and " + g.name + ")", f.filter.And(g.filter),
+			func(e *bcEntry) bool { return f.match(e) && g.match(e) }}
+	}
+	or := func(f, g testFilter) testFilter {
+		return testFilter{"(" + f.name + " or " + g.name + ")", f.filter.Or(g.filter),
+			func(e *bcEntry) bool { return f.match(e) || g.match(e) }}
+	}
+	not := func(f testFilter) testFilter {
+		return testFilter{"not " + f.name, f.filter.Not(), func(e *bcEntry) bool { return !f.match(e) }}
+	}
+
+	/* every expression of up to two operators over the leaves, then some
+	   deeper ones built from them */
+	filters := append([]testFilter{}, leaves...)
+	for _, f := range leaves {
+		filters = append(filters, not(f))
+		for _, g := range leaves {
+			filters = append(filters, and(f, g), or(f, g))
+		}
+	}
+	level := len(filters)
+	for i := 0; i < level; i++ {
+		f, g := filters[i], filters[(i*7+3)%level]
+		filters = append(filters, not(filters[i]), and(f, g), or(f, g), and(not(f), or(g, f)), not(or(and(f, g), not(g))))
+	}
+
+	for _, f := range filters {
+		if err := bcAudit(f.filter); err != nil {
+			t.Errorf("%s: %v", f.name, err)
+			continue
+		}
+		for _, e := range entries {
+			if got, want := bcRun(f.filter, e), f.match(e); got != want {
+				t.Errorf("%s on %v: got %v, want %v", f.name, e, got, want)
+			}
+		}
+	}
+}
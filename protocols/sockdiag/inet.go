@@ -0,0 +1,421 @@
+package sockdiag
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+// InetDiagSockId identifies an inet socket. Ports are kept in host byte
+// order here. A zero Cookie matches any socket when used in a request, see
+// INET_DIAG_NOCOOKIE.
+type InetDiagSockId struct {
+	SrcPort uint16
+	DstPort uint16
+	Src     net.IP
+	Dst     net.IP
+	If      uint32
+	Cookie  uint64
+}
+
+type InetDiagReqV2 struct {
+	Family   uint8
+	Protocol uint8
+	Ext      uint8
+	Pad      uint8
+	States   uint32
+	Id       InetDiagSockId
+}
+
+type InetDiagMemInfo struct {
+	RMem uint32
+	WMem uint32
+	FMem uint32
+	TMem uint32
+}
+
+// TcpInfo mirrors struct tcp_info. Kernels older than the structure report
+// fewer fields, which are left to zero.
+type TcpInfo struct {
+	State       uint8
+	CaState     uint8
+	Retransmits uint8
+	Probes      uint8
+	Backoff     uint8
+	Options     uint8
+	WScale      uint8 /* snd_wscale:4, rcv_wscale:4 */
+	AppLimited  uint8 /* delivery_rate_app_limited:1, fastopen_client_fail:2 */
+
+	Rto    uint32
+	Ato    uint32
+	SndMss uint32
+	RcvMss uint32
+
+	Unacked uint32
+	Sacked  uint32
+	Lost    uint32
+	Retrans uint32
+	Fackets uint32
+
+	LastDataSent uint32
+	LastAckSent  uint32
+	LastDataRecv uint32
+	LastAckRecv  uint32
+
+	Pmtu        uint32
+	RcvSsthresh uint32
+	Rtt         uint32
+	Rttvar      uint32
+	SndSsthresh uint32
+	SndCwnd     uint32
+	Advmss      uint32
+	Reordering  uint32
+
+	RcvRtt   uint32
+	RcvSpace uint32
+
+	TotalRetrans uint32
+
+	PacingRate    uint64
+	MaxPacingRate uint64
+	BytesAcked    uint64
+	BytesReceived uint64
+	SegsOut       uint32
+	SegsIn        uint32
+
+	NotsentBytes uint32
+	MinRtt       uint32
+	DataSegsIn   uint32
+	DataSegsOut  uint32
+
+	DeliveryRate uint64
+
+	BusyTime      uint64
+	RwndLimited   uint64
+	SndbufLimited uint64
+
+	Delivered   uint32
+	DeliveredCe uint32
+
+	BytesSent    uint64
+	BytesRetrans uint64
+	DsackDups    uint32
+	ReordSeen    uint32
+
+	RcvOoopack uint32
+
+	SndWnd uint32
+	RcvWnd uint32
+
+	Rehash uint32
+
+	TotalRto           uint16
+	TotalRtoRecoveries uint16
+	TotalRtoTime       uint32
+}
+
+// InetSocket is a TCP, UDP or other inet socket as reported by inet_diag.
+// Expires is in milliseconds. Protocol is the one it was dumped with. The
+// optional fields are only set when the matching extension was requested,
+// see InetDiagExt, or the kernel reports them unasked.
+type InetSocket struct {
+	Family    uint8
+	Protocol  uint8
+	State     uint8
+	Timer     uint8
+	Retrans   uint8
+	Id        InetDiagSockId
+	Expires   uint32
+	RQueue    uint32
+	WQueue    uint32
+	Uid       uint32
+	Inode     uint32
+	MemInfo   *InetDiagMemInfo
+	SkMemInfo SkMemInfo
+	TcpInfo   *TcpInfo
+	Cong      string
+	Tos       uint8
+	HasTos    bool
+	TClass    uint8
+	HasTClass bool
+	Shutdown  uint8
+	Mark      uint32
+	HasMark   bool
+	CgroupId  uint64
+	HasCgroup bool
+	Attrs     []netlink.NetlinkAttr
+}
+
+// InetDiagQuery selects the inet sockets to dump. A zero Family dumps both
+// AF_INET and AF_INET6 sockets, zero States all of them. Ext is a set of
+// InetDiagExt bits and Filter is matched by the kernel against every socket.
+type InetDiagQuery struct {
+	Family   uint8
+	Protocol uint8
+	States   uint32
+	Ext      uint8
+	Filter   InetDiagFilter
+}
+
+var tcpStateNames = map[uint8]string{
+	TCP_ESTABLISHED:  "ESTAB",
+	TCP_SYN_SENT:     "SYN-SENT",
+	TCP_SYN_RECV:     "SYN-RECV",
+	TCP_FIN_WAIT1:    "FIN-WAIT-1",
+	TCP_FIN_WAIT2:    "FIN-WAIT-2",
+	TCP_TIME_WAIT:    "TIME-WAIT",
+	TCP_CLOSE:        "UNCONN",
+	TCP_CLOSE_WAIT:   "CLOSE-WAIT",
+	TCP_LAST_ACK:     "LAST-ACK",
+	TCP_LISTEN:       "LISTEN",
+	TCP_CLOSING:      "CLOSING",
+	TCP_NEW_SYN_RECV: "NEW-SYN-RECV",
+}
+
+// TcpStateName returns the name ss uses for a socket state.
+func TcpStateName(state uint8) string {
+	if name, ok := tcpStateNames[state]; ok {
+		return name
+	}
+	return "UNKNOWN"
+}
+
+// InetDiagExt returns the request extension bit asking for attr, which must
+// be at most INET_DIAG_SHUTDOWN.
+func InetDiagExt(attr uint16) uint8 {
+	return 1 << (attr - 1)
+}
+
+func (info *TcpInfo) SndWscale() uint8 {
+	return info.WScale & 0xf
+}
+
+func (info *TcpInfo) RcvWscale() uint8 {
+	return info.WScale >> 4
+}
+
+func TcpInfofromWireFormat(data []byte) *TcpInfo {
+	info := &TcpInfo{}
+	n := int(unsafe.Sizeof(*info))
+	if len(data) < n {
+		n = len(data)
+	}
+	copy((*[unsafe.Sizeof(TcpInfo{})]byte)(unsafe.Pointer(info))[:n], data[:n])
+	return info
+}
+
+func InetDiagMemInfofromWireFormat(data []byte) *InetDiagMemInfo {
+	return &InetDiagMemInfo{
+		RMem: *(*uint32)(unsafe.Pointer(&data[0:4][0])),
+		WMem: *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		FMem: *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+		TMem: *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+	}
+}
+
+func InetDiagSockIdfromWireFormat(family uint8, data []byte) *InetDiagSockId {
+	iplen := net.IPv6len
+	if family == syscall.AF_INET {
+		iplen = net.IPv4len
+	}
+
+	return &InetDiagSockId{
+		SrcPort: binary.BigEndian.Uint16(data[0:2]),
+		DstPort: binary.BigEndian.Uint16(data[2:4]),
+		Src:     net.IP(append([]byte{}, data[4:4+iplen]...)),
+		Dst:     net.IP(append([]byte{}, data[20:20+iplen]...)),
+		If:      *(*uint32)(unsafe.Pointer(&data[36:40][0])),
+		Cookie:  uint64(*(*uint32)(unsafe.Pointer(&data[40:44][0]))) | uint64(*(*uint32)(unsafe.Pointer(&data[44:48][0])))<<32,
+	}
+}
+
+func putInetDiagAddr(b []byte, family uint8, ip net.IP) {
+	if family == syscall.AF_INET {
+		copy(b[0:4], ip.To4())
+	} else {
+		copy(b[0:16], ip.To16())
+	}
+}
+
+func (id *InetDiagSockId) toWireFormat(family uint8) []byte {
+	b := make([]byte, SizeofInetDiagSockId)
+	binary.BigEndian.PutUint16(b[0:2], id.SrcPort)
+	binary.BigEndian.PutUint16(b[2:4], id.DstPort)
+	putInetDiagAddr(b[4:20], family, id.Src)
+	putInetDiagAddr(b[20:36], family, id.Dst)
+	*(*uint32)(unsafe.Pointer(&b[36:40][0])) = id.If
+	cookie := id.Cookie
+	if cookie == 0 {
+		cookie = INET_DIAG_NOCOOKIE
+	}
+	*(*uint32)(unsafe.Pointer(&b[40:44][0])) = uint32(cookie)
+	*(*uint32)(unsafe.Pointer(&b[44:48][0])) = uint32(cookie >> 32)
+	return b
+}
+
+func (req *InetDiagReqV2) toWireFormat() []byte {
+	b := make([]byte, SizeofInetDiagReqV2)
+	b[0] = req.Family
+	b[1] = req.Protocol
+	b[2] = req.Ext
+	b[3] = req.Pad
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = req.States
+	copy(b[8:], req.Id.toWireFormat(req.Family))
+	return b
+}
+
+func InetSocketfromWireFormat(data []byte) (*InetSocket, error) {
+	if len(data) < SizeofInetDiagMsg {
+		return nil, errors.New("short inet_diag_msg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofInetDiagMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &InetSocket{
+		Family:  data[0],
+		State:   data[1],
+		Timer:   data[2],
+		Retrans: data[3],
+		Id:      *InetDiagSockIdfromWireFormat(data[0], data[4:52]),
+		Expires: *(*uint32)(unsafe.Pointer(&data[52:56][0])),
+		RQueue:  *(*uint32)(unsafe.Pointer(&data[56:60][0])),
+		WQueue:  *(*uint32)(unsafe.Pointer(&data[60:64][0])),
+		Uid:     *(*uint32)(unsafe.Pointer(&data[64:68][0])),
+		Inode:   *(*uint32)(unsafe.Pointer(&data[68:72][0])),
+		Attrs:   attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case INET_DIAG_MEMINFO:
+			if len(attr.Data) >= 16 {
+				s.MemInfo = InetDiagMemInfofromWireFormat(attr.Data)
+			}
+		case INET_DIAG_SKMEMINFO:
+			s.SkMemInfo = SkMemInfofromWireFormat(attr.Data)
+		case INET_DIAG_INFO:
+			s.TcpInfo = TcpInfofromWireFormat(attr.Data)
+		case INET_DIAG_CONG:
+			s.Cong = attr.String()
+		case INET_DIAG_TOS:
+			s.Tos = attr.Uint8()
+			s.HasTos = true
+		case INET_DIAG_TCLASS:
+			s.TClass = attr.Uint8()
+			s.HasTClass = true
+		case INET_DIAG_SHUTDOWN:
+			s.Shutdown = attr.Uint8()
+		case INET_DIAG_PROTOCOL:
+			s.Protocol = attr.Uint8()
+		case INET_DIAG_MARK:
+			s.Mark = attr.Uint32()
+			s.HasMark = true
+		case INET_DIAG_CGROUP_ID:
+			s.CgroupId = attr.Uint64()
+			s.HasCgroup = true
+		}
+	}
+
+	return s, nil
+}
+
+// ListInetSockets dumps the inet sockets selected by q.
+func (sl *SockDiagNLSocket) ListInetSockets(q *InetDiagQuery) ([]*InetSocket, error) {
+	families := []uint8{q.Family}
+	if q.Family == syscall.AF_UNSPEC {
+		families = []uint8{syscall.AF_INET, syscall.AF_INET6}
+	}
+
+	states := q.States
+	if states == 0 {
+		states = TCPF_ALL
+	}
+
+	ret := []*InetSocket{}
+
+	for _, family := range families {
+		req := &InetDiagReqV2{
+			Family:   family,
+			Protocol: q.Protocol,
+			Ext:      q.Ext,
+			States:   states,
+		}
+		data := req.toWireFormat()
+		if len(q.Filter) > 0 {
+			data = append(data, netlink.AttrsToWireFormat([]netlink.NetlinkAttr{netlink.NewAttr(INET_DIAG_REQ_BYTECODE, q.Filter)})...)
+		}
+
+		msgList, err := sl.dump(data, SizeofInetDiagMsg)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, msg := range msgList {
+			s, err := InetSocketfromWireFormat(msg.Data)
+			if err != nil {
+				return nil, err
+			}
+			if s.Protocol == 0 {
+				s.Protocol = q.Protocol
+			}
+			ret = append(ret, s)
+		}
+	}
+
+	return ret, nil
+}
+
+// GetInetSocket looks up the socket exactly matching id.
+func (sl *SockDiagNLSocket) GetInetSocket(family, protocol uint8, id *InetDiagSockId, ext uint8) (*InetSocket, error) {
+	req := &InetDiagReqV2{
+		Family:   family,
+		Protocol: protocol,
+		Ext:      ext,
+		States:   TCPF_ALL,
+		Id:       *id,
+	}
+
+	msgList, err := sl.Execute(SOCK_DIAG_BY_FAMILY, 0, req.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != SOCK_DIAG_BY_FAMILY {
+			continue
+		}
+		s, err := InetSocketfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		if s.Protocol == 0 {
+			s.Protocol = protocol
+		}
+		return s, nil
+	}
+
+	return nil, syscall.ENOENT
+}
+
+// DestroyInetSocket closes a socket as if it got a reset, waking up its
+// owner with ECONNABORTED. It needs CAP_NET_ADMIN and a kernel built with
+// CONFIG_INET_DIAG_DESTROY. The socket is matched on its full id, so that a
+// socket reusing the addresses is left alone.
+func (sl *SockDiagNLSocket) DestroyInetSocket(s *InetSocket) error {
+	req := &InetDiagReqV2{
+		Family:   s.Family,
+		Protocol: s.Protocol,
+		States:   TCPF_ALL,
+		Id:       s.Id,
+	}
+
+	_, err := sl.Execute(SOCK_DESTROY, 0, req.toWireFormat())
+	return err
+}
@@ -0,0 +1,321 @@
+package sockdiag
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestInetDiagSockIdWireFormat(t *testing.T) {
+	ids := []struct {
+		family uint8
+		id     InetDiagSockId
+	}{
+		{syscall.AF_INET, InetDiagSockId{SrcPort: 80, DstPort: 40000, Src: net.ParseIP("192.0.2.1").To4(),
+			Dst: net.ParseIP("192.0.2.2").To4(), If: 2, Cookie: 0x0102030405060708}},
+		{syscall.AF_INET6, InetDiagSockId{SrcPort: 443, DstPort: 1024, Src: net.ParseIP("2001:db8::1"),
+			Dst: net.ParseIP("2001:db8::2"), Cookie: 1}},
+	}
+
+	for _, test := range ids {
+		b := test.id.toWireFormat(test.family)
+		if len(b) != SizeofInetDiagSockId {
+			t.Fatalf("got %d bytes", len(b))
+		}
+		/* ports are in network byte order */
+		if binary.BigEndian.Uint16(b[0:2]) != test.id.SrcPort {
+			t.Errorf("got % x", b)
+		}
+		got := InetDiagSockIdfromWireFormat(test.family, b)
+		if !reflect.DeepEqual(*got, test.id) {
+			t.Errorf("got %+v, want %+v", got, test.id)
+		}
+	}
+
+	/* a zero cookie matches any socket */
+	b := (&InetDiagSockId{}).toWireFormat(syscall.AF_INET)
+	if id := InetDiagSockIdfromWireFormat(syscall.AF_INET, b); id.Cookie != INET_DIAG_NOCOOKIE {
+		t.Errorf("got %+v", id)
+	}
+}
+
+func TestInetDiagReqV2WireFormat(t *testing.T) {
+	req := &InetDiagReqV2{
+		Family:   syscall.AF_INET6,
+		Protocol: syscall.IPPROTO_TCP,
+		Ext:      InetDiagExt(INET_DIAG_INFO) | InetDiagExt(INET_DIAG_CONG),
+		States:   1 << TCP_LISTEN,
+	}
+	b := req.toWireFormat()
+	if len(b) != SizeofInetDiagReqV2 || b[0] != syscall.AF_INET6 || b[1] != syscall.IPPROTO_TCP ||
+		b[2] != 0x0a || *(*uint32)(unsafe.Pointer(&b[4])) != 1<<TCP_LISTEN {
+		t.Errorf("got % x", b)
+	}
+}
+
+func TestTcpInfoLayout(t *testing.T) {
+	var info TcpInfo
+	offsets := []struct {
+		name string
+		got  uintptr
+		want uintptr
+	}{
+		{"rto", unsafe.Offsetof(info.Rto), 8},
+		{"rtt", unsafe.Offsetof(info.Rtt), 68},
+		{"total_retrans", unsafe.Offsetof(info.TotalRetrans), 100},
+		{"pacing_rate", unsafe.Offsetof(info.PacingRate), 104},
+		{"delivery_rate", unsafe.Offsetof(info.DeliveryRate), 160},
+		{"bytes_sent", unsafe.Offsetof(info.BytesSent), 200},
+		{"snd_wnd", unsafe.Offsetof(info.SndWnd), 228},
+		{"total_rto", unsafe.Offsetof(info.TotalRto), 240},
+		{"total_rto_time", unsafe.Offsetof(info.TotalRtoTime), 244},
+		{"sizeof", unsafe.Sizeof(info), 248},
+	}
+	for _, o := range offsets {
+		if o.got != o.want {
+			t.Errorf("%s: got %d, want %d", o.name, o.got, o.want)
+		}
+	}
+
+	/* older kernels report fewer fields, newer ones more */
+	data := make([]byte, 300)
+	data[0] = TCP_ESTABLISHED
+	data[6] = 0x75
+	*(*uint32)(unsafe.Pointer(&data[68])) = 1000
+	*(*uint32)(unsafe.Pointer(&data[244])) = 7
+	for _, n := range []int{104, 248, 300} {
+		info := TcpInfofromWireFormat(data[:n])
+		if info.State != TCP_ESTABLISHED || info.SndWscale() != 5 || info.RcvWscale() != 7 || info.Rtt != 1000 {
+			t.Errorf("%d bytes: got %+v", n, info)
+		}
+		if (n >= 248) != (info.TotalRtoTime == 7) {
+			t.Errorf("%d bytes: got %+v", n, info)
+		}
+	}
+}
+
+func TestInetSocketfromWireFormat(t *testing.T) {
+	id := InetDiagSockId{SrcPort: 22, DstPort: 50000, Src: net.ParseIP("2001:db8::1"), Dst: net.ParseIP("2001:db8::2"), Cookie: 9}
+	data := make([]byte, SizeofInetDiagMsg)
+	data[0] = syscall.AF_INET6
+	data[1] = TCP_ESTABLISHED
+	data[2] = 1
+	copy(data[4:52], id.toWireFormat(syscall.AF_INET6))
+	for i, v := range []uint32{200, 5, 6, 1000, 12345} {
+		*(*uint32)(unsafe.Pointer(&data[52+i*4])) = v
+	}
+	meminfo := make([]byte, 16)
+	*(*uint32)(unsafe.Pointer(&meminfo[12])) = 4096
+	data = append(data, netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttr(INET_DIAG_MEMINFO, meminfo),
+		netlink.NewAttr(INET_DIAG_SKMEMINFO, make([]byte, 4*(SK_MEMINFO_DROPS+1))),
+		netlink.NewAttrString(INET_DIAG_CONG, "cubic"),
+		netlink.NewAttrUint8(INET_DIAG_TCLASS, 0),
+		netlink.NewAttrUint8(INET_DIAG_PROTOCOL, syscall.IPPROTO_TCP),
+		netlink.NewAttrUint32(INET_DIAG_MARK, 0x2a),
+		netlink.NewAttrUint64(INET_DIAG_CGROUP_ID, 77),
+	})...)
+
+	s, err := InetSocketfromWireFormat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Family != syscall.AF_INET6 || s.State != TCP_ESTABLISHED || s.Timer != 1 || !reflect.DeepEqual(s.Id, id) ||
+		s.Expires != 200 || s.RQueue != 5 || s.WQueue != 6 || s.Uid != 1000 || s.Inode != 12345 {
+		t.Errorf("got %+v", s)
+	}
+	if s.MemInfo == nil || s.MemInfo.TMem != 4096 || len(s.SkMemInfo) != SK_MEMINFO_DROPS+1 || s.Cong != "cubic" ||
+		s.HasTos || !s.HasTClass || s.Protocol != syscall.IPPROTO_TCP || !s.HasMark || s.Mark != 0x2a ||
+		!s.HasCgroup || s.CgroupId != 77 || s.TcpInfo != nil {
+		t.Errorf("got %+v", s)
+	}
+
+	if _, err := InetSocketfromWireFormat(data[:SizeofInetDiagMsg-1]); err == nil {
+		t.Error("short message parsed")
+	}
+}
+
+func TestTcpStateName(t *testing.T) {
+	if TcpStateName(TCP_LISTEN) != "LISTEN" || TcpStateName(TCP_CLOSE) != "UNCONN" || TcpStateName(0) != "UNKNOWN" {
+		t.Error("bad state names")
+	}
+}
+
+// findInet returns the socket bound to the local port.
+func findInet(sockets []*InetSocket, port int) *InetSocket {
+	for _, s := range sockets {
+		if int(s.Id.SrcPort) == port {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestInetSockets(t *testing.T) {
+	sl := testNetns(t)
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lport := ln.Addr().(*net.TCPAddr).Port
+
+	client, err := net.Dial("tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	cport := client.LocalAddr().(*net.TCPAddr).Port
+	server, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	udp, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	uport := udp.LocalAddr().(*net.UDPAddr).Port
+
+	ext := InetDiagExt(INET_DIAG_INFO) | InetDiagExt(INET_DIAG_CONG) | InetDiagExt(INET_DIAG_MEMINFO) | InetDiagExt(INET_DIAG_SKMEMINFO)
+	sockets, err := sl.ListInetSockets(&InetDiagQuery{Protocol: syscall.IPPROTO_TCP, Ext: ext})
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sockets) != 3 {
+		t.Fatalf("got %d sockets", len(sockets))
+	}
+
+	l := findInet(sockets, lport)
+	if l == nil || l.State != TCP_LISTEN || l.Family != syscall.AF_INET || l.Protocol != syscall.IPPROTO_TCP ||
+		!l.Id.Src.Equal(net.IPv4(127, 0, 0, 1)) || l.Inode == 0 {
+		t.Errorf("listener: got %+v", l)
+	}
+	c := findInet(sockets, cport)
+	if c == nil || c.State != TCP_ESTABLISHED || int(c.Id.DstPort) != lport || c.Id.Cookie == 0 {
+		t.Fatalf("client: got %+v", c)
+	}
+	if c.TcpInfo == nil || c.TcpInfo.State != TCP_ESTABLISHED || c.TcpInfo.SndMss == 0 || c.Cong == "" ||
+		c.MemInfo == nil || len(c.SkMemInfo) <= SK_MEMINFO_SNDBUF || c.SkMemInfo[SK_MEMINFO_SNDBUF] == 0 {
+		t.Errorf("client extensions: got %+v", c)
+	}
+
+	/* states select sockets */
+	sockets, err = sl.ListInetSockets(&InetDiagQuery{Family: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, States: 1 << TCP_LISTEN})
+	if err != nil || len(sockets) != 1 || int(sockets[0].Id.SrcPort) != lport {
+		t.Errorf("listeners: got %+v, %v", sockets, err)
+	}
+
+	/* unconnected UDP sockets are in the close state */
+	sockets, err = sl.ListInetSockets(&InetDiagQuery{Protocol: syscall.IPPROTO_UDP})
+	if err != nil || len(sockets) != 1 || int(sockets[0].Id.SrcPort) != uport || sockets[0].Family != syscall.AF_INET6 ||
+		sockets[0].State != TCP_CLOSE || sockets[0].Protocol != syscall.IPPROTO_UDP {
+		t.Errorf("udp: got %+v, %v", sockets, err)
+	}
+
+	s, err := sl.GetInetSocket(syscall.AF_INET, syscall.IPPROTO_TCP, &c.Id, 0)
+	if err != nil || s.Inode != c.Inode || s.Id.Cookie != c.Id.Cookie {
+		t.Errorf("get: got %+v, %v", s, err)
+	}
+	id := c.Id
+	id.Cookie++
+	if _, err := sl.GetInetSocket(syscall.AF_INET, syscall.IPPROTO_TCP, &id, 0); err != syscall.ENOENT {
+		t.Errorf("get with another cookie: %v", err)
+	}
+
+	err = sl.DestroyInetSocket(c)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.Read(make([]byte, 1))
+	if err == nil || !isErrno(err, syscall.ECONNABORTED) {
+		t.Errorf("read after destroy: %v", err)
+	}
+	if _, err := sl.GetInetSocket(syscall.AF_INET, syscall.IPPROTO_TCP, &c.Id, 0); err != syscall.ENOENT {
+		t.Errorf("get after destroy: %v", err)
+	}
+}
+
+// isErrno tells whether err wraps errno, as errors of net do.
+func isErrno(err error, errno syscall.Errno) bool {
+	for err != nil {
+		if e, ok := err.(syscall.Errno); ok {
+			return e == errno
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
+
+func TestInetFilter(t *testing.T) {
+	sl := testNetns(t)
+
+	/* the first port is chosen, the others are assigned by the kernel */
+	var ports []int
+	for _, addr := range []string{"127.0.0.1:8080", "127.0.0.1:0", "127.0.0.1:0"} {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		ports = append(ports, ln.Addr().(*net.TCPAddr).Port)
+	}
+	ln6, err := net.Listen("tcp6", "[::1]:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln6.Close()
+	port6 := ln6.Addr().(*net.TCPAddr).Port
+
+	_, lo, _ := net.ParseCIDR("127.0.0.0/8")
+	tests := []struct {
+		name   string
+		filter InetDiagFilter
+		want   []int
+	}{
+		{"none", nil, append(ports, port6)},
+		{"sport", FilterSrcPortEq(uint16(ports[1])), ports[1:2]},
+		{"not sport", FilterSrcPortEq(uint16(ports[1])).Not(), []int{ports[0], ports[2], port6}},
+		{"or", FilterSrcPortEq(uint16(ports[0])).Or(FilterSrcPortEq(uint16(port6))), []int{ports[0], port6}},
+		{"src v4", FilterSrc(lo, -1), ports},
+		{"src v4 and port", FilterSrc(lo, ports[2]), ports[2:]},
+		{"any address", FilterSrc(nil, port6), []int{port6}},
+		{"and not", FilterSrc(lo, -1).And(FilterSrcPortEq(uint16(ports[0])).Not()), ports[1:]},
+		{"auto", FilterAuto(), []int{ports[1], ports[2], port6}},
+		{"mark", FilterMark(1, 1), nil},
+		{"not mark", FilterMark(1, 1).Not(), append(ports, port6)},
+	}
+
+	for _, test := range tests {
+		sockets, err := sl.ListInetSockets(&InetDiagQuery{Protocol: syscall.IPPROTO_TCP, Filter: test.filter})
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		got := map[int]bool{}
+		for _, s := range sockets {
+			got[int(s.Id.SrcPort)] = true
+		}
+		want := map[int]bool{}
+		for _, port := range test.want {
+			want[port] = true
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %v, want %v", test.name, got, want)
+		}
+	}
+}
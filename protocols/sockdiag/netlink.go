@@ -0,0 +1,151 @@
+package sockdiag
+
+import (
+	"errors"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+type NetlinkDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	Pad      uint16
+	Ino      uint32
+	Show     uint32
+	Cookie   uint64
+}
+
+// NetlinkSocket is a netlink socket as reported by netlink_diag. PortId is
+// the address it is bound to, usually the pid of its owner for the first
+// socket of a process, and Groups the multicast groups it joined.
+type NetlinkSocket struct {
+	Type      uint8
+	Protocol  uint8
+	State     uint8
+	PortId    uint32
+	DstPortId uint32
+	DstGroup  uint32
+	Inode     uint32
+	Cookie    uint64
+	MemInfo   SkMemInfo
+	Groups    []uint32
+	Flags     uint32
+	HasFlags  bool
+	Attrs     []netlink.NetlinkAttr
+}
+
+func (req *NetlinkDiagReq) toWireFormat() []byte {
+	b := make([]byte, SizeofNetlinkDiagReq)
+	b[0] = req.Family
+	b[1] = req.Protocol
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = req.Pad
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = req.Ino
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = req.Show
+	*(*uint64)(unsafe.Pointer(&b[12:20][0])) = req.Cookie
+	return b
+}
+
+// netlinkGroups decodes the group bitmap, an array of unsigned long, into
+// the group numbers set in it.
+func netlinkGroups(data []byte) []uint32 {
+	groups := []uint32{}
+	wordsz := int(unsafe.Sizeof(uintptr(0)))
+	for i := 0; i+wordsz <= len(data); i += wordsz {
+		var word uint64
+		if wordsz == 8 {
+			word = *(*uint64)(unsafe.Pointer(&data[i : i+8][0]))
+		} else {
+			word = uint64(*(*uint32)(unsafe.Pointer(&data[i : i+4][0])))
+		}
+		for bit := 0; bit < wordsz*8; bit++ {
+			if word&(1<<uint(bit)) != 0 {
+				groups = append(groups, uint32(i*8+bit+1))
+			}
+		}
+	}
+	return groups
+}
+
+func NetlinkSocketfromWireFormat(data []byte) (*NetlinkSocket, error) {
+	if len(data) < SizeofNetlinkDiagMsg {
+		return nil, errors.New("short netlink_diag_msg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofNetlinkDiagMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &NetlinkSocket{
+		Type:      data[1],
+		Protocol:  data[2],
+		State:     data[3],
+		PortId:    *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		DstPortId: *(*uint32)(unsafe.Pointer(&data[8:12][0])),
+		DstGroup:  *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+		Inode:     *(*uint32)(unsafe.Pointer(&data[16:20][0])),
+		Cookie:    uint64(*(*uint32)(unsafe.Pointer(&data[20:24][0]))) | uint64(*(*uint32)(unsafe.Pointer(&data[24:28][0])))<<32,
+		Attrs:     attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case NETLINK_DIAG_MEMINFO:
+			s.MemInfo = SkMemInfofromWireFormat(attr.Data)
+		case NETLINK_DIAG_GROUPS:
+			s.Groups = netlinkGroups(attr.Data)
+		case NETLINK_DIAG_FLAGS:
+			s.Flags = attr.Uint32()
+			s.HasFlags = true
+		}
+	}
+
+	return s, nil
+}
+
+// ListNetlinkSockets dumps the netlink sockets of a protocol, or of every
+// protocol with NDIAG_PROTO_ALL. show is a set of NDIAG_SHOW_* flags.
+func (sl *SockDiagNLSocket) ListNetlinkSockets(protocol uint8, show uint32) ([]*NetlinkSocket, error) {
+	req := &NetlinkDiagReq{
+		Family:   syscall.AF_NETLINK,
+		Protocol: protocol,
+		Show:     show,
+	}
+
+	msgList, err := sl.dump(req.toWireFormat(), SizeofNetlinkDiagMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*NetlinkSocket{}
+
+	for _, msg := range msgList {
+		s, err := NetlinkSocketfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// FindNetlinkSocket returns the socket of a protocol bound to portid, such
+// as the one the audit daemon registered with AUDIT_STATUS_PID. Its Inode
+// can be looked up in SocketOwners to find the process holding it.
+func (sl *SockDiagNLSocket) FindNetlinkSocket(protocol uint8, portid uint32) (*NetlinkSocket, error) {
+	sockets, err := sl.ListNetlinkSockets(protocol, NDIAG_SHOW_GROUPS)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, s := range sockets {
+		if s.PortId == portid {
+			return s, nil
+		}
+	}
+
+	return nil, syscall.ENOENT
+}
@@ -0,0 +1,134 @@
+package sockdiag
+
+import (
+	"reflect"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestNetlinkDiagReqWireFormat(t *testing.T) {
+	req := &NetlinkDiagReq{Family: syscall.AF_NETLINK, Protocol: NDIAG_PROTO_ALL, Show: NDIAG_SHOW_GROUPS, Cookie: INET_DIAG_NOCOOKIE}
+	b := req.toWireFormat()
+	if len(b) != SizeofNetlinkDiagReq || b[0] != syscall.AF_NETLINK || b[1] != NDIAG_PROTO_ALL ||
+		*(*uint32)(unsafe.Pointer(&b[8])) != NDIAG_SHOW_GROUPS || *(*uint64)(unsafe.Pointer(&b[12])) != INET_DIAG_NOCOOKIE {
+		t.Errorf("got % x", b)
+	}
+}
+
+func TestNetlinkGroups(t *testing.T) {
+	wordsz := int(unsafe.Sizeof(uintptr(0)))
+
+	/* groups are numbered from one, by bit in each unsigned long */
+	data := make([]byte, 2*wordsz)
+	*(*uintptr)(unsafe.Pointer(&data[0])) = 1 | 1<<4
+	*(*uintptr)(unsafe.Pointer(&data[wordsz])) = 1 << 2
+	want := []uint32{1, 5, uint32(wordsz*8 + 3)}
+	if got := netlinkGroups(data); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	if got := netlinkGroups(data[:wordsz-1]); len(got) != 0 {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestNetlinkSocketfromWireFormat(t *testing.T) {
+	data := make([]byte, SizeofNetlinkDiagMsg)
+	data[0] = syscall.AF_NETLINK
+	data[1] = syscall.SOCK_RAW
+	data[2] = syscall.NETLINK_AUDIT
+	data[3] = 7
+	for i, v := range []uint32{1234, 0, 0, 99, 1, 2} {
+		*(*uint32)(unsafe.Pointer(&data[4+i*4])) = v
+	}
+	groups := make([]byte, unsafe.Sizeof(uintptr(0)))
+	groups[0] = 1
+	data = append(data, netlink.AttrsToWireFormat([]netlink.NetlinkAttr{
+		netlink.NewAttr(NETLINK_DIAG_GROUPS, groups),
+		netlink.NewAttrUint32(NETLINK_DIAG_FLAGS, NDIAG_FLAG_CAP_ACK),
+	})...)
+
+	s, err := NetlinkSocketfromWireFormat(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Type != syscall.SOCK_RAW || s.Protocol != syscall.NETLINK_AUDIT || s.State != 7 || s.PortId != 1234 ||
+		s.Inode != 99 || s.Cookie != 1|2<<32 || !reflect.DeepEqual(s.Groups, []uint32{1}) || !s.HasFlags ||
+		s.Flags != NDIAG_FLAG_CAP_ACK {
+		t.Errorf("got %+v", s)
+	}
+
+	if _, err := NetlinkSocketfromWireFormat(data[:SizeofNetlinkDiagMsg-1]); err == nil {
+		t.Error("short message parsed")
+	}
+}
+
+func TestNetlinkSockets(t *testing.T) {
+	sl := testNetns(t)
+
+	/* a route socket bound to the link group, as a monitor would be */
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, syscall.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	err = syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1 << (3 - 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sa, err := syscall.Getsockname(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portid := sa.(*syscall.SockaddrNetlink).Pid
+	var st syscall.Stat_t
+	err = syscall.Fstat(fd, &st)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sockets, err := sl.ListNetlinkSockets(NDIAG_PROTO_ALL, NDIAG_SHOW_GROUPS|NDIAG_SHOW_FLAGS|NDIAG_SHOW_MEMINFO)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found, self bool
+	for _, s := range sockets {
+		switch s.Protocol {
+		case syscall.NETLINK_ROUTE:
+			if s.PortId != portid {
+				continue
+			}
+			found = true
+			if s.Inode != uint32(st.Ino) || !reflect.DeepEqual(s.Groups, []uint32{3}) || !s.HasFlags || len(s.MemInfo) == 0 {
+				t.Errorf("got %+v", s)
+			}
+		case NETLINK_SOCK_DIAG:
+			/* the socket running the dump */
+			self = self || s.Flags&NDIAG_FLAG_CB_RUNNING != 0
+		}
+	}
+	if !found || !self {
+		t.Errorf("route socket found %v, dumping socket found %v", found, self)
+	}
+
+	s, err := sl.FindNetlinkSocket(syscall.NETLINK_ROUTE, portid)
+	if err != nil || s.Inode != uint32(st.Ino) {
+		t.Fatalf("got %+v, %v", s, err)
+	}
+	if _, err := sl.FindNetlinkSocket(syscall.NETLINK_AUDIT, portid); err != syscall.ENOENT {
+		t.Errorf("other protocol: %v", err)
+	}
+
+	owners, err := SocketOwners()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pids := owners[s.Inode]; !reflect.DeepEqual(pids, []int{syscall.Getpid()}) {
+		t.Errorf("owners: got %v", pids)
+	}
+}
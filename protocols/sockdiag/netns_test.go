@@ -0,0 +1,61 @@
+package sockdiag
+
+import (
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/apuigsech/netlink/protocols/route"
+)
+
+// testNetns moves the test to a network namespace of its own and returns a
+// socket in it, with the loopback link up. The namespace lives on the
+// thread of the test, which is left locked so that the runtime throws it
+// away when the test ends. Only the sockets of the test are found in it.
+// Tests are skipped when namespaces can not be created, such as when
+// unprivileged.
+func testNetns(t *testing.T) *SockDiagNLSocket {
+	t.Helper()
+	runtime.LockOSThread()
+
+	err := syscall.Unshare(syscall.CLONE_NEWNET)
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+
+	rl, err := route.OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.CloseLink()
+
+	lo, err := rl.GetLinkByName("lo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = rl.SetLinkUp(lo.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sl.CloseLink()
+	})
+
+	return sl
+}
+
+// skipUnsupported skips the test when the kernel lacks what err says it
+// does, such as inet_diag built as a module that is not available, which
+// sock_diag reports with ENOENT.
+func skipUnsupported(t *testing.T, err error) {
+	t.Helper()
+	if err == syscall.EOPNOTSUPP || err == syscall.EAFNOSUPPORT || err == syscall.EPROTONOSUPPORT || err == syscall.ENOENT {
+		t.Skipf("unsupported by the kernel: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package sockdiag
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+type SockDiagNLSocket netlink.NetlinkSocket
+
+// SkMemInfo holds the SK_MEMINFO_* counters of a socket, indexed by them.
+// Kernels may report fewer or more counters than SK_MEMINFO_DROPS.
+type SkMemInfo []uint32
+
+func SkMemInfofromWireFormat(data []byte) SkMemInfo {
+	m := make(SkMemInfo, len(data)/4)
+	for i := range m {
+		m[i] = *(*uint32)(unsafe.Pointer(&data[i*4 : i*4+4][0]))
+	}
+	return m
+}
+
+func OpenLink(group, pid uint32) (*SockDiagNLSocket, error) {
+	nl, err := netlink.OpenLink(NETLINK_SOCK_DIAG, group, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	return (*SockDiagNLSocket)(nl), nil
+}
+
+func (sl *SockDiagNLSocket) CloseLink() error {
+	nl := (*netlink.NetlinkSocket)(sl)
+	return nl.CloseLink()
+}
+
+func (sl *SockDiagNLSocket) AddMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(sl)
+	return nl.AddMembership(group)
+}
+
+func (sl *SockDiagNLSocket) DropMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(sl)
+	return nl.DropMembership(group)
+}
+
+func (sl *SockDiagNLSocket) RecvMessages(sz int, sockflags int) ([]netlink.NetlinkMessage, error) {
+	nl := (*netlink.NetlinkSocket)(sl)
+	return nl.RecvMessages(sz, sockflags)
+}
+
+// Execute sends a request and waits for the kernel to acknowledge it,
+// returning the replies it produced.
+func (sl *SockDiagNLSocket) Execute(msgtype, flags uint16, data []byte) ([]netlink.NetlinkMessage, error) {
+	nl := (*netlink.NetlinkSocket)(sl)
+	msg := &netlink.NetlinkMessage{
+		Header: syscall.NlMsghdr{
+			Type:  msgtype,
+			Flags: flags,
+		},
+		Data: data,
+	}
+
+	return nl.Execute(msg, 0)
+}
+
+// dump runs a SOCK_DIAG_BY_FAMILY dump and returns the replies carrying a
+// socket, skipping anything shorter than a message of the family.
+func (sl *SockDiagNLSocket) dump(data []byte, minlen int) ([]netlink.NetlinkMessage, error) {
+	msgList, err := sl.Execute(SOCK_DIAG_BY_FAMILY, syscall.NLM_F_DUMP, data)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []netlink.NetlinkMessage{}
+	for _, msg := range msgList {
+		if msg.Header.Type != SOCK_DIAG_BY_FAMILY || len(msg.Data) < minlen {
+			continue
+		}
+		ret = append(ret, msg)
+	}
+
+	return ret, nil
+}
+
+// SocketOwners maps socket inodes to the pids of the processes holding a
+// descriptor for them, scanning /proc like ss -p does. Processes that can
+// not be inspected are skipped, so the result is only complete when run
+// with enough privileges.
+func SocketOwners() (map[uint32][]int, error) {
+	procs, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	owners := map[uint32][]int{}
+
+	for _, p := range procs {
+		pid, err := strconv.Atoi(p.Name())
+		if err != nil {
+			continue
+		}
+
+		dir := filepath.Join("/proc", p.Name(), "fd")
+		fds, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		seen := map[uint32]bool{}
+		for _, fd := range fds {
+			link, err := os.Readlink(filepath.Join(dir, fd.Name()))
+			if err != nil || !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+				continue
+			}
+			ino, err := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 32)
+			if err != nil || seen[uint32(ino)] {
+				continue
+			}
+			seen[uint32(ino)] = true
+			owners[uint32(ino)] = append(owners[uint32(ino)], pid)
+		}
+	}
+
+	return owners, nil
+}
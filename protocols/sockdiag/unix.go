@@ -0,0 +1,176 @@
+package sockdiag
+
+import (
+	"errors"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+type UnixDiagReq struct {
+	Family   uint8
+	Protocol uint8
+	Pad      uint16
+	States   uint32
+	Ino      uint32
+	Show     uint32
+	Cookie   uint64
+}
+
+// UnixDiagVfs is the device and inode of the file a socket is bound to.
+type UnixDiagVfs struct {
+	Ino uint32
+	Dev uint32
+}
+
+// UnixSocket is a UNIX socket as reported by unix_diag. Name starts with a
+// zero byte for abstract sockets and is a path otherwise. Peer is the inode
+// of the connected socket and Icons those of the connections waiting to be
+// accepted on a listener.
+type UnixSocket struct {
+	Type     uint8
+	State    uint8
+	Inode    uint32
+	Cookie   uint64
+	Name     string
+	Vfs      *UnixDiagVfs
+	Peer     uint32
+	HasPeer  bool
+	Icons    []uint32
+	RQueue   uint32
+	WQueue   uint32
+	HasRQLen bool
+	MemInfo  SkMemInfo
+	Shutdown uint8
+	Uid      uint32
+	HasUid   bool
+	Attrs    []netlink.NetlinkAttr
+}
+
+func (req *UnixDiagReq) toWireFormat() []byte {
+	b := make([]byte, SizeofUnixDiagReq)
+	b[0] = req.Family
+	b[1] = req.Protocol
+	*(*uint16)(unsafe.Pointer(&b[2:4][0])) = req.Pad
+	*(*uint32)(unsafe.Pointer(&b[4:8][0])) = req.States
+	*(*uint32)(unsafe.Pointer(&b[8:12][0])) = req.Ino
+	*(*uint32)(unsafe.Pointer(&b[12:16][0])) = req.Show
+	*(*uint64)(unsafe.Pointer(&b[16:24][0])) = req.Cookie
+	return b
+}
+
+func UnixSocketfromWireFormat(data []byte) (*UnixSocket, error) {
+	if len(data) < SizeofUnixDiagMsg {
+		return nil, errors.New("short unix_diag_msg")
+	}
+
+	attrs, err := netlink.ParseNetlinkAttrs(data[SizeofUnixDiagMsg:])
+	if err != nil {
+		return nil, err
+	}
+
+	s := &UnixSocket{
+		Type:   data[1],
+		State:  data[2],
+		Inode:  *(*uint32)(unsafe.Pointer(&data[4:8][0])),
+		Cookie: uint64(*(*uint32)(unsafe.Pointer(&data[8:12][0]))) | uint64(*(*uint32)(unsafe.Pointer(&data[12:16][0])))<<32,
+		Attrs:  attrs,
+	}
+
+	for _, attr := range attrs {
+		switch attr.AttrType() {
+		case UNIX_DIAG_NAME:
+			s.Name = string(attr.Data)
+			if len(s.Name) > 0 && s.Name[0] != 0 {
+				s.Name = strings.TrimRight(s.Name, "\x00")
+			}
+		case UNIX_DIAG_VFS:
+			if len(attr.Data) >= 8 {
+				s.Vfs = &UnixDiagVfs{
+					Ino: *(*uint32)(unsafe.Pointer(&attr.Data[0:4][0])),
+					Dev: *(*uint32)(unsafe.Pointer(&attr.Data[4:8][0])),
+				}
+			}
+		case UNIX_DIAG_PEER:
+			s.Peer = attr.Uint32()
+			s.HasPeer = true
+		case UNIX_DIAG_ICONS:
+			s.Icons = make([]uint32, len(attr.Data)/4)
+			for i := range s.Icons {
+				s.Icons[i] = *(*uint32)(unsafe.Pointer(&attr.Data[i*4 : i*4+4][0]))
+			}
+		case UNIX_DIAG_RQLEN:
+			if len(attr.Data) >= 8 {
+				s.RQueue = *(*uint32)(unsafe.Pointer(&attr.Data[0:4][0]))
+				s.WQueue = *(*uint32)(unsafe.Pointer(&attr.Data[4:8][0]))
+				s.HasRQLen = true
+			}
+		case UNIX_DIAG_MEMINFO:
+			s.MemInfo = SkMemInfofromWireFormat(attr.Data)
+		case UNIX_DIAG_SHUTDOWN:
+			s.Shutdown = attr.Uint8()
+		case UNIX_DIAG_UID:
+			s.Uid = attr.Uint32()
+			s.HasUid = true
+		}
+	}
+
+	return s, nil
+}
+
+// ListUnixSockets dumps the UNIX sockets in one of states, all of them if
+// zero. show is a set of UDIAG_SHOW_* flags selecting what is reported.
+func (sl *SockDiagNLSocket) ListUnixSockets(states, show uint32) ([]*UnixSocket, error) {
+	if states == 0 {
+		states = TCPF_ALL
+	}
+
+	req := &UnixDiagReq{
+		Family: syscall.AF_UNIX,
+		States: states,
+		Show:   show,
+	}
+
+	msgList, err := sl.dump(req.toWireFormat(), SizeofUnixDiagMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*UnixSocket{}
+
+	for _, msg := range msgList {
+		s, err := UnixSocketfromWireFormat(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, s)
+	}
+
+	return ret, nil
+}
+
+// GetUnixSocket looks up a UNIX socket by inode.
+func (sl *SockDiagNLSocket) GetUnixSocket(ino, show uint32) (*UnixSocket, error) {
+	req := &UnixDiagReq{
+		Family: syscall.AF_UNIX,
+		Ino:    ino,
+		Show:   show,
+		Cookie: INET_DIAG_NOCOOKIE,
+	}
+
+	msgList, err := sl.Execute(SOCK_DIAG_BY_FAMILY, 0, req.toWireFormat())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, msg := range msgList {
+		if msg.Header.Type != SOCK_DIAG_BY_FAMILY {
+			continue
+		}
+		return UnixSocketfromWireFormat(msg.Data)
+	}
+
+	return nil, syscall.ENOENT
+}
@@ -0,0 +1,188 @@
+package sockdiag
+
+import (
+	"net"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestUnixDiagReqWireFormat(t *testing.T) {
+	req := &UnixDiagReq{Family: syscall.AF_UNIX, States: TCPF_ALL, Ino: 7, Show: UDIAG_SHOW_NAME, Cookie: INET_DIAG_NOCOOKIE}
+	b := req.toWireFormat()
+	if len(b) != SizeofUnixDiagReq || b[0] != syscall.AF_UNIX || *(*uint32)(unsafe.Pointer(&b[4])) != TCPF_ALL ||
+		*(*uint32)(unsafe.Pointer(&b[8])) != 7 || *(*uint32)(unsafe.Pointer(&b[12])) != UDIAG_SHOW_NAME ||
+		*(*uint64)(unsafe.Pointer(&b[16])) != INET_DIAG_NOCOOKIE {
+		t.Errorf("got % x", b)
+	}
+}
+
+func TestUnixSocketfromWireFormat(t *testing.T) {
+	msg := func(attrs ...netlink.NetlinkAttr) []byte {
+		data := make([]byte, SizeofUnixDiagMsg)
+		data[0] = syscall.AF_UNIX
+		data[1] = syscall.SOCK_STREAM
+		data[2] = TCP_LISTEN
+		*(*uint32)(unsafe.Pointer(&data[4])) = 100
+		*(*uint32)(unsafe.Pointer(&data[8])) = 1
+		*(*uint32)(unsafe.Pointer(&data[12])) = 2
+		return append(data, netlink.AttrsToWireFormat(attrs)...)
+	}
+	pair := func(a, b uint32) []byte {
+		data := make([]byte, 8)
+		*(*uint32)(unsafe.Pointer(&data[0])) = a
+		*(*uint32)(unsafe.Pointer(&data[4])) = b
+		return data
+	}
+
+	s, err := UnixSocketfromWireFormat(msg(
+		netlink.NewAttr(UNIX_DIAG_NAME, []byte("/run/test.sock\x00")),
+		netlink.NewAttr(UNIX_DIAG_VFS, pair(5, 6)),
+		netlink.NewAttrUint32(UNIX_DIAG_PEER, 0),
+		netlink.NewAttr(UNIX_DIAG_ICONS, pair(101, 102)),
+		netlink.NewAttr(UNIX_DIAG_RQLEN, pair(1, 128)),
+		netlink.NewAttrUint8(UNIX_DIAG_SHUTDOWN, 2),
+		netlink.NewAttrUint32(UNIX_DIAG_UID, 1000),
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &UnixSocket{
+		Type:     syscall.SOCK_STREAM,
+		State:    TCP_LISTEN,
+		Inode:    100,
+		Cookie:   1 | 2<<32,
+		Name:     "/run/test.sock",
+		Vfs:      &UnixDiagVfs{Ino: 5, Dev: 6},
+		HasPeer:  true,
+		Icons:    []uint32{101, 102},
+		RQueue:   1,
+		WQueue:   128,
+		HasRQLen: true,
+		Shutdown: 2,
+		Uid:      1000,
+		HasUid:   true,
+		Attrs:    s.Attrs,
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v, want %+v", s, want)
+	}
+
+	/* abstract names keep their leading zero byte */
+	s, err = UnixSocketfromWireFormat(msg(netlink.NewAttr(UNIX_DIAG_NAME, []byte("\x00test\x00"))))
+	if err != nil || s.Name != "\x00test\x00" || s.HasPeer || s.HasUid {
+		t.Errorf("got %+v, %v", s, err)
+	}
+
+	if _, err := UnixSocketfromWireFormat(make([]byte, SizeofUnixDiagMsg-1)); err == nil {
+		t.Error("short message parsed")
+	}
+}
+
+// findUnix returns the socket with inode ino.
+func findUnix(sockets []*UnixSocket, ino uint32) *UnixSocket {
+	for _, s := range sockets {
+		if s.Inode == ino {
+			return s
+		}
+	}
+	return nil
+}
+
+// unixInode returns the inode of the socket under a connection.
+func unixInode(t *testing.T, c syscall.Conn) uint32 {
+	t.Helper()
+	rc, err := c.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st syscall.Stat_t
+	rc.Control(func(fd uintptr) {
+		err = syscall.Fstat(int(fd), &st)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return uint32(st.Ino)
+}
+
+func TestUnixSockets(t *testing.T) {
+	sl := testNetns(t)
+
+	path := filepath.Join(t.TempDir(), "test.sock")
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lino := unixInode(t, ln)
+
+	abstract, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "@sockdiag-test", Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer abstract.Close()
+	aino := unixInode(t, abstract)
+
+	/* the connection waits on the listener until accepted */
+	client, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	cino := unixInode(t, client)
+
+	show := uint32(UDIAG_SHOW_NAME | UDIAG_SHOW_VFS | UDIAG_SHOW_PEER | UDIAG_SHOW_ICONS | UDIAG_SHOW_RQLEN |
+		UDIAG_SHOW_MEMINFO | UDIAG_SHOW_UID)
+	sockets, err := sl.ListUnixSockets(0, show)
+	skipUnsupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := findUnix(sockets, lino)
+	if l == nil || l.Type != syscall.SOCK_STREAM || l.State != TCP_LISTEN || l.Name != path || l.Vfs == nil ||
+		!reflect.DeepEqual(l.Icons, []uint32{cino}) || !l.HasRQLen || l.RQueue != 1 || !l.HasUid || l.Uid != uint32(syscall.Getuid()) ||
+		len(l.MemInfo) == 0 {
+		t.Fatalf("listener: got %+v", l)
+	}
+	/* the socket waiting to be accepted has no inode yet */
+	c := findUnix(sockets, cino)
+	if c == nil || c.State != TCP_ESTABLISHED || !c.HasPeer || c.Peer != 0 {
+		t.Errorf("client: got %+v", c)
+	}
+	a := findUnix(sockets, aino)
+	if a == nil || a.Type != syscall.SOCK_DGRAM || a.Name != "\x00sockdiag-test" || a.Vfs != nil {
+		t.Errorf("abstract: got %+v", a)
+	}
+
+	server, err := ln.AcceptUnix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	sino := unixInode(t, server)
+
+	s, err := sl.GetUnixSocket(sino, UDIAG_SHOW_PEER)
+	if err != nil || s.Inode != sino || !s.HasPeer || s.Peer != cino || s.HasUid {
+		t.Errorf("get: got %+v, %v", s, err)
+	}
+	s, err = sl.GetUnixSocket(cino, UDIAG_SHOW_PEER)
+	if err != nil || s.Peer != sino {
+		t.Errorf("get client: got %+v, %v", s, err)
+	}
+	s, err = sl.GetUnixSocket(lino, UDIAG_SHOW_ICONS)
+	if err != nil || len(s.Icons) != 0 {
+		t.Errorf("get listener: got %+v, %v", s, err)
+	}
+
+	/* states select sockets */
+	sockets, err = sl.ListUnixSockets(1<<TCP_LISTEN, 0)
+	if err != nil || len(sockets) != 1 || sockets[0].Inode != lino {
+		t.Errorf("listeners: got %+v, %v", sockets, err)
+	}
+}
@@ -0,0 +1,48 @@
+package taskstats
+
+const (
+	TASKSTATS_GENL_NAME    = "TASKSTATS"
+	TASKSTATS_GENL_VERSION = 0x1
+
+	TASKSTATS_VERSION = 14
+	TS_COMM_LEN       = 32
+
+	SizeofCgroupStats = 40
+
+	/* Commands */
+	TASKSTATS_CMD_UNSPEC   = 0
+	TASKSTATS_CMD_GET      = 1
+	TASKSTATS_CMD_NEW      = 2
+	CGROUPSTATS_CMD_UNSPEC = 3
+	CGROUPSTATS_CMD_GET    = 4
+	CGROUPSTATS_CMD_NEW    = 5
+
+	/* Reply attributes */
+	TASKSTATS_TYPE_UNSPEC    = 0
+	TASKSTATS_TYPE_PID       = 1
+	TASKSTATS_TYPE_TGID      = 2
+	TASKSTATS_TYPE_STATS     = 3
+	TASKSTATS_TYPE_AGGR_PID  = 4
+	TASKSTATS_TYPE_AGGR_TGID = 5
+	TASKSTATS_TYPE_NULL      = 6
+
+	/* Request attributes */
+	TASKSTATS_CMD_ATTR_UNSPEC             = 0
+	TASKSTATS_CMD_ATTR_PID                = 1
+	TASKSTATS_CMD_ATTR_TGID               = 2
+	TASKSTATS_CMD_ATTR_REGISTER_CPUMASK   = 3
+	TASKSTATS_CMD_ATTR_DEREGISTER_CPUMASK = 4
+
+	CGROUPSTATS_TYPE_UNSPEC       = 0
+	CGROUPSTATS_TYPE_CGROUP_STATS = 1
+
+	CGROUPSTATS_CMD_ATTR_UNSPEC = 0
+	CGROUPSTATS_CMD_ATTR_FD     = 1
+
+	/* Accounting flags of ac_flag, from <linux/acct.h> */
+	AFORK   = 0x01
+	ASU     = 0x02
+	ACOMPAT = 0x04
+	ACORE   = 0x08
+	AXSIG   = 0x10
+)
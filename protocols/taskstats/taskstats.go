@@ -0,0 +1,329 @@
+package taskstats
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+	"github.com/apuigsech/netlink/protocols/genetlink"
+)
+
+// TaskstatsNLSocket is a generic netlink socket bound to the taskstats
+// family.
+type TaskstatsNLSocket struct {
+	gl     *genetlink.GenlNLSocket
+	Family uint16
+}
+
+// Taskstats mirrors struct taskstats. Kernels report the fields up to their
+// Version, the others are left to zero. Delays are in nanoseconds, CPU times
+// in microseconds and memory high-water marks in KB.
+type Taskstats struct {
+	Version  uint16
+	ExitCode uint32
+	Flag     uint8
+	Nice     uint8
+
+	CpuCount           uint64
+	CpuDelayTotal      uint64
+	BlkioCount         uint64
+	BlkioDelayTotal    uint64
+	SwapinCount        uint64
+	SwapinDelayTotal   uint64
+	CpuRunRealTotal    uint64
+	CpuRunVirtualTotal uint64
+
+	Comm   [TS_COMM_LEN]byte
+	Sched  uint8
+	Pad    [3]uint8
+	_      [4]byte
+	Uid    uint32
+	Gid    uint32
+	Pid    uint32
+	Ppid   uint32
+	Btime  uint32
+	Etime  uint64
+	Utime  uint64
+	Stime  uint64
+	Minflt uint64
+	Majflt uint64
+
+	Coremem    uint64
+	Virtmem    uint64
+	HiwaterRss uint64
+	HiwaterVm  uint64
+
+	ReadChar      uint64
+	WriteChar     uint64
+	ReadSyscalls  uint64
+	WriteSyscalls uint64
+
+	ReadBytes           uint64
+	WriteBytes          uint64
+	CancelledWriteBytes uint64
+
+	Nvcsw  uint64
+	Nivcsw uint64
+
+	UtimeScaled           uint64
+	StimeScaled           uint64
+	CpuScaledRunRealTotal uint64
+
+	FreepagesCount      uint64
+	FreepagesDelayTotal uint64
+
+	ThrashingCount      uint64
+	ThrashingDelayTotal uint64
+
+	Btime64 uint64
+
+	CompactCount      uint64
+	CompactDelayTotal uint64
+
+	Tgid     uint32
+	Tgetime  uint64
+	ExeDev   uint64
+	ExeInode uint64
+
+	WpcopyCount      uint64
+	WpcopyDelayTotal uint64
+
+	IrqCount      uint64
+	IrqDelayTotal uint64
+}
+
+// TaskstatsEvent is the accounting record of an exiting task. For
+// multithreaded processes the record of the whole thread group follows,
+// with Tgid set instead of Pid, when the last thread exits.
+type TaskstatsEvent struct {
+	Pid   uint32
+	Tgid  uint32
+	Stats *Taskstats
+}
+
+// CgroupStats counts the tasks of a cgroup by state.
+type CgroupStats struct {
+	NrSleeping        uint64
+	NrRunning         uint64
+	NrStopped         uint64
+	NrUninterruptible uint64
+	NrIoWait          uint64
+}
+
+type TaskstatsCallback func(*TaskstatsEvent, chan error, ...interface{})
+
+func TaskstatsfromWireFormat(data []byte) *Taskstats {
+	st := &Taskstats{}
+	n := int(unsafe.Sizeof(*st))
+	if len(data) < n {
+		n = len(data)
+	}
+	copy((*[unsafe.Sizeof(Taskstats{})]byte)(unsafe.Pointer(st))[:n], data[:n])
+	return st
+}
+
+func CgroupStatsfromWireFormat(data []byte) *CgroupStats {
+	st := &CgroupStats{}
+	n := int(unsafe.Sizeof(*st))
+	if len(data) < n {
+		n = len(data)
+	}
+	copy((*[unsafe.Sizeof(CgroupStats{})]byte)(unsafe.Pointer(st))[:n], data[:n])
+	return st
+}
+
+func (st *Taskstats) Command() string {
+	comm := string(st.Comm[:])
+	if i := strings.IndexByte(comm, 0); i >= 0 {
+		comm = comm[:i]
+	}
+	return comm
+}
+
+// BeginTime returns when the task started, which together with its pid
+// identifies it in other records such as the audit ones.
+func (st *Taskstats) BeginTime() time.Time {
+	if st.Btime64 != 0 {
+		return time.Unix(int64(st.Btime64), 0)
+	}
+	return time.Unix(int64(st.Btime), 0)
+}
+
+// Elapsed returns the time the task has been running for, or ran for if it
+// exited.
+func (st *Taskstats) Elapsed() time.Duration {
+	return time.Duration(st.Etime) * time.Microsecond
+}
+
+// TaskstatsEventsfromAttrs returns the records of a reply or notification,
+// one per AGGR_PID and AGGR_TGID attribute.
+func TaskstatsEventsfromAttrs(attrs []netlink.NetlinkAttr) ([]*TaskstatsEvent, error) {
+	ret := []*TaskstatsEvent{}
+
+	for _, attr := range attrs {
+		if attr.AttrType() != TASKSTATS_TYPE_AGGR_PID && attr.AttrType() != TASKSTATS_TYPE_AGGR_TGID {
+			continue
+		}
+		nattrs, err := attr.Nested()
+		if err != nil {
+			return nil, err
+		}
+		ev := &TaskstatsEvent{}
+		for _, nattr := range nattrs {
+			switch nattr.AttrType() {
+			case TASKSTATS_TYPE_PID:
+				ev.Pid = nattr.Uint32()
+			case TASKSTATS_TYPE_TGID:
+				ev.Tgid = nattr.Uint32()
+			case TASKSTATS_TYPE_STATS:
+				ev.Stats = TaskstatsfromWireFormat(nattr.Data)
+			}
+		}
+		if ev.Stats == nil {
+			return nil, errors.New("taskstats record without stats")
+		}
+		ret = append(ret, ev)
+	}
+
+	return ret, nil
+}
+
+func OpenLink(group, pid uint32) (*TaskstatsNLSocket, error) {
+	gl, err := genetlink.OpenLink(group, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := gl.GetFamily(TASKSTATS_GENL_NAME)
+	if err != nil {
+		gl.CloseLink()
+		return nil, err
+	}
+
+	return &TaskstatsNLSocket{gl: gl, Family: f.Id}, nil
+}
+
+func (tl *TaskstatsNLSocket) CloseLink() error {
+	return tl.gl.CloseLink()
+}
+
+func (tl *TaskstatsNLSocket) execute(cmd uint8, attrs []netlink.NetlinkAttr) ([]*genetlink.GenlMessage, error) {
+	hdr := &genetlink.GenlMsgHdr{Cmd: cmd, Version: TASKSTATS_GENL_VERSION}
+	return tl.gl.Execute(tl.Family, 0, hdr, attrs)
+}
+
+func (tl *TaskstatsNLSocket) getStats(attrtype uint16, id uint32) (*Taskstats, error) {
+	msgList, err := tl.execute(TASKSTATS_CMD_GET, []netlink.NetlinkAttr{netlink.NewAttrUint32(attrtype, id)})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gm := range msgList {
+		evs, err := TaskstatsEventsfromAttrs(gm.Attrs)
+		if err != nil {
+			return nil, err
+		}
+		if len(evs) > 0 {
+			return evs[0].Stats, nil
+		}
+	}
+
+	return nil, syscall.ENOENT
+}
+
+// GetPidStats returns the stats of a single thread.
+func (tl *TaskstatsNLSocket) GetPidStats(pid uint32) (*Taskstats, error) {
+	return tl.getStats(TASKSTATS_CMD_ATTR_PID, pid)
+}
+
+// GetTgidStats returns the stats of a process, summed over its threads,
+// including the ones that already exited. Only the delays, CPU times and
+// context switches are summed, the fields identifying the task are left to
+// zero.
+func (tl *TaskstatsNLSocket) GetTgidStats(tgid uint32) (*Taskstats, error) {
+	return tl.getStats(TASKSTATS_CMD_ATTR_TGID, tgid)
+}
+
+// RegisterCpumask asks for the records of the tasks exiting on the CPUs of
+// mask, a list such as "0-3,8", to be sent to the socket. It needs
+// CAP_NET_ADMIN.
+func (tl *TaskstatsNLSocket) RegisterCpumask(mask string) error {
+	_, err := tl.execute(TASKSTATS_CMD_GET, []netlink.NetlinkAttr{netlink.NewAttrString(TASKSTATS_CMD_ATTR_REGISTER_CPUMASK, mask)})
+	return err
+}
+
+func (tl *TaskstatsNLSocket) DeregisterCpumask(mask string) error {
+	_, err := tl.execute(TASKSTATS_CMD_GET, []netlink.NetlinkAttr{netlink.NewAttrString(TASKSTATS_CMD_ATTR_DEREGISTER_CPUMASK, mask)})
+	return err
+}
+
+// GetCgroupStats counts the tasks of the cgroup at path by state. The kernel
+// only supports it for cgroup v1 hierarchies.
+func (tl *TaskstatsNLSocket) GetCgroupStats(path string) (*CgroupStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hdr := &genetlink.GenlMsgHdr{Cmd: CGROUPSTATS_CMD_GET, Version: TASKSTATS_GENL_VERSION}
+	attrs := []netlink.NetlinkAttr{netlink.NewAttrUint32(CGROUPSTATS_CMD_ATTR_FD, uint32(f.Fd()))}
+
+	msgList, err := tl.gl.Execute(tl.Family, 0, hdr, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, gm := range msgList {
+		for _, attr := range gm.Attrs {
+			if attr.AttrType() == CGROUPSTATS_TYPE_CGROUP_STATS {
+				return CgroupStatsfromWireFormat(attr.Data), nil
+			}
+		}
+	}
+
+	return nil, syscall.ENOENT
+}
+
+// StartExitMonitor calls cb for every exit record sent to the socket once
+// RegisterCpumask was called. Records lost because the socket could not
+// keep up are reported as ENOBUFS on ec. The socket should not be used for
+// requests once the monitor is running.
+func (tl *TaskstatsNLSocket) StartExitMonitor(cb TaskstatsCallback, ec chan error, args ...interface{}) error {
+	go func() {
+		for {
+			msgList, err := tl.gl.RecvMessages(netlink.RECV_BUFFER_SIZE, 0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			for _, gm := range msgList {
+				if gm.Family != tl.Family || gm.Header.Cmd != TASKSTATS_CMD_NEW {
+					continue
+				}
+				evs, err := TaskstatsEventsfromAttrs(gm.Attrs)
+				if err != nil {
+					if ec != nil {
+						ec <- err
+					}
+					continue
+				}
+				for _, ev := range evs {
+					cb(ev, ec, args...)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
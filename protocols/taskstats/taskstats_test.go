@@ -0,0 +1,293 @@
+package taskstats
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+func TestTaskstatsLayout(t *testing.T) {
+	var st Taskstats
+	offsets := []struct {
+		name string
+		got  uintptr
+		want uintptr
+	}{
+		{"ac_exitcode", unsafe.Offsetof(st.ExitCode), 4},
+		{"cpu_count", unsafe.Offsetof(st.CpuCount), 16},
+		{"ac_comm", unsafe.Offsetof(st.Comm), 80},
+		{"ac_sched", unsafe.Offsetof(st.Sched), 112},
+		{"ac_uid", unsafe.Offsetof(st.Uid), 120},
+		{"ac_btime", unsafe.Offsetof(st.Btime), 136},
+		{"ac_etime", unsafe.Offsetof(st.Etime), 144},
+		{"hiwater_rss", unsafe.Offsetof(st.HiwaterRss), 200},
+		{"nvcsw", unsafe.Offsetof(st.Nvcsw), 272},
+		{"ac_btime64", unsafe.Offsetof(st.Btime64), 344},
+		{"ac_tgid", unsafe.Offsetof(st.Tgid), 368},
+		{"ac_tgetime", unsafe.Offsetof(st.Tgetime), 376},
+		{"irq_delay_total", unsafe.Offsetof(st.IrqDelayTotal), 424},
+		{"sizeof", unsafe.Sizeof(st), 432},
+	}
+	for _, o := range offsets {
+		if o.got != o.want {
+			t.Errorf("%s: got %d, want %d", o.name, o.got, o.want)
+		}
+	}
+
+	var cg CgroupStats
+	if unsafe.Sizeof(cg) != SizeofCgroupStats {
+		t.Errorf("cgroupstats: got %d bytes", unsafe.Sizeof(cg))
+	}
+}
+
+// testStats builds a struct taskstats of n bytes.
+func testStats(n int) []byte {
+	data := make([]byte, 512)
+	*(*uint16)(unsafe.Pointer(&data[0])) = TASKSTATS_VERSION
+	copy(data[80:], "worker")
+	*(*uint32)(unsafe.Pointer(&data[128])) = 42
+	*(*uint32)(unsafe.Pointer(&data[136])) = 1000
+	*(*uint64)(unsafe.Pointer(&data[144])) = 2500000
+	*(*uint64)(unsafe.Pointer(&data[344])) = 2000
+	*(*uint32)(unsafe.Pointer(&data[368])) = 40
+	return data[:n]
+}
+
+func TestTaskstatsfromWireFormat(t *testing.T) {
+	/* older kernels send fewer fields, newer ones more */
+	for _, n := range []int{328, 432, 512} {
+		st := TaskstatsfromWireFormat(testStats(n))
+		if st.Version != TASKSTATS_VERSION || st.Command() != "worker" || st.Pid != 42 || st.Elapsed() != 2500*time.Millisecond {
+			t.Errorf("%d bytes: got %+v", n, st)
+		}
+		if n < 344 {
+			if st.Btime64 != 0 || st.Tgid != 0 || !st.BeginTime().Equal(time.Unix(1000, 0)) {
+				t.Errorf("%d bytes: got %+v", n, st)
+			}
+		} else if st.Tgid != 40 || !st.BeginTime().Equal(time.Unix(2000, 0)) {
+			t.Errorf("%d bytes: got %+v", n, st)
+		}
+	}
+
+	/* a command filling the field has no terminating zero */
+	st := &Taskstats{}
+	copy(st.Comm[:], strings.Repeat("x", TS_COMM_LEN))
+	if st.Command() != strings.Repeat("x", TS_COMM_LEN) {
+		t.Errorf("got %q", st.Command())
+	}
+
+	data := make([]byte, SizeofCgroupStats)
+	for i := 0; i < 5; i++ {
+		*(*uint64)(unsafe.Pointer(&data[i*8])) = uint64(i + 1)
+	}
+	cg := CgroupStatsfromWireFormat(data)
+	if *cg != (CgroupStats{1, 2, 3, 4, 5}) {
+		t.Errorf("got %+v", cg)
+	}
+}
+
+func TestTaskstatsEventsfromAttrs(t *testing.T) {
+	attrs := []netlink.NetlinkAttr{
+		netlink.NewAttrNested(TASKSTATS_TYPE_AGGR_PID, []netlink.NetlinkAttr{
+			netlink.NewAttrUint32(TASKSTATS_TYPE_PID, 42),
+			netlink.NewAttr(TASKSTATS_TYPE_STATS, testStats(432)),
+		}),
+		netlink.NewAttr(TASKSTATS_TYPE_NULL, nil),
+		netlink.NewAttrNested(TASKSTATS_TYPE_AGGR_TGID, []netlink.NetlinkAttr{
+			netlink.NewAttrUint32(TASKSTATS_TYPE_TGID, 40),
+			netlink.NewAttr(TASKSTATS_TYPE_STATS, testStats(432)),
+		}),
+	}
+
+	evs, err := TaskstatsEventsfromAttrs(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evs) != 2 || evs[0].Pid != 42 || evs[0].Tgid != 0 || evs[0].Stats.Pid != 42 ||
+		evs[1].Pid != 0 || evs[1].Tgid != 40 || evs[1].Stats == nil {
+		t.Errorf("got %+v", evs)
+	}
+
+	_, err = TaskstatsEventsfromAttrs([]netlink.NetlinkAttr{
+		netlink.NewAttrNested(TASKSTATS_TYPE_AGGR_PID, []netlink.NetlinkAttr{netlink.NewAttrUint32(TASKSTATS_TYPE_PID, 42)}),
+	})
+	if err == nil {
+		t.Error("record without stats parsed")
+	}
+}
+
+// openLink opens a taskstats socket, skipping the test when the family is
+// not available to it. It is only registered in the initial network
+// namespace and needs CAP_NET_ADMIN.
+func openLink(t *testing.T) *TaskstatsNLSocket {
+	t.Helper()
+	tl, err := OpenLink(0, 0)
+	if err != nil {
+		t.Skipf("taskstats unavailable: %v", err)
+	}
+
+	_, err = tl.GetPidStats(uint32(os.Getpid()))
+	if err == syscall.EPERM {
+		tl.CloseLink()
+		t.Skipf("taskstats unavailable: %v", err)
+	}
+	return tl
+}
+
+// testLink opens a taskstats socket closed when the test ends.
+func testLink(t *testing.T) *TaskstatsNLSocket {
+	t.Helper()
+	tl := openLink(t)
+	t.Cleanup(func() {
+		tl.CloseLink()
+	})
+	return tl
+}
+
+func TestGetStats(t *testing.T) {
+	tl := testLink(t)
+
+	st, err := tl.GetPidStats(uint32(syscall.Gettid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	comm, _ := os.ReadFile("/proc/thread-self/comm")
+	if st.Version < 8 || st.Pid != uint32(syscall.Gettid()) || st.Ppid != uint32(os.Getppid()) ||
+		st.Uid != uint32(os.Getuid()) || st.Command() != strings.TrimSpace(string(comm)) {
+		t.Errorf("got %+v", st)
+	}
+	if start := st.BeginTime(); start.After(time.Now()) || time.Since(start) > time.Hour || st.Elapsed() <= 0 {
+		t.Errorf("started %v, elapsed %v", start, st.Elapsed())
+	}
+	if st.HiwaterRss == 0 || st.HiwaterVm == 0 || st.Nvcsw+st.Nivcsw == 0 {
+		t.Errorf("got %+v", st)
+	}
+	if st.Version >= 13 && st.Tgid != uint32(os.Getpid()) {
+		t.Errorf("tgid %d", st.Tgid)
+	}
+
+	st, err = tl.GetTgidStats(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Version < 8 || st.Nvcsw+st.Nivcsw == 0 {
+		t.Errorf("got %+v", st)
+	}
+
+	/* pid 0 is never a task */
+	if _, err := tl.GetPidStats(0); err == nil {
+		t.Error("got the stats of pid 0")
+	}
+}
+
+// possibleCpus returns the CPU list a mask can be registered on.
+func possibleCpus() string {
+	data, err := os.ReadFile("/sys/devices/system/cpu/possible")
+	if err != nil {
+		return "0"
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// testExitMonitor starts an exit monitor on a new socket registered on every
+// CPU. Closing a socket does not wake a monitor blocked reading it, which
+// would then go on reading whatever socket is given its descriptor next, so
+// when the test ends processes are run until the monitor sees it closed.
+func testExitMonitor(t *testing.T) (chan *TaskstatsEvent, chan error) {
+	t.Helper()
+	tl := openLink(t)
+
+	err := tl.RegisterCpumask(possibleCpus())
+	if err != nil {
+		tl.CloseLink()
+		t.Fatal(err)
+	}
+	/* lists past the CPUs the kernel was built for are rejected */
+	if err := tl.RegisterCpumask("100000"); err != syscall.ERANGE {
+		t.Errorf("impossible cpu: %v", err)
+	}
+
+	events := make(chan *TaskstatsEvent, 100)
+	ec := make(chan error, 10)
+	cb := func(ev *TaskstatsEvent, ec chan error, args ...interface{}) {
+		select {
+		case events <- ev:
+		default:
+		}
+	}
+	err = tl.StartExitMonitor(cb, ec)
+	if err != nil {
+		tl.CloseLink()
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		tl.CloseLink()
+		for i := 0; i < 50; i++ {
+			exec.Command("/bin/true").Run()
+			select {
+			case err := <-ec:
+				if err == syscall.EBADF {
+					return
+				}
+			case <-time.After(100 * time.Millisecond):
+			}
+		}
+		t.Error("exit monitor still running")
+	})
+	return events, ec
+}
+
+func TestExitMonitor(t *testing.T) {
+	events, ec := testExitMonitor(t)
+
+	cmd := exec.Command("/bin/sh", "-c", "exit 3")
+	err := cmd.Run()
+	if _, ok := err.(*exec.ExitError); !ok {
+		t.Fatalf("got %v", err)
+	}
+	pid := uint32(cmd.Process.Pid)
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev := <-events:
+			if ev.Pid != pid {
+				continue
+			}
+			st := ev.Stats
+			if st.Pid != pid || st.Ppid != uint32(os.Getpid()) || st.ExitCode != 3<<8 || st.Command() != "sh" ||
+				st.Flag&AFORK != 0 {
+				t.Errorf("got %+v", st)
+			}
+			return
+		case err := <-ec:
+			t.Fatal(err)
+		case <-timeout:
+			t.Fatal("timed out waiting for the exit record")
+		}
+	}
+}
+
+func TestGetCgroupStats(t *testing.T) {
+	tl := testLink(t)
+
+	if _, err := tl.GetCgroupStats("/nonexistent"); !os.IsNotExist(err) {
+		t.Errorf("missing cgroup: %v", err)
+	}
+
+	/* only cgroup v1 hierarchies are supported */
+	st, err := tl.GetCgroupStats("/sys/fs/cgroup/cpu")
+	if err != nil {
+		t.Skipf("cgroup v1 unavailable: %v", err)
+	}
+	if st.NrRunning+st.NrSleeping+st.NrStopped+st.NrUninterruptible+st.NrIoWait == 0 {
+		t.Errorf("got %+v", st)
+	}
+}
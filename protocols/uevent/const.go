@@ -0,0 +1,23 @@
+package uevent
+
+const (
+	NETLINK_KOBJECT_UEVENT = 15
+
+	/* Multicast groups */
+	UEVENT_GROUP_NONE   = 0
+	UEVENT_GROUP_KERNEL = 1
+	UEVENT_GROUP_UDEV   = 2
+
+	UDEV_MONITOR_MAGIC             = 0xfeedcafe
+	SizeofUdevMonitorNetlinkHeader = 40
+
+	/* Actions */
+	ACTION_ADD     = "add"
+	ACTION_REMOVE  = "remove"
+	ACTION_CHANGE  = "change"
+	ACTION_MOVE    = "move"
+	ACTION_ONLINE  = "online"
+	ACTION_OFFLINE = "offline"
+	ACTION_BIND    = "bind"
+	ACTION_UNBIND  = "unbind"
+)
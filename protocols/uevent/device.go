@@ -0,0 +1,265 @@
+package uevent
+
+import (
+	"bufio"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Device is a device of the database. Properties holds the properties the
+// kernel reports in uevent files and events, merged with the ones udev
+// stored or added, Tags the udev tags.
+type Device struct {
+	DevPath    string
+	Subsystem  string
+	DevType    string
+	Driver     string
+	DevNode    string
+	Properties map[string]string
+	Tags       []string
+}
+
+// DeviceDB mirrors the devices of the system. It is filled by Coldplug and
+// kept up to date with Apply. It should be fed the events of a single group:
+// udev events when udev is running, as they carry the properties and tags
+// it adds, and kernel events otherwise.
+type DeviceDB struct {
+	SysPath  string
+	UdevPath string
+
+	mu      sync.RWMutex
+	devices map[string]*Device
+}
+
+func NewDeviceDB() *DeviceDB {
+	return &DeviceDB{
+		SysPath:  "/sys",
+		UdevPath: "/run/udev/data",
+		devices:  map[string]*Device{},
+	}
+}
+
+// newDevice fills the fields of a device from its properties.
+func newDevice(devpath string, props map[string]string) *Device {
+	d := &Device{
+		DevPath:    devpath,
+		Subsystem:  props["SUBSYSTEM"],
+		DevType:    props["DEVTYPE"],
+		Driver:     props["DRIVER"],
+		Properties: props,
+		Tags:       parseTags(props["TAGS"]),
+	}
+
+	if name, ok := props["DEVNAME"]; ok {
+		if !strings.HasPrefix(name, "/") {
+			name = "/dev/" + name
+			props["DEVNAME"] = name
+		}
+		d.DevNode = name
+	}
+
+	return d
+}
+
+// udevId returns the name udev stores the database entry of a device under.
+func (d *Device) udevId() string {
+	major, minor := d.Properties["MAJOR"], d.Properties["MINOR"]
+	switch {
+	case major != "" && minor != "" && d.Subsystem == "block":
+		return "b" + major + ":" + minor
+	case major != "" && minor != "":
+		return "c" + major + ":" + minor
+	case d.Subsystem == "net" && d.Properties["IFINDEX"] != "":
+		return "n" + d.Properties["IFINDEX"]
+	}
+	return "+" + d.Subsystem + ":" + filepath.Base(d.DevPath)
+}
+
+// readUdevData merges the properties and tags udev stored for a device.
+func (db *DeviceDB) readUdevData(d *Device) {
+	f, err := os.Open(filepath.Join(db.UdevPath, d.udevId()))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	links := []string{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if len(line) < 2 || line[1] != ':' {
+			continue
+		}
+		switch line[0] {
+		case 'E':
+			if i := strings.IndexByte(line[2:], '='); i > 0 {
+				d.Properties[line[2:2+i]] = line[3+i:]
+			}
+		case 'G':
+			d.Tags = append(d.Tags, line[2:])
+		case 'S':
+			links = append(links, "/dev/"+line[2:])
+		}
+	}
+
+	if len(links) > 0 {
+		d.Properties["DEVLINKS"] = strings.Join(links, " ")
+	}
+	if len(d.Tags) > 0 {
+		d.Properties["TAGS"] = ":" + strings.Join(d.Tags, ":") + ":"
+	}
+}
+
+// readDevice reads the device of a sysfs directory, nil if it has no
+// subsystem.
+func (db *DeviceDB) readDevice(dir string) *Device {
+	subsystem, err := os.Readlink(filepath.Join(dir, "subsystem"))
+	if err != nil {
+		return nil
+	}
+
+	f, err := os.Open(filepath.Join(dir, "uevent"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	devpath := strings.TrimPrefix(dir, filepath.Clean(db.SysPath))
+	props := map[string]string{
+		"DEVPATH":   devpath,
+		"SUBSYSTEM": filepath.Base(subsystem),
+	}
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		if i := strings.IndexByte(line, '='); i > 0 {
+			props[line[:i]] = line[i+1:]
+		}
+	}
+
+	if _, ok := props["DRIVER"]; !ok {
+		if driver, err := os.Readlink(filepath.Join(dir, "driver")); err == nil {
+			props["DRIVER"] = filepath.Base(driver)
+		}
+	}
+
+	d := newDevice(devpath, props)
+	db.readUdevData(d)
+	return d
+}
+
+// Coldplug fills the database with the devices found under /sys/devices,
+// along with what udev stored about them, replacing its contents. It is
+// used at start and to resync once events were lost.
+func (db *DeviceDB) Coldplug() error {
+	devices := map[string]*Device{}
+
+	root := filepath.Join(db.SysPath, "devices")
+	err := filepath.WalkDir(root, func(p string, de fs.DirEntry, err error) error {
+		if err != nil {
+			// Some attributes vanish or can not be read while walking.
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if de.Name() != "uevent" || de.IsDir() {
+			return nil
+		}
+		if d := db.readDevice(filepath.Dir(p)); d != nil {
+			devices[d.DevPath] = d
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.mu.Lock()
+	db.devices = devices
+	db.mu.Unlock()
+
+	return nil
+}
+
+// Apply updates the database with an event. Devices are replaced by the
+// properties of their last event.
+func (db *DeviceDB) Apply(ev *Uevent) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	switch ev.Action {
+	case ACTION_REMOVE:
+		delete(db.devices, ev.DevPath)
+		return
+	case ACTION_MOVE:
+		// Children are moved along without events of their own.
+		old := ev.Env["DEVPATH_OLD"]
+		delete(db.devices, old)
+		for devpath, d := range db.devices {
+			if strings.HasPrefix(devpath, old+"/") {
+				delete(db.devices, devpath)
+				props := map[string]string{}
+				for key, value := range d.Properties {
+					props[key] = value
+				}
+				moved := *d
+				moved.DevPath = ev.DevPath + strings.TrimPrefix(devpath, old)
+				moved.Properties = props
+				props["DEVPATH"] = moved.DevPath
+				db.devices[moved.DevPath] = &moved
+			}
+		}
+	}
+
+	props := map[string]string{}
+	for key, value := range ev.Env {
+		switch key {
+		case "ACTION", "SEQNUM", "DEVPATH_OLD":
+			continue
+		}
+		props[key] = value
+	}
+
+	db.devices[ev.DevPath] = newDevice(ev.DevPath, props)
+}
+
+func (db *DeviceDB) Get(devpath string) (*Device, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	d, ok := db.devices[devpath]
+	return d, ok
+}
+
+// List returns the devices matching m, every device if m is nil, sorted by
+// devpath.
+func (db *DeviceDB) List(m *Match) []*Device {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	ret := []*Device{}
+	for _, d := range db.devices {
+		if m == nil || m.MatchDevice(d) {
+			ret = append(ret, d)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].DevPath < ret[j].DevPath
+	})
+
+	return ret
+}
+
+func (db *DeviceDB) Len() int {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return len(db.devices)
+}
@@ -0,0 +1,197 @@
+package uevent
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testSysfs builds a sysfs tree and a udev database in a temporary
+// directory and returns a database reading them. Every entry of files is a
+// file with its contents, or a symbolic link to the path after "->".
+func testSysfs(t *testing.T, files map[string]string) *DeviceDB {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, name)
+		err := os.MkdirAll(filepath.Dir(p), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(content) > 2 && content[:2] == "->" {
+			target := filepath.Join(dir, content[2:])
+			err = os.MkdirAll(target, 0755)
+			if err == nil {
+				err = os.Symlink(target, p)
+			}
+		} else {
+			err = os.WriteFile(p, []byte(content), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	db := NewDeviceDB()
+	db.SysPath = filepath.Join(dir, "sys")
+	db.UdevPath = filepath.Join(dir, "run/udev/data")
+	return db
+}
+
+const (
+	testPci  = "/devices/pci0000:00/0000:00:1f.2"
+	testDisk = testPci + "/block/sda"
+	testPart = testDisk + "/sda1"
+)
+
+func TestColdplug(t *testing.T) {
+	db := testSysfs(t, map[string]string{
+		"sys/devices/virtual/net/lo/uevent":    "INTERFACE=lo\nIFINDEX=1\n",
+		"sys/devices/virtual/net/lo/subsystem": "->sys/class/net",
+		"sys" + testPci + "/uevent":            "PCI_ID=8086:2922\n",
+		"sys" + testPci + "/subsystem":         "->sys/bus/pci",
+		"sys" + testPci + "/driver":            "->sys/bus/pci/drivers/ahci",
+		"sys" + testDisk + "/uevent":           "MAJOR=8\nMINOR=0\nDEVNAME=sda\nDEVTYPE=disk\n",
+		"sys" + testDisk + "/subsystem":        "->sys/class/block",
+		"sys" + testPart + "/uevent":           "MAJOR=8\nMINOR=1\nDEVNAME=sda1\nDEVTYPE=partition\n",
+		"sys" + testPart + "/subsystem":        "->sys/class/block",
+		/* not a device without a subsystem */
+		"sys/devices/system/cpu/uevent": "",
+		"run/udev/data/b8:0":            "S:disk/by-id/ata-test\nS:disk/by-uuid/1234\nE:ID_BUS=ata\nG:systemd\nG:uaccess\nI:100\n",
+		"run/udev/data/n1":              "E:ID_NET_NAME=lo\n",
+	})
+
+	err := db.Coldplug()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 4 {
+		t.Fatalf("got %+v", db.List(nil))
+	}
+
+	d, ok := db.Get(testDisk)
+	want := &Device{
+		DevPath:   testDisk,
+		Subsystem: "block",
+		DevType:   "disk",
+		DevNode:   "/dev/sda",
+		Properties: map[string]string{"DEVPATH": testDisk, "SUBSYSTEM": "block", "MAJOR": "8", "MINOR": "0",
+			"DEVNAME": "/dev/sda", "DEVTYPE": "disk", "ID_BUS": "ata", "DEVLINKS": "/dev/disk/by-id/ata-test /dev/disk/by-uuid/1234",
+			"TAGS": ":systemd:uaccess:"},
+		Tags: []string{"systemd", "uaccess"},
+	}
+	if !ok || !reflect.DeepEqual(d, want) {
+		t.Errorf("got %+v, want %+v", d, want)
+	}
+
+	if d, ok := db.Get(testPci); !ok || d.Subsystem != "pci" || d.Driver != "ahci" || d.DevNode != "" {
+		t.Errorf("got %+v", d)
+	}
+	if d, ok := db.Get("/devices/virtual/net/lo"); !ok || d.Properties["ID_NET_NAME"] != "lo" || len(d.Tags) != 0 {
+		t.Errorf("got %+v", d)
+	}
+
+	/* devices are sorted by devpath */
+	devices := db.List(&Match{Subsystem: []string{"block"}})
+	if len(devices) != 2 || devices[0].DevPath != testDisk || devices[1].DevPath != testPart {
+		t.Errorf("got %+v", devices)
+	}
+	devices = db.List(&Match{Tag: []string{"uaccess"}})
+	if len(devices) != 1 || devices[0].DevPath != testDisk {
+		t.Errorf("got %+v", devices)
+	}
+
+	/* a missing tree is an error, leaving the database alone */
+	db.SysPath = filepath.Join(db.SysPath, "missing")
+	if err := db.Coldplug(); err == nil || db.Len() != 4 {
+		t.Errorf("got %v, %d devices", err, db.Len())
+	}
+}
+
+func TestUdevId(t *testing.T) {
+	tests := []struct {
+		d  *Device
+		id string
+	}{
+		{newDevice(testDisk, map[string]string{"SUBSYSTEM": "block", "MAJOR": "8", "MINOR": "0"}), "b8:0"},
+		{newDevice("/devices/virtual/tty/tty1", map[string]string{"SUBSYSTEM": "tty", "MAJOR": "4", "MINOR": "1"}), "c4:1"},
+		{newDevice("/devices/virtual/net/eth0", map[string]string{"SUBSYSTEM": "net", "IFINDEX": "2"}), "n2"},
+		{newDevice(testPci, map[string]string{"SUBSYSTEM": "pci"}), "+pci:0000:00:1f.2"},
+	}
+
+	for _, test := range tests {
+		if id := test.d.udevId(); id != test.id {
+			t.Errorf("%s: got %s, want %s", test.d.DevPath, id, test.id)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	db := NewDeviceDB()
+	event := func(action, devpath string, env ...string) *Uevent {
+		ev := &Uevent{Action: action, DevPath: devpath, Env: map[string]string{
+			"ACTION": action, "DEVPATH": devpath, "SUBSYSTEM": "block", "SEQNUM": "1"}}
+		for i := 0; i+1 < len(env); i += 2 {
+			ev.Env[env[i]] = env[i+1]
+		}
+		return ev
+	}
+
+	db.Apply(event(ACTION_ADD, testDisk, "DEVNAME", "sda", "DEVTYPE", "disk"))
+	db.Apply(event(ACTION_ADD, testPart, "DEVNAME", "sda1", "DEVTYPE", "partition"))
+	d, ok := db.Get(testDisk)
+	if !ok || d.DevNode != "/dev/sda" || d.DevType != "disk" || d.Properties["ACTION"] != "" || d.Properties["SEQNUM"] != "" {
+		t.Errorf("got %+v", d)
+	}
+
+	/* devices take the properties of their last event */
+	db.Apply(event(ACTION_CHANGE, testDisk, "DEVNAME", "sda", "ID_FS_TYPE", "ext4"))
+	if d, _ := db.Get(testDisk); d.DevType != "" || d.Properties["ID_FS_TYPE"] != "ext4" {
+		t.Errorf("got %+v", d)
+	}
+
+	/* children move along with their parent */
+	part, _ := db.Get(testPart)
+	moved := testPci + "/block/sdb"
+	db.Apply(event(ACTION_MOVE, moved, "DEVPATH_OLD", testDisk, "DEVNAME", "sdb"))
+	if _, ok := db.Get(testDisk); ok || db.Len() != 2 {
+		t.Errorf("got %+v", db.List(nil))
+	}
+	if d, ok := db.Get(moved); !ok || d.DevNode != "/dev/sdb" || d.Properties["DEVPATH_OLD"] != "" {
+		t.Errorf("got %+v", d)
+	}
+	d, ok = db.Get(moved + "/sda1")
+	if !ok || d.DevPath != moved+"/sda1" || d.Properties["DEVPATH"] != moved+"/sda1" || d.DevNode != "/dev/sda1" {
+		t.Errorf("got %+v", d)
+	}
+	if part.DevPath != testPart || part.Properties["DEVPATH"] != testPart {
+		t.Errorf("device returned before the move changed: %+v", part)
+	}
+
+	db.Apply(event(ACTION_REMOVE, moved+"/sda1"))
+	db.Apply(event(ACTION_REMOVE, moved))
+	if db.Len() != 0 {
+		t.Errorf("got %+v", db.List(nil))
+	}
+}
+
+func TestColdplugSysfs(t *testing.T) {
+	if _, err := os.Stat("/sys/devices/virtual/net/lo"); err != nil {
+		t.Skipf("sysfs unavailable: %v", err)
+	}
+
+	db := NewDeviceDB()
+	err := db.Coldplug()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, ok := db.Get("/devices/virtual/net/lo")
+	if !ok || d.Subsystem != "net" || d.Properties["INTERFACE"] != "lo" || d.Properties["IFINDEX"] != "1" {
+		t.Errorf("got %+v", d)
+	}
+	if devices := db.List(&Match{Subsystem: []string{"net"}, Property: map[string]string{"INTERFACE": "lo"}}); len(devices) != 1 {
+		t.Errorf("got %+v", devices)
+	}
+}
@@ -0,0 +1,69 @@
+package uevent
+
+import (
+	"path"
+)
+
+// Match selects events and devices the way udev rules and libudev filters
+// do. Fields are shell globs, see path.Match. A device matches when its
+// subsystem matches one of Subsystem and its devtype one of DevType, when
+// every property in Property is set to a matching value and when it has
+// every tag in Tag. Empty fields match anything.
+type Match struct {
+	Subsystem []string
+	DevType   []string
+	Property  map[string]string
+	Tag       []string
+}
+
+func matchAny(globs []string, s string) bool {
+	if len(globs) == 0 {
+		return true
+	}
+	for _, glob := range globs {
+		if ok, _ := path.Match(glob, s); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Match) match(subsystem, devtype string, env map[string]string, tags []string) bool {
+	if !matchAny(m.Subsystem, subsystem) || !matchAny(m.DevType, devtype) {
+		return false
+	}
+
+	for key, glob := range m.Property {
+		value, ok := env[key]
+		if !ok {
+			return false
+		}
+		if ok, _ := path.Match(glob, value); !ok {
+			return false
+		}
+	}
+
+	for _, tag := range m.Tag {
+		found := false
+		for _, t := range tags {
+			if t == tag {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// MatchUevent reports whether ev matches. Only udev events carry tags.
+func (m *Match) MatchUevent(ev *Uevent) bool {
+	return m.match(ev.Subsystem, ev.DevType, ev.Env, ev.Tags())
+}
+
+func (m *Match) MatchDevice(d *Device) bool {
+	return m.match(d.Subsystem, d.DevType, d.Properties, d.Tags)
+}
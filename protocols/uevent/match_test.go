@@ -0,0 +1,52 @@
+package uevent
+
+import (
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	disk := &Uevent{
+		Subsystem: "block",
+		DevType:   "disk",
+		Udev:      true,
+		Env:       map[string]string{"ID_BUS": "usb", "ID_FS_TYPE": "", "TAGS": ":systemd:uaccess:"},
+	}
+	kernel := &Uevent{Subsystem: "net", Env: map[string]string{"INTERFACE": "eth0"}}
+
+	tests := []struct {
+		m     Match
+		ev    *Uevent
+		match bool
+	}{
+		{Match{}, disk, true},
+		{Match{Subsystem: []string{"block"}}, disk, true},
+		{Match{Subsystem: []string{"net", "bl*"}}, disk, true},
+		{Match{Subsystem: []string{"net"}}, disk, false},
+		{Match{DevType: []string{"partition"}}, disk, false},
+		/* a device without devtype matches the globs matching an empty string */
+		{Match{DevType: []string{"*"}}, kernel, true},
+		{Match{DevType: []string{"disk"}}, kernel, false},
+		{Match{Property: map[string]string{"ID_BUS": "usb"}}, disk, true},
+		{Match{Property: map[string]string{"ID_BUS": "u[rs]b", "ID_FS_TYPE": ""}}, disk, true},
+		{Match{Property: map[string]string{"ID_BUS": "ata"}}, disk, false},
+		/* properties need to be set, even to match an empty value */
+		{Match{Property: map[string]string{"ID_MODEL": "*"}}, disk, false},
+		{Match{Tag: []string{"uaccess", "systemd"}}, disk, true},
+		{Match{Tag: []string{"uaccess", "seat"}}, disk, false},
+		/* tags are not globs */
+		{Match{Tag: []string{"u*"}}, disk, false},
+		/* kernel events carry no tags */
+		{Match{Tag: []string{"systemd"}}, kernel, false},
+		{Match{Subsystem: []string{"net"}, Property: map[string]string{"INTERFACE": "eth*"}}, kernel, true},
+	}
+
+	for _, test := range tests {
+		if got := test.m.MatchUevent(test.ev); got != test.match {
+			t.Errorf("%+v on %+v: got %v", test.m, test.ev, got)
+		}
+		d := &Device{Subsystem: test.ev.Subsystem, DevType: test.ev.DevType, Properties: test.ev.Env, Tags: test.ev.Tags()}
+		if got := test.m.MatchDevice(d); got != test.match {
+			t.Errorf("%+v on %+v: got %v", test.m, d, got)
+		}
+	}
+}
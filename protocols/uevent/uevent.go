@@ -0,0 +1,232 @@
+package uevent
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/apuigsech/netlink"
+)
+
+type UeventNLSocket netlink.NetlinkSocket
+
+// Uevent is a device event, as sent by the kernel or, with Udev set, as
+// rebroadcast by udev once it processed it. Env holds every property of the
+// event, the ones with their own fields included.
+type Uevent struct {
+	Action    string
+	DevPath   string
+	Subsystem string
+	DevType   string
+	Seqnum    uint64
+	Udev      bool
+	Env       map[string]string
+}
+
+// UdevMonitorNetlinkHeader is the header of the messages udev sends. The
+// filter fields let receivers drop messages early and are kept in network
+// byte order, the offsets in host byte order.
+type UdevMonitorNetlinkHeader struct {
+	Prefix              [8]byte
+	Magic               uint32
+	HeaderSize          uint32
+	PropertiesOff       uint32
+	PropertiesLen       uint32
+	FilterSubsystemHash uint32
+	FilterDevtypeHash   uint32
+	FilterTagBloomHi    uint32
+	FilterTagBloomLo    uint32
+}
+
+type UeventCallback func(*Uevent, chan error, ...interface{})
+
+// Tags returns the udev tags of the event.
+func (ev *Uevent) Tags() []string {
+	return parseTags(ev.Env["TAGS"])
+}
+
+func parseTags(s string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(s, ":") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+func UdevMonitorNetlinkHeaderfromWireFormat(data []byte) *UdevMonitorNetlinkHeader {
+	hdr := &UdevMonitorNetlinkHeader{
+		Magic:               binary.BigEndian.Uint32(data[8:12]),
+		HeaderSize:          *(*uint32)(unsafe.Pointer(&data[12:16][0])),
+		PropertiesOff:       *(*uint32)(unsafe.Pointer(&data[16:20][0])),
+		PropertiesLen:       *(*uint32)(unsafe.Pointer(&data[20:24][0])),
+		FilterSubsystemHash: binary.BigEndian.Uint32(data[24:28]),
+		FilterDevtypeHash:   binary.BigEndian.Uint32(data[28:32]),
+		FilterTagBloomHi:    binary.BigEndian.Uint32(data[32:36]),
+		FilterTagBloomLo:    binary.BigEndian.Uint32(data[36:40]),
+	}
+	copy(hdr.Prefix[:], data[0:8])
+	return hdr
+}
+
+// parseEnv parses a list of zero terminated KEY=VALUE strings.
+func parseEnv(data []byte) map[string]string {
+	env := map[string]string{}
+	for _, kv := range bytes.Split(data, []byte{0}) {
+		i := bytes.IndexByte(kv, '=')
+		if i <= 0 {
+			continue
+		}
+		env[string(kv[:i])] = string(kv[i+1:])
+	}
+	return env
+}
+
+// ParseUevent parses a kernel uevent, "ACTION@DEVPATH" followed by its
+// properties, or a udev message, starting with "libudev".
+func ParseUevent(data []byte) (*Uevent, error) {
+	ev := &Uevent{}
+
+	if bytes.HasPrefix(data, []byte("libudev\x00")) {
+		if len(data) < SizeofUdevMonitorNetlinkHeader {
+			return nil, errors.New("short udev message")
+		}
+		hdr := UdevMonitorNetlinkHeaderfromWireFormat(data)
+		if hdr.Magic != UDEV_MONITOR_MAGIC {
+			return nil, errors.New("bad udev message magic")
+		}
+		off, n := int(hdr.PropertiesOff), int(hdr.PropertiesLen)
+		if off < SizeofUdevMonitorNetlinkHeader || off+n > len(data) {
+			return nil, errors.New("truncated udev message")
+		}
+		ev.Udev = true
+		ev.Env = parseEnv(data[off : off+n])
+	} else {
+		i := bytes.IndexByte(data, 0)
+		if i < 0 || bytes.IndexByte(data[:i], '@') < 0 {
+			return nil, errors.New("malformed uevent")
+		}
+		ev.Env = parseEnv(data[i+1:])
+	}
+
+	ev.Action = ev.Env["ACTION"]
+	ev.DevPath = ev.Env["DEVPATH"]
+	ev.Subsystem = ev.Env["SUBSYSTEM"]
+	ev.DevType = ev.Env["DEVTYPE"]
+	if ev.Action == "" || ev.DevPath == "" {
+		return nil, errors.New("uevent without action or devpath")
+	}
+	if seqnum, ok := ev.Env["SEQNUM"]; ok {
+		ev.Seqnum, _ = strconv.ParseUint(seqnum, 10, 64)
+	}
+
+	return ev, nil
+}
+
+// OpenLink opens a uevent socket receiving the events of the groups in the
+// group bitmask, UEVENT_GROUP_KERNEL or UEVENT_GROUP_UDEV. udev only
+// rebroadcasts events once it is done with them, so udev events carry the
+// properties and tags it added and the device nodes already exist.
+func OpenLink(group, pid uint32) (*UeventNLSocket, error) {
+	nl, err := netlink.OpenLink(NETLINK_KOBJECT_UEVENT, 0, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only messages from the kernel or from root are trusted.
+	err = nl.SetPassCred(true)
+	if err != nil {
+		nl.CloseLink()
+		return nil, err
+	}
+
+	for g := uint32(1); g <= UEVENT_GROUP_UDEV; g++ {
+		if group&(1<<(g-1)) == 0 {
+			continue
+		}
+		err = nl.AddMembership(g)
+		if err != nil {
+			nl.CloseLink()
+			return nil, err
+		}
+	}
+
+	return (*UeventNLSocket)(nl), nil
+}
+
+func (ul *UeventNLSocket) CloseLink() error {
+	nl := (*netlink.NetlinkSocket)(ul)
+	return nl.CloseLink()
+}
+
+func (ul *UeventNLSocket) AddMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(ul)
+	return nl.AddMembership(group)
+}
+
+func (ul *UeventNLSocket) DropMembership(group uint32) error {
+	nl := (*netlink.NetlinkSocket)(ul)
+	return nl.DropMembership(group)
+}
+
+// RecvUevent receives the next event. Kernel events sent by anyone but the
+// kernel, and udev events sent by anyone but root, are rejected with EPERM
+// like libudev does.
+func (ul *UeventNLSocket) RecvUevent(sockflags int) (*Uevent, error) {
+	nl := (*netlink.NetlinkSocket)(ul)
+	data, from, cred, err := nl.RecvMessagesRawFrom(netlink.RECV_BUFFER_SIZE, sockflags)
+	if err != nil {
+		return nil, err
+	}
+
+	ev, err := ParseUevent(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if from == nil || cred == nil {
+		return nil, syscall.EPERM
+	}
+	if ev.Udev {
+		if cred.Uid != 0 {
+			return nil, syscall.EPERM
+		}
+	} else if from.Pid != 0 {
+		return nil, syscall.EPERM
+	}
+
+	return ev, nil
+}
+
+// StartUeventMonitor calls cb for every event received matching m, every
+// event if m is nil. Events lost because the socket could not keep up are
+// reported as ENOBUFS on ec, after which a device database needs to be
+// filled again.
+func (ul *UeventNLSocket) StartUeventMonitor(m *Match, cb UeventCallback, ec chan error, args ...interface{}) error {
+	go func() {
+		for {
+			ev, err := ul.RecvUevent(0)
+			if err != nil {
+				if ec != nil {
+					ec <- err
+				}
+				if err == syscall.EBADF {
+					return
+				}
+				continue
+			}
+
+			if m != nil && !m.MatchUevent(ev) {
+				continue
+			}
+			cb(ev, ec, args...)
+		}
+	}()
+
+	return nil
+}
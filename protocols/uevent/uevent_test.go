@@ -0,0 +1,207 @@
+package uevent
+
+import (
+	"encoding/binary"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/apuigsech/netlink/protocols/route"
+)
+
+// udevMessage builds a message the way udev sends them, with the filter
+// fields set.
+func udevMessage(env ...string) []byte {
+	props := []byte(strings.Join(env, "\x00") + "\x00")
+	b := make([]byte, SizeofUdevMonitorNetlinkHeader)
+	copy(b, "libudev\x00")
+	binary.BigEndian.PutUint32(b[8:12], UDEV_MONITOR_MAGIC)
+	*(*uint32)(unsafe.Pointer(&b[12])) = SizeofUdevMonitorNetlinkHeader
+	*(*uint32)(unsafe.Pointer(&b[16])) = SizeofUdevMonitorNetlinkHeader
+	*(*uint32)(unsafe.Pointer(&b[20])) = uint32(len(props))
+	binary.BigEndian.PutUint32(b[24:28], 0x11223344)
+	binary.BigEndian.PutUint32(b[36:40], 1)
+	return append(b, props...)
+}
+
+func TestParseUevent(t *testing.T) {
+	kernel := []byte("add@/devices/virtual/net/dummy0\x00ACTION=add\x00DEVPATH=/devices/virtual/net/dummy0\x00" +
+		"SUBSYSTEM=net\x00INTERFACE=dummy0\x00IFINDEX=2\x00SEQNUM=1234\x00")
+	ev, err := ParseUevent(kernel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Uevent{
+		Action:    ACTION_ADD,
+		DevPath:   "/devices/virtual/net/dummy0",
+		Subsystem: "net",
+		Seqnum:    1234,
+		Env: map[string]string{"ACTION": "add", "DEVPATH": "/devices/virtual/net/dummy0", "SUBSYSTEM": "net",
+			"INTERFACE": "dummy0", "IFINDEX": "2", "SEQNUM": "1234"},
+	}
+	if !reflect.DeepEqual(ev, want) {
+		t.Errorf("got %+v, want %+v", ev, want)
+	}
+
+	udev := udevMessage("ACTION=change", "DEVPATH=/devices/virtual/block/loop0", "SUBSYSTEM=block", "DEVTYPE=disk",
+		"TAGS=:systemd:seat:", "ID_FS_TYPE=")
+	ev, err = ParseUevent(udev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ev.Udev || ev.Action != ACTION_CHANGE || ev.Subsystem != "block" || ev.DevType != "disk" || ev.Seqnum != 0 ||
+		!reflect.DeepEqual(ev.Tags(), []string{"systemd", "seat"}) || ev.Env["ID_FS_TYPE"] != "" {
+		t.Errorf("got %+v", ev)
+	}
+
+	hdr := UdevMonitorNetlinkHeaderfromWireFormat(udev)
+	if string(hdr.Prefix[:]) != "libudev\x00" || hdr.FilterSubsystemHash != 0x11223344 || hdr.FilterTagBloomLo != 1 {
+		t.Errorf("got %+v", hdr)
+	}
+
+	badMagic := udevMessage("ACTION=add", "DEVPATH=/devices/x")
+	badMagic[8] = 0
+	for _, data := range [][]byte{
+		[]byte("add /devices/x\x00ACTION=add\x00DEVPATH=/devices/x\x00"),
+		[]byte("add@/devices/x"),
+		[]byte("add@/devices/x\x00SUBSYSTEM=net\x00"),
+		udevMessage("ACTION=add", "DEVPATH=/devices/x")[:SizeofUdevMonitorNetlinkHeader+4],
+		udevMessage("ACTION=add")[:20],
+		badMagic,
+	} {
+		if ev, err := ParseUevent(data); err == nil {
+			t.Errorf("%q: got %+v", data, ev)
+		}
+	}
+}
+
+// testNetns moves the test to a network namespace of its own and returns a
+// uevent socket in it, joined to groups. Events of network devices are only
+// sent to the namespace they are in. The namespace lives on the thread of
+// the test, which is left locked so that the runtime throws it away when the
+// test ends. Tests are skipped when namespaces can not be created, such as
+// when unprivileged.
+func testNetns(t *testing.T, groups uint32) *UeventNLSocket {
+	t.Helper()
+	runtime.LockOSThread()
+
+	err := syscall.Unshare(syscall.CLONE_NEWNET)
+	if err != nil {
+		runtime.UnlockOSThread()
+		t.Skipf("network namespaces unavailable: %v", err)
+	}
+
+	ul, err := OpenLink(groups, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ul.CloseLink()
+	})
+
+	return ul
+}
+
+// nextUevent waits for the next event of a monitor.
+func nextUevent(t *testing.T, events chan *Uevent, ec chan error) *Uevent {
+	t.Helper()
+	select {
+	case ev := <-events:
+		return ev
+	case err := <-ec:
+		t.Fatal(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return nil
+}
+
+func TestUeventMonitor(t *testing.T) {
+	ul := testNetns(t, UEVENT_GROUP_KERNEL)
+
+	events := make(chan *Uevent, 10)
+	ec := make(chan error, 10)
+	cb := func(ev *Uevent, ec chan error, args ...interface{}) {
+		events <- ev
+	}
+	err := ul.StartUeventMonitor(&Match{Subsystem: []string{"net"}, Property: map[string]string{"INTERFACE": "ue*"}}, cb, ec)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rl, err := route.OpenLink(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rl.CloseLink()
+
+	err = rl.AddLink(&route.Link{Name: "ue0", Info: &route.Veth{PeerName: "other0"}})
+	if err == syscall.EOPNOTSUPP {
+		t.Skipf("unsupported by the kernel: %v", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := rl.GetLinkByName("ue0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	/* the peer of the link is filtered out */
+	db := NewDeviceDB()
+	ev := nextUevent(t, events, ec)
+	if ev.Udev || ev.Action != ACTION_ADD || ev.DevPath != "/devices/virtual/net/ue0" || ev.Subsystem != "net" ||
+		ev.Seqnum == 0 || ev.Env["IFINDEX"] != strconv.Itoa(int(l.Index)) {
+		t.Errorf("got %+v", ev)
+	}
+	db.Apply(ev)
+
+	err = rl.DelLink(l.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev = nextUevent(t, events, ec)
+	if ev.Action != ACTION_REMOVE || ev.DevPath != "/devices/virtual/net/ue0" {
+		t.Errorf("got %+v", ev)
+	}
+	db.Apply(ev)
+	if db.Len() != 0 {
+		t.Errorf("got %+v", db.List(nil))
+	}
+}
+
+// sendUevent multicasts data to a uevent group the way udev does.
+func sendUevent(t *testing.T, group uint32, data []byte) {
+	t.Helper()
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW, NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+	err = syscall.Sendto(fd, data, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1 << (group - 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecvUeventSender(t *testing.T) {
+	ul := testNetns(t, UEVENT_GROUP_KERNEL|UEVENT_GROUP_UDEV)
+
+	/* kernel events only come from the kernel */
+	sendUevent(t, UEVENT_GROUP_KERNEL, []byte("add@/devices/x\x00ACTION=add\x00DEVPATH=/devices/x\x00"))
+	if ev, err := ul.RecvUevent(0); err != syscall.EPERM {
+		t.Errorf("kernel event from userspace: got %+v, %v", ev, err)
+	}
+
+	/* udev events come from root */
+	sendUevent(t, UEVENT_GROUP_UDEV, udevMessage("ACTION=add", "DEVPATH=/devices/x", "SUBSYSTEM=test"))
+	ev, err := ul.RecvUevent(0)
+	if err != nil || !ev.Udev || ev.Subsystem != "test" {
+		t.Errorf("udev event: got %+v, %v", ev, err)
+	}
+}